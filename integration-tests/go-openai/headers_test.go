@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadersModelSetsResponseHeaders(t *testing.T) {
+	client := setupClient(t)
+
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: "headers",
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: "X-TeenyTiny-Trace: go-openai\nRetry-After: 7",
+				},
+			},
+		},
+	)
+
+	require.NoError(t, err)
+	assert.Equal(t, "go-openai", resp.Header().Get("X-TeenyTiny-Trace"))
+	assert.Equal(t, "7", resp.Header().Get("Retry-After"))
+	assert.Equal(t, "Set X-TeenyTiny-Trace: go-openai\nSet Retry-After: 7", resp.Choices[0].Message.Content)
+}
+
+func TestHeadersModelRefusesUnsafeHeaders(t *testing.T) {
+	client := setupClient(t)
+
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: "headers",
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: "Set-Cookie: session=stolen",
+				},
+			},
+		},
+	)
+
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header().Get("Set-Cookie"))
+	assert.Contains(t, resp.Choices[0].Message.Content, "Refused Set-Cookie")
+}
+
+func TestHeadersModelSetsStreamingResponseHeaders(t *testing.T) {
+	client := setupClient(t)
+
+	stream, err := client.CreateChatCompletionStream(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: "headers",
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: "X-TeenyTiny-Trace: go-openai-stream",
+				},
+			},
+			Stream: true,
+		},
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	assert.Equal(t, "go-openai-stream", stream.Header().Get("X-TeenyTiny-Trace"))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationHeaderIsEchoed(t *testing.T) {
+	baseURL := os.Getenv("TEENYTINY_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	apiKey := os.Getenv("TEENYTINY_API_KEY")
+	if apiKey == "" {
+		apiKey = "testkey"
+	}
+
+	// The server under test runs without --organizations, so any id is accepted
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL + "/v1"
+	config.OrgID = "org-go-openai"
+	client := openai.NewClientWithConfig(config)
+
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: "echo",
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: "Hello from an organization",
+				},
+			},
+		},
+	)
+
+	require.NoError(t, err)
+	assert.Equal(t, "org-go-openai", resp.Header().Get("openai-organization"))
+	assert.Equal(t, "Hello from an organization", resp.Choices[0].Message.Content)
+}
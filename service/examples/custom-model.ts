@@ -0,0 +1,31 @@
+/**
+ * Embeds the server with one extra model, "shout", which upper-cases the
+ * latest user message.
+ *
+ *   npx tsx examples/custom-model.ts
+ *   curl http://localhost:8080/v1/chat/completions \
+ *     -H 'Authorization: Bearer tt-1234567890abcdef' \
+ *     -H 'Content-Type: application/json' \
+ *     -d '{"model": "shout", "messages": [{"role": "user", "content": "hello"}]}'
+ *
+ * Outside this repository, import from 'teenytiny-api/server' instead.
+ */
+import { createServer } from '../src/teenytiny.js';
+import type { Model } from '../src/teenytiny.js';
+
+class ShoutModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    yield input.toUpperCase() || 'SAY SOMETHING!';
+  }
+}
+
+const server = createServer({
+  auth: { apiKey: 'tt-1234567890abcdef' },
+  models: [{ id: 'shout', model: new ShoutModel() }],
+});
+
+const stop = new AbortController();
+process.on('SIGINT', () => stop.abort());
+
+const { port } = await server.listen({ port: 8080, signal: stop.signal });
+console.log(`Listening on http://localhost:${port}, try the "shout" model`);
@@ -3,31 +3,445 @@ import { Hono } from "hono";
 // Define types for Hono context variables
 type Variables = {
   requestId: string;
+  timing: RequestTimer;
+  completion: CompletionOutcome;
 };
 import { stream } from "hono/streaming";
-import type { ChatCompletionRequest } from "./openai-protocol/types.js";
+import {
+  RESPONSE_ID_PREFIX_HEADER,
+  validateChatCompletionRequest,
+  validateEmbeddingRequest,
+  validateResponseIdPrefix,
+} from "./openai-protocol/request-validation.js";
 import {
   InvalidRequestError,
+  ModelUnavailableError,
   NotFoundError,
 } from "./openai-protocol/errors.js";
+import type { ErrorVerbosity } from "./openai-protocol/errors.js";
 import { ModelRegistry } from "./models/model-registry.js";
+import type { Model, ModelCapabilities } from "./models/model.js";
 import { OpenAIModelRegistry } from "./openai-protocol/openai-model-registry.js";
+import type { ChoiceOptions, TransportHints } from "./openai-protocol/adapter.js";
+import type { IdGenerator } from "./openai-protocol/ids.js";
 import { EchoModel } from "./models/echo-model.js";
 import { ElizaModel } from "./models/eliza-model.js";
 import { ParryModel } from "./models/parry-model.js";
 import { RacterModel } from "./models/racter-model.js";
-import { createAuthMiddleware } from "./middleware/auth.js";
+import { ToolCallModel } from "./models/toolcall-model.js";
+import { InterleavedModel } from "./models/interleaved-model.js";
+import type { InterleavedScript } from "./models/interleaved-model.js";
+import {
+  CountdownModel,
+  parseCountdownOptions,
+} from "./models/countdown-model.js";
+import type { CountdownOptions } from "./models/countdown-model.js";
+import {
+  parseRefuserOptions,
+  RefuserModel,
+} from "./models/refuser-model.js";
+import { AcronymModel } from "./models/acronym-model.js";
+import { PalindromeModel } from "./models/palindrome-model.js";
+import { ShuffleModel } from "./models/shuffle-model.js";
+import { ReverseModel } from "./models/reverse-model.js";
+import { FanoutModel } from "./models/fanout-model.js";
+import { ChunkyModel } from "./models/chunky-model.js";
+import { FinishReasonModel } from "./models/finishreason-model.js";
+import { NormalizeModel } from "./models/normalize-model.js";
+import type { NormalizationForm } from "./models/normalize-model.js";
+import { UsageModel } from "./models/usage-model.js";
+import { HeadersModel } from "./models/headers-model.js";
+import {
+  maskRequestHeaders,
+  RequestHeadersModel,
+} from "./models/request-headers-model.js";
+import { SSETortureModel } from "./models/sse-torture-model.js";
+import { Utf8SplitModel } from "./models/utf8-split-model.js";
+import {
+  DEFAULT_ESCALATING_SCRIPT,
+  EscalatingModel,
+} from "./models/escalating-model.js";
+import type { EscalatingStep } from "./models/escalating-model.js";
+import { AttemptTracker } from "./utils/attempt-tracker.js";
+import type { AttemptTrackerConfig } from "./utils/attempt-tracker.js";
+import { LatencyEchoModel } from "./models/latency-echo-model.js";
+import { LatencyModel } from "./models/latency-model.js";
+import {
+  embed,
+  EMBEDDING_DIMENSIONS,
+  EmbeddingModel,
+  MAX_EMBEDDING_BATCH_SIZE,
+  MAX_EMBEDDING_DIMENSIONS,
+} from "./models/embedding-model.js";
+import { AnnotateModel } from "./models/annotate-model.js";
+import type { CannedModel } from "./models/canned-models.js";
+import { orderVirtualModels } from "./models/virtual-models.js";
+import type { VirtualModel } from "./models/virtual-models.js";
+import { HistoryModel } from "./models/history-model.js";
+import { RedactorModel } from "./models/redactor-model.js";
+import { SystemEchoModel } from "./models/system-echo-model.js";
+import { VisionModel } from "./models/vision-model.js";
+import { RefineModel } from "./models/refine-model.js";
+import { MarkdownModel } from "./models/markdown-model.js";
+import { MarkdownTortureModel } from "./models/markdown-torture-model.js";
+import { ResponsesModel } from "./models/responses-model.js";
+import { JsonPatchModel } from "./models/jsonpatch-model.js";
+import { CsvModel } from "./models/csv-model.js";
+import type { ResponseMap, ResponseMapFallback } from "./models/responses-model.js";
+import type { VisionFetchOptions } from "./models/vision-model.js";
+import type { AnnotateOptions } from "./models/annotate-model.js";
+import { PromptLatencyModelware } from "./modelware/prompt-latency-modelware.js";
+import { GarbleModelware } from "./modelware/garble-modelware.js";
+import { TransformModelware } from "./modelware/transform-modelware.js";
+import type { GarbleOptions } from "./modelware/garble-modelware.js";
+import { chunkDropper } from "./utils/chunk-drop.js";
+import type { ChunkDropOptions } from "./utils/chunk-drop.js";
+import type { RefuserOptions } from "./models/refuser-model.js";
+import {
+  bearerToken,
+  createAuthMiddleware,
+} from "./middleware/auth.js";
+import { clientIp } from "./middleware/client-ip.js";
 import { corsMiddleware } from "./middleware/cors.js";
-import { createLoggingMiddleware } from "./middleware/logging.js";
+import type { CorsConfig } from "./middleware/cors.js";
+import {
+  createLoggingMiddleware,
+  LogFilter,
+  parseLogFilterConfig,
+} from "./middleware/logging.js";
+import type { LogFilterConfig } from "./middleware/logging.js";
 import { createErrorHandler } from "./middleware/errors.js";
+import {
+  createIdempotencyMiddleware,
+  DEFAULT_IDEMPOTENCY_CONFIG,
+  IdempotencyStore,
+} from "./middleware/idempotency.js";
+import type { IdempotencyConfig } from "./middleware/idempotency.js";
+import {
+  createQueueMiddleware,
+  PRIORITIES,
+  RequestQueue,
+} from "./middleware/queue.js";
+import type { Priority, QueueConfig } from "./middleware/queue.js";
+import {
+  createPriorityClassifier,
+  PRIORITY_SERVICE_TIERS,
+  requestPriority,
+} from "./middleware/priority.js";
+import {
+  createMaintenanceMiddleware,
+  MaintenanceMode,
+  parseMaintenanceUpdate,
+} from "./middleware/maintenance.js";
+import {
+  createOrganizationMiddleware,
+  requestOrganization,
+} from "./middleware/organization.js";
+import type { OrganizationConfig } from "./middleware/organization.js";
+import { ConcurrencyLimiter, createIpLimitMiddleware } from "./middleware/ip-limit.js";
+import type { IpLimitConfig } from "./middleware/ip-limit.js";
+import { createStreamLimitMiddleware } from "./middleware/stream-limit.js";
+import { createJsonBodyMiddleware, jsonBody } from "./middleware/json-body.js";
+import { createWebhookMiddleware } from "./middleware/webhook.js";
+import { createRequestHistoryMiddleware } from "./middleware/request-history.js";
+import type { CompletionOutcome } from "./middleware/webhook.js";
+import { createShadowMiddleware } from "./middleware/shadow.js";
+import {
+  createRateLimitMiddleware,
+  RateLimiter,
+} from "./middleware/rate-limit.js";
+import type { RateLimitConfig } from "./middleware/rate-limit.js";
+import { createQuotaMiddleware, QuotaTracker } from "./middleware/quota.js";
+import type { QuotaConfig } from "./middleware/quota.js";
 import { SingleKeyAuthenticator } from "./auth/single-key-authenticator.js";
 import { EncryptedKeyAuthenticator } from "./auth/encrypted-key-authenticator.js";
 import { FallbackKeyAuthenticator } from "./auth/fallback-key-authenticator.js";
 import type { Authenticator } from "./auth/authenticator.js";
 import type { AuthConfig } from "./auth/auth-config.js";
+import { readJsonBody } from "./utils/request-body.js";
+import { checkGeneration } from "./utils/health-check.js";
+import { ModelHealthMonitor } from "./utils/model-health.js";
+import type { ModelHealthConfig } from "./utils/model-health.js";
+import type { ListenerStatus } from "./utils/listen-address.js";
+import {
+  appliedOverrides,
+  forcedStatusError,
+  OVERRIDES_APPLIED_HEADER,
+  parseHeaderOverrides,
+} from "./utils/header-overrides.js";
+import type { HeaderOverrides } from "./utils/header-overrides.js";
+import { sleep } from "./utils/sleep.js";
+import {
+  SCENARIO_HEADER,
+  StreamScenarios,
+} from "./utils/stream-scenarios.js";
+import type {
+  ScenarioClock,
+  ScenarioStep,
+  StreamScenarioConfig,
+} from "./utils/stream-scenarios.js";
+import { Logger } from "./utils/logger.js";
+import type { LogEntry } from "./utils/logger.js";
+import { encodeSSEJson, isSSEVariant } from "./openai-protocol/sse.js";
+import { writeChatCompletionStream } from "./openai-protocol/stream-writer.js";
+import type { SSEEvent } from "./openai-protocol/stream-writer.js";
+import { minimalCompletion } from "./openai-protocol/minimal.js";
+import { contentToText, embeddingToBase64, MAX_CHOICES } from "./openai-protocol/types.js";
+import type {
+  ChatCompletionMessage,
+  ChatCompletionResponse,
+  ChatCompletionUsage,
+  ContentFilterResult,
+  EmbeddingResponse,
+} from "./openai-protocol/types.js";
+import { maskAPIKey } from "./utils/audit-log.js";
+import type { AuditLogger } from "./utils/audit-log.js";
+import type { SecurityLogger } from "./utils/security-log.js";
+import type { RequestTimer } from "./utils/request-timer.js";
+import { WebhookNotifier } from "./utils/webhook.js";
+import {
+  sendTrailers,
+  USAGE_TRAILERS,
+  usageTrailers,
+} from "./utils/trailers.js";
+import type { WebhookConfig } from "./utils/webhook.js";
+import { ShadowMirror } from "./utils/shadow.js";
+import type { ShadowConfig } from "./utils/shadow.js";
+import { SessionStore } from "./utils/session-store.js";
+import type { SessionConfig } from "./utils/session-store.js";
+import { ResponseCache, responseCacheKey } from "./utils/response-cache.js";
+import type { ResponseCacheConfig } from "./utils/response-cache.js";
+import { REQUEST_SIZE_BUCKETS, RequestSizeStats } from "./utils/request-sizes.js";
+import type { RequestSizeMeasure } from "./utils/request-sizes.js";
+import {
+  PROMETHEUS_CONTENT_TYPE,
+  counter,
+  formatMetrics,
+  gauge,
+  histogram,
+} from "./utils/prometheus.js";
+import {
+  DEFAULT_REQUEST_HISTORY_LIMIT,
+  RequestHistory,
+} from "./utils/request-history.js";
 
 export interface AppConfig {
   auth: AuthConfig;
+  // Largest accepted request body; larger bodies are rejected with 413
+  maxRequestBytes?: number;
+  // Largest accepted prompt in estimated tokens, independent of output length
+  maxPromptTokens?: number | undefined;
+  // Hard cap on completion length in estimated tokens, overriding larger
+  // max_tokens in requests; capped completions finish with length
+  maxOutputTokens?: number | undefined;
+  // Simulated capacity: completions beyond maxConcurrent wait, up to
+  // maxQueued, then get 503 (off by default)
+  queue?: QueueConfig | undefined;
+  // Queue priority of API keys whose requests leave service_tier to the
+  // server, reported back as the tier they ran on (normal when unlisted)
+  priorities?: Record<string, Priority> | undefined;
+  // Retry-After sent with 503s while PUT /admin/maintenance has the server in
+  // maintenance mode (DEFAULT_MAINTENANCE_RETRY_AFTER_SECONDS when unset)
+  maintenanceRetryAfterSeconds?: number | undefined;
+  // Accepted OpenAI-Organization and OpenAI-Project ids; unknown ones get
+  // 401 (any accepted by default). Both are echoed back either way
+  organizations?: OrganizationConfig | undefined;
+  // Models left out of the registry, e.g. to see how clients cope
+  disabledModels?: string[] | undefined;
+  // How long the /health/deep test generation may take before it's
+  // reported as failing (default 1000ms)
+  healthCheckTimeoutMs?: number | undefined;
+  // Serve POST /v1/teenytiny/trace, which returns the SSE events a chat
+  // completion would stream as JSON (also served with admin enabled)
+  trace?: boolean | undefined;
+  // Lets the vision model download http(s) images within these limits;
+  // otherwise it only echoes their URLs
+  visionFetch?: VisionFetchOptions | undefined;
+  // Bind status of the addresses being served, reported by /health/deep;
+  // provided by createServer
+  listeners?: (() => ListenerStatus[]) | undefined;
+  // Methods, headers and preflight max age allowed to browser clients
+  cors?: CorsConfig | undefined;
+  // Concurrent API requests per client IP; more get 429 (no limit by default)
+  ipLimit?: IpLimitConfig | undefined;
+  // Addresses of reverse proxies whose X-Forwarded-For names the client IP,
+  // for per-IP limits and the security log; with none, clients are told
+  // apart by the socket address alone
+  trustedProxies?: string[] | undefined;
+  // Streamed chat completions open at once per API key; more get 429 (no
+  // limit by default)
+  maxStreamsPerKey?: number | undefined;
+  // Requests per window by endpoint, optionally overridden per API key;
+  // exceeding one gives 429 (unlimited by default)
+  rateLimits?: RateLimitConfig | undefined;
+  // Total chat completion tokens per API key; once spent, requests get 429
+  // insufficient_quota until reset via /admin/quotas (unlimited by default)
+  quotas?: QuotaConfig | undefined;
+  // Replay window for requests carrying an Idempotency-Key header
+  idempotency?: IdempotencyConfig;
+  // Replays non-streaming responses of deterministic models for identical
+  // requests, flushed via /admin/cache (off by default)
+  cache?: ResponseCacheConfig | undefined;
+  // Server-side transcripts under /v1/teenytiny/sessions, continued by
+  // completions carrying X-Session-Id (off by default)
+  sessions?: SessionConfig | undefined;
+  // Debugging endpoints under /admin, authenticated like /v1 (off by default)
+  admin?: AdminConfig;
+  // Named stall and burst timelines that streams pick with
+  // X-TeenyTiny-Scenario; also definable via /admin/scenarios
+  streamScenarios?: StreamScenarioConfig | undefined;
+  // Time source for scenarios, so tests needn't wait out their stalls
+  scenarioClock?: ScenarioClock | undefined;
+  logger?: Logger | undefined;
+  // Access log routes to suppress or sample; adjustable via /admin/log-filters
+  logFilters?: LogFilterConfig | undefined;
+  idGenerator?: IdGenerator;
+  // Reply with output_text content parts when the user sent array content
+  mirrorArrayContent?: boolean;
+  // Send empty content alongside the role in the first streamed chunk
+  roleChunkContent?: boolean;
+  // Sampling defaults for requests that leave them out (OpenAI's when unset)
+  defaultTemperature?: number | undefined;
+  defaultTopP?: number | undefined;
+  // Add the resolved sampling parameters to responses as x_parameters, so
+  // tests can confirm defaults applied (off, as OpenAI has no such field)
+  reflectParameters?: boolean | undefined;
+  // Degraded mode: send chat completions with none of their optional fields
+  // (usage, system_fingerprint, service_tier, ...), to test that clients
+  // cope with the sparsest valid responses
+  minimalResponses?: boolean | undefined;
+  // Content filter results added to chat completions as Azure OpenAI's
+  // prompt_filter_results, keyed by category (off by default)
+  promptFilterResults?: Record<string, ContentFilterResult> | undefined;
+  // Formatting overhead in prompt_tokens: per message, and once for priming
+  // the reply (OpenAI's 3 and 3 when unset)
+  tokensPerMessage?: number | undefined;
+  replyPrimingTokens?: number | undefined;
+  // Send streamed completions' usage as X-Usage-* HTTP trailers too (only
+  // possible on the Node.js server)
+  usageTrailers?: boolean;
+  // Honour X-TeenyTiny-Model, -Delay, -Chunking and -Force-Status request
+  // headers; off by default so requests behave exactly as the spec says
+  allowHeaderOverrides?: boolean;
+  // Default count, cap and per-chunk delay for the countdown model
+  countdown?: CountdownOptions;
+  // Time to first chunk of the slowprompt model, per estimated prompt token
+  promptLatencyMsPerToken?: number | undefined;
+  // Trigger phrases and refusal text for the refuser model
+  refuser?: RefuserOptions;
+  // What the interleaved model says and calls (default
+  // DEFAULT_INTERLEAVED_SCRIPT)
+  interleaved?: InterleavedScript | undefined;
+  // Exact prompts the responses model answers with fixed replies, and what
+  // it does with other prompts (echo them by default)
+  responses?: ResponseMap | undefined;
+  responsesFallback?: ResponseMapFallback | undefined;
+  // The escalating model's failure script, and how long and how many
+  // requests' attempts it remembers
+  escalating?: {
+    script?: EscalatingStep[] | undefined;
+    attempts?: AttemptTrackerConfig | undefined;
+  } | undefined;
+  // Registered as the exec model when set; built by the Node.js server since
+  // it runs external commands (see ExecModel)
+  exec?: Model | undefined;
+  // Makes every outbound request: vision downloads, webhook deliveries and
+  // shadow mirroring. The Node.js server passes one honouring its proxy
+  // settings; the global fetch otherwise.
+  outboundFetch?: typeof fetch | undefined;
+  // Catalog entries such as gpt-4, answered by echo for chat and by the
+  // embedding model for embeddings, replacing built-ins with the same id
+  cannedModels?: CannedModel[] | undefined;
+  // Model ids served by other models with forced parameters, a default
+  // system prompt and text transforms, e.g. echo-loud
+  virtualModels?: VirtualModel[] | undefined;
+  // Models whose output now and then gets a garbage token, by model id
+  // (off by default)
+  garble?: Record<string, GarbleOptions> | undefined;
+  // Models whose streams lose chunks of output now and then, by model id,
+  // for chaos testing SSE clients (off by default)
+  dropChunks?: Record<string, ChunkDropOptions> | undefined;
+  // Models the fanout model answers with, one choice each, e.g. echo and
+  // reverse; no fanout model without them
+  fanout?: string[] | undefined;
+  // Extra models registered after the built-in ones, replacing any with the
+  // same id
+  models?: CustomModel[] | undefined;
+  // Background checks of models with external dependencies (see
+  // Model.checkHealth), shown in /v1/models and /health/deep; off when unset
+  modelHealth?: ModelHealthConfig | undefined;
+  // Default vector length of the embedding model, and the most a request's
+  // dimensions may ask for
+  embeddingDimensions?: number | undefined;
+  maxEmbeddingDimensions?: number | undefined;
+  // Most inputs one embeddings request may send (default 2048)
+  maxEmbeddingBatchSize?: number | undefined;
+  // Most choices a chat completion's n may ask for (OpenAI's 128 when unset)
+  maxChoices?: number | undefined;
+  // Sources the annotate model cites
+  annotate?: AnnotateOptions;
+  // Unicode normalization form applied by the normalize model (default NFC)
+  normalizeForm?: NormalizationForm;
+  // Writes a JSONL audit record per chat completion when set
+  audit?: AuditLogger | undefined;
+  // Posts a summary of each chat completion, errors included, to a URL
+  webhook?: WebhookConfig | undefined;
+  // Replays each chat completion, non-streaming, to another API in the
+  // background and compares status, latency and usage via /admin/shadow
+  shadow?: ShadowConfig | undefined;
+  // Hash-chained record of auth failures, key creation and admin use
+  security?: SecurityLogger | undefined;
+  // Detail level of error messages; defaults to terse
+  errorVerbosity?: ErrorVerbosity;
+}
+
+// A model supplied by a program embedding the server
+export interface CustomModel {
+  id: string;
+  model: Model;
+  capabilities?: ModelCapabilities | undefined;
+  // The options the model was built with, for its system_fingerprint
+  settings?: unknown;
+}
+
+export interface AdminConfig {
+  enabled: boolean;
+  // Recent /v1 requests kept for /admin/requests (default 50)
+  requestHistory?: number | undefined;
+}
+
+// One SSE event as /v1/teenytiny/trace reports it
+interface TraceEvent {
+  index: number;
+  type: SSEEvent["kind"];
+  // Exactly the text written, framing included
+  raw: string;
+  // The object in chunk and error events, null for the rest
+  parsed: unknown;
+  bytes: number;
+  // Separate writes the event took; more than one for split framing
+  writes: number;
+  // Since the stream started, to a tenth of a millisecond
+  offset_ms: number;
+}
+
+function traceEvent(index: number, event: SSEEvent, offsetMs: number): TraceEvent {
+  const bytes = new Uint8Array(event.pieces.reduce((total, piece) => total + piece.length, 0));
+  let offset = 0;
+  for (const piece of event.pieces) {
+    bytes.set(piece, offset);
+    offset += piece.length;
+  }
+  return {
+    index,
+    type: event.kind,
+    // Keeping any byte order mark the bom variant writes
+    raw: new TextDecoder("utf-8", { ignoreBOM: true }).decode(bytes),
+    parsed: event.value ?? null,
+    bytes: bytes.length,
+    writes: event.pieces.length,
+    offset_ms: Math.round(offsetMs * 10) / 10,
+  };
 }
 
 // Helper function to create pretty-printed JSON responses
@@ -37,7 +451,39 @@ function prettyJson(c: any, data: any) {
 }
 
 export function createApp(config: AppConfig) {
+  return buildApp(config).app;
+}
+
+// The app along with the registry and request sizes behind it, for the
+// server that runs it
+export function buildApp(config: AppConfig) {
   const app = new Hono<{ Variables: Variables }>();
+  const logger = config.logger ?? new Logger();
+  const logFilter = new LogFilter(config.logFilters);
+  const sessions = config.sessions ? new SessionStore(config.sessions) : undefined;
+  const cache = config.cache ? new ResponseCache(config.cache) : undefined;
+  const queue = config.queue ? new RequestQueue(config.queue) : undefined;
+  const idempotency = new IdempotencyStore(config.idempotency ?? DEFAULT_IDEMPOTENCY_CONFIG);
+  const requestSizes = new RequestSizeStats();
+  const history = new RequestHistory(config.admin?.requestHistory);
+  const quotas = config.quotas ? new QuotaTracker(config.quotas) : undefined;
+  const maintenance = new MaintenanceMode(config.maintenanceRetryAfterSeconds);
+  const scenarios =
+    config.streamScenarios || config.admin?.enabled
+      ? new StreamScenarios(config.streamScenarios)
+      : undefined;
+  const webhook = config.webhook
+    ? new WebhookNotifier(config.webhook, logger, config.outboundFetch)
+    : undefined;
+  const shadow = config.shadow
+    ? new ShadowMirror(config.shadow, logger, config.outboundFetch)
+    : undefined;
+  const embeddingDimensions = config.embeddingDimensions ?? EMBEDDING_DIMENSIONS;
+  const maxEmbeddingDimensions =
+    config.maxEmbeddingDimensions ?? MAX_EMBEDDING_DIMENSIONS;
+  const maxEmbeddingBatchSize =
+    config.maxEmbeddingBatchSize ?? MAX_EMBEDDING_BATCH_SIZE;
+  const maxChoices = config.maxChoices ?? MAX_CHOICES;
 
   // Initialize authenticator with fallback chain for graceful migration to new key formats
   const authenticator: Authenticator = new FallbackKeyAuthenticator([
@@ -51,23 +497,361 @@ export function createApp(config: AppConfig) {
 
   // Initialize model registries
   const coreRegistry = new ModelRegistry();
-  const openaiRegistry = new OpenAIModelRegistry(coreRegistry);
+  const openaiRegistry = new OpenAIModelRegistry(coreRegistry, {
+    idGenerator: config.idGenerator,
+    mirrorArrayContent: config.mirrorArrayContent,
+    roleChunkContent: config.roleChunkContent,
+    defaultTemperature: config.defaultTemperature,
+    defaultTopP: config.defaultTopP,
+    reflectParameters: config.reflectParameters,
+    promptFilterResults: config.promptFilterResults,
+    tokensPerMessage: config.tokensPerMessage,
+    replyPrimingTokens: config.replyPrimingTokens,
+    maxPromptTokens: config.maxPromptTokens,
+    maxOutputTokens: config.maxOutputTokens,
+  });
 
   // Register models directly without any modelware decorations for fast responses
   openaiRegistry.register("echo", new EchoModel());
-  openaiRegistry.register("eliza", new ElizaModel());
-  openaiRegistry.register("parry", new ParryModel());
-  openaiRegistry.register("racter", new RacterModel());
+  // Seedless random replies, so never served from the response cache
+  openaiRegistry.register("eliza", new ElizaModel(), { deterministic: false });
+  openaiRegistry.register("parry", new ParryModel(), { deterministic: false });
+  openaiRegistry.register("racter", new RacterModel(), { deterministic: false });
+  openaiRegistry.register("toolcall", new ToolCallModel());
+  // Models built with options pass them too, for their system_fingerprint
+  openaiRegistry.register(
+    "countdown",
+    new CountdownModel(config.countdown),
+    {},
+    config.countdown,
+  );
+  openaiRegistry.register(
+    "refuser",
+    new RefuserModel(config.refuser),
+    {},
+    config.refuser,
+  );
+  openaiRegistry.register(
+    "interleaved",
+    new InterleavedModel(config.interleaved),
+    {},
+    config.interleaved,
+  );
+  openaiRegistry.register("acronym", new AcronymModel());
+  openaiRegistry.register("palindrome", new PalindromeModel());
+  openaiRegistry.register("shuffle", new ShuffleModel(), {
+    deterministic: false,
+  });
+  // Reversed replies are whole, so there's no prefill to continue
+  openaiRegistry.register("reverse", new ReverseModel(), { supportsPrefill: false });
+  openaiRegistry.register("chunky", new ChunkyModel());
+  openaiRegistry.register("finishreason", new FinishReasonModel());
+  openaiRegistry.register(
+    "normalize",
+    new NormalizeModel(config.normalizeForm),
+    {},
+    { form: config.normalizeForm },
+  );
+  openaiRegistry.register("usage", new UsageModel());
+  openaiRegistry.register("headers", new HeadersModel());
+  // Headers vary between otherwise identical requests, so never cached
+  openaiRegistry.register("request-headers", new RequestHeadersModel(), {
+    deterministic: false,
+  });
+  openaiRegistry.register("sse-torture", new SSETortureModel());
+  openaiRegistry.register("utf8-split", new Utf8SplitModel());
+  openaiRegistry.register("latency-echo", new LatencyEchoModel(), {
+    deterministic: false,
+  });
+  openaiRegistry.register("latency", new LatencyModel(), {
+    deterministic: false,
+  });
+  openaiRegistry.register(
+    "annotate",
+    new AnnotateModel(config.annotate),
+    {},
+    config.annotate,
+  );
+  openaiRegistry.register("history", new HistoryModel());
+  openaiRegistry.register("redactor", new RedactorModel());
+  openaiRegistry.register("system-echo", new SystemEchoModel());
+  openaiRegistry.register("refine", new RefineModel());
+  openaiRegistry.register("markdown", new MarkdownModel());
+  openaiRegistry.register("markdown-torture", new MarkdownTortureModel());
+  // Converted documents are whole replies, so there's no prefill to continue
+  openaiRegistry.register("jsonpatch", new JsonPatchModel(), { supportsPrefill: false });
+  openaiRegistry.register("csv", new CsvModel(), { supportsPrefill: false });
+  // Mapped responses are whole replies, so there's no prefill to continue
+  openaiRegistry.register(
+    "responses",
+    new ResponsesModel(config.responses, config.responsesFallback),
+    { supportsPrefill: false },
+    { responses: Object.fromEntries(config.responses ?? []), fallback: config.responsesFallback ?? "echo" },
+  );
+  // Replies depend on how many attempts came before
+  const escalating = new EscalatingModel(
+    config.escalating?.script,
+    new AttemptTracker(config.escalating?.attempts),
+  );
+  openaiRegistry.register(
+    "escalating",
+    escalating,
+    { deterministic: false },
+    { script: config.escalating?.script ?? DEFAULT_ESCALATING_SCRIPT },
+  );
+  // Downloaded images can change between requests
+  openaiRegistry.register(
+    "vision",
+    new VisionModel(config.visionFetch, config.outboundFetch),
+    { deterministic: config.visionFetch === undefined },
+    { fetch: config.visionFetch },
+  );
+  if (config.exec) {
+    openaiRegistry.register("exec", config.exec, { deterministic: false });
+  }
+  openaiRegistry.register(
+    "embedding",
+    new EmbeddingModel(embeddingDimensions),
+    { supportsStreaming: false, supportsPrefill: false },
+    { dimensions: embeddingDimensions },
+  );
+  openaiRegistry.register(
+    "slowprompt",
+    new PromptLatencyModelware(new EchoModel(), config.promptLatencyMsPerToken),
+    {},
+    { msPerToken: config.promptLatencyMsPerToken },
+  );
+
+  // Ids /v1/embeddings accepts
+  const embeddingModels = new Set(["embedding"]);
+  for (const canned of config.cannedModels ?? []) {
+    const chat = canned.capabilities.includes("chat");
+    openaiRegistry.register(
+      canned.id,
+      chat ? new EchoModel() : new EmbeddingModel(embeddingDimensions),
+      { supportsStreaming: chat, supportsPrefill: chat, ownedBy: canned.owned_by },
+      canned,
+    );
+    if (canned.capabilities.includes("embeddings")) {
+      embeddingModels.add(canned.id);
+    }
+  }
+
+  for (const custom of config.models ?? []) {
+    openaiRegistry.register(
+      custom.id,
+      custom.model,
+      custom.capabilities,
+      custom.settings,
+    );
+  }
+
+  // Virtual models, each after any virtual model it's built on, whose
+  // forced parameters and system prompt it inherits unless it sets its own
+  for (const virtual of orderVirtualModels(config.virtualModels ?? [])) {
+    const inherited = openaiRegistry.adapterOptionsFor(virtual.base);
+    const forcedParameters = {
+      ...inherited?.forcedParameters,
+      ...(virtual.max_tokens !== undefined && { max_tokens: virtual.max_tokens }),
+      ...(virtual.temperature !== undefined && { temperature: virtual.temperature }),
+    };
+    const caps = [config.maxOutputTokens, forcedParameters.max_tokens].filter(
+      (cap): cap is number => cap !== undefined,
+    );
+    const derived = openaiRegistry.derive(
+      virtual.id,
+      virtual.base,
+      (model) =>
+        new TransformModelware(model, {
+          input: virtual.input,
+          output: virtual.output,
+        }),
+      virtual,
+      {
+        forcedParameters,
+        defaultSystemPrompt: virtual.system ?? inherited?.defaultSystemPrompt,
+        maxOutputTokens: caps.length > 0 ? Math.min(...caps) : undefined,
+      },
+    );
+    if (!derived) {
+      throw new Error(
+        `Virtual model ${virtual.id} is built on unknown model: ${virtual.base}`,
+      );
+    }
+  }
+
+  // Garbles a model's output if configured to, e.g. again once rebuilt.
+  // Unseeded garbling is random, so those replies are never cached.
+  const applyGarble = (id: string) => {
+    const options = config.garble?.[id];
+    if (!options) {
+      return;
+    }
+    const decorated = openaiRegistry.decorate(
+      id,
+      (model) => new GarbleModelware(model, options),
+      { garble: options },
+      options.seed === undefined ? { deterministic: false } : {},
+    );
+    if (!decorated) {
+      throw new Error(`Can't garble unknown model: ${id}`);
+    }
+  };
+  for (const id of Object.keys(config.garble ?? {})) {
+    applyGarble(id);
+  }
+
+  // One choice per backend, as each is now, garbled or virtual, with its own
+  // system prompt and output cap; it's only as deterministic and streamable
+  // as the least of them
+  if (config.fanout) {
+    const backends = config.fanout.map((id) => {
+      const model = coreRegistry.get(id);
+      if (!model) {
+        throw new Error(`Fanout is over unknown model: ${id}`);
+      }
+      return model;
+    });
+    const choiceOptions = config.fanout.map((id): ChoiceOptions => {
+      const options = openaiRegistry.adapterOptionsFor(id);
+      return { defaultSystemPrompt: options?.defaultSystemPrompt, maxOutputTokens: options?.maxOutputTokens };
+    });
+    openaiRegistry.register(
+      "fanout",
+      new FanoutModel(backends),
+      {
+        deterministic: config.fanout.every((id) => openaiRegistry.isDeterministic(id)),
+        supportsStreaming: config.fanout.every((id) => openaiRegistry.supportsStreaming(id)),
+        supportsPrefill: false,
+      },
+      { backends: config.fanout },
+      { forcedParameters: { n: backends.length }, choiceOptions },
+    );
+  }
+
+  for (const id of Object.keys(config.dropChunks ?? {})) {
+    if (!openaiRegistry.has(id)) {
+      throw new Error(`Can't drop chunks of unknown model: ${id}`);
+    }
+  }
+
+  for (const id of config.disabledModels ?? []) {
+    openaiRegistry.unregister(id);
+  }
+
+  const modelHealth = config.modelHealth
+    ? new ModelHealthMonitor(coreRegistry, config.modelHealth, logger)
+    : undefined;
+  modelHealth?.start();
 
   // Global middleware (applies to all routes)
-  app.use("*", corsMiddleware());
-  app.use("*", createLoggingMiddleware());
+  app.use("*", corsMiddleware(config.cors));
+  app.use("*", createLoggingMiddleware(logger, logFilter));
+
+  // Keep recent API requests for /admin/requests, rejected ones included
+  if (config.admin?.enabled) {
+    app.use("/v1/*", createRequestHistoryMiddleware(history));
+  }
+
+  // Turn away new API requests during maintenance; running streams finish
+  app.use("/v1/*", createMaintenanceMiddleware(maintenance));
+
+  // Turn away clients with too many requests in flight, before auth work
+  if (config.ipLimit) {
+    app.use(
+      "/v1/*",
+      createIpLimitMiddleware(
+        new ConcurrencyLimiter(config.ipLimit.maxConcurrent),
+        config.trustedProxies,
+      ),
+    );
+  }
 
   // Auth middleware (only for API routes)
-  app.use("/v1/*", createAuthMiddleware(authenticator));
+  app.use(
+    "/v1/*",
+    createAuthMiddleware(
+      authenticator,
+      config.auth,
+      config.security,
+      config.trustedProxies,
+    ),
+  );
+  // Echo, and check if configured, the OpenAI-Organization/Project headers
+  app.use("/v1/*", createOrganizationMiddleware(config.organizations));
+  if (config.admin?.enabled) {
+    const adminAuth = createAuthMiddleware(
+      authenticator,
+      config.auth,
+      config.security,
+      config.trustedProxies,
+    );
+    app.use("/admin/*", adminAuth);
+    app.use("/metrics", adminAuth);
+    app.use("/admin/*", async (c, next) => {
+      config.security?.record({
+        event: "admin_request",
+        method: c.req.method,
+        path: c.req.path,
+        api_key: maskAPIKey(bearerToken(c.req.header("Authorization")) ?? ""),
+        source_ip: clientIp(c, config.trustedProxies),
+      });
+      await next();
+    });
+  }
+
+  // Report completions, including those rejected below, once they're sent
+  if (webhook) {
+    app.use("/v1/chat/completions", createWebhookMiddleware(webhook));
+  }
+  if (shadow) {
+    app.use("/v1/chat/completions", createShadowMiddleware(shadow));
+  }
+
+  // Throttle API keys per endpoint before they take a queue slot
+  if (config.rateLimits) {
+    app.use("/v1/*", createRateLimitMiddleware(new RateLimiter(config.rateLimits)));
+  }
+
+  // Refuse completions once a key's token budget is spent
+  if (quotas) {
+    app.use("/v1/chat/completions", createQuotaMiddleware(quotas));
+  }
+
+  // Parse the body once for the middleware below and the handler
+  app.use(
+    "/v1/chat/completions",
+    createJsonBodyMiddleware(config.maxRequestBytes),
+  );
+
+  // Cap each key's open streams before they take a queue slot
+  if (config.maxStreamsPerKey !== undefined) {
+    app.use(
+      "/v1/chat/completions",
+      createStreamLimitMiddleware(new ConcurrencyLimiter(config.maxStreamsPerKey)),
+    );
+  }
+
+  // Queue completions beyond the configured concurrency, admitting waiting
+  // requests by priority
+  if (queue) {
+    app.use(
+      "/v1/chat/completions",
+      createQueueMiddleware(
+        queue,
+        createPriorityClassifier(config.priorities),
+      ),
+    );
+  }
+
+  // Replay responses for retried requests carrying an Idempotency-Key
+  app.use(
+    "/v1/chat/completions",
+    createIdempotencyMiddleware(idempotency),
+  );
 
   // Error handler
-  app.onError(createErrorHandler());
+  app.onError(createErrorHandler(config.errorVerbosity));
 
   // Health check endpoint
   app.get("/health", (c) => {
@@ -78,18 +862,76 @@ export function createApp(config: AppConfig) {
     });
   });
 
+  // Readiness: also generates a tiny completion, so a broken model layer
+  // gives 503 even though the process is up. Failing background model checks
+  // only make it degraded, since other models still work.
+  app.get("/health/deep", async (c) => {
+    const generation = await checkGeneration(
+      openaiRegistry,
+      config.healthCheckTimeoutMs,
+    );
+    let status: string = generation.status;
+    if (generation.status === "error") {
+      logger.warn("Deep health check failed", {
+        request_id: c.get("requestId"),
+        error: generation.error,
+      });
+      c.status(503);
+    }
+
+    const checks: Record<string, unknown> = { generation };
+    const models = modelHealth?.report() ?? {};
+    if (Object.keys(models).length > 0) {
+      checks.models = models;
+      if (
+        status === "ok" &&
+        Object.values(models).some((model) => model.status === "degraded")
+      ) {
+        status = "degraded";
+      }
+    }
+
+    // A listener that failed to bind leaves the others serving
+    const listeners = config.listeners?.() ?? [];
+    if (listeners.length > 0) {
+      checks.listeners = listeners;
+      if (
+        status === "ok" &&
+        listeners.some((listener) => listener.status === "failed")
+      ) {
+        status = "degraded";
+      }
+    }
+
+    // Not ready while in maintenance, so load balancers drain the instance
+    checks.maintenance = maintenance.status();
+    if (maintenance.enabled) {
+      status = "maintenance";
+      c.status(503);
+    }
+
+    return prettyJson(c, {
+      status,
+      service: "teenytiny-api",
+      checks,
+      timestamp: new Date().toISOString(),
+    });
+  });
+
   // Models endpoint
   app.get("/v1/models", (c) => {
     const response = openaiRegistry.listAsResponse();
+    for (const model of response.data) {
+      const health = modelHealth?.status(model.id);
+      if (health) {
+        model.status = health.status;
+      }
+    }
 
-    console.log(
-      JSON.stringify({
-        level: "info",
-        message: "Models listed",
-        request_id: c.get("requestId"),
-        model_count: response.data.length,
-      }),
-    );
+    logger.info("Models listed", {
+      request_id: c.get("requestId"),
+      model_count: response.data.length,
+    });
 
     return prettyJson(c, response);
   });
@@ -97,74 +939,311 @@ export function createApp(config: AppConfig) {
   // Chat completions endpoint
   app.post("/v1/chat/completions", async (c) => {
     const requestId = c.get("requestId") as string;
+    const timing = c.get("timing");
+
+    // Validate the request the JSON body middleware parsed
+    const received = await timing.time("parse", async () =>
+      validateChatCompletionRequest(jsonBody(c), maxChoices),
+    );
+
+    const idPrefix = validateResponseIdPrefix(c.req.header(RESPONSE_ID_PREFIX_HEADER));
 
-    // Parse and validate request
-    let request: ChatCompletionRequest;
-    try {
-      request = await c.req.json<ChatCompletionRequest>();
-    } catch (error) {
-      throw new InvalidRequestError("Invalid JSON in request body");
+    // Continue a stored conversation: the model sees the whole transcript,
+    // and this turn is appended to it once the reply is complete
+    const sessionId = c.req.header("X-Session-Id");
+    const owner = bearerToken(c.req.header("Authorization")) ?? "";
+    let request = received;
+    if (sessionId !== undefined) {
+      if (!sessions) {
+        throw new InvalidRequestError(
+          "Sessions are not enabled on this server; remove the X-Session-Id header",
+        );
+      }
+      const session = sessions.get(sessionId, owner);
+      if (!session) {
+        throw new NotFoundError(`Session not found: ${sessionId}`);
+      }
+      request = {
+        ...received,
+        messages: [...session.messages, ...received.messages],
+      };
+    }
+
+    // Headers override the body, for clients that can't change the body
+    const overrides: HeaderOverrides = config.allowHeaderOverrides
+      ? parseHeaderOverrides(c.req.raw.headers)
+      : {};
+    const applied = appliedOverrides(overrides);
+    if (applied.length > 0) {
+      c.header(OVERRIDES_APPLIED_HEADER, applied.join(", "));
+      logger.info("Header overrides applied", {
+        request_id: requestId,
+        overrides,
+      });
+    }
+    if (overrides.model !== undefined) {
+      request = { ...request, model: overrides.model };
     }
+    // Report the tier the API key's priority put the request on
+    if (config.priorities) {
+      request = {
+        ...request,
+        service_tier:
+          PRIORITY_SERVICE_TIERS[
+            requestPriority(request.service_tier, owner, config.priorities)
+          ],
+      };
+    }
+
+    const recordTurn = (reply: ChatCompletionMessage) => {
+      if (sessionId !== undefined) {
+        sessions?.append(sessionId, owner, [...received.messages, reply]);
+      }
+    };
 
-    // Validate required fields
-    if (!request.model) {
+    // Get model adapter
+    const adapter = openaiRegistry.get(request.model);
+    if (!adapter) {
       throw new InvalidRequestError(
-        "Missing required parameter: model",
+        `Model not found: ${request.model}`,
         "model",
       );
     }
+    const outcome: CompletionOutcome = { model: request.model, request };
+    c.set("completion", outcome);
+    requestSizes.record("/v1/chat/completions", request);
+
+    if (modelHealth && !modelHealth.isAvailable(request.model)) {
+      throw new ModelUnavailableError(request.model);
+    }
 
-    if (!request.messages || request.messages.length === 0) {
+    const isStreaming = request.stream === true;
+    if (isStreaming && !openaiRegistry.supportsStreaming(request.model)) {
       throw new InvalidRequestError(
-        "Missing required parameter: messages",
-        "messages",
+        `Model ${request.model} does not support streaming; retry with stream set to false`,
+        "stream",
       );
     }
 
-    // Validate message structure
-    for (let i = 0; i < request.messages.length; i++) {
-      const message = request.messages[i];
-
-      if (!message || typeof message !== "object") {
+    // Stalls and bursts for the stream, by scenario name
+    const scenarioName = c.req.header(SCENARIO_HEADER);
+    let scenario: ScenarioStep[] | undefined;
+    if (scenarioName !== undefined) {
+      if (!scenarios) {
         throw new InvalidRequestError(
-          `Invalid message at index ${i}: must be an object`,
-          "messages",
+          `Stream scenarios are not enabled on this server; remove the ${SCENARIO_HEADER} header`,
+          SCENARIO_HEADER,
         );
       }
+      scenario = scenarios.use(scenarioName);
+      outcome.scenario = scenarioName;
+    }
 
-      if (!message.role) {
-        throw new InvalidRequestError(
-          `Invalid message at index ${i}: missing required field 'role'`,
-          "messages",
-        );
-      }
+    logger.info("Chat completion request", {
+      request_id: requestId,
+      model: request.model,
+      message_count: request.messages.length,
+      streaming: isStreaming,
+      scenario: scenarioName,
+    });
 
-      if (
-        typeof message.role !== "string" ||
-        !["system", "user", "assistant"].includes(message.role)
-      ) {
-        throw new InvalidRequestError(
-          `Invalid message at index ${i}: 'role' must be one of 'system', 'user', or 'assistant'`,
-          "messages",
+    if (overrides.delay !== undefined) {
+      await sleep(overrides.delay, c.req.raw.signal);
+    }
+    if (overrides.forceStatus !== undefined) {
+      throw forcedStatusError(overrides.forceStatus);
+    }
+
+    // Response headers and SSE framing the model asks for (see the headers
+    // and sse-torture models)
+    const transport: TransportHints = { headers: new Headers() };
+
+    const audit = (usage: ChatCompletionUsage | undefined, response: string) =>
+      config.audit?.record({
+        requestId,
+        apiKey: c.req.header("Authorization")?.replace(/^Bearer /, ""),
+        ...requestOrganization(c),
+        model: request.model,
+        streaming: isStreaming,
+        promptTokens: usage?.prompt_tokens ?? 0,
+        completionTokens: usage?.completion_tokens ?? 0,
+        messages: request.messages.map((message) => ({
+          role: message.role,
+          content: contentToText(message.content),
+        })),
+        response,
+      });
+
+    if (isStreaming) {
+      // Pull the first chunk before committing to a 200, so errors the model
+      // raises up front still reach the client as a proper error response
+      const abort = new AbortController();
+      const completion = adapter.completeStream(request, {
+        signal: abort.signal,
+        transport,
+        timing,
+        chunking: overrides.chunking,
+        idPrefix,
+        idempotencyKey: c.req.header("Idempotency-Key"),
+        requestHeaders: maskRequestHeaders(c.req.raw.headers),
+      });
+      const chunks = completion[Symbol.asyncIterator]();
+      const first = await timing.time("model", () => chunks.next());
+
+      // Streaming response
+      return stream(c, async (stream) => {
+        c.header("Content-Type", "text/event-stream");
+        c.header("Cache-Control", "no-cache");
+        c.header("Connection", "keep-alive");
+        transport.headers.forEach((value, name) => c.header(name, value));
+        if (config.usageTrailers) {
+          c.header("Trailer", USAGE_TRAILERS.join(", "));
+        }
+
+        // Let the model stop as soon as the client disconnects
+        stream.onAbort(() => abort.abort());
+
+        async function* generated() {
+          for (
+            let next = first;
+            !next.done;
+            next = await timing.time("model", () => chunks.next())
+          ) {
+            yield next.value;
+          }
+        }
+
+        const writePieces = async (event: SSEEvent) => {
+          for (const piece of event.pieces) {
+            await stream.write(piece);
+          }
+        };
+        const dropOptions = config.dropChunks?.[request.model];
+        const { usage, content, error, dropped } = await writeChatCompletionStream(
+          generated(),
+          {
+            write: (event) =>
+              event.kind === "chunk"
+                ? timing.time("write", () => writePieces(event))
+                : writePieces(event),
+          },
+          {
+            variants: (transport.sseVariants ?? []).filter(isSSEVariant),
+            scenario,
+            scenarioOptions: {
+              clock: config.scenarioClock,
+              heartbeatMs: scenarios?.heartbeatMs,
+              signal: abort.signal,
+            },
+            requestId,
+            clock: () => timing.elapsed(),
+            minimal: config.minimalResponses,
+            drop: dropOptions && chunkDropper(dropOptions, request.seed),
+          },
         );
+
+        if (error !== undefined) {
+          logger.error("Streaming completion failed", {
+            request_id: requestId,
+            error: error instanceof Error ? error.message : String(error),
+          });
+          return;
+        }
+
+        outcome.usage = usage;
+        if (config.usageTrailers && usage) {
+          sendTrailers(c, usageTrailers(usage));
+        }
+
+        logger.info("Streaming completion finished", {
+          request_id: requestId,
+          model: request.model,
+          total_tokens: usage?.total_tokens ?? 0,
+          scenario: scenarioName,
+          ...(dropOptions && { dropped_chunks: dropped }),
+        });
+        audit(usage, content);
+        recordTurn({ role: "assistant", content });
+      });
+    } else {
+      // Identical requests to deterministic models replay the stored bytes;
+      // sessions change the history between requests and id prefixes the
+      // reply, so they skip the cache
+      const cacheKey =
+        cache &&
+        sessionId === undefined &&
+        idPrefix === undefined &&
+        openaiRegistry.isDeterministic(request.model)
+          ? await responseCacheKey(
+              request,
+              openaiRegistry.fingerprint(request.model),
+            )
+          : undefined;
+      const cached = cacheKey === undefined ? undefined : cache?.get(cacheKey);
+      if (cached) {
+        logger.info("Chat completion served from cache", {
+          request_id: requestId,
+          model: request.model,
+        });
+        c.header("x-teenytiny-cache", "hit");
+        const replayed = JSON.parse(cached.body) as ChatCompletionResponse;
+        outcome.usage = replayed.usage;
+        const body = config.minimalResponses
+          ? JSON.stringify(minimalCompletion(replayed), null, 2)
+          : cached.body;
+        return c.body(body, 200, cached.headers);
       }
 
-      if (message.content === undefined || message.content === null) {
-        throw new InvalidRequestError(
-          `Invalid message at index ${i}: missing required field 'content'`,
-          "messages",
-        );
+      // Non-streaming response
+      const response = await timing.time("model", () =>
+        adapter.complete(request, {
+          signal: c.req.raw.signal,
+          transport,
+          timing,
+          idPrefix,
+          idempotencyKey: c.req.header("Idempotency-Key"),
+          requestHeaders: maskRequestHeaders(c.req.raw.headers),
+        }),
+      );
+      transport.headers.forEach((value, name) => c.header(name, value));
+      outcome.usage = response.usage;
+
+      logger.info("Chat completion completed", {
+        request_id: requestId,
+        model: request.model,
+        prompt_tokens: response.usage.prompt_tokens,
+        completion_tokens: response.usage.completion_tokens,
+      });
+      audit(response.usage, contentToText(response.choices[0]?.message.content ?? null));
+      const reply = response.choices[0]?.message;
+      if (reply) {
+        recordTurn(reply);
       }
 
-      if (typeof message.content !== "string") {
-        throw new InvalidRequestError(
-          `Invalid message at index ${i}: 'content' must be a string`,
-          "messages",
-        );
+      if (cache && cacheKey !== undefined) {
+        const headers: Record<string, string> = {
+          "Content-Type": "application/json",
+        };
+        transport.headers.forEach((value, name) => {
+          headers[name] = value;
+        });
+        cache.set(cacheKey, { headers, body: JSON.stringify(response, null, 2) });
+        c.header("x-teenytiny-cache", "miss");
       }
+
+      return timing.time("write", async () =>
+        prettyJson(c, config.minimalResponses ? minimalCompletion(response) : response),
+      );
     }
+  });
 
-    // Get model adapter
+  // Prompt tokens a chat completion request would be charged, without
+  // generating anything
+  app.post("/v1/chat/completions/count", async (c) => {
+    const request = validateChatCompletionRequest(
+      await readJsonBody<unknown>(c.req.raw, config.maxRequestBytes),
+      maxChoices,
+    );
     const adapter = openaiRegistry.get(request.model);
     if (!adapter) {
       throw new InvalidRequestError(
@@ -173,91 +1252,694 @@ export function createApp(config: AppConfig) {
       );
     }
 
-    const isStreaming = request.stream === true;
+    const promptTokens = adapter.countPromptTokens(request);
+    logger.info("Prompt tokens counted", {
+      request_id: c.get("requestId"),
+      model: request.model,
+      prompt_tokens: promptTokens,
+    });
 
-    console.log(
-      JSON.stringify({
-        level: "info",
-        message: "Chat completion request",
-        request_id: requestId,
+    return prettyJson(c, { prompt_tokens: promptTokens });
+  });
+
+  // Runs a chat completion as a stream and returns the SSE events it would
+  // have sent, so client developers can see the exact sequence without
+  // parsing SSE themselves
+  if (config.trace || config.admin?.enabled) {
+    app.post("/v1/teenytiny/trace", async (c) => {
+      const request = validateChatCompletionRequest(
+        await readJsonBody<unknown>(c.req.raw, config.maxRequestBytes),
+        maxChoices,
+      );
+      const adapter = openaiRegistry.get(request.model);
+      if (!adapter) {
+        throw new InvalidRequestError(
+          `Model not found: ${request.model}`,
+          "model",
+        );
+      }
+      if (!openaiRegistry.supportsStreaming(request.model)) {
+        throw new InvalidRequestError(
+          `Model ${request.model} does not support streaming, so there's nothing to trace`,
+          "model",
+        );
+      }
+      requestSizes.record("/v1/teenytiny/trace", request);
+
+      const scenarioName = c.req.header(SCENARIO_HEADER);
+      if (scenarioName !== undefined && !scenarios) {
+        throw new InvalidRequestError(
+          `Stream scenarios are not enabled on this server; remove the ${SCENARIO_HEADER} header`,
+          SCENARIO_HEADER,
+        );
+      }
+      const scenario =
+        scenarioName === undefined ? undefined : scenarios?.use(scenarioName);
+
+      // As with chat completions, errors before the first chunk fail the
+      // request rather than becoming an error event
+      const transport: TransportHints = { headers: new Headers() };
+      const completion = adapter.completeStream(
+        { ...request, stream: true },
+        {
+          signal: c.req.raw.signal,
+          transport,
+          idPrefix: validateResponseIdPrefix(c.req.header(RESPONSE_ID_PREFIX_HEADER)),
+          requestHeaders: maskRequestHeaders(c.req.raw.headers),
+        },
+      );
+      const chunks = completion[Symbol.asyncIterator]();
+      const start = performance.now();
+      const first = await chunks.next();
+      async function* generated() {
+        for (let next = first; !next.done; next = await chunks.next()) {
+          yield next.value;
+        }
+      }
+
+      const events: TraceEvent[] = [];
+      const dropOptions = config.dropChunks?.[request.model];
+      const { error } = await writeChatCompletionStream(
+        generated(),
+        {
+          write: async (event) => {
+            events.push(traceEvent(events.length, event, performance.now() - start));
+          },
+        },
+        {
+          variants: (transport.sseVariants ?? []).filter(isSSEVariant),
+          scenario,
+          scenarioOptions: {
+            clock: config.scenarioClock,
+            heartbeatMs: scenarios?.heartbeatMs,
+            signal: c.req.raw.signal,
+          },
+          requestId: c.get("requestId"),
+          clock: () => performance.now() - start,
+          minimal: config.minimalResponses,
+          drop: dropOptions && chunkDropper(dropOptions, request.seed),
+        },
+      );
+
+      logger.info("Chat completion traced", {
+        request_id: c.get("requestId"),
         model: request.model,
-        message_count: request.messages.length,
-        streaming: isStreaming,
-      }),
+        events: events.length,
+        error:
+          error instanceof Error
+            ? error.message
+            : error === undefined
+              ? undefined
+              : String(error),
+      });
+
+      return prettyJson(c, {
+        object: "list",
+        model: request.model,
+        headers: Object.fromEntries(transport.headers),
+        data: events,
+      });
+    });
+  }
+
+  // Embeddings endpoint, served by the embedding model's hash vectors
+  app.post("/v1/embeddings", async (c) => {
+    const request = await c.get("timing").time("parse", async () =>
+      validateEmbeddingRequest(
+        await readJsonBody<unknown>(c.req.raw, config.maxRequestBytes),
+        maxEmbeddingDimensions,
+        maxEmbeddingBatchSize,
+      ),
     );
+    if (!embeddingModels.has(request.model)) {
+      throw new InvalidRequestError(
+        `Model ${request.model} does not support embeddings; use embedding`,
+        "model",
+      );
+    }
 
-    if (isStreaming) {
-      // Streaming response
+    const inputs = typeof request.input === "string" ? [request.input] : request.input;
+    // Roughly 1 token per 4 characters, as for chat prompts
+    const promptTokens = inputs.reduce(
+      (total, input) => total + Math.ceil(input.trim().length / 4),
+      0,
+    );
+    // Batches often repeat inputs, so each distinct one is embedded once
+    const vectors = new Map<string, number[]>();
+    const response: EmbeddingResponse = {
+      object: "list",
+      data: inputs.map((input, index) => {
+        let vector = vectors.get(input);
+        if (!vector) {
+          vector = embed(input, request.dimensions ?? embeddingDimensions);
+          vectors.set(input, vector);
+        }
+        return {
+          object: "embedding",
+          index,
+          embedding:
+            request.encoding_format === "base64"
+              ? embeddingToBase64(vector)
+              : vector,
+        };
+      }),
+      model: request.model,
+      usage: { prompt_tokens: promptTokens, total_tokens: promptTokens },
+    };
+
+    logger.info("Embeddings created", {
+      request_id: c.get("requestId"),
+      input_count: inputs.length,
+    });
+
+    return prettyJson(c, response);
+  });
+
+  if (sessions) {
+    // Starts an empty conversation owned by the caller's API key
+    app.post("/v1/teenytiny/sessions", (c) => {
+      const session = sessions.create(
+        bearerToken(c.req.header("Authorization")) ?? "",
+      );
+
+      logger.info("Session created", {
+        request_id: c.get("requestId"),
+        session_id: session.id,
+      });
+
+      c.status(201);
+      return prettyJson(c, {
+        id: session.id,
+        object: "teenytiny.session",
+        created: session.created,
+      });
+    });
+
+    app.get("/v1/teenytiny/sessions/:id", (c) => {
+      const id = c.req.param("id");
+      const session = sessions.get(
+        id,
+        bearerToken(c.req.header("Authorization")) ?? "",
+      );
+      if (!session) {
+        throw new NotFoundError(`Session not found: ${id}`);
+      }
+
+      return prettyJson(c, {
+        id: session.id,
+        object: "teenytiny.session",
+        created: session.created,
+        messages: session.messages,
+      });
+    });
+
+    app.delete("/v1/teenytiny/sessions/:id", (c) => {
+      const id = c.req.param("id");
+      if (!sessions.delete(id, bearerToken(c.req.header("Authorization")) ?? "")) {
+        throw new NotFoundError(`Session not found: ${id}`);
+      }
+
+      return prettyJson(c, {
+        id,
+        object: "teenytiny.session",
+        deleted: true,
+      });
+    });
+  }
+
+  if (config.admin?.enabled) {
+    // Streams buffered and live log entries as SSE, for debugging
+    app.get("/admin/logs", (c) => {
       return stream(c, async (stream) => {
         c.header("Content-Type", "text/event-stream");
         c.header("Cache-Control", "no-cache");
         c.header("Connection", "keep-alive");
 
-        let totalTokens = 0;
+        // Serialise writes so entries arrive in the order they were logged
+        let pending = Promise.resolve();
+        const send = (entry: LogEntry) => {
+          pending = pending
+            .then(() => stream.write(encodeSSEJson(entry)))
+            .then(
+              () => undefined,
+              () => undefined, // Subscriber went away mid-write
+            );
+        };
 
-        try {
-          for await (const chunk of adapter.completeStream(request)) {
-            // Track token usage from final chunk
-            if (chunk.usage) {
-              totalTokens = chunk.usage.total_tokens;
-            }
+        for (const entry of logger.recent()) {
+          send(entry);
+        }
+        const unsubscribe = logger.subscribe(send);
 
-            await stream.write(`data: ${JSON.stringify(chunk)}\n\n`);
-          }
+        await new Promise<void>((resolve) => stream.onAbort(resolve));
+        unsubscribe();
+      });
+    });
 
-          await stream.write("data: [DONE]\n\n");
+    // How the shadow backend compared on recently mirrored requests
+    app.get("/admin/shadow", (c) => {
+      if (!shadow) {
+        throw new NotFoundError("Shadow mirroring is not enabled");
+      }
+      return prettyJson(c, shadow.summary());
+    });
 
-          console.log(
-            JSON.stringify({
-              level: "info",
-              message: "Streaming completion finished",
-              request_id: requestId,
-              model: request.model,
-              total_tokens: totalTokens,
-            }),
-          );
-        } catch (error) {
-          console.error(
-            JSON.stringify({
-              level: "error",
-              message: "Streaming completion failed",
-              request_id: requestId,
-              error: error instanceof Error ? error.message : String(error),
-            }),
-          );
+    // Webhook deliveries and failures since startup
+    app.get("/admin/webhooks", (c) => {
+      if (!webhook) {
+        throw new NotFoundError("Webhooks are not enabled");
+      }
+      return prettyJson(c, webhook.stats());
+    });
 
-          await stream.write(
-            `data: ${JSON.stringify({
-              error: {
-                message: "Streaming failed",
-                type: "api_error",
-              },
-            })}\n\n`,
-          );
-        }
+    // Histograms of chat completion request sizes since startup, by route
+    // and model
+    app.get("/admin/request-sizes", (c) => {
+      return prettyJson(c, { object: "list", data: requestSizes.stats() });
+    });
+
+    // Requests in flight and queued by priority, and those shed since startup
+    app.get("/admin/queue", (c) => {
+      if (!queue) {
+        throw new NotFoundError("Request queue is not enabled");
+      }
+      return prettyJson(c, queue.stats());
+    });
+
+    // The figures the /admin endpoints report, for Prometheus to scrape
+    app.get("/metrics", (c) => {
+      const series = requestSizes.stats();
+      const measures = Object.keys(
+        REQUEST_SIZE_BUCKETS,
+      ) as RequestSizeMeasure[];
+      const families = measures.map((measure) =>
+        histogram(
+          `teenytiny_request_${measure}`,
+          `Chat completion request ${measure.replace("_", " ")}, by route and model`,
+          series.map(({ route, model, histograms }) => ({
+            labels: { route, model },
+            snapshot: histograms[measure],
+          })),
+        ),
+      );
+
+      const logged = logFilter.stats();
+      const stored = idempotency.stats();
+      families.push(
+        gauge(
+          "teenytiny_maintenance_mode",
+          "Whether the server is in maintenance mode",
+          [{ value: maintenance.enabled ? 1 : 0 }],
+        ),
+        counter("teenytiny_requests_total", "Requests seen, logged or not", [
+          { value: logged.requests },
+        ]),
+        counter(
+          "teenytiny_requests_suppressed_total",
+          "Requests the log filters kept out of the access log",
+          [{ value: logged.suppressed }],
+        ),
+        gauge("teenytiny_idempotency_entries", "Stored idempotent responses", [
+          { value: stored.entries },
+        ]),
+        counter(
+          "teenytiny_idempotency_hits_total",
+          "Retries answered with a stored response",
+          [{ value: stored.hits }],
+        ),
+        counter(
+          "teenytiny_idempotency_conflicts_total",
+          "Idempotency keys reused with a different body",
+          [{ value: stored.conflicts }],
+        ),
+      );
+
+      if (queue) {
+        const stats = queue.stats();
+        families.push(
+          gauge("teenytiny_queue_active", "Requests in flight", [
+            { value: stats.active },
+          ]),
+          gauge(
+            "teenytiny_queue_depth",
+            "Requests waiting for a slot, by priority",
+            PRIORITIES.map((priority) => ({
+              labels: { priority },
+              value: stats.queued[priority],
+            })),
+          ),
+          counter(
+            "teenytiny_queue_shed_total",
+            "Requests shed since startup, by priority",
+            PRIORITIES.map((priority) => ({
+              labels: { priority },
+              value: stats.shed[priority],
+            })),
+          ),
+        );
+      }
+      if (cache) {
+        const stats = cache.stats();
+        families.push(
+          gauge("teenytiny_cache_entries", "Cached responses", [
+            { value: stats.entries },
+          ]),
+          counter("teenytiny_cache_hits_total", "Responses served from the cache", [
+            { value: stats.hits },
+          ]),
+          counter(
+            "teenytiny_cache_misses_total",
+            "Cacheable requests not found in the cache",
+            [{ value: stats.misses }],
+          ),
+        );
+      }
+      if (modelHealth) {
+        const health = Object.entries(modelHealth.report());
+        families.push(
+          gauge(
+            "teenytiny_model_healthy",
+            "Whether the model's latest health check passed",
+            health.map(([model, { status }]) => ({
+              labels: { model },
+              value: status === "ok" ? 1 : 0,
+            })),
+          ),
+          gauge(
+            "teenytiny_model_consecutive_failures",
+            "Health checks failed in a row",
+            health.map(([model, { consecutive_failures }]) => ({
+              labels: { model },
+              value: consecutive_failures,
+            })),
+          ),
+        );
+      }
+      if (scenarios) {
+        families.push(
+          counter(
+            "teenytiny_scenario_requests_total",
+            "Requests naming each stream scenario since it was defined",
+            Object.entries(scenarios.stats()).map(([scenario, { requests }]) => ({
+              labels: { scenario },
+              value: requests,
+            })),
+          ),
+        );
+      }
+      if (webhook) {
+        const stats = webhook.stats();
+        families.push(
+          gauge("teenytiny_webhook_queued", "Notifications waiting to be sent", [
+            { value: stats.queued },
+          ]),
+          counter(
+            "teenytiny_webhook_notifications_total",
+            "Notifications by outcome",
+            (["delivered", "failed", "dropped"] as const).map((result) => ({
+              labels: { result },
+              value: stats[result],
+            })),
+          ),
+        );
+      }
+
+      return c.body(formatMetrics(families), 200, {
+        "Content-Type": PROMETHEUS_CONTENT_TYPE,
       });
-    } else {
-      // Non-streaming response
-      const response = await adapter.complete(request);
+    });
 
-      console.log(
-        JSON.stringify({
-          level: "info",
-          message: "Chat completion completed",
-          request_id: requestId,
-          model: request.model,
-          prompt_tokens: response.usage.prompt_tokens,
-          completion_tokens: response.usage.completion_tokens,
+    // Response cache size and hit rate since startup
+    app.get("/admin/cache", (c) => {
+      if (!cache) {
+        throw new NotFoundError("Response cache is not enabled");
+      }
+      return prettyJson(c, cache.stats());
+    });
+
+    // Empties the response cache
+    app.delete("/admin/cache", (c) => {
+      if (!cache) {
+        throw new NotFoundError("Response cache is not enabled");
+      }
+      cache.flush();
+
+      logger.info("Response cache flushed", {
+        request_id: c.get("requestId"),
+      });
+
+      return prettyJson(c, cache.stats());
+    });
+
+    // The escalating model's script and how many requests it's counting
+    app.get("/admin/escalating", (c) =>
+      prettyJson(c, {
+        script: config.escalating?.script ?? DEFAULT_ESCALATING_SCRIPT,
+        tracked: escalating.attempts.size,
+      }),
+    );
+
+    // Starts every request's escalating attempts over, e.g. between test runs
+    app.delete("/admin/escalating", (c) => {
+      const reset = escalating.attempts.reset();
+
+      logger.info("Escalating attempts reset", {
+        request_id: c.get("requestId"),
+        reset,
+      });
+
+      return prettyJson(c, { reset });
+    });
+
+    // Stored Idempotency-Key responses, replays and conflicts since startup
+    app.get("/admin/idempotency", (c) => prettyJson(c, idempotency.stats()));
+
+    // Token budgets, usage and what's left per API key
+    app.get("/admin/quotas", (c) => {
+      if (!quotas) {
+        throw new NotFoundError("Quotas are not enabled");
+      }
+      return prettyJson(c, { data: quotas.quotas() });
+    });
+
+    // Restores every key's full budget
+    app.delete("/admin/quotas", (c) => {
+      if (!quotas) {
+        throw new NotFoundError("Quotas are not enabled");
+      }
+      quotas.reset();
+
+      logger.info("Quotas reset", {
+        request_id: c.get("requestId"),
+      });
+
+      return prettyJson(c, { data: quotas.quotas() });
+    });
+
+    // Recent API requests, newest first, optionally only those for a model
+    // or with a status such as 429 or 4xx
+    app.get("/admin/requests", (c) => {
+      const limit = c.req.query("limit");
+      if (limit !== undefined && !/^[1-9]\d*$/.test(limit)) {
+        throw new InvalidRequestError(
+          `Invalid limit: ${limit}; expected a positive integer`,
+          "limit",
+        );
+      }
+      return prettyJson(c, {
+        object: "list",
+        data: history.list({
+          model: c.req.query("model"),
+          status: c.req.query("status"),
+          limit: limit === undefined ? DEFAULT_REQUEST_HISTORY_LIMIT : Number(limit),
         }),
+      });
+    });
+
+    // One recent request with its response, credentials redacted
+    app.get("/admin/requests/:id", (c) => {
+      const id = c.req.param("id");
+      const record = history.get(id);
+      if (!record) {
+        throw new NotFoundError(`Request not found: ${id}`);
+      }
+      return prettyJson(c, record);
+    });
+
+    // Forgets every recent request
+    app.delete("/admin/requests", (c) => {
+      const cleared = history.clear();
+
+      logger.info("Request history cleared", {
+        request_id: c.get("requestId"),
+        cleared,
+      });
+
+      return prettyJson(c, { cleared });
+    });
+
+    // Rebuilds a model with new options until the next restart; its
+    // system_fingerprint changes accordingly
+    app.put("/admin/models/:id/config", async (c) => {
+      const id = c.req.param("id");
+      const body = await readJsonBody<unknown>(
+        c.req.raw,
+        config.maxRequestBytes,
+      );
+      if (id === "countdown") {
+        const options = parseCountdownOptions(body);
+        openaiRegistry.register(id, new CountdownModel(options), {}, options);
+        applyGarble(id);
+      } else if (id === "refuser") {
+        const options = parseRefuserOptions(body);
+        openaiRegistry.register(id, new RefuserModel(options), {}, options);
+        applyGarble(id);
+      } else {
+        throw new NotFoundError(`Model ${id} can't be reconfigured`);
+      }
+      config.security?.record({
+        event: "config_reloaded",
+        setting: `models.${id}`,
+        api_key: maskAPIKey(bearerToken(c.req.header("Authorization")) ?? ""),
+      });
+
+      logger.info("Model reconfigured", {
+        request_id: c.get("requestId"),
+        model: id,
+        options: body,
+      });
+
+      return prettyJson(c, {
+        id,
+        system_fingerprint: openaiRegistry.fingerprint(id),
+      });
+    });
+
+    // Whether the server is in maintenance mode
+    app.get("/admin/maintenance", (c) => {
+      return prettyJson(c, maintenance.status());
+    });
+
+    // Switches maintenance mode on or off without a restart
+    app.put("/admin/maintenance", async (c) => {
+      const { enabled, retryAfterSeconds } = parseMaintenanceUpdate(
+        await readJsonBody<unknown>(c.req.raw, config.maxRequestBytes),
       );
+      maintenance.set(enabled, retryAfterSeconds);
+      config.security?.record({
+        event: "config_reloaded",
+        setting: "maintenance",
+        api_key: maskAPIKey(bearerToken(c.req.header("Authorization")) ?? ""),
+      });
+
+      logger.info(enabled ? "Maintenance mode on" : "Maintenance mode off", {
+        request_id: c.get("requestId"),
+        retry_after_seconds: maintenance.status().retry_after_seconds,
+      });
 
-      return prettyJson(c, response);
+      return prettyJson(c, maintenance.status());
+    });
+
+    // Current access log filters, and how many requests they've let through
+    app.get("/admin/log-filters", (c) => {
+      return prettyJson(c, {
+        filters: logFilter.config,
+        counts: logFilter.stats(),
+      });
+    });
+
+    // Replaces the access log filters until the next restart
+    app.put("/admin/log-filters", async (c) => {
+      const filters = parseLogFilterConfig(
+        await readJsonBody<unknown>(c.req.raw, config.maxRequestBytes),
+      );
+      logFilter.update(filters);
+      config.security?.record({
+        event: "config_reloaded",
+        setting: "log_filters",
+        api_key: maskAPIKey(bearerToken(c.req.header("Authorization")) ?? ""),
+      });
+
+      logger.info("Log filters updated", {
+        request_id: c.get("requestId"),
+        filters,
+      });
+
+      return prettyJson(c, {
+        filters: logFilter.config,
+        counts: logFilter.stats(),
+      });
+    });
+
+    if (scenarios) {
+      // Stream scenarios, and how many requests each has run
+      app.get("/admin/scenarios", (c) => {
+        return prettyJson(c, {
+          heartbeat_ms: scenarios.heartbeatMs ?? null,
+          scenarios: scenarios.stats(),
+        });
+      });
+
+      // Adds or replaces a scenario until the next restart, from
+      // {"timeline": "normal 2s, stall 5s, burst 50 chunks"}
+      app.put("/admin/scenarios/:name", async (c) => {
+        const name = c.req.param("name");
+        const body = await readJsonBody<unknown>(
+          c.req.raw,
+          config.maxRequestBytes,
+        );
+        const timeline = (body as { timeline?: unknown } | null)?.timeline;
+        if (typeof timeline !== "string") {
+          throw new InvalidRequestError(
+            "Body must be {\"timeline\": \"<steps>\"}",
+            "timeline",
+          );
+        }
+        scenarios.define(name, timeline);
+        config.security?.record({
+          event: "config_reloaded",
+          setting: `scenarios.${name}`,
+          api_key: maskAPIKey(bearerToken(c.req.header("Authorization")) ?? ""),
+        });
+
+        logger.info("Stream scenario defined", {
+          request_id: c.get("requestId"),
+          scenario: name,
+          timeline,
+        });
+
+        return prettyJson(c, { name, ...scenarios.stats()[name] });
+      });
+
+      app.delete("/admin/scenarios/:name", (c) => {
+        const name = c.req.param("name");
+        if (!scenarios.remove(name)) {
+          throw new NotFoundError(`Stream scenario not found: ${name}`);
+        }
+        config.security?.record({
+          event: "config_reloaded",
+          setting: `scenarios.${name}`,
+          api_key: maskAPIKey(bearerToken(c.req.header("Authorization")) ?? ""),
+        });
+
+        logger.info("Stream scenario removed", {
+          request_id: c.get("requestId"),
+          scenario: name,
+        });
+
+        return prettyJson(c, { name, deleted: true });
+      });
     }
-  });
+  }
 
   // Website-specific endpoints (no auth required)
   app.post("/site/new-key", async (c) => {
     const apiKey = await authenticator.generateApiKey();
+    config.security?.record({
+      event: "key_created",
+      api_key: maskAPIKey(apiKey),
+      source_ip: clientIp(c, config.trustedProxies),
+    });
     return prettyJson(c, {
       key: apiKey,
     });
@@ -268,6 +1950,6 @@ export function createApp(config: AppConfig) {
     throw new NotFoundError(`Not found: ${c.req.method} ${c.req.path}`);
   });
 
-  return app;
+  return { app, registry: coreRegistry, requestSizes };
 }
 
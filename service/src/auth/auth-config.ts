@@ -3,4 +3,8 @@
  */
 export interface AuthConfig {
   apiKey: string;
-}
\ No newline at end of file
+  // Fixed pause before rejecting a request, so failures don't leak timing
+  failureDelayMs?: number;
+  // Also pause successful requests, making auth constant-time
+  delayOnSuccess?: boolean;
+}
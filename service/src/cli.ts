@@ -2,6 +2,17 @@
 
 import { createInterface } from "node:readline";
 import { stdin, stdout, stderr } from "node:process";
+import { readFile } from "node:fs/promises";
+import {
+  CHECKS,
+  type ConformanceCheck,
+  type ConformanceTarget,
+  conformanceReport,
+  formatResultsTable,
+  runChecks,
+  selectChecks,
+} from "./conformance/conformance.js";
+import { verifySecurityLog } from "./utils/security-log.js";
 
 const DEFAULT_BASE_URL = "http://localhost:8080";
 const DEFAULT_API_KEY = "testkey";
@@ -45,6 +56,8 @@ async function listModels(config: CliConfig): Promise<void> {
     console.log(`\nUsage:`);
     console.log(`  tt <model> "message"   - One-shot completion`);
     console.log(`  tt <model>             - Interactive mode`);
+    console.log(`  tt conformance         - Run the conformance checks against a server`);
+    console.log(`  tt audit verify <file> - Check a security log's hash chain`);
     console.log(`  tt                     - Show this help`);
 
     console.log(`\nAuthor: Joe Walnes <joe@walnes.com>`);
@@ -182,10 +195,163 @@ async function interactiveMode(
   });
 }
 
+function parseList(value: string | undefined, flag: string): string[] {
+  if (!value) {
+    stderr.write(`Error: ${flag} requires a comma-separated list of checks\n`);
+    process.exit(1);
+  }
+  return value
+    .split(",")
+    .map((name) => name.trim())
+    .filter((name) => name.length > 0);
+}
+
+const CONFORMANCE_USAGE =
+  "Usage: tt conformance [--url <url>] [--key <key>] [--model <model>] [--only <checks>] [--skip <checks>] [--json]\n";
+
+// Runs the conformance checks against this server or any OpenAI-compatible
+// one; `selftest` is the same command under its original name
+async function conformance(config: CliConfig, args: string[]): Promise<void> {
+  const target: ConformanceTarget = { baseUrl: config.baseUrl, apiKey: config.apiKey };
+  let only: string[] = [];
+  let skip: string[] = [];
+  let json = false;
+
+  for (let i = 0; i < args.length; i++) {
+    const arg = args[i];
+    const nextArg = args[i + 1];
+
+    switch (arg) {
+      case "--url":
+        if (!nextArg) {
+          stderr.write("Error: --url requires a value\n");
+          process.exit(1);
+        }
+        target.baseUrl = nextArg;
+        i++;
+        break;
+
+      case "--key":
+        if (!nextArg) {
+          stderr.write("Error: --key requires a value\n");
+          process.exit(1);
+        }
+        target.apiKey = nextArg;
+        i++;
+        break;
+
+      case "--model":
+        if (!nextArg) {
+          stderr.write("Error: --model requires a value\n");
+          process.exit(1);
+        }
+        target.model = nextArg;
+        i++;
+        break;
+
+      case "--only":
+        only = parseList(nextArg, "--only");
+        i++;
+        break;
+
+      case "--skip":
+        skip = parseList(nextArg, "--skip");
+        i++;
+        break;
+
+      case "--json":
+        json = true;
+        break;
+
+      default:
+        stderr.write(`Error: Unknown argument ${arg}\n`);
+        stderr.write(CONFORMANCE_USAGE);
+        process.exit(1);
+    }
+  }
+
+  let checks: ConformanceCheck[] = [];
+  try {
+    checks = selectChecks({ only, skip });
+  } catch (error) {
+    stderr.write(
+      `Error: ${error instanceof Error ? error.message : String(error)}\n`,
+    );
+    process.exit(1);
+  }
+
+  const skipped = CHECKS.filter((check) => !checks.includes(check)).map((check) => check.name);
+  if (!json) {
+    console.log(`Running conformance checks against ${target.baseUrl} with model ${target.model ?? "echo"}\n`);
+  }
+  const results = await runChecks(target, checks);
+  console.log(
+    json
+      ? JSON.stringify(conformanceReport(target, results, skipped), null, 2)
+      : formatResultsTable(results, skipped),
+  );
+
+  if (results.some((result) => !result.passed)) {
+    process.exit(1);
+  }
+}
+
+// Checks the hash chain of security log files, given oldest first
+async function auditVerify(files: string[]): Promise<void> {
+  if (files.length === 0) {
+    stderr.write("Usage: tt audit verify <file> [<newer file>...]\n");
+    stderr.write(
+      "  Pass rotated files oldest first, e.g. security.log.2 security.log.1 security.log\n",
+    );
+    process.exit(1);
+  }
+
+  const lines: string[] = [];
+  const origins: string[] = [];
+  for (const file of files) {
+    try {
+      for (const [index, line] of (await readFile(file, "utf8")).split("\n").entries()) {
+        lines.push(line);
+        origins.push(`${file}:${index + 1}`);
+      }
+    } catch (error) {
+      stderr.write(
+        `Error: cannot read ${file}: ${error instanceof Error ? error.message : String(error)}\n`,
+      );
+      process.exit(1);
+    }
+  }
+
+  const result = verifySecurityLog(lines);
+  if (!result.valid) {
+    stderr.write(
+      `FAIL ${origins[result.line! - 1]}: ${result.error} (${result.entries} entries verified before it)\n`,
+    );
+    process.exit(1);
+  }
+
+  console.log(`OK ${result.entries} entries, hash chain intact`);
+  if (result.firstSeq !== undefined && result.firstSeq > 0) {
+    console.log(
+      `Note: the chain starts at entry ${result.firstSeq}; entries 0-${result.firstSeq - 1} were rotated out or removed`,
+    );
+  }
+}
+
 async function main(): Promise<void> {
   const config = getConfig();
   const args = process.argv.slice(2);
 
+  if (args[0] === "conformance" || args[0] === "selftest") {
+    await conformance(config, args.slice(1));
+    return;
+  }
+
+  if (args[0] === "audit" && args[1] === "verify") {
+    await auditVerify(args.slice(2));
+    return;
+  }
+
   // No arguments: show models and usage
   if (args.length === 0) {
     await listModels(config);
@@ -212,6 +378,8 @@ async function main(): Promise<void> {
   stderr.write("  tt                     - List models and show usage\n");
   stderr.write('  tt <model> "message"   - One-shot completion\n');
   stderr.write("  tt <model>             - Interactive mode\n");
+  stderr.write("  tt conformance         - Run the conformance checks against a server\n");
+  stderr.write("  tt audit verify <file> - Check a security log's hash chain\n");
   process.exit(1);
 }
 
@@ -0,0 +1,102 @@
+import { describe, it, expect } from "vitest";
+import {
+  CHECKS,
+  conformanceReport,
+  formatResultsTable,
+  parseSSEData,
+  runChecks,
+  selectChecks,
+} from "./conformance.js";
+
+describe("Conformance", () => {
+  it("should select all checks by default", () => {
+    expect(selectChecks({}).map((c) => c.name)).toEqual(
+      CHECKS.map((c) => c.name),
+    );
+  });
+
+  it("should skip named checks", () => {
+    const names = selectChecks({ skip: ["auth"] }).map((c) => c.name);
+    expect(names).not.toContain("auth");
+    expect(names).toContain("completion");
+  });
+
+  it("should run only named checks", () => {
+    const names = selectChecks({ only: ["health", "models"] }).map(
+      (c) => c.name,
+    );
+    expect(names).toEqual(["health", "models"]);
+  });
+
+  it("should reject unknown check names", () => {
+    expect(() => selectChecks({ skip: ["nope"] })).toThrow(/Unknown check/);
+  });
+
+  it("should report failures without throwing", async () => {
+    const results = await runChecks(
+      {
+        baseUrl: "http://localhost",
+        apiKey: "key",
+        fetch: async () => new Response("oops", { status: 500 }),
+      },
+      selectChecks({ only: ["health"] }),
+    );
+
+    expect(results).toHaveLength(1);
+    expect(results[0]!.passed).toBe(false);
+    expect(results[0]!.error).toContain("status");
+    expect(formatResultsTable(results)).toContain("FAIL");
+  });
+
+  it("should check other models' replies by their shape", async () => {
+    const reply = (content: string, model: string) =>
+      Response.json({
+        id: "chatcmpl-abc",
+        object: "chat.completion",
+        created: 1,
+        model,
+        choices: [{ index: 0, message: { role: "assistant", content }, finish_reason: "stop" }],
+        usage: { prompt_tokens: 5, completion_tokens: 2, total_tokens: 7 },
+      });
+    const target = (content: string, model = "llama-3.1-8b-instruct") => ({
+      baseUrl: "http://localhost",
+      apiKey: "key",
+      model: "llama",
+      fetch: async () => reply(content, model),
+    });
+    const completion = selectChecks({ only: ["completion"] });
+
+    expect((await runChecks(target("Hi there!"), completion))[0]!.passed).toBe(true);
+    const [empty] = await runChecks(target(""), completion);
+    expect(empty!.error).toContain("content must be a non-empty string");
+    const [unnamed] = await runChecks(target("Hi there!", ""), completion);
+    expect(unnamed!.error).toContain("model must be a non-empty string");
+  });
+
+  it("should report results and skipped checks for CI", async () => {
+    const target = {
+      baseUrl: "http://localhost",
+      apiKey: "key",
+      fetch: async () => Response.json({ status: "ok" }),
+    };
+    const results = await runChecks(target, selectChecks({ only: ["health"] }));
+    const skipped = CHECKS.map((c) => c.name).filter((name) => name !== "health");
+
+    const report = conformanceReport(target, results, skipped);
+    expect(report).toMatchObject({ baseUrl: "http://localhost", model: "echo", passed: 1, failed: 0, skipped });
+    expect(report.results[0]).toMatchObject({ name: "health", passed: true });
+    expect(formatResultsTable(results, skipped)).toContain(`1 passed, 0 failed, ${skipped.length} skipped`);
+  });
+
+  it("should parse SSE data lines", () => {
+    expect(parseSSEData('data: {"a":1}\n\n: comment\ndata:[DONE]\n\n')).toEqual(
+      ['{"a":1}', "[DONE]"],
+    );
+  });
+
+  it("should parse every legal line ending, multi-line data and a BOM", () => {
+    expect(
+      parseSSEData("\uFEFFdata: a\r\n\r\ndata: b\r\rdata: c\ndata: d\nid: 1\n\ndata: partial"),
+    ).toEqual(["a", "b", "c\nd"]);
+  });
+});
@@ -0,0 +1,457 @@
+/**
+ * Conformance suite for OpenAI-compatible chat completion servers
+ *
+ * The same checks back both the integration tests (run against an in-process
+ * app) and the `tt conformance` command (run against a live server, this one
+ * or any other, e.g. vLLM or LiteLLM), so the two can't drift apart. Checks
+ * are plain async functions that throw a ConformanceError on failure,
+ * keeping them free of any test framework.
+ */
+
+export type FetchFunction = (
+  input: string,
+  init?: RequestInit,
+) => Promise<Response>;
+
+export interface ConformanceTarget {
+  baseUrl: string;
+  apiKey: string;
+  // The model completions are requested from; echo when unset
+  model?: string | undefined;
+  // Whether the model replies with the user's message word for word, so
+  // replies can be checked exactly; true for echo, otherwise only their
+  // shape is checked
+  echoes?: boolean | undefined;
+  fetch?: FetchFunction;
+}
+
+export interface ConformanceCheck {
+  name: string;
+  description: string;
+  run(target: ConformanceTarget): Promise<void>;
+}
+
+export interface ConformanceResult {
+  name: string;
+  description: string;
+  passed: boolean;
+  error?: string;
+  durationMs: number;
+}
+
+// A run's results as written for CI by `tt conformance --json`
+export interface ConformanceReport {
+  baseUrl: string;
+  model: string;
+  passed: number;
+  failed: number;
+  // Names of the checks that weren't run
+  skipped: string[];
+  results: ConformanceResult[];
+}
+
+export class ConformanceError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "ConformanceError";
+  }
+}
+
+export function assert(condition: unknown, message: string): asserts condition {
+  if (!condition) {
+    throw new ConformanceError(message);
+  }
+}
+
+export function assertEqual<T>(actual: T, expected: T, what: string): void {
+  if (actual !== expected) {
+    throw new ConformanceError(
+      `${what}: expected ${JSON.stringify(expected)}, got ${JSON.stringify(actual)}`,
+    );
+  }
+}
+
+async function request(
+  target: ConformanceTarget,
+  path: string,
+  init: RequestInit = {},
+): Promise<Response> {
+  const doFetch: FetchFunction =
+    target.fetch ?? ((input, init) => fetch(input, init));
+  return doFetch(`${target.baseUrl.replace(/\/+$/, "")}${path}`, init);
+}
+
+function authHeaders(apiKey: string): Record<string, string> {
+  return {
+    Authorization: `Bearer ${apiKey}`,
+    "Content-Type": "application/json",
+  };
+}
+
+async function readJson(res: Response, what: string): Promise<any> {
+  const text = await res.text();
+  try {
+    return JSON.parse(text);
+  } catch {
+    throw new ConformanceError(`${what}: response body is not JSON: ${text.slice(0, 100)}`);
+  }
+}
+
+/**
+ * Splits an SSE body into the data of each event, in order, following the
+ * spec: any of CRLF, LF or CR end a line, a leading BOM and comment lines are
+ * ignored, and multiple `data:` lines in one event are joined with newlines.
+ * A trailing event without its blank line is incomplete and dropped.
+ */
+export function parseSSEData(body: string): string[] {
+  const events: string[] = [];
+  let data: string[] = [];
+
+  for (const line of body.replace(/^\uFEFF/, "").split(/\r\n|\r|\n/)) {
+    if (line === "") {
+      if (data.length > 0) {
+        events.push(data.join("\n"));
+      }
+      data = [];
+    } else if (line.startsWith("data:")) {
+      data.push(line.slice(5).replace(/^ /, ""));
+    }
+    // Comments (":...") and other fields (id, retry, event) carry no data
+  }
+
+  return events;
+}
+
+const DEFAULT_MODEL = "echo";
+
+function modelOf(target: ConformanceTarget): string {
+  return target.model ?? DEFAULT_MODEL;
+}
+
+function echoes(target: ConformanceTarget): boolean {
+  return target.echoes ?? modelOf(target) === DEFAULT_MODEL;
+}
+
+// Checks a reply to COMPLETION_MESSAGE: the message itself from a model that
+// echoes, otherwise any text that finished normally
+function assertReply(
+  target: ConformanceTarget,
+  content: unknown,
+  finishReason: unknown,
+  what: string,
+): void {
+  if (echoes(target)) {
+    assertEqual(content, COMPLETION_MESSAGE, `${what} content`);
+    assertEqual(finishReason, "stop", `${what} finish_reason`);
+    return;
+  }
+  assert(typeof content === "string" && content !== "", `${what} content must be a non-empty string`);
+  assert(
+    finishReason === "stop" || finishReason === "length",
+    `${what} finish_reason: expected "stop" or "length", got ${JSON.stringify(finishReason)}`,
+  );
+}
+
+// Servers other than this one often answer with the full or resolved name of
+// the model asked for, such as a dated snapshot, so only ours must match
+function assertModel(target: ConformanceTarget, model: unknown, what: string): void {
+  if (echoes(target)) {
+    assertEqual(model, modelOf(target), what);
+    return;
+  }
+  assert(typeof model === "string" && model !== "", `${what} must be a non-empty string`);
+}
+
+function assertUsage(usage: any, what: string): void {
+  assert(usage && typeof usage === "object", `missing ${what}`);
+  assertEqual(
+    usage.total_tokens,
+    usage.prompt_tokens + usage.completion_tokens,
+    `${what}.total_tokens`,
+  );
+}
+
+function completionRequest(target: ConformanceTarget, body: Record<string, unknown> = {}): RequestInit {
+  return {
+    method: "POST",
+    headers: authHeaders(target.apiKey),
+    body: JSON.stringify({
+      model: modelOf(target),
+      messages: [{ role: "user", content: COMPLETION_MESSAGE }],
+      ...body,
+    }),
+  };
+}
+
+// The JSON chunks of a streamed completion, checking it ended with [DONE]
+async function readChunks(res: Response): Promise<any[]> {
+  assertEqual(res.status, 200, "status");
+  const contentType = res.headers.get("content-type") ?? "";
+  assert(contentType.includes("text/event-stream"), `unexpected content-type: ${contentType}`);
+
+  const events = parseSSEData(await res.text());
+  assert(events.length > 0, "no SSE data events received");
+  assertEqual(events[events.length - 1], "[DONE]", "final event");
+  return events.slice(0, -1).map((data, index) => {
+    try {
+      return JSON.parse(data);
+    } catch {
+      throw new ConformanceError(`chunk ${index} is not JSON: ${data.slice(0, 100)}`);
+    }
+  });
+}
+
+function assertErrorShape(data: any, expectedType: string, what: string): void {
+  assert(data && typeof data === "object", `${what}: body must be an object`);
+  assert(data.error && typeof data.error === "object", `${what}: missing 'error' object`);
+  assertEqual(typeof data.error.message, "string", `${what}: error.message type`);
+  assertEqual(data.error.type, expectedType, `${what}: error.type`);
+}
+
+const COMPLETION_MESSAGE = "Hello, conformance!";
+
+export const CHECKS: ConformanceCheck[] = [
+  {
+    name: "health",
+    description: "GET /health returns status ok",
+    async run(target) {
+      const res = await request(target, "/health");
+      assertEqual(res.status, 200, "status");
+      const data = await readJson(res, "health");
+      assertEqual(data.status, "ok", "health status");
+    },
+  },
+  {
+    name: "models",
+    description: "GET /v1/models lists the model",
+    async run(target) {
+      const res = await request(target, "/v1/models", {
+        headers: authHeaders(target.apiKey),
+      });
+      assertEqual(res.status, 200, "status");
+      const data = await readJson(res, "models");
+      assertEqual(data.object, "list", "object");
+      assert(Array.isArray(data.data), "data must be an array");
+      const model = data.data.find((m: any) => m.id === modelOf(target));
+      assert(model, `${modelOf(target)} model not listed`);
+      assertEqual(model.object, "model", "model object");
+      assertEqual(typeof model.owned_by, "string", "owned_by type");
+    },
+  },
+  {
+    name: "completion",
+    description: "POST /v1/chat/completions returns a chat.completion",
+    async run(target) {
+      const res = await request(target, "/v1/chat/completions", completionRequest(target));
+      assertEqual(res.status, 200, "status");
+      const data = await readJson(res, "completion");
+      assertEqual(data.object, "chat.completion", "object");
+      assertModel(target, data.model, "model");
+      assert(typeof data.id === "string" && data.id.startsWith("chatcmpl-"), "id must start with chatcmpl-");
+      assertEqual(typeof data.created, "number", "created type");
+      const choice = data.choices?.[0];
+      assert(choice, "missing choices[0]");
+      assertEqual(choice.index, 0, "choice index");
+      assertEqual(choice.message?.role, "assistant", "message role");
+      assertReply(target, choice.message?.content, choice.finish_reason, "message");
+      assertUsage(data.usage, "usage");
+    },
+  },
+  {
+    name: "streaming",
+    description: "Streaming completion reassembles into a reply",
+    async run(target) {
+      const res = await request(target, "/v1/chat/completions", completionRequest(target, { stream: true }));
+      const chunks = await readChunks(res);
+      assert(chunks.length > 0, "no chunks before [DONE]");
+      assertEqual(chunks[0].choices?.[0]?.delta?.role, "assistant", "first chunk role");
+
+      const ids = new Set(chunks.map((chunk: any) => chunk.id));
+      assertEqual(ids.size, 1, "distinct chunk ids");
+
+      let content = "";
+      for (const chunk of chunks) {
+        assertEqual(chunk.object, "chat.completion.chunk", "chunk object");
+        content += chunk.choices?.[0]?.delta?.content ?? "";
+      }
+      const last = chunks[chunks.length - 1];
+      assertReply(target, content, last.choices?.[0]?.finish_reason, "reassembled");
+    },
+  },
+  {
+    name: "stream-usage",
+    description: "stream_options.include_usage ends the stream with a usage chunk",
+    async run(target) {
+      const res = await request(
+        target,
+        "/v1/chat/completions",
+        completionRequest(target, { stream: true, stream_options: { include_usage: true } }),
+      );
+      const chunks = await readChunks(res);
+      const last = chunks[chunks.length - 1];
+      assert(last, "no chunks before [DONE]");
+      assert(Array.isArray(last.choices) && last.choices.length === 0, "usage chunk must have empty choices");
+      assertUsage(last.usage, "usage chunk usage");
+    },
+  },
+  {
+    name: "choices",
+    description: "n asks for that many choices, indexed in order",
+    async run(target) {
+      const res = await request(target, "/v1/chat/completions", completionRequest(target, { n: 2 }));
+      assertEqual(res.status, 200, "status");
+      const data = await readJson(res, "completion");
+      assert(Array.isArray(data.choices), "choices must be an array");
+      assertEqual(data.choices.length, 2, "choices length");
+      for (const [index, choice] of data.choices.entries()) {
+        assertEqual(choice.index, index, `choices[${index}] index`);
+        assertEqual(choice.message?.role, "assistant", `choices[${index}] role`);
+        assertReply(target, choice.message?.content, choice.finish_reason, `choices[${index}]`);
+      }
+    },
+  },
+  {
+    name: "auth",
+    description: "Missing and invalid API keys are rejected with 401",
+    async run(target) {
+      const missing = await request(target, "/v1/models");
+      assertEqual(missing.status, 401, "status without key");
+      assertErrorShape(await readJson(missing, "missing key"), "authentication_error", "missing key");
+
+      const invalid = await request(target, "/v1/models", {
+        headers: authHeaders("invalid-conformance-key"),
+      });
+      assertEqual(invalid.status, 401, "status with invalid key");
+      assertErrorShape(await readJson(invalid, "invalid key"), "authentication_error", "invalid key");
+    },
+  },
+  {
+    name: "errors",
+    description: "Invalid requests return OpenAI-shaped errors",
+    async run(target) {
+      const unknownModel = await request(target, "/v1/chat/completions", {
+        method: "POST",
+        headers: authHeaders(target.apiKey),
+        body: JSON.stringify({
+          model: "nonexistent-model",
+          messages: [{ role: "user", content: "Hello!" }],
+        }),
+      });
+      assertEqual(unknownModel.status, 400, "status for unknown model");
+      const unknownModelData = await readJson(unknownModel, "unknown model");
+      assertErrorShape(unknownModelData, "invalid_request_error", "unknown model");
+      assertEqual(unknownModelData.error.param, "model", "unknown model param");
+
+      const malformed = await request(target, "/v1/chat/completions", {
+        method: "POST",
+        headers: authHeaders(target.apiKey),
+        body: "invalid json",
+      });
+      assertEqual(malformed.status, 400, "status for malformed JSON");
+      assertErrorShape(await readJson(malformed, "malformed JSON"), "invalid_request_error", "malformed JSON");
+
+      const noMessages = await request(target, "/v1/chat/completions", {
+        method: "POST",
+        headers: authHeaders(target.apiKey),
+        body: JSON.stringify({ model: modelOf(target) }),
+      });
+      assertEqual(noMessages.status, 400, "status without messages");
+      assertErrorShape(await readJson(noMessages, "missing messages"), "invalid_request_error", "missing messages");
+
+      const notFound = await request(target, "/unknown-route", {
+        headers: authHeaders(target.apiKey),
+      });
+      assertEqual(notFound.status, 404, "status for unknown route");
+      assertErrorShape(await readJson(notFound, "unknown route"), "not_found_error", "unknown route");
+    },
+  },
+];
+
+export function selectChecks(options: { only?: string[]; skip?: string[] }): ConformanceCheck[] {
+  const known = new Set(CHECKS.map((check) => check.name));
+  for (const name of [...(options.only ?? []), ...(options.skip ?? [])]) {
+    if (!known.has(name)) {
+      throw new Error(`Unknown check: ${name} (available: ${[...known].join(", ")})`);
+    }
+  }
+
+  return CHECKS.filter(
+    (check) =>
+      (!options.only || options.only.length === 0 || options.only.includes(check.name)) &&
+      !(options.skip ?? []).includes(check.name),
+  );
+}
+
+export async function runChecks(
+  target: ConformanceTarget,
+  checks: ConformanceCheck[] = CHECKS,
+): Promise<ConformanceResult[]> {
+  const results: ConformanceResult[] = [];
+
+  for (const check of checks) {
+    const start = Date.now();
+    try {
+      await check.run(target);
+      results.push({
+        name: check.name,
+        description: check.description,
+        passed: true,
+        durationMs: Date.now() - start,
+      });
+    } catch (error) {
+      results.push({
+        name: check.name,
+        description: check.description,
+        passed: false,
+        error: error instanceof Error ? error.message : String(error),
+        durationMs: Date.now() - start,
+      });
+    }
+  }
+
+  return results;
+}
+
+export function formatResultsTable(results: ConformanceResult[], skipped: string[] = []): string {
+  const nameWidth = Math.max(5, ...results.map((r) => r.name.length), ...skipped.map((name) => name.length));
+  const lines = [`${"CHECK".padEnd(nameWidth)}  RESULT  TIME     DETAIL`];
+
+  for (const result of results) {
+    lines.push(
+      [
+        result.name.padEnd(nameWidth),
+        (result.passed ? "PASS" : "FAIL").padEnd(6),
+        `${result.durationMs}ms`.padEnd(7),
+        result.passed ? result.description : result.error,
+      ].join("  "),
+    );
+  }
+
+  for (const name of skipped) {
+    lines.push([name.padEnd(nameWidth), "SKIP".padEnd(6), "-".padEnd(7), "skipped"].join("  "));
+  }
+
+  const failed = results.filter((r) => !r.passed).length;
+  lines.push("");
+  lines.push(
+    `${results.length - failed} passed, ${failed} failed` +
+      (skipped.length > 0 ? `, ${skipped.length} skipped` : ""),
+  );
+  return lines.join("\n");
+}
+
+export function conformanceReport(
+  target: ConformanceTarget,
+  results: ConformanceResult[],
+  skipped: string[] = [],
+): ConformanceReport {
+  const failed = results.filter((r) => !r.passed).length;
+  return {
+    baseUrl: target.baseUrl,
+    model: modelOf(target),
+    passed: results.length - failed,
+    failed,
+    skipped,
+    results,
+  };
+}
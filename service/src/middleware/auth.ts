@@ -1,31 +1,94 @@
 import { Context, Next } from 'hono';
-import { AuthenticationError } from '../openai-protocol/errors.js';
+import { AuthenticationError, InvalidRequestError } from '../openai-protocol/errors.js';
 import type { Authenticator } from '../auth/authenticator.js';
+import type { AuthConfig } from '../auth/auth-config.js';
+import { sleep } from '../utils/sleep.js';
+import type { RequestTimer } from '../utils/request-timer.js';
+import { maskAPIKey } from '../utils/audit-log.js';
+import type { SecurityLogger } from '../utils/security-log.js';
+import { clientIp } from './client-ip.js';
 
-export function createAuthMiddleware(authenticator: Authenticator) {
-  return async (c: Context, next: Next) => {
+type Variables = {
+  timing?: RequestTimer;
+};
+
+export type AuthDelayConfig = Pick<AuthConfig, 'failureDelayMs' | 'delayOnSuccess'>;
+
+export function createAuthMiddleware(
+  authenticator: Authenticator,
+  delay: AuthDelayConfig = {},
+  security?: SecurityLogger,
+  trustedProxies: string[] = []
+) {
+  const delayMs = delay.failureDelayMs ?? 0;
+
+  return async (c: Context<{ Variables: Variables }>, next: Next) => {
     // Skip auth for health check
     if (c.req.path === '/health') {
       await next();
       return;
     }
 
-    const authHeader = c.req.header('Authorization');
-    if (!authHeader) {
-      throw new AuthenticationError('No authorization header provided');
-    }
-
-    const bearerPrefix = 'Bearer ';
-    if (!authHeader.startsWith(bearerPrefix)) {
-      throw new AuthenticationError('Invalid authorization header format. Expected "Bearer <token>"');
-    }
+    const timing = c.get('timing');
+    timing?.start('auth');
+    try {
+      // A repeated header arrives as its values joined with commas, which a
+      // bearer token can't contain; rather than guess which one is meant, the
+      // request is refused
+      const values = c.req.header('Authorization')?.split(',').filter((value) => value.trim() !== '') ?? [];
+      if (values.length > 1) {
+        throw new InvalidRequestError(
+          `Found ${values.length} Authorization headers; send exactly one "Bearer <token>" header`,
+          'Authorization'
+        );
+      }
 
-    const token = authHeader.slice(bearerPrefix.length);
-    const isValid = await authenticator.validateApiKey(token);
-    if (!isValid) {
-      throw new AuthenticationError('Invalid API key');
+      const error = await authenticate(authenticator, c.req.header('Authorization'));
+      if (error) {
+        const token = bearerToken(c.req.header('Authorization'));
+        security?.record({
+          event: 'auth_failure',
+          reason: error.message,
+          source_ip: clientIp(c, trustedProxies),
+          api_key: token === undefined ? undefined : maskAPIKey(token),
+        });
+        await sleep(delayMs);
+        throw error;
+      }
+      if (delay.delayOnSuccess) {
+        await sleep(delayMs);
+      }
+    } finally {
+      timing?.stop('auth');
     }
 
     await next();
   };
-}
\ No newline at end of file
+}
+
+// The token from a well-formed Bearer header, if any
+export function bearerToken(authHeader: string | undefined): string | undefined {
+  return authHeader?.startsWith('Bearer ') ? authHeader.slice('Bearer '.length) : undefined;
+}
+
+async function authenticate(
+  authenticator: Authenticator,
+  authHeader: string | undefined
+): Promise<AuthenticationError | undefined> {
+  if (!authHeader) {
+    return new AuthenticationError('No authorization header provided');
+  }
+
+  const bearerPrefix = 'Bearer ';
+  if (!authHeader.startsWith(bearerPrefix)) {
+    return new AuthenticationError('Invalid authorization header format. Expected "Bearer <token>"');
+  }
+
+  const token = authHeader.slice(bearerPrefix.length);
+  const isValid = await authenticator.validateApiKey(token);
+  if (!isValid) {
+    return new AuthenticationError('Invalid API key');
+  }
+
+  return undefined;
+}
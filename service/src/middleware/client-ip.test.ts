@@ -0,0 +1,46 @@
+import { describe, it, expect } from "vitest";
+import { Hono } from "hono";
+import { clientIp } from "./client-ip.js";
+
+describe("clientIp", () => {
+  const resolve = async (remoteAddress: string | undefined, forwardedFor: string | undefined, trusted: string[]) => {
+    const app = new Hono();
+    app.get("/", (c) => c.text(clientIp(c, trusted)));
+    const headers: Record<string, string> = forwardedFor === undefined ? {} : { "X-Forwarded-For": forwardedFor };
+    const env = remoteAddress === undefined ? undefined : { incoming: { socket: { remoteAddress } } };
+    const res = await app.request("/", { headers }, env);
+    return res.text();
+  };
+
+  it("should use the socket address and ignore X-Forwarded-For from untrusted peers", async () => {
+    expect(await resolve("198.51.100.7", "203.0.113.1", [])).toBe("198.51.100.7");
+    expect(await resolve("198.51.100.7", "203.0.113.1", ["10.0.0.1"])).toBe("198.51.100.7");
+  });
+
+  it("should take the rightmost untrusted hop behind trusted proxies", async () => {
+    const trusted = ["10.0.0.1", "10.0.0.2"];
+
+    expect(await resolve("10.0.0.1", "203.0.113.1", trusted)).toBe("203.0.113.1");
+    expect(await resolve("10.0.0.1", "6.6.6.6, 203.0.113.1, 10.0.0.2", trusted)).toBe("203.0.113.1");
+    expect(await resolve("10.0.0.1", "10.0.0.2", trusted)).toBe("10.0.0.2");
+    expect(await resolve("10.0.0.1", undefined, trusted)).toBe("10.0.0.1");
+  });
+
+  it("should unwrap IPv4-mapped IPv6 addresses", async () => {
+    expect(await resolve("::ffff:10.0.0.1", "::ffff:203.0.113.1", ["10.0.0.1"])).toBe("203.0.113.1");
+  });
+
+  it("should report clients without a socket as unknown", async () => {
+    expect(await resolve(undefined, "203.0.113.1", ["10.0.0.1"])).toBe("unknown");
+  });
+
+  it("should believe CF-Connecting-IP only without a socket", async () => {
+    const app = new Hono();
+    app.get("/", (c) => c.text(clientIp(c)));
+    const headers = { "CF-Connecting-IP": "203.0.113.9" };
+
+    expect(await (await app.request("/", { headers })).text()).toBe("203.0.113.9");
+    const env = { incoming: { socket: { remoteAddress: "198.51.100.7" } } };
+    expect(await (await app.request("/", { headers }, env)).text()).toBe("198.51.100.7");
+  });
+});
@@ -0,0 +1,37 @@
+import { Context } from 'hono';
+
+/**
+ * The client's IP, for throttling and the security log. X-Forwarded-For is
+ * only read when the request came from a trusted proxy, and then from the
+ * right, skipping further trusted proxies, since anything left of them is
+ * client-supplied. Without a socket the request either came through
+ * Cloudflare, which sets CF-Connecting-IP itself, or in-process, and then
+ * the client is 'unknown'.
+ */
+export function clientIp(c: Context, trustedProxies: string[] = []): string {
+  // @hono/node-server passes the Node.js request as env.incoming
+  const socket = (c.env as { incoming?: { socket?: { remoteAddress?: string } } } | undefined)?.incoming?.socket;
+  if (socket?.remoteAddress === undefined) {
+    return c.req.header('CF-Connecting-IP') || 'unknown';
+  }
+  const peer = normalizeAddress(socket.remoteAddress);
+  if (!trustedProxies.includes(peer)) {
+    return peer;
+  }
+
+  const hops = (c.req.header('X-Forwarded-For') ?? '')
+    .split(',')
+    .map((hop) => normalizeAddress(hop.trim()))
+    .filter((hop) => hop !== '');
+  for (let i = hops.length - 1; i >= 0; i--) {
+    if (!trustedProxies.includes(hops[i]!)) {
+      return hops[i]!;
+    }
+  }
+  return hops[0] ?? peer;
+}
+
+// IPv4 clients of a dual-stack server show up as ::ffff:1.2.3.4
+function normalizeAddress(address: string): string {
+  return address.startsWith('::ffff:') && address.includes('.') ? address.slice('::ffff:'.length) : address;
+}
@@ -1,16 +1,53 @@
 import { Context, Next } from 'hono';
+import { RESPONSE_ID_PREFIX_HEADER } from '../openai-protocol/request-validation.js';
+import { SCENARIO_HEADER } from '../utils/stream-scenarios.js';
+
+export interface CorsConfig {
+  // Sent as Access-Control-Allow-Methods (default DEFAULT_CORS_METHODS)
+  allowMethods?: string[] | undefined;
+  // Sent as Access-Control-Allow-Headers (default DEFAULT_CORS_HEADERS)
+  allowHeaders?: string[] | undefined;
+  // Seconds browsers may cache a preflight's answer, sent as
+  // Access-Control-Max-Age on preflights; left to the browser when unset
+  maxAge?: number | undefined;
+}
+
+// What the /v1 endpoints are called with
+export const DEFAULT_CORS_METHODS = ['GET', 'POST', 'DELETE', 'OPTIONS'];
+
+// The request headers the /v1 endpoints read
+export const DEFAULT_CORS_HEADERS = [
+  'Content-Type',
+  'Authorization',
+  'OpenAI-Organization',
+  'OpenAI-Project',
+  'Idempotency-Key',
+  'X-Session-Id',
+  RESPONSE_ID_PREFIX_HEADER,
+  SCENARIO_HEADER,
+  'X-TeenyTiny-Model',
+  'X-TeenyTiny-Delay',
+  'X-TeenyTiny-Chunking',
+  'X-TeenyTiny-Force-Status',
+];
+
+export function corsMiddleware(config: CorsConfig = {}) {
+  const methods = (config.allowMethods ?? DEFAULT_CORS_METHODS).join(', ');
+  const headers = (config.allowHeaders ?? DEFAULT_CORS_HEADERS).join(', ');
 
-export function corsMiddleware() {
   return async (c: Context, next: Next) => {
     c.header('Access-Control-Allow-Origin', '*');
-    c.header('Access-Control-Allow-Methods', 'GET, POST, OPTIONS');
-    c.header('Access-Control-Allow-Headers', 'Content-Type, Authorization');
+    c.header('Access-Control-Allow-Methods', methods);
+    c.header('Access-Control-Allow-Headers', headers);
 
     if (c.req.method === 'OPTIONS') {
+      if (config.maxAge !== undefined) {
+        c.header('Access-Control-Max-Age', String(config.maxAge));
+      }
       return c.text('', 200);
     }
 
     await next();
     return;
   };
-}
\ No newline at end of file
+}
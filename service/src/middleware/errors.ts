@@ -1,14 +1,18 @@
 import { Context } from 'hono';
 import { HTTPException } from 'hono/http-exception';
-import { APIError } from '../openai-protocol/errors.js';
+import { APIError, RateLimitError, ServiceUnavailableError } from '../openai-protocol/errors.js';
+import type { ErrorVerbosity } from '../openai-protocol/errors.js';
 
-export function createErrorHandler() {
+export function createErrorHandler(verbosity: ErrorVerbosity = 'terse') {
   return async (err: Error, c: Context) => {
     console.error('Request error:', err);
 
     // Handle APIError instances
     if (err instanceof APIError) {
-      return c.json(err.toErrorResponse(), err.statusCode as any);
+      if (err instanceof RateLimitError || err instanceof ServiceUnavailableError) {
+        c.header('Retry-After', String(err.retryAfterSeconds));
+      }
+      return c.json(err.toErrorResponse(verbosity), err.statusCode as any);
     }
 
     // Handle Hono HTTP exceptions
@@ -24,15 +28,24 @@ export function createErrorHandler() {
       );
     }
 
-    // Handle unknown errors
+    // Handle unknown errors, only revealing what went wrong in verbose mode
     return c.json(
       {
         error: {
-          message: 'Internal server error',
+          message: verbosity === 'verbose' ? `Internal server error (${describeError(err)})` : 'Internal server error',
           type: 'api_error',
         },
       },
       500
     );
   };
-}
\ No newline at end of file
+}
+
+// The error and the first few frames of its stack, on one line
+function describeError(err: Error): string {
+  const frames = (err.stack ?? '')
+    .split('\n')
+    .slice(1, 4)
+    .map((line) => line.trim());
+  return [`${err.name}: ${err.message}`, ...frames].join(' | ');
+}
@@ -0,0 +1,49 @@
+import { describe, it, expect } from "vitest";
+import { IdempotencyStore } from "./idempotency.js";
+
+function fakeClock() {
+  const clock = { time: 1000, now: () => clock.time };
+  return clock;
+}
+
+const response = (requestHash: string, body = "{}") => ({
+  requestHash,
+  status: 200,
+  headers: { "Content-Type": "application/json" },
+  body,
+});
+
+describe("IdempotencyStore", () => {
+  it("should replay only for the request body it stored, counting conflicts", () => {
+    const store = new IdempotencyStore({ ttlMs: 1000, maxEntries: 10 });
+
+    expect(store.lookup("key", "hash-a")).toBeUndefined();
+    store.set("key", response("hash-a"));
+    expect(store.lookup("key", "hash-a")).toMatchObject(response("hash-a"));
+    expect(store.lookup("key", "hash-b")).toBe("conflict");
+
+    expect(store.stats()).toEqual({ entries: 1, max_entries: 10, ttl_ms: 1000, hits: 1, misses: 1, conflicts: 1 });
+  });
+
+  it("should forget responses after the TTL, even for a different body", () => {
+    const clock = fakeClock();
+    const store = new IdempotencyStore({ ttlMs: 1000, maxEntries: 10 }, clock.now);
+    store.set("key", response("hash-a"));
+
+    clock.time += 1000;
+
+    expect(store.lookup("key", "hash-b")).toBeUndefined();
+    expect(store.stats().entries).toBe(0);
+  });
+
+  it("should evict the oldest responses beyond the bound", () => {
+    const store = new IdempotencyStore({ ttlMs: 1000, maxEntries: 2 });
+    store.set("a", response("hash"));
+    store.set("b", response("hash"));
+    store.set("c", response("hash"));
+
+    expect(store.lookup("a", "hash")).toBeUndefined();
+    expect(store.lookup("c", "hash")).toBeDefined();
+    expect(store.stats().entries).toBe(2);
+  });
+});
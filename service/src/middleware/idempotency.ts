@@ -0,0 +1,197 @@
+import { Context, Next } from 'hono';
+import { IdempotencyConflictError } from '../openai-protocol/errors.js';
+import { peekJsonBody } from './json-body.js';
+
+export interface IdempotencyConfig {
+  // How long a stored response is replayed for
+  ttlMs: number;
+  // Upper bound on stored responses; the oldest are evicted first
+  maxEntries: number;
+}
+
+export const DEFAULT_IDEMPOTENCY_CONFIG: IdempotencyConfig = {
+  ttlMs: 10 * 60 * 1000,
+  maxEntries: 1000,
+};
+
+// Marks a response replayed for a retried Idempotency-Key
+export const IDEMPOTENT_REPLAY_HEADER = 'Idempotent-Replay';
+
+interface StoredResponse {
+  expiresAt: number;
+  // Hash of the request body the response answered
+  requestHash: string;
+  status: number;
+  headers: Record<string, string>;
+  body: string;
+}
+
+export interface IdempotencyStats {
+  entries: number;
+  max_entries: number;
+  ttl_ms: number;
+  // Retries answered with a stored response
+  hits: number;
+  // Keys with nothing stored yet, or only an expired response
+  misses: number;
+  // Keys reused with a different request body, and rejected
+  conflicts: number;
+}
+
+/**
+ * In-memory store of completed responses keyed by Idempotency-Key
+ */
+export class IdempotencyStore {
+  private entries = new Map<string, StoredResponse>();
+  private hits = 0;
+  private misses = 0;
+  private conflicts = 0;
+
+  constructor(
+    private config: IdempotencyConfig = DEFAULT_IDEMPOTENCY_CONFIG,
+    private now: () => number = Date.now
+  ) {}
+
+  // The response stored for a key, counting the hit or miss. A key stored
+  // for a different request body is a conflict rather than a hit.
+  lookup(key: string, requestHash: string): StoredResponse | 'conflict' | undefined {
+    const entry = this.entries.get(key);
+    if (!entry || entry.expiresAt <= this.now()) {
+      this.entries.delete(key);
+      this.misses++;
+      return undefined;
+    }
+    if (entry.requestHash !== requestHash) {
+      this.conflicts++;
+      return 'conflict';
+    }
+    this.hits++;
+    return entry;
+  }
+
+  set(key: string, response: Omit<StoredResponse, 'expiresAt'>): void {
+    this.entries.delete(key);
+    this.entries.set(key, { ...response, expiresAt: this.now() + this.config.ttlMs });
+
+    // Maps iterate in insertion order, so the first key is the oldest
+    while (this.entries.size > this.config.maxEntries) {
+      const oldest = this.entries.keys().next().value;
+      if (oldest === undefined) break;
+      this.entries.delete(oldest);
+    }
+  }
+
+  stats(): IdempotencyStats {
+    return {
+      entries: this.entries.size,
+      max_entries: this.config.maxEntries,
+      ttl_ms: this.config.ttlMs,
+      hits: this.hits,
+      misses: this.misses,
+      conflicts: this.conflicts,
+    };
+  }
+}
+
+// SHA-256 of the parsed body, so retries differing only in whitespace match
+async function requestHash(body: unknown): Promise<string> {
+  const digest = await globalThis.crypto.subtle.digest('SHA-256', new TextEncoder().encode(JSON.stringify(body)));
+  return Array.from(new Uint8Array(digest), (byte) => byte.toString(16).padStart(2, '0')).join('');
+}
+
+/**
+ * Replays the first successful response for a repeated Idempotency-Key,
+ * marked Idempotent-Replay: true, and rejects the key with a 409 if it
+ * comes back with a different request body.
+ *
+ * Keys are scoped to the caller's credentials so two clients can't see each
+ * other's responses. Streams are stored once they finish with [DONE] and
+ * replayed as the same events; streams that fail or are abandoned by the
+ * client aren't stored, so a retry runs the completion again.
+ */
+export function createIdempotencyMiddleware(store: IdempotencyStore) {
+  return async (c: Context, next: Next) => {
+    const idempotencyKey = c.req.header('Idempotency-Key');
+    if (!idempotencyKey) {
+      await next();
+      return;
+    }
+
+    // Bodies that can't be read are left for the handler to reject
+    const body = peekJsonBody(c);
+    if (body === undefined) {
+      await next();
+      return;
+    }
+    const hash = await requestHash(body);
+
+    const key = `${c.req.header('Authorization') ?? ''}\n${idempotencyKey}`;
+    const stored = store.lookup(key, hash);
+    if (stored === 'conflict') {
+      throw new IdempotencyConflictError();
+    }
+    if (stored) {
+      return c.body(stored.body, stored.status as any, { ...stored.headers, [IDEMPOTENT_REPLAY_HEADER]: 'true' });
+    }
+
+    await next();
+
+    if (!c.res.ok) {
+      return;
+    }
+    const contentType = c.res.headers.get('Content-Type') ?? '';
+    const status = c.res.status;
+    if (!contentType.includes('text/event-stream')) {
+      store.set(key, {
+        requestHash: hash,
+        status,
+        headers: { 'Content-Type': contentType },
+        body: await c.res.clone().text(),
+      });
+      return;
+    }
+
+    const body = c.res.body;
+    if (body) {
+      c.res = new Response(recordStream(body, (text) => {
+        store.set(key, {
+          requestHash: hash,
+          status,
+          headers: { 'Content-Type': contentType, 'Cache-Control': 'no-cache' },
+          body: text,
+        });
+      }), c.res);
+    }
+    return;
+  };
+}
+
+// Passes a stream through, handing its text to onComplete if it ends with
+// [DONE]; errors and cancellation leave it unrecorded
+function recordStream(body: ReadableStream<Uint8Array>, onComplete: (text: string) => void): ReadableStream<Uint8Array> {
+  const reader = body.getReader();
+  const decoder = new TextDecoder('utf-8', { ignoreBOM: true });
+  let text = '';
+  return new ReadableStream({
+    async pull(controller) {
+      try {
+        const { done, value } = await reader.read();
+        if (done) {
+          text += decoder.decode();
+          if (text.endsWith('data: [DONE]\n\n')) {
+            onComplete(text);
+          }
+          controller.close();
+        } else {
+          text += decoder.decode(value, { stream: true });
+          controller.enqueue(value);
+        }
+      } catch (error) {
+        controller.error(error);
+      }
+    },
+    cancel(reason) {
+      return reader.cancel(reason);
+    },
+  });
+}
@@ -0,0 +1,17 @@
+import { describe, it, expect } from "vitest";
+import { ConcurrencyLimiter } from "./ip-limit.js";
+
+describe("ConcurrencyLimiter", () => {
+  it("should limit each IP separately and free slots on release", () => {
+    const limiter = new ConcurrencyLimiter(2);
+
+    expect(limiter.tryAcquire("203.0.113.1")).toBe(true);
+    expect(limiter.tryAcquire("203.0.113.1")).toBe(true);
+    expect(limiter.tryAcquire("203.0.113.1")).toBe(false);
+    expect(limiter.tryAcquire("203.0.113.2")).toBe(true);
+
+    limiter.release("203.0.113.1");
+    expect(limiter.inFlight("203.0.113.1")).toBe(1);
+    expect(limiter.tryAcquire("203.0.113.1")).toBe(true);
+  });
+});
@@ -0,0 +1,71 @@
+import { Context, Next } from 'hono';
+import { RateLimitError } from '../openai-protocol/errors.js';
+import { afterResponse } from './response-end.js';
+import { clientIp } from './client-ip.js';
+
+export interface IpLimitConfig {
+  // Requests from one client IP handled at once; streams count until they end
+  maxConcurrent: number;
+}
+
+/**
+ * Requests in flight per client IP. Unlike the queue nothing waits: a client
+ * at its limit is turned away until one of its requests finishes.
+ */
+export class ConcurrencyLimiter {
+  private active = new Map<string, number>();
+
+  constructor(private maxConcurrent: number) {}
+
+  tryAcquire(ip: string): boolean {
+    const count = this.active.get(ip) ?? 0;
+    if (count >= this.maxConcurrent) {
+      return false;
+    }
+    this.active.set(ip, count + 1);
+    return true;
+  }
+
+  release(ip: string): void {
+    const count = this.active.get(ip) ?? 0;
+    if (count <= 1) {
+      this.active.delete(ip);
+    } else {
+      this.active.set(ip, count - 1);
+    }
+  }
+
+  inFlight(ip: string): number {
+    return this.active.get(ip) ?? 0;
+  }
+}
+
+/**
+ * Rejects requests from a client IP that already has the configured number
+ * in flight with a 429, so one noisy client can't take every slot.
+ */
+export function createIpLimitMiddleware(limiter: ConcurrencyLimiter, trustedProxies: string[] = []) {
+  return async (c: Context, next: Next) => {
+    const ip = clientIp(c, trustedProxies);
+    if (!limiter.tryAcquire(ip)) {
+      throw new RateLimitError(1, 'Too many concurrent requests from this IP address, please retry later');
+    }
+
+    let released = false;
+    const release = () => {
+      if (!released) {
+        released = true;
+        limiter.release(ip);
+      }
+    };
+
+    try {
+      await next();
+    } catch (error) {
+      release();
+      throw error;
+    }
+
+    afterResponse(c, release);
+  };
+}
@@ -0,0 +1,52 @@
+import { Context, Next } from 'hono';
+import { readJsonBody } from '../utils/request-body.js';
+import type { RequestTimer } from '../utils/request-timer.js';
+
+// The request body as parsed, or what reading or parsing it threw
+export type ParsedBody = { value: unknown } | { error: unknown };
+
+type Variables = {
+  timing?: RequestTimer;
+  body?: ParsedBody;
+};
+
+/**
+ * Reads and parses a JSON request body once, for the middleware and handler
+ * after it. A body that can't be read isn't rejected here: middleware that
+ * only peek at it go on without it, and the handler reports the problem.
+ */
+export function createJsonBodyMiddleware(maxRequestBytes?: number) {
+  return async (c: Context<{ Variables: Variables }>, next: Next) => {
+    const read = () => readJsonBody<unknown>(c.req.raw, maxRequestBytes);
+    try {
+      const timing = c.get('timing');
+      c.set('body', { value: await (timing ? timing.time('parse', read) : read()) });
+    } catch (error) {
+      c.set('body', { error });
+    }
+    await next();
+  };
+}
+
+// The parsed body, throwing what reading it threw
+export function jsonBody(c: Context): unknown {
+  const body = parsedBody(c);
+  if ('error' in body) {
+    throw body.error;
+  }
+  return body.value;
+}
+
+// The parsed body, or undefined if it couldn't be read
+export function peekJsonBody(c: Context): unknown {
+  const body = parsedBody(c);
+  return 'error' in body ? undefined : body.value;
+}
+
+function parsedBody(c: Context): ParsedBody {
+  const body = c.get('body') as ParsedBody | undefined;
+  if (!body) {
+    throw new Error('The JSON body middleware must run before reading the body');
+  }
+  return body;
+}
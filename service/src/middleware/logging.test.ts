@@ -0,0 +1,85 @@
+import { describe, it, expect } from "vitest";
+import { LogFilter, parseLogFilterConfig, shouldLogRequest } from "./logging.js";
+import { InvalidRequestError } from "../openai-protocol/errors.js";
+
+describe("shouldLogRequest", () => {
+  const filters = {
+    suppressRoutes: ["/health", "/metrics"],
+    sampleRates: { "/v1/models": 0.25, "/health": 1 },
+  };
+
+  it.each([
+    // path, roll, status, expected
+    ["/health", 0, undefined, false],
+    ["/health", 0, 200, false],
+    ["/health", 0, 404, true],
+    ["/metrics", 0.5, 503, true],
+    ["/v1/models", 0.1, undefined, true],
+    ["/v1/models", 0.1, 200, true],
+    ["/v1/models", 0.25, 200, false],
+    ["/v1/models", 0.9, undefined, false],
+    ["/v1/models", 0.9, 401, true],
+    ["/v1/chat/completions", 0.999, 200, true],
+    ["/v1/chat/completions", 0.999, 500, true],
+  ] as const)("should decide %s with roll %s and status %s", (path, roll, status, expected) => {
+    expect(shouldLogRequest(filters, path, roll, status)).toBe(expected);
+  });
+
+  it("should log everything when no filters are configured", () => {
+    expect(shouldLogRequest({}, "/health", 0.999, 200)).toBe(true);
+  });
+
+  it("should match paths exactly", () => {
+    expect(shouldLogRequest(filters, "/health/deep", 0, 200)).toBe(true);
+  });
+
+  it("should log nothing but errors at a sample rate of zero", () => {
+    const none = { sampleRates: { "/v1/models": 0 } };
+
+    expect(shouldLogRequest(none, "/v1/models", 0, 200)).toBe(false);
+    expect(shouldLogRequest(none, "/v1/models", 0, 500)).toBe(true);
+  });
+});
+
+describe("parseLogFilterConfig", () => {
+  it("should accept valid filters", () => {
+    const filters = { suppressRoutes: ["/health"], sampleRates: { "/v1/models": 0.5 } };
+
+    expect(parseLogFilterConfig(filters)).toEqual(filters);
+    expect(parseLogFilterConfig({})).toEqual({});
+  });
+
+  it.each([
+    ["a non-object", []],
+    ["an unknown key", { suppress: ["/health"] }],
+    ["routes that aren't paths", { suppressRoutes: ["health"] }],
+    ["a non-array of routes", { suppressRoutes: "/health" }],
+    ["a rate above one", { sampleRates: { "/health": 1.5 } }],
+    ["a negative rate", { sampleRates: { "/health": -0.1 } }],
+    ["a non-numeric rate", { sampleRates: { "/health": "half" } }],
+  ])("should reject %s", (_description, value) => {
+    expect(() => parseLogFilterConfig(value)).toThrow(InvalidRequestError);
+  });
+});
+
+describe("LogFilter", () => {
+  it("should count suppressed requests as well as logged ones", () => {
+    const filter = new LogFilter({ suppressRoutes: ["/health"] }, () => 0);
+
+    for (const [path, status] of [["/health", 200], ["/health", 500], ["/v1/models", 200]] as const) {
+      filter.record(filter.begin(path)(status));
+    }
+
+    expect(filter.stats()).toEqual({ requests: 3, logged: 2, suppressed: 1 });
+  });
+
+  it("should keep a request's decision when the filters change mid-request", () => {
+    const filter = new LogFilter({}, () => 0.5);
+
+    const shouldLog = filter.begin("/health");
+    filter.update({ suppressRoutes: ["/health"] });
+
+    expect(shouldLog(200)).toBe(true);
+    expect(filter.begin("/health")(200)).toBe(false);
+  });
+});
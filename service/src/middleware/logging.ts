@@ -1,43 +1,175 @@
 import { Context, Next } from 'hono';
+import { Logger } from '../utils/logger.js';
+import { RequestTimer } from '../utils/request-timer.js';
+import { InvalidRequestError } from '../openai-protocol/errors.js';
 
 type Variables = {
   requestId: string;
+  timing: RequestTimer;
 };
 
-export function createLoggingMiddleware() {
+export interface LogFilterConfig {
+  // Paths whose access logs are dropped entirely, e.g. '/health'
+  suppressRoutes?: string[] | undefined;
+  // Fraction of requests logged per path, from 0 (none) to 1 (all)
+  sampleRates?: Record<string, number> | undefined;
+}
+
+/**
+ * Decides whether a request's access log lines are written.
+ *
+ * `roll` is drawn once per request in [0, 1) so the start and completion
+ * lines of a sampled request agree. Responses with an error status are
+ * always logged, whatever the filters say; `status` is left out when the
+ * request hasn't completed yet.
+ */
+export function shouldLogRequest(
+  filters: LogFilterConfig,
+  path: string,
+  roll: number,
+  status?: number
+): boolean {
+  if (status !== undefined && status >= 400) {
+    return true;
+  }
+  if (filters.suppressRoutes?.includes(path)) {
+    return false;
+  }
+  return roll < (filters.sampleRates?.[path] ?? 1);
+}
+
+// Validates filters from the config file or the admin API
+export function parseLogFilterConfig(value: unknown): LogFilterConfig {
+  if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+    throw new InvalidRequestError('Log filters must be an object');
+  }
+  const { suppressRoutes, sampleRates, ...rest } = value as Record<string, unknown>;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown log filter: ${unknownKey}`, unknownKey);
+  }
+
+  if (
+    suppressRoutes !== undefined &&
+    (!Array.isArray(suppressRoutes) || !suppressRoutes.every((route) => typeof route === 'string' && route.startsWith('/')))
+  ) {
+    throw new InvalidRequestError('suppressRoutes must be an array of paths starting with /', 'suppressRoutes');
+  }
+
+  if (sampleRates !== undefined) {
+    if (typeof sampleRates !== 'object' || sampleRates === null || Array.isArray(sampleRates)) {
+      throw new InvalidRequestError('sampleRates must map paths to rates', 'sampleRates');
+    }
+    for (const [route, rate] of Object.entries(sampleRates)) {
+      if (!route.startsWith('/') || typeof rate !== 'number' || !(rate >= 0 && rate <= 1)) {
+        throw new InvalidRequestError(
+          `sampleRates must map paths starting with / to rates between 0 and 1; got ${route}: ${String(rate)}`,
+          'sampleRates'
+        );
+      }
+    }
+  }
+
+  return {
+    suppressRoutes: suppressRoutes as string[] | undefined,
+    sampleRates: sampleRates as Record<string, number> | undefined,
+  };
+}
+
+export interface LogFilterCounts {
+  // Every request seen, logged or not
+  requests: number;
+  logged: number;
+  suppressed: number;
+}
+
+/**
+ * Current log filters, replaceable at runtime, plus counts of what they let
+ * through. Filtered requests are still counted so traffic figures stay
+ * accurate while their logs are quiet.
+ */
+export class LogFilter {
+  private counts: LogFilterCounts = { requests: 0, logged: 0, suppressed: 0 };
+
+  constructor(
+    private filters: LogFilterConfig = {},
+    private random: () => number = Math.random
+  ) {}
+
+  get config(): LogFilterConfig {
+    return this.filters;
+  }
+
+  update(filters: LogFilterConfig): void {
+    this.filters = filters;
+  }
+
+  stats(): LogFilterCounts {
+    return { ...this.counts };
+  }
+
+  // Starts a request; the returned function tells whether to log a line
+  begin(path: string): (status?: number) => boolean {
+    this.counts.requests++;
+    const filters = this.filters;
+    const roll = this.random();
+    return (status) => shouldLogRequest(filters, path, roll, status);
+  }
+
+  // Records whether a completed request was logged
+  record(logged: boolean): void {
+    if (logged) {
+      this.counts.logged++;
+    } else {
+      this.counts.suppressed++;
+    }
+  }
+}
+
+export function createLoggingMiddleware(logger: Logger = new Logger(), filter: LogFilter = new LogFilter()) {
   return async (c: Context<{ Variables: Variables }>, next: Next) => {
     const start = Date.now();
-    
+    const timing = new RequestTimer();
+    const shouldLog = filter.begin(c.req.path);
+
     // Generate request ID (compatible with both Node.js and CF Workers)
-    const requestId = globalThis.crypto?.randomUUID?.() || 
+    const requestId = globalThis.crypto?.randomUUID?.() ||
       Math.random().toString(36).substring(2, 15) + Math.random().toString(36).substring(2, 15);
-    
+
     // Add request ID to context
     c.set('requestId', requestId);
-    
+    // Later middleware and handlers record their phases against this
+    c.set('timing', timing);
+
     // Add request ID to response headers
     c.header('X-Request-ID', requestId);
 
-    console.log(JSON.stringify({
-      level: 'info',
-      message: 'Request started',
-      request_id: requestId,
-      method: c.req.method,
-      path: c.req.path,
-      user_agent: c.req.header('User-Agent'),
-    }));
+    if (shouldLog()) {
+      logger.info('Request started', {
+        request_id: requestId,
+        method: c.req.method,
+        path: c.req.path,
+        user_agent: c.req.header('User-Agent'),
+      });
+    }
 
     await next();
 
+    const logged = shouldLog(c.res.status);
+    filter.record(logged);
+    if (!logged) {
+      return;
+    }
+
     const duration = Date.now() - start;
-    console.log(JSON.stringify({
-      level: 'info',
-      message: 'Request completed',
+    logger.info('Request completed', {
       request_id: requestId,
       method: c.req.method,
       path: c.req.path,
       status: c.res.status,
       duration_ms: duration,
-    }));
+      phases_ms: timing.phases(),
+    });
   };
-}
\ No newline at end of file
+}
@@ -0,0 +1,79 @@
+import { Context, Next } from 'hono';
+import { InvalidRequestError, ServiceUnavailableError } from '../openai-protocol/errors.js';
+
+export const DEFAULT_MAINTENANCE_RETRY_AFTER_SECONDS = 60;
+
+export interface MaintenanceStatus {
+  enabled: boolean;
+  // Sent as Retry-After with each rejected request
+  retry_after_seconds: number;
+  // When maintenance started, while enabled
+  since: string | null;
+}
+
+/**
+ * Whether the server is down for maintenance, switched at runtime via
+ * PUT /admin/maintenance. Only new requests are turned away, so streams
+ * already running finish normally.
+ */
+export class MaintenanceMode {
+  private since: Date | undefined;
+
+  constructor(private retryAfterSeconds: number = DEFAULT_MAINTENANCE_RETRY_AFTER_SECONDS) {}
+
+  get enabled(): boolean {
+    return this.since !== undefined;
+  }
+
+  // Switches maintenance on or off; the Retry-After is kept unless given
+  set(enabled: boolean, retryAfterSeconds?: number): void {
+    if (retryAfterSeconds !== undefined) {
+      this.retryAfterSeconds = retryAfterSeconds;
+    }
+    if (enabled !== this.enabled) {
+      this.since = enabled ? new Date() : undefined;
+    }
+  }
+
+  status(): MaintenanceStatus {
+    return {
+      enabled: this.enabled,
+      retry_after_seconds: this.retryAfterSeconds,
+      since: this.since?.toISOString() ?? null,
+    };
+  }
+
+  check(): void {
+    if (this.enabled) {
+      throw new ServiceUnavailableError(this.retryAfterSeconds);
+    }
+  }
+}
+
+// Validates a PUT /admin/maintenance body: {"enabled": true, "retryAfterSeconds": 120}
+export function parseMaintenanceUpdate(value: unknown): { enabled: boolean; retryAfterSeconds?: number | undefined } {
+  if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+    throw new InvalidRequestError('Maintenance settings must be an object');
+  }
+  const { enabled, retryAfterSeconds, ...rest } = value as Record<string, unknown>;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown maintenance setting: ${unknownKey}`, unknownKey);
+  }
+  if (typeof enabled !== 'boolean') {
+    throw new InvalidRequestError('enabled must be true or false', 'enabled');
+  }
+  if (retryAfterSeconds !== undefined && !(Number.isInteger(retryAfterSeconds) && (retryAfterSeconds as number) >= 0)) {
+    throw new InvalidRequestError('retryAfterSeconds must be a non-negative integer', 'retryAfterSeconds');
+  }
+  return { enabled, retryAfterSeconds: retryAfterSeconds as number | undefined };
+}
+
+// Rejects requests with 503 and Retry-After while in maintenance
+export function createMaintenanceMiddleware(mode: MaintenanceMode) {
+  return async (_c: Context, next: Next) => {
+    mode.check();
+    await next();
+  };
+}
@@ -0,0 +1,50 @@
+import { Context, Next } from 'hono';
+import { InvalidOrganizationError } from '../openai-protocol/errors.js';
+
+export interface OrganizationConfig {
+  // Organization ids accepted in OpenAI-Organization; any when unset
+  organizations?: string[] | undefined;
+  // Project ids accepted in OpenAI-Project; any when unset
+  projects?: string[] | undefined;
+}
+
+// Who a request is billed to, from the OpenAI-Organization and
+// OpenAI-Project headers, for attributing usage
+export interface RequestOrganization {
+  organization?: string | undefined;
+  project?: string | undefined;
+}
+
+export function requestOrganization(c: Context): RequestOrganization {
+  return {
+    organization: c.req.header('OpenAI-Organization')?.trim() || undefined,
+    project: c.req.header('OpenAI-Project')?.trim() || undefined,
+  };
+}
+
+/**
+ * Echoes the OpenAI-Organization and OpenAI-Project headers back as
+ * openai-organization and openai-project, like OpenAI, and rejects ids
+ * outside the configured lists with its 401 invalid_organization error.
+ * Requests without the headers are always accepted.
+ */
+export function createOrganizationMiddleware(config: OrganizationConfig = {}) {
+  return async (c: Context, next: Next) => {
+    const { organization, project } = requestOrganization(c);
+
+    if (organization !== undefined) {
+      c.header('openai-organization', organization);
+      if (config.organizations && !config.organizations.includes(organization)) {
+        throw new InvalidOrganizationError(`No such organization: ${organization}.`);
+      }
+    }
+    if (project !== undefined) {
+      c.header('openai-project', project);
+      if (config.projects && !config.projects.includes(project)) {
+        throw new InvalidOrganizationError(`No such project: ${project}.`);
+      }
+    }
+
+    await next();
+  };
+}
@@ -0,0 +1,17 @@
+import { describe, it, expect } from "vitest";
+import { requestPriority } from "./priority.js";
+
+describe("requestPriority", () => {
+  it("should follow the requested service_tier", () => {
+    expect(requestPriority("priority", "key")).toBe("high");
+    expect(requestPriority("default", "key", { key: "low" })).toBe("normal");
+    expect(requestPriority("flex", "key", { key: "high" })).toBe("low");
+  });
+
+  it("should fall back to the API key's priority, then normal", () => {
+    expect(requestPriority(undefined, "key", { key: "high" })).toBe("high");
+    expect(requestPriority("auto", "key", { key: "low" })).toBe("low");
+    expect(requestPriority(undefined, "other", { key: "high" })).toBe("normal");
+    expect(requestPriority(undefined, "constructor", {})).toBe("normal");
+  });
+});
@@ -0,0 +1,49 @@
+import { Context } from 'hono';
+import type { ChatCompletionServiceTier, ResolvedServiceTier } from '../openai-protocol/types.js';
+import { bearerToken } from './auth.js';
+import { peekJsonBody } from './json-body.js';
+import type { Priority } from './queue.js';
+
+// The queue priority each processing tier gets, and the tier reported for
+// each priority
+export const SERVICE_TIER_PRIORITIES: Record<ResolvedServiceTier, Priority> = {
+  priority: 'high',
+  default: 'normal',
+  flex: 'low',
+};
+export const PRIORITY_SERVICE_TIERS: Record<Priority, ResolvedServiceTier> = {
+  high: 'priority',
+  normal: 'default',
+  low: 'flex',
+};
+
+/**
+ * A request's queue priority: the service_tier it asks for, or its API
+ * key's priority when it leaves the tier to the server, or normal.
+ */
+export function requestPriority(
+  serviceTier: ChatCompletionServiceTier | undefined,
+  apiKey: string,
+  keyPriorities: Record<string, Priority> = {}
+): Priority {
+  if (serviceTier !== undefined && serviceTier !== 'auto') {
+    return SERVICE_TIER_PRIORITIES[serviceTier];
+  }
+  return Object.prototype.hasOwnProperty.call(keyPriorities, apiKey) ? keyPriorities[apiKey]! : 'normal';
+}
+
+/**
+ * Classifies a chat completion for the queue from its service_tier. Bodies
+ * that can't be read count as normal; the handler rejects them itself.
+ */
+export function createPriorityClassifier(keyPriorities: Record<string, Priority> = {}) {
+  return async (c: Context): Promise<Priority> => {
+    let serviceTier: ChatCompletionServiceTier | undefined;
+    const body = peekJsonBody(c);
+    const requested = typeof body === 'object' && body !== null ? (body as Record<string, unknown>).service_tier : undefined;
+    if (typeof requested === 'string' && Object.prototype.hasOwnProperty.call(SERVICE_TIER_PRIORITIES, requested)) {
+      serviceTier = requested as ResolvedServiceTier;
+    }
+    return requestPriority(serviceTier, bearerToken(c.req.header('Authorization')) ?? '', keyPriorities);
+  };
+}
@@ -0,0 +1,91 @@
+import { describe, it, expect } from "vitest";
+import { RequestQueue } from "./queue.js";
+
+describe("RequestQueue", () => {
+  it("should hand out slots up to the concurrency limit", () => {
+    const queue = new RequestQueue({ maxConcurrent: 2, maxQueued: 0 });
+
+    expect(queue.tryAcquire()).toBe(true);
+    expect(queue.tryAcquire()).toBe(true);
+    expect(queue.tryAcquire()).toBe(false);
+
+    queue.release();
+    expect(queue.tryAcquire()).toBe(true);
+  });
+
+  it("should refuse to queue beyond the queue limit", () => {
+    const queue = new RequestQueue({ maxConcurrent: 1, maxQueued: 1 });
+    queue.tryAcquire();
+
+    expect(queue.enqueue()).toBeInstanceOf(Promise);
+    expect(queue.enqueue()).toBeUndefined();
+    expect(queue.queued).toBe(1);
+  });
+
+  it("should pass released slots to waiters in arrival order", async () => {
+    const queue = new RequestQueue({ maxConcurrent: 1, maxQueued: 2 });
+    const order: string[] = [];
+    queue.tryAcquire();
+
+    const first = queue.enqueue()!.then(() => order.push("first"));
+    const second = queue.enqueue()!.then(() => order.push("second"));
+
+    queue.release();
+    await first;
+    expect(order).toEqual(["first"]);
+    // The slot went to the waiter rather than becoming free
+    expect(queue.tryAcquire()).toBe(false);
+
+    queue.release();
+    await second;
+    expect(order).toEqual(["first", "second"]);
+  });
+
+  it("should admit waiters by priority before arrival order", async () => {
+    const queue = new RequestQueue({ maxConcurrent: 1, maxQueued: 3 });
+    const order: string[] = [];
+    queue.tryAcquire();
+
+    const low = queue.enqueue("low")!.then(() => order.push("low"));
+    const normal = queue.enqueue()!.then(() => order.push("normal"));
+    const high = queue.enqueue("high")!.then(() => order.push("high"));
+    expect(queue.stats().queued).toEqual({ high: 1, normal: 1, low: 1 });
+
+    for (const turn of [high, normal, low]) {
+      queue.release();
+      await turn;
+    }
+    expect(order).toEqual(["high", "normal", "low"]);
+  });
+
+  it("should shed the newest lower priority waiter when full", async () => {
+    const queue = new RequestQueue({ maxConcurrent: 1, maxQueued: 2 });
+    queue.tryAcquire();
+    const older = queue.enqueue("low")!;
+    const newer = queue.enqueue("low")!;
+
+    const high = queue.enqueue("high");
+    expect(high).toBeInstanceOf(Promise);
+    await expect(newer).rejects.toThrow("Shed from the low priority queue for a high priority request");
+    expect(queue.enqueue("low")).toBeUndefined();
+    expect(queue.stats()).toMatchObject({ queued: { high: 1, normal: 0, low: 1 }, shed: { high: 0, normal: 0, low: 2 } });
+
+    queue.release();
+    await high;
+    queue.release();
+    await older;
+  });
+
+  it("should time out waiters of a priority with a wait limit", async () => {
+    const queue = new RequestQueue({ maxConcurrent: 1, maxQueued: 2, maxWaitMs: { low: 5 } });
+    queue.tryAcquire();
+    const low = queue.enqueue("low")!;
+    const normal = queue.enqueue("normal")!;
+
+    await expect(low).rejects.toThrow("Timed out after 5ms in the low priority queue");
+    expect(queue.stats()).toMatchObject({ queued: { low: 0, normal: 1 }, shed: { low: 1 } });
+
+    queue.release();
+    await normal;
+  });
+});
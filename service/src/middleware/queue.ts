@@ -0,0 +1,181 @@
+import { Context, Next } from 'hono';
+import { OverloadedError } from '../openai-protocol/errors.js';
+import { afterResponse } from './response-end.js';
+
+// Admission classes, most important first
+export const PRIORITIES = ['high', 'normal', 'low'] as const;
+
+export type Priority = typeof PRIORITIES[number];
+
+export interface QueueConfig {
+  // Requests handled at once; later ones wait in the queue
+  maxConcurrent: number;
+  // Requests allowed to wait; beyond this they're rejected with 503
+  maxQueued: number;
+  // Longest a request of each priority waits before it's rejected with 503;
+  // priorities left out wait until a slot frees up
+  maxWaitMs?: Partial<Record<Priority, number>> | undefined;
+}
+
+export interface QueueStats {
+  active: number;
+  max_concurrent: number;
+  max_queued: number;
+  // Requests waiting now, by priority
+  queued: Record<Priority, number>;
+  // Requests turned away since startup, by priority: rejected with the queue
+  // full, pushed out by a more important request, or timed out waiting
+  shed: Record<Priority, number>;
+}
+
+interface Waiter {
+  admit: () => void;
+  shed: (error: OverloadedError) => void;
+  timer?: ReturnType<typeof setTimeout> | undefined;
+}
+
+/**
+ * Counts requests in flight and holds the rest until a slot frees up. A
+ * finished request hands its slot straight to the next waiter: the oldest
+ * of the highest priority waiting, so lower priorities only get slots no
+ * one more important wants. When the queue is full a request sheds the
+ * newest waiter of a lower priority, if there is one, to take its place.
+ */
+export class RequestQueue {
+  private active = 0;
+  private waiting: Record<Priority, Waiter[]> = { high: [], normal: [], low: [] };
+  private shedCounts: Record<Priority, number> = { high: 0, normal: 0, low: 0 };
+
+  constructor(private config: QueueConfig) {}
+
+  // Takes a slot if one is free
+  tryAcquire(): boolean {
+    if (this.active < this.config.maxConcurrent) {
+      this.active++;
+      return true;
+    }
+    return false;
+  }
+
+  // Waits for a slot, or returns undefined when the queue is full of
+  // requests at least as important. The promise rejects with an
+  // OverloadedError if the request is shed or times out while waiting.
+  enqueue(priority: Priority = 'normal'): Promise<void> | undefined {
+    if (this.queued >= this.config.maxQueued && !this.shedLowerThan(priority)) {
+      this.shedCounts[priority]++;
+      return undefined;
+    }
+
+    return new Promise((resolve, reject) => {
+      const waiter: Waiter = { admit: resolve, shed: reject };
+      const maxWaitMs = this.config.maxWaitMs?.[priority];
+      if (maxWaitMs !== undefined) {
+        waiter.timer = setTimeout(() => {
+          this.remove(priority, waiter);
+          this.shedCounts[priority]++;
+          reject(new OverloadedError(`Timed out after ${maxWaitMs}ms in the ${priority} priority queue, please retry later`));
+        }, maxWaitMs);
+      }
+      this.waiting[priority].push(waiter);
+    });
+  }
+
+  release(): void {
+    const priority = PRIORITIES.find((candidate) => this.waiting[candidate].length > 0);
+    const next = priority && this.waiting[priority].shift();
+    if (next) {
+      clearTimeout(next.timer);
+      next.admit();
+    } else {
+      this.active--;
+    }
+  }
+
+  get queued(): number {
+    return PRIORITIES.reduce((total, priority) => total + this.waiting[priority].length, 0);
+  }
+
+  stats(): QueueStats {
+    return {
+      active: this.active,
+      max_concurrent: this.config.maxConcurrent,
+      max_queued: this.config.maxQueued,
+      queued: { high: this.waiting.high.length, normal: this.waiting.normal.length, low: this.waiting.low.length },
+      shed: { ...this.shedCounts },
+    };
+  }
+
+  // Rejects the newest waiter of the lowest priority below the given one
+  private shedLowerThan(priority: Priority): boolean {
+    for (const lower of [...PRIORITIES].reverse()) {
+      if (lower === priority) {
+        return false;
+      }
+      const waiter = this.waiting[lower].pop();
+      if (waiter) {
+        clearTimeout(waiter.timer);
+        this.shedCounts[lower]++;
+        waiter.shed(new OverloadedError(`Shed from the ${lower} priority queue for a ${priority} priority request, please retry later`));
+        return true;
+      }
+    }
+    return false;
+  }
+
+  private remove(priority: Priority, waiter: Waiter): void {
+    const waiting = this.waiting[priority];
+    const index = waiting.indexOf(waiter);
+    if (index !== -1) {
+      waiting.splice(index, 1);
+    }
+  }
+}
+
+/**
+ * Simulates a busy server: requests beyond the concurrency limit wait their
+ * turn, and their response reports the wait in an x-queue-wait-ms header.
+ * priorityOf classifies a request only when it has to wait.
+ *
+ * Streaming responses keep their slot until the stream ends or the client
+ * goes away, not just until the headers are sent.
+ */
+export function createQueueMiddleware(
+  queue: RequestQueue,
+  priorityOf: (c: Context) => Promise<Priority> = async () => 'normal'
+) {
+  return async (c: Context, next: Next) => {
+    let waitMs: number | undefined;
+    if (!queue.tryAcquire()) {
+      const queuedAt = Date.now();
+      // A slot may have freed up while the request was classified
+      const priority = await priorityOf(c);
+      const turn = queue.tryAcquire() ? Promise.resolve() : queue.enqueue(priority);
+      if (!turn) {
+        throw new OverloadedError('Too many requests queued, please retry later');
+      }
+      await turn;
+      waitMs = Date.now() - queuedAt;
+    }
+
+    let released = false;
+    const release = () => {
+      if (!released) {
+        released = true;
+        queue.release();
+      }
+    };
+
+    try {
+      await next();
+    } catch (error) {
+      release();
+      throw error;
+    }
+
+    if (waitMs !== undefined) {
+      c.header('x-queue-wait-ms', String(waitMs));
+    }
+
+    afterResponse(c, release);
+  };
+}
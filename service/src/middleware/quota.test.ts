@@ -0,0 +1,55 @@
+import { describe, it, expect } from "vitest";
+import { parseQuotaConfig, QuotaTracker } from "./quota.js";
+
+describe("QuotaTracker", () => {
+  it("should count down a key's budget without going below zero", () => {
+    const tracker = new QuotaTracker({ default: 100 });
+
+    tracker.charge("tt-key-1", 60);
+    expect(tracker.remaining("tt-key-1")).toBe(40);
+
+    tracker.charge("tt-key-1", 60);
+    expect(tracker.remaining("tt-key-1")).toBe(0);
+    expect(tracker.quotas()).toEqual([{ key: "tt-key***", budget: 100, used: 120, remaining: 0 }]);
+  });
+
+  it("should prefer per-key budgets and leave keys without one unlimited", () => {
+    const tracker = new QuotaTracker({ keys: { "tt-trial": 10 } });
+
+    expect(tracker.remaining("tt-trial")).toBe(10);
+    expect(tracker.remaining("tt-paid")).toBeUndefined();
+
+    tracker.charge("tt-paid", 1000);
+    expect(tracker.quotas()).toEqual([]);
+  });
+
+  it("should restore full budgets on reset", () => {
+    const tracker = new QuotaTracker({ default: 5 });
+    tracker.charge("tt-key-1", 5);
+
+    tracker.reset();
+
+    expect(tracker.remaining("tt-key-1")).toBe(5);
+    expect(tracker.quotas()).toEqual([]);
+  });
+});
+
+describe("parseQuotaConfig", () => {
+  it("should accept a default and per-key budgets", () => {
+    expect(parseQuotaConfig({ default: 1000, keys: { "tt-trial": 0 } })).toEqual({
+      default: 1000,
+      keys: { "tt-trial": 0 },
+    });
+  });
+
+  it.each([
+    [[], undefined],
+    [{ default: -1 }, "default"],
+    [{ default: 1.5 }, "default"],
+    [{ keys: { "tt-trial": "lots" } }, "keys"],
+    [{ keys: [] }, "keys"],
+    [{ monthly: 10 }, "monthly"],
+  ])("should reject %j", (config, param) => {
+    expect(() => parseQuotaConfig(config)).toThrow(expect.objectContaining({ param }));
+  });
+});
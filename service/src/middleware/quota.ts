@@ -0,0 +1,129 @@
+import { Context, Next } from 'hono';
+import { InsufficientQuotaError, InvalidRequestError } from '../openai-protocol/errors.js';
+import { maskAPIKey } from '../utils/audit-log.js';
+import { bearerToken } from './auth.js';
+import { afterResponse } from './response-end.js';
+import type { CompletionOutcome } from './webhook.js';
+
+// Tokens left for the key once the request is charged (before it, for streams)
+export const QUOTA_REMAINING_HEADER = 'X-TeenyTiny-Quota-Remaining-Tokens';
+
+export interface QuotaConfig {
+  // Total prompt plus completion tokens each key may use; keys without a
+  // budget are unlimited
+  default?: number | undefined;
+  // Per API key budgets, replacing the default
+  keys?: Record<string, number> | undefined;
+}
+
+export interface KeyQuota {
+  // Masked API key
+  key: string;
+  budget: number;
+  used: number;
+  remaining: number;
+}
+
+/**
+ * Running token totals per API key against hard budgets. Unlike rate
+ * limits nothing resets with time; only reset() clears usage.
+ */
+export class QuotaTracker {
+  private used = new Map<string, number>();
+
+  constructor(private config: QuotaConfig) {}
+
+  budget(apiKey: string): number | undefined {
+    return this.config.keys?.[apiKey] ?? this.config.default;
+  }
+
+  // Tokens left, never below zero, or undefined when the key is unlimited
+  remaining(apiKey: string): number | undefined {
+    const budget = this.budget(apiKey);
+    return budget === undefined ? undefined : Math.max(budget - (this.used.get(apiKey) ?? 0), 0);
+  }
+
+  charge(apiKey: string, tokens: number): void {
+    this.used.set(apiKey, (this.used.get(apiKey) ?? 0) + tokens);
+  }
+
+  // Clears recorded usage for every key, restoring full budgets
+  reset(): void {
+    this.used.clear();
+  }
+
+  // Keys with a budget that have made requests so far
+  quotas(): KeyQuota[] {
+    return [...this.used].flatMap(([apiKey, used]) => {
+      const budget = this.budget(apiKey);
+      return budget === undefined
+        ? []
+        : [{ key: maskAPIKey(apiKey), budget, used, remaining: Math.max(budget - used, 0) }];
+    });
+  }
+}
+
+// Validates budgets from the config file
+export function parseQuotaConfig(value: unknown): QuotaConfig {
+  if (!isObject(value)) {
+    throw new InvalidRequestError('Quotas must be an object');
+  }
+  const { default: defaultBudget, keys, ...rest } = value;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown quota setting: ${unknownKey}`, unknownKey);
+  }
+
+  if (defaultBudget !== undefined && !isBudget(defaultBudget)) {
+    throw new InvalidRequestError('default must be a non-negative integer number of tokens', 'default');
+  }
+  if (keys !== undefined && !(isObject(keys) && Object.values(keys).every(isBudget))) {
+    throw new InvalidRequestError('keys must map API keys to non-negative integer numbers of tokens', 'keys');
+  }
+
+  return { default: defaultBudget as number | undefined, keys: keys as Record<string, number> | undefined };
+}
+
+function isBudget(value: unknown): value is number {
+  return Number.isSafeInteger(value) && (value as number) >= 0;
+}
+
+function isObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
+
+/**
+ * Rejects chat completions from keys whose budget is spent with OpenAI's
+ * insufficient_quota 429, and charges each completion's usage once known.
+ * Streams are charged when they end, so one may run over the budget; the
+ * next request is then refused.
+ */
+export function createQuotaMiddleware(tracker: QuotaTracker) {
+  return async (c: Context, next: Next) => {
+    const apiKey = bearerToken(c.req.header('Authorization')) ?? '';
+    const remaining = tracker.remaining(apiKey);
+    if (remaining === undefined) {
+      await next();
+      return;
+    }
+
+    c.header(QUOTA_REMAINING_HEADER, String(remaining));
+    if (remaining <= 0) {
+      throw new InsufficientQuotaError();
+    }
+
+    await next();
+
+    afterResponse(c, () => {
+      const usage = (c.get('completion') as CompletionOutcome | undefined)?.usage;
+      if (usage) {
+        tracker.charge(apiKey, usage.total_tokens);
+      }
+    });
+    // Non-streaming responses are charged already and can still take headers
+    if (!(c.res.headers.get('Content-Type') ?? '').includes('text/event-stream')) {
+      c.res.headers.set(QUOTA_REMAINING_HEADER, String(tracker.remaining(apiKey)));
+    }
+  };
+}
@@ -0,0 +1,107 @@
+import { describe, it, expect } from "vitest";
+import { parseRateLimitConfig, RateLimiter } from "./rate-limit.js";
+
+function fakeClock() {
+  const clock = { time: 1000, now: () => clock.time };
+  return clock;
+}
+
+describe("RateLimiter", () => {
+  it("should allow requests up to the limit within a window", () => {
+    const clock = fakeClock();
+    const limiter = new RateLimiter(
+      { endpoints: { "/v1/chat/completions": { requests: 2, windowMs: 1000 } } },
+      clock.now,
+    );
+
+    expect(limiter.check("key", "/v1/chat/completions")).toMatchObject({ allowed: true, remaining: 1 });
+    expect(limiter.check("key", "/v1/chat/completions")).toMatchObject({ allowed: true, remaining: 0 });
+
+    clock.time += 400;
+    expect(limiter.check("key", "/v1/chat/completions")).toEqual({
+      allowed: false,
+      limit: 2,
+      remaining: 0,
+      resetMs: 600,
+    });
+
+    clock.time += 600;
+    expect(limiter.check("key", "/v1/chat/completions")?.allowed).toBe(true);
+  });
+
+  it("should count endpoints and API keys separately", () => {
+    const limiter = new RateLimiter({
+      endpoints: {
+        "/v1/chat/completions": { requests: 1, windowMs: 1000 },
+        "/v1/embeddings": { requests: 1, windowMs: 1000 },
+      },
+    });
+
+    expect(limiter.check("a", "/v1/chat/completions")?.allowed).toBe(true);
+    expect(limiter.check("a", "/v1/chat/completions")?.allowed).toBe(false);
+    expect(limiter.check("a", "/v1/embeddings")?.allowed).toBe(true);
+    expect(limiter.check("b", "/v1/chat/completions")?.allowed).toBe(true);
+  });
+
+  it("should prefer per-key limits and leave unconfigured endpoints unlimited", () => {
+    const limiter = new RateLimiter({
+      endpoints: { "/v1/chat/completions": { requests: 1, windowMs: 1000 } },
+      keys: { vip: { "/v1/chat/completions": { requests: 3, windowMs: 1000 } } },
+    });
+
+    expect(limiter.rule("vip", "/v1/chat/completions")?.requests).toBe(3);
+    expect(limiter.rule("other", "/v1/chat/completions")?.requests).toBe(1);
+    expect(limiter.check("vip", "/v1/models")).toBeUndefined();
+  });
+
+  it("should refuse requests once charged tokens reach the limit", () => {
+    const clock = fakeClock();
+    const limiter = new RateLimiter(
+      { endpoints: { "/v1/chat/completions": { requests: 10, tokens: 100, windowMs: 1000 } } },
+      clock.now,
+    );
+
+    expect(limiter.check("key", "/v1/chat/completions")?.tokens).toEqual({ limit: 100, remaining: 100 });
+    expect(limiter.charge("key", "/v1/chat/completions", 60)?.tokens).toEqual({ limit: 100, remaining: 40 });
+    expect(limiter.check("key", "/v1/chat/completions")?.allowed).toBe(true);
+    expect(limiter.charge("key", "/v1/chat/completions", 60)?.tokens?.remaining).toBe(0);
+    expect(limiter.check("key", "/v1/chat/completions")).toMatchObject({ allowed: false, remaining: 8 });
+
+    clock.time += 1000;
+    expect(limiter.check("key", "/v1/chat/completions")).toMatchObject({
+      allowed: true,
+      tokens: { limit: 100, remaining: 100 },
+    });
+  });
+
+  it("should leave token counts out for rules without a token limit", () => {
+    const limiter = new RateLimiter({ endpoints: { "/v1/chat/completions": { requests: 1, windowMs: 1000 } } });
+
+    expect(limiter.check("key", "/v1/chat/completions")?.tokens).toBeUndefined();
+    expect(limiter.charge("key", "/v1/chat/completions", 1000)?.tokens).toBeUndefined();
+  });
+});
+
+describe("parseRateLimitConfig", () => {
+  it("should accept endpoint and per-key limits", () => {
+    const config = {
+      endpoints: { "/v1/embeddings": { requests: 100, windowMs: 60000 } },
+      keys: { "tt-key": { "/v1/chat/completions": { requests: 5, tokens: 5000, windowMs: 1000 } } },
+    };
+
+    expect(parseRateLimitConfig(config)).toEqual(config);
+  });
+
+  it("should reject malformed limits", () => {
+    expect(() => parseRateLimitConfig([])).toThrow("must be an object");
+    expect(() => parseRateLimitConfig({ limits: {} })).toThrow("Unknown rate limit setting: limits");
+    expect(() => parseRateLimitConfig({ endpoints: { "v1/embeddings": { requests: 1, windowMs: 1 } } })).toThrow(
+      "paths starting with /",
+    );
+    expect(() => parseRateLimitConfig({ endpoints: { "/v1/embeddings": { requests: 1.5, windowMs: 1 } } })).toThrow();
+    expect(() => parseRateLimitConfig({ keys: { k: { "/v1/embeddings": { requests: 1, windowMs: 0 } } } })).toThrow();
+    expect(() =>
+      parseRateLimitConfig({ endpoints: { "/v1/embeddings": { requests: 1, tokens: -1, windowMs: 1 } } }),
+    ).toThrow();
+  });
+});
@@ -0,0 +1,213 @@
+import { Context, Next } from 'hono';
+import { InvalidRequestError, RateLimitError } from '../openai-protocol/errors.js';
+import { bearerToken } from './auth.js';
+import { afterResponse } from './response-end.js';
+import type { CompletionOutcome } from './webhook.js';
+
+export interface RateLimitRule {
+  // Requests allowed per window
+  requests: number;
+  // Prompt plus completion tokens allowed per window, counted once each
+  // response's usage is known; unlimited when unset
+  tokens?: number | undefined;
+  windowMs: number;
+}
+
+// Rules by endpoint path, e.g. '/v1/chat/completions'
+export type EndpointRateLimits = Record<string, RateLimitRule>;
+
+export interface RateLimitConfig {
+  // Limits applying to every API key; endpoints without one are unlimited
+  endpoints?: EndpointRateLimits | undefined;
+  // Per API key overrides of individual endpoint limits
+  keys?: Record<string, EndpointRateLimits> | undefined;
+}
+
+export interface RateLimitDecision {
+  allowed: boolean;
+  limit: number;
+  remaining: number;
+  // Only when the rule limits tokens
+  tokens?: { limit: number; remaining: number } | undefined;
+  // Until the window resets and requests are allowed again
+  resetMs: number;
+}
+
+interface Window {
+  startedAt: number;
+  count: number;
+  tokens: number;
+}
+
+/**
+ * Fixed-window request counts per API key and endpoint, so a key that
+ * exhausts its chat completions allowance can still call other endpoints.
+ */
+export class RateLimiter {
+  private windows = new Map<string, Window>();
+
+  constructor(
+    private config: RateLimitConfig,
+    private now: () => number = Date.now
+  ) {}
+
+  // The rule for a key on an endpoint; per-key overrides win
+  rule(apiKey: string, endpoint: string): RateLimitRule | undefined {
+    return this.config.keys?.[apiKey]?.[endpoint] ?? this.config.endpoints?.[endpoint];
+  }
+
+  // Counts a request, or returns undefined when the endpoint is unlimited
+  check(apiKey: string, endpoint: string): RateLimitDecision | undefined {
+    const rule = this.rule(apiKey, endpoint);
+    if (!rule) {
+      return undefined;
+    }
+
+    const now = this.now();
+    const window = this.window(apiKey, endpoint, rule, now);
+    const allowed = window.count < rule.requests && (rule.tokens === undefined || window.tokens < rule.tokens);
+    if (allowed) {
+      window.count++;
+    }
+    return this.decision(allowed, rule, window, now);
+  }
+
+  // Counts tokens used by an allowed request against its window, returning
+  // the decision as it stands afterwards
+  charge(apiKey: string, endpoint: string, tokens: number): RateLimitDecision | undefined {
+    const rule = this.rule(apiKey, endpoint);
+    if (!rule) {
+      return undefined;
+    }
+
+    const now = this.now();
+    const window = this.window(apiKey, endpoint, rule, now);
+    window.tokens += tokens;
+    return this.decision(true, rule, window, now);
+  }
+
+  private window(apiKey: string, endpoint: string, rule: RateLimitRule, now: number): Window {
+    const id = `${endpoint} ${apiKey}`;
+    let window = this.windows.get(id);
+    if (!window || now - window.startedAt >= rule.windowMs) {
+      window = { startedAt: now, count: 0, tokens: 0 };
+      this.windows.set(id, window);
+    }
+    return window;
+  }
+
+  private decision(allowed: boolean, rule: RateLimitRule, window: Window, now: number): RateLimitDecision {
+    const decision: RateLimitDecision = {
+      allowed,
+      limit: rule.requests,
+      remaining: rule.requests - window.count,
+      resetMs: window.startedAt + rule.windowMs - now,
+    };
+    if (rule.tokens !== undefined) {
+      decision.tokens = { limit: rule.tokens, remaining: Math.max(rule.tokens - window.tokens, 0) };
+    }
+    return decision;
+  }
+}
+
+// Validates limits from the config file
+export function parseRateLimitConfig(value: unknown): RateLimitConfig {
+  if (!isObject(value)) {
+    throw new InvalidRequestError('Rate limits must be an object');
+  }
+  const { endpoints, keys, ...rest } = value;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown rate limit setting: ${unknownKey}`, unknownKey);
+  }
+
+  if (keys !== undefined && !isObject(keys)) {
+    throw new InvalidRequestError('keys must map API keys to endpoint limits', 'keys');
+  }
+
+  return {
+    endpoints: endpoints === undefined ? undefined : parseEndpointRateLimits(endpoints, 'endpoints'),
+    keys:
+      keys === undefined
+        ? undefined
+        : Object.fromEntries(Object.entries(keys).map(([key, limits]) => [key, parseEndpointRateLimits(limits, 'keys')])),
+  };
+}
+
+function parseEndpointRateLimits(value: unknown, param: string): EndpointRateLimits {
+  if (!isObject(value)) {
+    throw new InvalidRequestError(`${param} must map paths to limits`, param);
+  }
+  for (const [endpoint, rule] of Object.entries(value)) {
+    if (
+      !endpoint.startsWith('/') ||
+      !isObject(rule) ||
+      !Number.isInteger(rule.requests) ||
+      (rule.requests as number) < 0 ||
+      typeof rule.windowMs !== 'number' ||
+      !(rule.windowMs > 0) ||
+      (rule.tokens !== undefined && !(Number.isInteger(rule.tokens) && (rule.tokens as number) >= 0))
+    ) {
+      throw new InvalidRequestError(
+        `${param} must map paths starting with / to {requests, tokens?, windowMs}; got ${endpoint}: ${JSON.stringify(rule)}`,
+        param
+      );
+    }
+  }
+  return value as EndpointRateLimits;
+}
+
+function isObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
+
+/**
+ * Throttles authenticated requests by API key and path. Limited responses
+ * carry OpenAI's x-ratelimit-* headers, the -tokens ones only for rules
+ * limiting tokens; rejected ones are 429s with a Retry-After in seconds.
+ * Token usage is counted once a response's usage is known, so a stream may
+ * run over the limit; the next request is then refused.
+ */
+export function createRateLimitMiddleware(limiter: RateLimiter) {
+  return async (c: Context, next: Next) => {
+    const apiKey = bearerToken(c.req.header('Authorization')) ?? '';
+    const decision = limiter.check(apiKey, c.req.path);
+    if (!decision) {
+      await next();
+      return;
+    }
+
+    const reset = `${Math.ceil(decision.resetMs / 1000)}s`;
+    c.header('x-ratelimit-limit-requests', String(decision.limit));
+    c.header('x-ratelimit-remaining-requests', String(decision.remaining));
+    c.header('x-ratelimit-reset-requests', reset);
+    if (decision.tokens) {
+      c.header('x-ratelimit-limit-tokens', String(decision.tokens.limit));
+      c.header('x-ratelimit-remaining-tokens', String(decision.tokens.remaining));
+      c.header('x-ratelimit-reset-tokens', reset);
+    }
+    if (!decision.allowed) {
+      throw new RateLimitError(Math.max(Math.ceil(decision.resetMs / 1000), 1));
+    }
+
+    await next();
+
+    if (!decision.tokens) {
+      return;
+    }
+    const charge = () => {
+      const usage = (c.get('completion') as CompletionOutcome | undefined)?.usage;
+      return usage ? limiter.charge(apiKey, c.req.path, usage.total_tokens) : undefined;
+    };
+    if ((c.res.headers.get('Content-Type') ?? '').includes('text/event-stream')) {
+      afterResponse(c, () => void charge());
+      return;
+    }
+    // Non-streaming responses can still take the updated count
+    const tokens = charge()?.tokens;
+    if (tokens) {
+      c.res.headers.set('x-ratelimit-remaining-tokens', String(tokens.remaining));
+    }
+  };
+}
@@ -0,0 +1,97 @@
+import { Context, Next } from 'hono';
+import { maskAPIKey } from '../utils/audit-log.js';
+import { BodyCapture, RequestHistory } from '../utils/request-history.js';
+import { bearerToken } from './auth.js';
+import { afterResponse } from './response-end.js';
+import type { CompletionOutcome } from './webhook.js';
+
+/**
+ * Records each request, with its response, in the history once the
+ * response has been sent. Only the start of each body is read into the
+ * history: the request's is read up to the cap before the handler runs, and
+ * the response's as it goes out, so streams are recorded when they end.
+ */
+export function createRequestHistoryMiddleware(history: RequestHistory) {
+  return async (c: Context, next: Next) => {
+    const start = Date.now();
+    const timestamp = new Date().toISOString();
+    const request = await captureBody(c.req.raw.clone());
+
+    await next();
+
+    const response = new BodyCapture();
+    const streaming = (c.res.headers.get('Content-Type') ?? '').includes('text/event-stream');
+    if (streaming && c.res.body) {
+      c.res = new Response(
+        c.res.body.pipeThrough(
+          new TransformStream<Uint8Array, Uint8Array>({
+            transform(chunk, controller) {
+              response.add(chunk);
+              controller.enqueue(chunk);
+            },
+          })
+        ),
+        c.res
+      );
+    } else if (c.res.body) {
+      await captureBody(c.res.clone(), response);
+    }
+
+    afterResponse(c, () => {
+      const completion = c.get('completion') as CompletionOutcome | undefined;
+      const usage = completion?.usage;
+      const requestBody = request.finish(c.req.raw.headers, declaredLength(c.req.raw.headers));
+      history.record({
+        id: c.get('requestId') as string,
+        timestamp,
+        key_label: maskAPIKey(bearerToken(c.req.header('Authorization')) ?? ''),
+        method: c.req.method,
+        path: c.req.path,
+        model: completion?.model ?? requestedModel(requestBody.body),
+        status: c.res.status,
+        streaming,
+        prompt_tokens: usage?.prompt_tokens ?? 0,
+        completion_tokens: usage?.completion_tokens ?? 0,
+        total_tokens: usage?.total_tokens ?? 0,
+        duration_ms: Date.now() - start,
+        request: requestBody,
+        response: response.finish(c.res.headers),
+      });
+    });
+  };
+}
+
+// Reads a body until it's done or past the capture's cap
+async function captureBody(message: Request | Response, capture = new BodyCapture()): Promise<BodyCapture> {
+  const reader = message.body?.getReader();
+  if (!reader) {
+    return capture;
+  }
+  try {
+    while (!capture.full) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      capture.add(value);
+    }
+  } catch {
+    // A body the client abandoned is kept as far as it got
+  } finally {
+    reader.cancel().catch(() => {});
+  }
+  return capture;
+}
+
+function declaredLength(headers: Headers): number | undefined {
+  const length = Number(headers.get('Content-Length') ?? undefined);
+  return Number.isSafeInteger(length) ? length : undefined;
+}
+
+// The model a JSON body names, for requests rejected before one was chosen
+function requestedModel(body: string): string | null {
+  try {
+    const model = (JSON.parse(body) as { model?: unknown } | null)?.model;
+    return typeof model === 'string' ? model : null;
+  } catch {
+    return null;
+  }
+}
@@ -0,0 +1,47 @@
+import { Context } from 'hono';
+
+/**
+ * Calls onEnd once the response has been sent. Event streams are wrapped so
+ * onEnd waits until the stream ends or the client goes away, rather than
+ * firing as soon as the headers are ready.
+ */
+export function afterResponse(c: Context, onEnd: () => void): void {
+  const body = c.res.body;
+  if (!body || !(c.res.headers.get('Content-Type') ?? '').includes('text/event-stream')) {
+    onEnd();
+    return;
+  }
+
+  let finished = false;
+  const finish = () => {
+    if (!finished) {
+      finished = true;
+      onEnd();
+    }
+  };
+
+  const reader = body.getReader();
+  c.res = new Response(
+    new ReadableStream({
+      async pull(controller) {
+        try {
+          const { done, value } = await reader.read();
+          if (done) {
+            finish();
+            controller.close();
+          } else {
+            controller.enqueue(value);
+          }
+        } catch (error) {
+          finish();
+          controller.error(error);
+        }
+      },
+      cancel(reason) {
+        finish();
+        return reader.cancel(reason);
+      },
+    }),
+    c.res
+  );
+}
@@ -0,0 +1,30 @@
+import { Context, Next } from 'hono';
+import { ShadowMirror } from '../utils/shadow.js';
+import { afterResponse } from './response-end.js';
+import type { CompletionOutcome } from './webhook.js';
+
+/**
+ * Hands each chat completion to the shadow mirror once its response has
+ * been sent. Requests rejected before a model was chosen aren't mirrored.
+ */
+export function createShadowMiddleware(mirror: ShadowMirror) {
+  return async (c: Context, next: Next) => {
+    const start = performance.now();
+
+    await next();
+
+    afterResponse(c, () => {
+      const completion = c.get('completion') as CompletionOutcome | undefined;
+      if (!completion) {
+        return;
+      }
+      mirror.mirror({
+        requestId: c.get('requestId') as string,
+        request: completion.request,
+        status: c.res.status,
+        latencyMs: performance.now() - start,
+        usage: completion.usage,
+      });
+    });
+  };
+}
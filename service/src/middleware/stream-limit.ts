@@ -0,0 +1,49 @@
+import { Context, Next } from 'hono';
+import { RateLimitError } from '../openai-protocol/errors.js';
+import { bearerToken } from './auth.js';
+import { ConcurrencyLimiter } from './ip-limit.js';
+import { afterResponse } from './response-end.js';
+import { peekJsonBody } from './json-body.js';
+
+// Whether a chat completion body asks to stream. Bodies that can't be read
+// don't count; the handler rejects them itself.
+function wantsStream(c: Context): boolean {
+  const body = peekJsonBody(c);
+  return typeof body === 'object' && body !== null && (body as Record<string, unknown>).stream === true;
+}
+
+/**
+ * Rejects a streamed chat completion with a 429 while its API key already
+ * holds the configured number of open streams, simulating per-key streaming
+ * quotas. A stream holds its slot until it ends or the client goes away;
+ * non-streaming requests are never counted.
+ */
+export function createStreamLimitMiddleware(limiter: ConcurrencyLimiter) {
+  return async (c: Context, next: Next) => {
+    if (!wantsStream(c)) {
+      return next();
+    }
+
+    const key = bearerToken(c.req.header('Authorization')) ?? '';
+    if (!limiter.tryAcquire(key)) {
+      throw new RateLimitError(1, 'Too many concurrent streams for this API key, please retry later');
+    }
+
+    let released = false;
+    const release = () => {
+      if (!released) {
+        released = true;
+        limiter.release(key);
+      }
+    };
+
+    try {
+      await next();
+    } catch (error) {
+      release();
+      throw error;
+    }
+
+    afterResponse(c, release);
+  };
+}
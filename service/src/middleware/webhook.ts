@@ -0,0 +1,61 @@
+import { Context, Next } from 'hono';
+import type { ChatCompletionRequest, ChatCompletionUsage } from '../openai-protocol/types.js';
+import { maskAPIKey } from '../utils/audit-log.js';
+import { WebhookNotifier } from '../utils/webhook.js';
+import type { CompletionEvent } from '../utils/webhook.js';
+import { bearerToken } from './auth.js';
+import { requestOrganization } from './organization.js';
+import { afterResponse } from './response-end.js';
+
+// What the chat completions handler learned, shared via the 'completion'
+// context variable; usage is filled in once known
+export interface CompletionOutcome {
+  model: string;
+  // As handed to the model, including any session history
+  request: ChatCompletionRequest;
+  usage?: ChatCompletionUsage | undefined;
+  // Named by X-TeenyTiny-Scenario, when the request ran under one
+  scenario?: string | undefined;
+}
+
+/**
+ * Notifies the webhook once each response has been sent, errors included.
+ * Streaming responses are reported when the stream ends.
+ */
+export function createWebhookMiddleware(notifier: WebhookNotifier) {
+  return async (c: Context, next: Next) => {
+    const start = Date.now();
+
+    await next();
+
+    afterResponse(c, () => {
+      const completion = c.get('completion') as CompletionOutcome | undefined;
+      const usage = completion?.usage;
+      const event: CompletionEvent = {
+        event: 'chat.completion',
+        request_id: c.get('requestId') as string,
+        key_label: maskAPIKey(bearerToken(c.req.header('Authorization')) ?? ''),
+        model: completion?.model ?? null,
+        streaming: (c.res.headers.get('Content-Type') ?? '').includes('text/event-stream'),
+        status: c.res.status,
+        prompt_tokens: usage?.prompt_tokens ?? 0,
+        completion_tokens: usage?.completion_tokens ?? 0,
+        total_tokens: usage?.total_tokens ?? 0,
+        duration_ms: Date.now() - start,
+        timestamp: new Date().toISOString(),
+      };
+
+      const { organization, project } = requestOrganization(c);
+      if (organization !== undefined) {
+        event.organization = organization;
+      }
+      if (project !== undefined) {
+        event.project = project;
+      }
+      if (completion?.scenario !== undefined) {
+        event.scenario = completion.scenario;
+      }
+      notifier.notify(event);
+    });
+  };
+}
@@ -0,0 +1,61 @@
+import { describe, it, expect } from "vitest";
+import { AcronymModel, toAcronym } from "./acronym-model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+describe("AcronymModel", () => {
+  it("should reply with the initials as a single chunk", async () => {
+    const model = new AcronymModel();
+
+    const chunks = await getChunks(model, "as far as I know");
+
+    expect(chunks).toEqual(["AFAIK"]);
+  });
+
+  it("should return default message for empty input", async () => {
+    const model = new AcronymModel();
+
+    const response = await getResponse(model, "");
+
+    expect(response).toContain("I'm the Acronym model");
+  });
+
+  it("should return default message when there are no words", async () => {
+    const model = new AcronymModel();
+
+    const response = await getResponse(model, " ... !!! ");
+
+    expect(response).toContain("I'm the Acronym model");
+  });
+});
+
+describe("toAcronym", () => {
+  it("should ignore punctuation and repeated spaces", () => {
+    expect(toAcronym("  Hello,   world!  (really) ")).toBe("HWR");
+  });
+
+  it("should treat each part of a hyphenated word as a word", () => {
+    expect(toAcronym("state-of-the-art")).toBe("SOTA");
+  });
+
+  it("should split on emoji", () => {
+    expect(toAcronym("rolling🙂on🎉the🔥floor")).toBe("ROTF");
+  });
+
+  it("should split on unicode whitespace", () => {
+    expect(toAcronym("no big　deal\tthanks")).toBe("NBDT");
+  });
+
+  it("should keep apostrophes inside words", () => {
+    expect(toAcronym("don't ask")).toBe("DA");
+  });
+
+  it("should upper-case non-latin initials with their combining marks", () => {
+    expect(toAcronym("élan vital")).toBe("ÉV");
+    expect(toAcronym("e\u0301lan vital")).toBe("E\u0301V"); // decomposed
+    expect(toAcronym("über große straße")).toBe("ÜGS");
+  });
+
+  it("should include leading digits", () => {
+    expect(toAcronym("24 hour party people")).toBe("2HPP");
+  });
+});
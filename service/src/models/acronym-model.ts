@@ -0,0 +1,28 @@
+import { Model } from './model.js';
+
+// A word starts with a letter or digit and runs until anything that isn't a
+// letter, digit, combining mark or apostrophe, so hyphens, punctuation, any
+// kind of whitespace and emoji all separate words while "don't" stays whole.
+const WORD = /[\p{L}\p{N}]\p{M}*[\p{L}\p{N}\p{M}'’]*/gu;
+const INITIAL = /^[\p{L}\p{N}]\p{M}*/u;
+
+/**
+ * Acronym - Deterministic word-boundary transformation
+ *
+ * Replies with the upper-cased first letter of each word in the latest user
+ * message ("as far as I know" → "AFAIK"). Hyphenated words contribute one
+ * letter per part ("state-of-the-art" → "SOTA").
+ */
+export class AcronymModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    const acronym = toAcronym(input);
+    yield acronym || "Hello! I'm the Acronym model. Send me a phrase and I'll reply with its initials.";
+  }
+}
+
+export function toAcronym(text: string): string {
+  return (text.match(WORD) ?? [])
+    .map((word) => word.match(INITIAL)?.[0] ?? '')
+    .join('')
+    .toUpperCase();
+}
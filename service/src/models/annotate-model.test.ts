@@ -0,0 +1,69 @@
+import { describe, it, expect } from "vitest";
+import { AnnotateModel, citeSentences, DEFAULT_CITATION_SOURCES } from "./annotate-model.js";
+import { createModelContext } from "./model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+const sources = [
+  { url: "https://example.com/a", title: "A" },
+  { url: "https://example.com/b", title: "B" },
+];
+
+describe("AnnotateModel", () => {
+  it("should echo the message a word at a time", async () => {
+    const chunks = await getChunks(new AnnotateModel(), "  One. Two three.  ");
+
+    expect(chunks).toEqual(["One. ", "Two ", "three."]);
+  });
+
+  it("should cite one source per sentence, cycling through the sources", async () => {
+    const context = createModelContext();
+
+    await getResponse(new AnnotateModel({ sources }), "First one. Second? Third!", context);
+
+    expect(context.citations).toEqual([
+      { url: "https://example.com/a", title: "A", startIndex: 0, endIndex: 10 },
+      { url: "https://example.com/b", title: "B", startIndex: 11, endIndex: 18 },
+      { url: "https://example.com/a", title: "A", startIndex: 19, endIndex: 25 },
+    ]);
+  });
+
+  it("should use the default sources when none are configured", async () => {
+    const context = createModelContext();
+
+    await getResponse(new AnnotateModel(), "Hello.", context);
+
+    expect(context.citations?.[0]).toMatchObject(DEFAULT_CITATION_SOURCES[0]!);
+  });
+
+  it("should cite its greeting for empty input", async () => {
+    const context = createModelContext();
+
+    const response = await getResponse(new AnnotateModel(), "", context);
+
+    expect(response).toMatch(/^Hello! I'm the Annotate model\./);
+    expect(context.citations!.length).toBeGreaterThan(0);
+  });
+});
+
+describe("citeSentences", () => {
+  it("should count indices in code points", () => {
+    const text = "Wave 👋 hello. Bye.";
+    const codePoints = Array.from(text);
+
+    const spans = citeSentences(text, sources).map((citation) =>
+      codePoints.slice(citation.startIndex, citation.endIndex).join(""),
+    );
+
+    expect(spans).toEqual(["Wave 👋 hello.", "Bye."]);
+  });
+
+  it("should treat text without punctuation as one sentence", () => {
+    expect(citeSentences("no full stop", sources)).toEqual([
+      { ...sources[0], startIndex: 0, endIndex: 12 },
+    ]);
+  });
+
+  it("should cite nothing without sources", () => {
+    expect(citeSentences("Hello.", [])).toEqual([]);
+  });
+});
@@ -0,0 +1,67 @@
+import { Model, ModelCitation, ModelContext } from './model.js';
+
+export interface CitationSource {
+  url: string;
+  title: string;
+}
+
+export interface AnnotateOptions {
+  // Sources cited in turn, one per sentence
+  sources?: CitationSource[] | undefined;
+}
+
+export const DEFAULT_CITATION_SOURCES: CitationSource[] = [
+  { url: 'https://teenytiny.ai/', title: 'TeenyTiny AI' },
+  { url: 'https://platform.openai.com/docs/api-reference/chat', title: 'Chat Completions API reference' },
+];
+
+// A sentence runs from its first non-space character to its closing punctuation
+const SENTENCE = /\S[^.!?]*[.!?]*/gu;
+
+/**
+ * Annotate - Echoes with url_citation annotations, like a web-search model
+ *
+ * Echoes the message back a word at a time and cites one source per
+ * sentence, cycling through the configured sources. The adapter sends the
+ * citations as `message.annotations`, or as an annotations delta after the
+ * content when streaming. Indices count code points of the echoed content.
+ */
+export class AnnotateModel implements Model {
+  private sources: CitationSource[];
+
+  constructor(options: AnnotateOptions = {}) {
+    this.sources = options.sources ?? DEFAULT_CITATION_SOURCES;
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const text = input.trim() || "Hello! I'm the Annotate model. Send me a few sentences and I'll cite a source for each.";
+
+    if (context) {
+      context.citations = citeSentences(text, this.sources);
+    }
+
+    for (const word of text.split(/(?<= )/)) {
+      yield word;
+    }
+  }
+}
+
+export function citeSentences(text: string, sources: CitationSource[]): ModelCitation[] {
+  if (sources.length === 0) {
+    return [];
+  }
+
+  return Array.from(text.matchAll(SENTENCE), (match, n) => {
+    const source = sources[n % sources.length]!;
+    const startIndex = codePointLength(text.slice(0, match.index ?? 0));
+    return {
+      ...source,
+      startIndex,
+      endIndex: startIndex + codePointLength(match[0]),
+    };
+  });
+}
+
+function codePointLength(text: string): number {
+  return Array.from(text).length;
+}
@@ -0,0 +1,30 @@
+import { describe, it, expect } from "vitest";
+import { parseCannedModels } from "./canned-models.js";
+
+describe("parseCannedModels", () => {
+  it("should accept a saved /v1/models response", () => {
+    const models = parseCannedModels({
+      object: "list",
+      data: [
+        { id: "gpt-4", object: "model", created: 1687882411, owned_by: "openai", capabilities: ["chat", "chat"] },
+      ],
+    });
+
+    expect(models).toEqual([{ id: "gpt-4", object: "model", owned_by: "openai", capabilities: ["chat"] }]);
+  });
+
+  it("should default owned_by and capabilities in a bare list", () => {
+    expect(parseCannedModels([{ id: "gpt-4o" }])).toEqual([
+      { id: "gpt-4o", object: "model", owned_by: "teenytiny-ai", capabilities: ["chat"] },
+    ]);
+  });
+
+  it("should reject malformed entries", () => {
+    expect(() => parseCannedModels({ models: [] })).toThrow("list of models");
+    expect(() => parseCannedModels([{ id: "" }])).toThrow("data[0].id");
+    expect(() => parseCannedModels([{ id: "a" }, { id: "a" }])).toThrow("listed twice");
+    expect(() => parseCannedModels([{ id: "a", object: "engine" }])).toThrow('must be "model"');
+    expect(() => parseCannedModels([{ id: "a", capabilities: ["images"] }])).toThrow("capabilities");
+    expect(() => parseCannedModels([{ id: "a", root: "a" }])).toThrow("Unknown canned model setting: root");
+  });
+});
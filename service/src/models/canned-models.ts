@@ -0,0 +1,75 @@
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+
+// What a canned model answers: chat completions are served by echo,
+// embeddings by the embedding model's hash vectors
+export type CannedCapability = 'chat' | 'embeddings';
+
+// A catalog entry standing in for a real provider's model, e.g. gpt-4, so
+// clients and fixtures written against its ids work unchanged
+export interface CannedModel {
+  id: string;
+  object: 'model';
+  owned_by: string;
+  capabilities: CannedCapability[];
+}
+
+const CAPABILITIES: readonly CannedCapability[] = ['chat', 'embeddings'];
+
+// Fields of a saved /v1/models response that the server sets itself
+const IGNORED_FIELDS = ['created', 'system_fingerprint', 'status'];
+
+/**
+ * Validates the entries of a --canned-models file: either a list of models
+ * or a saved /v1/models response, whose entries are under data. owned_by
+ * defaults to teenytiny-ai and capabilities to ["chat"].
+ */
+export function parseCannedModels(value: unknown): CannedModel[] {
+  const entries = isObject(value) ? value.data : value;
+  if (!Array.isArray(entries)) {
+    throw new InvalidRequestError('Canned models must be a list of models or an object with a data list');
+  }
+
+  const ids = new Set<string>();
+  return entries.map((entry: unknown, index) => {
+    const param = `data[${index}]`;
+    if (!isObject(entry)) {
+      throw new InvalidRequestError(`${param} must be an object`, param);
+    }
+    const { id, object = 'model', owned_by = 'teenytiny-ai', capabilities = ['chat'], ...rest } = entry;
+
+    const unknownKey = Object.keys(rest).find((key) => !IGNORED_FIELDS.includes(key));
+    if (unknownKey !== undefined) {
+      throw new InvalidRequestError(`Unknown canned model setting: ${unknownKey}`, `${param}.${unknownKey}`);
+    }
+
+    if (typeof id !== 'string' || id === '') {
+      throw new InvalidRequestError(`${param}.id must be a non-empty string`, `${param}.id`);
+    }
+    if (ids.has(id)) {
+      throw new InvalidRequestError(`Canned model ${id} is listed twice`, `${param}.id`);
+    }
+    ids.add(id);
+    if (object !== 'model') {
+      throw new InvalidRequestError(`${param}.object must be "model"`, `${param}.object`);
+    }
+    if (typeof owned_by !== 'string' || owned_by === '') {
+      throw new InvalidRequestError(`${param}.owned_by must be a non-empty string`, `${param}.owned_by`);
+    }
+    if (
+      !Array.isArray(capabilities) ||
+      capabilities.length === 0 ||
+      !capabilities.every((capability) => CAPABILITIES.includes(capability))
+    ) {
+      throw new InvalidRequestError(
+        `${param}.capabilities must be a non-empty list of ${CAPABILITIES.map((c) => `"${c}"`).join(' and ')}`,
+        `${param}.capabilities`
+      );
+    }
+
+    return { id, object: 'model', owned_by, capabilities: [...new Set(capabilities as CannedCapability[])] };
+  });
+}
+
+function isObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
@@ -0,0 +1,55 @@
+import { describe, it, expect } from "vitest";
+import { ChunkyModel, splitChunks } from "./chunky-model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+describe("ChunkyModel", () => {
+  it("should stream exactly the scripted chunks", async () => {
+    const model = new ChunkyModel();
+
+    const chunks = await getChunks(model, "Hel|lo wo|rld");
+
+    expect(chunks).toEqual(["Hel", "lo wo", "rld"]);
+  });
+
+  it("should join the chunks for a whole response", async () => {
+    const model = new ChunkyModel();
+
+    const response = await getResponse(model, "Hel|lo wo|rld");
+
+    expect(response).toBe("Hello world");
+  });
+
+  it("should return default message for empty input", async () => {
+    const model = new ChunkyModel();
+
+    const response = await getResponse(model, "");
+
+    expect(response).toContain("I'm the Chunky model");
+  });
+});
+
+describe("splitChunks", () => {
+  it("should return the whole text when there are no delimiters", () => {
+    expect(splitChunks("no pipes here")).toEqual(["no pipes here"]);
+  });
+
+  it("should treat an escaped pipe as a literal", () => {
+    expect(splitChunks("a\\|b|c")).toEqual(["a|b", "c"]);
+  });
+
+  it("should treat an escaped backslash as a literal", () => {
+    expect(splitChunks("a\\\\|b")).toEqual(["a\\", "b"]);
+  });
+
+  it("should keep other backslashes as-is", () => {
+    expect(splitChunks("C:\\temp|\\n")).toEqual(["C:\\temp", "\\n"]);
+  });
+
+  it("should keep empty chunks, including leading and trailing ones", () => {
+    expect(splitChunks("|a||b|")).toEqual(["", "a", "", "b", ""]);
+  });
+
+  it("should split inside grapheme clusters and markdown tokens", () => {
+    expect(splitChunks("e|\u0301|*|*bold*|*")).toEqual(["e", "\u0301", "*", "*bold*", "*"]);
+  });
+});
@@ -0,0 +1,53 @@
+import { Model } from './model.js';
+
+/**
+ * Chunky - Scripted chunk boundaries for debugging stream reassembly
+ *
+ * The user message is split on `|` and each piece is streamed as its own
+ * chunk, so "Hel|lo wo|rld" arrives as exactly "Hel", "lo wo" and "rld".
+ * Non-streaming requests get the pieces joined back together.
+ *
+ * Escaping rules:
+ * - `\|` is a literal pipe and does not split
+ * - `\\` is a literal backslash (so `\\|` is a backslash followed by a split)
+ * - any other backslash is kept as-is
+ *
+ * Empty pieces ("a||b") are kept, producing an empty delta. Splitting happens
+ * on UTF-16 text, not graphemes, so a `|` between a base letter and its
+ * combining mark (or inside a markdown token) splits exactly there.
+ */
+export class ChunkyModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    if (!input) {
+      yield "Hello! I'm the Chunky model. Separate chunks with '|' (escape a literal pipe as '\\|') and I'll stream them exactly.";
+      return;
+    }
+
+    for (const chunk of splitChunks(input)) {
+      yield chunk;
+    }
+  }
+}
+
+export function splitChunks(script: string): string[] {
+  const chunks: string[] = [];
+  let current = '';
+
+  for (let i = 0; i < script.length; i++) {
+    const char = script.charAt(i);
+    const next = script.charAt(i + 1);
+
+    if (char === '\\' && (next === '|' || next === '\\')) {
+      current += next;
+      i++;
+    } else if (char === '|') {
+      chunks.push(current);
+      current = '';
+    } else {
+      current += char;
+    }
+  }
+
+  chunks.push(current);
+  return chunks;
+}
@@ -0,0 +1,92 @@
+import { describe, it, expect } from "vitest";
+import { CountdownModel, parseCountdownOptions } from "./countdown-model.js";
+import { createModelContext } from "./model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+describe("CountdownModel", () => {
+  it("should stream one number per chunk down to Done!", async () => {
+    const model = new CountdownModel({ delayMs: 0 });
+
+    const chunks = await getChunks(model, "Count down from 3 please");
+
+    expect(chunks).toEqual(["3... ", "2... ", "1... ", "Done!"]);
+  });
+
+  it("should default to 10 when the message has no number", async () => {
+    const model = new CountdownModel({ delayMs: 0 });
+
+    const response = await getResponse(model, "Go!");
+
+    expect(response).toBe("10... 9... 8... 7... 6... 5... 4... 3... 2... 1... Done!");
+  });
+
+  it("should clamp the count to the configured maximum", async () => {
+    const model = new CountdownModel({ delayMs: 0, maxCount: 2 });
+
+    const chunks = await getChunks(model, "1000");
+
+    expect(chunks).toEqual(["2... ", "1... ", "Done!"]);
+  });
+
+  it("should report the numbers emitted as completion tokens", async () => {
+    const model = new CountdownModel({ delayMs: 0 });
+    const context = createModelContext();
+
+    await getResponse(model, "4", context);
+
+    expect(context.completionTokens).toBe(4);
+  });
+
+  it("should carry on a prefilled countdown from its last number", async () => {
+    const model = new CountdownModel({ delayMs: 0 });
+    const context = createModelContext();
+    context.prefill = "5... 4...";
+
+    const chunks = await getChunks(model, "5", context);
+
+    expect(chunks).toEqual([" 3... ", "2... ", "1... ", "Done!"]);
+  });
+
+  it("should only finish a prefill that already reached 1", async () => {
+    const model = new CountdownModel({ delayMs: 0 });
+    const context = createModelContext();
+    context.prefill = "2... 1... ";
+
+    expect(await getChunks(model, "2", context)).toEqual(["Done!"]);
+  });
+
+  it("should stop straight away once the signal aborts", async () => {
+    const model = new CountdownModel({ delayMs: 10_000 });
+    const abort = new AbortController();
+    const context = createModelContext();
+    context.signal = abort.signal;
+
+    const start = Date.now();
+    const chunks: string[] = [];
+    for await (const chunk of model.process("5", context)) {
+      chunks.push(chunk);
+      abort.abort();
+    }
+
+    expect(chunks).toEqual(["5... "]);
+    expect(context.completionTokens).toBe(1);
+    expect(Date.now() - start).toBeLessThan(1000);
+  });
+});
+
+describe("parseCountdownOptions", () => {
+  it("should accept any subset of the options", () => {
+    expect(parseCountdownOptions({ delayMs: 0, maxCount: 3 })).toEqual({ delayMs: 0, maxCount: 3 });
+    expect(parseCountdownOptions({})).toEqual({});
+  });
+
+  it.each([
+    [[], undefined],
+    [{ delayMs: -1 }, "delayMs"],
+    [{ maxCount: 0 }, "maxCount"],
+    [{ defaultCount: "3" }, "defaultCount"],
+    [{ speed: 2 }, "speed"],
+  ])("should reject %j", (options, param) => {
+    expect(() => parseCountdownOptions(options)).toThrow(expect.objectContaining({ param }));
+  });
+});
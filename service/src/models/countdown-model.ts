@@ -0,0 +1,106 @@
+import { Model, ModelContext } from './model.js';
+import { sleep } from '../utils/sleep.js';
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+
+export interface CountdownOptions {
+  // Count used when the message contains no number
+  defaultCount?: number | undefined;
+  // Larger requested counts are clamped to this
+  maxCount?: number | undefined;
+  // Pause between chunks
+  delayMs?: number | undefined;
+}
+
+/**
+ * Countdown - Predictable multi-chunk streaming for progress-style UIs
+ *
+ * Takes the first integer in the user message as N and streams
+ * "N... N-1... ... 1... Done!", one number per chunk with a short pause
+ * between them. The prompt is otherwise ignored. A prefilled reply such as
+ * "5... 4..." is carried on from the number after its last one. Completion
+ * tokens are reported as the number of numbers emitted, and the countdown
+ * stops as soon as the request's abort signal fires.
+ */
+export class CountdownModel implements Model {
+  private defaultCount: number;
+  private maxCount: number;
+  private delayMs: number;
+
+  constructor(options: CountdownOptions = {}) {
+    this.defaultCount = options.defaultCount ?? 10;
+    this.maxCount = options.maxCount ?? 100;
+    this.delayMs = options.delayMs ?? 200;
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const signal = context?.signal;
+    const prefill = context?.prefill;
+    const count = prefill === undefined ? this.parseCount(input) : this.continuedCount(prefill, input);
+    // A continuation joins the prefill with a space, as echo's does
+    let separator = prefill === undefined || /\s$/.test(prefill) ? '' : ' ';
+    let emitted = 0;
+
+    for (let n = count; n >= 1; n--) {
+      if (signal?.aborted) {
+        return;
+      }
+      yield `${separator}${n}... `;
+      separator = '';
+      emitted++;
+      if (context) {
+        context.completionTokens = emitted;
+      }
+      await sleep(this.delayMs, signal);
+    }
+
+    if (signal?.aborted) {
+      return;
+    }
+    yield `${separator}Done!`;
+  }
+
+  // The number after the prefill's last one, down to 0 when it already
+  // reached 1; a prefill without numbers starts the countdown afresh
+  private continuedCount(prefill: string, input: string): number {
+    const last = prefill.match(/\d+/g)?.at(-1);
+    if (last === undefined) {
+      return this.parseCount(input);
+    }
+    return Math.min(Math.max(parseInt(last, 10) - 1, 0), this.maxCount);
+  }
+
+  private parseCount(input: string): number {
+    const match = input.match(/\d+/);
+    const requested = match ? parseInt(match[0], 10) : this.defaultCount;
+    return Math.min(Math.max(requested, 1), this.maxCount);
+  }
+}
+
+// Validates options sent to /admin/models/countdown/config
+export function parseCountdownOptions(value: unknown): CountdownOptions {
+  if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+    throw new InvalidRequestError('Countdown options must be an object');
+  }
+  const { defaultCount, maxCount, delayMs, ...rest } = value as Record<string, unknown>;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown countdown option: ${unknownKey}`, unknownKey);
+  }
+
+  const options: CountdownOptions = {};
+  for (const [name, option, min] of [
+    ['defaultCount', defaultCount, 1],
+    ['maxCount', maxCount, 1],
+    ['delayMs', delayMs, 0],
+  ] as const) {
+    if (option === undefined) {
+      continue;
+    }
+    if (!Number.isSafeInteger(option) || (option as number) < min) {
+      throw new InvalidRequestError(`${name} must be an integer of at least ${min}`, name);
+    }
+    options[name] = option as number;
+  }
+  return options;
+}
@@ -0,0 +1,55 @@
+import { describe, it, expect } from "vitest";
+import { CsvModel } from "./csv-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+function jsonContext() {
+  const context = createModelContext();
+  context.responseFormat = "json_object";
+  return context;
+}
+
+describe("CsvModel", () => {
+  it("should turn CSV into an object per row", async () => {
+    const response = await getResponse(new CsvModel(), 'name,city\nAda,"London, UK"\nGrace,東京\n');
+
+    expect(JSON.parse(response)).toEqual([
+      { name: "Ada", city: "London, UK" },
+      { name: "Grace", city: "東京" },
+    ]);
+    expect(response).toContain('\n  {\n    "name": "Ada"');
+  });
+
+  it("should wrap rows in an object for a JSON response_format", async () => {
+    expect(await getResponse(new CsvModel(), "name\nAda", jsonContext())).toBe('{"rows":[{"name":"Ada"}]}');
+  });
+
+  it("should turn a JSON array into CSV with columns in first-seen order", async () => {
+    const input = JSON.stringify([
+      { name: "Ada", age: 36 },
+      { city: "Paris, FR", name: "Grace", age: null },
+      { active: true },
+    ]);
+
+    expect(await getResponse(new CsvModel(), input)).toBe(
+      'name,age,city,active\nAda,36,,\nGrace,,"Paris, FR",\n,,,true\n',
+    );
+    expect(await getResponse(new CsvModel(), '[{"a": 1}]', jsonContext())).toBe('{"csv":"a\\n1\\n"}');
+  });
+
+  it("should explain ragged rows and nested values", async () => {
+    expect(await getResponse(new CsvModel(), "a,b\n1,2,3")).toBe(
+      "I couldn't convert that (parse error on line 2: expected 2 fields, got 3).",
+    );
+    expect(await getResponse(new CsvModel(), '[{"a": {"b": 1}}]')).toContain('item 0\'s "a" is not a string');
+    expect(await getResponse(new CsvModel(), "a,a\n1,2")).toContain('column "a" appears twice');
+    expect(JSON.parse(await getResponse(new CsvModel(), "[1]", jsonContext())).error).toContain("not an object");
+  });
+
+  it("should refuse messages over the size cap", async () => {
+    expect(JSON.parse(await getResponse(new CsvModel(5), "a\n1"))).toEqual([{ a: "1" }]);
+    expect(await getResponse(new CsvModel(5), "a,b\n1,2")).toBe(
+      "The message is 7 characters long; I convert at most 5.",
+    );
+  });
+});
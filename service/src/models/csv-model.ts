@@ -0,0 +1,108 @@
+import { Model, ModelContext } from './model.js';
+import { CsvError, formatCsv, parseCsv } from '../utils/csv.js';
+
+// Longest message, in characters, the csv model converts
+export const DEFAULT_CSV_MAX_INPUT_CHARS = 100_000;
+
+// Why a JSON array can't be written as CSV
+class JsonRowsError extends Error {}
+
+/**
+ * CSV - Converts between CSV and JSON, for data-wrangling demos
+ *
+ * CSV in the latest user message comes back as a pretty-printed JSON array
+ * with an object per row, keyed by the header row. A JSON array of flat
+ * objects comes back as CSV, with a column per key in the order keys first
+ * appear. With a JSON response_format the rows are wrapped as {"rows": [...]},
+ * and CSV as {"csv": "..."}. Malformed input, such as a ragged row or an
+ * unclosed quote, gets a reply giving the line rather than an error.
+ */
+export class CsvModel implements Model {
+  constructor(private readonly maxInputChars: number = DEFAULT_CSV_MAX_INPUT_CHARS) {}
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const json = context?.responseFormat === 'json_object' || context?.responseFormat === 'json_schema';
+    const reply = (text: string) => (json ? JSON.stringify({ error: text }) : text);
+
+    if (!input.trim()) {
+      yield reply("Hello! I'm the CSV model. Send me CSV with a header row and I'll turn it into JSON, or a JSON array of objects and I'll turn it into CSV.");
+      return;
+    }
+    const length = [...input].length;
+    if (length > this.maxInputChars) {
+      yield reply(`The message is ${length} characters long; I convert at most ${this.maxInputChars}.`);
+      return;
+    }
+
+    const items = parseJsonArray(input);
+    try {
+      if (items !== undefined) {
+        const csv = formatCsv(toRows(items));
+        yield json ? JSON.stringify({ csv }) : csv;
+      } else {
+        const rows = toObjects(parseCsv(input));
+        yield json ? JSON.stringify({ rows }) : JSON.stringify(rows, null, 2);
+      }
+    } catch (error) {
+      if (!(error instanceof CsvError || error instanceof JsonRowsError)) {
+        throw error;
+      }
+      yield reply(`I couldn't convert that (${error.message}).`);
+    }
+  }
+}
+
+// The message as a JSON array, or undefined if it's anything else
+function parseJsonArray(input: string): unknown[] | undefined {
+  if (!input.trim().startsWith('[')) {
+    return undefined;
+  }
+  try {
+    const value: unknown = JSON.parse(input);
+    return Array.isArray(value) ? value : undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+// Keys the rows by the header; the parser has already checked every row
+// is as wide as the header
+function toObjects(rows: string[][]): Record<string, string>[] {
+  const [header = [], ...records] = rows;
+  const seen = new Set<string>();
+  for (const name of header) {
+    if (seen.has(name)) {
+      throw new CsvError(`column ${JSON.stringify(name)} appears twice in the header row`, 1);
+    }
+    seen.add(name);
+  }
+  return records.map((record) => Object.fromEntries(header.map((name, i) => [name, record[i] ?? ''])));
+}
+
+// A header row of every key, in the order keys first appear, then a row
+// per object; missing and null values are left empty
+function toRows(items: unknown[]): string[][] {
+  const columns: string[] = [];
+  const objects = items.map((item, index) => {
+    if (typeof item !== 'object' || item === null || Array.isArray(item)) {
+      throw new JsonRowsError(`item ${index} of the JSON array is not an object`);
+    }
+    for (const [key, value] of Object.entries(item)) {
+      if (value !== null && typeof value === 'object') {
+        throw new JsonRowsError(`item ${index}'s ${JSON.stringify(key)} is not a string, number, boolean or null`);
+      }
+      if (!columns.includes(key)) {
+        columns.push(key);
+      }
+    }
+    return item as Record<string, unknown>;
+  });
+
+  return [
+    columns,
+    ...objects.map((object) => columns.map((column) => {
+      const value = Object.prototype.hasOwnProperty.call(object, column) ? object[column] : null;
+      return value === null || value === undefined ? '' : String(value);
+    })),
+  ];
+}
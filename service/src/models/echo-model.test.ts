@@ -1,5 +1,6 @@
 import { describe, it, expect } from "vitest";
 import { EchoModel } from "./echo-model.js";
+import { createModelContext } from "./model.js";
 
 describe("EchoModel", () => {
   it("should echo back input text as single chunk", async () => {
@@ -25,4 +26,20 @@ describe("EchoModel", () => {
       "Hello! I'm the Echo model. Send me a message and I'll echo it back.",
     ]);
   });
+
+  it("should continue a prefilled reply without repeating it", async () => {
+    const model = new EchoModel();
+    const continuation = async (prefill: string) => {
+      const context = createModelContext();
+      context.prefill = prefill;
+      const chunks: string[] = [];
+      for await (const chunk of model.process("hello world", context)) {
+        chunks.push(chunk);
+      }
+      return chunks.join("");
+    };
+
+    expect(await continuation("You said:")).toBe(" hello world");
+    expect(await continuation("You said: ")).toBe("hello world");
+  });
 });
\ No newline at end of file
@@ -1,7 +1,14 @@
-import { Model } from './model.js';
+import { Model, ModelContext } from './model.js';
 
 export class EchoModel implements Model {
-  async *process(input: string): AsyncGenerator<string> {
-    yield input || "Hello! I'm the Echo model. Send me a message and I'll echo it back.";
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const reply = input || "Hello! I'm the Echo model. Send me a message and I'll echo it back.";
+    // Continuing a prefilled reply: prefill then the message, sending only
+    // what follows the prefill
+    if (context?.prefill !== undefined) {
+      yield (/\s$/.test(context.prefill) ? '' : ' ') + reply;
+      return;
+    }
+    yield reply;
   }
-}
\ No newline at end of file
+}
@@ -0,0 +1,41 @@
+import { describe, it, expect } from "vitest";
+import { EmbeddingModel, EMBEDDING_DIMENSIONS, embed } from "./embedding-model.js";
+import { getChunks } from "../../tests/test-helpers.js";
+
+describe("EmbeddingModel", () => {
+  it("should reply with the whole vector as a single JSON chunk", async () => {
+    const chunks = await getChunks(new EmbeddingModel(), "hello");
+
+    expect(chunks).toHaveLength(1);
+    expect(JSON.parse(chunks[0]!)).toEqual(embed("hello"));
+  });
+
+  it("should return unit-length vectors of a fixed size", () => {
+    for (const text of ["", "hello", "héllo 👋", "x".repeat(10_000)]) {
+      const vector = embed(text);
+
+      expect(vector).toHaveLength(EMBEDDING_DIMENSIONS);
+      expect(Math.hypot(...vector)).toBeCloseTo(1, 4);
+    }
+  });
+
+  it("should shorten vectors by truncating and renormalizing", () => {
+    const full = embed("hello", 16);
+    const short = embed("hello", 4);
+    const norm = Math.hypot(...full.slice(0, 4));
+
+    expect(short).toHaveLength(4);
+    short.forEach((value, i) => expect(value).toBeCloseTo(full[i]! / norm, 4));
+  });
+
+  it("should use the configured dimension", async () => {
+    const chunks = await getChunks(new EmbeddingModel(3), "hello");
+
+    expect(JSON.parse(chunks[0]!)).toHaveLength(3);
+  });
+
+  it("should be deterministic and distinguish different texts", () => {
+    expect(embed("hello")).toEqual(embed("hello"));
+    expect(embed("hello")).not.toEqual(embed("hello!"));
+  });
+});
@@ -0,0 +1,35 @@
+import { Model } from './model.js';
+import { fnv1a } from '../utils/fnv.js';
+
+// Length of vectors returned unless configured or requested otherwise
+export const EMBEDDING_DIMENSIONS = 8;
+
+// Largest dimension a request may ask for, as for OpenAI's largest model
+export const MAX_EMBEDDING_DIMENSIONS = 3072;
+
+// Most inputs one embeddings request may send, as OpenAI allows
+export const MAX_EMBEDDING_BATCH_SIZE = 2048;
+
+/**
+ * Embedding - Embeddings-style model that returns a vector, not prose
+ *
+ * Replies with a JSON array of numbers (EMBEDDING_DIMENSIONS unless
+ * configured) derived from a hash of the message: the same text always gives
+ * the same unit-length vector. The whole vector is one value, so the model is registered as not
+ * supporting streaming and `stream: true` requests are rejected.
+ */
+export class EmbeddingModel implements Model {
+  constructor(private dimensions: number = EMBEDDING_DIMENSIONS) {}
+
+  async *process(input: string): AsyncGenerator<string> {
+    yield JSON.stringify(embed(input, this.dimensions));
+  }
+}
+
+// Each component is hashed on its own, so a shorter vector is a longer one
+// truncated and renormalized, like OpenAI's reduced-dimension embeddings
+export function embed(text: string, dimensions: number = EMBEDDING_DIMENSIONS): number[] {
+  const raw = Array.from({ length: dimensions }, (_, dimension) => fnv1a(`${dimension}:${text}`) / 0xffffffff - 0.5);
+  const norm = Math.hypot(...raw) || 1;
+  return raw.map((value) => Math.round((value / norm) * 1e6) / 1e6);
+}
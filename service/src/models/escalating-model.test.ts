@@ -0,0 +1,66 @@
+import { describe, it, expect } from "vitest";
+import { EscalatingModel, parseEscalatingScript } from "./escalating-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+const attempt = async (model: EscalatingModel, idempotencyKey?: string) => {
+  const context = createModelContext([{ role: "user", content: "Hi" }]);
+  context.idempotencyKey = idempotencyKey;
+  try {
+    return { reply: await getResponse(model, "Hi", context), headers: context.responseHeaders };
+  } catch (error) {
+    return { status: (error as { statusCode: number }).statusCode };
+  }
+};
+
+describe("EscalatingModel", () => {
+  it("should follow the script, then report the attempts", async () => {
+    const model = new EscalatingModel();
+
+    expect(await attempt(model)).toEqual({ status: 429 });
+    expect(await attempt(model)).toEqual({ status: 429 });
+    expect(await attempt(model)).toEqual({ status: 500 });
+    expect(await attempt(model)).toEqual({
+      reply: "Succeeded on attempt 4, after 429, 429, 500.",
+      headers: { "x-teenytiny-attempts": "4" },
+    });
+
+    // Success starts the count over
+    expect(await attempt(model)).toEqual({ status: 429 });
+  });
+
+  it("should count idempotency keys apart from conversations", async () => {
+    const model = new EscalatingModel([503, "success"]);
+
+    expect(await attempt(model, "key-1")).toEqual({ status: 503 });
+    expect(await attempt(model, "key-2")).toEqual({ status: 503 });
+    expect(await attempt(model)).toEqual({ status: 503 });
+    expect((await attempt(model, "key-1")).reply).toBe("Succeeded on attempt 2, after 503.");
+  });
+
+  it("should reply with JSON for a JSON response_format", async () => {
+    const context = createModelContext([{ role: "user", content: "Hi" }]);
+    context.responseFormat = "json_object";
+
+    const reply = await getResponse(new EscalatingModel(["success"]), "Hi", context);
+
+    expect(JSON.parse(reply)).toEqual({ attempts: 1, failures: [] });
+  });
+});
+
+describe("parseEscalatingScript", () => {
+  it("should parse statuses followed by success", () => {
+    expect(parseEscalatingScript("429, 429,500 ,SUCCESS")).toEqual([429, 429, 500, "success"]);
+    expect(parseEscalatingScript("success")).toEqual(["success"]);
+  });
+
+  it.each([
+    ["", "step 1"],
+    ["429,500", "last step must be success"],
+    ["success,429,success", "success must be the last step"],
+    ["200,success", "step 1 must be a status from 400 to 599"],
+    ["42.9,success", "step 1"],
+  ])("should reject %j", (script, message) => {
+    expect(() => parseEscalatingScript(script)).toThrow(message);
+  });
+});
@@ -0,0 +1,85 @@
+import { createHash } from 'node:crypto';
+import { Model, ModelContext } from './model.js';
+import { statusError } from '../openai-protocol/errors.js';
+import { AttemptTracker } from '../utils/attempt-tracker.js';
+
+// A scripted attempt: an HTTP status to fail with, or success
+export type EscalatingStep = number | 'success';
+
+export const DEFAULT_ESCALATING_SCRIPT: EscalatingStep[] = [429, 429, 500, 'success'];
+
+/**
+ * Parses a script such as "429, 429, 500, success": error statuses from
+ * 400 to 599, then success as the last step only.
+ */
+export function parseEscalatingScript(text: string): EscalatingStep[] {
+  const steps = text.split(',').map((step) => step.trim().toLowerCase());
+  return steps.map((step, i) => {
+    const last = i === steps.length - 1;
+    if (step === 'success') {
+      if (!last) {
+        throw new Error(`success must be the last step, found it at step ${i + 1}`);
+      }
+      return 'success';
+    }
+    const status = Number(step);
+    if (!/^\d+$/.test(step) || status < 400 || status > 599) {
+      throw new Error(`step ${i + 1} must be a status from 400 to 599 or success, got ${JSON.stringify(step)}`);
+    }
+    if (last) {
+      throw new Error('the last step must be success');
+    }
+    return status;
+  });
+}
+
+/**
+ * Escalating - Fails by script until a retry succeeds, for testing backoff
+ *
+ * Counts attempts at each request and answers the nth with the script's nth
+ * step: an error with that status, or, at the end, a reply saying which
+ * attempt succeeded and what failed before it ({"attempts": n, "failures":
+ * [...]} with a JSON response_format), also sent as x-teenytiny-attempts.
+ * Attempts are counted per Idempotency-Key when the request has one, and
+ * otherwise per conversation, so resending the same messages is a retry.
+ * A request's count starts over once it succeeds, once the tracker's TTL
+ * passes without a retry, or when the tracker is reset.
+ */
+export class EscalatingModel implements Model {
+  constructor(
+    private readonly script: EscalatingStep[] = DEFAULT_ESCALATING_SCRIPT,
+    readonly attempts: AttemptTracker = new AttemptTracker()
+  ) {}
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const key = context?.idempotencyKey !== undefined
+      ? `idempotency-key\n${context.idempotencyKey}`
+      : `conversation\n${conversationHash(context?.messages ?? [{ role: 'user', content: input }])}`;
+    const attempt = this.attempts.next(key);
+    const step = this.script[Math.min(attempt, this.script.length) - 1]!;
+    if (step !== 'success') {
+      throw statusError(
+        step,
+        `Attempt ${attempt} failed with ${step} as scripted (${this.script.join(', ')}); retry the same request to go on`,
+        'scripted_failure'
+      );
+    }
+    this.attempts.forget(key);
+
+    const failures = this.script.filter((s): s is number => s !== 'success');
+    if (context) {
+      context.responseHeaders = { 'x-teenytiny-attempts': String(attempt) };
+    }
+    if (context?.responseFormat === 'json_object' || context?.responseFormat === 'json_schema') {
+      yield JSON.stringify({ attempts: attempt, failures });
+      return;
+    }
+    yield failures.length === 0
+      ? `Succeeded on attempt ${attempt}.`
+      : `Succeeded on attempt ${attempt}, after ${failures.join(', ')}.`;
+  }
+}
+
+function conversationHash(messages: ModelContext['messages']): string {
+  return createHash('sha256').update(JSON.stringify(messages)).digest('hex');
+}
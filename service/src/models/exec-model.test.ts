@@ -0,0 +1,128 @@
+import { describe, it, expect, afterEach } from "vitest";
+import { fileURLToPath } from "url";
+import { ExecModel } from "./exec-model.js";
+import { ExecWorkerPool } from "./exec-pool.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+const WORKER = fileURLToPath(new URL("../../tests/testdata/exec-worker.sh", import.meta.url));
+
+// "<pid>: <payload>" from the test worker
+function parseReply(reply: string): { pid: string; payload: string } {
+  const [pid, ...rest] = reply.split(": ");
+  return { pid: pid!, payload: rest.join(": ") };
+}
+
+describe("ExecModel", () => {
+  describe("one-shot mode", () => {
+    it("should stream the command's output for the message on stdin", async () => {
+      const model = new ExecModel({ command: "cat" });
+
+      expect(await getResponse(model, "héllo\nworld")).toBe("héllo\nworld");
+    });
+
+    it("should fail when the command exits non-zero", async () => {
+      const model = new ExecModel({ command: "sh", args: ["-c", "echo broken >&2; exit 3"] });
+
+      await expect(getChunks(model, "hi")).rejects.toThrow("exited with code 3: broken");
+    });
+
+    it("should fail when the command takes too long", async () => {
+      const model = new ExecModel({ command: "sleep", args: ["5"], timeoutMs: 50 });
+
+      await expect(getChunks(model, "hi")).rejects.toThrow("timed out after 50ms");
+    });
+  });
+
+  describe("health check", () => {
+    it("should pass when the command is on PATH", async () => {
+      await expect(new ExecModel({ command: "cat" }).checkHealth()).resolves.toBeUndefined();
+    });
+
+    it("should fail when the command doesn't exist", async () => {
+      const model = new ExecModel({ command: "/nonexistent/teenytiny-model" });
+
+      await expect(model.checkHealth()).rejects.toThrow("not found or not executable");
+    });
+  });
+
+  describe("pooled mode", () => {
+    let model: ExecModel | undefined;
+
+    afterEach(() => {
+      model?.close();
+    });
+
+    it("should reuse long-lived workers across requests", async () => {
+      model = new ExecModel({ command: "bash", args: [WORKER], pool: { size: 1 } });
+
+      const first = parseReply(await getResponse(model, "one"));
+      const second = parseReply(await getResponse(model, "two\nlines, ünïcode"));
+
+      expect(first.payload).toBe("one");
+      expect(second.payload).toBe("two\nlines, ünïcode");
+      expect(second.pid).toBe(first.pid);
+    });
+  });
+});
+
+describe("ExecWorkerPool", () => {
+  let pool: ExecWorkerPool | undefined;
+
+  afterEach(() => {
+    pool?.close();
+  });
+
+  it("should spread concurrent requests over idle workers", async () => {
+    pool = new ExecWorkerPool("bash", [WORKER], { size: 2 });
+
+    const replies = (await Promise.all(["a", "b", "c", "d"].map((input) => pool!.run(input)))).map(parseReply);
+
+    expect(replies.map((reply) => reply.payload)).toEqual(["a", "b", "c", "d"]);
+    expect(new Set(replies.map((reply) => reply.pid)).size).toBe(2);
+  });
+
+  it("should replace workers after their maximum number of requests", async () => {
+    pool = new ExecWorkerPool("bash", [WORKER], { size: 1, maxRequestsPerWorker: 2 });
+
+    const pids: string[] = [];
+    for (const input of ["1", "2", "3", "4", "5"]) {
+      pids.push(parseReply(await pool.run(input)).pid);
+    }
+
+    expect(pids[0]).toBe(pids[1]);
+    expect(pids[2]).not.toBe(pids[1]);
+    expect(pids[2]).toBe(pids[3]);
+    expect(pids[4]).not.toBe(pids[3]);
+  });
+
+  it("should fail the request and respawn a worker that crashes", async () => {
+    pool = new ExecWorkerPool("bash", [WORKER], { size: 1, respawnBackoffMs: 10 });
+    const before = parseReply(await pool.run("before")).pid;
+
+    await expect(pool.run("crash")).rejects.toThrow("exited unexpectedly");
+    const after = parseReply(await pool.run("after"));
+
+    expect(after.payload).toBe("after");
+    expect(after.pid).not.toBe(before);
+  });
+
+  it("should time out a stuck worker and replace it", async () => {
+    pool = new ExecWorkerPool("bash", [WORKER], { size: 1, timeoutMs: 100, respawnBackoffMs: 10 });
+
+    await expect(pool.run("sleep")).rejects.toThrow("timed out after 100ms");
+
+    expect(parseReply(await pool.run("recovered")).payload).toBe("recovered");
+  });
+
+  it("should reject queued and new requests once closed", async () => {
+    pool = new ExecWorkerPool("bash", [WORKER], { size: 1, timeoutMs: 1000 });
+    const stuck = pool.run("sleep");
+    const queued = pool.run("queued");
+
+    pool.close();
+
+    await expect(queued).rejects.toThrow("closed");
+    await expect(stuck).rejects.toThrow();
+    await expect(pool.run("late")).rejects.toThrow("closed");
+  });
+});
@@ -0,0 +1,110 @@
+import { spawn } from 'child_process';
+import { access, constants } from 'fs/promises';
+import { delimiter, join } from 'path';
+import { Model, ModelContext } from './model.js';
+import { ExecWorkerPool } from './exec-pool.js';
+import type { ExecPoolOptions } from './exec-pool.js';
+
+export interface ExecOptions {
+  command: string;
+  args?: string[] | undefined;
+  // Per-request limit in one-shot mode; pooled mode uses pool.timeoutMs
+  timeoutMs?: number | undefined;
+  // Keep workers running between requests instead of one process per request
+  pool?: ExecPoolOptions | undefined;
+}
+
+/**
+ * Exec - Replies with the output of an external command (Node.js only)
+ *
+ * By default each request runs the command once: the user message goes to
+ * its stdin and its stdout is streamed back as it arrives. A non-zero exit
+ * fails the request. In pooled mode the command is started once per worker
+ * and speaks a length-prefixed protocol instead (see ExecWorkerPool), which
+ * avoids paying interpreter startup on every request; replies then arrive
+ * as a single chunk.
+ */
+export class ExecModel implements Model {
+  private pool: ExecWorkerPool | undefined;
+
+  constructor(private options: ExecOptions) {
+    if (options.pool) {
+      this.pool = new ExecWorkerPool(options.command, options.args ?? [], options.pool);
+    }
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    if (this.pool) {
+      yield await this.pool.run(input);
+      return;
+    }
+    yield* this.runOnce(input, context?.signal);
+  }
+
+  // Checks the command can still be run, without running it: a path must be
+  // executable, a bare name found on PATH
+  async checkHealth(): Promise<void> {
+    const { command } = this.options;
+    const candidates = command.includes('/')
+      ? [command]
+      : (process.env.PATH ?? '').split(delimiter).filter((dir) => dir !== '').map((dir) => join(dir, command));
+    for (const candidate of candidates) {
+      if (await access(candidate, constants.X_OK).then(() => true, () => false)) {
+        return;
+      }
+    }
+    throw new Error(`exec command not found or not executable: ${command}`);
+  }
+
+  close(): void {
+    this.pool?.close();
+  }
+
+  private async *runOnce(input: string, signal: AbortSignal | undefined): AsyncGenerator<string> {
+    const child = spawn(this.options.command, this.options.args ?? [], { stdio: ['pipe', 'pipe', 'pipe'] });
+    const exited = new Promise<number | null>((resolve, reject) => {
+      child.on('error', reject);
+      child.on('close', (code) => resolve(code));
+    });
+    // Keep a rejection from going unhandled while we're still reading stdout
+    exited.catch(() => {});
+
+    let stderr = '';
+    child.stderr.setEncoding('utf8');
+    child.stderr.on('data', (data: string) => {
+      stderr += data;
+    });
+    child.stdin.on('error', () => {}); // The command may exit without reading
+    child.stdin.end(input);
+
+    let timedOut = false;
+    const timer =
+      this.options.timeoutMs === undefined
+        ? undefined
+        : setTimeout(() => {
+            timedOut = true;
+            child.kill('SIGKILL');
+          }, this.options.timeoutMs);
+    const onAbort = () => child.kill('SIGKILL');
+    signal?.addEventListener('abort', onAbort, { once: true });
+
+    try {
+      child.stdout.setEncoding('utf8');
+      for await (const chunk of child.stdout) {
+        yield chunk as string;
+      }
+
+      const code = await exited;
+      if (timedOut) {
+        throw new Error(`exec command timed out after ${this.options.timeoutMs}ms`);
+      }
+      if (code !== 0 && !signal?.aborted) {
+        throw new Error(`exec command exited with code ${code}${stderr ? `: ${stderr.trim()}` : ''}`);
+      }
+    } finally {
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', onAbort);
+      child.kill('SIGKILL');
+    }
+  }
+}
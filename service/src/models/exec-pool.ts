@@ -0,0 +1,203 @@
+import { spawn } from 'child_process';
+import type { ChildProcessByStdio } from 'child_process';
+import type { Readable, Writable } from 'stream';
+
+export interface ExecPoolOptions {
+  // Worker processes kept running
+  size: number;
+  // A request with no reply by then fails, and its worker is replaced
+  timeoutMs?: number | undefined;
+  // Workers are replaced after serving this many requests (0: never)
+  maxRequestsPerWorker?: number | undefined;
+  // First respawn delay after a crash, doubling per consecutive crash
+  respawnBackoffMs?: number | undefined;
+  maxRespawnBackoffMs?: number | undefined;
+}
+
+interface Worker {
+  process: ChildProcessByStdio<Writable, Readable, null>;
+  served: number;
+  output: Buffer;
+  job?: Job | undefined;
+}
+
+interface Job {
+  input: string;
+  resolve: (output: string) => void;
+  reject: (error: Error) => void;
+  timer?: ReturnType<typeof setTimeout> | undefined;
+}
+
+/**
+ * Long-lived worker processes for the exec model's pooled mode.
+ *
+ * Requests and replies are framed the same way in both directions: the
+ * payload's length in bytes as decimal digits, a newline, then the UTF-8
+ * payload. Each worker handles one request at a time; requests queue in
+ * arrival order while all workers are busy. Crashed workers are respawned
+ * with exponential backoff, and workers that hit the request limit are
+ * retired and replaced straight away.
+ */
+export class ExecWorkerPool {
+  private idle: Worker[] = [];
+  private queue: Job[] = [];
+  private workers = new Set<Worker>();
+  private crashes = 0;
+  private closed = false;
+
+  constructor(
+    private command: string,
+    private args: string[],
+    private options: ExecPoolOptions,
+  ) {
+    for (let i = 0; i < options.size; i++) {
+      this.spawnWorker();
+    }
+  }
+
+  run(input: string): Promise<string> {
+    if (this.closed) {
+      return Promise.reject(new Error('exec worker pool is closed'));
+    }
+    return new Promise((resolve, reject) => {
+      this.queue.push({ input, resolve, reject });
+      this.dispatch();
+    });
+  }
+
+  // Process IDs of the running workers, for diagnostics and tests
+  pids(): number[] {
+    return [...this.workers].map((worker) => worker.process.pid ?? -1);
+  }
+
+  close(): void {
+    this.closed = true;
+    for (const job of this.queue.splice(0)) {
+      job.reject(new Error('exec worker pool is closed'));
+    }
+    for (const worker of this.workers) {
+      worker.process.kill('SIGKILL');
+    }
+  }
+
+  private dispatch(): void {
+    while (this.idle.length > 0 && this.queue.length > 0) {
+      const worker = this.idle.shift()!;
+      const job = this.queue.shift()!;
+      worker.job = job;
+
+      if (this.options.timeoutMs !== undefined) {
+        job.timer = setTimeout(() => {
+          this.fail(worker, new Error(`exec worker timed out after ${this.options.timeoutMs}ms`));
+          worker.process.kill('SIGKILL');
+        }, this.options.timeoutMs);
+      }
+
+      const payload = Buffer.from(job.input, 'utf8');
+      worker.process.stdin.write(`${payload.length}\n`);
+      worker.process.stdin.write(payload);
+    }
+  }
+
+  private spawnWorker(): void {
+    if (this.closed) {
+      return;
+    }
+
+    const worker: Worker = {
+      process: spawn(this.command, this.args, { stdio: ['pipe', 'pipe', 'inherit'] }),
+      served: 0,
+      output: Buffer.alloc(0),
+    };
+    this.workers.add(worker);
+
+    worker.process.stdout.on('data', (data: Buffer) => {
+      worker.output = Buffer.concat([worker.output, data]);
+      this.readReply(worker);
+    });
+    // Writing to a worker that has just died; the exit handler deals with it
+    worker.process.stdin.on('error', () => {});
+    // Spawning failed, e.g. no such command; 'exit' may never follow
+    worker.process.on('error', (error) => {
+      this.fail(worker, error);
+      this.onExit(worker, null, null);
+    });
+    worker.process.on('exit', (code, signal) => this.onExit(worker, code, signal));
+
+    this.idle.push(worker);
+    this.dispatch();
+  }
+
+  private readReply(worker: Worker): void {
+    const newline = worker.output.indexOf(0x0a);
+    if (newline < 0) {
+      return;
+    }
+    const length = Number(worker.output.subarray(0, newline).toString('ascii'));
+    if (!Number.isInteger(length) || length < 0) {
+      this.fail(worker, new Error('exec worker sent a malformed reply header'));
+      worker.process.kill('SIGKILL');
+      return;
+    }
+    if (worker.output.length < newline + 1 + length) {
+      return;
+    }
+
+    const reply = worker.output.subarray(newline + 1, newline + 1 + length).toString('utf8');
+    worker.output = worker.output.subarray(newline + 1 + length);
+
+    const job = worker.job;
+    if (!job) {
+      return;
+    }
+    clearTimeout(job.timer);
+    worker.job = undefined;
+    worker.served++;
+    this.crashes = 0;
+    job.resolve(reply);
+
+    const max = this.options.maxRequestsPerWorker ?? 0;
+    if (max > 0 && worker.served >= max) {
+      this.retire(worker);
+    } else {
+      this.idle.push(worker);
+      this.dispatch();
+    }
+  }
+
+  // Replaces a worker that has done its share, without counting it as a crash
+  private retire(worker: Worker): void {
+    this.workers.delete(worker);
+    worker.process.stdin.end();
+    worker.process.kill();
+    this.spawnWorker();
+  }
+
+  private fail(worker: Worker, error: Error): void {
+    const job = worker.job;
+    if (job) {
+      clearTimeout(job.timer);
+      worker.job = undefined;
+      job.reject(error);
+    }
+  }
+
+  private onExit(worker: Worker, code: number | null, signal: NodeJS.Signals | null): void {
+    if (!this.workers.delete(worker)) {
+      return; // Already handled, or retired on purpose
+    }
+    // Grandchildren may still hold the pipes open; we're done reading them
+    worker.process.stdout.destroy();
+    worker.process.stdin.destroy();
+    this.idle = this.idle.filter((candidate) => candidate !== worker);
+    this.fail(worker, new Error(`exec worker exited unexpectedly (${signal ?? `code ${code}`})`));
+    if (this.closed) {
+      return;
+    }
+
+    const base = this.options.respawnBackoffMs ?? 100;
+    const delay = Math.min(base * 2 ** this.crashes, this.options.maxRespawnBackoffMs ?? 10_000);
+    this.crashes++;
+    setTimeout(() => this.spawnWorker(), delay).unref?.();
+  }
+}
@@ -0,0 +1,35 @@
+import { describe, it, expect } from "vitest";
+import { FanoutModel } from "./fanout-model.js";
+import { EchoModel } from "./echo-model.js";
+import { ReverseModel } from "./reverse-model.js";
+import { createModelContext } from "./model.js";
+
+async function reply(model: FanoutModel, choiceIndex?: number): Promise<string> {
+  const context = createModelContext();
+  if (choiceIndex !== undefined) {
+    context.choiceIndex = choiceIndex;
+  }
+  let text = "";
+  for await (const chunk of model.process("abc", context)) {
+    text += chunk;
+  }
+  return text;
+}
+
+describe("FanoutModel", () => {
+  const fanout = new FanoutModel([new EchoModel(), new ReverseModel()]);
+
+  it("should answer each choice with its backend", async () => {
+    expect(await reply(fanout, 0)).toBe("abc");
+    expect(await reply(fanout, 1)).toBe("cba");
+  });
+
+  it("should take turns beyond the last backend, starting from the first", async () => {
+    expect(await reply(fanout)).toBe("abc");
+    expect(await reply(fanout, 3)).toBe("cba");
+  });
+
+  it("should need a backend", () => {
+    expect(() => new FanoutModel([])).toThrow("at least one backend");
+  });
+});
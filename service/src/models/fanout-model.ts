@@ -0,0 +1,22 @@
+import { Model, ModelContext } from './model.js';
+
+/**
+ * Fanout - Several models' replies to one request, side by side
+ *
+ * Each choice of a completion is answered by one of its backends in turn:
+ * choice 0 by the first, choice 1 by the second, and so on. Registered with
+ * n forced to the number of backends, a single request gets one reply from
+ * every backend, for comparing their output in one call.
+ */
+export class FanoutModel implements Model {
+  constructor(private backends: Model[]) {
+    if (backends.length === 0) {
+      throw new Error('Fanout needs at least one backend model');
+    }
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const backend = this.backends[(context?.choiceIndex ?? 0) % this.backends.length]!;
+    yield* backend.process(input, context);
+  }
+}
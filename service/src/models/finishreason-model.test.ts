@@ -0,0 +1,63 @@
+import { describe, it, expect } from "vitest";
+import { FinishReasonModel } from "./finishreason-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+import { InvalidRequestError } from "../openai-protocol/errors.js";
+
+describe("FinishReasonModel", () => {
+  it.each(["stop", "length", "content_filter"] as const)(
+    "should reply with canned content and finish with %s",
+    async (reason) => {
+      const model = new FinishReasonModel();
+      const context = createModelContext();
+
+      const response = await getResponse(model, reason, context);
+
+      expect(response).not.toBe("");
+      expect(context.finishReason).toBe(reason);
+      expect(context.toolCalls).toEqual([]);
+    },
+  );
+
+  it.each(["tool_calls", "function_call"] as const)(
+    "should stub a call to the first tool and finish with %s",
+    async (reason) => {
+      const model = new FinishReasonModel();
+      const context = createModelContext([], [{ name: "lookup" }]);
+
+      const response = await getResponse(model, ` ${reason.toUpperCase()} `, context);
+
+      expect(response).toBe("");
+      expect(context.finishReason).toBe(reason);
+      expect(context.toolCalls).toEqual([{ name: "lookup", arguments: "{}" }]);
+    },
+  );
+
+  it("should stub a call even when no tools were offered", async () => {
+    const model = new FinishReasonModel();
+    const context = createModelContext();
+
+    await getResponse(model, "tool_calls", context);
+
+    expect(context.toolCalls[0]?.name).toBe("finish_reason_stub");
+  });
+
+  it("should reject unknown values with the valid options", async () => {
+    const model = new FinishReasonModel();
+
+    const error = await getResponse(model, "exhausted").catch((e: unknown) => e);
+
+    expect(error).toBeInstanceOf(InvalidRequestError);
+    expect((error as InvalidRequestError).message).toContain(
+      "stop, length, tool_calls, content_filter, function_call",
+    );
+  });
+
+  it("should return default message for empty input", async () => {
+    const model = new FinishReasonModel();
+
+    const response = await getResponse(model, "");
+
+    expect(response).toContain("I'm the FinishReason model");
+  });
+});
@@ -0,0 +1,54 @@
+import { Model, ModelContext, ModelFinishReason } from './model.js';
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+
+const CANNED_CONTENT: Record<ModelFinishReason, string | undefined> = {
+  stop: 'This response finished normally.',
+  length: 'This response was cut off because it reached the maximum',
+  tool_calls: undefined,
+  content_filter: 'This response was withheld by the content',
+  function_call: undefined,
+};
+
+export const FINISH_REASONS = Object.keys(CANNED_CONTENT) as ModelFinishReason[];
+
+/**
+ * FinishReason - Produces any finish_reason on demand
+ *
+ * The user message names the finish_reason to end with (stop, length,
+ * tool_calls, content_filter or function_call). Content reasons reply with a
+ * short canned sentence; tool_calls and function_call reply with a stub call
+ * to the first tool offered (or `finish_reason_stub` if none) and no content.
+ * Any other value is rejected with a 400 listing the valid options.
+ */
+export class FinishReasonModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const requested = input.trim().toLowerCase();
+    if (!requested) {
+      yield `Hello! I'm the FinishReason model. Send one of ${FINISH_REASONS.join(', ')} and I'll finish with it.`;
+      return;
+    }
+
+    const reason = FINISH_REASONS.find((candidate) => candidate === requested);
+    if (!reason) {
+      throw new InvalidRequestError(
+        `Unknown finish_reason '${requested}'. Valid options: ${FINISH_REASONS.join(', ')}`,
+        'messages'
+      );
+    }
+
+    if (context) {
+      context.finishReason = reason;
+      if (reason === 'tool_calls' || reason === 'function_call') {
+        context.toolCalls.push({
+          name: context.tools[0]?.name ?? 'finish_reason_stub',
+          arguments: '{}',
+        });
+      }
+    }
+
+    const content = CANNED_CONTENT[reason];
+    if (content !== undefined) {
+      yield content;
+    }
+  }
+}
@@ -0,0 +1,66 @@
+import { describe, it, expect } from "vitest";
+import { HeadersModel, checkHeader } from "./headers-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("HeadersModel", () => {
+  it("should request allowed headers and echo what it set", async () => {
+    const model = new HeadersModel();
+    const context = createModelContext();
+
+    const response = await getResponse(
+      model,
+      "X-TeenyTiny-Trace: abc123\nRetry-After: 5",
+      context,
+    );
+
+    expect(context.responseHeaders).toEqual({
+      "X-TeenyTiny-Trace": "abc123",
+      "Retry-After": "5",
+    });
+    expect(response).toBe("Set X-TeenyTiny-Trace: abc123\nSet Retry-After: 5");
+  });
+
+  it("should refuse unsafe headers in the reply instead of failing", async () => {
+    const model = new HeadersModel();
+    const context = createModelContext();
+
+    const response = await getResponse(
+      model,
+      "Transfer-Encoding: chunked\nSet-Cookie: a=b\nX-TeenyTiny-Ok: yes\nnonsense",
+      context,
+    );
+
+    expect(context.responseHeaders).toEqual({ "X-TeenyTiny-Ok": "yes" });
+    expect(response).toContain("Refused Transfer-Encoding: hop-by-hop");
+    expect(response).toContain("Refused Set-Cookie: security-sensitive");
+    expect(response).toContain("Ignored 'nonsense'");
+  });
+
+  it("should return default message for empty input", async () => {
+    const model = new HeadersModel();
+
+    const response = await getResponse(model, "");
+
+    expect(response).toContain("I'm the Headers model");
+  });
+});
+
+describe("checkHeader", () => {
+  it("should allow X-TeenyTiny-* in any case", () => {
+    expect(checkHeader("x-teenytiny-anything", "value")).toBeUndefined();
+  });
+
+  it("should refuse headers outside the allowlist", () => {
+    expect(checkHeader("X-Powered-By", "me")).toContain("only X-TeenyTiny-*");
+  });
+
+  it("should refuse CORS headers", () => {
+    expect(checkHeader("Access-Control-Allow-Origin", "*")).toContain("security-sensitive");
+  });
+
+  it("should refuse malformed names and values", () => {
+    expect(checkHeader("X-TeenyTiny Bad", "v")).toBe("not a valid header name");
+    expect(checkHeader("X-TeenyTiny-Emoji", "🙂")).toBe("values must be printable ASCII");
+  });
+});
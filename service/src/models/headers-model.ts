@@ -0,0 +1,108 @@
+import { Model, ModelContext } from './model.js';
+
+// Settable besides X-TeenyTiny-*: cache and metadata headers that proxies and
+// SDKs commonly inspect but that can't change how the response is framed
+export const ALLOWED_HEADERS = [
+  'Cache-Control',
+  'Content-Language',
+  'ETag',
+  'Expires',
+  'Last-Modified',
+  'Retry-After',
+  'Vary',
+];
+
+const HOP_BY_HOP_HEADERS = [
+  'Connection',
+  'Keep-Alive',
+  'Proxy-Authenticate',
+  'Proxy-Authorization',
+  'TE',
+  'Trailer',
+  'Transfer-Encoding',
+  'Upgrade',
+];
+
+const SENSITIVE_HEADERS = [
+  'Authorization',
+  'Content-Encoding',
+  'Content-Length',
+  'Content-Security-Policy',
+  'Content-Type',
+  'Host',
+  'Location',
+  'Set-Cookie',
+  'Strict-Transport-Security',
+  'WWW-Authenticate',
+];
+
+const HEADER_NAME = /^[A-Za-z0-9-]+$/;
+const HEADER_VALUE = /^[\t\x20-\x7e]*$/;
+
+/**
+ * Headers - Makes the server emit response headers of the caller's choosing
+ *
+ * Each line of the user message of the form `Header-Name: value` asks for
+ * that header on the HTTP response. Only `X-TeenyTiny-*` names and a small
+ * allowlist of safe headers are honoured; hop-by-hop and security-sensitive
+ * headers (and anything else) are refused, with the reason given in the
+ * reply rather than as an error. The reply lists what was set and refused.
+ */
+export class HeadersModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const lines = input
+      .split(/\r?\n/)
+      .map((line) => line.trim())
+      .filter((line) => line !== '');
+    if (lines.length === 0) {
+      yield "Hello! I'm the Headers model. Send 'X-TeenyTiny-Name: value' lines and I'll set them on the response.";
+      return;
+    }
+
+    const headers: Record<string, string> = {};
+    const report = lines.map((line) => {
+      const separator = line.indexOf(':');
+      if (separator === -1) {
+        return `Ignored '${line}': expected 'Header-Name: value'`;
+      }
+
+      const name = line.slice(0, separator).trim();
+      const value = line.slice(separator + 1).trim();
+      const refusal = checkHeader(name, value);
+      if (refusal) {
+        return `Refused ${name}: ${refusal}`;
+      }
+
+      headers[name] = value;
+      return `Set ${name}: ${value}`;
+    });
+
+    if (context) {
+      context.responseHeaders = { ...context.responseHeaders, ...headers };
+    }
+    yield report.join('\n');
+  }
+}
+
+// Returns why a header may not be set, or undefined if it may
+export function checkHeader(name: string, value: string): string | undefined {
+  if (!HEADER_NAME.test(name)) {
+    return 'not a valid header name';
+  }
+  if (!HEADER_VALUE.test(value)) {
+    return 'values must be printable ASCII';
+  }
+
+  const lower = name.toLowerCase();
+  const matches = (list: string[]) => list.some((header) => header.toLowerCase() === lower);
+  if (matches(HOP_BY_HOP_HEADERS)) {
+    return 'hop-by-hop headers are managed by the server';
+  }
+  if (matches(SENSITIVE_HEADERS) || lower.startsWith('access-control-')) {
+    return 'security-sensitive headers cannot be overridden';
+  }
+  if (!lower.startsWith('x-teenytiny-') && !matches(ALLOWED_HEADERS)) {
+    return `only X-TeenyTiny-* and ${ALLOWED_HEADERS.join(', ')} can be set`;
+  }
+  return undefined;
+}
@@ -0,0 +1,23 @@
+import { describe, it, expect } from "vitest";
+import { HistoryModel } from "./history-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("HistoryModel", () => {
+  it("should list every message it received, numbered in order", async () => {
+    const context = createModelContext([
+      { role: "system", content: "Be brief" },
+      { role: "user", content: "Hi" },
+      { role: "assistant", content: "Hello" },
+      { role: "user", content: "Again" },
+    ]);
+
+    const response = await getResponse(new HistoryModel(), "Again", context);
+
+    expect(response).toBe("1. system: Be brief\n2. user: Hi\n3. assistant: Hello\n4. user: Again");
+  });
+
+  it("should fall back to the input without a context", async () => {
+    expect(await getResponse(new HistoryModel(), "Hi")).toBe("1. user: Hi");
+  });
+});
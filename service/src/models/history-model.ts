@@ -0,0 +1,16 @@
+import { Model, ModelContext } from './model.js';
+
+/**
+ * History - Replies with the conversation it was given
+ *
+ * Lists every message the model received, one numbered line per message
+ * ("1. user: Hi"), so clients can check exactly what history reached the
+ * model, e.g. when server-side sessions fill in earlier turns.
+ */
+export class HistoryModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const messages = context?.messages ?? [{ role: 'user', content: input }];
+
+    yield messages.map((message, index) => `${index + 1}. ${message.role}: ${message.content}`).join('\n');
+  }
+}
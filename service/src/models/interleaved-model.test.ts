@@ -0,0 +1,69 @@
+import { describe, it, expect } from "vitest";
+import { DEFAULT_INTERLEAVED_SCRIPT, InterleavedModel, parseInterleavedScript } from "./interleaved-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("InterleavedModel", () => {
+  it("should stream the opening word by word, then call the function", async () => {
+    const model = new InterleavedModel();
+    const context = createModelContext([{ role: "user", content: "Hi" }]);
+
+    const chunks: string[] = [];
+    for await (const chunk of model.process("Hi", context)) {
+      chunks.push(chunk);
+    }
+
+    expect(chunks).toEqual(["Let ", "me ", "look ", "that ", "up ", "for ", "you."]);
+    expect(context.toolCalls).toHaveLength(1);
+    const call = context.toolCalls[0]!;
+    expect(call.name).toBe("lookup");
+    expect(JSON.parse(call.arguments)).toEqual({ query: "teenytiny", limit: 3 });
+    expect(call.argumentChunks!.length).toBeGreaterThan(1);
+    expect(call.argumentChunks!.join("")).toBe(call.arguments);
+  });
+
+  it("should close with the tool result once it comes back", async () => {
+    const model = new InterleavedModel();
+    const context = createModelContext([
+      { role: "user", content: "Hi" },
+      { role: "assistant", content: "Let me look that up for you." },
+      { role: "tool", content: "42" },
+    ]);
+
+    const response = await getResponse(model, "Hi", context);
+
+    expect(response).toBe("The lookup returned 42, so that is your answer.");
+    expect(context.toolCalls).toEqual([]);
+  });
+
+  it("should follow a configured script", async () => {
+    const model = new InterleavedModel({
+      opening: "Checking.",
+      toolCall: { name: "check", arguments: { id: 1 } },
+      closing: "Got {result}.",
+    });
+    const context = createModelContext();
+
+    const response = await getResponse(model, "Hi", context);
+
+    expect(response).toBe("Checking.");
+    expect(context.toolCalls[0]).toMatchObject({ name: "check", arguments: '{"id":1}' });
+  });
+});
+
+describe("parseInterleavedScript", () => {
+  it("should accept a complete script", () => {
+    expect(parseInterleavedScript(DEFAULT_INTERLEAVED_SCRIPT)).toEqual(DEFAULT_INTERLEAVED_SCRIPT);
+  });
+
+  it("should reject missing sentences, bad tool calls and unknown settings", () => {
+    expect(() => parseInterleavedScript({ ...DEFAULT_INTERLEAVED_SCRIPT, opening: "" })).toThrow("opening");
+    expect(() =>
+      parseInterleavedScript({ ...DEFAULT_INTERLEAVED_SCRIPT, toolCall: { name: "bad name", arguments: {} } }),
+    ).toThrow("toolCall");
+    expect(() =>
+      parseInterleavedScript({ ...DEFAULT_INTERLEAVED_SCRIPT, toolCall: { name: "ok", arguments: "{}" } }),
+    ).toThrow("toolCall");
+    expect(() => parseInterleavedScript({ ...DEFAULT_INTERLEAVED_SCRIPT, extra: true })).toThrow("extra");
+  });
+});
@@ -0,0 +1,94 @@
+import { Model, ModelContext } from './model.js';
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+
+// What the interleaved model says and calls on each turn
+export interface InterleavedScript {
+  // Streamed before the tool call
+  opening: string;
+  toolCall: {
+    name: string;
+    arguments: Record<string, unknown>;
+  };
+  // Streamed once the tool result comes back; {result} is replaced by it
+  closing: string;
+}
+
+export const DEFAULT_INTERLEAVED_SCRIPT: InterleavedScript = {
+  opening: 'Let me look that up for you.',
+  toolCall: {
+    name: 'lookup',
+    arguments: { query: 'teenytiny', limit: 3 },
+  },
+  closing: 'The lookup returned {result}, so that is your answer.',
+};
+
+// Characters of JSON arguments per streamed delta
+const ARGUMENT_CHUNK_LENGTH = 8;
+
+/**
+ * Interleaved - Content and tool-call deltas in one streamed turn
+ *
+ * Streams the opening sentence word by word, then calls the scripted
+ * function with its arguments split across several deltas, finishing with
+ * tool_calls. Once the conversation ends with a tool result, it streams the
+ * closing sentence and stops, so clients have to handle content → tool call
+ * → content transitions the way real models produce them.
+ *
+ * The function is called whether or not the caller offered it as a tool.
+ */
+export class InterleavedModel implements Model {
+  constructor(private script: InterleavedScript = DEFAULT_INTERLEAVED_SCRIPT) {}
+
+  async *process(_input: string, context?: ModelContext): AsyncGenerator<string> {
+    const last = context?.messages[context.messages.length - 1];
+    if (last && (last.role === 'tool' || last.role === 'function')) {
+      yield* this.script.closing.replaceAll('{result}', last.content).split(/(?<= )/);
+      return;
+    }
+
+    yield* this.script.opening.split(/(?<= )/);
+
+    if (context) {
+      const args = JSON.stringify(this.script.toolCall.arguments);
+      const argumentChunks: string[] = [];
+      for (let start = 0; start < args.length; start += ARGUMENT_CHUNK_LENGTH) {
+        argumentChunks.push(args.slice(start, start + ARGUMENT_CHUNK_LENGTH));
+      }
+      context.toolCalls.push({ name: this.script.toolCall.name, arguments: args, argumentChunks });
+    }
+  }
+}
+
+// Validates a script from the --interleaved-script fixture file
+export function parseInterleavedScript(value: unknown): InterleavedScript {
+  if (!isObject(value)) {
+    throw new InvalidRequestError('Interleaved script must be an object');
+  }
+  const { opening, toolCall, closing, ...rest } = value;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown interleaved script setting: ${unknownKey}`, unknownKey);
+  }
+
+  if (typeof opening !== 'string' || opening === '') {
+    throw new InvalidRequestError('opening must be a non-empty string', 'opening');
+  }
+  if (typeof closing !== 'string' || closing === '') {
+    throw new InvalidRequestError('closing must be a non-empty string', 'closing');
+  }
+  if (
+    !isObject(toolCall) ||
+    typeof toolCall.name !== 'string' ||
+    !/^[a-zA-Z0-9_-]{1,64}$/.test(toolCall.name) ||
+    !isObject(toolCall.arguments)
+  ) {
+    throw new InvalidRequestError('toolCall must be {name, arguments} with a valid function name and an arguments object', 'toolCall');
+  }
+
+  return { opening, toolCall: { name: toolCall.name, arguments: toolCall.arguments }, closing };
+}
+
+function isObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
@@ -0,0 +1,60 @@
+import { describe, it, expect } from "vitest";
+import { JsonPatchModel } from "./jsonpatch-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+const patch = JSON.stringify([{ op: "replace", path: "/status", value: "done" }]);
+
+function conversation(...contents: string[]) {
+  return createModelContext(contents.map((content) => ({ role: "user", content })));
+}
+
+describe("JsonPatchModel", () => {
+  it("should reply with the patched document pretty-printed", async () => {
+    const context = conversation('{"id": 1, "status": "open"}', patch);
+
+    const response = await getResponse(new JsonPatchModel(), patch, context);
+
+    expect(response).toBe('{\n  "id": 1,\n  "status": "done"\n}');
+  });
+
+  it("should reply with compact JSON for a JSON response_format", async () => {
+    const context = conversation(patch, '```json\n{"status": "open"}\n```');
+    context.responseFormat = "json_object";
+
+    expect(await getResponse(new JsonPatchModel(), "", context)).toBe('{"status":"done"}');
+  });
+
+  it("should patch the newest document", async () => {
+    const context = conversation('{"status": "old"}', '{"status": "new", "v": 2}', "Apply this:", patch);
+
+    expect(JSON.parse(await getResponse(new JsonPatchModel(), patch, context))).toEqual({ status: "done", v: 2 });
+  });
+
+  it("should explain a patch that can't be applied", async () => {
+    const failing = JSON.stringify([{ op: "test", path: "/status", value: "closed" }]);
+    const context = conversation('{"status": "open"}', failing);
+
+    const response = await getResponse(new JsonPatchModel(), failing, context);
+
+    expect(response).toBe(
+      'The patch couldn\'t be applied, so the document is unchanged. Operation 0 (test /status) failed: value is "open", not "closed".',
+    );
+  });
+
+  it("should report errors as JSON for a JSON response_format", async () => {
+    const context = conversation('{"tags": []}', JSON.stringify([{ op: "remove", path: "/tags/0" }]));
+    context.responseFormat = "json_object";
+
+    const response = JSON.parse(await getResponse(new JsonPatchModel(), "", context));
+
+    expect(response.error).toContain("out of bounds");
+  });
+
+  it("should ask for whatever is missing", async () => {
+    expect(await getResponse(new JsonPatchModel(), "Hello")).toContain("I need a JSON Patch array");
+    expect(await getResponse(new JsonPatchModel(), patch, conversation(patch))).toContain(
+      "I need a JSON document to patch",
+    );
+  });
+});
@@ -0,0 +1,62 @@
+import { Model, ModelContext } from './model.js';
+import { applyJsonPatch } from '../utils/json-patch.js';
+import type { JsonValue } from '../utils/json-patch.js';
+
+/**
+ * JSONPatch - Applies an RFC 6902 JSON Patch to a JSON document
+ *
+ * Looks through the user messages, newest first, for a JSON Patch (an array
+ * of {"op": ...} objects) and a JSON document in another message, and
+ * replies with the patched document pretty-printed, or compact with a JSON
+ * response_format. Either may be wrapped in a ```json fence. A patch that
+ * can't be applied, say because a path doesn't exist or a test op fails,
+ * gets a reply explaining which operation failed rather than an error, and
+ * the document is left unchanged.
+ */
+export class JsonPatchModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const json = context?.responseFormat === 'json_object' || context?.responseFormat === 'json_schema';
+    const contents = (context?.messages ?? [{ role: 'user', content: input }])
+      .filter((message) => message.role === 'user')
+      .map((message) => parseJson(message.content))
+      .reverse();
+
+    const patchIndex = contents.findIndex(isJsonPatch);
+    const document = contents.find((content, i) => i !== patchIndex && content !== undefined);
+    if (patchIndex === -1 || document === undefined) {
+      const missing = patchIndex === -1 ? 'a JSON Patch array' : 'a JSON document to patch';
+      const reply = `I need ${missing}. Send a JSON document and a JSON Patch (RFC 6902), e.g. [{"op": "add", "path": "/name", "value": "Ada"}], in separate user messages and I'll apply the patch.`;
+      yield json ? JSON.stringify({ error: reply }) : reply;
+      return;
+    }
+
+    let patched: JsonValue;
+    try {
+      patched = applyJsonPatch(document, contents[patchIndex]);
+    } catch (error) {
+      const reason = error instanceof Error ? error.message : String(error);
+      yield json ? JSON.stringify({ error: reason }) : `The patch couldn't be applied, so the document is unchanged. ${reason}.`;
+      return;
+    }
+    yield json ? JSON.stringify(patched) : JSON.stringify(patched, null, 2);
+  }
+}
+
+// The message's JSON, if it is JSON, optionally inside a code fence
+function parseJson(content: string): JsonValue | undefined {
+  const text = content.trim().replace(/^```(?:json)?\s*\n([\s\S]*?)\n?```$/, '$1');
+  try {
+    return JSON.parse(text) as JsonValue;
+  } catch {
+    return undefined;
+  }
+}
+
+// Arrays of operation objects are patches; other JSON is a document
+function isJsonPatch(value: JsonValue | undefined): boolean {
+  return (
+    Array.isArray(value) &&
+    value.length > 0 &&
+    value.every((item) => typeof item === 'object' && item !== null && !Array.isArray(item) && 'op' in item)
+  );
+}
@@ -0,0 +1,60 @@
+import { describe, it, expect } from "vitest";
+import { LatencyEchoModel } from "./latency-echo-model.js";
+import { createModelContext } from "./model.js";
+import { RequestTimer } from "../utils/request-timer.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+function timedContext(responseFormat?: string) {
+  const clock = { time: 0 };
+  const timing = new RequestTimer(() => clock.time);
+  timing.start("auth");
+  clock.time += 1.5;
+  timing.stop("auth");
+  timing.start("parse");
+  clock.time += 0.25;
+  timing.stop("parse");
+  timing.start("model");
+  clock.time += 2;
+
+  const context = createModelContext();
+  context.timing = timing;
+  context.responseFormat = responseFormat;
+  return context;
+}
+
+describe("LatencyEchoModel", () => {
+  it("should echo the input followed by each phase's timing", async () => {
+    const context = timedContext();
+
+    const response = await getResponse(new LatencyEchoModel(), "hello", context);
+
+    expect(response).toBe(
+      `hello\n\nServer timing: auth 1.5ms, parse 0.25ms, model 2ms, write 0ms (arrived ${context.timing!.arrivedAt.toISOString()})`,
+    );
+  });
+
+  it("should reply with structured timings for json_object", async () => {
+    const context = timedContext("json_object");
+
+    const response = JSON.parse(await getResponse(new LatencyEchoModel(), "hello", context));
+
+    expect(response).toEqual({
+      echo: "hello",
+      arrived_at: context.timing!.arrivedAt.toISOString(),
+      phases_ms: { auth: 1.5, parse: 0.25, model: 2, write: 0 },
+      elapsed_ms: 3.75,
+    });
+  });
+
+  it("should say so when the server records no timings", async () => {
+    const response = await getResponse(new LatencyEchoModel(), "hello");
+
+    expect(response).toBe("hello\n\nServer timing unavailable.");
+  });
+
+  it("should introduce itself for empty input", async () => {
+    const response = await getResponse(new LatencyEchoModel(), "", timedContext());
+
+    expect(response).toMatch(/^Hello! I'm the Latency Echo model\..*\n\nServer timing: auth /s);
+  });
+});
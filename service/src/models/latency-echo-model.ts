@@ -0,0 +1,47 @@
+import { Model, ModelContext } from './model.js';
+import { TIMING_PHASES } from '../utils/request-timer.js';
+
+/**
+ * Latency Echo - Echoes the input followed by server-side timings
+ *
+ * Appends the time the request has spent so far in each server phase (auth,
+ * parse, model, write) and when it arrived, so slow requests can be split
+ * into server time and network time. With
+ * `response_format: {type: 'json_object'}` it replies with
+ * {"echo", "arrived_at", "phases_ms", "elapsed_ms"} instead. Timings are
+ * taken as the last chunk is produced, so writing that chunk isn't counted.
+ */
+export class LatencyEchoModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const timing = context?.timing;
+    const json = context?.responseFormat === 'json_object';
+
+    if (!json) {
+      yield input || "Hello! I'm the Latency Echo model. Send me a message and I'll echo it back with server timings.";
+    }
+
+    if (!timing) {
+      yield json ? JSON.stringify({ echo: input }) : '\n\nServer timing unavailable.';
+      return;
+    }
+
+    const phases = timing.phases();
+    if (json) {
+      yield JSON.stringify({
+        echo: input,
+        arrived_at: timing.arrivedAt.toISOString(),
+        phases_ms: Object.fromEntries(TIMING_PHASES.map((phase) => [phase, round(phases[phase])])),
+        elapsed_ms: round(timing.elapsed()),
+      });
+      return;
+    }
+
+    const summary = TIMING_PHASES.map((phase) => `${phase} ${round(phases[phase])}ms`).join(', ');
+    yield `\n\nServer timing: ${summary} (arrived ${timing.arrivedAt.toISOString()})`;
+  }
+}
+
+// Microsecond precision is plenty and keeps the output readable
+function round(ms: number): number {
+  return Math.round(ms * 1000) / 1000;
+}
@@ -0,0 +1,36 @@
+import { describe, it, expect } from "vitest";
+import { LatencyModel } from "./latency-model.js";
+import { createModelContext } from "./model.js";
+import { RequestTimer } from "../utils/request-timer.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("LatencyModel", () => {
+  it("should reply with the request's parse and generate times", async () => {
+    const clock = { time: 0 };
+    const timing = new RequestTimer(() => clock.time);
+    timing.start("parse");
+    clock.time += 0.0625;
+    timing.stop("parse");
+    timing.start("model");
+    clock.time += 2;
+    const context = createModelContext();
+    context.timing = timing;
+
+    const response = JSON.parse(await getResponse(new LatencyModel(), "ignored", context));
+
+    expect(response).toEqual({
+      arrived_at: timing.arrivedAt.toISOString(),
+      auth_ms: 0,
+      parse_ms: 0.0625,
+      generate_ms: 2,
+      elapsed_ms: 2.0625,
+    });
+  });
+
+  it("should say so when the server records no timings", async () => {
+    expect(JSON.parse(await getResponse(new LatencyModel(), "hello"))).toEqual({
+      error: "Server timing unavailable",
+      input: "hello",
+    });
+  });
+});
@@ -0,0 +1,30 @@
+import { Model, ModelContext } from './model.js';
+
+/**
+ * Latency - Replies with the server's own timings for the request
+ *
+ * Always answers with a JSON object, for clients benchmarking the server:
+ * how long the body took to read and validate (parse_ms), how long the
+ * model has been generating (generate_ms), the time spent authenticating,
+ * and the total since the request arrived. Like latency-echo it reads the
+ * request's timer as the reply is produced, but leaves the figures
+ * unrounded so even sub-microsecond phases show as measured.
+ */
+export class LatencyModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const timing = context?.timing;
+    if (!timing) {
+      yield JSON.stringify({ error: 'Server timing unavailable', input });
+      return;
+    }
+
+    const phases = timing.phases();
+    yield JSON.stringify({
+      arrived_at: timing.arrivedAt.toISOString(),
+      auth_ms: phases.auth,
+      parse_ms: phases.parse,
+      generate_ms: phases.model,
+      elapsed_ms: timing.elapsed(),
+    });
+  }
+}
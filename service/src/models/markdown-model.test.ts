@@ -0,0 +1,42 @@
+import { describe, it, expect } from "vitest";
+import { MarkdownModel, markdownBlocks, MARKDOWN_ELEMENTS } from "./markdown-model.js";
+import { getChunks } from "../../tests/test-helpers.js";
+
+describe("MarkdownModel", () => {
+  it("should wrap the message in every element, one chunk each", async () => {
+    const chunks = await getChunks(new MarkdownModel(), "Hello | <world>");
+    const content = chunks.join("");
+
+    expect(chunks).toHaveLength(MARKDOWN_ELEMENTS.length);
+    expect(content).toBe(markdownBlocks("Hello | <world>", [...MARKDOWN_ELEMENTS]).join(""));
+    expect(content).toMatch(/^# Hello \| <world>\n\n/);
+    expect(content).toContain("\n\n> Hello | <world>\n\n");
+    expect(content).toContain("- **Words:** 3\n- **Lines:** 1\n- **Characters:** 15");
+    expect(content).toContain("```text\nHello | <world>\n```");
+    expect(content).toContain(
+      "| # | Word | Length |\n| ---: | --- | ---: |\n| 1 | Hello | 5 |\n| 2 | \\| | 1 |\n| 3 | <world> | 7 |"
+    );
+    expect(content).toMatch(/<details>\n<summary>Echo<\/summary>\n<p>Hello \| &lt;world&gt;<\/p>\n<\/details>$/);
+  });
+
+  it("should include just the elements named in the message", async () => {
+    const chunks = await getChunks(new MarkdownModel(), "code and tables");
+
+    expect(chunks).toEqual([
+      "```text\ncode and tables\n```\n\n",
+      "| # | Word | Length |\n| ---: | --- | ---: |\n| 1 | code | 4 |\n| 2 | and | 3 |\n| 3 | tables | 6 |",
+    ]);
+  });
+
+  it("should fence code containing backticks with a longer fence", () => {
+    const [block] = markdownBlocks("use ```js``` fences", ["code"]);
+
+    expect(block).toBe("````text\nuse ```js``` fences\n````");
+  });
+
+  it("should quote every line of a multi-line message", () => {
+    const [block] = markdownBlocks("first\n\nsecond", ["quote"]);
+
+    expect(block).toBe("> first\n>\n> second");
+  });
+});
@@ -0,0 +1,77 @@
+import { Model } from './model.js';
+
+export const MARKDOWN_ELEMENTS = ['heading', 'quote', 'list', 'code', 'table', 'html'] as const;
+
+export type MarkdownElement = typeof MARKDOWN_ELEMENTS[number];
+
+function isMarkdownElement(value: string): value is MarkdownElement {
+  return (MARKDOWN_ELEMENTS as readonly string[]).includes(value);
+}
+
+/**
+ * Markdown - Echoes the message wrapped in markdown, for rendering tests
+ *
+ * Replies with the message as a heading, a blockquote, a list of counts, a
+ * fenced code block, a table of its words and an HTML <details> block.
+ * Naming elements anywhere in the message ("code table") selects just
+ * those; otherwise all of them are included. Each element is streamed as
+ * one chunk, so a renderer never sees half a fence or table, and the chunks
+ * join to exactly markdownBlocks(...).join('').
+ */
+export class MarkdownModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    if (!input.trim()) {
+      yield `Hello! I'm the Markdown model. Name any of ${MARKDOWN_ELEMENTS.join(', ')} and I'll wrap your message in them.`;
+      return;
+    }
+
+    const requested = input
+      .toLowerCase()
+      .split(/[^a-z]+/)
+      .map((word) => word.replace(/s$/, ''))
+      .filter(isMarkdownElement);
+    yield* markdownBlocks(input, requested.length > 0 ? requested : [...MARKDOWN_ELEMENTS]);
+  }
+}
+
+// The markdown for each selected element, in MARKDOWN_ELEMENTS order; all
+// but the last end with the blank line separating it from the next
+export function markdownBlocks(input: string, elements: MarkdownElement[]): string[] {
+  const text = input.trim();
+  const words = text.split(/\s+/);
+  const lines = text.split(/\r?\n/);
+
+  const render: Record<MarkdownElement, () => string> = {
+    heading: () => `# ${lines[0]}`,
+    quote: () => lines.map((line) => (line.trim() ? `> ${line}` : '>')).join('\n'),
+    list: () => [
+      `- **Words:** ${words.length}`,
+      `- **Lines:** ${lines.length}`,
+      `- **Characters:** ${[...text].length}`,
+    ].join('\n'),
+    code: () => {
+      // A fence longer than any backtick run inside, so the text can't close it
+      const longest = Math.max(0, ...(text.match(/`+/g) ?? []).map((run) => run.length));
+      const fence = '`'.repeat(Math.max(3, longest + 1));
+      return `${fence}text\n${text}\n${fence}`;
+    },
+    table: () => [
+      '| # | Word | Length |',
+      '| ---: | --- | ---: |',
+      ...words.map((word, i) => `| ${i + 1} | ${word.replace(/\|/g, '\\|')} | ${[...word].length} |`),
+    ].join('\n'),
+    html: () => `<details>\n<summary>Echo</summary>\n<p>${escapeHtml(text)}</p>\n</details>`,
+  };
+
+  const selected = MARKDOWN_ELEMENTS.filter((element) => elements.includes(element));
+  return selected.map((element, i) => render[element]() + (i < selected.length - 1 ? '\n\n' : ''));
+}
+
+function escapeHtml(text: string): string {
+  return text
+    .replace(/&/g, '&amp;')
+    .replace(/</g, '&lt;')
+    .replace(/>/g, '&gt;')
+    .replace(/"/g, '&quot;')
+    .replace(/\n/g, '<br>\n');
+}
@@ -0,0 +1,43 @@
+import { describe, it, expect } from "vitest";
+import { readFileSync } from "fs";
+import {
+  MarkdownTortureModel,
+  MARKDOWN_TORTURE_CHUNKS,
+  MARKDOWN_TORTURE_SECTIONS,
+} from "./markdown-torture-model.js";
+import { getChunks } from "../../tests/test-helpers.js";
+
+const FIXTURE = JSON.parse(
+  readFileSync(new URL("../../tests/testdata/markdown-torture.json", import.meta.url), "utf8"),
+) as { sections: Record<string, string[]> };
+
+describe("MarkdownTortureModel", () => {
+  it("should stream exactly the chunks pinned in testdata", async () => {
+    const expected = Object.values(FIXTURE.sections).flat();
+
+    expect(Object.keys(FIXTURE.sections)).toEqual([...MARKDOWN_TORTURE_SECTIONS]);
+    expect(await getChunks(new MarkdownTortureModel(), "all")).toEqual(expected);
+    expect(await getChunks(new MarkdownTortureModel(), "")).toEqual(expected);
+  });
+
+  it("should include just the sections named in the message, in document order", async () => {
+    const chunks = await getChunks(new MarkdownTortureModel(), "links and a table");
+
+    expect(chunks).toEqual([...MARKDOWN_TORTURE_CHUNKS.tables, ...MARKDOWN_TORTURE_CHUNKS.links]);
+  });
+
+  it("should split constructs across chunks", () => {
+    const { code, tables, emphasis } = MARKDOWN_TORTURE_CHUNKS;
+
+    // The opening fence's backticks straddle chunks, and the closing fence
+    // arrives three chunks later
+    expect(code[0]).toMatch(/``$/);
+    expect(code[1]).toMatch(/^`ts\n/);
+    expect(code[3]).toMatch(/^``\n/);
+    // A table row is cut mid-cell
+    expect(tables[1]).toMatch(/\| mark$/);
+    // A ** pair is split between its stars
+    expect(emphasis[0]).toMatch(/[^*]\*$/);
+    expect(emphasis[1]).toMatch(/^\*[^*]/);
+  });
+});
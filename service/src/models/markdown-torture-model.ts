@@ -0,0 +1,71 @@
+import { Model } from './model.js';
+
+export const MARKDOWN_TORTURE_SECTIONS = ['code', 'tables', 'lists', 'emphasis', 'links'] as const;
+
+export type MarkdownTortureSection = typeof MARKDOWN_TORTURE_SECTIONS[number];
+
+/**
+ * Each section's markdown, as the chunks it streams in. The boundaries are
+ * the point: fences split inside their backticks and closed three chunks
+ * after they open, table rows cut mid-cell, ** pairs split between their
+ * stars, and links cut mid-URL. tests/testdata/markdown-torture.json pins
+ * the same chunks, so changing a byte here means changing it there too.
+ */
+export const MARKDOWN_TORTURE_CHUNKS: Record<MarkdownTortureSection, readonly string[]> = {
+  code: [
+    '## Code\n\nA fence opened in one chunk and closed three chunks later:\n\n``',
+    '`ts\nfunction add(a: number, b: number) {\n',
+    '  return a + b;\n}\n`',
+    '``\n\nInline `code with **stars**` and a tilde fence holding backticks:\n\n~~~\n```\nnot a fence\n',
+    '```\n~~~\n',
+  ],
+  tables: [
+    '## Tables\n\n| Model | Streams | Notes |\n| --- | :---: | --',
+    '-: |\n| echo | yes | plain \\| piped |\n| mark',
+    'down | yes | **bold** cell |\n| csv | no |',
+    ' `a\\|b` |\n\nText straight after a table.\n',
+  ],
+  lists: [
+    '## Lists\n\n1. First\n   - nested **bo',
+    'ld** item\n     - deeper\n',
+    '       1. deepest ordered\n2. Se',
+    'cond\n   > quote inside a list\n\n- [ ] task\n- [x] done\n',
+  ],
+  emphasis: [
+    '## Emphasis\n\nA **bold phrase whose closing stars are split*',
+    '*, an opening pair split *',
+    '*like this**, ***bold italic***, ~~strike~~ and an escaped \\*',
+    '\\* that stays literal.\n',
+  ],
+  links: [
+    '## Links\n\nAn [inline link](https://example.com/a_b',
+    '_c) split mid-URL, a [reference link][ref], an autolink <https://exa',
+    'mple.com> and an image ![alt text](https://example.com/i.png "Ti',
+    'tle").\n\n[ref]: https://example.com/reference\n',
+  ],
+};
+
+/**
+ * Markdown Torture - Streams markdown split where renderers break
+ *
+ * Replies with a fixed document exercising code fences, tables, nested
+ * lists, emphasis and links, streamed in MARKDOWN_TORTURE_CHUNKS so chunk
+ * boundaries fall mid-fence, mid-row and between ** pairs. Naming sections
+ * anywhere in the message ("tables code") selects just those, in document
+ * order; "all", or naming none, sends the whole document. Unlike markdown,
+ * which sends whole elements, this shows whether a renderer copes with
+ * partial ones. Non-streaming replies get the same bytes in one piece.
+ */
+export class MarkdownTortureModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    const words = input.toLowerCase().split(/[^a-z]+/);
+    const requested = MARKDOWN_TORTURE_SECTIONS.filter((section) =>
+      words.some((word) => word === section || `${word}s` === section)
+    );
+    const sections = requested.length > 0 && !words.includes('all') ? requested : MARKDOWN_TORTURE_SECTIONS;
+
+    for (const section of sections) {
+      yield* MARKDOWN_TORTURE_CHUNKS[section];
+    }
+  }
+}
@@ -1,19 +1,30 @@
-import { Model } from './model.js';
+import { Model, ModelCapabilities } from './model.js';
 
 // Protocol-agnostic model registry
 export class ModelRegistry {
   private models = new Map<string, Model>();
-  private metadata = new Map<string, { created: number }>();
+  private metadata = new Map<
+    string,
+    { created: number; ownedBy: string | undefined; supportsStreaming: boolean; deterministic: boolean }
+  >();
 
   constructor(private ownedBy: string = 'teenytiny-ai') {}
 
-  register(id: string, model: Model): void {
+  register(id: string, model: Model, capabilities: ModelCapabilities = {}): void {
     this.models.set(id, model);
     this.metadata.set(id, {
       created: Math.floor(Date.now() / 1000),
+      ownedBy: capabilities.ownedBy,
+      supportsStreaming: capabilities.supportsStreaming ?? true,
+      deterministic: capabilities.deterministic ?? true,
     });
   }
 
+  unregister(id: string): void {
+    this.models.delete(id);
+    this.metadata.delete(id);
+  }
+
   get(id: string): Model | undefined {
     return this.models.get(id);
   }
@@ -26,13 +37,17 @@ export class ModelRegistry {
     return Array.from(this.models.keys());
   }
 
-  getMetadata(id: string): { created: number; ownedBy: string } | undefined {
+  getMetadata(
+    id: string
+  ): { created: number; ownedBy: string; supportsStreaming: boolean; deterministic: boolean } | undefined {
     const meta = this.metadata.get(id);
     if (!meta) return undefined;
     
     return {
       created: meta.created,
-      ownedBy: this.ownedBy,
+      ownedBy: meta.ownedBy ?? this.ownedBy,
+      supportsStreaming: meta.supportsStreaming,
+      deterministic: meta.deterministic,
     };
   }
 }
\ No newline at end of file
@@ -1,4 +1,118 @@
+import type { RequestTimer } from '../utils/request-timer.js';
+
+// A single conversation turn, independent of any wire protocol
+export interface ModelMessage {
+  role: string;
+  content: string;
+}
+
+// A function the caller has made available for the model to call
+export interface ModelTool {
+  name: string;
+  description?: string;
+  parameters?: Record<string, unknown>;
+}
+
+// A function call requested by the model, with JSON-encoded arguments
+export interface ModelToolCall {
+  name: string;
+  arguments: string;
+  // Streams the arguments in these pieces, which must join up to arguments,
+  // instead of in one delta
+  argumentChunks?: string[] | undefined;
+}
+
+// A source cited for part of the output; indices count Unicode code points
+// in the final (trimmed) output, with the end exclusive
+export interface ModelCitation {
+  url: string;
+  title: string;
+  startIndex: number;
+  endIndex: number;
+}
+
+// Why the model stopped, mirroring the values clients switch on
+export type ModelFinishReason = 'stop' | 'length' | 'tool_calls' | 'content_filter' | 'function_call';
+
+// Per-request context passed alongside the input text. Models that only care
+// about the latest user message can ignore it; models that need the whole
+// conversation or tools read from it, and report tool calls back through it.
+export interface ModelContext {
+  messages: ModelMessage[];
+  tools: ModelTool[];
+  toolCalls: ModelToolCall[];
+  // URLs of the image_url parts of the last user message, in order: http(s)
+  // links or data: URIs
+  images?: string[] | undefined;
+  // Every system message's content, in order and joined with blank lines as
+  // OpenAI combines them; undefined without system messages
+  system?: string | undefined;
+  // Output format the caller asked for, e.g. 'json_object'; models that can
+  // produce structured output may honour it, others ignore it
+  responseFormat?: string | undefined;
+  // The request's seed; models with random output should give the same
+  // output for the same seed and input
+  seed?: number | undefined;
+  // Fires when the client goes away; long-running models should stop early
+  signal?: AbortSignal | undefined;
+  // Override the estimated prompt and completion token counts when set
+  promptTokens?: number | undefined;
+  completionTokens?: number | undefined;
+  // Start of the reply, from a trailing assistant message. The model
+  // continues it: its output is sent as what follows the prefill, without
+  // repeating it
+  prefill?: string | undefined;
+  // Set by models that decline to answer; sent as a refusal instead of content
+  refusal?: string | undefined;
+  // Sources cited for spans of the output
+  citations?: ModelCitation[] | undefined;
+  // Overrides the finish reason otherwise derived from the output
+  finishReason?: ModelFinishReason | undefined;
+  // Extra HTTP response headers requested by the model
+  responseHeaders?: Record<string, string> | undefined;
+  // Unusual SSE framings to stream with (see SSE_VARIANTS in openai-protocol)
+  sseVariants?: string[] | undefined;
+  // Server-side timings of the request so far, when the server records them
+  timing?: RequestTimer | undefined;
+  // The request's Idempotency-Key header, which retries of it repeat
+  idempotencyKey?: string | undefined;
+  // The request's HTTP headers, with credentials masked (see
+  // maskRequestHeaders)
+  requestHeaders?: Record<string, string> | undefined;
+  // Which of the request's n choices this run produces, counting from 0
+  choiceIndex?: number | undefined;
+}
+
+export function createModelContext(
+  messages: ModelMessage[] = [],
+  tools: ModelTool[] = [],
+): ModelContext {
+  return { messages, tools, toolCalls: [] };
+}
+
+// What a model can do beyond producing text; omitted fields default to yes
+export interface ModelCapabilities {
+  // Whether the model may be asked for a streamed response
+  supportsStreaming?: boolean | undefined;
+  // Whether identical requests always get identical output, making cached
+  // responses safe to serve
+  deterministic?: boolean | undefined;
+  // Reported as owned_by in /v1/models instead of the registry's owner
+  ownedBy?: string | undefined;
+  // Whether a conversation ending in an assistant message is continued from
+  // it (see ModelContext.prefill); models that opt out answer the latest user
+  // message as if the assistant message weren't there
+  supportsPrefill?: boolean | undefined;
+}
+
 // Simple text-based model interface
 export interface Model {
-  process(input: string): AsyncGenerator<string>;
-}
\ No newline at end of file
+  process(input: string, context?: ModelContext): AsyncGenerator<string>;
+  // Implemented by models that depend on something outside the process,
+  // such as a command, so it's checked in the background rather than by the
+  // first request; rejects while the dependency is unusable
+  checkHealth?(signal: AbortSignal): Promise<void>;
+  // Implemented by models that need to start up before serving, e.g. to load
+  // data; the server binds its listeners only once every init has resolved
+  init?(): Promise<void>;
+}
@@ -0,0 +1,39 @@
+import { describe, it, expect } from "vitest";
+import { NormalizeModel } from "./normalize-model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+// "café ﬁle" with a decomposed é (e + U+0301) and the U+FB01 "ﬁ" ligature
+const INPUT = "café ﬁle";
+
+describe("NormalizeModel", () => {
+  it("should compose characters by default (NFC)", async () => {
+    const response = await getResponse(new NormalizeModel(), INPUT);
+
+    expect(response).toBe("café ﬁle");
+  });
+
+  it("should decompose characters with NFD", async () => {
+    const response = await getResponse(new NormalizeModel("NFD"), "café");
+
+    expect(response).toBe("café");
+    expect(response).toHaveLength(5);
+  });
+
+  it("should compose and fold compatibility characters with NFKC", async () => {
+    const response = await getResponse(new NormalizeModel("NFKC"), INPUT);
+
+    expect(response).toBe("café file");
+  });
+
+  it("should decompose and fold compatibility characters with NFKD", async () => {
+    const response = await getResponse(new NormalizeModel("NFKD"), INPUT);
+
+    expect(response).toBe("café file");
+  });
+
+  it("should return default message for empty input", async () => {
+    const response = await getResponse(new NormalizeModel("NFD"), "");
+
+    expect(response).toContain("echo it back in NFD");
+  });
+});
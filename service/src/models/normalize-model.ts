@@ -0,0 +1,26 @@
+import { Model } from './model.js';
+
+export type NormalizationForm = 'NFC' | 'NFD' | 'NFKC' | 'NFKD';
+
+export const NORMALIZATION_FORMS: NormalizationForm[] = ['NFC', 'NFD', 'NFKC', 'NFKD'];
+
+/**
+ * Normalize - Echoes messages in a chosen Unicode normalization form
+ *
+ * Useful for checking that clients cope with composed ("é" as one code
+ * point, NFC) and decomposed ("e" + combining accent, NFD) text, and with
+ * compatibility folding (NFKC/NFKD turn "ﬁ" into "fi"). Usage is estimated
+ * from the normalized reply, so it changes with the form.
+ */
+export class NormalizeModel implements Model {
+  constructor(private form: NormalizationForm = 'NFC') {}
+
+  async *process(input: string): AsyncGenerator<string> {
+    if (!input) {
+      yield `Hello! I'm the Normalize model. Send me a message and I'll echo it back in ${this.form}.`;
+      return;
+    }
+
+    yield input.normalize(this.form);
+  }
+}
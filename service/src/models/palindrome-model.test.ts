@@ -0,0 +1,83 @@
+import { describe, it, expect } from "vitest";
+import { PalindromeModel, isPalindrome, normalizeForPalindrome } from "./palindrome-model.js";
+import { createModelContext } from "./model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+describe("PalindromeModel", () => {
+  it("should confirm a palindrome in a fixed sentence", async () => {
+    const model = new PalindromeModel();
+
+    const chunks = await getChunks(model, "A man, a plan, a canal: Panama!");
+
+    expect(chunks).toEqual(["Yes, 'A man, a plan, a canal: Panama!' is a palindrome."]);
+  });
+
+  it("should reject a non-palindrome in a fixed sentence", async () => {
+    const model = new PalindromeModel();
+
+    const response = await getResponse(model, "Hello");
+
+    expect(response).toBe("No, 'Hello' is not a palindrome.");
+  });
+
+  it("should return default message for empty input", async () => {
+    const model = new PalindromeModel();
+
+    const response = await getResponse(model, "");
+
+    expect(response).toContain("I'm the Palindrome model");
+  });
+
+  it("should reply with JSON when asked for a json_object", async () => {
+    const model = new PalindromeModel();
+    const context = createModelContext();
+    context.responseFormat = "json_object";
+
+    const response = await getResponse(model, "Never odd or even", context);
+
+    expect(JSON.parse(response)).toEqual({ palindrome: true, normalized: "neveroddoreven" });
+  });
+
+  it("should not crash on lone combining characters", async () => {
+    const model = new PalindromeModel();
+
+    const response = await getResponse(model, "\u0301\u0308");
+
+    expect(response).toBe("No, '\u0301\u0308' is not a palindrome.");
+  });
+});
+
+describe("normalizeForPalindrome", () => {
+  it("should drop case, spaces and punctuation", () => {
+    expect(normalizeForPalindrome("Was it a car, or a cat I saw?")).toBe("wasitacaroracatisaw");
+  });
+
+  it("should strip accents whether composed or decomposed", () => {
+    expect(normalizeForPalindrome("été")).toBe("ete");
+    expect(normalizeForPalindrome("e\u0301te\u0301")).toBe("ete"); // decomposed
+  });
+
+  it("should fold compatibility forms such as full-width letters", () => {
+    expect(normalizeForPalindrome("ＡｂＡ")).toBe("aba");
+  });
+
+  it("should keep digits and non-latin letters", () => {
+    expect(normalizeForPalindrome("12-21")).toBe("1221");
+    expect(normalizeForPalindrome("Straße")).toBe("straße");
+  });
+
+  it("should reduce text with no letters or digits to an empty string", () => {
+    expect(normalizeForPalindrome("\u0301 !? \u{1F600}")).toBe("");
+  });
+});
+
+describe("isPalindrome", () => {
+  it("should compare astral characters as whole code points", () => {
+    expect(isPalindrome("\u{10428}a\u{10428}")).toBe(true);
+    expect(isPalindrome("\u{10428}a\u{10429}")).toBe(false);
+  });
+
+  it("should not treat an empty string as a palindrome", () => {
+    expect(isPalindrome("")).toBe(false);
+  });
+});
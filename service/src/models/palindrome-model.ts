@@ -0,0 +1,56 @@
+import { Model, ModelContext } from './model.js';
+
+/**
+ * Palindrome - Deterministic yes/no answers for client assertions
+ *
+ * Says whether the latest user message reads the same backwards, ignoring
+ * case, spacing, punctuation and accents, always in the same sentence form:
+ *
+ *   Yes, 'Never odd or even' is a palindrome.
+ *   No, 'Hello' is not a palindrome.
+ *
+ * With `response_format: {type: 'json_object'}` it replies with
+ * {"palindrome": true, "normalized": "neveroddoreven"} instead.
+ */
+export class PalindromeModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const text = input.trim();
+    const normalized = normalizeForPalindrome(text);
+    const palindrome = isPalindrome(normalized);
+
+    if (context?.responseFormat === 'json_object') {
+      yield JSON.stringify({ palindrome, normalized });
+      return;
+    }
+
+    if (!text) {
+      yield "Hello! I'm the Palindrome model. Send me a phrase and I'll tell you whether it's a palindrome.";
+      return;
+    }
+
+    yield palindrome ? `Yes, '${text}' is a palindrome.` : `No, '${text}' is not a palindrome.`;
+  }
+}
+
+/**
+ * Reduces text to the characters that matter for a palindrome check: letters
+ * and digits, lower-cased, with accents and other combining marks removed.
+ * Compatibility decomposition (NFKD) first splits "é" into "e" + accent and
+ * folds look-alikes such as full-width letters into their plain forms.
+ */
+export function normalizeForPalindrome(text: string): string {
+  return text
+    .normalize('NFKD')
+    .replace(/\p{M}/gu, '')
+    .toLowerCase()
+    .replace(/[^\p{L}\p{N}]/gu, '');
+}
+
+// Compares by code point so astral characters aren't split into halves
+export function isPalindrome(normalized: string): boolean {
+  if (!normalized) {
+    return false;
+  }
+  const chars = Array.from(normalized);
+  return chars.join('') === chars.reverse().join('');
+}
@@ -0,0 +1,33 @@
+import { describe, it, expect } from "vitest";
+import { RedactorModel } from "./redactor-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("RedactorModel", () => {
+  it("should mask each kind of match and count them by type", async () => {
+    const reply = await getResponse(
+      new RedactorModel(),
+      "Mail ana@example.com or bo@example.org, call +1 (555) 123-4567 from 10.0.0.12",
+    );
+
+    expect(reply).toBe(
+      "Mail [EMAIL] or [EMAIL], call [PHONE] from [IPV4]\n\nRedactions: EMAIL 2, PHONE 1, IPV4 1",
+    );
+  });
+
+  it("should say when there was nothing to redact", async () => {
+    expect(await getResponse(new RedactorModel(), "Nothing to see")).toBe("Nothing to see\n\nRedactions: none");
+  });
+
+  it("should list spans with code point offsets in json_object mode", async () => {
+    const context = createModelContext();
+    context.responseFormat = "json_object";
+    const reply = await getResponse(new RedactorModel(), "Café ☕ card 4111-1111-1111-1111", context);
+
+    expect(JSON.parse(reply)).toEqual({
+      text: "Café ☕ card [CREDIT_CARD]",
+      redactions: [{ type: "CREDIT_CARD", start: 12, end: 31 }],
+      counts: { CREDIT_CARD: 1 },
+    });
+  });
+});
@@ -0,0 +1,34 @@
+import { Model, ModelContext } from './model.js';
+import { redactPII } from '../utils/pii.js';
+import type { PIIType } from '../utils/pii.js';
+
+/**
+ * Redactor - Echoes the input with personal data masked
+ *
+ * Replaces email addresses, phone numbers, credit-card-like digit runs and
+ * IPv4 addresses with `[EMAIL]`, `[PHONE]`, `[CREDIT_CARD]` and `[IPV4]`,
+ * then adds a line counting the redactions by type. With
+ * `response_format: {type: 'json_object'}` it replies with
+ * {"text", "redactions", "counts"} instead, where each redaction gives the
+ * type and code point offsets of what it replaced in the input.
+ */
+export class RedactorModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const text = input || "Hello! I'm the Redactor model. Send me a message with an email address or phone number and I'll mask it.";
+    const { text: redacted, spans } = redactPII(text);
+
+    const counts: Partial<Record<PIIType, number>> = {};
+    for (const span of spans) {
+      counts[span.type] = (counts[span.type] ?? 0) + 1;
+    }
+
+    if (context?.responseFormat === 'json_object') {
+      yield JSON.stringify({ text: redacted, redactions: spans, counts });
+      return;
+    }
+
+    yield redacted;
+    const summary = Object.entries(counts).map(([type, count]) => `${type} ${count}`);
+    yield `\n\nRedactions: ${summary.length > 0 ? summary.join(', ') : 'none'}`;
+  }
+}
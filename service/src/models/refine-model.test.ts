@@ -0,0 +1,27 @@
+import { describe, it, expect } from "vitest";
+import { finalRevision, RefineModel, REVISION_MARKER } from "./refine-model.js";
+import { getChunks } from "../../tests/test-helpers.js";
+
+describe("RefineModel", () => {
+  it("should stream a draft, the revision marker, then the revised answer", async () => {
+    const chunks = await getChunks(new RefineModel(), "The quick brown fox jumps");
+
+    expect(chunks).toEqual([
+      "The ", "quick ", "brown", "…",
+      REVISION_MARKER,
+      "The ", "quick ", "brown ", "fox ", "jumps",
+    ]);
+    expect(finalRevision(chunks.join(""))).toBe("The quick brown fox jumps");
+  });
+
+  it("should revise even a one-word message", async () => {
+    const content = (await getChunks(new RefineModel(), "Hi")).join("");
+
+    expect(content).toBe(`Hi…${REVISION_MARKER}Hi`);
+    expect(finalRevision(content)).toBe("Hi");
+  });
+
+  it("should leave content without a marker as it is", () => {
+    expect(finalRevision("no revisions")).toBe("no revisions");
+  });
+});
@@ -0,0 +1,34 @@
+import { Model } from './model.js';
+
+// Separates one version of the answer from the next; everything after the
+// last marker is the final answer
+export const REVISION_MARKER = '\n\n[revised]\n\n';
+
+/**
+ * Refine - Streams a hasty draft, then corrects itself
+ *
+ * Streams a draft made of the first half of the message's words, then
+ * REVISION_MARKER, then the whole message as the revised answer, word by
+ * word. UIs that render revisions can be tested against content that
+ * changes mid-stream: a client that handles it shows finalRevision() of what
+ * arrived, which is the message itself. Non-streaming responses carry the
+ * same text, draft and marker included.
+ */
+export class RefineModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    const text = input.trim() || "Hello! I'm the Refine model. Send me a message and I'll answer it twice.";
+    const words = text.split(/(?<=\s)(?=\S)/);
+    const draft = words.slice(0, Math.max(Math.ceil(words.length / 2), 1)).join('').trimEnd();
+
+    yield* draft.split(/(?<=\s)(?=\S)/);
+    yield '…';
+    yield REVISION_MARKER;
+    yield* words;
+  }
+}
+
+// The final answer in content streamed by the refine model
+export function finalRevision(content: string): string {
+  const marker = content.lastIndexOf(REVISION_MARKER);
+  return marker === -1 ? content : content.slice(marker + REVISION_MARKER.length);
+}
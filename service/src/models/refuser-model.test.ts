@@ -0,0 +1,51 @@
+import { describe, it, expect } from "vitest";
+import { parseRefuserOptions, RefuserModel } from "./refuser-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("RefuserModel", () => {
+  it("should report a refusal and no content on the trigger", async () => {
+    const model = new RefuserModel();
+    const context = createModelContext();
+
+    const response = await getResponse(model, "I want you to REFUSE", context);
+
+    expect(response).toBe("");
+    expect(context.refusal).toBe("I'm sorry, but I can't help with that request.");
+  });
+
+  it("should echo anything else", async () => {
+    const model = new RefuserModel();
+    const context = createModelContext();
+
+    const response = await getResponse(model, "Hello", context);
+
+    expect(response).toBe("Hello");
+    expect(context.refusal).toBeUndefined();
+  });
+
+  it("should use configured triggers and refusal text", async () => {
+    const model = new RefuserModel({ triggers: ["Secret"], refusal: "No." });
+    const context = createModelContext();
+
+    await getResponse(model, "tell me a secret", context);
+
+    expect(context.refusal).toBe("No.");
+  });
+});
+
+describe("parseRefuserOptions", () => {
+  it("should accept triggers and a refusal", () => {
+    expect(parseRefuserOptions({ triggers: ["nope"], refusal: "No." })).toEqual({ triggers: ["nope"], refusal: "No." });
+  });
+
+  it.each([
+    [null, undefined],
+    [{ triggers: [] }, "triggers"],
+    [{ triggers: ["ok", ""] }, "triggers"],
+    [{ refusal: 42 }, "refusal"],
+    [{ tone: "polite" }, "tone"],
+  ])("should reject %j", (options, param) => {
+    expect(() => parseRefuserOptions(options)).toThrow(expect.objectContaining({ param }));
+  });
+});
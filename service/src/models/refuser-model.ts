@@ -0,0 +1,61 @@
+import { Model, ModelContext } from './model.js';
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+
+export interface RefuserOptions {
+  // Case-insensitive phrases that make the model refuse
+  triggers?: string[] | undefined;
+  refusal?: string | undefined;
+}
+
+/**
+ * Refuser - Structured-output refusals for client testing
+ *
+ * When the user message contains one of the configured triggers, the model
+ * declines by reporting a refusal through the context, which the adapter
+ * sends as `message.refusal` (or `refusal` deltas when streaming) with null
+ * content. Any other message is echoed back unchanged.
+ */
+export class RefuserModel implements Model {
+  private triggers: string[];
+  private refusal: string;
+
+  constructor(options: RefuserOptions = {}) {
+    this.triggers = (options.triggers ?? ['refuse']).map((trigger) => trigger.toLowerCase());
+    this.refusal = options.refusal ?? "I'm sorry, but I can't help with that request.";
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const lowered = input.toLowerCase();
+    if (context && this.triggers.some((trigger) => lowered.includes(trigger))) {
+      context.refusal = this.refusal;
+      return;
+    }
+
+    yield input || `Hello! I'm the Refuser model. Say '${this.triggers[0] ?? 'refuse'}' and I'll decline to answer.`;
+  }
+}
+
+// Validates options sent to /admin/models/refuser/config
+export function parseRefuserOptions(value: unknown): RefuserOptions {
+  if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+    throw new InvalidRequestError('Refuser options must be an object');
+  }
+  const { triggers, refusal, ...rest } = value as Record<string, unknown>;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown refuser option: ${unknownKey}`, unknownKey);
+  }
+
+  if (
+    triggers !== undefined &&
+    !(Array.isArray(triggers) && triggers.length > 0 && triggers.every((trigger) => typeof trigger === 'string' && trigger !== ''))
+  ) {
+    throw new InvalidRequestError('triggers must be a non-empty array of non-empty strings', 'triggers');
+  }
+  if (refusal !== undefined && (typeof refusal !== 'string' || refusal === '')) {
+    throw new InvalidRequestError('refusal must be a non-empty string', 'refusal');
+  }
+
+  return { triggers: triggers as string[] | undefined, refusal: refusal as string | undefined };
+}
@@ -0,0 +1,47 @@
+import { describe, it, expect } from "vitest";
+import { maskRequestHeaders, RequestHeadersModel } from "./request-headers-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("maskRequestHeaders", () => {
+  it("should lowercase names and mask credentials", () => {
+    const headers = new Headers({
+      "Authorization": "Bearer tt-1234567890abcdef",
+      "Proxy-Authorization": "Basic dXNlcjpwYXNz",
+      "X-Forwarded-For": "10.0.0.1",
+    });
+
+    expect(maskRequestHeaders(headers)).toEqual({
+      "authorization": "Bearer tt-123***",
+      "proxy-authorization": "Basic dXNlcj***",
+      "x-forwarded-for": "10.0.0.1",
+    });
+  });
+
+  it("should mask credentials without a scheme whole", () => {
+    expect(maskRequestHeaders(new Headers({ Authorization: "tt-1234567890" }))).toEqual({
+      authorization: "tt-123***",
+    });
+  });
+
+  it("should mask cookies as credentials", () => {
+    expect(maskRequestHeaders(new Headers({ Cookie: "session=abcdef; theme=dark" }))).toEqual({
+      cookie: "sessio***",
+    });
+  });
+});
+
+describe("RequestHeadersModel", () => {
+  it("should reply with the request headers as JSON", async () => {
+    const context = createModelContext();
+    context.requestHeaders = { "authorization": "Bearer tt-123***", "x-debug": "yes" };
+
+    const reply = await getResponse(new RequestHeadersModel(), "ignored", context);
+
+    expect(JSON.parse(reply)).toEqual({ "authorization": "Bearer tt-123***", "x-debug": "yes" });
+  });
+
+  it("should reply with an empty object without request headers", async () => {
+    expect(JSON.parse(await getResponse(new RequestHeadersModel(), "hi"))).toEqual({});
+  });
+});
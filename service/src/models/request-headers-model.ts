@@ -0,0 +1,41 @@
+import { Model, ModelContext } from './model.js';
+import { maskAPIKey } from '../utils/audit-log.js';
+import { CREDENTIAL_HEADERS } from '../utils/credential-headers.js';
+
+/**
+ * The request's headers as models see them: names lowercased and sorted,
+ * repeated headers joined with commas, and credentials masked
+ */
+export function maskRequestHeaders(headers: Headers): Record<string, string> {
+  const masked: Record<string, string> = {};
+  headers.forEach((value, name) => {
+    masked[name] = CREDENTIAL_HEADERS.includes(name) ? maskCredential(name, value) : value;
+  });
+  return masked;
+}
+
+// Only the scheme and the start of a credential are shown: "Bearer
+// tt-1234567890" becomes "Bearer tt-123***". Cookies have no scheme, and
+// splitting one on its spaces would show the first cookie whole.
+function maskCredential(name: string, value: string): string {
+  if (name.endsWith('cookie')) {
+    return maskAPIKey(value);
+  }
+  const separator = value.indexOf(' ');
+  return separator === -1
+    ? maskAPIKey(value)
+    : `${value.slice(0, separator)} ${maskAPIKey(value.slice(separator + 1).trim())}`;
+}
+
+/**
+ * Request Headers - Replies with the headers that reached the server
+ *
+ * For debugging proxies that strip, add or rewrite headers on the way in.
+ * The reply is a JSON object of the request's headers, with credentials and
+ * cookies masked; the message itself is ignored.
+ */
+export class RequestHeadersModel implements Model {
+  async *process(_input: string, context?: ModelContext): AsyncGenerator<string> {
+    yield JSON.stringify(context?.requestHeaders ?? {}, null, 2);
+  }
+}
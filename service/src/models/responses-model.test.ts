@@ -0,0 +1,38 @@
+import { describe, it, expect } from "vitest";
+import { ResponsesModel, parseResponseMap } from "./responses-model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+import { InvalidRequestError } from "../openai-protocol/errors.js";
+
+describe("ResponsesModel", () => {
+  const responses = parseResponseMap({ "What is 2+2?": "4", "Say hi": "Hi!" });
+
+  it("should reply with the response mapped to an exact prompt", async () => {
+    const model = new ResponsesModel(responses);
+
+    expect(await getResponse(model, "What is 2+2?")).toBe("4");
+    expect(await getResponse(model, "Say hi")).toBe("Hi!");
+  });
+
+  it("should echo prompts that don't match exactly", async () => {
+    const model = new ResponsesModel(responses);
+
+    expect(await getResponse(model, "what is 2+2?")).toBe("what is 2+2?");
+    expect(await getResponse(model, "Say hi ")).toBe("Say hi ");
+  });
+
+  it("should reject misses with the error fallback", async () => {
+    const model = new ResponsesModel(responses, "error");
+
+    await expect(getResponse(model, "Say hello")).rejects.toThrow(InvalidRequestError);
+    await expect(getResponse(model, "Say hello")).rejects.toThrow("2 prompts");
+    expect(await getResponse(model, "Say hi")).toBe("Hi!");
+  });
+});
+
+describe("parseResponseMap", () => {
+  it("should reject anything but an object of non-empty strings", () => {
+    expect(() => parseResponseMap([["a", "b"]])).toThrow("mapping prompts to responses");
+    expect(() => parseResponseMap({ a: 1 })).toThrow('The response to "a"');
+    expect(() => parseResponseMap({ a: "" })).toThrow("non-empty string");
+  });
+});
@@ -0,0 +1,63 @@
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+import { EchoModel } from './echo-model.js';
+import { Model, ModelContext } from './model.js';
+
+// What the responses model does with a prompt missing from its map
+export const RESPONSE_MAP_FALLBACKS = ['echo', 'error'] as const;
+
+export type ResponseMapFallback = typeof RESPONSE_MAP_FALLBACKS[number];
+
+// Exact prompts and the replies the responses model gives them
+export type ResponseMap = Map<string, string>;
+
+/**
+ * Responses - Answers exact prompts with fixed replies, for golden tests
+ *
+ * Looks the latest user message up in a prompt-to-response map, loaded
+ * with --responses, and replies with the mapped response when it matches
+ * exactly, whitespace and case included. Other prompts are echoed, or
+ * rejected as invalid requests with the 'error' fallback.
+ */
+export class ResponsesModel implements Model {
+  private readonly echo = new EchoModel();
+
+  constructor(
+    private readonly responses: ResponseMap = new Map(),
+    private readonly fallback: ResponseMapFallback = 'echo'
+  ) {}
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const response = this.responses.get(input);
+    if (response !== undefined) {
+      yield response;
+      return;
+    }
+
+    if (this.fallback === 'error') {
+      throw new InvalidRequestError(
+        `No response is mapped to this prompt (${this.responses.size} prompts are)`,
+        'messages'
+      );
+    }
+    yield* this.echo.process(input, context);
+  }
+}
+
+/**
+ * Validates a --responses file: an object mapping each prompt to its
+ * response, e.g. {"What is 2+2?": "4"}.
+ */
+export function parseResponseMap(value: unknown): ResponseMap {
+  if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+    throw new InvalidRequestError('Responses must be an object mapping prompts to responses');
+  }
+
+  const responses: ResponseMap = new Map();
+  for (const [prompt, response] of Object.entries(value)) {
+    if (typeof response !== 'string' || response === '') {
+      throw new InvalidRequestError(`The response to ${JSON.stringify(prompt)} must be a non-empty string`, prompt);
+    }
+    responses.set(prompt, response);
+  }
+  return responses;
+}
@@ -0,0 +1,17 @@
+import { describe, it, expect } from "vitest";
+import { ReverseModel, reverse } from "./reverse-model.js";
+
+describe("ReverseModel", () => {
+  it("should reply with the message backwards", async () => {
+    const chunks: string[] = [];
+    for await (const chunk of new ReverseModel().process("Hello, world!")) {
+      chunks.push(chunk);
+    }
+
+    expect(chunks).toEqual(["!dlrow ,olleH"]);
+  });
+
+  it("should keep emoji and accented letters whole", () => {
+    expect(reverse("ae\u0301 👍🏽!")).toBe("!👍🏽 e\u0301a");
+  });
+});
@@ -0,0 +1,24 @@
+import { Model } from './model.js';
+
+/**
+ * Reverse - The latest user message backwards
+ *
+ * Replies with the message's characters in reverse order, keeping each
+ * user-perceived character (an emoji, or a letter with its accents) whole,
+ * so "Hello, world!" comes back as "!dlrow ,olleH". Useful wherever a test
+ * needs output that's predictable but plainly not an echo.
+ */
+export class ReverseModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    if (!input) {
+      yield "Hello! I'm the Reverse model. Send me a message and I'll reply with it backwards.";
+      return;
+    }
+    yield reverse(input);
+  }
+}
+
+export function reverse(text: string): string {
+  const graphemes = Array.from(new Intl.Segmenter(undefined, { granularity: 'grapheme' }).segment(text), (s) => s.segment);
+  return graphemes.reverse().join('');
+}
@@ -0,0 +1,78 @@
+import { describe, it, expect } from "vitest";
+import { ShuffleModel, shuffle } from "./shuffle-model.js";
+import { seededRandom } from "../utils/random.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+const sentence = "the quick brown fox jumps over the lazy dog";
+
+function seeded(seed: number) {
+  const context = createModelContext();
+  context.seed = seed;
+  return context;
+}
+
+describe("ShuffleModel", () => {
+  it("should keep every word exactly once", async () => {
+    const model = new ShuffleModel();
+
+    const response = await getResponse(model, sentence);
+
+    expect(response.split(" ").sort()).toEqual(sentence.split(" ").sort());
+  });
+
+  it("should give the same order for the same seed", async () => {
+    const model = new ShuffleModel();
+
+    const first = await getResponse(model, sentence, seeded(42));
+    const second = await getResponse(model, sentence, seeded(42));
+
+    expect(second).toBe(first);
+    expect(first.split(" ").sort()).toEqual(sentence.split(" ").sort());
+  });
+
+  it("should give different orders for different seeds", async () => {
+    const model = new ShuffleModel();
+
+    const orders = new Set<string>();
+    for (let seed = 0; seed < 10; seed++) {
+      orders.add(await getResponse(model, sentence, seeded(seed)));
+    }
+
+    expect(orders.size).toBeGreaterThan(1);
+  });
+
+  it("should use its random source when no seed is given", async () => {
+    const model = new ShuffleModel(() => 0);
+
+    const response = await getResponse(model, "one two three");
+
+    expect(response).toBe("two three one");
+  });
+
+  it("should collapse whitespace between words", async () => {
+    const model = new ShuffleModel(() => 0.999);
+
+    const response = await getResponse(model, "  one\ttwo\n three ");
+
+    expect(response).toBe("one two three");
+  });
+
+  it("should return default message for empty input", async () => {
+    const model = new ShuffleModel();
+
+    const response = await getResponse(model, " ");
+
+    expect(response).toContain("I'm the Shuffle model");
+  });
+});
+
+describe("shuffle", () => {
+  it("should not modify its input", () => {
+    const items = [1, 2, 3, 4];
+
+    shuffle(items, seededRandom(7));
+
+    expect(items).toEqual([1, 2, 3, 4]);
+  });
+});
@@ -0,0 +1,37 @@
+import { Model, ModelContext } from './model.js';
+import { seededRandom } from '../utils/random.js';
+
+/**
+ * Shuffle - Random word order for testing non-determinism handling
+ *
+ * Replies with the words of the latest user message in a random order, so
+ * clients and tests that wrongly assume identical requests get identical
+ * replies fail quickly. Every word is kept exactly once.
+ *
+ * With a `seed` in the request the order is reproducible: the same seed and
+ * message always give the same shuffle.
+ */
+export class ShuffleModel implements Model {
+  constructor(private random: () => number = Math.random) {}
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const words = input.split(/\s+/).filter((word) => word !== '');
+    if (words.length === 0) {
+      yield "Hello! I'm the Shuffle model. Send me a sentence and I'll reply with its words in a random order.";
+      return;
+    }
+
+    const random = context?.seed === undefined ? this.random : seededRandom(context.seed);
+    yield shuffle(words, random).join(' ');
+  }
+}
+
+// Fisher-Yates shuffle of a copy
+export function shuffle<T>(items: T[], random: () => number): T[] {
+  const shuffled = [...items];
+  for (let i = shuffled.length - 1; i > 0; i--) {
+    const j = Math.floor(random() * (i + 1));
+    [shuffled[i], shuffled[j]] = [shuffled[j]!, shuffled[i]!];
+  }
+  return shuffled;
+}
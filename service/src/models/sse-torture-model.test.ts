@@ -0,0 +1,35 @@
+import { describe, it, expect } from "vitest";
+import { SSETortureModel } from "./sse-torture-model.js";
+import { createModelContext } from "./model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+import { SSE_VARIANTS } from "../openai-protocol/sse.js";
+
+describe("SSETortureModel", () => {
+  it("should stream the message back a word at a time", async () => {
+    const chunks = await getChunks(new SSETortureModel(), "crlf and more");
+
+    expect(chunks).toEqual(["crlf ", "and ", "more"]);
+  });
+
+  it("should request the variants named in the message", async () => {
+    const context = createModelContext();
+
+    await getResponse(new SSETortureModel(), "Try CRLF, then multiline; crlf again", context);
+
+    expect(context.sseVariants).toEqual(["crlf", "multiline"]);
+  });
+
+  it("should request every variant when none are named", async () => {
+    const context = createModelContext();
+
+    await getResponse(new SSETortureModel(), "Hello there", context);
+
+    expect(context.sseVariants).toEqual([...SSE_VARIANTS]);
+  });
+
+  it("should return default message for empty input", async () => {
+    const response = await getResponse(new SSETortureModel(), "");
+
+    expect(response).toContain("I'm the SSE Torture model");
+  });
+});
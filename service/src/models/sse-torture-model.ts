@@ -0,0 +1,34 @@
+import { Model, ModelContext } from './model.js';
+import { isSSEVariant, SSE_VARIANTS } from '../openai-protocol/sse.js';
+
+/**
+ * SSE Torture - Echoes over pathological but spec-legal SSE framing
+ *
+ * Streams the user message back a word at a time while asking the server to
+ * frame the events unusually: CRLF or lone-CR line endings, data split over
+ * several lines, comment lines, extra fields, a missing optional space,
+ * events split into tiny writes, or a leading byte order mark. Naming
+ * variants anywhere in the message ("crlf multiline") selects just those,
+ * rotating between them event by event; otherwise all of them rotate. The
+ * reassembled content is always exactly the message.
+ */
+export class SSETortureModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    if (!input) {
+      yield `Hello! I'm the SSE Torture model. Name any of ${SSE_VARIANTS.join(', ')} and I'll stream your message back framed that way.`;
+      return;
+    }
+
+    if (context) {
+      const requested = input
+        .toLowerCase()
+        .split(/[^a-z]+/)
+        .filter(isSSEVariant);
+      context.sseVariants = requested.length > 0 ? [...new Set(requested)] : [...SSE_VARIANTS];
+    }
+
+    for (const word of input.split(/(?<= )/)) {
+      yield word;
+    }
+  }
+}
@@ -0,0 +1,17 @@
+import { describe, it, expect } from "vitest";
+import { SystemEchoModel } from "./system-echo-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("SystemEchoModel", () => {
+  it("should reply with the combined system prompt", async () => {
+    const context = createModelContext();
+    context.system = "Be brief.\n\nAnswer in French.";
+
+    expect(await getResponse(new SystemEchoModel(), "Hi", context)).toBe("Be brief.\n\nAnswer in French.");
+  });
+
+  it("should say hello without a system prompt", async () => {
+    expect(await getResponse(new SystemEchoModel(), "Hi")).toContain("System Echo model");
+  });
+});
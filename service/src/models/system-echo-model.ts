@@ -0,0 +1,14 @@
+import { Model, ModelContext } from './model.js';
+
+/**
+ * System Echo - Replies with the system prompt it was given
+ *
+ * Echoes the content of every system message, combined in order the way
+ * OpenAI joins them, so clients can check which instructions reached the
+ * model when they send several system messages or build them up in layers.
+ */
+export class SystemEchoModel implements Model {
+  async *process(_input: string, context?: ModelContext): AsyncGenerator<string> {
+    yield context?.system ?? "Hello! I'm the System Echo model. Send me system messages and I'll reply with them combined.";
+  }
+}
@@ -0,0 +1,58 @@
+import { describe, it, expect } from "vitest";
+import { ToolCallModel } from "./toolcall-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("ToolCallModel", () => {
+  it("should call the first available tool with wrapped input", async () => {
+    const model = new ToolCallModel();
+    const context = createModelContext(
+      [{ role: "user", content: "Paris" }],
+      [{ name: "get_weather" }, { name: "get_time" }],
+    );
+
+    const response = await getResponse(model, "Paris", context);
+
+    expect(response).toBe("");
+    expect(context.toolCalls).toEqual([
+      { name: "get_weather", arguments: '{"input":"Paris"}' },
+    ]);
+  });
+
+  it("should pass JSON object input through as arguments", async () => {
+    const model = new ToolCallModel();
+    const context = createModelContext(
+      [{ role: "user", content: '{"city": "Paris"}' }],
+      [{ name: "get_weather" }],
+    );
+
+    await getResponse(model, '{"city": "Paris"}', context);
+
+    expect(context.toolCalls[0]?.arguments).toBe('{"city":"Paris"}');
+  });
+
+  it("should answer with the tool result once one is provided", async () => {
+    const model = new ToolCallModel();
+    const context = createModelContext(
+      [
+        { role: "user", content: "Paris" },
+        { role: "assistant", content: "" },
+        { role: "tool", content: "Sunny, 22C" },
+      ],
+      [{ name: "get_weather" }],
+    );
+
+    const response = await getResponse(model, "Paris", context);
+
+    expect(response).toBe("Tool result: Sunny, 22C");
+    expect(context.toolCalls).toEqual([]);
+  });
+
+  it("should explain itself when no tools are available", async () => {
+    const model = new ToolCallModel();
+
+    const response = await getResponse(model, "Paris");
+
+    expect(response).toContain("No tools available");
+  });
+});
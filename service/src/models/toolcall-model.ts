@@ -0,0 +1,46 @@
+import { Model, ModelContext } from './model.js';
+
+/**
+ * ToolCall - Deterministic function calling for client testing
+ *
+ * Calls the first tool the caller makes available, passing the latest user
+ * message as arguments: a JSON object message is passed through verbatim,
+ * anything else is wrapped as {"input": "<message>"}. Once the conversation
+ * ends with a tool result, it replies with that result as plain content, so a
+ * full call → result → answer round trip can be exercised.
+ *
+ * The model only reports calls through the context; whether they go out as
+ * `tool_calls` or legacy `function_call` is decided by the protocol adapter.
+ */
+export class ToolCallModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const last = context?.messages[context.messages.length - 1];
+    if (last && (last.role === 'tool' || last.role === 'function')) {
+      yield `Tool result: ${last.content}`;
+      return;
+    }
+
+    const tool = context?.tools[0];
+    if (!context || !tool) {
+      yield "No tools available. Send a request with 'tools' (or legacy 'functions') and I'll call the first one.";
+      return;
+    }
+
+    context.toolCalls.push({
+      name: tool.name,
+      arguments: this.toArguments(input),
+    });
+  }
+
+  private toArguments(input: string): string {
+    try {
+      const parsed = JSON.parse(input);
+      if (parsed && typeof parsed === 'object' && !Array.isArray(parsed)) {
+        return JSON.stringify(parsed);
+      }
+    } catch {
+      // Not JSON - fall through and wrap the raw text
+    }
+    return JSON.stringify({ input });
+  }
+}
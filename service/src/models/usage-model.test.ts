@@ -0,0 +1,44 @@
+import { describe, it, expect } from "vitest";
+import { UsageModel, parseUsage } from "./usage-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("UsageModel", () => {
+  it("should report the dictated counts and restate them", async () => {
+    const model = new UsageModel();
+    const context = createModelContext();
+
+    const response = await getResponse(model, "prompt=123 completion=45", context);
+
+    expect(response).toBe("Usage: prompt=123 completion=45 total=168.");
+    expect(context.promptTokens).toBe(123);
+    expect(context.completionTokens).toBe(45);
+  });
+
+  it("should fall back to real counting with a note for unparseable input", async () => {
+    const model = new UsageModel();
+    const context = createModelContext();
+
+    const response = await getResponse(model, "prompt=lots", context);
+
+    expect(response).toContain("Couldn't read usage");
+    expect(context.promptTokens).toBeUndefined();
+    expect(context.completionTokens).toBeUndefined();
+  });
+});
+
+describe("parseUsage", () => {
+  it("should accept either order, any case and separators", () => {
+    expect(parseUsage("Completion = 0, PROMPT=7")).toEqual({ prompt: 7, completion: 0 });
+  });
+
+  it("should reject negative, fractional and out-of-range counts", () => {
+    expect(parseUsage("prompt=-1 completion=2")).toBeUndefined();
+    expect(parseUsage("prompt=1.5 completion=2")).toBeUndefined();
+    expect(parseUsage("prompt=1000001 completion=2")).toBeUndefined();
+  });
+
+  it("should require both counts", () => {
+    expect(parseUsage("prompt=10")).toBeUndefined();
+  });
+});
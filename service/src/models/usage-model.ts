@@ -0,0 +1,47 @@
+import { Model, ModelContext } from './model.js';
+
+// Largest count a caller may dictate, to keep totals well inside safe integers
+export const MAX_DICTATED_TOKENS = 1_000_000;
+
+/**
+ * Usage - Caller-controlled token counts for testing cost accounting
+ *
+ * The user message dictates the usage to report, e.g. "prompt=123
+ * completion=45"; the reply restates the numbers and the response's usage
+ * carries exactly those values, with the total computed. If either count is
+ * missing or outside 0..1,000,000 the model says so and the usual estimated
+ * counts are reported instead.
+ */
+export class UsageModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const usage = parseUsage(input);
+    if (!usage) {
+      yield `Couldn't read usage from '${input}'. Send "prompt=<n> completion=<n>" with values from 0 to ${MAX_DICTATED_TOKENS}; reporting real counts instead.`;
+      return;
+    }
+
+    if (context) {
+      context.promptTokens = usage.prompt;
+      context.completionTokens = usage.completion;
+    }
+    yield `Usage: prompt=${usage.prompt} completion=${usage.completion} total=${usage.prompt + usage.completion}.`;
+  }
+}
+
+export function parseUsage(input: string): { prompt: number; completion: number } | undefined {
+  const prompt = readCount(input, 'prompt');
+  const completion = readCount(input, 'completion');
+  if (prompt === undefined || completion === undefined) {
+    return undefined;
+  }
+  return { prompt, completion };
+}
+
+function readCount(input: string, name: string): number | undefined {
+  const match = input.match(new RegExp(`\\b${name}\\s*=\\s*([^\\s,;]+)`, 'i'));
+  if (!match || !/^\d+$/.test(match[1]!)) {
+    return undefined;
+  }
+  const count = Number(match[1]);
+  return count <= MAX_DICTATED_TOKENS ? count : undefined;
+}
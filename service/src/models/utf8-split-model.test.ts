@@ -0,0 +1,20 @@
+import { describe, it, expect } from "vitest";
+import { Utf8SplitModel, UTF8_SPLIT_SAMPLE } from "./utf8-split-model.js";
+import { createModelContext } from "./model.js";
+import { getChunks, getResponse } from "../../tests/test-helpers.js";
+
+describe("Utf8SplitModel", () => {
+  it("should stream a multibyte message back a word at a time, framed midchar", async () => {
+    const context = createModelContext();
+
+    const chunks = await getChunks(new Utf8SplitModel(), "crème brûlée 🍮", context);
+
+    expect(chunks).toEqual(["crème ", "brûlée ", "🍮"]);
+    expect(context.sseVariants).toEqual(["midchar"]);
+  });
+
+  it("should reply with the multibyte sample to plain ASCII", async () => {
+    expect(await getResponse(new Utf8SplitModel(), "Hello there")).toBe(UTF8_SPLIT_SAMPLE);
+    expect(await getResponse(new Utf8SplitModel(), "")).toBe(UTF8_SPLIT_SAMPLE);
+  });
+});
@@ -0,0 +1,28 @@
+import { Model, ModelContext } from './model.js';
+
+// Replied when the message has nothing beyond ASCII to split
+export const UTF8_SPLIT_SAMPLE = 'héllo wörld 👋 世界, naïve café 🎉';
+
+/**
+ * UTF-8 Split - Streams multibyte text split mid-character on the wire
+ *
+ * For testing the robustness of SSE decoders, not for real chats. Streams
+ * the message back a word at a time, with each event written in two pieces
+ * that break inside its first multibyte character (the midchar framing), so
+ * a client decoding each network read as UTF-8 on its own gets replacement
+ * characters where a buffering one gets the text intact. Messages that are
+ * plain ASCII get UTF8_SPLIT_SAMPLE instead, so there's always something to
+ * split. The reassembled content is always valid UTF-8.
+ */
+export class Utf8SplitModel implements Model {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    if (context) {
+      context.sseVariants = ['midchar'];
+    }
+
+    const text = /[^\x00-\x7f]/.test(input) ? input : UTF8_SPLIT_SAMPLE;
+    for (const word of text.split(/(?<= )/)) {
+      yield word;
+    }
+  }
+}
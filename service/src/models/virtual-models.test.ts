@@ -0,0 +1,70 @@
+import { describe, it, expect } from "vitest";
+import { orderVirtualModels, parseVirtualModels } from "./virtual-models.js";
+
+describe("parseVirtualModels", () => {
+  it("should accept every setting", () => {
+    expect(
+      parseVirtualModels([
+        {
+          id: "echo-loud",
+          base: "echo",
+          max_tokens: 50,
+          temperature: 0.3,
+          system: "Shout.",
+          input: ["trim"],
+          output: ["uppercase", { prefix: "> " }, { suffix: "!" }],
+        },
+      ])
+    ).toEqual([
+      {
+        id: "echo-loud",
+        base: "echo",
+        max_tokens: 50,
+        temperature: 0.3,
+        system: "Shout.",
+        input: ["trim"],
+        output: ["uppercase", { prefix: "> " }, { suffix: "!" }],
+      },
+    ]);
+  });
+
+  it("should reject malformed entries", () => {
+    expect(() => parseVirtualModels({ models: [] })).toThrow("list of models");
+    expect(() => parseVirtualModels([{ base: "echo" }])).toThrow("[0].id");
+    expect(() => parseVirtualModels([{ id: "a" }])).toThrow("[0].base");
+    expect(() => parseVirtualModels([{ id: "a", base: "echo", max_tokens: 0 }])).toThrow("positive integer");
+    expect(() => parseVirtualModels([{ id: "a", base: "echo", temperature: 3 }])).toThrow("from 0 to 2");
+    expect(() => parseVirtualModels([{ id: "a", base: "echo", output: ["reverse"] }])).toThrow("[0].output[0]");
+    expect(() => parseVirtualModels([{ id: "a", base: "echo", input: [{ prefix: 1 }] }])).toThrow("[0].input[0]");
+    expect(() => parseVirtualModels([{ id: "a", base: "echo", seed: 1 }])).toThrow("Unknown virtual model setting: seed");
+  });
+});
+
+describe("orderVirtualModels", () => {
+  it("should put each model after the virtual model it's built on", () => {
+    const ordered = orderVirtualModels([
+      { id: "c", base: "b" },
+      { id: "b", base: "a" },
+      { id: "a", base: "echo" },
+    ]);
+
+    expect(ordered.map((model) => model.id)).toEqual(["a", "b", "c"]);
+  });
+
+  it("should reject duplicates, cycles and deep stacks", () => {
+    expect(() => orderVirtualModels([{ id: "a", base: "echo" }, { id: "a", base: "eliza" }])).toThrow(
+      "Virtual model a is listed twice"
+    );
+    expect(() => orderVirtualModels([{ id: "a", base: "b" }, { id: "b", base: "a" }])).toThrow(
+      "Virtual models form a cycle: a -> b -> a"
+    );
+    expect(() =>
+      orderVirtualModels([
+        { id: "a", base: "echo" },
+        { id: "b", base: "a" },
+        { id: "c", base: "b" },
+        { id: "d", base: "c" },
+      ])
+    ).toThrow("Virtual model d is stacked 4 deep, beyond the 3 allowed");
+  });
+});
@@ -0,0 +1,142 @@
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+import type { TextTransform } from '../modelware/transform-modelware.js';
+
+// How many virtual models may be stacked on each other, counting the one
+// on the registered model
+export const MAX_VIRTUAL_DEPTH = 3;
+
+// A model id served by another model with fixed settings, e.g. echo-loud as
+// echo upper-cased and cut off at 50 tokens
+export interface VirtualModel {
+  id: string;
+  // The registered model, or another virtual model, it's built on
+  base: string;
+  // Request parameters it always runs with. Output is cut off at max_tokens,
+  // finishing with length; temperature is reported but, as every model
+  // ignores sampling, changes nothing.
+  max_tokens?: number | undefined;
+  temperature?: number | undefined;
+  // System prompt for requests without a system message
+  system?: string | undefined;
+  // Transforms of the user message and of the output, applied in order
+  input?: TextTransform[] | undefined;
+  output?: TextTransform[] | undefined;
+}
+
+const TRANSFORM_HINT = '"uppercase", "trim", {"prefix": "..."} or {"suffix": "..."}';
+
+/**
+ * Validates the entries of a --virtual-models file, a list of virtual
+ * models, and returns them in an order where each comes after its base.
+ */
+export function parseVirtualModels(value: unknown): VirtualModel[] {
+  if (!Array.isArray(value)) {
+    throw new InvalidRequestError('Virtual models must be a list of models');
+  }
+
+  const models = value.map((entry: unknown, index) => {
+    const param = `[${index}]`;
+    if (!isObject(entry)) {
+      throw new InvalidRequestError(`${param} must be an object`, param);
+    }
+    const { id, base, max_tokens, temperature, system, input, output, ...rest } = entry;
+
+    const unknownKey = Object.keys(rest)[0];
+    if (unknownKey !== undefined) {
+      throw new InvalidRequestError(`Unknown virtual model setting: ${unknownKey}`, `${param}.${unknownKey}`);
+    }
+    if (typeof id !== 'string' || id === '') {
+      throw new InvalidRequestError(`${param}.id must be a non-empty string`, `${param}.id`);
+    }
+    if (typeof base !== 'string' || base === '') {
+      throw new InvalidRequestError(`${param}.base must be a non-empty string`, `${param}.base`);
+    }
+    if (max_tokens !== undefined && !(Number.isInteger(max_tokens) && (max_tokens as number) >= 1)) {
+      throw new InvalidRequestError(`${param}.max_tokens must be a positive integer`, `${param}.max_tokens`);
+    }
+    if (
+      temperature !== undefined &&
+      !(typeof temperature === 'number' && temperature >= 0 && temperature <= 2)
+    ) {
+      throw new InvalidRequestError(`${param}.temperature must be a number from 0 to 2`, `${param}.temperature`);
+    }
+    if (system !== undefined && typeof system !== 'string') {
+      throw new InvalidRequestError(`${param}.system must be a string`, `${param}.system`);
+    }
+
+    const model: VirtualModel = { id, base };
+    if (max_tokens !== undefined) model.max_tokens = max_tokens as number;
+    if (temperature !== undefined) model.temperature = temperature;
+    if (system !== undefined) model.system = system;
+    if (input !== undefined) model.input = parseTransforms(input, `${param}.input`);
+    if (output !== undefined) model.output = parseTransforms(output, `${param}.output`);
+    return model;
+  });
+  return orderVirtualModels(models);
+}
+
+function parseTransforms(value: unknown, param: string): TextTransform[] {
+  if (!Array.isArray(value)) {
+    throw new InvalidRequestError(`${param} must be a list of ${TRANSFORM_HINT}`, param);
+  }
+  return value.map((transform: unknown, index) => {
+    if (transform === 'uppercase' || transform === 'trim') {
+      return transform;
+    }
+    if (isObject(transform) && Object.keys(transform).length === 1) {
+      if (typeof transform.prefix === 'string') {
+        return { prefix: transform.prefix };
+      }
+      if (typeof transform.suffix === 'string') {
+        return { suffix: transform.suffix };
+      }
+    }
+    throw new InvalidRequestError(`${param}[${index}] must be ${TRANSFORM_HINT}`, `${param}[${index}]`);
+  });
+}
+
+/**
+ * Orders virtual models so each comes after the virtual model it's built
+ * on, if any. Rejects ids listed twice, cycles, and stacks deeper than
+ * MAX_VIRTUAL_DEPTH.
+ */
+export function orderVirtualModels(models: VirtualModel[]): VirtualModel[] {
+  const byId = new Map<string, VirtualModel>();
+  for (const model of models) {
+    if (byId.has(model.id)) {
+      throw new InvalidRequestError(`Virtual model ${model.id} is listed twice`);
+    }
+    byId.set(model.id, model);
+  }
+
+  const ordered: VirtualModel[] = [];
+  // How many virtual models deep each placed one is
+  const depths = new Map<string, number>();
+  const place = (model: VirtualModel, chain: string[]): number => {
+    const known = depths.get(model.id);
+    if (known !== undefined) {
+      return known;
+    }
+    if (chain.includes(model.id)) {
+      throw new InvalidRequestError(`Virtual models form a cycle: ${[...chain, model.id].join(' -> ')}`);
+    }
+    const base = byId.get(model.base);
+    const depth = base ? place(base, [...chain, model.id]) + 1 : 1;
+    if (depth > MAX_VIRTUAL_DEPTH) {
+      throw new InvalidRequestError(
+        `Virtual model ${model.id} is stacked ${depth} deep, beyond the ${MAX_VIRTUAL_DEPTH} allowed`
+      );
+    }
+    depths.set(model.id, depth);
+    ordered.push(model);
+    return depth;
+  };
+  for (const model of models) {
+    place(model, []);
+  }
+  return ordered;
+}
+
+function isObject(value: unknown): value is Record<string, unknown> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
@@ -0,0 +1,58 @@
+import { describe, it, expect } from "vitest";
+import { readFileSync } from "fs";
+import { VisionModel } from "./vision-model.js";
+import { createModelContext } from "./model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+const PNG = readFileSync(new URL("../../tests/testdata/red-3x2.png", import.meta.url));
+const PNG_URI = `data:image/png;base64,${PNG.toString("base64")}`;
+
+const withImages = (...images: string[]) => {
+  const context = createModelContext();
+  context.images = images;
+  return context;
+};
+
+// Serves the PNG, or the given status, without touching the network
+const fakeFetch = (status = 200, body: Uint8Array = PNG) =>
+  (async () => new Response(status === 200 ? body : null, { status })) as unknown as typeof fetch;
+
+describe("VisionModel", () => {
+  it("should describe data URIs from their bytes, then echo the text", async () => {
+    const reply = await getResponse(
+      new VisionModel(),
+      "What are these?",
+      withImages(PNG_URI, PNG_URI.replace("image/png", "image/jpeg"), "data:image/png;base64,@@@@"),
+    );
+
+    expect(reply).toBe(
+      [
+        "Image 1: data URI, 73 bytes, PNG 3x2",
+        "Image 2: data URI, 73 bytes, PNG 3x2 (declared image/jpeg)",
+        "Image 3: data URI (invalid base64)",
+        "",
+        "What are these?",
+      ].join("\n"),
+    );
+  });
+
+  it("should echo http(s) URLs without fetching them by default", async () => {
+    const reply = await getResponse(new VisionModel(), "", withImages("https://example.com/cat.png", "ftp://x/y.png"));
+
+    expect(reply).toBe("Image 1: https://example.com/cat.png (not fetched)\nImage 2: ftp://x/y.png (unsupported URL scheme)");
+  });
+
+  it("should describe fetched images within the size limit", async () => {
+    const url = "https://example.com/red.png";
+    const fetching = (fetchImpl: typeof fetch, maxBytes = 1024) =>
+      getResponse(new VisionModel({ maxBytes, timeoutMs: 1000 }, fetchImpl), "", withImages(url));
+
+    expect(await fetching(fakeFetch())).toBe(`Image 1: ${url}, 73 bytes, PNG 3x2`);
+    expect(await fetching(fakeFetch(), 50)).toBe(`Image 1: ${url} (fetch failed: larger than 50 bytes)`);
+    expect(await fetching(fakeFetch(404))).toBe(`Image 1: ${url} (fetch failed: HTTP 404)`);
+  });
+
+  it("should say when there are no images", async () => {
+    expect(await getResponse(new VisionModel(), "Just text")).toBe("No images.\n\nJust text");
+  });
+});
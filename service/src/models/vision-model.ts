@@ -0,0 +1,116 @@
+import { Model, ModelContext } from './model.js';
+import { inspectImage, parseDataUri } from '../utils/image-info.js';
+import type { ImageInfo } from '../utils/image-info.js';
+
+// Limits on downloading http(s) images, only done when enabled
+export interface VisionFetchOptions {
+  maxBytes: number;
+  timeoutMs: number;
+}
+
+export const DEFAULT_VISION_FETCH: VisionFetchOptions = { maxBytes: 5 * 1024 * 1024, timeoutMs: 5000 };
+
+/**
+ * Vision - Describes the images it's sent, without looking at them
+ *
+ * Replies with one line per image_url part of the last user message, then
+ * the message's text. Data URIs are decoded and reported with their size,
+ * format (from the magic bytes, not the declared type) and, for PNG and
+ * JPEG, dimensions. http(s) URLs are echoed as they are unless fetching is
+ * enabled, in which case they're downloaded within the size and time limits
+ * and described the same way. The same images always give the same reply,
+ * so multimodal client code can be tested offline.
+ */
+export class VisionModel implements Model {
+  constructor(
+    private fetchOptions?: VisionFetchOptions | undefined,
+    private fetchImpl: typeof fetch = fetch
+  ) {}
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const images = context?.images ?? [];
+    if (images.length === 0 && !input) {
+      yield "Hello! I'm the Vision model. Send me image_url content parts and I'll describe each one.";
+      return;
+    }
+
+    const lines = await Promise.all(
+      images.map(async (url, index) => `Image ${index + 1}: ${await this.describe(url)}`)
+    );
+    if (lines.length === 0) {
+      lines.push('No images.');
+    }
+    yield input ? `${lines.join('\n')}\n\n${input}` : lines.join('\n');
+  }
+
+  private async describe(url: string): Promise<string> {
+    if (url.startsWith('data:')) {
+      try {
+        const { mediaType, bytes } = parseDataUri(url);
+        const info = inspectImage(bytes);
+        const declared = info.format && mediaType === `image/${info.format}` ? '' : ` (declared ${mediaType})`;
+        return `data URI, ${bytes.length} bytes, ${summarize(info)}${declared}`;
+      } catch (error) {
+        return `data URI (${error instanceof Error ? error.message : String(error)})`;
+      }
+    }
+
+    if (!/^https?:\/\//i.test(url)) {
+      return `${url} (unsupported URL scheme)`;
+    }
+    if (!this.fetchOptions) {
+      return `${url} (not fetched)`;
+    }
+    try {
+      const bytes = await this.download(url, this.fetchOptions);
+      return `${url}, ${bytes.length} bytes, ${summarize(inspectImage(bytes))}`;
+    } catch (error) {
+      return `${url} (fetch failed: ${error instanceof Error ? error.message : String(error)})`;
+    }
+  }
+
+  // Reads the body up to maxBytes, giving up as soon as it's larger
+  private async download(url: string, { maxBytes, timeoutMs }: VisionFetchOptions): Promise<Uint8Array> {
+    const signal = AbortSignal.timeout(timeoutMs);
+    const tooLarge = () => new Error(`larger than ${maxBytes} bytes`);
+    try {
+      const response = await this.fetchImpl(url, { signal });
+      if (!response.ok) {
+        throw new Error(`HTTP ${response.status}`);
+      }
+      if (Number(response.headers.get('Content-Length') ?? 0) > maxBytes) {
+        throw tooLarge();
+      }
+
+      const chunks: Uint8Array[] = [];
+      let length = 0;
+      const reader = response.body?.getReader();
+      for (let next = await reader?.read(); next && !next.done; next = await reader?.read()) {
+        length += next.value.length;
+        if (length > maxBytes) {
+          await reader?.cancel();
+          throw tooLarge();
+        }
+        chunks.push(next.value);
+      }
+      return new Uint8Array(Buffer.concat(chunks));
+    } catch (error) {
+      if (signal.aborted) {
+        throw new Error(`no response within ${timeoutMs}ms`);
+      }
+      throw error;
+    }
+  }
+}
+
+const FORMAT_NAMES = { png: 'PNG', jpeg: 'JPEG', gif: 'GIF', webp: 'WebP' };
+
+function summarize({ format, width, height }: ImageInfo): string {
+  if (!format) {
+    return 'unknown format';
+  }
+  if (width === undefined || height === undefined) {
+    return FORMAT_NAMES[format];
+  }
+  return `${FORMAT_NAMES[format]} ${width}x${height}`;
+}
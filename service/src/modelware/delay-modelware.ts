@@ -1,4 +1,4 @@
-import { Model } from '../models/model.js';
+import { Model, ModelContext } from '../models/model.js';
 
 export class DelayModelware implements Model {
   constructor(
@@ -6,8 +6,8 @@ export class DelayModelware implements Model {
     private delayMs: number = 50
   ) {}
 
-  async *process(input: string): AsyncGenerator<string> {
-    for await (const chunk of this.model.process(input)) {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    for await (const chunk of this.model.process(input, context)) {
       yield chunk;
       await new Promise(resolve => setTimeout(resolve, this.delayMs));
     }
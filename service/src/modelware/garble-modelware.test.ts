@@ -0,0 +1,53 @@
+import { describe, it, expect } from "vitest";
+import { DEFAULT_GARBAGE_TOKEN, GarbleModelware } from "./garble-modelware.js";
+import { EchoModel } from "../models/echo-model.js";
+import { createModelContext } from "../models/model.js";
+import { getResponse } from "../../tests/test-helpers.js";
+
+describe("GarbleModelware", () => {
+  it("should follow every word with the garbage token at probability 1", async () => {
+    const model = new GarbleModelware(new EchoModel(), { probability: 1 });
+
+    expect(await getResponse(model, "the quick fox")).toBe(
+      `the${DEFAULT_GARBAGE_TOKEN} quick${DEFAULT_GARBAGE_TOKEN} fox${DEFAULT_GARBAGE_TOKEN}`,
+    );
+  });
+
+  it("should leave output clean at probability 0", async () => {
+    const model = new GarbleModelware(new EchoModel(), { probability: 0, token: "#" });
+
+    expect(await getResponse(model, "the quick fox")).toBe("the quick fox");
+  });
+
+  it("should garble the same words for the same seed", async () => {
+    const text = Array.from({ length: 40 }, (_, i) => `w${i}`).join(" ");
+    const garbled = (seed: number) =>
+      getResponse(new GarbleModelware(new EchoModel(), { probability: 0.5, seed, token: "#" }), text);
+
+    const first = await garbled(7);
+    expect(await garbled(7)).toBe(first);
+    expect(await garbled(8)).not.toBe(first);
+    expect(first.replaceAll("#", "")).toBe(text);
+    expect(first).toContain("#");
+  });
+
+  it("should prefer the request's seed to the configured one", async () => {
+    const model = new GarbleModelware(new EchoModel(), { probability: 0.5, seed: 1, token: "#" });
+    const text = Array.from({ length: 40 }, (_, i) => `w${i}`).join(" ");
+    const withSeed = (seed: number) => {
+      const context = createModelContext();
+      context.seed = seed;
+      return getResponse(model, text, context);
+    };
+
+    expect(await withSeed(99)).toBe(await withSeed(99));
+    expect(await withSeed(99)).not.toBe(await getResponse(model, text));
+  });
+
+  it("should keep the wrapped model's health check", () => {
+    const checked = { process: new EchoModel().process, checkHealth: async () => {} };
+
+    expect(new GarbleModelware(new EchoModel(), { probability: 1 }).checkHealth).toBeUndefined();
+    expect(new GarbleModelware(checked, { probability: 1 }).checkHealth).toBeDefined();
+  });
+});
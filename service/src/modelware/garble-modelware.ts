@@ -0,0 +1,56 @@
+import { Model, ModelContext } from '../models/model.js';
+import { seededRandom } from '../utils/random.js';
+
+// Inserted by default: replacement characters and symbols no real tokenizer
+// would produce together
+export const DEFAULT_GARBAGE_TOKEN = '�#@%�';
+
+export interface GarbleOptions {
+  // Chance, from 0 to 1, of a garbage token after each word of output
+  probability: number;
+  // Makes the garbling reproducible; a request's own seed takes precedence
+  seed?: number | undefined;
+  token?: string | undefined;
+}
+
+/**
+ * Now and then inserts a garbage token into another model's output, like a
+ * flaky model emitting corrupted tokens, so clients' output validation can be
+ * exercised. Each word of output is followed by the token with the given
+ * probability.
+ */
+export class GarbleModelware implements Model {
+  checkHealth?: (signal: AbortSignal) => Promise<void>;
+  init?: () => Promise<void>;
+
+  constructor(
+    private model: Model,
+    private options: GarbleOptions,
+    private random: () => number = Math.random
+  ) {
+    // Garbling doesn't change what the model depends on
+    if (model.checkHealth) {
+      this.checkHealth = (signal) => model.checkHealth!(signal);
+    }
+    if (model.init) {
+      this.init = () => model.init!();
+    }
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const seed = context?.seed ?? this.options.seed;
+    const random = seed === undefined ? this.random : seededRandom(seed);
+    const token = this.options.token ?? DEFAULT_GARBAGE_TOKEN;
+
+    for await (const chunk of this.model.process(input, context)) {
+      let garbled = '';
+      for (const word of chunk.split(/(?<=\S)(?=\s)/)) {
+        garbled += word;
+        if (random() < this.options.probability) {
+          garbled += token;
+        }
+      }
+      yield garbled;
+    }
+  }
+}
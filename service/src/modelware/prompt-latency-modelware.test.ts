@@ -0,0 +1,46 @@
+import { describe, it, expect } from "vitest";
+import { PromptLatencyModelware } from "./prompt-latency-modelware.js";
+import { EchoModel } from "../models/echo-model.js";
+import { createModelContext } from "../models/model.js";
+
+async function timeToFirstChunk(model: PromptLatencyModelware, input: string): Promise<number> {
+  const start = Date.now();
+  await model.process(input).next();
+  return Date.now() - start;
+}
+
+describe("PromptLatencyModelware", () => {
+  it("should take proportionally longer for longer prompts", async () => {
+    const model = new PromptLatencyModelware(new EchoModel(), 2);
+
+    const short = await timeToFirstChunk(model, "x".repeat(40)); // 10 tokens, ~20ms
+    const long = await timeToFirstChunk(model, "x".repeat(400)); // 100 tokens, ~200ms
+
+    expect(short).toBeGreaterThanOrEqual(15);
+    expect(long).toBeGreaterThanOrEqual(190);
+    expect(long).toBeGreaterThan(short * 4);
+  });
+
+  it("should add the base delay regardless of prompt length", async () => {
+    const model = new PromptLatencyModelware(new EchoModel(), 0, 30);
+
+    expect(await timeToFirstChunk(model, "hi")).toBeGreaterThanOrEqual(25);
+  });
+
+  it("should stop waiting when the request is aborted", async () => {
+    const model = new PromptLatencyModelware(new EchoModel(), 1000);
+    const abort = new AbortController();
+    const context = createModelContext();
+    context.signal = abort.signal;
+    setTimeout(() => abort.abort(), 20);
+
+    const start = Date.now();
+    const chunks: string[] = [];
+    for await (const chunk of model.process("a long enough prompt", context)) {
+      chunks.push(chunk);
+    }
+
+    expect(chunks).toEqual([]);
+    expect(Date.now() - start).toBeLessThan(1000);
+  });
+});
@@ -0,0 +1,26 @@
+import { Model, ModelContext } from '../models/model.js';
+import { sleep } from '../utils/sleep.js';
+
+/**
+ * Delays the first chunk in proportion to the prompt's length, mimicking
+ * real models whose time to first token grows with the prompt. The prompt is
+ * estimated at roughly 4 characters per token, as in usage reporting, and the
+ * wait is cut short if the request is aborted.
+ */
+export class PromptLatencyModelware implements Model {
+  constructor(
+    private model: Model,
+    private msPerToken: number = 5,
+    private baseMs: number = 0
+  ) {}
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const promptTokens = Math.ceil(input.trim().length / 4);
+    await sleep(this.baseMs + promptTokens * this.msPerToken, context?.signal);
+    if (context?.signal?.aborted) {
+      return;
+    }
+
+    yield* this.model.process(input, context);
+  }
+}
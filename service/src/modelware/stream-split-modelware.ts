@@ -1,4 +1,4 @@
-import { Model } from '../models/model.js';
+import { Model, ModelContext } from '../models/model.js';
 
 export class StreamSplitModelware implements Model {
   // Common split patterns
@@ -12,8 +12,8 @@ export class StreamSplitModelware implements Model {
     private splitPattern: RegExp = StreamSplitModelware.WORDS
   ) {}
 
-  async *process(input: string): AsyncGenerator<string> {
-    for await (const chunk of this.model.process(input)) {
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    for await (const chunk of this.model.process(input, context)) {
       if (this.splitPattern === StreamSplitModelware.WORDS) {
         // Special handling for WORDS to match original EchoModel behavior
         const words = chunk.split(' ');
@@ -0,0 +1,52 @@
+import { describe, it, expect } from "vitest";
+import { TransformModelware, transformText } from "./transform-modelware.js";
+import { EchoModel } from "../models/echo-model.js";
+import { Model } from "../models/model.js";
+
+// Yields the given chunks as they are
+class ChunksModel implements Model {
+  constructor(private chunks: string[]) {}
+
+  async *process(): AsyncGenerator<string> {
+    yield* this.chunks;
+  }
+}
+
+async function collect(model: Model, input: string): Promise<string[]> {
+  const chunks: string[] = [];
+  for await (const chunk of model.process(input)) {
+    chunks.push(chunk);
+  }
+  return chunks;
+}
+
+describe("transformText", () => {
+  it("should apply each kind of transform", () => {
+    expect(transformText("  hi  ", "trim")).toBe("hi");
+    expect(transformText("hi", "uppercase")).toBe("HI");
+    expect(transformText("hi", { prefix: "> " })).toBe("> hi");
+    expect(transformText("hi", { suffix: "!" })).toBe("hi!");
+  });
+});
+
+describe("TransformModelware", () => {
+  it("should transform the input before the model sees it", async () => {
+    const model = new TransformModelware(new EchoModel(), { input: ["trim", { prefix: "You said: " }] });
+
+    expect((await collect(model, "  hello  ")).join("")).toBe("You said: hello");
+  });
+
+  it("should transform the output in order", async () => {
+    const model = new TransformModelware(new ChunksModel(["hel", "lo"]), {
+      output: ["uppercase", { prefix: "> " }, { suffix: "!" }],
+    });
+
+    expect(await collect(model, "")).toEqual(["> ", "HEL", "LO", "!"]);
+  });
+
+  it("should trim streamed output, holding back only whitespace", async () => {
+    const model = new TransformModelware(new ChunksModel(["  ", " one ", " ", "two", "  \n"]), { output: ["trim"] });
+
+    expect(await collect(model, "")).toEqual(["one", "  two"]);
+  });
+});
@@ -0,0 +1,86 @@
+import { Model, ModelContext } from '../models/model.js';
+
+// A fixed rewrite of text: upper-casing it, trimming its surrounding
+// whitespace, or adding to its start or end
+export type TextTransform = 'uppercase' | 'trim' | { prefix: string } | { suffix: string };
+
+export interface TransformOptions {
+  // Applied in order to the user message before the model sees it
+  input?: TextTransform[] | undefined;
+  // Applied in order to the model's output as it streams
+  output?: TextTransform[] | undefined;
+}
+
+/**
+ * Rewrites the message a model is given and the output it produces with
+ * fixed transforms, as virtual models configure. Output is transformed as it
+ * streams: only whitespace that trim may yet drop is held back.
+ */
+export class TransformModelware implements Model {
+  checkHealth?: (signal: AbortSignal) => Promise<void>;
+  init?: () => Promise<void>;
+
+  constructor(
+    private model: Model,
+    private options: TransformOptions
+  ) {
+    // Transforming doesn't change what the model depends on
+    if (model.checkHealth) {
+      this.checkHealth = (signal) => model.checkHealth!(signal);
+    }
+    if (model.init) {
+      this.init = () => model.init!();
+    }
+  }
+
+  async *process(input: string, context?: ModelContext): AsyncGenerator<string> {
+    const transformed = (this.options.input ?? []).reduce(transformText, input);
+    let output: AsyncIterable<string> = this.model.process(transformed, context);
+    for (const transform of this.options.output ?? []) {
+      output = transformStream(output, transform);
+    }
+    yield* output;
+  }
+}
+
+export function transformText(text: string, transform: TextTransform): string {
+  if (transform === 'uppercase') {
+    return text.toUpperCase();
+  }
+  if (transform === 'trim') {
+    return text.trim();
+  }
+  return 'prefix' in transform ? transform.prefix + text : text + transform.suffix;
+}
+
+async function* transformStream(chunks: AsyncIterable<string>, transform: TextTransform): AsyncGenerator<string> {
+  if (transform === 'uppercase') {
+    for await (const chunk of chunks) {
+      yield chunk.toUpperCase();
+    }
+  } else if (transform === 'trim') {
+    yield* trimStream(chunks);
+  } else if ('prefix' in transform) {
+    yield transform.prefix;
+    yield* chunks;
+  } else {
+    yield* chunks;
+    yield transform.suffix;
+  }
+}
+
+// Drops leading whitespace, and holds back whitespace until more text
+// follows it, so whatever is left at the end is dropped too
+async function* trimStream(chunks: AsyncIterable<string>): AsyncGenerator<string> {
+  let started = false;
+  let pending = '';
+  for await (const chunk of chunks) {
+    const text = pending + (started ? chunk : chunk.trimStart());
+    const end = text.trimEnd().length;
+    pending = text.slice(end);
+    if (end > 0) {
+      started = true;
+      yield text.slice(0, end);
+    }
+  }
+}
@@ -1,128 +1,721 @@
 import type {
   ChatCompletionRequest,
   ChatCompletionResponse,
+  ChatCompletionChoice,
+  ChatCompletionStreamChoice,
   ChatCompletionStreamResponse,
   ChatCompletionMessage,
+  ChatCompletionFinishReason,
+  ChatCompletionAnnotation,
+  ChatCompletionParameters,
+  ChatCompletionLogprobs,
+  ContentFilterResult,
+  PromptFilterResult,
 } from './types.js';
 import {
+  DEFAULT_REPLY_PRIMING_TOKENS,
+  DEFAULT_TEMPERATURE,
+  DEFAULT_TOKENS_PER_MESSAGE,
+  DEFAULT_TOP_P,
+  contentToText,
+  resolveServiceTier,
   generateChatCompletionId,
+  generateToolCallId,
   getCurrentTimestamp,
 } from './types.js';
-import { Model } from '../models/model.js';
+import { PromptTooLongError } from './errors.js';
+import { defaultIdGenerator } from './ids.js';
+import type { IdGenerator } from './ids.js';
+import { Model, ModelContext, ModelTool, createModelContext } from '../models/model.js';
+import type { RequestTimer } from '../utils/request-timer.js';
+import { systemFingerprint } from '../utils/fingerprint.js';
+import { interleave } from '../utils/interleave.js';
+import { tokenLogprobs } from '../utils/logprobs.js';
+
+// What a model asked of the HTTP layer rather than of the completion itself
+export interface TransportHints {
+  headers: Headers;
+  // SSE framing variants to stream with instead of the standard framing
+  sseVariants?: string[] | undefined;
+}
+
+// Per-call inputs and outputs beyond the request itself
+export interface CompletionOptions {
+  // Fires when the client goes away, so the model can stop early
+  signal?: AbortSignal | undefined;
+  // Filled in with the model's transport hints; streaming calls fill it in
+  // before the first chunk is yielded
+  transport?: TransportHints | undefined;
+  // Server-side timings of the request, made available to the model
+  timing?: RequestTimer | undefined;
+  // Re-splits streamed content instead of sending the model's own pieces
+  chunking?: Chunking | undefined;
+  // Put in front of the completion id, e.g. mytest- for mytest-chatcmpl-...
+  idPrefix?: string | undefined;
+  // Passed on to the model (see ModelContext.idempotencyKey)
+  idempotencyKey?: string | undefined;
+  // Passed on to the model (see ModelContext.requestHeaders)
+  requestHeaders?: Record<string, string> | undefined;
+}
+
+// One chunk per character or per word (trailing space included), or chunks
+// of at most this many characters
+export type Chunking = 'char' | 'word' | number;
+
+// Splits one piece of model output according to the chunking
+export function splitContent(text: string, chunking: Chunking | undefined): string[] {
+  if (chunking === undefined) {
+    return [text];
+  }
+  if (chunking === 'word') {
+    return text.split(/(?<= )/).filter((word) => word !== '');
+  }
+  const chars = Array.from(text);
+  const size = chunking === 'char' ? 1 : chunking;
+  const pieces: string[] = [];
+  for (let i = 0; i < chars.length; i += size) {
+    pieces.push(chars.slice(i, i + size).join(''));
+  }
+  return pieces;
+}
+
+// Protocol-level behaviour shared by every model's adapter
+export interface AdapterOptions {
+  idGenerator?: IdGenerator | undefined;
+  // Reply with output_text parts when the user sent array-form content
+  mirrorArrayContent?: boolean | undefined;
+  // The first streamed chunk always carries just the role; with this set it
+  // also carries empty content ({"role":"assistant","content":""}), which
+  // some clients require before any content deltas
+  roleChunkContent?: boolean | undefined;
+  // Rejects prompts estimated above this many tokens, regardless of output
+  maxPromptTokens?: number | undefined;
+  // Cuts output off at an estimated this many tokens, finishing with length,
+  // whatever max_tokens the request asked for
+  maxOutputTokens?: number | undefined;
+  // Sent as system_fingerprint; derived from the model id alone when unset
+  systemFingerprint?: string | undefined;
+  // Continue a trailing assistant message rather than ignore it (default)
+  prefill?: boolean | undefined;
+  // Used when a request leaves them out (OpenAI's default of 1 when unset)
+  defaultTemperature?: number | undefined;
+  defaultTopP?: number | undefined;
+  // Report the resolved sampling parameters as x_parameters
+  reflectParameters?: boolean | undefined;
+  // Sent as Azure OpenAI's prompt_filter_results, for the one prompt
+  promptFilterResults?: Record<string, ContentFilterResult> | undefined;
+  // Added to prompt_tokens per message and once for the reply (OpenAI's 3
+  // and 3 when unset), so a non-empty messages array never counts as 0
+  tokensPerMessage?: number | undefined;
+  replyPrimingTokens?: number | undefined;
+  // Request parameters this model always runs with, whatever the request
+  // asked for (see virtual models)
+  forcedParameters?: ForcedParameters | undefined;
+  // Sent as the first message of requests that have no system message
+  defaultSystemPrompt?: string | undefined;
+  // Choice i runs with choiceOptions[i % length] over these, e.g. each
+  // fanout backend with its own system prompt and output cap
+  choiceOptions?: ChoiceOptions[] | undefined;
+}
+
+export type ChoiceOptions = Pick<AdapterOptions, 'defaultSystemPrompt' | 'maxOutputTokens'>;
+
+export interface ForcedParameters {
+  max_tokens?: number | undefined;
+  temperature?: number | undefined;
+  // How many choices to run, e.g. one per backend of a fanout
+  n?: number | undefined;
+}
 
 export class OpenAIAdapter {
-  constructor(private model: Model, private modelId: string) {}
+  private idGenerator: IdGenerator;
+  private systemFingerprint: string;
 
-  async complete(request: ChatCompletionRequest): Promise<ChatCompletionResponse> {
+  constructor(
+    private model: Model,
+    private modelId: string,
+    private options: AdapterOptions = {}
+  ) {
+    this.idGenerator = options.idGenerator ?? defaultIdGenerator;
+    this.systemFingerprint = options.systemFingerprint ?? systemFingerprint(modelId);
+  }
+
+  async complete(request: ChatCompletionRequest, options: CompletionOptions = {}): Promise<ChatCompletionResponse> {
+    request = this.withModelDefaults(request);
     const input = this.extractTextFromMessages(request.messages);
-    
-    // Collect all chunks from the streaming model
-    const chunks: string[] = [];
-    for await (const chunk of this.model.process(input)) {
-      chunks.push(chunk);
-    }
-    
-    const responseContent = chunks.join('').trim();
-    const promptTokens = this.estimateTokens(input);
-    const completionTokens = this.estimateTokens(responseContent);
+    this.checkPromptLength(request);
 
-    return {
-      id: generateChatCompletionId(),
+    // Each choice runs the model afresh, with a context of its own
+    const completed = await Promise.all(
+      Array.from({ length: request.n ?? 1 }, (_, index) => this.completeChoice(request, input, options, index))
+    );
+    const context = completed[0]!.context;
+    this.copyTransportHints(context, options.transport);
+
+    const promptTokens = context.promptTokens ?? this.countPromptTokens(request);
+    const completionTokens = completed.reduce((total, { completionTokens }) => total + completionTokens, 0);
+
+    const response: ChatCompletionResponse = {
+      id: (options.idPrefix ?? '') + generateChatCompletionId(this.idGenerator),
       object: 'chat.completion',
       created: getCurrentTimestamp(),
       model: this.modelId,
-      choices: [
-        {
-          index: 0,
-          message: {
-            role: 'assistant',
-            content: responseContent,
-          },
-          finish_reason: 'stop',
-        },
-      ],
+      service_tier: resolveServiceTier(request.service_tier),
+      system_fingerprint: this.systemFingerprint,
+      choices: completed.map(({ choice }) => choice),
       usage: {
         prompt_tokens: promptTokens,
         completion_tokens: completionTokens,
         total_tokens: promptTokens + completionTokens,
       },
     };
+    if (this.options.promptFilterResults) {
+      response.prompt_filter_results = this.promptFilterResults(this.options.promptFilterResults);
+    }
+    if (this.options.reflectParameters) {
+      response.x_parameters = this.resolveParameters(request);
+    }
+    return response;
   }
 
-  async *completeStream(request: ChatCompletionRequest): AsyncIterable<ChatCompletionStreamResponse> {
-    const input = this.extractTextFromMessages(request.messages);
-    const id = generateChatCompletionId();
-    const created = getCurrentTimestamp();
+  private async completeChoice(
+    request: ChatCompletionRequest,
+    input: string,
+    options: CompletionOptions,
+    index: number,
+  ): Promise<{ choice: ChatCompletionChoice; context: ModelContext; completionTokens: number }> {
+    const context = this.createContext(request, options, index);
 
-    // Send initial chunk with role
-    yield {
-      id,
-      object: 'chat.completion.chunk',
-      created,
-      model: this.modelId,
-      choices: [
-        {
-          index: 0,
-          delta: { role: 'assistant' },
-        },
-      ],
+    // Collect all chunks from the streaming model
+    const chunks: string[] = [];
+    let length = 0;
+    for await (const chunk of this.model.process(input, context)) {
+      const kept = this.capOutput(chunk, length, context);
+      chunks.push(kept);
+      length += kept.length;
+      if (kept !== chunk) {
+        break;
+      }
+    }
+
+    // A continuation keeps its leading space, which joins it to the prefill
+    const output = chunks.join('');
+    const responseContent = context.prefill === undefined ? output.trim() : output.trimEnd();
+    const message: ChatCompletionMessage = {
+      role: 'assistant',
+      content: responseContent,
     };
+    let finishReason: ChatCompletionFinishReason = 'stop';
 
-    // Stream content chunks
-    let totalContent = '';
-    for await (const chunk of this.model.process(input)) {
-      totalContent += chunk;
-      
-      yield {
-        id,
-        object: 'chat.completion.chunk',
-        created,
-        model: this.modelId,
-        choices: [
-          {
-            index: 0,
-            delta: { content: chunk },
-          },
-        ],
-      };
+    if (this.options.mirrorArrayContent && Array.isArray(this.findLastUserMessage(request.messages)?.content)) {
+      message.content = [{ type: 'output_text', text: responseContent }];
     }
 
-    // Send final chunk with finish reason and usage
-    const promptTokens = this.estimateTokens(input);
-    const completionTokens = this.estimateTokens(totalContent.trim());
+    if (context.citations?.length) {
+      message.annotations = this.annotations(context);
+    }
 
-    yield {
+    if (context.refusal !== undefined) {
+      message.content = null;
+      message.refusal = context.refusal;
+    }
+
+    if (context.toolCalls.length > 0) {
+      if (responseContent === '') {
+        message.content = null;
+      }
+      if (this.callsLegacyFunction(request, context)) {
+        // Legacy functions only ever allowed a single call
+        const call = context.toolCalls[0]!;
+        message.function_call = { name: call.name, arguments: call.arguments };
+        finishReason = 'function_call';
+      } else {
+        message.tool_calls = context.toolCalls.map((call) => ({
+          id: generateToolCallId(this.idGenerator),
+          type: 'function' as const,
+          function: { name: call.name, arguments: call.arguments },
+        }));
+        finishReason = 'tool_calls';
+      }
+    }
+
+    const completionTokens = this.completionTokens(
+      (responseContent + (context.refusal ?? '')).trim().length,
+      context,
+      context.finishReason ?? finishReason
+    );
+    const choice: ChatCompletionChoice = { index, message, finish_reason: context.finishReason ?? finishReason };
+    if (request.logprobs) {
+      choice.logprobs = this.logprobs(request, message.content === null ? null : responseContent, context.refusal);
+    }
+    return { choice, context, completionTokens };
+  }
+
+  async *completeStream(
+    request: ChatCompletionRequest,
+    options: CompletionOptions = {},
+  ): AsyncIterable<ChatCompletionStreamResponse> {
+    request = this.withModelDefaults(request);
+    const input = this.extractTextFromMessages(request.messages);
+    this.checkPromptLength(request);
+    const id = (options.idPrefix ?? '') + generateChatCompletionId(this.idGenerator);
+    const created = getCurrentTimestamp();
+    const serviceTier = resolveServiceTier(request.service_tier);
+    const chunkOf = (choice: ChatCompletionStreamChoice): ChatCompletionStreamResponse => ({
       id,
       object: 'chat.completion.chunk',
       created,
       model: this.modelId,
-      choices: [
-        {
-          index: 0,
-          delta: {},
-          finish_reason: 'stop',
-        },
-      ],
-      usage: {
+      service_tier: serviceTier,
+      system_fingerprint: this.systemFingerprint,
+      choices: [choice],
+    });
+
+    // Run the model up to its first chunk for every choice before sending
+    // anything, so errors it raises up front can still fail the request as
+    // a whole
+    const started = await Promise.allSettled(
+      Array.from({ length: request.n ?? 1 }, async (_, index): Promise<StartedChoice> => {
+        const context = this.createContext(request, options, index);
+        const chunks = this.model.process(input, context);
+        return { context, chunks, first: await chunks.next() };
+      })
+    );
+    const failed = started.find((result): result is PromiseRejectedResult => result.status === 'rejected');
+    const choices = started.flatMap((result) => (result.status === 'fulfilled' ? [result.value] : []));
+    if (failed) {
+      await Promise.allSettled(choices.map(({ chunks }) => chunks.return(undefined)));
+      throw failed.reason;
+    }
+    const context = choices[0]!.context;
+    this.copyTransportHints(context, options.transport);
+
+    // Send initial chunks with the role, one per choice
+    for (let index = 0; index < choices.length; index++) {
+      const first = chunkOf({
+        index,
+        delta: this.options.roleChunkContent ? { role: 'assistant', content: '' } : { role: 'assistant' },
+      });
+      if (index === 0 && this.options.promptFilterResults) {
+        first.prompt_filter_results = this.promptFilterResults(this.options.promptFilterResults);
+      }
+      if (index === 0 && this.options.reflectParameters) {
+        first.x_parameters = this.resolveParameters(request);
+      }
+      yield first;
+    }
+
+    // Choices stream side by side, each chunk sent as soon as its choice
+    // produces it; none of their content is kept beyond its length
+    let completionTokens = 0;
+    let unfinished = choices.length;
+    const streams = choices.map((choice, index) => this.streamChoice(request, options, choice, index, chunkOf));
+    for await (const event of interleave(streams)) {
+      if (!event.done) {
+        yield event.value;
+        continue;
+      }
+      if (event.value === undefined) {
+        // Nobody is listening any more, so don't bother finishing
+        return;
+      }
+
+      // Send each choice's final chunk with its finish reason, and the usage
+      // of them all on the last
+      completionTokens += event.value.completionTokens;
+      const finish = chunkOf({ index: event.index, delta: {}, finish_reason: event.value.finishReason });
+      if (--unfinished > 0) {
+        yield finish;
+        continue;
+      }
+      const promptTokens = context.promptTokens ?? this.countPromptTokens(request);
+      const usage = {
         prompt_tokens: promptTokens,
         completion_tokens: completionTokens,
         total_tokens: promptTokens + completionTokens,
-      },
+      };
+      yield { ...finish, usage };
+
+      // Clients that ask for stream_options.include_usage expect a separate
+      // trailing chunk with no choices that carries the usage
+      if (request.stream_options?.include_usage) {
+        yield { ...finish, choices: [], usage };
+      }
+    }
+  }
+
+  // Streams one choice's chunks after its role chunk, returning how it
+  // finished, or nothing if the client went away first
+  private async *streamChoice(
+    request: ChatCompletionRequest,
+    options: CompletionOptions,
+    { context, chunks, first }: StartedChoice,
+    index: number,
+    chunkOf: (choice: ChatCompletionStreamChoice) => ChatCompletionStreamResponse,
+  ): AsyncGenerator<ChatCompletionStreamResponse, StreamedChoice | undefined> {
+    const { signal } = options;
+
+    // Stream content chunks
+    const output = new OutputLength();
+    for (let next = first; !next.done; next = await chunks.next()) {
+      if (signal?.aborted) {
+        await chunks.return(undefined);
+        return undefined;
+      }
+      const kept = this.capOutput(next.value, output.length, context);
+      const capped = kept !== next.value;
+      output.add(kept);
+
+      for (const chunk of capped && kept === '' ? [] : splitContent(kept, options.chunking)) {
+        yield chunkOf({
+          index,
+          delta: { content: chunk },
+          ...(request.logprobs && { logprobs: this.logprobs(request, chunk, undefined) }),
+        });
+      }
+      if (capped) {
+        await chunks.return(undefined);
+        break;
+      }
+    }
+
+    // Citations follow the content they refer to
+    if (context.citations?.length) {
+      yield chunkOf({ index, delta: { annotations: this.annotations(context) } });
+    }
+
+    // Stream a refusal word by word, as it would arrive from a real model
+    if (context.refusal !== undefined) {
+      output.add(context.refusal);
+      for (const word of context.refusal.split(/(?<= )/)) {
+        yield chunkOf({
+          index,
+          delta: { refusal: word },
+          ...(request.logprobs && { logprobs: this.logprobs(request, null, word) }),
+        });
+      }
+    }
+
+    // Stream any tool calls the model requested once its content is done
+    let finishReason: ChatCompletionFinishReason = 'stop';
+    if (context.toolCalls.length > 0) {
+      const legacy = this.callsLegacyFunction(request, context);
+      finishReason = legacy ? 'function_call' : 'tool_calls';
+
+      const calls = legacy ? context.toolCalls.slice(0, 1) : context.toolCalls;
+      for (let callIndex = 0; callIndex < calls.length; callIndex++) {
+        const call = calls[callIndex]!;
+        // The name comes first, with the arguments whole or, when the model
+        // split them, in the deltas after it
+        const firstArguments = call.argumentChunks ? '' : call.arguments;
+        yield chunkOf({
+          index,
+          delta: legacy
+            ? { function_call: { name: call.name, arguments: firstArguments } }
+            : {
+                tool_calls: [
+                  {
+                    index: callIndex,
+                    id: generateToolCallId(this.idGenerator),
+                    type: 'function',
+                    function: { name: call.name, arguments: firstArguments },
+                  },
+                ],
+              },
+        });
+        for (const piece of call.argumentChunks ?? []) {
+          yield chunkOf({
+            index,
+            delta: legacy
+              ? { function_call: { arguments: piece } }
+              : { tool_calls: [{ index: callIndex, function: { arguments: piece } }] },
+          });
+        }
+      }
+    }
+
+    finishReason = context.finishReason ?? finishReason;
+    return { finishReason, completionTokens: this.completionTokens(output.trimmed, context, finishReason) };
+  }
+
+  // Logprobs for a piece of a choice's content or refusal; null for the one
+  // it doesn't have
+  private logprobs(
+    request: ChatCompletionRequest,
+    content: string | null,
+    refusal: string | undefined,
+  ): ChatCompletionLogprobs {
+    const topLogprobs = request.top_logprobs ?? 0;
+    return {
+      content: content === null ? null : tokenLogprobs(content, topLogprobs),
+      refusal: refusal === undefined ? null : tokenLogprobs(refusal, topLogprobs),
     };
   }
 
-  private extractTextFromMessages(messages: ChatCompletionMessage[]): string {
-    // Find the last user message
+  private annotations(context: ModelContext): ChatCompletionAnnotation[] {
+    return (context.citations ?? []).map((citation) => ({
+      type: 'url_citation',
+      url_citation: {
+        start_index: citation.startIndex,
+        end_index: citation.endIndex,
+        url: citation.url,
+        title: citation.title,
+      },
+    }));
+  }
+
+  // The prompt_tokens a completion of the request reports, unless its model
+  // counts its own, without running the model: the text the model is given,
+  // plus the formatting overhead of every message and of priming the reply
+  countPromptTokens(request: ChatCompletionRequest): number {
+    request = this.withModelDefaults(request);
+    const perMessage = this.options.tokensPerMessage ?? DEFAULT_TOKENS_PER_MESSAGE;
+    const replyPriming = this.options.replyPrimingTokens ?? DEFAULT_REPLY_PRIMING_TOKENS;
+    return (
+      this.estimateTokens(this.extractTextFromMessages(request.messages)) +
+      request.messages.length * perMessage +
+      replyPriming
+    );
+  }
+
+  // The request as this model runs it: with its forced parameters, and its
+  // default system prompt unless the request has a system message
+  private withModelDefaults(request: ChatCompletionRequest): ChatCompletionRequest {
+    const { forcedParameters: forced, defaultSystemPrompt: system } = this.options;
+    const effective = { ...request };
+    if (forced?.max_tokens !== undefined) {
+      effective.max_tokens = forced.max_tokens;
+    }
+    if (forced?.temperature !== undefined) {
+      effective.temperature = forced.temperature;
+    }
+    if (forced?.n !== undefined) {
+      effective.n = forced.n;
+    }
+    if (system !== undefined && !request.messages.some((message) => message.role === 'system')) {
+      effective.messages = [{ role: 'system', content: system }, ...request.messages];
+    }
+    return effective;
+  }
+
+  private checkPromptLength(request: ChatCompletionRequest): void {
+    const max = this.options.maxPromptTokens;
+    const promptTokens = this.countPromptTokens(request);
+    if (max !== undefined && promptTokens > max) {
+      throw new PromptTooLongError(promptTokens, max);
+    }
+  }
+
+  // Cuts a piece of output short if it would take the output past
+  // maxOutputTokens, finishing the completion with length
+  private capOutput(piece: string, outputLength: number, context: ModelContext): string {
+    const max = this.choiceOptionsAt(context.choiceIndex)?.maxOutputTokens ?? this.options.maxOutputTokens;
+    // The inverse of estimateTokens' 4 characters per token
+    const maxLength = max === undefined ? Infinity : max * 4;
+    if (outputLength + piece.length <= maxLength) {
+      return piece;
+    }
+    context.finishReason = 'length';
+    let end = Math.max(maxLength - outputLength, 0);
+    // Never leave half a surrogate pair at the end
+    const last = piece.charCodeAt(end - 1);
+    if (last >= 0xd800 && last <= 0xdbff) {
+      end--;
+    }
+    return piece.slice(0, end);
+  }
+
+  private copyTransportHints(context: ModelContext, transport: TransportHints | undefined): void {
+    if (!transport) {
+      return;
+    }
+    for (const [name, value] of Object.entries(context.responseHeaders ?? {})) {
+      transport.headers.set(name, value);
+    }
+    transport.sseVariants = context.sseVariants;
+  }
+
+  private choiceOptionsAt(index: number | undefined): ChoiceOptions | undefined {
+    const choices = this.options.choiceOptions;
+    return choices?.[(index ?? 0) % choices.length];
+  }
+
+  private createContext(request: ChatCompletionRequest, options: CompletionOptions, index: number): ModelContext {
+    const messages = request.messages.map((message) => ({
+      role: message.role,
+      content: contentToText(message.content),
+    }));
+    const prompt = this.choiceOptionsAt(index)?.defaultSystemPrompt;
+    if (prompt !== undefined && !messages.some((message) => message.role === 'system')) {
+      messages.unshift({ role: 'system', content: prompt });
+    }
+    const context = createModelContext(messages, this.resolveTools(request));
+    const system = messages.filter((message) => message.role === 'system').map((message) => message.content);
+    if (system.length > 0) {
+      context.system = system.join('\n\n');
+    }
+    const content = this.findLastUserMessage(request.messages)?.content;
+    if (Array.isArray(content)) {
+      context.images = content.flatMap((part) => (part.type === 'image_url' ? [part.image_url.url] : []));
+    }
+    context.responseFormat = request.response_format?.type;
+    context.seed = request.seed;
+    context.signal = options.signal;
+    context.timing = options.timing;
+    context.idempotencyKey = options.idempotencyKey;
+    context.requestHeaders = options.requestHeaders;
+    context.choiceIndex = index;
+
+    const last = request.messages[request.messages.length - 1];
+    const prefill = last?.role === 'assistant' ? contentToText(last.content) : '';
+    if (prefill !== '' && this.options.prefill !== false) {
+      context.prefill = prefill;
+    }
+    return context;
+  }
+
+  // Resolves the tools offered to the model, honouring tool_choice (or the
+  // legacy function_call) by withholding tools or narrowing to a named one.
+  private resolveTools(request: ChatCompletionRequest): ModelTool[] {
+    if (this.usesLegacyFunctions(request)) {
+      const functions = request.functions ?? [];
+      const choice = request.function_call;
+      if (choice === 'none') {
+        return [];
+      }
+      if (choice && typeof choice === 'object') {
+        return functions.filter((fn) => fn.name === choice.name);
+      }
+      return functions;
+    }
+
+    const tools = (request.tools ?? [])
+      .filter((tool) => tool.type === 'function')
+      .map((tool) => tool.function);
+    const choice = request.tool_choice;
+    if (choice === 'none') {
+      return [];
+    }
+    if (choice && typeof choice === 'object') {
+      return tools.filter((fn) => fn.name === choice.function.name);
+    }
+    return tools;
+  }
+
+  private usesLegacyFunctions(request: ChatCompletionRequest): boolean {
+    return !request.tools && Array.isArray(request.functions);
+  }
+
+  // Tool calls go out as a legacy function_call when the caller used the
+  // legacy fields, or when the model explicitly finished with one
+  private callsLegacyFunction(request: ChatCompletionRequest, context: ModelContext): boolean {
+    return this.usesLegacyFunctions(request) || context.finishReason === 'function_call';
+  }
+
+  private findLastUserMessage(messages: ChatCompletionMessage[]): ChatCompletionMessage | undefined {
     for (let i = messages.length - 1; i >= 0; i--) {
       if (messages[i]?.role === 'user') {
-        return messages[i]!.content;
+        return messages[i];
       }
     }
-    return '';
+    return undefined;
+  }
+
+  private extractTextFromMessages(messages: ChatCompletionMessage[]): string {
+    return contentToText(this.findLastUserMessage(messages)?.content ?? null);
+  }
+
+  // The request's sampling parameters, with configured or OpenAI defaults for
+  // the ones it left out
+  private resolveParameters(request: ChatCompletionRequest): ChatCompletionParameters {
+    const stop = request.stop;
+    return {
+      temperature: request.temperature ?? this.options.defaultTemperature ?? DEFAULT_TEMPERATURE,
+      top_p: request.top_p ?? this.options.defaultTopP ?? DEFAULT_TOP_P,
+      n: request.n ?? 1,
+      max_tokens: request.max_tokens ?? null,
+      stop: stop === undefined ? null : [stop].flat(),
+      seed: request.seed ?? null,
+    };
+  }
+
+  // Azure reports a filter result per prompt; chat completions have one,
+  // and each response gets its own copy of the configured results
+  private promptFilterResults(results: Record<string, ContentFilterResult>): PromptFilterResult[] {
+    return [{ prompt_index: 0, content_filter_results: structuredClone(results) }];
+  }
+
+  // Models may report their own count; otherwise estimate from the length
+  // of the output, trimmed. Only a completion that stopped without saying
+  // anything counts 0: one cut off or filtered before any output still
+  // generated the token it finished on
+  private completionTokens(outputLength: number, context: ModelContext, finishReason: ChatCompletionFinishReason): number {
+    if (context.completionTokens !== undefined) {
+      return context.completionTokens;
+    }
+    const estimated = tokensForLength(outputLength) + this.estimateToolCallTokens(context);
+    return estimated === 0 && finishReason !== 'stop' ? 1 : estimated;
+  }
+
+  private estimateToolCallTokens(context: ModelContext): number {
+    return context.toolCalls.reduce(
+      (total, call) => total + this.estimateTokens(call.name + call.arguments),
+      0,
+    );
   }
 
   private estimateTokens(text: string): number {
-    // Simple estimation: roughly 1 token per 4 characters
-    return Math.ceil(text.trim().length / 4);
+    return tokensForLength(text.trim().length);
+  }
+}
+
+// Simple estimation: roughly 1 token per 4 characters
+function tokensForLength(length: number): number {
+  return Math.ceil(length / 4);
+}
+
+// A choice whose model has been run up to its first chunk
+interface StartedChoice {
+  context: ModelContext;
+  chunks: AsyncGenerator<string>;
+  first: IteratorResult<string>;
+}
+
+// How a streamed choice finished
+interface StreamedChoice {
+  finishReason: ChatCompletionFinishReason;
+  completionTokens: number;
+}
+
+// Tracks the length of streamed output, and of the output trimmed, without
+// keeping the output itself
+class OutputLength {
+  length = 0;
+  private leading = 0;
+  private trailing = 0;
+  private started = false;
+
+  add(text: string): void {
+    this.length += text.length;
+    const end = text.trimEnd().length;
+    if (end === 0) {
+      // Nothing but whitespace, which belongs to either end
+      if (this.started) {
+        this.trailing += text.length;
+      } else {
+        this.leading += text.length;
+      }
+      return;
+    }
+    if (!this.started) {
+      this.leading += text.length - text.trimStart().length;
+      this.started = true;
+    }
+    this.trailing = text.length - end;
+  }
+
+  // The length of the output with its leading and trailing whitespace trimmed
+  get trimmed(): number {
+    return this.started ? this.length - this.leading - this.trailing : 0;
   }
-}
\ No newline at end of file
+}
@@ -9,22 +9,30 @@ export const ErrorTypes = {
   RATE_LIMIT: 'rate_limit_error',
   API_ERROR: 'api_error',
   OVERLOADED: 'overloaded_error',
+  INSUFFICIENT_QUOTA: 'insufficient_quota',
 } as const;
 
 export type ErrorType = typeof ErrorTypes[keyof typeof ErrorTypes];
 
+// How much detail error messages carry: 'terse' suits production, 'verbose'
+// appends context such as the offending value to help during development
+export type ErrorVerbosity = 'terse' | 'verbose';
+
 export class APIError extends Error {
   public readonly type: ErrorType;
   public readonly param?: string | undefined;
   public readonly code?: string | undefined;
   public readonly statusCode: number;
+  // Extra context only shown in verbose mode
+  public readonly detail?: string | undefined;
 
   constructor(
     message: string,
     type: ErrorType,
     statusCode: number = 400,
     param?: string | undefined,
-    code?: string | undefined
+    code?: string | undefined,
+    detail?: string | undefined
   ) {
     super(message);
     this.name = 'APIError';
@@ -32,11 +40,12 @@ export class APIError extends Error {
     this.param = param;
     this.code = code;
     this.statusCode = statusCode;
+    this.detail = detail;
   }
 
-  toErrorResponse(): ErrorResponse {
+  toErrorResponse(verbosity: ErrorVerbosity = 'terse'): ErrorResponse {
     const error: any = {
-      message: this.message,
+      message: verbosity === 'verbose' && this.detail ? `${this.message} (${this.detail})` : this.message,
       type: this.type,
     };
     
@@ -54,8 +63,32 @@ export class APIError extends Error {
 
 // Specific error classes
 export class InvalidRequestError extends APIError {
-  constructor(message: string, param?: string) {
-    super(message, ErrorTypes.INVALID_REQUEST, 400, param);
+  constructor(message: string, param?: string, detail?: string) {
+    super(message, ErrorTypes.INVALID_REQUEST, 400, param, undefined, detail);
+  }
+}
+
+export class RequestTooLargeError extends APIError {
+  constructor(maxBytes: number) {
+    super(
+      `Request body too large: limit is ${maxBytes} bytes`,
+      ErrorTypes.INVALID_REQUEST,
+      413,
+      undefined,
+      'request_too_large'
+    );
+  }
+}
+
+export class PromptTooLongError extends APIError {
+  constructor(promptTokens: number, maxPromptTokens: number) {
+    super(
+      `Prompt is too long: ${promptTokens} prompt tokens exceeds the limit of ${maxPromptTokens}`,
+      ErrorTypes.INVALID_REQUEST,
+      400,
+      'messages',
+      'prompt_too_long'
+    );
   }
 }
 
@@ -65,14 +98,103 @@ export class AuthenticationError extends APIError {
   }
 }
 
+// An OpenAI-Organization or OpenAI-Project the server doesn't know
+export class InvalidOrganizationError extends APIError {
+  constructor(message: string) {
+    super(message, ErrorTypes.INVALID_REQUEST, 401, undefined, 'invalid_organization');
+  }
+}
+
 export class NotFoundError extends APIError {
   constructor(message: string) {
     super(message, ErrorTypes.NOT_FOUND, 404);
   }
 }
 
+// An Idempotency-Key reused with a different request body; the original
+// response is only replayed for the request it answered
+export class IdempotencyConflictError extends APIError {
+  constructor(
+    message: string = 'This Idempotency-Key was already used with a different request body; use a new key for a new request'
+  ) {
+    super(message, ErrorTypes.INVALID_REQUEST, 409, undefined, 'idempotency_key_conflict');
+  }
+}
+
+export class RateLimitError extends APIError {
+  // Sent as the Retry-After header
+  public readonly retryAfterSeconds: number;
+
+  constructor(retryAfterSeconds: number, message: string = 'Rate limit reached, please retry later') {
+    super(message, ErrorTypes.RATE_LIMIT, 429, undefined, 'rate_limit_exceeded');
+    this.retryAfterSeconds = retryAfterSeconds;
+  }
+}
+
+// Sent once a key's token budget is spent; unlike RateLimitError retrying
+// won't help, which clients tell apart by the type and code
+export class InsufficientQuotaError extends APIError {
+  constructor(
+    message: string = 'You exceeded your current quota, please check your plan and billing details.'
+  ) {
+    super(message, ErrorTypes.INSUFFICIENT_QUOTA, 429, undefined, 'insufficient_quota');
+  }
+}
+
+export class OverloadedError extends APIError {
+  constructor(message: string = 'Server is overloaded, please retry later') {
+    super(message, ErrorTypes.OVERLOADED, 503);
+  }
+}
+
+// Sent while the server is in maintenance mode; retryable after the
+// Retry-After header's seconds
+export class ServiceUnavailableError extends APIError {
+  public readonly retryAfterSeconds: number;
+
+  constructor(
+    retryAfterSeconds: number,
+    message: string = 'The server is down for maintenance, please retry later'
+  ) {
+    super(message, ErrorTypes.API_ERROR, 503, undefined, 'service_unavailable');
+    this.retryAfterSeconds = retryAfterSeconds;
+  }
+}
+
+export class ModelUnavailableError extends APIError {
+  constructor(model: string) {
+    super(
+      `Model ${model} is temporarily unavailable: its health check is failing`,
+      ErrorTypes.API_ERROR,
+      503,
+      'model',
+      'model_unavailable'
+    );
+  }
+}
+
 export class InternalServerError extends APIError {
   constructor(message: string = 'Internal server error') {
     super(message, ErrorTypes.API_ERROR, 500);
   }
-}
\ No newline at end of file
+}
+
+// An error with an arbitrary status, typed to match what a real API would
+// send with that status
+export function statusError(status: number, message: string, code?: string): APIError {
+  const types: Record<number, ErrorType> = {
+    401: ErrorTypes.AUTHENTICATION,
+    403: ErrorTypes.PERMISSION,
+    404: ErrorTypes.NOT_FOUND,
+    429: ErrorTypes.RATE_LIMIT,
+    503: ErrorTypes.OVERLOADED,
+  };
+  const type = types[status] ?? (status < 500 ? ErrorTypes.INVALID_REQUEST : ErrorTypes.API_ERROR);
+  return new APIError(message, type, status, undefined, code);
+}
+
+// Describes a value for a verbose error detail, truncated to keep messages short
+export function describeValue(value: unknown, maxLength: number = 100): string {
+  const text = value === undefined ? 'undefined' : JSON.stringify(value) ?? String(value);
+  return text.length > maxLength ? `${text.slice(0, maxLength)}...` : text;
+}
@@ -0,0 +1,206 @@
+import { describe, it, expect } from "vitest";
+import { validateChatCompletionRequest } from "./request-validation.js";
+import { APIError } from "./errors.js";
+import { OpenAIAdapter } from "./adapter.js";
+import { encodeSSEJson } from "./sse.js";
+import { EchoModel } from "../models/echo-model.js";
+import { seededRandom } from "../utils/random.js";
+import type { ChatCompletionRequest } from "./types.js";
+
+/**
+ * Seeded fuzz tests for the request decoder and SSE writer.
+ *
+ * Each run explores FUZZ_ITERATIONS random inputs (default kept small so CI
+ * stays fast) from a fixed seed, so every run tries the same inputs; set
+ * FUZZ_SEED to explore others or reproduce a failure, or raise the iteration
+ * count for a longer local fuzzing session.
+ */
+const ITERATIONS = Number(process.env.FUZZ_ITERATIONS ?? 2000);
+const DEFAULT_SEED = 1174;
+const SEED = Number(process.env.FUZZ_SEED ?? DEFAULT_SEED);
+
+// Deterministic, so failures can be replayed by seed
+function createRandom(seed: number) {
+  const next = seededRandom(seed);
+  const int = (max: number) => Math.floor(next() * max);
+  const pick = <T,>(items: T[]): T => items[int(items.length)]!;
+  return { next, int, pick };
+}
+
+type Random = ReturnType<typeof createRandom>;
+
+const INTERESTING_STRINGS = [
+  "",
+  "user",
+  "assistant",
+  "system",
+  "tool",
+  "function",
+  "echo",
+  "none",
+  "auto",
+  "required",
+  "\u0000",
+  "\r\n",
+  "data: [DONE]\n\n",
+  "👋🏽",
+  "é",
+  "\ud800",
+  "x".repeat(1000),
+];
+
+function randomString(random: Random): string {
+  if (random.next() < 0.5) {
+    return random.pick(INTERESTING_STRINGS);
+  }
+  let result = "";
+  const length = random.int(20);
+  for (let i = 0; i < length; i++) {
+    // Mix ASCII, control characters, BMP and astral code points
+    const range = random.pick([0x20, 0x80, 0x800, 0x10000, 0x110000]);
+    const codePoint = random.int(range);
+    result +=
+      codePoint >= 0xd800 && codePoint <= 0xdfff
+        ? String.fromCharCode(codePoint) // Lone surrogate
+        : String.fromCodePoint(codePoint);
+  }
+  return result;
+}
+
+function randomValue(random: Random, depth = 0): unknown {
+  const kinds = depth > 4 ? 5 : 7;
+  switch (random.int(kinds)) {
+    case 0:
+      return null;
+    case 1:
+      return random.next() < 0.5;
+    case 2:
+      return random.pick([0, -1, 1.5, 1e308, NaN, 2 ** 53]);
+    case 3:
+    case 4:
+      return randomString(random);
+    case 5:
+      return Array.from({ length: random.int(4) }, () => randomValue(random, depth + 1));
+    default: {
+      const object: Record<string, unknown> = {};
+      const keys = ["model", "messages", "role", "content", "tools", "function", "name", "stream"];
+      for (let i = random.int(5); i > 0; i--) {
+        object[random.pick(keys)] = randomValue(random, depth + 1);
+      }
+      return object;
+    }
+  }
+}
+
+const SEED_REQUESTS: unknown[] = [
+  { model: "echo", messages: [{ role: "user", content: "Hello" }] },
+  { model: "echo", messages: [{ role: "user", content: "Hi" }], stream: true },
+  {
+    model: "echo",
+    messages: [
+      { role: "system", content: "Be brief" },
+      { role: "user", content: [{ type: "text", text: "array content" }] },
+    ],
+  },
+  {
+    model: "echo",
+    messages: [
+      { role: "user", content: "weather?" },
+      {
+        role: "assistant",
+        content: null,
+        tool_calls: [{ id: "call_1", type: "function", function: { name: "w", arguments: "{}" } }],
+      },
+      { role: "tool", tool_call_id: "call_1", content: "sunny" },
+    ],
+    tools: [{ type: "function", function: { name: "w", parameters: { type: "object" } } }],
+    tool_choice: { type: "function", function: { name: "w" } },
+  },
+  {
+    model: "echo",
+    messages: [{ role: "user", content: "legacy" }],
+    functions: [{ name: "f" }],
+    function_call: { name: "f" },
+  },
+];
+
+// Replaces a random nested value in a copy of the seed
+function mutate(random: Random, value: unknown, depth = 0): unknown {
+  if (depth > 0 && random.next() < 0.3) {
+    return randomValue(random);
+  }
+  if (Array.isArray(value)) {
+    const copy = value.map((item) => mutate(random, item, depth + 1));
+    if (random.next() < 0.2) copy.push(randomValue(random));
+    return copy;
+  }
+  if (value && typeof value === "object") {
+    const copy: Record<string, unknown> = {};
+    for (const [key, item] of Object.entries(value)) {
+      if (random.next() < 0.1) continue; // Drop the field
+      copy[key] = mutate(random, item, depth + 1);
+    }
+    return copy;
+  }
+  return value;
+}
+
+async function drain<T>(iterable: AsyncIterable<T>): Promise<T[]> {
+  const items: T[] = [];
+  for await (const item of iterable) items.push(item);
+  return items;
+}
+
+describe(`Fuzzing (seed ${SEED})`, () => {
+  it("should validate arbitrary request bodies without crashing", async () => {
+    const random = createRandom(SEED);
+    const adapter = new OpenAIAdapter(new EchoModel(), "echo");
+
+    for (let i = 0; i < ITERATIONS; i++) {
+      const body =
+        random.next() < 0.7 ? mutate(random, random.pick(SEED_REQUESTS)) : randomValue(random);
+
+      let request: ChatCompletionRequest;
+      try {
+        request = validateChatCompletionRequest(body);
+      } catch (error) {
+        // Rejections must be structured 400s, never incidental TypeErrors
+        expect(error, JSON.stringify(body)).toBeInstanceOf(APIError);
+        expect((error as APIError).statusCode).toBe(400);
+        continue;
+      }
+
+      // Anything accepted must be safe to run through the adapter
+      const response = await adapter.complete(request);
+      expect(response.choices).toHaveLength(1);
+      const chunks = await drain(adapter.completeStream(request));
+      expect(chunks.length).toBeGreaterThan(1);
+    }
+  });
+
+  it("should frame arbitrary content as SSE that reassembles exactly", () => {
+    const random = createRandom(SEED);
+    const decoder = new TextDecoder();
+
+    for (let i = 0; i < ITERATIONS; i++) {
+      const contents = Array.from({ length: 1 + random.int(5) }, () => randomString(random));
+      const stream = contents
+        .map((content) => decoder.decode(encodeSSEJson({ choices: [{ delta: { content } }] })))
+        .join("");
+
+      // Every event is a single data line followed by a blank line
+      const events = stream.split("\n\n");
+      expect(events.pop()).toBe("");
+      expect(events).toHaveLength(contents.length);
+      for (const event of events) {
+        expect(event.startsWith("data: ")).toBe(true);
+        expect(event).not.toMatch(/[\r\n]/);
+      }
+
+      const reassembled = events
+        .map((event) => JSON.parse(event.slice("data: ".length)).choices[0].delta.content)
+        .join("");
+      expect(reassembled).toBe(contents.join(""));
+    }
+  });
+});
@@ -0,0 +1,40 @@
+import { describe, it, expect } from "vitest";
+import { RandomIdGenerator, randomString } from "./ids.js";
+
+describe("RandomIdGenerator", () => {
+  it("should prefix ids and keep the OpenAI id length", () => {
+    const id = new RandomIdGenerator().generate("chatcmpl-");
+
+    expect(id).toMatch(/^chatcmpl-[a-zA-Z0-9]{29}$/);
+  });
+
+  it("should never repeat across many concurrent callers", async () => {
+    const generator = new RandomIdGenerator();
+    const workers = Array.from({ length: 10 }, async () => {
+      const ids: string[] = [];
+      for (let i = 0; i < 30_000; i++) {
+        ids.push(generator.generate("chatcmpl-"));
+        if (i % 1000 === 0) {
+          await Promise.resolve(); // Interleave with the other workers
+        }
+      }
+      return ids;
+    });
+
+    const ids = (await Promise.all(workers)).flat();
+
+    expect(ids).toHaveLength(300_000);
+    expect(new Set(ids).size).toBe(300_000);
+  });
+
+  it("should keep ids unique within the same millisecond", () => {
+    const generator = new RandomIdGenerator(0);
+    const ids = Array.from({ length: 1000 }, () => generator.generate(""));
+
+    expect(new Set(ids).size).toBe(1000);
+  });
+
+  it("should generate random strings from the alphanumeric charset", () => {
+    expect(randomString(64)).toMatch(/^[a-zA-Z0-9]{64}$/);
+  });
+});
@@ -0,0 +1,49 @@
+/**
+ * Generates unique, prefixed identifiers such as `chatcmpl-...`
+ *
+ * Injectable so tests can substitute predictable ids.
+ */
+export interface IdGenerator {
+  generate(prefix: string): string;
+}
+
+const CHARSET = 'abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789';
+const TIME_LENGTH = 9;
+const COUNTER_LENGTH = 5;
+const COUNTER_LIMIT = 36 ** COUNTER_LENGTH;
+
+/**
+ * Collision-resistant ids built from three parts:
+ *
+ * - the millisecond timestamp (base36), so ids sort roughly by creation time
+ * - a per-generator counter (base36), so ids minted in the same millisecond
+ *   by this generator never collide
+ * - random characters from crypto.getRandomValues, so ids from different
+ *   generators or processes are vanishingly unlikely to collide
+ */
+export class RandomIdGenerator implements IdGenerator {
+  private counter = 0;
+
+  constructor(private randomLength: number = 15) {}
+
+  generate(prefix: string): string {
+    const time = Date.now().toString(36).padStart(TIME_LENGTH, '0');
+    const counter = this.counter.toString(36).padStart(COUNTER_LENGTH, '0');
+    this.counter = (this.counter + 1) % COUNTER_LIMIT;
+    return `${prefix}${time}${counter}${randomString(this.randomLength)}`;
+  }
+}
+
+export function randomString(length: number): string {
+  const bytes = new Uint8Array(length);
+  globalThis.crypto.getRandomValues(bytes);
+
+  let result = '';
+  for (const byte of bytes) {
+    // The slight modulo bias doesn't matter: uniqueness comes from the counter
+    result += CHARSET.charAt(byte % CHARSET.length);
+  }
+  return result;
+}
+
+export const defaultIdGenerator: IdGenerator = new RandomIdGenerator();
@@ -0,0 +1,83 @@
+import { describe, it, expect } from "vitest";
+import { minimalChunk, minimalCompletion } from "./minimal.js";
+import type { ChatCompletionResponse, ChatCompletionStreamResponse } from "./types.js";
+
+const citation = {
+  type: "url_citation" as const,
+  url_citation: { start_index: 0, end_index: 4, url: "https://example.com", title: "Example" },
+};
+const logprobs = { content: [], refusal: null };
+
+describe("minimalCompletion", () => {
+  it("should keep the output but none of the optional fields", () => {
+    const response: ChatCompletionResponse = {
+      id: "chatcmpl-1",
+      object: "chat.completion",
+      created: 1,
+      model: "echo",
+      service_tier: "default",
+      system_fingerprint: "fp_0000000000",
+      usage: { prompt_tokens: 1, completion_tokens: 2, total_tokens: 3 },
+      x_parameters: { temperature: 1, top_p: 1, n: 1, max_tokens: null, stop: null, seed: null },
+      choices: [
+        {
+          index: 0,
+          message: {
+            role: "assistant",
+            content: null,
+            tool_calls: [{ id: "call_1", type: "function", function: { name: "f", arguments: "{}" } }],
+            annotations: [citation],
+          },
+          finish_reason: "tool_calls",
+          logprobs,
+        },
+      ],
+    };
+
+    expect(minimalCompletion(response)).toEqual({
+      id: "chatcmpl-1",
+      object: "chat.completion",
+      created: 1,
+      model: "echo",
+      choices: [
+        {
+          index: 0,
+          message: {
+            role: "assistant",
+            content: null,
+            tool_calls: [{ id: "call_1", type: "function", function: { name: "f", arguments: "{}" } }],
+          },
+          finish_reason: "tool_calls",
+          logprobs,
+        },
+      ],
+    });
+  });
+});
+
+describe("minimalChunk", () => {
+  const chunk = (choices: ChatCompletionStreamResponse["choices"]): ChatCompletionStreamResponse => ({
+    id: "chatcmpl-1",
+    object: "chat.completion.chunk",
+    created: 1,
+    model: "echo",
+    service_tier: "default",
+    system_fingerprint: "fp_0000000000",
+    usage: { prompt_tokens: 1, completion_tokens: 2, total_tokens: 3 },
+    choices,
+  });
+
+  it("should strip chunks to their choices' deltas", () => {
+    expect(minimalChunk(chunk([{ index: 0, delta: { annotations: [citation] }, finish_reason: "stop" }]))).toEqual({
+      id: "chatcmpl-1",
+      object: "chat.completion.chunk",
+      created: 1,
+      model: "echo",
+      choices: [{ index: 0, delta: {}, finish_reason: "stop" }],
+    });
+  });
+
+  it("should have nothing to send for the include_usage chunk", () => {
+    expect(minimalChunk(chunk([]))).toBeUndefined();
+  });
+});
@@ -0,0 +1,68 @@
+import type {
+  ChatCompletionChoice,
+  ChatCompletionMessage,
+  ChatCompletionResponse,
+  ChatCompletionStreamChoice,
+  ChatCompletionStreamDelta,
+  ChatCompletionStreamResponse,
+} from './types.js';
+
+// A chat completion with just enough to read its output: no usage,
+// system_fingerprint, service_tier or extensions
+export type MinimalChatCompletion = Pick<ChatCompletionResponse, 'id' | 'object' | 'created' | 'model'> & {
+  choices: ChatCompletionChoice[];
+};
+
+export type MinimalChatCompletionChunk = Pick<ChatCompletionStreamResponse, 'id' | 'object' | 'created' | 'model'> & {
+  choices: ChatCompletionStreamChoice[];
+};
+
+/**
+ * A completion cut down to what a client can't do without, for testing that
+ * clients cope with sparse responses. The output itself is kept whole:
+ * content, refusals, tool calls and the logprobs a request asked for.
+ */
+export function minimalCompletion(response: ChatCompletionResponse): MinimalChatCompletion {
+  const { id, object, created, model, choices } = response;
+  return {
+    id,
+    object,
+    created,
+    model,
+    choices: choices.map(({ index, message, finish_reason, logprobs }) => ({
+      index,
+      message: minimalMessage(message),
+      finish_reason,
+      ...(logprobs !== undefined && { logprobs }),
+    })),
+  };
+}
+
+// The same for a streamed chunk; the stream_options.include_usage chunk,
+// which carries nothing but usage, has nothing left to send
+export function minimalChunk(chunk: ChatCompletionStreamResponse): MinimalChatCompletionChunk | undefined {
+  const { id, object, created, model, choices } = chunk;
+  if (choices.length === 0) {
+    return undefined;
+  }
+  return {
+    id,
+    object,
+    created,
+    model,
+    choices: choices.map(({ index, delta, finish_reason, logprobs }) => ({
+      index,
+      delta: minimalDelta(delta),
+      ...(finish_reason !== undefined && { finish_reason }),
+      ...(logprobs !== undefined && { logprobs }),
+    })),
+  };
+}
+
+function minimalMessage({ annotations: _annotations, ...message }: ChatCompletionMessage): ChatCompletionMessage {
+  return message;
+}
+
+function minimalDelta({ annotations: _annotations, ...delta }: ChatCompletionStreamDelta): ChatCompletionStreamDelta {
+  return delta;
+}
@@ -1,21 +1,105 @@
 import type { Model as OpenAIModel, ModelsResponse } from './types.js';
 import { ModelRegistry } from '../models/model-registry.js';
-import { Model } from '../models/model.js';
+import { Model, ModelCapabilities } from '../models/model.js';
 import { OpenAIAdapter } from './adapter.js';
+import type { AdapterOptions } from './adapter.js';
+import { systemFingerprint } from '../utils/fingerprint.js';
 
 // OpenAI-specific model registry that wraps the core registry
 export class OpenAIModelRegistry {
   private adapters = new Map<string, OpenAIAdapter>();
+  private fingerprints = new Map<string, string>();
+  private registrations = new Map<
+    string,
+    { capabilities: ModelCapabilities; settings: unknown; adapterOptions: AdapterOptions }
+  >();
 
-  constructor(private coreRegistry: ModelRegistry) {}
+  constructor(
+    private coreRegistry: ModelRegistry,
+    private adapterOptions: AdapterOptions = {}
+  ) {}
 
-  register(id: string, model: Model): void {
+  // Settings are the options the model was built with; they go into its
+  // system_fingerprint. Adapter options apply to this model only, over the
+  // registry's. Registering an id again replaces the model.
+  register(
+    id: string,
+    model: Model,
+    capabilities: ModelCapabilities = {},
+    settings?: unknown,
+    adapterOptions: AdapterOptions = {}
+  ): void {
     // Register in core registry
-    this.coreRegistry.register(id, model);
+    this.coreRegistry.register(id, model, capabilities);
     
     // Create OpenAI adapter
-    const adapter = new OpenAIAdapter(model, id);
+    const fingerprint = systemFingerprint(id, settings);
+    const adapter = new OpenAIAdapter(model, id, {
+      ...this.adapterOptions,
+      ...adapterOptions,
+      systemFingerprint: fingerprint,
+      prefill: capabilities.supportsPrefill ?? true,
+    });
     this.adapters.set(id, adapter);
+    this.fingerprints.set(id, fingerprint);
+    this.registrations.set(id, { capabilities, settings, adapterOptions });
+  }
+
+  // Replaces a model with a wrapper around it, such as modelware, keeping the
+  // capabilities it doesn't override; the wrapper's settings join the
+  // model's in its system_fingerprint. False if there's no such model.
+  decorate(id: string, wrap: (model: Model) => Model, settings: unknown, capabilities: ModelCapabilities = {}): boolean {
+    const model = this.coreRegistry.get(id);
+    const registration = this.registrations.get(id);
+    if (!model || !registration) {
+      return false;
+    }
+    this.register(
+      id,
+      wrap(model),
+      { ...registration.capabilities, ...capabilities },
+      { model: registration.settings, decoration: settings },
+      registration.adapterOptions
+    );
+    return true;
+  }
+
+  // Registers a model built on another one, such as a virtual model: the
+  // wrapped base under a new id, with the base's capabilities and settings
+  // joined by its own. False if there's no such base.
+  derive(
+    id: string,
+    base: string,
+    wrap: (model: Model) => Model,
+    settings: unknown,
+    adapterOptions: AdapterOptions = {}
+  ): boolean {
+    const model = this.coreRegistry.get(base);
+    const registration = this.registrations.get(base);
+    if (!model || !registration) {
+      return false;
+    }
+    this.register(
+      id,
+      wrap(model),
+      registration.capabilities,
+      { base: registration.settings, derived: settings },
+      { ...registration.adapterOptions, ...adapterOptions }
+    );
+    return true;
+  }
+
+  // The options a model was registered with, over the registry's
+  adapterOptionsFor(id: string): AdapterOptions | undefined {
+    const registration = this.registrations.get(id);
+    return registration && { ...this.adapterOptions, ...registration.adapterOptions };
+  }
+
+  unregister(id: string): void {
+    this.coreRegistry.unregister(id);
+    this.adapters.delete(id);
+    this.fingerprints.delete(id);
+    this.registrations.delete(id);
   }
 
   get(id: string): OpenAIAdapter | undefined {
@@ -26,6 +110,18 @@ export class OpenAIModelRegistry {
     return this.coreRegistry.has(id);
   }
 
+  supportsStreaming(id: string): boolean {
+    return this.coreRegistry.getMetadata(id)?.supportsStreaming ?? false;
+  }
+
+  isDeterministic(id: string): boolean {
+    return this.coreRegistry.getMetadata(id)?.deterministic ?? false;
+  }
+
+  fingerprint(id: string): string | undefined {
+    return this.fingerprints.get(id);
+  }
+
   list(): OpenAIModel[] {
     return this.coreRegistry.getIds().map(id => {
       const meta = this.coreRegistry.getMetadata(id)!;
@@ -34,6 +130,7 @@ export class OpenAIModelRegistry {
         object: 'model' as const,
         created: meta.created,
         owned_by: meta.ownedBy,
+        system_fingerprint: this.fingerprints.get(id)!,
       };
     });
   }
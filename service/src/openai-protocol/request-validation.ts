@@ -0,0 +1,323 @@
+import type { ChatCompletionRequest, EmbeddingRequest } from './types.js';
+import { EMBEDDING_ENCODING_FORMATS, MAX_CHOICES, MAX_TOP_LOGPROBS, SERVICE_TIERS } from './types.js';
+import { describeValue, InvalidRequestError } from './errors.js';
+
+const ROLES = ['system', 'user', 'assistant', 'tool', 'function'];
+
+function isObject(value: unknown): value is Record<string, any> {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
+
+function isFunctionDefinition(value: unknown): boolean {
+  return isObject(value) && typeof value.name === 'string';
+}
+
+function isContentPart(value: unknown): boolean {
+  if (!isObject(value)) {
+    return false;
+  }
+  if (value.type === 'text') {
+    return typeof value.text === 'string';
+  }
+  if (value.type === 'image_url') {
+    return isObject(value.image_url) && typeof value.image_url.url === 'string';
+  }
+  return false;
+}
+
+/**
+ * Validates a decoded chat completion request body.
+ *
+ * Accepts any JSON value and either returns it as a well-formed request or
+ * throws an InvalidRequestError naming the offending parameter, so nothing
+ * downstream has to defend against malformed shapes.
+ */
+export function validateChatCompletionRequest(body: unknown, maxChoices = MAX_CHOICES): ChatCompletionRequest {
+  if (!isObject(body)) {
+    throw new InvalidRequestError('Request body must be a JSON object', undefined, `got ${describeValue(body)}`);
+  }
+  const request = body as ChatCompletionRequest;
+
+  // Validate required fields
+  if (!request.model) {
+    throw new InvalidRequestError('Missing required parameter: model', 'model');
+  }
+
+  if (typeof request.model !== 'string') {
+    throw new InvalidRequestError("Invalid 'model': must be a string", 'model', `got ${describeValue(request.model)}`);
+  }
+
+  if (!request.messages || (Array.isArray(request.messages) && request.messages.length === 0)) {
+    throw new InvalidRequestError('Missing required parameter: messages', 'messages');
+  }
+
+  if (!Array.isArray(request.messages)) {
+    throw new InvalidRequestError(
+      "Invalid 'messages': must be an array",
+      'messages',
+      `got ${describeValue(request.messages)}`
+    );
+  }
+
+  // Validate message structure
+  for (let i = 0; i < request.messages.length; i++) {
+    const message = request.messages[i];
+
+    if (!isObject(message)) {
+      throw new InvalidRequestError(
+        `Invalid message at index ${i}: must be an object`,
+        'messages',
+        `got ${describeValue(message)}`
+      );
+    }
+
+    if (!message.role) {
+      throw new InvalidRequestError(`Invalid message at index ${i}: missing required field 'role'`, 'messages');
+    }
+
+    if (typeof message.role !== 'string' || !ROLES.includes(message.role)) {
+      throw new InvalidRequestError(
+        `Invalid message at index ${i}: 'role' must be one of 'system', 'user', 'assistant', 'tool', or 'function'`,
+        'messages',
+        `got ${describeValue(message.role)}`
+      );
+    }
+
+    // Assistant turns that only carry tool calls have no content
+    const callsTools =
+      message.role === 'assistant' && (message.tool_calls !== undefined || message.function_call !== undefined);
+    if (callsTools && message.content === null) {
+      continue;
+    }
+
+    if (message.content === undefined || message.content === null) {
+      throw new InvalidRequestError(`Invalid message at index ${i}: missing required field 'content'`, 'messages');
+    }
+
+    if (Array.isArray(message.content)) {
+      const invalid = message.content.findIndex((part) => !isContentPart(part));
+      if (invalid !== -1) {
+        throw new InvalidRequestError(
+          `Invalid message at index ${i}: content part ${invalid} must be {type: 'text', text} or {type: 'image_url', image_url: {url}}`,
+          'messages',
+          `got ${describeValue(message.content[invalid])}`
+        );
+      }
+    } else if (typeof message.content !== 'string') {
+      throw new InvalidRequestError(
+        `Invalid message at index ${i}: 'content' must be a string or an array of content parts`,
+        'messages',
+        `got ${describeValue(message.content)}`
+      );
+    }
+  }
+
+  // Validate tool definitions, which the adapter reads without further checks
+  if (request.tools !== undefined) {
+    if (
+      !Array.isArray(request.tools) ||
+      !request.tools.every((tool) => isObject(tool) && isFunctionDefinition(tool.function))
+    ) {
+      throw new InvalidRequestError(
+        "Invalid 'tools': must be an array of {type: 'function', function: {name}} objects",
+        'tools',
+        `got ${describeValue(request.tools)}`
+      );
+    }
+  }
+
+  const toolChoice: unknown = request.tool_choice;
+  if (
+    toolChoice !== undefined &&
+    !['none', 'auto', 'required'].includes(toolChoice as string) &&
+    !(isObject(toolChoice) && isFunctionDefinition(toolChoice.function))
+  ) {
+    throw new InvalidRequestError(
+      "Invalid 'tool_choice': must be 'none', 'auto', 'required' or {type: 'function', function: {name}}",
+      'tool_choice',
+      `got ${describeValue(toolChoice)}`
+    );
+  }
+
+  if (request.functions !== undefined) {
+    if (!Array.isArray(request.functions) || !request.functions.every(isFunctionDefinition)) {
+      throw new InvalidRequestError(
+        "Invalid 'functions': must be an array of {name} objects",
+        'functions',
+        `got ${describeValue(request.functions)}`
+      );
+    }
+  }
+
+  const functionCall: unknown = request.function_call;
+  if (
+    functionCall !== undefined &&
+    !['none', 'auto'].includes(functionCall as string) &&
+    !isFunctionDefinition(functionCall)
+  ) {
+    throw new InvalidRequestError(
+      "Invalid 'function_call': must be 'none', 'auto' or {name}",
+      'function_call',
+      `got ${describeValue(functionCall)}`
+    );
+  }
+
+  const streamOptions: unknown = request.stream_options;
+  if (
+    streamOptions !== undefined &&
+    !(isObject(streamOptions) && ['undefined', 'boolean'].includes(typeof streamOptions.include_usage))
+  ) {
+    throw new InvalidRequestError(
+      "Invalid 'stream_options': must be an object with an optional boolean 'include_usage'",
+      'stream_options',
+      `got ${describeValue(streamOptions)}`
+    );
+  }
+
+  const serviceTier: unknown = request.service_tier;
+  if (serviceTier !== undefined && !(SERVICE_TIERS as readonly unknown[]).includes(serviceTier)) {
+    throw new InvalidRequestError(
+      `Invalid 'service_tier': must be one of ${SERVICE_TIERS.map((tier) => `'${tier}'`).join(', ')}`,
+      'service_tier',
+      `got ${describeValue(serviceTier)}`
+    );
+  }
+
+  const n: unknown = request.n;
+  if (n !== undefined && !(typeof n === 'number' && Number.isInteger(n) && n >= 1 && n <= maxChoices)) {
+    throw new InvalidRequestError(
+      `Invalid 'n': must be an integer from 1 to ${maxChoices}`,
+      'n',
+      `got ${describeValue(n)}`
+    );
+  }
+
+  const logprobs: unknown = request.logprobs;
+  if (logprobs !== undefined && typeof logprobs !== 'boolean') {
+    throw new InvalidRequestError("Invalid 'logprobs': must be a boolean", 'logprobs', `got ${describeValue(logprobs)}`);
+  }
+
+  const topLogprobs: unknown = request.top_logprobs;
+  if (topLogprobs !== undefined) {
+    if (
+      !(
+        typeof topLogprobs === 'number' &&
+        Number.isInteger(topLogprobs) &&
+        topLogprobs >= 0 &&
+        topLogprobs <= MAX_TOP_LOGPROBS
+      )
+    ) {
+      throw new InvalidRequestError(
+        `Invalid 'top_logprobs': must be an integer from 0 to ${MAX_TOP_LOGPROBS}`,
+        'top_logprobs',
+        `got ${describeValue(topLogprobs)}`
+      );
+    }
+    if (logprobs !== true) {
+      throw new InvalidRequestError("Invalid 'top_logprobs': requires 'logprobs' to be true", 'top_logprobs');
+    }
+  }
+
+  const seed: unknown = request.seed;
+  if (seed !== undefined && !(typeof seed === 'number' && Number.isSafeInteger(seed))) {
+    throw new InvalidRequestError("Invalid 'seed': must be an integer", 'seed', `got ${describeValue(seed)}`);
+  }
+
+  const responseFormat: unknown = request.response_format;
+  if (
+    responseFormat !== undefined &&
+    !(isObject(responseFormat) && ['text', 'json_object', 'json_schema'].includes(responseFormat.type))
+  ) {
+    throw new InvalidRequestError(
+      "Invalid 'response_format': must be {type: 'text'}, {type: 'json_object'} or {type: 'json_schema'}",
+      'response_format',
+      `got ${describeValue(responseFormat)}`
+    );
+  }
+
+  return request;
+}
+
+// Validates a decoded embeddings request body, like validateChatCompletionRequest
+export function validateEmbeddingRequest(body: unknown, maxDimensions: number, maxBatchSize: number): EmbeddingRequest {
+  if (!isObject(body)) {
+    throw new InvalidRequestError('Request body must be a JSON object', undefined, `got ${describeValue(body)}`);
+  }
+  const request = body as EmbeddingRequest;
+
+  if (!request.model) {
+    throw new InvalidRequestError('Missing required parameter: model', 'model');
+  }
+
+  if (typeof request.model !== 'string') {
+    throw new InvalidRequestError("Invalid 'model': must be a string", 'model', `got ${describeValue(request.model)}`);
+  }
+
+  const input: unknown = request.input;
+  if (input === undefined) {
+    throw new InvalidRequestError('Missing required parameter: input', 'input');
+  }
+
+  if (
+    !(typeof input === 'string' && input !== '') &&
+    !(Array.isArray(input) && input.length > 0 && input.every((item) => typeof item === 'string' && item !== ''))
+  ) {
+    throw new InvalidRequestError(
+      "Invalid 'input': must be a non-empty string or array of non-empty strings",
+      'input',
+      `got ${describeValue(input)}`
+    );
+  }
+
+  if (Array.isArray(input) && input.length > maxBatchSize) {
+    throw new InvalidRequestError(
+      `Invalid 'input': at most ${maxBatchSize} inputs may be embedded per request`,
+      'input',
+      `got ${input.length} inputs`
+    );
+  }
+
+  const dimensions: unknown = request.dimensions;
+  if (
+    dimensions !== undefined &&
+    !(typeof dimensions === 'number' && Number.isInteger(dimensions) && dimensions >= 1 && dimensions <= maxDimensions)
+  ) {
+    throw new InvalidRequestError(
+      `Invalid 'dimensions': must be an integer from 1 to ${maxDimensions}`,
+      'dimensions',
+      `got ${describeValue(dimensions)}`
+    );
+  }
+
+  const encodingFormat: unknown = request.encoding_format;
+  if (encodingFormat !== undefined && !(EMBEDDING_ENCODING_FORMATS as readonly unknown[]).includes(encodingFormat)) {
+    throw new InvalidRequestError(
+      `Invalid 'encoding_format': must be one of ${EMBEDDING_ENCODING_FORMATS.map((format) => `'${format}'`).join(', ')}`,
+      'encoding_format',
+      `got ${describeValue(encodingFormat)}`
+    );
+  }
+
+  return request;
+}
+
+// Lets clients group their requests by the ids they get back
+export const RESPONSE_ID_PREFIX_HEADER = 'X-Response-ID-Prefix';
+
+const RESPONSE_ID_PREFIX = /^[A-Za-z0-9._-]{1,64}$/;
+
+// Validates an X-Response-ID-Prefix header value: up to 64 letters, digits,
+// dots, underscores or hyphens, so prefixed ids stay safe in URLs and logs
+export function validateResponseIdPrefix(value: string | undefined): string | undefined {
+  if (value === undefined) {
+    return undefined;
+  }
+  if (!RESPONSE_ID_PREFIX.test(value)) {
+    throw new InvalidRequestError(
+      `Invalid ${RESPONSE_ID_PREFIX_HEADER} header: must be 1 to 64 letters, digits, '.', '_' or '-'`,
+      RESPONSE_ID_PREFIX_HEADER,
+      `got ${describeValue(value)}`
+    );
+  }
+  return value;
+}
@@ -0,0 +1,30 @@
+import { bench, describe } from "vitest";
+import { encodeSSEJson } from "./sse.js";
+
+// Run with: npm run bench
+const chunk = {
+  id: "chatcmpl-abcdefghijklmnopqrstuvwxyz012",
+  object: "chat.completion.chunk",
+  created: 1700000000,
+  model: "echo",
+  choices: [{ index: 0, delta: { content: " streaming" } }],
+};
+
+const encoder = new TextEncoder();
+
+const encodings: [string, () => Uint8Array][] = [
+  ["template string + TextEncoder", () => encoder.encode(`data: ${JSON.stringify(chunk)}\n\n`)],
+  ["encodeSSEJson", () => encodeSSEJson(chunk)],
+];
+
+describe("SSE chunk encoding", () => {
+  for (const [name, encode] of encodings) {
+    // What each event keeps allocated is the buffer behind the bytes sent,
+    // which may be larger than they are; the bench's name reports both
+    const bytes = encode();
+
+    bench(`${name}, ${bytes.buffer.byteLength} bytes allocated for ${bytes.length} sent`, () => {
+      encode();
+    });
+  }
+});
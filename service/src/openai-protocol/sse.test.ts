@@ -0,0 +1,99 @@
+import { describe, it, expect } from "vitest";
+import { encodeSSEData, encodeSSEJson, SSE_DONE, SSEFramer } from "./sse.js";
+import type { SSEVariant } from "./sse.js";
+import { parseSSEData } from "../conformance/conformance.js";
+
+const decode = (bytes: Uint8Array) => new TextDecoder().decode(bytes);
+
+describe("SSE encoding", () => {
+  it("should frame a payload as a data event", () => {
+    expect(decode(encodeSSEData("hello"))).toBe("data: hello\n\n");
+  });
+
+  it("should encode JSON values", () => {
+    expect(decode(encodeSSEJson({ a: 1 }))).toBe('data: {"a":1}\n\n');
+  });
+
+  it("should encode multibyte content exactly", () => {
+    const payload = JSON.stringify({ content: "héllo 👋 世界" });
+    const bytes = encodeSSEData(payload);
+
+    expect(decode(bytes)).toBe(`data: ${payload}\n\n`);
+    expect(bytes.length).toBe(new TextEncoder().encode(`data: ${payload}\n\n`).length);
+  });
+
+  it("should allocate exactly the bytes it returns", () => {
+    for (const payload of ["hello", "héllo 👋 世界", "lone \ud83d surrogate \udc4b", "trailing \ud83d"]) {
+      const bytes = encodeSSEData(payload);
+
+      expect(bytes.buffer.byteLength).toBe(bytes.length);
+      expect(bytes).toEqual(new TextEncoder().encode(`data: ${payload}\n\n`));
+    }
+  });
+
+  it("should provide the DONE terminator", () => {
+    expect(decode(SSE_DONE)).toBe("data: [DONE]\n\n");
+  });
+});
+
+describe("SSEFramer", () => {
+  const value = { content: "héllo 👋", n: [1, 2] };
+  const frame = (variant: SSEVariant) =>
+    new SSEFramer([variant]).event(value).map(decode).join("");
+
+  it.each([
+    ["crlf", `data: ${JSON.stringify(value)}\r\n\r\n`],
+    ["cr", `data: ${JSON.stringify(value)}\r\r`],
+    ["comments", `: before\ndata: ${JSON.stringify(value)}\n: inside\n\n`],
+    ["fields", `id: 1\nretry: 1000\ndata: ${JSON.stringify(value)}\n\n`],
+    ["nospace", `data:${JSON.stringify(value)}\n\n`],
+    ["split", `data: ${JSON.stringify(value)}\n\n`],
+  ] as const)("should frame the %s variant exactly", (variant, expected) => {
+    expect(frame(variant)).toBe(expected);
+  });
+
+  it("should spread multiline data over several data lines", () => {
+    const framed = frame("multiline");
+
+    expect(framed.match(/^data: /gm)!.length).toBeGreaterThan(1);
+    expect(JSON.parse(parseSSEData(framed)[0]!)).toEqual(value);
+  });
+
+  it("should split events into several small writes", () => {
+    const pieces = new SSEFramer(["split"]).event(value);
+
+    expect(pieces.length).toBeGreaterThan(1);
+    expect(pieces.every((piece) => piece.length <= 7)).toBe(true);
+  });
+
+  it("should split events inside their first multibyte character", () => {
+    const strict = new TextDecoder("utf-8", { fatal: true });
+    const pieces = new SSEFramer(["midchar"]).event(value);
+
+    expect(pieces).toHaveLength(2);
+    // "é" is C3 A9: the first piece ends on its lead byte
+    expect(pieces[0]![pieces[0]!.length - 1]).toBe(0xc3);
+    expect(() => strict.decode(pieces[0]!)).toThrow();
+    expect(strict.decode(new Uint8Array([...pieces[0]!, ...pieces[1]!]))).toBe(`data: ${JSON.stringify(value)}\n\n`);
+    expect(new SSEFramer(["midchar"]).event({ content: "ascii" })).toHaveLength(1);
+
+    const emoji = new SSEFramer(["midchar"]).event({ content: "👋" });
+    expect(decode(emoji[0]!)).toMatch(/"content":"\uFFFD$/);
+    expect(emoji.map(decode).join("")).not.toContain("👋");
+    expect(strict.decode(new Uint8Array([...emoji[0]!, ...emoji[1]!]))).toBe('data: {"content":"👋"}\n\n');
+  });
+
+  it("should only start the stream with a BOM for the bom variant", () => {
+    expect(new SSEFramer(["bom"]).start().map(decode)).toEqual(["\uFEFF"]);
+    expect(new SSEFramer(["crlf"]).start()).toEqual([]);
+    expect(decode(new SSEFramer(["bom"]).event(value)[0]!)).toBe(`data: ${JSON.stringify(value)}\n\n`);
+  });
+
+  it("should rotate through the variants event by event", () => {
+    const framer = new SSEFramer(["crlf", "nospace"]);
+
+    const framed = [1, 2, 3].map((n) => framer.event(n).map(decode).join(""));
+
+    expect(framed).toEqual(["data: 1\r\n\r\n", "data:2\n\n", "data: 3\r\n\r\n"]);
+  });
+});
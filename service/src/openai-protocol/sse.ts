@@ -0,0 +1,153 @@
+const encoder = new TextEncoder();
+const DATA_PREFIX = encoder.encode('data: ');
+const EVENT_TERMINATOR = encoder.encode('\n\n');
+const FRAMING_BYTES = DATA_PREFIX.length + EVENT_TERMINATOR.length;
+
+/**
+ * Frames a payload as a single SSE `data:` event, encoded as UTF-8.
+ *
+ * Each event costs one buffer allocation, sized exactly: the prefix, payload
+ * and terminator are encoded straight into it rather than via an
+ * intermediate template string. The payload must not contain newlines -
+ * JSON.stringify output never does.
+ */
+export function encodeSSEData(payload: string): Uint8Array {
+  const buffer = new Uint8Array(FRAMING_BYTES + utf8Length(payload));
+  buffer.set(DATA_PREFIX, 0);
+  const { written } = encoder.encodeInto(payload, buffer.subarray(DATA_PREFIX.length));
+  buffer.set(EVENT_TERMINATOR, DATA_PREFIX.length + written);
+  return buffer;
+}
+
+// Bytes TextEncoder turns a string into, lone surrogates becoming the 3
+// bytes of U+FFFD
+function utf8Length(text: string): number {
+  let bytes = text.length;
+  for (let i = 0; i < text.length; i++) {
+    const code = text.charCodeAt(i);
+    if (code < 0x80) {
+      continue;
+    }
+    if (code < 0x800) {
+      bytes += 1;
+    } else if (code <= 0xdbff && code >= 0xd800 && isLowSurrogate(text.charCodeAt(i + 1))) {
+      // A pair's two code units become 4 bytes
+      bytes += 2;
+      i++;
+    } else {
+      bytes += 2;
+    }
+  }
+  return bytes;
+}
+
+function isLowSurrogate(code: number): boolean {
+  return code >= 0xdc00 && code <= 0xdfff;
+}
+
+export function encodeSSEJson(value: unknown): Uint8Array {
+  return encodeSSEData(JSON.stringify(value));
+}
+
+export const SSE_DONE = encodeSSEData('[DONE]');
+
+// A comment line, which clients ignore but which keeps idle proxies and
+// read timeouts from dropping a quiet stream
+export const SSE_HEARTBEAT = encoder.encode(': keep-alive\n\n');
+
+/**
+ * Unusual but spec-legal ways of framing SSE events, for hardening client
+ * parsers (see the sse-torture model). Every variant decodes to exactly the
+ * same data as the standard `data: <payload>\n\n` framing:
+ *
+ * - crlf:      lines end in CRLF instead of LF
+ * - cr:        lines end in a lone CR
+ * - multiline: the JSON is pretty-printed over several `data:` lines, which
+ *              parsers must rejoin with newlines
+ * - comments:  `:` comment lines before and inside the event
+ * - fields:    `id:` and `retry:` fields alongside `data:`
+ * - nospace:   `data:<payload>` without the optional space
+ * - split:     the event is written in several small pieces, so it arrives
+ *              across separate network packets
+ * - midchar:   the event is written in two pieces split inside its first
+ *              multibyte character, so clients decoding each read on its
+ *              own garble it; events without one are written whole
+ * - bom:       the stream starts with a UTF-8 byte order mark
+ */
+export const SSE_VARIANTS = ['crlf', 'cr', 'multiline', 'comments', 'fields', 'nospace', 'split', 'midchar', 'bom'] as const;
+
+export type SSEVariant = typeof SSE_VARIANTS[number];
+
+export function isSSEVariant(value: string): value is SSEVariant {
+  return (SSE_VARIANTS as readonly string[]).includes(value);
+}
+
+// Bytes per write when splitting an event
+const SPLIT_SIZE = 7;
+
+/**
+ * Frames successive JSON events, rotating through the given variants. The
+ * bom variant only affects the start of the stream; the rest apply per event.
+ */
+export class SSEFramer {
+  private eventVariants: SSEVariant[];
+  private next = 0;
+
+  constructor(private variants: SSEVariant[]) {
+    this.eventVariants = variants.filter((variant) => variant !== 'bom');
+  }
+
+  // Bytes to write before the first event
+  start(): Uint8Array[] {
+    return this.variants.includes('bom') ? [encoder.encode('\uFEFF')] : [];
+  }
+
+  // One event, as the pieces to write in order
+  event(value: unknown): Uint8Array[] {
+    const variant = this.eventVariants[this.next++ % Math.max(this.eventVariants.length, 1)];
+    const payload = JSON.stringify(value);
+
+    switch (variant) {
+      case 'crlf':
+        return [encoder.encode(`data: ${payload}\r\n\r\n`)];
+      case 'cr':
+        return [encoder.encode(`data: ${payload}\r\r`)];
+      case 'multiline': {
+        const lines = JSON.stringify(value, null, 1).split('\n');
+        return [encoder.encode(`${lines.map((line) => `data: ${line}\n`).join('')}\n`)];
+      }
+      case 'comments':
+        return [encoder.encode(`: before\ndata: ${payload}\n: inside\n\n`)];
+      case 'fields':
+        return [encoder.encode(`id: ${this.next}\nretry: 1000\ndata: ${payload}\n\n`)];
+      case 'nospace':
+        return [encoder.encode(`data:${payload}\n\n`)];
+      case 'split': {
+        const bytes = encodeSSEData(payload);
+        const pieces: Uint8Array[] = [];
+        for (let offset = 0; offset < bytes.length; offset += SPLIT_SIZE) {
+          pieces.push(bytes.subarray(offset, offset + SPLIT_SIZE));
+        }
+        return pieces;
+      }
+      case 'midchar': {
+        const bytes = encodeSSEData(payload);
+        const split = midCharacterOffset(bytes);
+        return split === undefined ? [bytes] : [bytes.subarray(0, split), bytes.subarray(split)];
+      }
+      default:
+        return [encodeSSEData(payload)];
+    }
+  }
+}
+
+// An offset halfway through the first multibyte UTF-8 sequence, if any
+function midCharacterOffset(bytes: Uint8Array): number | undefined {
+  const start = bytes.findIndex((byte) => byte >= 0xc0);
+  if (start === -1) {
+    return undefined;
+  }
+  const lead = bytes[start]!;
+  const length = lead >= 0xf0 ? 4 : lead >= 0xe0 ? 3 : 2;
+  return start + Math.ceil(length / 2);
+}
@@ -0,0 +1,181 @@
+import { describe, it, expect } from "vitest";
+import { writeChatCompletionStream } from "./stream-writer.js";
+import type { SSEEvent } from "./stream-writer.js";
+import type { ChatCompletionStreamResponse } from "./types.js";
+import { parseTimeline } from "../utils/stream-scenarios.js";
+import type { ScenarioClock } from "../utils/stream-scenarios.js";
+
+const decode = (event: SSEEvent) =>
+  event.pieces.map((piece) => new TextDecoder().decode(piece)).join("");
+
+const chunk = (
+  content: string,
+  usage?: ChatCompletionStreamResponse["usage"]
+): ChatCompletionStreamResponse => ({
+  id: "chatcmpl-1",
+  object: "chat.completion.chunk",
+  created: 0,
+  model: "echo",
+  service_tier: "default",
+  system_fingerprint: "fp_0000000000",
+  choices: [{ index: 0, delta: { content } }],
+  ...(usage ? { usage } : {}),
+});
+
+async function* chunks(...contents: string[]) {
+  for (const content of contents) {
+    yield chunk(content);
+  }
+  yield chunk("", { prompt_tokens: 1, completion_tokens: 2, total_tokens: 3 });
+}
+
+// Records events instead of writing them anywhere
+function recorder() {
+  const events: SSEEvent[] = [];
+  const sink = {
+    write: async (event: SSEEvent) => {
+      events.push(event);
+    },
+  };
+  return { events, sink };
+}
+
+describe("writeChatCompletionStream", () => {
+  it("should write one event per chunk and then [DONE]", async () => {
+    const { events, sink } = recorder();
+
+    const result = await writeChatCompletionStream(chunks("Hello", " world"), sink);
+
+    expect(events.map((event) => event.kind)).toEqual(["chunk", "chunk", "chunk", "done"]);
+    expect(decode(events[0]!)).toBe(`data: ${JSON.stringify(chunk("Hello"))}\n\n`);
+    expect(events[0]!.value).toEqual(chunk("Hello"));
+    expect(decode(events[3]!)).toBe("data: [DONE]\n\n");
+    expect(result).toEqual({
+      content: "Hello world",
+      usage: { prompt_tokens: 1, completion_tokens: 2, total_tokens: 3 },
+      dropped: 0,
+    });
+  });
+
+  it("should leave out the chunks it's told to drop, still counting them", async () => {
+    const { events, sink } = recorder();
+
+    const result = await writeChatCompletionStream(chunks("Hello", " world"), sink, {
+      drop: (chunk) => chunk.choices[0]?.delta.content === " world",
+    });
+
+    expect(events.map((event) => event.kind)).toEqual(["chunk", "chunk", "done"]);
+    expect(events[1]!.value).toEqual(chunk("", { prompt_tokens: 1, completion_tokens: 2, total_tokens: 3 }));
+    expect(result).toMatchObject({ content: "Hello world", dropped: 1 });
+  });
+
+  it("should frame events with the requested variants", async () => {
+    const { events, sink } = recorder();
+
+    await writeChatCompletionStream(chunks("Hi"), sink, { variants: ["bom", "split"] });
+
+    expect(events[0]).toEqual({ kind: "preamble", pieces: [new TextEncoder().encode("\uFEFF")] });
+    expect(events[1]!.kind).toBe("chunk");
+    expect(events[1]!.pieces.length).toBeGreaterThan(1);
+    expect(decode(events[1]!)).toBe(`data: ${JSON.stringify(chunk("Hi"))}\n\n`);
+  });
+
+  it("should write heartbeats while a scenario stalls", async () => {
+    let now = 0;
+    const clock: ScenarioClock = {
+      now: () => now,
+      sleep: async (ms) => {
+        now += ms;
+      },
+    };
+    const { events, sink } = recorder();
+
+    await writeChatCompletionStream(chunks("Hi"), sink, {
+      scenario: parseTimeline("stall 1s"),
+      scenarioOptions: { clock, heartbeatMs: 400 },
+    });
+
+    expect(events.map((event) => event.kind)).toEqual([
+      "heartbeat",
+      "heartbeat",
+      "chunk",
+      "chunk",
+      "done",
+    ]);
+    expect(decode(events[0]!)).toBe(": keep-alive\n\n");
+  });
+
+  it("should end with an error event when the chunks fail part way", async () => {
+    const { events, sink } = recorder();
+    async function* failing() {
+      yield chunk("partial");
+      throw new Error("model crashed");
+    }
+
+    const result = await writeChatCompletionStream(failing(), sink);
+
+    expect(events.map((event) => event.kind)).toEqual(["chunk", "error"]);
+    expect(events[1]!.value).toEqual({ error: { message: "Streaming failed", type: "api_error" } });
+    expect(result.error).toEqual(new Error("model crashed"));
+    expect(result.content).toBe("partial");
+  });
+
+  it("should include the request id in the error event", async () => {
+    const { events, sink } = recorder();
+    async function* failing() {
+      yield chunk("partial");
+      throw new Error("model crashed");
+    }
+
+    await writeChatCompletionStream(failing(), sink, { requestId: "req-123" });
+
+    expect(events[1]!.value).toEqual({
+      error: { message: "Streaming failed", type: "api_error", request_id: "req-123" },
+    });
+    expect(decode(events[1]!)).toContain('"request_id":"req-123"');
+  });
+
+  it("should report pacing in the include_usage chunk only", async () => {
+    const times = [12, 15, 25, 27];
+    const { events, sink } = recorder();
+    const usage = { prompt_tokens: 1, completion_tokens: 2, total_tokens: 3 };
+    async function* withUsageChunk() {
+      yield* chunks("Hello", " world");
+      yield { ...chunk("", usage), choices: [] };
+    }
+
+    const result = await writeChatCompletionStream(withUsageChunk(), sink, { clock: () => times.shift()! });
+
+    expect(events.map((event) => event.kind)).toEqual(["chunk", "chunk", "chunk", "chunk", "done"]);
+    expect(events[2]!.value).toEqual(chunk("", usage));
+    expect(events[3]!.value).toEqual({
+      ...chunk("", {
+        ...usage,
+        teenytiny: {
+          chunk_count: 4,
+          duration_ms: 27,
+          time_to_first_chunk_ms: 12,
+          inter_chunk_gap_ms: { min: 2, mean: 5, max: 10 },
+        },
+      }),
+      choices: [],
+    });
+    expect(result.usage).toEqual(usage);
+  });
+
+  it("should report no gaps for a lone usage chunk", async () => {
+    const { events, sink } = recorder();
+    async function* onlyUsage() {
+      yield { ...chunk("", { prompt_tokens: 1, completion_tokens: 0, total_tokens: 1 }), choices: [] };
+    }
+
+    await writeChatCompletionStream(onlyUsage(), sink, { clock: () => 3 });
+
+    expect((events[0]!.value as ChatCompletionStreamResponse).usage?.teenytiny).toEqual({
+      chunk_count: 1,
+      duration_ms: 3,
+      time_to_first_chunk_ms: 3,
+      inter_chunk_gap_ms: null,
+    });
+  });
+});
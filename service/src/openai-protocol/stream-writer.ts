@@ -0,0 +1,175 @@
+import type { ChatCompletionStreamResponse, ChatCompletionUsage, StreamPacing } from './types.js';
+import { encodeSSEJson, SSE_DONE, SSE_HEARTBEAT, SSEFramer } from './sse.js';
+import type { SSEVariant } from './sse.js';
+import { runScenario } from '../utils/stream-scenarios.js';
+import type { ScenarioOptions, ScenarioStep } from '../utils/stream-scenarios.js';
+import { minimalChunk } from './minimal.js';
+
+// What an event is for: bytes before the first chunk (e.g. a BOM), a
+// completion chunk, a keep-alive comment during a stall, the [DONE]
+// terminator, or the error that replaces it when the stream fails
+export type SSEEventKind = 'preamble' | 'chunk' | 'heartbeat' | 'done' | 'error';
+
+export interface SSEEvent {
+  kind: SSEEventKind;
+  // Written in order: several for the split framing variant, otherwise one
+  pieces: Uint8Array[];
+  // The object serialized into chunk and error events
+  value?: unknown;
+}
+
+// Where events go: the HTTP response, or a recording of them
+export interface SSESink {
+  write(event: SSEEvent): Promise<void>;
+}
+
+export interface StreamWriterOptions {
+  // Framing variants the model asked for (see the sse-torture model)
+  variants?: SSEVariant[] | undefined;
+  // Stalls and bursts to replay the chunks under; heartbeats during stalls
+  // are written to the sink
+  scenario?: ScenarioStep[] | undefined;
+  scenarioOptions?: Omit<ScenarioOptions, 'onHeartbeat'> | undefined;
+  // Sent as request_id in the error event, matching the X-Request-ID
+  // header and the logs, so clients can report which request failed
+  requestId?: string | undefined;
+  // Milliseconds since the request arrived, for the pacing reported in the
+  // usage chunk; timed from the start of writing when unset
+  clock?: (() => number) | undefined;
+  // Send chunks cut down to their essentials (see minimalChunk), dropping
+  // the include_usage chunk; the result still reports the usage
+  minimal?: boolean | undefined;
+  // Leaves out the chunks it says to, simulating packet loss (see
+  // chunkDropper); the result still counts their content and usage
+  drop?: ((chunk: ChatCompletionStreamResponse) => boolean) | undefined;
+}
+
+export interface StreamResult {
+  // From the final chunk; undefined when the stream failed before it
+  usage: ChatCompletionUsage | undefined;
+  // The first choice's content; with n the others are streamed but not kept
+  content: string;
+  // What the chunks threw, if they did; an error event was written in place
+  // of [DONE]
+  error?: unknown;
+  // How many chunks drop left out
+  dropped: number;
+}
+
+/**
+ * Writes a streamed chat completion as SSE events: any preamble the framing
+ * needs, one event per chunk, then [DONE]. Once the response has started a
+ * failure can't change its status, so if the chunks throw part way an error
+ * event is written instead of [DONE] and the error returned. Nothing here
+ * knows about HTTP, so the chat completions endpoint and the trace endpoint
+ * produce exactly the same events.
+ */
+export async function writeChatCompletionStream(
+  chunks: AsyncGenerator<ChatCompletionStreamResponse>,
+  sink: SSESink,
+  options: StreamWriterOptions = {}
+): Promise<StreamResult> {
+  const framer = options.variants?.length ? new SSEFramer(options.variants) : undefined;
+  const streamed = options.scenario
+    ? runScenario(chunks, options.scenario, {
+        ...options.scenarioOptions,
+        onHeartbeat: () => sink.write({ kind: 'heartbeat', pieces: [SSE_HEARTBEAT] }),
+      })
+    : chunks;
+
+  const result: StreamResult = { usage: undefined, content: '', dropped: 0 };
+  const pacing = new PacingRecorder(options.clock ?? stopwatch());
+  try {
+    const preamble = framer?.start() ?? [];
+    if (preamble.length > 0) {
+      await sink.write({ kind: 'preamble', pieces: preamble });
+    }
+
+    for await (const chunk of streamed) {
+      if (chunk.usage) {
+        result.usage = chunk.usage;
+      }
+      for (const choice of chunk.choices) {
+        if (choice.index === 0) {
+          result.content += choice.delta.content ?? '';
+        }
+      }
+
+      if (options.drop?.(chunk)) {
+        result.dropped++;
+        continue;
+      }
+
+      // The usage chunk clients ask for with stream_options.include_usage
+      // reports the pacing alongside the standard fields
+      pacing.record();
+      const sent = options.minimal
+        ? minimalChunk(chunk)
+        : chunk.usage && chunk.choices.length === 0
+          ? { ...chunk, usage: { ...chunk.usage, teenytiny: pacing.stats() } }
+          : chunk;
+      if (sent === undefined) {
+        continue;
+      }
+      await sink.write({ kind: 'chunk', pieces: framer ? framer.event(sent) : [encodeSSEJson(sent)], value: sent });
+    }
+
+    await sink.write({ kind: 'done', pieces: [SSE_DONE] });
+  } catch (error) {
+    result.error = error;
+    const value = {
+      error: {
+        message: 'Streaming failed',
+        type: 'api_error',
+        ...(options.requestId !== undefined && { request_id: options.requestId }),
+      },
+    };
+    await sink.write({ kind: 'error', pieces: [encodeSSEJson(value)], value });
+  }
+  return result;
+}
+
+function stopwatch(): () => number {
+  const start = performance.now();
+  return () => performance.now() - start;
+}
+
+// Times chunk writes, keeping running totals rather than every time
+class PacingRecorder {
+  private count = 0;
+  private first = 0;
+  private last = 0;
+  private minGap = Infinity;
+  private maxGap = 0;
+
+  constructor(private clock: () => number) {}
+
+  record(): void {
+    const now = this.clock();
+    if (this.count === 0) {
+      this.first = now;
+    } else {
+      const gap = now - this.last;
+      this.minGap = Math.min(this.minGap, gap);
+      this.maxGap = Math.max(this.maxGap, gap);
+    }
+    this.last = now;
+    this.count++;
+  }
+
+  stats(): StreamPacing {
+    const gaps = this.count - 1;
+    return {
+      chunk_count: this.count,
+      duration_ms: round(this.last),
+      time_to_first_chunk_ms: round(this.first),
+      inter_chunk_gap_ms: gaps > 0
+        ? { min: round(this.minGap), mean: round((this.last - this.first) / gaps), max: round(this.maxGap) }
+        : null,
+    };
+  }
+}
+
+function round(ms: number): number {
+  return Math.round(ms * 100) / 100;
+}
@@ -1,32 +1,230 @@
 // OpenAI-compatible API types for chat completions
 
+import { defaultIdGenerator, randomString } from './ids.js';
+import type { IdGenerator } from './ids.js';
+
+export type ChatCompletionRole = 'system' | 'user' | 'assistant' | 'tool' | 'function';
+
+export interface ChatCompletionFunctionCall {
+  name: string;
+  arguments: string;
+}
+
+export interface ChatCompletionToolCall {
+  id: string;
+  type: 'function';
+  function: ChatCompletionFunctionCall;
+}
+
+export interface ChatCompletionTextPart {
+  type: 'text';
+  text: string;
+}
+
+export interface ChatCompletionImagePart {
+  type: 'image_url';
+  image_url: { url: string; detail?: 'auto' | 'low' | 'high' };
+}
+
+// Used in responses that mirror array-form request content
+export interface ChatCompletionOutputTextPart {
+  type: 'output_text';
+  text: string;
+}
+
+export type ChatCompletionContentPart =
+  | ChatCompletionTextPart
+  | ChatCompletionImagePart
+  | ChatCompletionOutputTextPart;
+
+// A source the model cites for part of its content; indices count Unicode
+// code points in the content, with the end exclusive
+export interface ChatCompletionURLCitation {
+  type: 'url_citation';
+  url_citation: {
+    start_index: number;
+    end_index: number;
+    url: string;
+    title: string;
+  };
+}
+
+export type ChatCompletionAnnotation = ChatCompletionURLCitation;
+
 export interface ChatCompletionMessage {
-  role: 'system' | 'user' | 'assistant';
-  content: string;
+  role: ChatCompletionRole;
+  content: string | ChatCompletionContentPart[] | null;
+  name?: string;
+  tool_calls?: ChatCompletionToolCall[];
+  tool_call_id?: string;
+  // Deprecated in favour of tool_calls, still sent by older clients
+  function_call?: ChatCompletionFunctionCall;
+  // Set instead of content when the model declines to answer
+  refusal?: string | null;
+  // Citations for spans of the content, e.g. from web-search models
+  annotations?: ChatCompletionAnnotation[];
+}
+
+export interface ChatCompletionFunctionDefinition {
+  name: string;
+  description?: string;
+  parameters?: Record<string, unknown>;
+}
+
+export interface ChatCompletionTool {
+  type: 'function';
+  function: ChatCompletionFunctionDefinition;
+}
+
+export type ChatCompletionToolChoice =
+  | 'none'
+  | 'auto'
+  | 'required'
+  | { type: 'function'; function: { name: string } };
+
+export type ChatCompletionFunctionCallChoice = 'none' | 'auto' | { name: string };
+
+export interface ChatCompletionResponseFormat {
+  type: 'text' | 'json_object' | 'json_schema';
+  json_schema?: Record<string, unknown>;
+}
+
+// Processing tiers a request may ask for; 'auto' lets the server choose
+export const SERVICE_TIERS = ['auto', 'default', 'flex', 'priority'] as const;
+
+export type ChatCompletionServiceTier = typeof SERVICE_TIERS[number];
+
+// The tier a request actually runs on, as reported in responses
+export type ResolvedServiceTier = Exclude<ChatCompletionServiceTier, 'auto'>;
+
+export function resolveServiceTier(requested: ChatCompletionServiceTier | undefined): ResolvedServiceTier {
+  return requested === undefined || requested === 'auto' ? 'default' : requested;
+}
+
+export interface ChatCompletionStreamOptions {
+  include_usage?: boolean;
 }
 
 export interface ChatCompletionRequest {
   model: string;
   messages: ChatCompletionMessage[];
   stream?: boolean;
+  stream_options?: ChatCompletionStreamOptions;
   user?: string;
   temperature?: number;
   max_tokens?: number;
   top_p?: number;
   n?: number;
   stop?: string | string[];
+  tools?: ChatCompletionTool[];
+  tool_choice?: ChatCompletionToolChoice;
+  // Deprecated in favour of tools/tool_choice, still sent by older clients
+  functions?: ChatCompletionFunctionDefinition[];
+  function_call?: ChatCompletionFunctionCallChoice;
+  response_format?: ChatCompletionResponseFormat;
+  service_tier?: ChatCompletionServiceTier;
+  // Makes models with random output reproducible
+  seed?: number;
+  // Report each output token's logprob, with top_logprobs alternatives
+  logprobs?: boolean;
+  top_logprobs?: number;
+}
+
+// Azure OpenAI's content filter verdict for one category: severity-rated
+// categories such as hate carry a severity, detection categories such as
+// jailbreak whether it was detected
+export interface ContentFilterResult {
+  filtered: boolean;
+  severity?: ContentFilterSeverity;
+  detected?: boolean;
+}
+
+export const CONTENT_FILTER_SEVERITIES = ['safe', 'low', 'medium', 'high'] as const;
+
+export type ContentFilterSeverity = typeof CONTENT_FILTER_SEVERITIES[number];
+
+// Not part of OpenAI's API; Azure OpenAI reports how each prompt fared
+// against its content filters, which the server mimics when configured to
+export interface PromptFilterResult {
+  prompt_index: number;
+  content_filter_results: Record<string, ContentFilterResult>;
+}
+
+// Sampling parameters a completion ran with once defaults are filled in.
+// Not part of OpenAI's API; sent as x_parameters when the server is
+// configured to, so tests can check which defaults applied.
+export interface ChatCompletionParameters {
+  temperature: number;
+  top_p: number;
+  n: number;
+  max_tokens: number | null;
+  stop: string[] | null;
+  seed: number | null;
 }
 
+// OpenAI's defaults for parameters the request leaves out
+export const DEFAULT_TEMPERATURE = 1;
+export const DEFAULT_TOP_P = 1;
+
+// The most choices (n) a chat completion may ask for, as OpenAI allows
+export const MAX_CHOICES = 128;
+
+// The most alternatives per token (top_logprobs) OpenAI allows
+export const MAX_TOP_LOGPROBS = 20;
+
+// Formatting overhead counted into prompt_tokens, as OpenAI counts it: each
+// message's role and delimiters, then the tokens priming the reply
+export const DEFAULT_TOKENS_PER_MESSAGE = 3;
+export const DEFAULT_REPLY_PRIMING_TOKENS = 3;
+
 export interface ChatCompletionUsage {
   prompt_tokens: number;
   completion_tokens: number;
   total_tokens: number;
+  // Only in the stream_options.include_usage chunk
+  teenytiny?: StreamPacing;
+}
+
+// Not part of OpenAI's API: how a stream was paced, as measured when the
+// server wrote each chunk, up to and including the usage chunk. Times are in
+// milliseconds from the request's arrival; gaps are null with one chunk.
+export interface StreamPacing {
+  chunk_count: number;
+  duration_ms: number;
+  time_to_first_chunk_ms: number;
+  inter_chunk_gap_ms: { min: number; mean: number; max: number } | null;
+}
+
+export type ChatCompletionFinishReason =
+  | 'stop'
+  | 'length'
+  | 'tool_calls'
+  | 'content_filter'
+  | 'function_call';
+
+export interface ChatCompletionTopLogprob {
+  token: string;
+  logprob: number;
+  // The token's UTF-8 bytes
+  bytes: number[] | null;
+}
+
+export interface ChatCompletionTokenLogprob extends ChatCompletionTopLogprob {
+  // The most likely tokens in its place, as many as top_logprobs asked for
+  top_logprobs: ChatCompletionTopLogprob[];
+}
+
+export interface ChatCompletionLogprobs {
+  content: ChatCompletionTokenLogprob[] | null;
+  refusal: ChatCompletionTokenLogprob[] | null;
 }
 
 export interface ChatCompletionChoice {
   index: number;
   message: ChatCompletionMessage;
-  finish_reason: 'stop' | 'length' | 'content_filter' | null;
+  finish_reason: ChatCompletionFinishReason | null;
+  // Only when the request asked for logprobs
+  logprobs?: ChatCompletionLogprobs | null;
 }
 
 export interface ChatCompletionResponse {
@@ -36,18 +234,36 @@ export interface ChatCompletionResponse {
   model: string;
   choices: ChatCompletionChoice[];
   usage: ChatCompletionUsage;
+  service_tier: ResolvedServiceTier;
+  // Identifies the model's configuration; changes whenever it does
+  system_fingerprint: string;
+  prompt_filter_results?: PromptFilterResult[];
+  x_parameters?: ChatCompletionParameters;
 }
 
 // Streaming types
+export interface ChatCompletionToolCallDelta {
+  index: number;
+  id?: string;
+  type?: 'function';
+  function?: Partial<ChatCompletionFunctionCall>;
+}
+
 export interface ChatCompletionStreamDelta {
   role?: 'assistant' | undefined;
   content?: string | undefined;
+  tool_calls?: ChatCompletionToolCallDelta[] | undefined;
+  function_call?: Partial<ChatCompletionFunctionCall> | undefined;
+  refusal?: string | undefined;
+  annotations?: ChatCompletionAnnotation[] | undefined;
 }
 
 export interface ChatCompletionStreamChoice {
   index: number;
   delta: ChatCompletionStreamDelta;
-  finish_reason?: 'stop' | 'length' | 'content_filter' | null;
+  finish_reason?: ChatCompletionFinishReason | null;
+  // For the content or refusal in this chunk, when the request asked
+  logprobs?: ChatCompletionLogprobs | null;
 }
 
 export interface ChatCompletionStreamResponse {
@@ -57,6 +273,11 @@ export interface ChatCompletionStreamResponse {
   model: string;
   choices: ChatCompletionStreamChoice[];
   usage?: ChatCompletionUsage;
+  service_tier: ResolvedServiceTier;
+  system_fingerprint: string;
+  // Only on the first chunk
+  prompt_filter_results?: PromptFilterResult[];
+  x_parameters?: ChatCompletionParameters;
 }
 
 // Models API types
@@ -65,6 +286,10 @@ export interface Model {
   object: 'model';
   created: number;
   owned_by: string;
+  // TeenyTiny extension: the system_fingerprint completions currently carry
+  system_fingerprint: string;
+  // TeenyTiny extension: only for models with background health checks
+  status?: 'ok' | 'degraded';
 }
 
 export interface ModelsResponse {
@@ -72,6 +297,36 @@ export interface ModelsResponse {
   data: Model[];
 }
 
+export interface EmbeddingRequest {
+  model: string;
+  input: string | string[];
+  // Length of the returned vectors; the model's default when left out
+  dimensions?: number;
+  encoding_format?: EmbeddingEncodingFormat;
+  user?: string;
+}
+
+export const EMBEDDING_ENCODING_FORMATS = ['float', 'base64'] as const;
+
+export type EmbeddingEncodingFormat = typeof EMBEDDING_ENCODING_FORMATS[number];
+
+export interface Embedding {
+  object: 'embedding';
+  index: number;
+  // Base64 of the little-endian float32 bytes when encoding_format is base64
+  embedding: number[] | string;
+}
+
+export interface EmbeddingResponse {
+  object: 'list';
+  data: Embedding[];
+  model: string;
+  usage: {
+    prompt_tokens: number;
+    total_tokens: number;
+  };
+}
+
 // Error types
 export interface ErrorDetail {
   message: string;
@@ -87,23 +342,46 @@ export interface ErrorResponse {
 // Utility types
 export type APIResponse<T> = T | ErrorResponse;
 
+// Flattens string or array-form content to its text
+export function contentToText(content: ChatCompletionMessage['content']): string {
+  if (Array.isArray(content)) {
+    return content
+      .map((part) => (part.type === 'image_url' ? '' : part.text))
+      .join('');
+  }
+  return content ?? '';
+}
+
+// Packs a vector as little-endian float32 bytes in base64, as OpenAI does for
+// encoding_format: base64
+export function embeddingToBase64(vector: number[]): string {
+  const bytes = new Uint8Array(vector.length * 4);
+  const view = new DataView(bytes.buffer);
+  vector.forEach((value, i) => view.setFloat32(i * 4, value, true));
+
+  let binary = '';
+  for (const byte of bytes) {
+    binary += String.fromCharCode(byte);
+  }
+  return btoa(binary);
+}
+
 // Type guards
 export function isErrorResponse(response: any): response is ErrorResponse {
   return response && typeof response === 'object' && 'error' in response;
 }
 
 // ID generation
-export function generateChatCompletionId(): string {
-  return `chatcmpl-${generateRandomString(29)}`;
+export function generateChatCompletionId(idGenerator: IdGenerator = defaultIdGenerator): string {
+  return idGenerator.generate('chatcmpl-');
+}
+
+export function generateToolCallId(idGenerator: IdGenerator = defaultIdGenerator): string {
+  return idGenerator.generate('call_');
 }
 
 export function generateRandomString(length: number): string {
-  const charset = 'abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789';
-  let result = '';
-  for (let i = 0; i < length; i++) {
-    result += charset.charAt(Math.floor(Math.random() * charset.length));
-  }
-  return result;
+  return randomString(length);
 }
 
 export function getCurrentTimestamp(): number {
@@ -0,0 +1,441 @@
+import { DEFAULT_MAX_REQUEST_BYTES } from './utils/request-body.js';
+import { PRIORITIES } from './middleware/queue.js';
+import type { Priority } from './middleware/queue.js';
+import { NORMALIZATION_FORMS } from './models/normalize-model.js';
+import type { NormalizationForm } from './models/normalize-model.js';
+import { RESPONSE_MAP_FALLBACKS } from './models/responses-model.js';
+import { DEFAULT_ESCALATING_SCRIPT, parseEscalatingScript } from './models/escalating-model.js';
+import { DEFAULT_ATTEMPT_TRACKER_CONFIG } from './utils/attempt-tracker.js';
+import type { ResponseMapFallback } from './models/responses-model.js';
+import { DEFAULT_ROTATION_CONFIG } from './utils/rotating-file-sink.js';
+import { EMBEDDING_DIMENSIONS, MAX_EMBEDDING_BATCH_SIZE, MAX_EMBEDDING_DIMENSIONS } from './models/embedding-model.js';
+import { MAX_CHOICES } from './openai-protocol/types.js';
+import { DEFAULT_LOG_FILE_CONFIG } from './utils/log-file.js';
+import { DEFAULT_SESSION_CONFIG } from './utils/session-store.js';
+import { DEFAULT_RESPONSE_CACHE_CONFIG } from './utils/response-cache.js';
+import { DEFAULT_IDEMPOTENCY_CONFIG } from './middleware/idempotency.js';
+import { DEFAULT_REQUEST_HISTORY_SIZE } from './utils/request-history.js';
+import { DEFAULT_MODEL_HEALTH_INTERVAL_MS } from './utils/model-health.js';
+import { DEFAULT_VISION_FETCH } from './models/vision-model.js';
+import { parseListenAddress } from './utils/listen-address.js';
+import { parseProxyUrl } from './utils/outbound-proxy.js';
+import type { ListenAddress } from './utils/listen-address.js';
+
+export const DEFAULT_PORT = 8080;
+export const DEFAULT_API_KEY = 'testkey';
+
+// Environment variables are named after the flags: --max-concurrent is
+// TEENYTINY_MAX_CONCURRENT
+export const ENV_PREFIX = 'TEENYTINY_';
+
+export function defaultServerConfig() {
+  return {
+    port: DEFAULT_PORT,
+    listen: [] as ListenAddress[],
+    readyFile: undefined as string | undefined,
+    apiKey: DEFAULT_API_KEY,
+    maxRequestBytes: DEFAULT_MAX_REQUEST_BYTES,
+    maxPromptTokens: undefined as number | undefined,
+    maxOutputTokens: undefined as number | undefined,
+    maxConcurrent: undefined as number | undefined,
+    maxQueued: 0,
+    queueTimeouts: undefined as Partial<Record<Priority, number>> | undefined,
+    highPriorityKeys: undefined as string[] | undefined,
+    lowPriorityKeys: undefined as string[] | undefined,
+    maintenanceRetryAfterSeconds: undefined as number | undefined,
+    maxConcurrentPerIp: undefined as number | undefined,
+    maxStreamsPerKey: undefined as number | undefined,
+    trustedProxies: [] as string[],
+    corsMethods: undefined as string[] | undefined,
+    corsHeaders: undefined as string[] | undefined,
+    corsMaxAge: undefined as number | undefined,
+    organizations: undefined as string[] | undefined,
+    disabledModels: undefined as string[] | undefined,
+    garble: undefined as Record<string, number> | undefined,
+    garbleSeed: undefined as number | undefined,
+    dropChunks: undefined as Record<string, number> | undefined,
+    dropChunksSeed: undefined as number | undefined,
+    healthCheckTimeoutMs: undefined as number | undefined,
+    modelHealthIntervalMs: DEFAULT_MODEL_HEALTH_INTERVAL_MS,
+    disableUnhealthyModels: false,
+    projects: undefined as string[] | undefined,
+    rateLimits: undefined as string | undefined,
+    quotas: undefined as string | undefined,
+    interleavedScript: undefined as string | undefined,
+    cannedModels: undefined as string | undefined,
+    virtualModels: undefined as string | undefined,
+    fanout: undefined as string[] | undefined,
+    responses: undefined as string | undefined,
+    responsesFallback: 'echo' as ResponseMapFallback,
+    escalatingScript: DEFAULT_ESCALATING_SCRIPT,
+    escalatingTtlSeconds: DEFAULT_ATTEMPT_TRACKER_CONFIG.ttlMs / 1000,
+    streamScenarios: undefined as string | undefined,
+    cacheTtlSeconds: undefined as number | undefined,
+    cacheSize: DEFAULT_RESPONSE_CACHE_CONFIG.maxEntries,
+    idempotencyTtlSeconds: DEFAULT_IDEMPOTENCY_CONFIG.ttlMs / 1000,
+    idempotencySize: DEFAULT_IDEMPOTENCY_CONFIG.maxEntries,
+    webhookUrl: undefined as string | undefined,
+    webhookSecret: undefined as string | undefined,
+    webhookErrorsOnly: false,
+    webhookModels: undefined as string[] | undefined,
+    shadowUrl: undefined as string | undefined,
+    shadowApiKey: undefined as string | undefined,
+    shadowModel: undefined as string | undefined,
+    shadowTimeoutMs: undefined as number | undefined,
+    outboundProxy: undefined as string | undefined,
+    admin: false,
+    requestHistory: DEFAULT_REQUEST_HISTORY_SIZE,
+    upgradeSocket: false,
+    sessions: false,
+    sessionTtlMs: DEFAULT_SESSION_CONFIG.ttlMs,
+    maxSessions: DEFAULT_SESSION_CONFIG.maxSessionsPerKey,
+    mirrorArrayContent: false,
+    roleChunkContent: false,
+    defaultTemperature: undefined as number | undefined,
+    defaultTopP: undefined as number | undefined,
+    reflectParameters: false,
+    minimalResponses: false,
+    azureCompat: false,
+    promptFilterResults: undefined as string | undefined,
+    tokensPerMessage: undefined as number | undefined,
+    replyPrimingTokens: undefined as number | undefined,
+    trace: false,
+    visionFetch: false,
+    visionFetchMaxBytes: DEFAULT_VISION_FETCH.maxBytes,
+    visionFetchTimeoutMs: DEFAULT_VISION_FETCH.timeoutMs,
+    usageTrailers: false,
+    allowHeaderOverrides: false,
+    verboseErrors: false,
+    authFailureDelayMs: 0,
+    constantTimeAuth: false,
+    normalizeForm: 'NFC' as NormalizationForm,
+    embeddingDimensions: EMBEDDING_DIMENSIONS,
+    maxEmbeddingDimensions: MAX_EMBEDDING_DIMENSIONS,
+    maxEmbeddingBatchSize: MAX_EMBEDDING_BATCH_SIZE,
+    maxChoices: MAX_CHOICES,
+    auditLog: undefined as string | undefined,
+    auditContent: false,
+    logFilters: undefined as string | undefined,
+    logFile: undefined as string | undefined,
+    exec: undefined as string | undefined,
+    execTimeoutMs: undefined as number | undefined,
+    execPool: 0,
+    execMaxRequests: 0,
+    logMaxBytes: DEFAULT_LOG_FILE_CONFIG.maxBytes,
+    logDaily: DEFAULT_LOG_FILE_CONFIG.daily,
+    logKeep: DEFAULT_LOG_FILE_CONFIG.keep,
+    securityLog: undefined as string | undefined,
+    securityLogMaxBytes: DEFAULT_ROTATION_CONFIG.maxBytes,
+    securityLogKeep: DEFAULT_ROTATION_CONFIG.keep,
+    help: false,
+  };
+}
+
+export type ServerConfig = ReturnType<typeof defaultServerConfig>;
+
+// Every invalid flag and environment variable found at startup
+export class ConfigError extends Error {
+  constructor(readonly problems: string[]) {
+    super(`Invalid configuration: ${problems.join('; ')}`);
+    this.name = 'ConfigError';
+  }
+}
+
+interface Option {
+  flag: string;
+  alias?: string | undefined;
+  // Read instead of the environment variable named after the flag
+  env?: string | undefined;
+  // Completes "<flag> requires ..."; switches, which take no value, have none
+  requires?: string | undefined;
+  // Stores the value, or returns false when it's invalid; may instead throw
+  // with a more specific message
+  apply(config: ServerConfig, value: string): boolean;
+  // Set on flags that may be repeated: clears the environment variable's
+  // values before the first flag's
+  reset?(config: ServerConfig): void;
+}
+
+type SwitchKey = { [K in keyof ServerConfig]: ServerConfig[K] extends boolean ? K : never }[keyof ServerConfig];
+
+function option<K extends keyof ServerConfig>(
+  flag: string,
+  key: K,
+  requires: string,
+  parse: (value: string) => ServerConfig[K] | undefined,
+  alias?: string
+): Option {
+  return {
+    flag,
+    alias,
+    requires,
+    apply: (config, value) => {
+      const parsed = parse(value);
+      if (parsed === undefined) {
+        return false;
+      }
+      config[key] = parsed;
+      return true;
+    },
+  };
+}
+
+// A flag without a value, setting key to on; its environment variable takes
+// true or false
+function toggle(flag: string, key: SwitchKey, on = true): Option {
+  return {
+    flag,
+    apply: (config, value) => {
+      config[key] = (value === 'true') === on;
+      return true;
+    },
+  };
+}
+
+const text = (value: string) => value;
+const list = (value: string) => value.split(',').filter((item) => item !== '');
+const trimmedList = (value: string) => value.split(',').map((item) => item.trim()).filter((item) => item !== '');
+const number = (test: (n: number) => boolean) => (value: string) =>
+  !isNaN(Number(value)) && test(Number(value)) ? Number(value) : undefined;
+const integer = (test: (n: number) => boolean) => (value: string) =>
+  Number.isInteger(Number(value)) && test(Number(value)) ? Number(value) : undefined;
+const positive = (n: number) => n > 0;
+const nonNegative = (n: number) => n >= 0;
+const any = () => true;
+
+function garble(value: string): Record<string, number> | undefined {
+  const entries = value.split(',').filter((entry) => entry !== '').map((entry) => entry.split('='));
+  const valid = entries.length > 0 && entries.every(
+    ([model, probability, ...rest]) =>
+      model && probability && rest.length === 0 && Number(probability) >= 0 && Number(probability) <= 1
+  );
+  return valid ? Object.fromEntries(entries.map(([model, probability]) => [model, Number(probability)])) : undefined;
+}
+
+function queueTimeouts(value: string): Partial<Record<Priority, number>> | undefined {
+  const entries = value.split(',').filter((entry) => entry !== '').map((entry) => entry.split('='));
+  const valid = entries.length > 0 && entries.every(
+    ([priority, ms, ...rest]) =>
+      (PRIORITIES as readonly string[]).includes(priority ?? '') && ms && rest.length === 0 && positive(Number(ms)) && Number.isInteger(Number(ms))
+  );
+  return valid ? Object.fromEntries(entries.map(([priority, ms]) => [priority, Number(ms)])) : undefined;
+}
+
+const OPTIONS: Option[] = [
+  option('--port', 'port', 'a numeric value', number(any), '-p'),
+  {
+    flag: '--listen',
+    requires: 'an address such as http://127.0.0.1:8080',
+    apply: (config, value) => {
+      config.listen.push(parseListenAddress(value));
+      return true;
+    },
+    reset: (config) => {
+      config.listen = [];
+    },
+  },
+  option('--ready-file', 'readyFile', 'a file path', text),
+  // TEENYTINY_API_KEY is the key the tt client sends, which the server
+  // mustn't take as its own when both run in one shell
+  { ...option('--api-key', 'apiKey', 'a value', text), env: 'TEENYTINY_SERVER_API_KEY' },
+  option('--max-request-bytes', 'maxRequestBytes', 'a positive numeric value', number(positive)),
+  option('--max-prompt-tokens', 'maxPromptTokens', 'a positive numeric value', number(positive)),
+  option('--max-output-tokens', 'maxOutputTokens', 'a positive integer', integer(positive)),
+  option('--max-concurrent', 'maxConcurrent', 'a positive integer', integer(positive)),
+  option('--max-queued', 'maxQueued', 'a non-negative integer', integer(nonNegative)),
+  option('--queue-timeouts', 'queueTimeouts', 'comma-separated priority=milliseconds pairs, e.g. low=1000', queueTimeouts),
+  option('--high-priority-keys', 'highPriorityKeys', 'a comma-separated list of API keys', list),
+  option('--low-priority-keys', 'lowPriorityKeys', 'a comma-separated list of API keys', list),
+  option('--maintenance-retry-after', 'maintenanceRetryAfterSeconds', 'a non-negative integer number of seconds', integer(nonNegative)),
+  option('--max-concurrent-per-ip', 'maxConcurrentPerIp', 'a positive integer', integer(positive)),
+  option('--max-streams-per-key', 'maxStreamsPerKey', 'a positive integer', integer(positive)),
+  option('--trusted-proxies', 'trustedProxies', 'a comma-separated list of addresses', trimmedList),
+  option('--cors-methods', 'corsMethods', 'a comma-separated list of methods', (value) =>
+    trimmedList(value).map((method) => method.toUpperCase())
+  ),
+  option('--cors-headers', 'corsHeaders', 'a comma-separated list of headers', trimmedList),
+  option('--cors-max-age', 'corsMaxAge', 'a non-negative integer number of seconds', integer(nonNegative)),
+  option('--disable-models', 'disabledModels', 'a comma-separated list of models', list),
+  option('--garble', 'garble', 'comma-separated model=probability pairs, e.g. echo=0.1', garble),
+  option('--garble-seed', 'garbleSeed', 'an integer', integer(any)),
+  option('--drop-chunks', 'dropChunks', 'comma-separated model=probability pairs, e.g. countdown=0.2', garble),
+  option('--drop-chunks-seed', 'dropChunksSeed', 'an integer', integer(any)),
+  option('--health-check-timeout-ms', 'healthCheckTimeoutMs', 'a positive integer', integer(positive)),
+  option('--model-health-interval-ms', 'modelHealthIntervalMs', 'a positive integer', integer(positive)),
+  toggle('--disable-unhealthy-models', 'disableUnhealthyModels'),
+  option('--organizations', 'organizations', 'a comma-separated list of organization ids', list),
+  option('--projects', 'projects', 'a comma-separated list of project ids', list),
+  option('--rate-limits', 'rateLimits', 'a file path', text),
+  option('--quotas', 'quotas', 'a file path', text),
+  option('--interleaved-script', 'interleavedScript', 'a file path', text),
+  option('--canned-models', 'cannedModels', 'a file path', text),
+  option('--virtual-models', 'virtualModels', 'a file path', text),
+  option('--fanout', 'fanout', 'a comma-separated list of models', (value) => {
+    const models = trimmedList(value);
+    return models.length > 0 ? models : undefined;
+  }),
+  option('--responses', 'responses', 'a file path', text),
+  option('--responses-fallback', 'responsesFallback', `one of ${RESPONSE_MAP_FALLBACKS.join(', ')}`, (value) =>
+    RESPONSE_MAP_FALLBACKS.find((candidate) => candidate === value)
+  ),
+  option('--escalating-script', 'escalatingScript', 'comma-separated statuses ending in success, e.g. 429,500,success', (value) => {
+    try {
+      return parseEscalatingScript(value);
+    } catch {
+      return undefined;
+    }
+  }),
+  option('--escalating-ttl', 'escalatingTtlSeconds', 'a positive number of seconds', number(positive)),
+  option('--stream-scenarios', 'streamScenarios', 'a file path', text),
+  option('--cache-ttl', 'cacheTtlSeconds', 'a positive number of seconds', number(positive)),
+  option('--cache-size', 'cacheSize', 'a positive integer', integer(positive)),
+  option('--idempotency-ttl', 'idempotencyTtlSeconds', 'a positive number of seconds', number(positive)),
+  option('--idempotency-size', 'idempotencySize', 'a positive integer', integer(positive)),
+  option('--embedding-dimensions', 'embeddingDimensions', 'a positive integer', integer(positive)),
+  option('--max-embedding-dimensions', 'maxEmbeddingDimensions', 'a positive integer', integer(positive)),
+  option('--max-embedding-batch-size', 'maxEmbeddingBatchSize', 'a positive integer', integer(positive)),
+  option('--max-choices', 'maxChoices', 'a positive integer', integer(positive)),
+  toggle('--upgrade-socket', 'upgradeSocket'),
+  toggle('--admin', 'admin'),
+  option('--request-history', 'requestHistory', 'a positive integer', integer(positive)),
+  toggle('--sessions', 'sessions'),
+  option('--session-ttl-ms', 'sessionTtlMs', 'a positive numeric value', number(positive)),
+  option('--max-sessions', 'maxSessions', 'a positive integer', integer(positive)),
+  toggle('--allow-header-overrides', 'allowHeaderOverrides'),
+  toggle('--usage-trailers', 'usageTrailers'),
+  toggle('--mirror-array-content', 'mirrorArrayContent'),
+  toggle('--role-chunk-content', 'roleChunkContent'),
+  option('--default-temperature', 'defaultTemperature', 'a number from 0 to 2', number((n) => n >= 0 && n <= 2)),
+  option('--default-top-p', 'defaultTopP', 'a number from 0 to 1', number((n) => n >= 0 && n <= 1)),
+  toggle('--reflect-parameters', 'reflectParameters'),
+  toggle('--minimal-responses', 'minimalResponses'),
+  toggle('--azure-compat', 'azureCompat'),
+  option('--prompt-filter-results', 'promptFilterResults', 'a file path', text),
+  option('--tokens-per-message', 'tokensPerMessage', 'a non-negative integer', integer(nonNegative)),
+  option('--reply-priming-tokens', 'replyPrimingTokens', 'a non-negative integer', integer(nonNegative)),
+  toggle('--trace', 'trace'),
+  toggle('--vision-fetch', 'visionFetch'),
+  option('--vision-fetch-max-bytes', 'visionFetchMaxBytes', 'a positive integer', integer(positive)),
+  option('--vision-fetch-timeout-ms', 'visionFetchTimeoutMs', 'a positive integer', integer(positive)),
+  toggle('--verbose-errors', 'verboseErrors'),
+  option('--auth-failure-delay-ms', 'authFailureDelayMs', 'a non-negative numeric value', number(nonNegative)),
+  toggle('--constant-time-auth', 'constantTimeAuth'),
+  option('--normalize-form', 'normalizeForm', `one of ${NORMALIZATION_FORMS.join(', ')}`, (value) =>
+    NORMALIZATION_FORMS.find((candidate) => candidate === value.toUpperCase())
+  ),
+  option('--audit-log', 'auditLog', 'a file path', text),
+  toggle('--audit-content', 'auditContent'),
+  option('--security-log', 'securityLog', 'a file path', text),
+  option('--security-log-max-bytes', 'securityLogMaxBytes', 'a positive integer', integer(positive)),
+  option('--security-log-keep', 'securityLogKeep', 'a non-negative integer', integer(nonNegative)),
+  option('--exec', 'exec', 'a command', (value) => (value.trim() ? value : undefined)),
+  option('--exec-timeout-ms', 'execTimeoutMs', 'a positive integer', integer(positive)),
+  option('--exec-pool', 'execPool', 'a non-negative integer', integer(nonNegative)),
+  option('--exec-max-requests', 'execMaxRequests', 'a non-negative integer', integer(nonNegative)),
+  option('--log-file', 'logFile', 'a file path', text),
+  option('--log-max-bytes', 'logMaxBytes', 'a non-negative integer', integer(nonNegative)),
+  toggle('--log-no-daily', 'logDaily', false),
+  option('--log-keep', 'logKeep', 'a non-negative integer', integer(nonNegative)),
+  option('--webhook-url', 'webhookUrl', 'a URL', text),
+  option('--webhook-secret', 'webhookSecret', 'a value', text),
+  toggle('--webhook-errors-only', 'webhookErrorsOnly'),
+  option('--webhook-models', 'webhookModels', 'a comma-separated list of models', list),
+  option('--shadow-url', 'shadowUrl', 'a base URL', text),
+  option('--shadow-api-key', 'shadowApiKey', 'a value', text),
+  option('--shadow-model', 'shadowModel', 'a model name', text),
+  option('--shadow-timeout-ms', 'shadowTimeoutMs', 'a positive numeric value', number(positive)),
+  // Throws rather than returning undefined, so the problem doesn't quote the
+  // URL's credentials
+  option('--outbound-proxy', 'outboundProxy', 'a proxy URL', (value) => parseProxyUrl(value) && value),
+  option('--log-filters', 'logFilters', 'a file path', text),
+];
+
+// e.g. --max-concurrent → TEENYTINY_MAX_CONCURRENT
+export function envName(flag: string): string {
+  return ENV_PREFIX + flag.replace(/^--/, '').replace(/-/g, '_').toUpperCase();
+}
+
+/**
+ * Parses and validates the server's flags and TEENYTINY_* environment
+ * variables, flags taking precedence. Rather than stopping at the first
+ * problem, it throws a ConfigError listing every invalid value, so a
+ * misconfigured deployment fails at startup with all of them named.
+ * Environment variables for switches such as --admin take true or false;
+ * TEENYTINY_LISTEN takes several addresses separated by spaces.
+ */
+export function loadServerConfig(args: string[], env: Record<string, string | undefined> = {}): ServerConfig {
+  const config = defaultServerConfig();
+  const problems: string[] = [];
+
+  const apply = (option: Option, name: string, value: string) => {
+    try {
+      if (!option.apply(config, value)) {
+        problems.push(`${name} requires ${option.requires} (got "${value}")`);
+      }
+    } catch (error) {
+      problems.push(`${name}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+  };
+
+  for (const option of OPTIONS) {
+    const name = option.env ?? envName(option.flag);
+    const value = env[name]?.trim();
+    if (!value) {
+      continue;
+    }
+    if (option.requires === undefined) {
+      const enabled = ['true', '1'].includes(value.toLowerCase());
+      if (!enabled && !['false', '0'].includes(value.toLowerCase())) {
+        problems.push(`${name} requires true or false (got "${value}")`);
+        continue;
+      }
+      apply(option, name, String(enabled));
+    } else if (option.reset) {
+      value.split(/\s+/).forEach((item) => apply(option, name, item));
+    } else {
+      apply(option, name, value);
+    }
+  }
+
+  const repeated = new Set<Option>();
+  for (let i = 0; i < args.length; i++) {
+    const arg = args[i] ?? '';
+    if (arg === '--help' || arg === '-h') {
+      config.help = true;
+      continue;
+    }
+    const option = OPTIONS.find((candidate) => candidate.flag === arg || candidate.alias === arg);
+    if (!option) {
+      problems.push(`Unknown argument ${arg}`);
+      continue;
+    }
+    if (option.requires === undefined) {
+      option.apply(config, 'true');
+      continue;
+    }
+
+    // A following flag isn't taken as the value, though negative numbers are
+    const value = args[i + 1];
+    if (!value || /^-[-a-z]/i.test(value)) {
+      problems.push(`${arg} requires ${option.requires}`);
+      continue;
+    }
+    i++; // Skip the value
+    if (option.reset && !repeated.has(option)) {
+      repeated.add(option);
+      option.reset(config);
+    }
+    apply(option, arg, value);
+  }
+
+  if (config.upgradeSocket && config.listen.length > 1) {
+    problems.push('--upgrade-socket hands over a single listening socket, so it allows one --listen');
+  }
+  if (config.promptFilterResults !== undefined && !config.azureCompat) {
+    problems.push('--prompt-filter-results sets what --azure-compat adds, so it requires --azure-compat');
+  }
+  if (problems.length > 0) {
+    throw new ConfigError(problems);
+  }
+  return config;
+}
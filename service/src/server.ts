@@ -1,63 +1,192 @@
 #!/usr/bin/env node
 
-import { serve } from '@hono/node-server';
 import { serveStatic } from '@hono/node-server/serve-static';
-import { createApp } from './app.js';
+import { createServer } from './teenytiny.js';
+import { ConfigError, DEFAULT_API_KEY, DEFAULT_PORT, ENV_PREFIX, loadServerConfig } from './server-config.js';
+import type { ServerConfig } from './server-config.js';
+import { DEFAULT_MAX_REQUEST_BYTES } from './utils/request-body.js';
+import { DEFAULT_REQUEST_HISTORY_SIZE } from './utils/request-history.js';
+import { AuditLogger, maskAPIKey } from './utils/audit-log.js';
+import { FileAuditSink } from './utils/file-audit-sink.js';
+import { DEFAULT_ROTATION_CONFIG, RotatingFileSink } from './utils/rotating-file-sink.js';
+import type { RotationConfig } from './utils/rotating-file-sink.js';
+import { chainHeadOf, SecurityLogger } from './utils/security-log.js';
+import { createProxyFetch, outboundProxyConfig, redactProxyUrl } from './utils/outbound-proxy.js';
+import type { OutboundProxyConfig } from './utils/outbound-proxy.js';
+import { parseLogFilterConfig } from './middleware/logging.js';
+import { Logger } from './utils/logger.js';
+import { ExecModel } from './models/exec-model.js';
+import { EMBEDDING_DIMENSIONS, MAX_EMBEDDING_BATCH_SIZE, MAX_EMBEDDING_DIMENSIONS } from './models/embedding-model.js';
+import { DEFAULT_LOG_FILE_CONFIG, LogFile } from './utils/log-file.js';
+import { DEFAULT_SESSION_CONFIG } from './utils/session-store.js';
+import { DEFAULT_RESPONSE_CACHE_CONFIG } from './utils/response-cache.js';
+import { DEFAULT_IDEMPOTENCY_CONFIG } from './middleware/idempotency.js';
+import { DEFAULT_ESCALATING_SCRIPT } from './models/escalating-model.js';
+import { DEFAULT_ATTEMPT_TRACKER_CONFIG } from './utils/attempt-tracker.js';
+import { DEFAULT_CONTENT_FILTER_RESULTS, parseContentFilterResults } from './utils/content-filter.js';
+import type { ContentFilterResult } from './openai-protocol/types.js';
+import { DEFAULT_HEALTH_CHECK_TIMEOUT_MS } from './utils/health-check.js';
+import { DEFAULT_MODEL_HEALTH_INTERVAL_MS } from './utils/model-health.js';
+import type { LogFilterConfig } from './middleware/logging.js';
+import { DEFAULT_CORS_METHODS } from './middleware/cors.js';
+import { DEFAULT_MAINTENANCE_RETRY_AFTER_SECONDS } from './middleware/maintenance.js';
+import { parseRateLimitConfig } from './middleware/rate-limit.js';
+import type { RateLimitConfig } from './middleware/rate-limit.js';
+import { parseQuotaConfig } from './middleware/quota.js';
+import type { QuotaConfig } from './middleware/quota.js';
+import { parseInterleavedScript } from './models/interleaved-model.js';
+import type { InterleavedScript } from './models/interleaved-model.js';
+import { parseCannedModels } from './models/canned-models.js';
+import { DEFAULT_VISION_FETCH } from './models/vision-model.js';
+import { DEFAULT_REPLY_PRIMING_TOKENS, DEFAULT_TOKENS_PER_MESSAGE, MAX_CHOICES } from './openai-protocol/types.js';
+import type { CannedModel } from './models/canned-models.js';
+import { parseVirtualModels } from './models/virtual-models.js';
+import type { VirtualModel } from './models/virtual-models.js';
+import { parseResponseMap } from './models/responses-model.js';
+import type { ResponseMap } from './models/responses-model.js';
+import { parseStreamScenarioConfig } from './utils/stream-scenarios.js';
+import type { StreamScenarioConfig } from './utils/stream-scenarios.js';
+import { confirmUpgrade, inheritedListener, startUpgrade } from './utils/upgrade.js';
+import type { ListenAddress } from './utils/listen-address.js';
+import type { ListenOptions } from './teenytiny.js';
+import { notifySystemd, writeReadyFile } from './utils/ready.js';
+import type { ReadyInfo } from './utils/ready.js';
+import { readFileSync, rmSync } from 'fs';
 import path from 'path';
 import { fileURLToPath } from 'url';
 
 const __filename = fileURLToPath(import.meta.url);
 const __dirname = path.dirname(__filename);
 
-const DEFAULT_PORT = 8080;
-const DEFAULT_API_KEY = 'testkey';
-
-function parseArgs() {
-  const args = process.argv.slice(2);
-  const config = {
-    port: DEFAULT_PORT,
-    apiKey: DEFAULT_API_KEY,
-    help: false,
-  };
+// Reads and validates the access log filters file, exiting on any problem
+function loadLogFilters(file: string): LogFilterConfig {
+  try {
+    return parseLogFilterConfig(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --log-filters file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
 
-  for (let i = 0; i < args.length; i++) {
-    const arg = args[i];
-    const nextArg = args[i + 1];
-
-    switch (arg) {
-      case '--port':
-      case '-p':
-        if (nextArg && !isNaN(Number(nextArg))) {
-          config.port = Number(nextArg);
-          i++; // Skip next argument
-        } else {
-          console.error('Error: --port requires a numeric value');
-          process.exit(1);
-        }
-        break;
-      
-      case '--api-key':
-        if (nextArg) {
-          config.apiKey = nextArg;
-          i++; // Skip next argument
-        } else {
-          console.error('Error: --api-key requires a value');
-          process.exit(1);
-        }
-        break;
-      
-      case '--help':
-      case '-h':
-        config.help = true;
-        break;
-      
-      default:
-        console.error(`Error: Unknown argument ${arg}`);
+// Reads each https listener's certificate and key
+function loadListenOptions(addresses: ListenAddress[]): ListenOptions[] {
+  return addresses.map(({ scheme, hostname, port, path, cert, key, h2c }) => {
+    if (scheme === 'unix') {
+      return { path, h2c };
+    }
+    const options: ListenOptions = { port, hostname: hostname || undefined, h2c };
+    if (scheme === 'https' && cert && key) {
+      try {
+        options.tls = { cert: readFileSync(cert), key: readFileSync(key) };
+      } catch (error) {
+        console.error(`Error: can't read TLS files for --listen: ${error instanceof Error ? error.message : String(error)}`);
         process.exit(1);
+      }
     }
+    return options;
+  });
+}
+
+function loadRateLimits(file: string): RateLimitConfig {
+  try {
+    return parseRateLimitConfig(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --rate-limits file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function loadQuotas(file: string): QuotaConfig {
+  try {
+    return parseQuotaConfig(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --quotas file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function loadInterleavedScript(file: string): InterleavedScript {
+  try {
+    return parseInterleavedScript(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --interleaved-script file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function loadCannedModels(file: string): CannedModel[] {
+  try {
+    return parseCannedModels(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --canned-models file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
   }
+}
 
-  return config;
+function loadVirtualModels(file: string): VirtualModel[] {
+  try {
+    return parseVirtualModels(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --virtual-models file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function loadResponseMap(file: string): ResponseMap {
+  try {
+    return parseResponseMap(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --responses file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function loadStreamScenarios(file: string): StreamScenarioConfig {
+  try {
+    return parseStreamScenarioConfig(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --stream-scenarios file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function loadPromptFilterResults(file: string): Record<string, ContentFilterResult> {
+  try {
+    return parseContentFilterResults(JSON.parse(readFileSync(file, 'utf8')));
+  } catch (error) {
+    console.error(`Error: invalid --prompt-filter-results file ${file}: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+// --outbound-proxy, else the standard proxy variables, which aren't checked
+// with the rest of the configuration
+function loadOutboundProxy(proxy: string | undefined): OutboundProxyConfig | undefined {
+  try {
+    return outboundProxyConfig(proxy, process.env);
+  } catch (error) {
+    console.error(`Error: invalid outbound proxy: ${error instanceof Error ? error.message : String(error)}`);
+    process.exit(1);
+  }
+}
+
+function createExecModel(commandLine: string, config: ServerConfig): ExecModel {
+  const [command = '', ...args] = commandLine.split(' ').filter((part) => part !== '');
+  return new ExecModel({
+    command,
+    args,
+    timeoutMs: config.execTimeoutMs,
+    pool: config.execPool > 0
+      ? { size: config.execPool, timeoutMs: config.execTimeoutMs, maxRequestsPerWorker: config.execMaxRequests }
+      : undefined,
+  });
+}
+
+// Opens the security log, continuing the hash chain from its last entry
+function openSecurityLog(file: string, rotation: RotationConfig): SecurityLogger {
+  const sink = new RotatingFileSink(file, rotation);
+  const last = sink.lastLine();
+  return new SecurityLogger(sink, last === undefined ? undefined : chainHeadOf(last));
 }
 
 function showHelp() {
@@ -68,9 +197,151 @@ function showHelp() {
   console.log('');
   console.log('Options:');
   console.log('  --port, -p <port>     Port to run the server on (default: 8080)');
+  console.log('  --listen <address>    Serve on http://host:port, https://host:port?cert=<file>&key=<file>');
+  console.log('                        or unix:<path>, adding ?h2c for cleartext HTTP/2; repeat to');
+  console.log('                        serve one instance on several addresses (replaces --port)');
+  console.log('  --ready-file <path>   Once serving, write the startup line\'s addresses, models and');
+  console.log('                        auth mode there as JSON; also notifies systemd if it\'s waiting');
   console.log('  --api-key <key>       API key for authentication (default: testkey)');
+  console.log(`  --max-request-bytes <n>  Largest accepted request body (default: ${DEFAULT_MAX_REQUEST_BYTES})`);
+  console.log('  --max-prompt-tokens <n>  Reject prompts estimated above n tokens (default: no limit)');
+  console.log('  --max-output-tokens <n>  Cut completions off at an estimated n tokens with finish_reason');
+  console.log('                        length, whatever max_tokens asks for (default: no limit)');
+  console.log('  --max-concurrent <n>  Queue chat completions beyond n in flight (default: no limit)');
+  console.log('  --max-queued <n>      Requests allowed to queue before 503s, with --max-concurrent (default: 0)');
+  console.log('  --queue-timeouts <priority=ms,...>  503 queued requests of a priority (high, normal, low)');
+  console.log('                        after waiting ms, e.g. low=1000 (default: wait for a slot)');
+  console.log('  --high-priority-keys <keys>  API keys queued ahead of others and reported as the');
+  console.log('                        "priority" service_tier, unless a request picks its tier');
+  console.log('  --low-priority-keys <keys>  API keys queued behind others and shed first, reported as "flex"');
+  console.log(`  --maintenance-retry-after <seconds>  Retry-After of 503s during maintenance mode, switched`);
+  console.log(`                        with PUT /admin/maintenance (default: ${DEFAULT_MAINTENANCE_RETRY_AFTER_SECONDS})`);
+  console.log('  --max-concurrent-per-ip <n>  429 requests from an IP with n already in flight');
+  console.log('  --trusted-proxies <addrs>  Comma-separated proxy addresses whose X-Forwarded-For');
+  console.log('                        identifies the client IP, for --max-concurrent-per-ip and');
+  console.log('                        the security log');
+  console.log('  --max-streams-per-key <n>  429 streamed completions from an API key with n streams open');
+  console.log('  --cors-methods <list>  Comma-separated Access-Control-Allow-Methods (default:');
+  console.log(`                        ${DEFAULT_CORS_METHODS.join(',')})`);
+  console.log('  --cors-headers <list>  Comma-separated Access-Control-Allow-Headers (default: those');
+  console.log('                        the /v1 endpoints read, e.g. Authorization, Idempotency-Key)');
+  console.log('  --cors-max-age <seconds>  Let browsers cache preflights this long (Access-Control-Max-Age)');
+  console.log('  --disable-models <models>  Comma-separated models to leave out');
+  console.log('  --garble <model=p,...>  Insert a garbage token after each word of a model\'s output');
+  console.log('                        with probability p, e.g. echo=0.1 (default: off)');
+  console.log('  --garble-seed <n>     Make --garble reproducible (a request\'s seed takes precedence)');
+  console.log('  --drop-chunks <model=p,...>  Leave each chunk of output out of a model\'s streams with');
+  console.log('                        probability p, like a lossy network, e.g. countdown=0.2 (default: off)');
+  console.log('  --drop-chunks-seed <n>  Make --drop-chunks reproducible (a request\'s seed takes precedence)');
+  console.log(`  --health-check-timeout-ms <ms>  Time /health/deep gives its test generation (default: ${DEFAULT_HEALTH_CHECK_TIMEOUT_MS})`);
+  console.log(`  --model-health-interval-ms <ms>  How often models with external dependencies, such as`);
+  console.log(`                        exec, are checked (default: ${DEFAULT_MODEL_HEALTH_INTERVAL_MS})`);
+  console.log('  --disable-unhealthy-models  503 requests to models failing their checks until they recover');
+  console.log('  --organizations <ids> Comma-separated OpenAI-Organization ids to accept (default: any)');
+  console.log('  --projects <ids>      Comma-separated OpenAI-Project ids to accept (default: any)');
+  console.log('  --rate-limits <path>  JSON file of requests per window by endpoint and API key, e.g.');
+  console.log('                        {"endpoints": {"/v1/chat/completions": {"requests": 60, "windowMs": 60000}}}');
+  console.log('  --quotas <path>       JSON file of total tokens per API key, e.g.');
+  console.log('                        {"default": 100000, "keys": {"tt-trial": 1000}}');
+  console.log('  --cache-ttl <seconds> Replay non-streaming responses of deterministic models for');
+  console.log('                        identical requests, marked x-teenytiny-cache: hit');
+  console.log(`  --cache-size <n>      Cached responses kept, with --cache-ttl (default: ${DEFAULT_RESPONSE_CACHE_CONFIG.maxEntries})`);
+  console.log('  --idempotency-ttl <seconds>  Replay responses for a retried Idempotency-Key this long');
+  console.log(`                        (default: ${DEFAULT_IDEMPOTENCY_CONFIG.ttlMs / 1000})`);
+  console.log(`  --idempotency-size <n>  Idempotency-Key responses kept (default: ${DEFAULT_IDEMPOTENCY_CONFIG.maxEntries})`);
+  console.log('  --admin               Enable debugging endpoints under /admin and /metrics (authenticated)');
+  console.log('  --request-history <n>  Recent API requests kept for /admin/requests, with --admin');
+  console.log(`                        (default: ${DEFAULT_REQUEST_HISTORY_SIZE})`);
+  console.log('  --sessions            Keep conversations server-side under /v1/teenytiny/sessions,');
+  console.log('                        continued by completions sending X-Session-Id');
+  console.log(`  --session-ttl-ms <ms>  Forget sessions unused this long (default: ${DEFAULT_SESSION_CONFIG.ttlMs})`);
+  console.log(`  --max-sessions <n>    Sessions per API key before the oldest is dropped (default: ${DEFAULT_SESSION_CONFIG.maxSessionsPerKey})`);
+  console.log('  --mirror-array-content  Reply with output_text parts to array-form user content');
+  console.log('  --role-chunk-content  Send empty content with the role in the first streamed chunk');
+  console.log('  --default-temperature <t>  Temperature for requests that leave it out (default: 1)');
+  console.log('  --default-top-p <p>   top_p for requests that leave it out (default: 1)');
+  console.log('  --reflect-parameters  Add the resolved sampling parameters to responses as x_parameters');
+  console.log('  --minimal-responses   Degraded mode: leave usage, system_fingerprint and every other');
+  console.log('                        optional field out of chat completions');
+  console.log('  --azure-compat        Add Azure OpenAI\'s prompt_filter_results to chat completions');
+  console.log('  --prompt-filter-results <file>  JSON content filter results by category; requires --azure-compat');
+  console.log('                        (default: hate, self_harm, sexual and violence, all safe)');
+  console.log(`  --tokens-per-message <n>  prompt_tokens added per message (default: ${DEFAULT_TOKENS_PER_MESSAGE})`);
+  console.log(`  --reply-priming-tokens <n>  prompt_tokens added once for the reply (default: ${DEFAULT_REPLY_PRIMING_TOKENS})`);
+  console.log('  --trace               Serve POST /v1/teenytiny/trace, listing the SSE events a chat');
+  console.log('                        completion would stream as JSON (also served with --admin)');
+  console.log('  --vision-fetch        Let the vision model download http(s) image URLs to describe them');
+  console.log(`  --vision-fetch-max-bytes <n>  Largest image it downloads (default: ${DEFAULT_VISION_FETCH.maxBytes})`);
+  console.log(`  --vision-fetch-timeout-ms <ms>  Time limit per download (default: ${DEFAULT_VISION_FETCH.timeoutMs})`);
+  console.log('  --usage-trailers      Also send streamed usage as X-Usage-* HTTP trailers');
+  console.log('  --allow-header-overrides  Honour X-TeenyTiny-Model, -Delay, -Chunking and');
+  console.log('                        -Force-Status request headers');
+  console.log('  --verbose-errors      Include offending values and context in error messages');
+  console.log('  --auth-failure-delay-ms <ms>  Pause before rejecting failed auth (default: 0)');
+  console.log('  --constant-time-auth  Apply the auth delay to successful requests too');
+  console.log('  --normalize-form <form>  Unicode form used by the normalize model (default: NFC)');
+  console.log('  --interleaved-script <path>  JSON file of the interleaved model\'s opening, toolCall');
+  console.log('                        {name, arguments} and closing (with a {result} placeholder)');
+  console.log('  --canned-models <path>  JSON list of extra model ids, e.g. gpt-4, with owned_by and');
+  console.log('                        capabilities ["chat"] (echo) and/or ["embeddings"]');
+  console.log('  --virtual-models <path>  JSON list of models built on others, with forced max_tokens and');
+  console.log('                        temperature, a default system prompt and text transforms');
+  console.log('  --fanout <models>     Comma-separated models the fanout model answers with, one');
+  console.log('                        choice each, e.g. echo,reverse (default: no fanout model)');
+  console.log('  --responses <path>    JSON object mapping exact prompts to the responses model\'s replies');
+  console.log('  --responses-fallback <echo|error>  What the responses model does with other prompts');
+  console.log('                        (default: echo)');
+  console.log('  --escalating-script <steps>  Statuses the escalating model fails attempts with before');
+  console.log(`                        succeeding (default: ${DEFAULT_ESCALATING_SCRIPT.join(',')})`);
+  console.log('  --escalating-ttl <seconds>  Start a request\'s escalating attempts over after this long');
+  console.log(`                        without a retry (default: ${DEFAULT_ATTEMPT_TRACKER_CONFIG.ttlMs / 1000})`);
+  console.log('  --stream-scenarios <path>  JSON file of named stall/burst timelines for streams, picked');
+  console.log('                        with X-TeenyTiny-Scenario, and heartbeatMs during stalls');
+  console.log(`  --embedding-dimensions <n>  Default embedding vector length (default: ${EMBEDDING_DIMENSIONS})`);
+  console.log(`  --max-embedding-dimensions <n>  Largest dimensions a request may ask for (default: ${MAX_EMBEDDING_DIMENSIONS})`);
+  console.log(`  --max-embedding-batch-size <n>  Most inputs per embeddings request (default: ${MAX_EMBEDDING_BATCH_SIZE})`);
+  console.log(`  --max-choices <n>     Most choices a chat completion's n may ask for (default: ${MAX_CHOICES})`);
+  console.log('  --audit-log <path>    Append a JSONL audit record per chat completion to a file');
+  console.log('  --audit-content       Include message contents in audit records');
+  console.log('  --security-log <path> Append hash-chained auth and admin events to a file');
+  console.log('                        (check with: tt audit verify <path>)');
+  console.log(`  --security-log-max-bytes <n>  Rotate the security log at n bytes (default: ${DEFAULT_ROTATION_CONFIG.maxBytes})`);
+  console.log(`  --security-log-keep <n>  Rotated security logs to keep (default: ${DEFAULT_ROTATION_CONFIG.keep})`);
+  console.log('  --exec <command>      Register an exec model that replies with the command\'s output');
+  console.log('                        for the message on stdin (split on spaces into arguments)');
+  console.log('  --exec-timeout-ms <ms>  Fail exec requests that take longer (default: no limit)');
+  console.log('  --exec-pool <n>       Keep n exec workers running, speaking the length-prefixed');
+  console.log('                        protocol, instead of one process per request (default: 0)');
+  console.log('  --exec-max-requests <n>  Replace pooled exec workers after n requests (default: never)');
+  console.log('  --upgrade-socket      On SIGUSR2, start a new server process on the same socket,');
+  console.log('                        then finish in-flight requests and exit');
+  console.log('  --log-file <path>     Write logs to a file instead of stdout, rotated by size and');
+  console.log('                        daily; SIGUSR1 reopens it for external rotators');
+  console.log(`  --log-max-bytes <n>   Rotate the log file at n bytes, 0 for never (default: ${DEFAULT_LOG_FILE_CONFIG.maxBytes})`);
+  console.log('  --log-no-daily        Don\'t rotate the log file at midnight');
+  console.log(`  --log-keep <n>        Compressed old log files to keep (default: ${DEFAULT_LOG_FILE_CONFIG.keep})`);
+  console.log('  --webhook-url <url>   POST a JSON summary of each chat completion to a URL');
+  console.log('  --webhook-secret <s>  Sign webhook bodies with HMAC-SHA256 (X-TeenyTiny-Signature)');
+  console.log('  --webhook-errors-only Only notify about failed requests');
+  console.log('  --webhook-models <a,b>  Only notify about completions for these models');
+  console.log('  --shadow-url <url>    Replay each chat completion, non-streaming, to another API');
+  console.log('                        (base URL such as https://api.openai.com/v1) and compare');
+  console.log('                        status, latency and usage at /admin/shadow');
+  console.log('  --shadow-api-key <key>  API key sent to the shadow');
+  console.log('  --shadow-model <name>  Model name used in shadow requests (default: as requested)');
+  console.log('  --shadow-timeout-ms <ms>  Give up on shadow requests after this long (default: 30000)');
+  console.log('  --outbound-proxy <url>  Send outbound requests (vision downloads, webhooks, shadow');
+  console.log('                        mirroring) through an http:// (CONNECT) or socks5:// proxy;');
+  console.log('                        otherwise HTTPS_PROXY and HTTP_PROXY are used. NO_PROXY');
+  console.log('                        lists hosts reached directly either way');
+  console.log('  --log-filters <path>  JSON file of access log filters, e.g.');
+  console.log('                        {"suppressRoutes": ["/health"], "sampleRates": {"/v1/models": 0.1}}');
   console.log('  --help, -h            Show this help message');
   console.log('');
+  console.log(`Each option can also be set by an environment variable named after it, e.g.`);
+  console.log(`${ENV_PREFIX}MAX_CONCURRENT=4 for --max-concurrent; switches take true or false, and`);
+  console.log(`${ENV_PREFIX}LISTEN space-separated addresses. Flags take precedence.`);
+  console.log('');
   console.log('Examples:');
   console.log('  npm run dev                    # Run on default port 8080');
   console.log('  npm run dev -- --port 3000     # Run on port 3000');
@@ -84,62 +355,248 @@ function showHelp() {
   console.log('  llm -m echo "Hello!" # Using llm tool (configure with: llm keys set teenytiny)');
 }
 
-function maskAPIKey(key: string): string {
-  if (key.length <= 6) {
-    return '***';
+// Exits listing every invalid flag and environment variable, not just the
+// first
+function loadConfig(): ServerConfig {
+  try {
+    return loadServerConfig(process.argv.slice(2), process.env);
+  } catch (error) {
+    if (!(error instanceof ConfigError)) {
+      throw error;
+    }
+    for (const problem of error.problems) {
+      console.error(`Error: ${problem}`);
+    }
+    process.exit(1);
   }
-  return key.slice(0, 6) + '***';
 }
 
 async function main() {
-  const config = parseArgs();
+  const config = loadConfig();
 
   if (config.help) {
     showHelp();
     process.exit(0);
   }
 
-  // Create the app
-  const app = createApp({
+  // A file left by an earlier run mustn't look like this one being ready
+  if (config.readyFile) {
+    rmSync(config.readyFile, { force: true });
+  }
+
+  // --port unless --listen gives addresses of its own
+  const listens = config.listen.length > 0 ? loadListenOptions(config.listen) : [{ port: config.port }];
+
+  const auditSink = config.auditLog ? new FileAuditSink(config.auditLog) : undefined;
+  const exec = config.exec ? createExecModel(config.exec, config) : undefined;
+  const logFile = config.logFile
+    ? new LogFile(config.logFile, { maxBytes: config.logMaxBytes, daily: config.logDaily, keep: config.logKeep })
+    : undefined;
+  const security = config.securityLog
+    ? openSecurityLog(config.securityLog, { maxBytes: config.securityLogMaxBytes, keep: config.securityLogKeep })
+    : undefined;
+  const outboundProxy = loadOutboundProxy(config.outboundProxy);
+
+  // Create the server
+  const server = createServer({
     auth: {
       apiKey: config.apiKey,
+      failureDelayMs: config.authFailureDelayMs,
+      delayOnSuccess: config.constantTimeAuth,
     },
+    maxRequestBytes: config.maxRequestBytes,
+    maxPromptTokens: config.maxPromptTokens,
+    maxOutputTokens: config.maxOutputTokens,
+    queue: config.maxConcurrent === undefined
+      ? undefined
+      : { maxConcurrent: config.maxConcurrent, maxQueued: config.maxQueued, maxWaitMs: config.queueTimeouts },
+    priorities: config.highPriorityKeys === undefined && config.lowPriorityKeys === undefined
+      ? undefined
+      : {
+          ...Object.fromEntries((config.lowPriorityKeys ?? []).map((key) => [key, 'low' as const])),
+          ...Object.fromEntries((config.highPriorityKeys ?? []).map((key) => [key, 'high' as const])),
+        },
+    maintenanceRetryAfterSeconds: config.maintenanceRetryAfterSeconds,
+    disabledModels: config.disabledModels,
+    garble: config.garble && Object.fromEntries(
+      Object.entries(config.garble).map(([model, probability]) => [model, { probability, seed: config.garbleSeed }])
+    ),
+    dropChunks: config.dropChunks && Object.fromEntries(
+      Object.entries(config.dropChunks).map(([model, probability]) => [model, { probability, seed: config.dropChunksSeed }])
+    ),
+    healthCheckTimeoutMs: config.healthCheckTimeoutMs,
+    modelHealth: { intervalMs: config.modelHealthIntervalMs, disableUnhealthy: config.disableUnhealthyModels },
+    organizations: { organizations: config.organizations, projects: config.projects },
+    cors: { allowMethods: config.corsMethods, allowHeaders: config.corsHeaders, maxAge: config.corsMaxAge },
+    ipLimit: config.maxConcurrentPerIp === undefined
+      ? undefined
+      : { maxConcurrent: config.maxConcurrentPerIp },
+    trustedProxies: config.trustedProxies,
+    maxStreamsPerKey: config.maxStreamsPerKey,
+    rateLimits: config.rateLimits ? loadRateLimits(config.rateLimits) : undefined,
+    quotas: config.quotas ? loadQuotas(config.quotas) : undefined,
+    cache: config.cacheTtlSeconds === undefined
+      ? undefined
+      : { ttlMs: config.cacheTtlSeconds * 1000, maxEntries: config.cacheSize },
+    idempotency: { ttlMs: config.idempotencyTtlSeconds * 1000, maxEntries: config.idempotencySize },
+    admin: { enabled: config.admin, requestHistory: config.requestHistory },
+    sessions: config.sessions
+      ? { ttlMs: config.sessionTtlMs, maxSessionsPerKey: config.maxSessions }
+      : undefined,
+    mirrorArrayContent: config.mirrorArrayContent,
+    roleChunkContent: config.roleChunkContent,
+    defaultTemperature: config.defaultTemperature,
+    defaultTopP: config.defaultTopP,
+    reflectParameters: config.reflectParameters,
+    minimalResponses: config.minimalResponses,
+    promptFilterResults: config.azureCompat
+      ? config.promptFilterResults ? loadPromptFilterResults(config.promptFilterResults) : DEFAULT_CONTENT_FILTER_RESULTS
+      : undefined,
+    tokensPerMessage: config.tokensPerMessage,
+    replyPrimingTokens: config.replyPrimingTokens,
+    trace: config.trace,
+    visionFetch: config.visionFetch
+      ? { maxBytes: config.visionFetchMaxBytes, timeoutMs: config.visionFetchTimeoutMs }
+      : undefined,
+    usageTrailers: config.usageTrailers,
+    allowHeaderOverrides: config.allowHeaderOverrides,
+    errorVerbosity: config.verboseErrors ? 'verbose' : 'terse',
+    normalizeForm: config.normalizeForm,
+    interleaved: config.interleavedScript ? loadInterleavedScript(config.interleavedScript) : undefined,
+    cannedModels: config.cannedModels ? loadCannedModels(config.cannedModels) : undefined,
+    virtualModels: config.virtualModels ? loadVirtualModels(config.virtualModels) : undefined,
+    fanout: config.fanout,
+    responses: config.responses ? loadResponseMap(config.responses) : undefined,
+    responsesFallback: config.responsesFallback,
+    escalating: {
+      script: config.escalatingScript,
+      attempts: { ...DEFAULT_ATTEMPT_TRACKER_CONFIG, ttlMs: config.escalatingTtlSeconds * 1000 },
+    },
+    streamScenarios: config.streamScenarios ? loadStreamScenarios(config.streamScenarios) : undefined,
+    embeddingDimensions: config.embeddingDimensions,
+    maxEmbeddingDimensions: config.maxEmbeddingDimensions,
+    maxEmbeddingBatchSize: config.maxEmbeddingBatchSize,
+    maxChoices: config.maxChoices,
+    audit: auditSink && new AuditLogger(auditSink, config.auditContent),
+    logFilters: config.logFilters ? loadLogFilters(config.logFilters) : undefined,
+    webhook: config.webhookUrl === undefined
+      ? undefined
+      : {
+          url: config.webhookUrl,
+          secret: config.webhookSecret,
+          filter: { errorsOnly: config.webhookErrorsOnly, models: config.webhookModels },
+        },
+    shadow: config.shadowUrl === undefined
+      ? undefined
+      : {
+          baseUrl: config.shadowUrl,
+          apiKey: config.shadowApiKey,
+          model: config.shadowModel,
+          timeoutMs: config.shadowTimeoutMs,
+        },
+    security,
+    logger: logFile && new Logger(undefined, logFile),
+    exec,
+    outboundFetch: outboundProxy && createProxyFetch(outboundProxy),
   });
 
   // Add static file serving for development (Node.js only)
   const websiteRoot = path.resolve(__dirname, '../../website');
-  app.use('/*', serveStatic({ root: websiteRoot }));
+  server.app.use('/*', serveStatic({ root: websiteRoot }));
 
   console.log(JSON.stringify({
     level: 'info',
     message: 'Starting TeenyTiny AI server',
     port: config.port,
     api_key: maskAPIKey(config.apiKey),
+    ...(outboundProxy && {
+      outbound_proxy: {
+        proxy: outboundProxy.proxy && redactProxyUrl(outboundProxy.proxy),
+        https_proxy: outboundProxy.httpsProxy && redactProxyUrl(outboundProxy.httpsProxy),
+        http_proxy: outboundProxy.httpProxy && redactProxyUrl(outboundProxy.httpProxy),
+        no_proxy: outboundProxy.noProxy,
+      },
+    }),
   }));
 
-  // Start the server
-  serve({
-    fetch: app.fetch,
-    port: config.port,
-  });
+  // Models finish starting up before any listener accepts connections
+  await server.ready();
 
+  // Start the server, on the previous process's socket when this one was
+  // started to replace it. Listeners that fail to bind are reported by
+  // /health/deep while the others serve.
+  const listener = await inheritedListener();
+  const listening = await server.listenAll(listener ? [{ ...listens[0], listener }] : listens);
+  for (const failed of server.listeners().filter((status) => status.status === 'failed')) {
+    console.error(JSON.stringify({
+      level: 'error',
+      message: 'Listener failed to bind',
+      url: failed.url,
+      error: failed.error,
+    }));
+  }
+  if (listener) {
+    confirmUpgrade();
+    console.log(JSON.stringify({
+      level: 'info',
+      message: 'Upgrade: took over the listening socket',
+      pid: process.pid,
+    }));
+  }
+
+  // The ready signal: one line with everything orchestration needs instead
+  // of polling /health, mirrored to --ready-file and systemd
+  const urls = listening.servers.map((serving) => serving.url);
+  const ready: ReadyInfo = {
+    addresses: urls,
+    models: server.models(),
+    auth: { mode: 'api_key', api_key: maskAPIKey(config.apiKey), constant_time: config.constantTimeAuth },
+    pid: process.pid,
+  };
   console.log(JSON.stringify({
     level: 'info',
     message: 'Server started successfully',
-    address: `http://localhost:${config.port}`,
-    health_check: `http://localhost:${config.port}/health`,
-    models_endpoint: `http://localhost:${config.port}/v1/models`,
-    chat_endpoint: `http://localhost:${config.port}/v1/chat/completions`,
+    address: urls[0],
+    listeners: urls,
+    health_check: `${urls[0]}/health`,
+    models_endpoint: `${urls[0]}/v1/models`,
+    chat_endpoint: `${urls[0]}/v1/chat/completions`,
+    models: ready.models,
+    auth: ready.auth,
   }));
+  if (config.readyFile) {
+    await writeReadyFile(config.readyFile, ready);
+  }
+  await notifySystemd().catch((error: unknown) => {
+    console.error(JSON.stringify({
+      level: 'warn',
+      message: 'Could not notify systemd',
+      error: error instanceof Error ? error.message : String(error),
+    }));
+  });
+
+  // logrotate-style tools move the file away, then signal us to start a new one
+  if (logFile) {
+    process.on('SIGUSR1', () => logFile.reopen());
+  }
+
+  // Graceful shutdown: every listener drains its requests and streams, then
+  // buffered audit lines are flushed
+  const shutdown = async () => {
+    await listening.close();
+    exec?.close();
+    await auditSink?.close();
+    await logFile?.close();
+    process.exit(0);
+  };
 
-  // Graceful shutdown
   process.on('SIGINT', () => {
     console.log(JSON.stringify({
       level: 'info',
       message: 'Server shutting down gracefully...',
     }));
-    
-    process.exit(0);
+
+    void shutdown();
   });
 
   process.on('SIGTERM', () => {
@@ -147,9 +604,54 @@ async function main() {
       level: 'info',
       message: 'Server shutting down gracefully...',
     }));
-    
-    process.exit(0);
+
+    void shutdown();
   });
+
+  // Zero-downtime upgrades: a new process takes over the socket, then this
+  // one stops accepting and exits once its requests and streams finish
+  const [upgradable] = listening.servers;
+  if (config.upgradeSocket && upgradable) {
+    let upgrading = false;
+    process.on('SIGUSR2', () => {
+      if (upgrading) {
+        return;
+      }
+      upgrading = true;
+      console.log(JSON.stringify({
+        level: 'info',
+        message: 'Upgrade: starting new server process',
+        pid: process.pid,
+      }));
+
+      startUpgrade(upgradable.server).then(
+        async (child) => {
+          console.log(JSON.stringify({
+            level: 'info',
+            message: 'Upgrade: new process accepting connections, draining in-flight requests',
+            pid: process.pid,
+            new_pid: child.pid,
+          }));
+          await listening.close();
+          console.log(JSON.stringify({
+            level: 'info',
+            message: 'Upgrade: drained, exiting',
+            pid: process.pid,
+          }));
+          await shutdown();
+        },
+        (error) => {
+          upgrading = false;
+          console.error(JSON.stringify({
+            level: 'error',
+            message: 'Upgrade failed, still serving',
+            pid: process.pid,
+            error: error instanceof Error ? error.message : String(error),
+          }));
+        }
+      );
+    });
+  }
 }
 
 // Handle unhandled errors
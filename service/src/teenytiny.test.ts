@@ -0,0 +1,177 @@
+import { describe, it, expect } from "vitest";
+import { mkdtempSync } from "fs";
+import { tmpdir } from "os";
+import path from "path";
+import { createServer, SERVER_VERSION } from "./teenytiny.js";
+import type { Model } from "./teenytiny.js";
+import { TestServer } from "../tests/test-helpers.js";
+
+class ReverseModel implements Model {
+  async *process(input: string): AsyncGenerator<string> {
+    yield [...input].reverse().join("");
+  }
+}
+
+const apiKey = "tt-library-key";
+
+const completion = (model: string) =>
+  new Request("http://localhost/v1/chat/completions", {
+    method: "POST",
+    headers: {
+      Authorization: `Bearer ${apiKey}`,
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ model, messages: [{ role: "user", content: "abc" }] }),
+  });
+
+describe("createServer", () => {
+  it("should serve custom models alongside the built-in ones", async () => {
+    const server = createServer({
+      auth: { apiKey },
+      models: [{ id: "reverse", model: new ReverseModel() }],
+    });
+
+    const reversed = await (await server.fetch(completion("reverse"))).json();
+    expect(reversed.choices[0].message.content).toBe("cba");
+
+    const echoed = await (await server.fetch(completion("echo"))).json();
+    expect(echoed.choices[0].message.content).toBe("abc");
+  });
+
+  it("should let custom models replace built-in ones", async () => {
+    const server = createServer({
+      auth: { apiKey },
+      models: [{ id: "echo", model: new ReverseModel(), capabilities: { supportsStreaming: false } }],
+    });
+
+    const data = await (await server.fetch(completion("echo"))).json();
+    expect(data.choices[0].message.content).toBe("cba");
+  });
+
+  it("should report request size histograms in its stats", async () => {
+    const server = createServer({ auth: { apiKey } });
+    expect(server.stats()).toEqual({ requestSizes: [] });
+
+    await server.fetch(completion("echo"));
+
+    const [series] = server.stats().requestSizes;
+    expect(series).toMatchObject({ route: "/v1/chat/completions", model: "echo" });
+    expect(series?.histograms.prompt_characters).toMatchObject({ count: 1, sum: 3 });
+  });
+
+  it("should listen on a port until the signal aborts", async () => {
+    const server = createServer({ auth: { apiKey } });
+    const stop = new AbortController();
+
+    const listening = await server.listen({ port: 0, hostname: "127.0.0.1", signal: stop.signal });
+    const res = await fetch(`http://127.0.0.1:${listening.port}/health`);
+    expect(res.status).toBe(200);
+
+    stop.abort();
+    await listening.close();
+    await expect(fetch(`http://127.0.0.1:${listening.port}/health`)).rejects.toThrow();
+  });
+
+  it("should reject when the port can't be bound", async () => {
+    const first = await createServer({ auth: { apiKey } }).listen({ port: 0, hostname: "127.0.0.1" });
+
+    await expect(
+      createServer({ auth: { apiKey } }).listen({ port: first.port, hostname: "127.0.0.1" }),
+    ).rejects.toThrow("EADDRINUSE");
+    await first.close();
+  });
+
+  it("should serve the same state on a TCP and a unix listener", async () => {
+    const socketPath = path.join(mkdtempSync(path.join(tmpdir(), "teenytiny-")), "api.sock");
+    const server = await TestServer.start(
+      { auth: { apiKey }, quotas: { default: 1000 }, admin: { enabled: true } },
+      [{ port: 0, hostname: "127.0.0.1" }, { path: socketPath }],
+    );
+    const headers = { Authorization: `Bearer ${apiKey}`, "Content-Type": "application/json" };
+
+    try {
+      expect(server.baseUrls).toEqual([expect.stringMatching(/^http:\/\/127\.0\.0\.1:\d+$/), `unix:${socketPath}`]);
+
+      let used = 0;
+      for (const baseUrl of server.baseUrls) {
+        const res = await server.request(baseUrl, "/v1/chat/completions", {
+          method: "POST",
+          headers,
+          body: JSON.stringify({ model: "echo", messages: [{ role: "user", content: "abc" }] }),
+        });
+        expect(res.status).toBe(200);
+        const data = await res.json();
+        expect(data.choices[0].message.content).toBe("abc");
+        used += data.usage.total_tokens;
+      }
+
+      // Either listener sees the usage of both
+      for (const baseUrl of server.baseUrls) {
+        const quotas = await (await server.request(baseUrl, "/admin/quotas", { headers })).json();
+        expect(quotas.data[0].used).toBe(used);
+      }
+      expect(server.stats().requestSizes[0]?.histograms.messages.count).toBe(2);
+    } finally {
+      await server.close();
+    }
+  });
+
+  it("should report each listener's bind status and keep serving on the rest", async () => {
+    const taken = await createServer({ auth: { apiKey } }).listen({ port: 0, hostname: "127.0.0.1" });
+    const server = createServer({ auth: { apiKey } });
+
+    const listening = await server.listenAll([
+      { port: 0, hostname: "127.0.0.1" },
+      { port: taken.port, hostname: "127.0.0.1" },
+    ]);
+    expect(listening.servers).toHaveLength(1);
+
+    const res = await fetch(`${listening.servers[0]?.url}/health/deep`);
+    const health = await res.json();
+    expect(health.status).toBe("degraded");
+    expect(health.checks.listeners).toEqual([
+      { url: listening.servers[0]?.url, status: "listening" },
+      { url: `http://127.0.0.1:${taken.port}`, status: "failed", error: expect.stringContaining("EADDRINUSE") },
+    ]);
+
+    await listening.close();
+    expect(server.listeners()[0]?.status).toBe("closed");
+    await taken.close();
+  });
+
+  it("should reject listenAll when no listener can bind", async () => {
+    const taken = await createServer({ auth: { apiKey } }).listen({ port: 0, hostname: "127.0.0.1" });
+
+    await expect(
+      createServer({ auth: { apiKey } }).listenAll([{ port: taken.port, hostname: "127.0.0.1" }]),
+    ).rejects.toThrow("EADDRINUSE");
+    await taken.close();
+  });
+
+  it("should run model init hooks before reporting ready", async () => {
+    const started: string[] = [];
+    class SlowStartModel extends ReverseModel {
+      async init(): Promise<void> {
+        await new Promise((resolve) => setTimeout(resolve, 20));
+        started.push("slow");
+      }
+    }
+    class BrokenModel extends ReverseModel {
+      async init(): Promise<void> {
+        throw new Error("missing weights");
+      }
+    }
+
+    const server = createServer({ auth: { apiKey }, models: [{ id: "slow", model: new SlowStartModel() }] });
+    await server.ready();
+    expect(started).toEqual(["slow"]);
+    expect(server.models()).toContain("slow");
+
+    const broken = createServer({ auth: { apiKey }, models: [{ id: "broken", model: new BrokenModel() }] });
+    await expect(broken.ready()).rejects.toThrow("Model broken failed to initialize: missing weights");
+  });
+
+  it("should report the version of the public API", () => {
+    expect(SERVER_VERSION).toMatch(/^\d+\.\d+\.\d+$/);
+  });
+});
@@ -0,0 +1,200 @@
+/**
+ * Public API for running the server inside another Node.js program, e.g. a
+ * mock with models of its own. Published as `teenytiny-api/server`.
+ *
+ * Everything exported from this module follows semantic versioning with
+ * SERVER_VERSION: breaking changes to it only come with a new major version.
+ * The rest of src is internal and may change in any release.
+ */
+import { createAdaptorServer } from '@hono/node-server';
+import type { ServerType } from '@hono/node-server';
+import { createServer as createHttpsServer } from 'https';
+import { createServer as createHttp2Server } from 'http2';
+import type { Server } from 'net';
+import { buildApp, createApp } from './app.js';
+import type { AppConfig } from './app.js';
+import { initModels } from './utils/model-init.js';
+import { listenerUrl } from './utils/listen-address.js';
+import type { ListenerStatus } from './utils/listen-address.js';
+import type { RequestSizeSeries } from './utils/request-sizes.js';
+
+export type { AdminConfig, AppConfig, CustomModel } from './app.js';
+export type { AuthConfig } from './auth/auth-config.js';
+export type {
+  Model,
+  ModelCapabilities,
+  ModelCitation,
+  ModelContext,
+  ModelFinishReason,
+  ModelMessage,
+  ModelTool,
+  ModelToolCall,
+} from './models/model.js';
+export type { ListenerStatus } from './utils/listen-address.js';
+export type { HistogramSnapshot, RequestSizeSeries } from './utils/request-sizes.js';
+export { SERVER_VERSION } from './version.js';
+
+export type TeenyTinyApp = ReturnType<typeof createApp>;
+
+export interface ListenOptions {
+  // 0 picks a free port, reported by the returned server
+  port?: number | undefined;
+  hostname?: string | undefined;
+  // Listens on a unix socket at this path instead of a port
+  path?: string | undefined;
+  // Serves HTTPS with this PEM certificate and key
+  tls?: { cert: string | Buffer; key: string | Buffer } | undefined;
+  // Serves cleartext HTTP/2 (with prior knowledge) instead of HTTP/1.1
+  h2c?: boolean | undefined;
+  // Accepts connections on a socket another process is already listening
+  // on, e.g. one handed over during an upgrade, instead of binding port
+  listener?: Server | undefined;
+  // Stops the server when aborted
+  signal?: AbortSignal | undefined;
+}
+
+export interface ListeningServer {
+  port: number;
+  // Base URL for clients, e.g. http://127.0.0.1:8080 or unix:/tmp/tt.sock
+  url: string;
+  // The Node.js server, e.g. for handing its socket to another process
+  server: ServerType;
+  // Stops accepting connections, resolving once open ones, streams
+  // included, have finished
+  close(): Promise<void>;
+}
+
+export interface TeenyTinyServer {
+  // The underlying Hono app, for adding routes or middleware before serving
+  app: TeenyTinyApp;
+  // Answers a request without listening anywhere, e.g. from tests or another
+  // server's handler
+  fetch(request: Request): Promise<Response>;
+  // Serves over HTTP, resolving once the port is bound
+  listen(options: ListenOptions): Promise<ListeningServer>;
+  // Serves the same app, and so the same state, on several addresses at
+  // once. Resolves once each has bound or failed to, and rejects only when
+  // none could be bound.
+  listenAll(options: ListenOptions[]): Promise<ListeningGroup>;
+  // Bind status of every listener so far, also shown by /health/deep
+  listeners(): ListenerStatus[];
+  // Resolves once every model's init() has finished, rejecting if one
+  // failed; listen after it so no request reaches a model too early
+  ready(): Promise<void>;
+  // Ids of the models being served
+  models(): string[];
+  // Aggregates since startup, the same as GET /admin/request-sizes and
+  // /metrics report
+  stats(): ServerStats;
+}
+
+export interface ServerStats {
+  requestSizes: RequestSizeSeries[];
+}
+
+export interface ListeningGroup {
+  servers: ListeningServer[];
+  // Stops every listener, resolving once all have drained
+  close(): Promise<void>;
+}
+
+export function createServer(config: AppConfig): TeenyTinyServer {
+  const statuses: ListenerStatus[] = [];
+  const { app, registry, requestSizes } = buildApp({ ...config, listeners: () => statuses });
+  // Started straight away; failures are reported by ready()
+  const initialized = initModels(registry);
+  initialized.catch(() => {});
+
+  const listen = ({ port = 0, hostname, path, tls, h2c, listener, signal }: ListenOptions) =>
+    new Promise<ListeningServer>((resolve, reject) => {
+      const scheme = path !== undefined ? 'unix' : tls ? 'https' : 'http';
+      let server: ServerType;
+      if (tls) {
+        server = createAdaptorServer({ fetch: app.fetch, createServer: createHttpsServer, serverOptions: tls });
+      } else if (h2c) {
+        server = createAdaptorServer({ fetch: app.fetch, createServer: createHttp2Server });
+      } else {
+        server = createAdaptorServer({ fetch: app.fetch });
+      }
+
+      // Reported in the order listeners were started
+      const status: ListenerStatus = { url: listenerUrl({ scheme, hostname, port, path }), status: 'binding' };
+      statuses.push(status);
+
+      const onError = (error: Error) => {
+        status.status = 'failed';
+        status.error = error.message;
+        reject(error);
+      };
+      const onListening = () => {
+        server.off('error', onError);
+        const address = server.address();
+        const bound = typeof address === 'object' && address ? address.port : port;
+        status.url = listenerUrl({ scheme, hostname, port: bound, path });
+        status.status = 'listening';
+
+        let closed: Promise<void> | undefined;
+        const close = () =>
+          (closed ??= closeServer(server).finally(() => {
+            status.status = 'closed';
+          }));
+        signal?.addEventListener('abort', () => void close(), { once: true });
+        resolve({ port: bound, url: status.url, server, close });
+      };
+
+      server.once('error', onError);
+      if (listener) {
+        server.listen(listener, onListening);
+      } else if (path !== undefined) {
+        server.listen(path, onListening);
+      } else if (hostname !== undefined) {
+        server.listen(port, hostname, onListening);
+      } else {
+        server.listen(port, onListening);
+      }
+    });
+
+  return {
+    app,
+    fetch: async (request) => app.fetch(request),
+    listen,
+    listenAll: async (options) => {
+      const results = await Promise.allSettled(options.map(listen));
+      const servers = results.flatMap((result) => (result.status === 'fulfilled' ? [result.value] : []));
+      const failure = results.find((result): result is PromiseRejectedResult => result.status === 'rejected');
+      if (servers.length === 0 && failure) {
+        throw failure.reason;
+      }
+      return {
+        servers,
+        close: async () => {
+          await Promise.all(servers.map((server) => server.close()));
+        },
+      };
+    },
+    listeners: () => statuses.map((status) => ({ ...status })),
+    ready: () => initialized,
+    models: () => registry.getIds(),
+    stats: () => ({ requestSizes: requestSizes.stats() }),
+  };
+}
+
+function closeServer(server: ServerType): Promise<void> {
+  return new Promise((resolve, reject) => {
+    // Idle keep-alive connections would otherwise hold the server open until
+    // they time out, so they're closed as soon as their requests finish
+    const closeIdle = setInterval(() => {
+      if ('closeIdleConnections' in server) {
+        server.closeIdleConnections();
+      }
+    }, 100);
+    server.close((error) => {
+      clearInterval(closeIdle);
+      if (error) {
+        reject(error);
+      } else {
+        resolve();
+      }
+    });
+  });
+}
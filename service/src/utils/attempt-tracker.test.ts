@@ -0,0 +1,50 @@
+import { describe, it, expect } from "vitest";
+import { AttemptTracker } from "./attempt-tracker.js";
+
+function fakeClock() {
+  const clock = { time: 1000, now: () => clock.time };
+  return clock;
+}
+
+describe("AttemptTracker", () => {
+  it("should number attempts per key", () => {
+    const tracker = new AttemptTracker({ ttlMs: 1000, maxEntries: 10 });
+
+    expect([tracker.next("a"), tracker.next("a"), tracker.next("b"), tracker.next("a")]).toEqual([1, 2, 1, 3]);
+
+    tracker.forget("a");
+    expect(tracker.next("a")).toBe(1);
+  });
+
+  it("should start over once the TTL passes without an attempt", () => {
+    const clock = fakeClock();
+    const tracker = new AttemptTracker({ ttlMs: 1000, maxEntries: 10 }, clock.now);
+    tracker.next("a");
+
+    clock.time += 999;
+    expect(tracker.next("a")).toBe(2);
+    clock.time += 1000;
+    expect(tracker.next("a")).toBe(1);
+  });
+
+  it("should forget the least recently attempted keys beyond the bound", () => {
+    const tracker = new AttemptTracker({ ttlMs: 1000, maxEntries: 2 });
+    tracker.next("a");
+    tracker.next("b");
+    tracker.next("a");
+    tracker.next("c");
+
+    expect(tracker.size).toBe(2);
+    expect(tracker.next("a")).toBe(3);
+    expect(tracker.next("b")).toBe(1);
+  });
+
+  it("should reset every key", () => {
+    const tracker = new AttemptTracker();
+    tracker.next("a");
+    tracker.next("b");
+
+    expect(tracker.reset()).toBe(2);
+    expect(tracker.next("a")).toBe(1);
+  });
+});
@@ -0,0 +1,65 @@
+export interface AttemptTrackerConfig {
+  // How long after its latest attempt a request is forgotten, so its next
+  // attempt counts as the first again
+  ttlMs: number;
+  // Upper bound on requests tracked; the least recently attempted are
+  // forgotten first
+  maxEntries: number;
+}
+
+export const DEFAULT_ATTEMPT_TRACKER_CONFIG: AttemptTrackerConfig = {
+  ttlMs: 5 * 60 * 1000,
+  maxEntries: 1000,
+};
+
+interface Attempts {
+  count: number;
+  expiresAt: number;
+}
+
+/**
+ * Counts attempts at the same request, by a key identifying it. Counting
+ * reads and updates the entry without awaiting anything in between, so
+ * concurrent retries of one request each get their own attempt number.
+ */
+export class AttemptTracker {
+  private entries = new Map<string, Attempts>();
+
+  constructor(
+    private config: AttemptTrackerConfig = DEFAULT_ATTEMPT_TRACKER_CONFIG,
+    private now: () => number = Date.now
+  ) {}
+
+  // Counts an attempt, returning its number from 1
+  next(key: string): number {
+    const entry = this.entries.get(key);
+    const count = entry && entry.expiresAt > this.now() ? entry.count + 1 : 1;
+    this.entries.delete(key);
+    this.entries.set(key, { count, expiresAt: this.now() + this.config.ttlMs });
+
+    // Maps iterate in insertion order and attempts re-insert, so the first
+    // key is the least recently attempted
+    while (this.entries.size > this.config.maxEntries) {
+      const oldest = this.entries.keys().next().value;
+      if (oldest === undefined) break;
+      this.entries.delete(oldest);
+    }
+    return count;
+  }
+
+  // Starts a request's count over
+  forget(key: string): void {
+    this.entries.delete(key);
+  }
+
+  // Starts every count over, returning how many requests were tracked
+  reset(): number {
+    const tracked = this.entries.size;
+    this.entries.clear();
+    return tracked;
+  }
+
+  get size(): number {
+    return this.entries.size;
+  }
+}
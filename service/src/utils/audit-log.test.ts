@@ -0,0 +1,76 @@
+import { describe, it, expect } from "vitest";
+import { AuditLogger, maskAPIKey } from "./audit-log.js";
+import type { AuditEntry } from "./audit-log.js";
+
+const entry: AuditEntry = {
+  requestId: "req-1",
+  apiKey: "tt-1234567890abcdef",
+  model: "echo",
+  streaming: false,
+  promptTokens: 3,
+  completionTokens: 4,
+  messages: [{ role: "user", content: "secret plans" }],
+  response: "secret plans",
+};
+
+function capture(includeContent?: boolean) {
+  const lines: string[] = [];
+  const logger = new AuditLogger({ write: (line) => lines.push(line) }, includeContent);
+  return { lines, logger };
+}
+
+describe("AuditLogger", () => {
+  it("should write one JSON line with counts and a masked key", () => {
+    const { lines, logger } = capture();
+
+    logger.record(entry);
+
+    expect(lines).toHaveLength(1);
+    const record = JSON.parse(lines[0]!);
+    expect(record).toMatchObject({
+      request_id: "req-1",
+      api_key: "tt-123***",
+      model: "echo",
+      streaming: false,
+      prompt_tokens: 3,
+      completion_tokens: 4,
+      total_tokens: 7,
+    });
+    expect(Date.parse(record.timestamp)).not.toBeNaN();
+  });
+
+  it("should leave message contents out unless enabled", () => {
+    const { lines, logger } = capture();
+
+    logger.record(entry);
+
+    expect(lines[0]).not.toContain("secret plans");
+  });
+
+  it("should include message contents when enabled", () => {
+    const { lines, logger } = capture(true);
+
+    logger.record(entry);
+
+    const record = JSON.parse(lines[0]!);
+    expect(record.messages).toEqual([{ role: "user", content: "secret plans" }]);
+    expect(record.response).toBe("secret plans");
+  });
+
+  it("should attribute records to the organization and project when known", () => {
+    const { lines, logger } = capture();
+
+    logger.record(entry);
+    logger.record({ ...entry, organization: "org-acme", project: "proj_web" });
+
+    expect(JSON.parse(lines[0]!)).not.toHaveProperty("organization");
+    expect(JSON.parse(lines[1]!)).toMatchObject({ organization: "org-acme", project: "proj_web" });
+  });
+});
+
+describe("maskAPIKey", () => {
+  it("should hide short keys entirely", () => {
+    expect(maskAPIKey("tt-123")).toBe("***");
+    expect(maskAPIKey("")).toBe("***");
+  });
+});
@@ -0,0 +1,88 @@
+/**
+ * Per-request audit trail, written as JSON lines
+ *
+ * Each chat completion produces one record with the masked API key, model and
+ * token counts, plus the conversation and reply when content capture is on.
+ * Records are handed to a sink that must not block: writing happens after the
+ * response is produced, and sinks are expected to buffer and flush on their
+ * own schedule (see FileAuditSink for the Node.js implementation).
+ */
+
+export interface AuditSink {
+  write(line: string): void;
+}
+
+export interface AuditMessage {
+  role: string;
+  content: string;
+}
+
+export interface AuditRecord {
+  timestamp: string;
+  request_id: string;
+  api_key: string;
+  // From the OpenAI-Organization and OpenAI-Project headers, when sent
+  organization?: string;
+  project?: string;
+  model: string;
+  streaming: boolean;
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+  messages?: AuditMessage[];
+  response?: string;
+}
+
+export interface AuditEntry {
+  requestId: string;
+  apiKey: string | undefined;
+  organization?: string | undefined;
+  project?: string | undefined;
+  model: string;
+  streaming: boolean;
+  promptTokens: number;
+  completionTokens: number;
+  messages: AuditMessage[];
+  response: string;
+}
+
+export class AuditLogger {
+  constructor(
+    private sink: AuditSink,
+    private includeContent: boolean = false,
+  ) {}
+
+  record(entry: AuditEntry): void {
+    const record: AuditRecord = {
+      timestamp: new Date().toISOString(),
+      request_id: entry.requestId,
+      api_key: maskAPIKey(entry.apiKey ?? ''),
+      model: entry.model,
+      streaming: entry.streaming,
+      prompt_tokens: entry.promptTokens,
+      completion_tokens: entry.completionTokens,
+      total_tokens: entry.promptTokens + entry.completionTokens,
+    };
+
+    if (entry.organization !== undefined) {
+      record.organization = entry.organization;
+    }
+    if (entry.project !== undefined) {
+      record.project = entry.project;
+    }
+
+    if (this.includeContent) {
+      record.messages = entry.messages;
+      record.response = entry.response;
+    }
+
+    this.sink.write(JSON.stringify(record));
+  }
+}
+
+export function maskAPIKey(key: string): string {
+  if (key.length <= 6) {
+    return '***';
+  }
+  return key.slice(0, 6) + '***';
+}
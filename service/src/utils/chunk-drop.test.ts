@@ -0,0 +1,37 @@
+import { describe, it, expect } from "vitest";
+import { chunkDropper } from "./chunk-drop.js";
+import type { ChatCompletionStreamResponse } from "../openai-protocol/types.js";
+
+const chunk = (choice: ChatCompletionStreamResponse["choices"][number]): ChatCompletionStreamResponse => ({
+  id: "chatcmpl-1",
+  object: "chat.completion.chunk",
+  created: 0,
+  model: "echo",
+  service_tier: "default",
+  system_fingerprint: "fp_0000000000",
+  choices: [choice],
+});
+
+describe("chunkDropper", () => {
+  it("should only ever drop chunks of output", () => {
+    const drop = chunkDropper({ probability: 1 }, undefined);
+
+    expect(drop(chunk({ index: 0, delta: { content: "Hi" } }))).toBe(true);
+    expect(drop(chunk({ index: 0, delta: { role: "assistant" } }))).toBe(false);
+    expect(drop(chunk({ index: 0, delta: {}, finish_reason: "stop" }))).toBe(false);
+    expect(drop({ ...chunk({ index: 0, delta: {} }), choices: [], usage: { prompt_tokens: 1, completion_tokens: 1, total_tokens: 2 } })).toBe(false);
+  });
+
+  it("should drop the same chunks for the same seed, preferring the request's", () => {
+    const content = chunk({ index: 0, delta: { content: "x" } });
+    const drops = (requestSeed: number | undefined, seed?: number) => {
+      const drop = chunkDropper({ probability: 0.5, seed }, requestSeed, () => 0);
+      return Array.from({ length: 32 }, () => drop(content));
+    };
+
+    expect(drops(undefined, 7)).toEqual(drops(undefined, 7));
+    expect(drops(3, 7)).toEqual(drops(3));
+    expect(drops(undefined, 7)).not.toEqual(drops(undefined, 8));
+    expect(drops(undefined).every(Boolean)).toBe(true);
+  });
+});
@@ -0,0 +1,34 @@
+import type { ChatCompletionStreamResponse } from '../openai-protocol/types.js';
+import { seededRandom } from './random.js';
+
+export interface ChunkDropOptions {
+  // Chance, from 0 to 1, of dropping each chunk of output
+  probability: number;
+  // Makes the drops reproducible; a request's own seed takes precedence
+  seed?: number | undefined;
+}
+
+/**
+ * Decides, chunk by chunk, which chunks of a stream to leave out, like a
+ * lossy network losing packets, so clients can be tested for coping with
+ * gaps in the output, or for noticing them. Only chunks of output are ever
+ * dropped: the role chunk, each choice's finish and the usage always arrive,
+ * so a client still sees the stream start and end.
+ */
+export function chunkDropper(
+  options: ChunkDropOptions,
+  requestSeed: number | undefined,
+  random: () => number = Math.random
+): (chunk: ChatCompletionStreamResponse) => boolean {
+  const seed = requestSeed ?? options.seed;
+  const next = seed === undefined ? random : seededRandom(seed);
+  return (chunk) => carriesOnlyOutput(chunk) && next() < options.probability;
+}
+
+function carriesOnlyOutput(chunk: ChatCompletionStreamResponse): boolean {
+  return (
+    chunk.usage === undefined &&
+    chunk.choices.length > 0 &&
+    chunk.choices.every((choice) => choice.delta.role === undefined && (choice.finish_reason ?? null) === null)
+  );
+}
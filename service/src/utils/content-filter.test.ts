@@ -0,0 +1,31 @@
+import { describe, it, expect } from "vitest";
+import { DEFAULT_CONTENT_FILTER_RESULTS, parseContentFilterResults } from "./content-filter.js";
+
+describe("parseContentFilterResults", () => {
+  it("should accept severity and detected results", () => {
+    const results = {
+      hate: { filtered: false, severity: "low" },
+      violence: { filtered: true, severity: "high" },
+      jailbreak: { filtered: false, detected: false },
+    };
+
+    expect(parseContentFilterResults(results)).toEqual(results);
+  });
+
+  it("should accept the defaults", () => {
+    expect(parseContentFilterResults(DEFAULT_CONTENT_FILTER_RESULTS)).toEqual(DEFAULT_CONTENT_FILTER_RESULTS);
+  });
+
+  it.each([
+    [[], "non-empty object"],
+    [{}, "non-empty object"],
+    [{ hate: "safe" }, "hate must be an object"],
+    [{ hate: { filtered: "no", severity: "safe" } }, "hate.filtered must be true or false"],
+    [{ hate: { filtered: false } }, "hate needs a severity or detected"],
+    [{ hate: { filtered: false, severity: "extreme" } }, "hate.severity must be one of safe, low, medium, high"],
+    [{ jailbreak: { filtered: false, detected: "no" } }, "jailbreak.detected must be true or false"],
+    [{ hate: { filtered: false, severity: "safe", score: 1 } }, "hate has unknown fields: score"],
+  ])("should reject %j", (value, message) => {
+    expect(() => parseContentFilterResults(value)).toThrow(message);
+  });
+});
@@ -0,0 +1,51 @@
+import { CONTENT_FILTER_SEVERITIES } from '../openai-protocol/types.js';
+import type { ContentFilterResult, ContentFilterSeverity } from '../openai-protocol/types.js';
+
+// What Azure OpenAI reports for a prompt that passed its default filters
+export const DEFAULT_CONTENT_FILTER_RESULTS: Record<string, ContentFilterResult> = {
+  hate: { filtered: false, severity: 'safe' },
+  self_harm: { filtered: false, severity: 'safe' },
+  sexual: { filtered: false, severity: 'safe' },
+  violence: { filtered: false, severity: 'safe' },
+};
+
+/**
+ * Parses content filter results keyed by category, e.g.
+ * {"hate": {"filtered": false, "severity": "low"}, "jailbreak": {"filtered":
+ * false, "detected": false}}. Each needs filtered, and a severity or
+ * detected.
+ */
+export function parseContentFilterResults(value: unknown): Record<string, ContentFilterResult> {
+  if (typeof value !== 'object' || value === null || Array.isArray(value) || Object.keys(value).length === 0) {
+    throw new Error('Content filter results must be a non-empty object keyed by category');
+  }
+
+  const results: Record<string, ContentFilterResult> = {};
+  for (const [category, result] of Object.entries(value)) {
+    if (typeof result !== 'object' || result === null || Array.isArray(result)) {
+      throw new Error(`${category} must be an object of filtered, and severity or detected`);
+    }
+    const { filtered, severity, detected, ...rest } = result as Record<string, unknown>;
+    if (Object.keys(rest).length > 0) {
+      throw new Error(`${category} has unknown fields: ${Object.keys(rest).join(', ')}`);
+    }
+    if (typeof filtered !== 'boolean') {
+      throw new Error(`${category}.filtered must be true or false`);
+    }
+    if (severity === undefined && detected === undefined) {
+      throw new Error(`${category} needs a severity or detected`);
+    }
+    if (severity !== undefined && !(CONTENT_FILTER_SEVERITIES as readonly unknown[]).includes(severity)) {
+      throw new Error(`${category}.severity must be one of ${CONTENT_FILTER_SEVERITIES.join(', ')}`);
+    }
+    if (detected !== undefined && typeof detected !== 'boolean') {
+      throw new Error(`${category}.detected must be true or false`);
+    }
+    results[category] = {
+      filtered,
+      ...(severity === undefined ? {} : { severity: severity as ContentFilterSeverity }),
+      ...(detected === undefined ? {} : { detected }),
+    };
+  }
+  return results;
+}
@@ -0,0 +1,2 @@
+// Headers that carry credentials or session cookies, never shown as sent
+export const CREDENTIAL_HEADERS = ['authorization', 'proxy-authorization', 'cookie', 'set-cookie'];
@@ -0,0 +1,62 @@
+import { describe, it, expect } from "vitest";
+import { CsvError, formatCsv, parseCsv } from "./csv.js";
+
+function failure(text: string): CsvError {
+  try {
+    parseCsv(text);
+  } catch (error) {
+    if (error instanceof CsvError) {
+      return error;
+    }
+  }
+  throw new Error("expected a CsvError");
+}
+
+describe("parseCsv", () => {
+  it("should split records and fields", () => {
+    expect(parseCsv("a,b\n1,2\n3,4")).toEqual([["a", "b"], ["1", "2"], ["3", "4"]]);
+    expect(parseCsv("a,b,\r\n1,2,\r\n")).toEqual([["a", "b", ""], ["1", "2", ""]]);
+  });
+
+  it("should unquote quoted fields, including commas, quotes and newlines", () => {
+    expect(parseCsv('name,quote\n"Lovelace, Ada","She said ""hi""\nthen left"\n')).toEqual([
+      ["name", "quote"],
+      ["Lovelace, Ada", 'She said "hi"\nthen left'],
+    ]);
+  });
+
+  it("should skip blank lines and a leading BOM", () => {
+    expect(parseCsv("\uFEFFa,b\n\n1,2\n\n")).toEqual([["a", "b"], ["1", "2"]]);
+  });
+
+  it("should keep unicode intact", () => {
+    expect(parseCsv("名前,都市\nアダ,東京 🗼\n")).toEqual([["名前", "都市"], ["アダ", "東京 🗼"]]);
+  });
+
+  it("should reject ragged rows with the line they start on", () => {
+    expect(failure("a,b\n1\n").message).toBe("parse error on line 2: expected 2 fields, got 1");
+    expect(failure('a,b\n"x\ny",2\n1,2,3\n').line).toBe(4);
+  });
+
+  it("should reject stray and unclosed quotes", () => {
+    expect(failure('a,b\n"open,2\n').message).toContain("quoted field starting on line 2 is never closed");
+    expect(failure('a,b\nx"y,2\n').message).toContain("unquoted field");
+    expect(failure('a,b\n"x"y,2\n').message).toContain('unexpected "y" after a closing quote');
+  });
+});
+
+describe("formatCsv", () => {
+  it("should quote only fields that need it and round-trip", () => {
+    const rows = [
+      ["a", "b"],
+      ["x, y", 'say "hi"'],
+      ["multi\nline", " padded"],
+      ["", "😀"],
+    ];
+
+    const csv = formatCsv(rows);
+
+    expect(csv).toBe('a,b\n"x, y","say ""hi"""\n"multi\nline"," padded"\n,😀\n');
+    expect(parseCsv(csv)).toEqual(rows);
+  });
+});
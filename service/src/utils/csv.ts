@@ -0,0 +1,96 @@
+// Why CSV couldn't be parsed, with the 1-based line it went wrong on
+export class CsvError extends Error {
+  constructor(message: string, public readonly line: number) {
+    super(`parse error on line ${line}: ${message}`);
+    this.name = 'CsvError';
+  }
+}
+
+/**
+ * Parses RFC 4180 CSV into rows of fields. Fields may be quoted, with ""
+ * for a quote, and quoted fields may span lines; CRLF and LF both end
+ * records, a leading BOM is dropped and blank lines are skipped. Every row
+ * must have as many fields as the first, as with Go's encoding/csv. Line
+ * numbers in errors count physical lines, so a quoted newline moves them on.
+ */
+export function parseCsv(text: string): string[][] {
+  const rows: string[][] = [];
+  const input = text.replace(/^\uFEFF/, '');
+  let line = 1;
+  let i = 0;
+
+  while (i < input.length) {
+    // Blank lines separate nothing
+    if (input[i] === '\n' || (input[i] === '\r' && input[i + 1] === '\n')) {
+      i += input[i] === '\r' ? 2 : 1;
+      line++;
+      continue;
+    }
+
+    const rowLine = line;
+    const row: string[] = [];
+    for (;;) {
+      let field = '';
+      if (input[i] === '"') {
+        const fieldLine = line;
+        i++;
+        for (;;) {
+          if (i >= input.length) {
+            throw new CsvError(`quoted field starting on line ${fieldLine} is never closed`, fieldLine);
+          }
+          const char = input[i]!;
+          if (char === '"') {
+            if (input[i + 1] === '"') {
+              field += '"';
+              i += 2;
+              continue;
+            }
+            i++;
+            break;
+          }
+          if (char === '\n') {
+            line++;
+          }
+          field += char;
+          i++;
+        }
+        if (i < input.length && input[i] !== ',' && input[i] !== '\n' && !(input[i] === '\r' && input[i + 1] === '\n')) {
+          throw new CsvError(`unexpected ${JSON.stringify(input[i])} after a closing quote`, line);
+        }
+      } else {
+        while (i < input.length && input[i] !== ',' && input[i] !== '\n' && !(input[i] === '\r' && input[i + 1] === '\n')) {
+          if (input[i] === '"') {
+            throw new CsvError('a " in an unquoted field must be inside a quoted one', line);
+          }
+          field += input[i];
+          i++;
+        }
+      }
+      row.push(field);
+
+      if (input[i] === ',') {
+        i++;
+        continue;
+      }
+      i += input[i] === '\r' ? 2 : 1;
+      line++;
+      break;
+    }
+
+    const expected = rows[0]?.length;
+    if (expected !== undefined && row.length !== expected) {
+      throw new CsvError(`expected ${expected} fields, got ${row.length}`, rowLine);
+    }
+    rows.push(row);
+  }
+  return rows;
+}
+
+// Formats rows as CSV lines ending in \n, quoting only fields that need it
+export function formatCsv(rows: string[][]): string {
+  return rows.map((row) => row.map(formatField).join(',') + '\n').join('');
+}
+
+function formatField(field: string): string {
+  return /[",\r\n]/.test(field) || /^\s|\s$/.test(field) ? `"${field.replace(/"/g, '""')}"` : field;
+}
@@ -0,0 +1,30 @@
+import { createWriteStream } from 'fs';
+import type { WriteStream } from 'fs';
+import type { AuditSink } from './audit-log.js';
+
+/**
+ * Appends audit lines to a file without blocking request handling.
+ *
+ * Lines are queued on a Node.js write stream, which buffers them in memory
+ * and writes asynchronously. Node.js only: the Cloudflare Worker has no
+ * filesystem, so it simply doesn't configure an audit sink.
+ */
+export class FileAuditSink implements AuditSink {
+  private stream: WriteStream;
+
+  constructor(path: string) {
+    this.stream = createWriteStream(path, { flags: 'a' });
+    this.stream.on('error', (error) => {
+      console.error(`Audit log write failed: ${error.message}`);
+    });
+  }
+
+  write(line: string): void {
+    this.stream.write(`${line}\n`);
+  }
+
+  // Flushes buffered lines and closes the file
+  close(): Promise<void> {
+    return new Promise((resolve) => this.stream.end(() => resolve()));
+  }
+}
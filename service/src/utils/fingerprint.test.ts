@@ -0,0 +1,26 @@
+import { describe, it, expect } from "vitest";
+import { systemFingerprint } from "./fingerprint.js";
+
+describe("systemFingerprint", () => {
+  it("should look like OpenAI's and be stable", () => {
+    const fingerprint = systemFingerprint("countdown", { delayMs: 10 });
+
+    expect(fingerprint).toMatch(/^fp_[0-9a-f]{10}$/);
+    expect(systemFingerprint("countdown", { delayMs: 10 })).toBe(fingerprint);
+  });
+
+  it("should ignore key order and undefined settings", () => {
+    expect(systemFingerprint("countdown", { delayMs: 10, maxCount: 5 })).toBe(
+      systemFingerprint("countdown", { maxCount: 5, delayMs: 10, defaultCount: undefined }),
+    );
+    expect(systemFingerprint("echo")).toBe(systemFingerprint("echo", {}));
+  });
+
+  it("should change with the model, its settings or the version", () => {
+    const fingerprint = systemFingerprint("countdown", { delayMs: 10 });
+
+    expect(systemFingerprint("echo", { delayMs: 10 })).not.toBe(fingerprint);
+    expect(systemFingerprint("countdown", { delayMs: 11 })).not.toBe(fingerprint);
+    expect(systemFingerprint("countdown", { delayMs: 10 }, "2.0.0")).not.toBe(fingerprint);
+  });
+});
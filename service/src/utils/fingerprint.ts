@@ -0,0 +1,36 @@
+import { SERVER_VERSION } from '../version.js';
+
+/**
+ * OpenAI-style system_fingerprint ("fp_" and 10 hex digits) for a model:
+ * a hash of its id, its settings and the server version. Identical
+ * deployments agree on it, and any settings change gives a new one, just
+ * as OpenAI's changes when the backend configuration does.
+ *
+ * Settings are serialized with sorted keys so only their values matter.
+ * FNV-1a rather than SHA-256 because it has to be synchronous; it's a label,
+ * not a security measure.
+ */
+export function systemFingerprint(modelId: string, settings?: unknown, version: string = SERVER_VERSION): string {
+  let hash = 0xcbf29ce484222325n;
+  for (const byte of new TextEncoder().encode(stableStringify([modelId, settings ?? {}, version]))) {
+    hash ^= BigInt(byte);
+    hash = (hash * 0x100000001b3n) & 0xffffffffffffffffn;
+  }
+  return `fp_${hash.toString(16).padStart(16, '0').slice(0, 10)}`;
+}
+
+// JSON with object keys sorted at every level; undefined properties are
+// dropped like JSON.stringify does
+function stableStringify(value: unknown): string {
+  if (Array.isArray(value)) {
+    return `[${value.map((item) => stableStringify(item ?? null)).join(',')}]`;
+  }
+  if (typeof value === 'object' && value !== null) {
+    const entries = Object.entries(value)
+      .filter(([, item]) => item !== undefined)
+      .sort(([a], [b]) => (a < b ? -1 : a > b ? 1 : 0))
+      .map(([key, item]) => `${JSON.stringify(key)}:${stableStringify(item)}`);
+    return `{${entries.join(',')}}`;
+  }
+  return JSON.stringify(value) ?? 'null';
+}
@@ -0,0 +1,47 @@
+import { describe, it, expect } from "vitest";
+import { appliedOverrides, forcedStatusError, parseHeaderOverrides } from "./header-overrides.js";
+
+describe("parseHeaderOverrides", () => {
+  it("should read every override header", () => {
+    const overrides = parseHeaderOverrides(
+      new Headers({
+        "X-TeenyTiny-Model": " eliza ",
+        "X-TeenyTiny-Delay": "250",
+        "X-TeenyTiny-Chunking": "Word",
+        "X-TeenyTiny-Force-Status": "503",
+      }),
+    );
+
+    expect(overrides).toEqual({ model: "eliza", delay: 250, chunking: "word", forceStatus: 503 });
+    expect(appliedOverrides(overrides)).toEqual(["model", "delay", "chunking", "force-status"]);
+  });
+
+  it("should accept a chunk size and ignore unrelated headers", () => {
+    expect(parseHeaderOverrides(new Headers({ "X-TeenyTiny-Chunking": "3", "X-Other": "1" }))).toEqual({ chunking: 3 });
+    expect(appliedOverrides({})).toEqual([]);
+  });
+
+  it.each([
+    ["X-TeenyTiny-Model", " "],
+    ["X-TeenyTiny-Delay", "-1"],
+    ["X-TeenyTiny-Delay", "60001"],
+    ["X-TeenyTiny-Delay", "1.5"],
+    ["X-TeenyTiny-Chunking", "0"],
+    ["X-TeenyTiny-Chunking", "line"],
+    ["X-TeenyTiny-Force-Status", "200"],
+    ["X-TeenyTiny-Force-Status", ""],
+  ])("should reject %s: %j", (header, value) => {
+    expect(() => parseHeaderOverrides(new Headers({ [header]: value }))).toThrow(
+      expect.objectContaining({ param: header, statusCode: 400 }),
+    );
+  });
+});
+
+describe("forcedStatusError", () => {
+  it("should type errors to match the status", () => {
+    expect(forcedStatusError(429)).toMatchObject({ statusCode: 429, type: "rate_limit_error", code: "forced_status" });
+    expect(forcedStatusError(503).type).toBe("overloaded_error");
+    expect(forcedStatusError(418).type).toBe("invalid_request_error");
+    expect(forcedStatusError(502).type).toBe("api_error");
+  });
+});
@@ -0,0 +1,91 @@
+import { APIError, InvalidRequestError, statusError } from '../openai-protocol/errors.js';
+import type { Chunking } from '../openai-protocol/adapter.js';
+
+// Lists the overrides a response honoured, e.g. "model, delay"
+export const OVERRIDES_APPLIED_HEADER = 'X-TeenyTiny-Overrides-Applied';
+
+// Longest X-TeenyTiny-Delay accepted
+export const MAX_OVERRIDE_DELAY_MS = 60_000;
+
+/**
+ * Per-request behaviour changes for clients that can add headers but not
+ * change the request body. Header values win over the body.
+ */
+export interface HeaderOverrides {
+  // X-TeenyTiny-Model: replaces the body's model
+  model?: string;
+  // X-TeenyTiny-Delay: milliseconds to wait before the model runs
+  delay?: number;
+  // X-TeenyTiny-Chunking: char, word or a chunk size in characters
+  chunking?: Chunking;
+  // X-TeenyTiny-Force-Status: fail with this 4xx or 5xx status instead of
+  // running the model
+  forceStatus?: number;
+}
+
+/**
+ * Reads the X-TeenyTiny-* override headers, throwing an InvalidRequestError
+ * naming the header when a value is malformed.
+ */
+export function parseHeaderOverrides(headers: Headers): HeaderOverrides {
+  const overrides: HeaderOverrides = {};
+
+  const model = headers.get('X-TeenyTiny-Model');
+  if (model !== null) {
+    if (model.trim() === '') {
+      throw new InvalidRequestError('X-TeenyTiny-Model must name a model', 'X-TeenyTiny-Model');
+    }
+    overrides.model = model.trim();
+  }
+
+  const delay = headers.get('X-TeenyTiny-Delay');
+  if (delay !== null) {
+    overrides.delay = parseInteger(delay, 0, MAX_OVERRIDE_DELAY_MS, 'X-TeenyTiny-Delay', 'milliseconds');
+  }
+
+  const chunking = headers.get('X-TeenyTiny-Chunking');
+  if (chunking !== null) {
+    const mode = chunking.trim().toLowerCase();
+    overrides.chunking =
+      mode === 'char' || mode === 'word'
+        ? mode
+        : parseInteger(chunking, 1, Number.MAX_SAFE_INTEGER, 'X-TeenyTiny-Chunking', 'char, word or characters per chunk');
+  }
+
+  const forceStatus = headers.get('X-TeenyTiny-Force-Status');
+  if (forceStatus !== null) {
+    overrides.forceStatus = parseInteger(forceStatus, 400, 599, 'X-TeenyTiny-Force-Status', 'an HTTP status');
+  }
+
+  return overrides;
+}
+
+// Header names of the overrides present, for the applied header and logs
+export function appliedOverrides(overrides: HeaderOverrides): string[] {
+  const names: Record<keyof HeaderOverrides, string> = {
+    model: 'model',
+    delay: 'delay',
+    chunking: 'chunking',
+    forceStatus: 'force-status',
+  };
+  return (Object.keys(names) as Array<keyof HeaderOverrides>)
+    .filter((key) => overrides[key] !== undefined)
+    .map((key) => names[key]);
+}
+
+// The error an X-TeenyTiny-Force-Status request fails with, typed to match
+// what a real API would send with that status
+export function forcedStatusError(status: number): APIError {
+  return statusError(status, `Status ${status} forced by X-TeenyTiny-Force-Status`, 'forced_status');
+}
+
+function parseInteger(value: string, min: number, max: number, header: string, expected: string): number {
+  const number = Number(value.trim());
+  if (value.trim() === '' || !Number.isInteger(number) || number < min || number > max) {
+    throw new InvalidRequestError(
+      `${header} must be ${expected}${max === Number.MAX_SAFE_INTEGER ? '' : ` from ${min} to ${max}`}`,
+      header
+    );
+  }
+  return number;
+}
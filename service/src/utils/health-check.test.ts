@@ -0,0 +1,58 @@
+import { describe, it, expect } from "vitest";
+import { checkGeneration } from "./health-check.js";
+import { OpenAIModelRegistry } from "../openai-protocol/openai-model-registry.js";
+import { ModelRegistry } from "../models/model-registry.js";
+import { EchoModel } from "../models/echo-model.js";
+import type { Model } from "../models/model.js";
+
+function registryWith(echo?: Model) {
+  const registry = new OpenAIModelRegistry(new ModelRegistry());
+  if (echo) {
+    registry.register("echo", echo);
+  }
+  return registry;
+}
+
+describe("checkGeneration", () => {
+  it("should pass when echo replies with the prompt", async () => {
+    const check = await checkGeneration(registryWith(new EchoModel()));
+
+    expect(check).toEqual({ status: "ok", latency_ms: expect.any(Number) });
+  });
+
+  it("should fail when echo isn't registered", async () => {
+    const check = await checkGeneration(registryWith());
+
+    expect(check).toMatchObject({ status: "error", error: "Model echo is not registered" });
+  });
+
+  it("should fail when the model throws or replies wrongly", async () => {
+    const broken: Model = {
+      async *process() {
+        throw new Error("tokenizer exploded");
+      },
+    };
+    const wrong: Model = {
+      async *process() {
+        yield "something else";
+      },
+    };
+
+    expect(await checkGeneration(registryWith(broken))).toMatchObject({ status: "error", error: "tokenizer exploded" });
+    expect((await checkGeneration(registryWith(wrong))).error).toContain("Unexpected reply");
+  });
+
+  it("should fail when the model takes longer than the timeout", async () => {
+    const stuck: Model = {
+      async *process() {
+        await new Promise(() => {});
+        yield "never";
+      },
+    };
+
+    const check = await checkGeneration(registryWith(stuck), 20);
+
+    expect(check).toMatchObject({ status: "error", error: "No reply within 20ms" });
+    expect(check.latency_ms).toBeGreaterThanOrEqual(15);
+  });
+});
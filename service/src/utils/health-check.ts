@@ -0,0 +1,62 @@
+import type { OpenAIModelRegistry } from '../openai-protocol/openai-model-registry.js';
+
+// Model run by the deep health check, with a prompt it must echo back
+export const HEALTH_CHECK_MODEL = 'echo';
+const PROMPT = 'health check';
+
+export const DEFAULT_HEALTH_CHECK_TIMEOUT_MS = 1000;
+
+export interface GenerationCheck {
+  status: 'ok' | 'error';
+  latency_ms: number;
+  error?: string;
+}
+
+/**
+ * Runs a tiny completion through the registry and adapter, the same path
+ * requests take, and checks the reply. A process can be up while this
+ * fails, e.g. when the echo model is missing or the adapter throws.
+ */
+export async function checkGeneration(
+  registry: OpenAIModelRegistry,
+  timeoutMs: number = DEFAULT_HEALTH_CHECK_TIMEOUT_MS
+): Promise<GenerationCheck> {
+  const start = performance.now();
+  const signal = AbortSignal.timeout(timeoutMs);
+  const result = (error?: string): GenerationCheck => {
+    const check: GenerationCheck = {
+      status: error === undefined ? 'ok' : 'error',
+      latency_ms: Math.round(performance.now() - start),
+    };
+    if (error !== undefined) {
+      check.error = error;
+    }
+    return check;
+  };
+
+  try {
+    const adapter = registry.get(HEALTH_CHECK_MODEL);
+    if (!adapter) {
+      return result(`Model ${HEALTH_CHECK_MODEL} is not registered`);
+    }
+
+    const timedOut = new Promise<never>((_, reject) =>
+      signal.addEventListener('abort', () => reject(new Error(`No reply within ${timeoutMs}ms`)), { once: true })
+    );
+    const response = await Promise.race([
+      adapter.complete(
+        { model: HEALTH_CHECK_MODEL, messages: [{ role: 'user', content: PROMPT }] },
+        { signal }
+      ),
+      timedOut,
+    ]);
+
+    const content = response.choices[0]?.message.content;
+    if (content !== PROMPT) {
+      return result(`Unexpected reply: ${JSON.stringify(content)}`);
+    }
+    return result();
+  } catch (error) {
+    return result(error instanceof Error ? error.message : String(error));
+  }
+}
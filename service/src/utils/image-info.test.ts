@@ -0,0 +1,50 @@
+import { describe, it, expect } from "vitest";
+import { readFileSync } from "fs";
+import { inspectImage, parseDataUri } from "./image-info.js";
+
+// A 3x2 red PNG
+const PNG_3X2 = readFileSync(new URL("../../tests/testdata/red-3x2.png", import.meta.url)).toString("base64");
+
+// The start of a baseline JPEG: SOI, a JFIF APP0 segment, then SOF0 for a
+// 5x4 image
+const JPEG_5X4 = Uint8Array.from([
+  0xff, 0xd8,
+  0xff, 0xe0, 0x00, 0x10, 0x4a, 0x46, 0x49, 0x46, 0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
+  0xff, 0xc0, 0x00, 0x11, 0x08, 0x00, 0x04, 0x00, 0x05, 0x03, 0x01, 0x22, 0x00, 0x02, 0x11, 0x01, 0x03, 0x11, 0x01,
+]);
+
+describe("parseDataUri", () => {
+  it("should decode base64 and percent-encoded data", () => {
+    const png = parseDataUri(`data:image/png;base64,${PNG_3X2}`);
+    expect(png.mediaType).toBe("image/png");
+    expect(png.bytes.length).toBe(73);
+
+    const text = parseDataUri("data:,hello%20world");
+    expect(text.mediaType).toBe("text/plain");
+    expect(new TextDecoder().decode(text.bytes)).toBe("hello world");
+  });
+
+  it("should reject malformed base64 rather than skip it", () => {
+    expect(() => parseDataUri("data:image/png;base64,iVBO!w0K")).toThrow("invalid base64");
+    expect(() => parseDataUri("data:image/png;base64,iVBORw0")).toThrow("invalid base64");
+    expect(() => parseDataUri("image/png;base64,iVBO")).toThrow("not a data URI");
+  });
+});
+
+describe("inspectImage", () => {
+  it("should read PNG and JPEG dimensions", () => {
+    expect(inspectImage(parseDataUri(`data:image/png;base64,${PNG_3X2}`).bytes)).toEqual({
+      format: "png",
+      width: 3,
+      height: 2,
+    });
+    expect(inspectImage(JPEG_5X4)).toEqual({ format: "jpeg", width: 5, height: 4 });
+  });
+
+  it("should recognise other formats by their magic bytes only", () => {
+    expect(inspectImage(new TextEncoder().encode("GIF89a\x01\x00\x01\x00"))).toEqual({ format: "gif" });
+    expect(inspectImage(new TextEncoder().encode("RIFF\x00\x00\x00\x00WEBPVP8 "))).toEqual({ format: "webp" });
+    expect(inspectImage(new TextEncoder().encode("not an image"))).toEqual({ format: undefined });
+    expect(inspectImage(JPEG_5X4.subarray(0, 24))).toEqual({ format: "jpeg" });
+  });
+});
@@ -0,0 +1,93 @@
+// Formats recognised from their magic bytes
+export type ImageFormat = 'png' | 'jpeg' | 'gif' | 'webp';
+
+export interface ImageInfo {
+  format: ImageFormat | undefined;
+  // Only read from PNG and JPEG headers
+  width?: number | undefined;
+  height?: number | undefined;
+}
+
+export interface DataUri {
+  // Declared media type, e.g. image/png; text/plain when left out, as RFC
+  // 2397 says
+  mediaType: string;
+  bytes: Uint8Array;
+}
+
+const PNG_SIGNATURE = [0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a];
+
+/**
+ * Decodes a data: URI, base64 or percent-encoded. Throws on malformed ones,
+ * including base64 with characters outside the alphabet or bad padding,
+ * which Buffer.from would otherwise skip over silently.
+ */
+export function parseDataUri(uri: string): DataUri {
+  const match = /^data:([^,]*),(.*)$/s.exec(uri);
+  if (!match) {
+    throw new Error('not a data URI');
+  }
+  const [, header = '', data = ''] = match;
+  const params = header.split(';');
+  const base64 = params[params.length - 1]?.toLowerCase() === 'base64';
+  const mediaType = (base64 ? params.slice(0, -1) : params)[0] || 'text/plain';
+
+  if (!base64) {
+    return { mediaType, bytes: new TextEncoder().encode(decodeURIComponent(data)) };
+  }
+  const encoded = data.replace(/\s+/g, '');
+  if (!/^[A-Za-z0-9+/]*={0,2}$/.test(encoded) || encoded.length % 4 !== 0) {
+    throw new Error('invalid base64');
+  }
+  return { mediaType, bytes: new Uint8Array(Buffer.from(encoded, 'base64')) };
+}
+
+// Recognises the format from the first bytes, and reads the dimensions of
+// PNG and JPEG images
+export function inspectImage(bytes: Uint8Array): ImageInfo {
+  const view = new DataView(bytes.buffer, bytes.byteOffset, bytes.byteLength);
+  const ascii = (start: number, end: number) => String.fromCharCode(...bytes.subarray(start, end));
+
+  if (PNG_SIGNATURE.every((byte, i) => bytes[i] === byte)) {
+    // The IHDR chunk always comes first: length, type, then width and height
+    if (bytes.length >= 24 && ascii(12, 16) === 'IHDR') {
+      return { format: 'png', width: view.getUint32(16), height: view.getUint32(20) };
+    }
+    return { format: 'png' };
+  }
+  if (bytes[0] === 0xff && bytes[1] === 0xd8 && bytes[2] === 0xff) {
+    return { format: 'jpeg', ...jpegDimensions(bytes, view) };
+  }
+  if (ascii(0, 6) === 'GIF87a' || ascii(0, 6) === 'GIF89a') {
+    return { format: 'gif' };
+  }
+  if (ascii(0, 4) === 'RIFF' && ascii(8, 12) === 'WEBP') {
+    return { format: 'webp' };
+  }
+  return { format: undefined };
+}
+
+// Walks the JPEG segments to the first start-of-frame marker, which holds
+// the height and width
+function jpegDimensions(bytes: Uint8Array, view: DataView): { width?: number; height?: number } {
+  let offset = 2;
+  while (offset + 4 <= bytes.length) {
+    if (bytes[offset] !== 0xff) {
+      return {};
+    }
+    const marker = bytes[offset + 1] ?? 0;
+    // Fill bytes and standalone markers have no length
+    if (marker === 0xff || marker === 0x01 || (marker >= 0xd0 && marker <= 0xd7)) {
+      offset += marker === 0xff ? 1 : 2;
+      continue;
+    }
+    const length = view.getUint16(offset + 2);
+    // SOF0 to SOF15, apart from DHT (C4), JPG (C8) and DAC (CC)
+    const isFrame = marker >= 0xc0 && marker <= 0xcf && marker !== 0xc4 && marker !== 0xc8 && marker !== 0xcc;
+    if (isFrame && offset + 9 <= bytes.length) {
+      return { height: view.getUint16(offset + 5), width: view.getUint16(offset + 7) };
+    }
+    offset += 2 + length;
+  }
+  return {};
+}
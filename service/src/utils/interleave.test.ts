@@ -0,0 +1,95 @@
+import { describe, it, expect } from "vitest";
+import { interleave } from "./interleave.js";
+import type { Interleaved } from "./interleave.js";
+import { sleep } from "./sleep.js";
+
+// Yields count values a delay apart, recording how many it has produced
+function producer(name: string, count: number, delayMs: number, produced: Record<string, number>) {
+  return (async function* () {
+    for (let i = 0; i < count; i++) {
+      await sleep(delayMs);
+      produced[name] = i + 1;
+      yield `${name}${i}`;
+    }
+    return `${name} done`;
+  })();
+}
+
+describe("interleave", () => {
+  it("should yield every value in order per iterator, then its return value", async () => {
+    const produced: Record<string, number> = {};
+    const events: Interleaved<string, string>[] = [];
+    for await (const event of interleave([producer("a", 3, 2, produced), producer("b", 2, 5, produced)])) {
+      events.push(event);
+    }
+
+    const byIndex = (index: number) => events.filter((event) => event.index === index).map((event) => event.value);
+    expect(byIndex(0)).toEqual(["a0", "a1", "a2", "a done"]);
+    expect(byIndex(1)).toEqual(["b0", "b1", "b done"]);
+  });
+
+  it("should yield values as they arrive rather than one iterator at a time", async () => {
+    const produced: Record<string, number> = {};
+    const order: string[] = [];
+    for await (const event of interleave([producer("slow", 2, 30, produced), producer("fast", 2, 1, produced)])) {
+      order.push(event.value);
+    }
+
+    expect(order.indexOf("fast done")).toBeLessThan(order.indexOf("slow0"));
+  });
+
+  it("should never let an iterator run more than one value ahead of the consumer", async () => {
+    const produced: Record<string, number> = {};
+    const consumed: Record<string, number> = {};
+    const names = ["a", "b", "c"];
+    for await (const event of interleave(names.map((name) => producer(name, 20, 0, produced)))) {
+      if (!event.done) {
+        const name = names[event.index]!;
+        consumed[name] = (consumed[name] ?? 0) + 1;
+        // A slow consumer
+        await sleep(1);
+        for (const other of names) {
+          expect((produced[other] ?? 0) - (consumed[other] ?? 0)).toBeLessThanOrEqual(1);
+        }
+      }
+    }
+  });
+
+  it("should return every unfinished iterator when ended early", async () => {
+    let returned = 0;
+    const endless = async function* () {
+      try {
+        for (let i = 0; ; i++) {
+          await sleep(1);
+          yield i;
+        }
+      } finally {
+        returned++;
+      }
+    };
+
+    for await (const event of interleave([endless(), endless()])) {
+      if (event.value === 3) break;
+    }
+    await sleep(10);
+
+    expect(returned).toBe(2);
+  });
+
+  it("should end with the first error", async () => {
+    const failing = async function* (): AsyncGenerator<string, string> {
+      await sleep(1);
+      throw new Error("boom");
+    };
+    const produced: Record<string, number> = {};
+
+    const merged = interleave([producer("a", 100, 1, produced), failing()]);
+    const drain = async () => {
+      while (!(await merged.next()).done) {
+        // keep going
+      }
+    };
+
+    await expect(drain()).rejects.toThrow("boom");
+  });
+});
@@ -0,0 +1,42 @@
+// A value from one of the interleaved iterators, or its return value once
+// it's done, tagged with the iterator's index
+export type Interleaved<T, R> =
+  | { index: number; done: false; value: T }
+  | { index: number; done: true; value: R };
+
+/**
+ * Merges async iterators, yielding each one's values in the order they
+ * arrive. An iterator is only asked for its next value once its last one has
+ * been consumed, so a slow consumer holds every iterator back rather than
+ * buffering what they produce: at most one value per iterator is in hand at
+ * any time. Errors end the merge; ending it early returns every iterator
+ * still running.
+ */
+export async function* interleave<T, R>(iterators: AsyncIterator<T, R>[]): AsyncGenerator<Interleaved<T, R>> {
+  type Pulled = { index: number; result: IteratorResult<T, R> };
+  const pending = new Map<number, Promise<Pulled>>();
+  const pull = (index: number) => {
+    pending.set(index, iterators[index]!.next().then((result) => ({ index, result })));
+  };
+  iterators.forEach((_, index) => pull(index));
+
+  try {
+    while (pending.size > 0) {
+      const { index, result } = await Promise.race(pending.values());
+      if (result.done) {
+        pending.delete(index);
+        yield { index, done: true, value: result.value };
+      } else {
+        yield { index, done: false, value: result.value };
+        pull(index);
+      }
+    }
+  } finally {
+    // Whatever the unfinished iterators produce or throw from here on is
+    // nobody's concern
+    for (const [index, promise] of pending) {
+      promise.catch(() => {});
+      iterators[index]!.return?.()?.catch(() => {});
+    }
+  }
+}
@@ -0,0 +1,147 @@
+import { describe, it, expect } from "vitest";
+import { JsonPatchError, applyJsonPatch, jsonEqual } from "./json-patch.js";
+import type { JsonValue } from "./json-patch.js";
+
+const document = { name: "Ada", tags: ["a", "b", "c"], address: { city: "London" }, "a/b": 1, "m~n": 2 };
+
+function failure(doc: JsonValue, patch: unknown): JsonPatchError {
+  try {
+    applyJsonPatch(doc, patch);
+  } catch (error) {
+    if (error instanceof JsonPatchError) {
+      return error;
+    }
+  }
+  throw new Error("expected a JsonPatchError");
+}
+
+describe("applyJsonPatch", () => {
+  it("should add object members and array elements", () => {
+    expect(
+      applyJsonPatch(document, [
+        { op: "add", path: "/age", value: 36 },
+        { op: "add", path: "/tags/1", value: "x" },
+        { op: "add", path: "/tags/-", value: "z" },
+        { op: "add", path: "/address/city", value: "Paris" },
+      ]),
+    ).toMatchObject({ age: 36, tags: ["a", "x", "b", "c", "z"], address: { city: "Paris" } });
+  });
+
+  it("should remove and replace values", () => {
+    expect(
+      applyJsonPatch(document, [
+        { op: "remove", path: "/tags/0" },
+        { op: "replace", path: "/name", value: { first: "Ada" } },
+        { op: "remove", path: "/address" },
+      ]),
+    ).toEqual({ name: { first: "Ada" }, tags: ["b", "c"], "a/b": 1, "m~n": 2 });
+  });
+
+  it("should keep members in order on replace", () => {
+    const patched = applyJsonPatch(document, [{ op: "replace", path: "/name", value: "Grace" }]);
+
+    expect(Object.keys(patched as object)).toEqual(Object.keys(document));
+  });
+
+  it("should move and copy values", () => {
+    expect(
+      applyJsonPatch(document, [
+        { op: "move", from: "/tags/0", path: "/tags/2" },
+        { op: "copy", from: "/address", path: "/home" },
+        { op: "move", from: "/address/city", path: "/city" },
+      ]),
+    ).toMatchObject({ tags: ["b", "c", "a"], home: { city: "London" }, address: {}, city: "London" });
+  });
+
+  it("should pass test operations on equal values in any member order", () => {
+    const patch = [
+      { op: "test", path: "/address", value: { city: "London" } },
+      { op: "test", path: "/tags", value: ["a", "b", "c"] },
+      { op: "test", path: "", value: { ...document } },
+    ];
+
+    expect(applyJsonPatch(document, patch)).toEqual(document);
+    expect(failure(document, [{ op: "test", path: "/tags", value: ["c", "b", "a"] }]).message).toContain(
+      'value is ["a","b","c"]',
+    );
+  });
+
+  it("should unescape ~0 and ~1 in paths", () => {
+    expect(
+      applyJsonPatch(document, [
+        { op: "remove", path: "/a~1b" },
+        { op: "replace", path: "/m~0n", value: 3 },
+      ]),
+    ).toMatchObject({ "m~n": 3 });
+  });
+
+  it("should replace the whole document at the root", () => {
+    expect(applyJsonPatch(document, [{ op: "add", path: "", value: [1] }])).toEqual([1]);
+    expect(applyJsonPatch(document, [{ op: "replace", path: "", value: null }])).toBeNull();
+    expect(failure(document, [{ op: "remove", path: "" }]).message).toContain("whole document");
+  });
+
+  it.each([
+    ["/tags/3", "add", true],
+    ["/tags/4", "add", false],
+    ["/tags/2", "remove", true],
+    ["/tags/3", "remove", false],
+    ["/tags/01", "add", false],
+    ["/tags/-1", "add", false],
+    ["/tags/-", "remove", false],
+  ])("should bound array index %s for %s", (path, op, valid) => {
+    const patch = [{ op, path, value: "v" }];
+
+    if (valid) {
+      expect(() => applyJsonPatch(document, patch)).not.toThrow();
+    } else {
+      expect(failure(document, patch).index).toBe(0);
+    }
+  });
+
+  it("should name the failing operation and leave the document alone", () => {
+    const original = structuredClone(document);
+    const error = failure(document, [
+      { op: "add", path: "/age", value: 36 },
+      { op: "replace", path: "/address/zip", value: "N1" },
+    ]);
+
+    expect(error.index).toBe(1);
+    expect(error.message).toBe('Operation 1 (replace /address/zip) failed: no member named "zip"');
+    expect(document).toEqual(original);
+  });
+
+  it("should reject values moved into their own children and paths through scalars", () => {
+    expect(failure(document, [{ op: "move", from: "/address", path: "/address/old" }]).message).toContain(
+      "own children",
+    );
+    expect(failure(document, [{ op: "add", path: "/name/first", value: "A" }]).message).toContain(
+      "/name is not an object or array",
+    );
+  });
+
+  it("should reject malformed patches", () => {
+    expect(failure(document, { op: "add" }).message).toContain("must be an array");
+    expect(failure(document, [{ op: "merge", path: "/a" }]).message).toContain('unknown op "merge"');
+    expect(failure(document, [{ op: "add", path: "/a" }]).message).toContain("needs a value");
+    expect(failure(document, [{ op: "copy", path: "/a" }]).message).toContain("needs a string from");
+    expect(failure(document, [{ op: "remove", path: "name" }]).message).toContain("must be empty or start with /");
+    expect(failure(document, [{ op: "remove", path: "/~2" }]).message).toContain("~ not followed by 0 or 1");
+  });
+
+  it("should add __proto__ as an ordinary member", () => {
+    const patched = applyJsonPatch({}, JSON.parse('[{"op": "add", "path": "/__proto__", "value": {"polluted": true}}]'));
+
+    expect(Object.keys(patched as object)).toEqual(["__proto__"]);
+    expect(({} as Record<string, unknown>).polluted).toBeUndefined();
+  });
+});
+
+describe("jsonEqual", () => {
+  it("should compare objects by members and arrays by order", () => {
+    expect(jsonEqual({ a: 1, b: [1, 2] }, { b: [1, 2], a: 1 })).toBe(true);
+    expect(jsonEqual([1, 2], [2, 1])).toBe(false);
+    expect(jsonEqual({ a: 1 }, { a: 1, b: undefined as unknown as JsonValue })).toBe(false);
+    expect(jsonEqual(1, "1")).toBe(false);
+  });
+});
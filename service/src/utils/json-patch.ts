@@ -0,0 +1,231 @@
+// A JSON value as JSON.parse returns it
+export type JsonValue = null | boolean | number | string | JsonValue[] | { [key: string]: JsonValue };
+
+export type JsonPatchOperation =
+  | { op: 'add' | 'replace' | 'test'; path: string; value: JsonValue }
+  | { op: 'remove'; path: string }
+  | { op: 'move' | 'copy'; from: string; path: string };
+
+const OPS = ['add', 'remove', 'replace', 'move', 'copy', 'test'];
+
+// Why a patch couldn't be applied; index is the failing operation's,
+// undefined when the patch itself is malformed
+export class JsonPatchError extends Error {
+  constructor(message: string, public readonly index?: number) {
+    super(message);
+    this.name = 'JsonPatchError';
+  }
+}
+
+/**
+ * Applies an RFC 6902 JSON Patch to a document, returning the patched copy.
+ * The patch is all or nothing: the document passed in is never modified,
+ * and the first failing operation throws a JsonPatchError naming it.
+ */
+export function applyJsonPatch(document: JsonValue, patch: unknown): JsonValue {
+  const operations = parseJsonPatch(patch);
+  let result = structuredClone(document);
+
+  operations.forEach((operation, index) => {
+    try {
+      result = applyOperation(result, operation);
+    } catch (error) {
+      const target = 'from' in operation ? `${operation.from} to ${operation.path}` : operation.path;
+      const reason = error instanceof Error ? error.message : String(error);
+      throw new JsonPatchError(`Operation ${index} (${operation.op} ${target || '""'}) failed: ${reason}`, index);
+    }
+  });
+  return result;
+}
+
+// Checks a patch is a list of well-formed operations
+export function parseJsonPatch(patch: unknown): JsonPatchOperation[] {
+  if (!Array.isArray(patch)) {
+    throw new JsonPatchError('A JSON Patch must be an array of operations');
+  }
+
+  return patch.map((operation: unknown, index) => {
+    const invalid = (reason: string) => new JsonPatchError(`Operation ${index} ${reason}`, index);
+    if (typeof operation !== 'object' || operation === null || Array.isArray(operation)) {
+      throw invalid('must be an object');
+    }
+    const { op, path, from } = operation as Record<string, unknown>;
+    if (typeof op !== 'string' || !OPS.includes(op)) {
+      throw invalid(`has an unknown op ${JSON.stringify(op)}; expected one of ${OPS.join(', ')}`);
+    }
+    if (typeof path !== 'string') {
+      throw invalid('needs a string path');
+    }
+    parsePointer(path, invalid);
+
+    if (op === 'move' || op === 'copy') {
+      if (typeof from !== 'string') {
+        throw invalid(`(${op}) needs a string from`);
+      }
+      parsePointer(from, invalid);
+    } else if ((op === 'add' || op === 'replace' || op === 'test') && !('value' in operation)) {
+      throw invalid(`(${op}) needs a value`);
+    }
+    return operation as JsonPatchOperation;
+  });
+}
+
+function applyOperation(document: JsonValue, operation: JsonPatchOperation): JsonValue {
+  switch (operation.op) {
+    case 'add':
+      return add(document, operation.path, structuredClone(operation.value));
+    case 'remove':
+      return remove(document, operation.path).document;
+    case 'replace':
+      return replace(document, operation.path, structuredClone(operation.value));
+    case 'move': {
+      if (operation.path.startsWith(`${operation.from}/`)) {
+        throw new Error('a value can\'t be moved into one of its own children');
+      }
+      if (operation.path === operation.from) {
+        get(document, operation.from);
+        return document;
+      }
+      const removed = remove(document, operation.from);
+      return add(removed.document, operation.path, removed.value);
+    }
+    case 'copy':
+      return add(document, operation.path, structuredClone(get(document, operation.from)));
+    case 'test': {
+      const actual = get(document, operation.path);
+      if (!jsonEqual(actual, operation.value)) {
+        throw new Error(`value is ${JSON.stringify(actual)}, not ${JSON.stringify(operation.value)}`);
+      }
+      return document;
+    }
+  }
+}
+
+// The reference tokens of an RFC 6901 JSON Pointer; "" is the whole document
+function parsePointer(pointer: string, invalid: (reason: string) => Error = (reason) => new Error(reason)): string[] {
+  if (pointer === '') {
+    return [];
+  }
+  if (!pointer.startsWith('/')) {
+    throw invalid(`path ${JSON.stringify(pointer)} must be empty or start with /`);
+  }
+  if (/~[^01]|~$/.test(pointer)) {
+    throw invalid(`path ${JSON.stringify(pointer)} has a ~ not followed by 0 or 1`);
+  }
+  return pointer.slice(1).split('/').map((token) => token.replace(/~1/g, '/').replace(/~0/g, '~'));
+}
+
+function get(document: JsonValue, pointer: string): JsonValue {
+  let value = document;
+  for (const token of parsePointer(pointer)) {
+    value = child(value, token);
+  }
+  return value;
+}
+
+// Adds or replaces the value at pointer; array elements from the index on
+// shift right, and "-" appends
+function add(document: JsonValue, pointer: string, value: JsonValue): JsonValue {
+  const tokens = parsePointer(pointer);
+  const last = tokens.pop();
+  if (last === undefined) {
+    return value;
+  }
+
+  const parent = tokens.reduce(child, document);
+  if (Array.isArray(parent)) {
+    const index = last === '-' ? parent.length : arrayIndex(parent, last, parent.length);
+    parent.splice(index, 0, value);
+  } else if (isObject(parent)) {
+    setMember(parent, last, value);
+  } else {
+    throw new Error(`${parentPath(tokens)} is not an object or array`);
+  }
+  return document;
+}
+
+// Swaps an existing value in place, keeping object members in order
+function replace(document: JsonValue, pointer: string, value: JsonValue): JsonValue {
+  const tokens = parsePointer(pointer);
+  const last = tokens.pop();
+  if (last === undefined) {
+    return value;
+  }
+
+  const parent = tokens.reduce(child, document);
+  child(parent, last);
+  if (Array.isArray(parent)) {
+    parent[Number(last)] = value;
+  } else if (isObject(parent)) {
+    setMember(parent, last, value);
+  }
+  return document;
+}
+
+function remove(document: JsonValue, pointer: string): { document: JsonValue; value: JsonValue } {
+  const tokens = parsePointer(pointer);
+  const last = tokens.pop();
+  if (last === undefined) {
+    throw new Error('the whole document can\'t be removed');
+  }
+
+  const parent = tokens.reduce(child, document);
+  const value = child(parent, last);
+  if (Array.isArray(parent)) {
+    parent.splice(arrayIndex(parent, last, parent.length - 1), 1);
+  } else if (isObject(parent)) {
+    delete parent[last];
+  }
+  return { document, value };
+}
+
+function child(value: JsonValue, token: string): JsonValue {
+  if (Array.isArray(value)) {
+    return value[arrayIndex(value, token, value.length - 1)] as JsonValue;
+  }
+  if (isObject(value)) {
+    if (!Object.prototype.hasOwnProperty.call(value, token)) {
+      throw new Error(`no member named ${JSON.stringify(token)}`);
+    }
+    return value[token] as JsonValue;
+  }
+  throw new Error(`can't look up ${JSON.stringify(token)} in ${JSON.stringify(value)}`);
+}
+
+// Array indices are decimal without leading zeros, up to max
+function arrayIndex(array: JsonValue[], token: string, max: number): number {
+  if (!/^(0|[1-9][0-9]*)$/.test(token)) {
+    throw new Error(`${JSON.stringify(token)} is not an array index`);
+  }
+  const index = Number(token);
+  if (index > max) {
+    throw new Error(`index ${index} is out of bounds for an array of length ${array.length}`);
+  }
+  return index;
+}
+
+// Defined rather than assigned, so a "__proto__" member stays a member
+function setMember(object: { [key: string]: JsonValue }, key: string, value: JsonValue): void {
+  Object.defineProperty(object, key, { value, writable: true, enumerable: true, configurable: true });
+}
+
+function parentPath(tokens: string[]): string {
+  return tokens.length === 0 ? 'the document' : `/${tokens.map((token) => token.replace(/~/g, '~0').replace(/\//g, '~1')).join('/')}`;
+}
+
+function isObject(value: JsonValue): value is { [key: string]: JsonValue } {
+  return typeof value === 'object' && value !== null && !Array.isArray(value);
+}
+
+// Structural equality: object members in any order, array elements in order
+export function jsonEqual(a: JsonValue, b: JsonValue): boolean {
+  if (Array.isArray(a) || Array.isArray(b)) {
+    return Array.isArray(a) && Array.isArray(b) && a.length === b.length && a.every((item, i) => jsonEqual(item, b[i] as JsonValue));
+  }
+  if (isObject(a) && isObject(b)) {
+    const keys = Object.keys(a);
+    return keys.length === Object.keys(b).length &&
+      keys.every((key) => Object.prototype.hasOwnProperty.call(b, key) && jsonEqual(a[key] as JsonValue, b[key] as JsonValue));
+  }
+  return a === b;
+}
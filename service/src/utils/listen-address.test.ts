@@ -0,0 +1,41 @@
+import { describe, it, expect } from "vitest";
+import { listenerUrl, parseListenAddress } from "./listen-address.js";
+
+describe("parseListenAddress", () => {
+  it("should parse http, https and unix listeners with their settings", () => {
+    expect(parseListenAddress("http://127.0.0.1:8080")).toEqual({
+      scheme: "http",
+      hostname: "127.0.0.1",
+      port: 8080,
+      h2c: false,
+    });
+    expect(parseListenAddress("http://:8080?h2c")).toEqual({ scheme: "http", hostname: "", port: 8080, h2c: true });
+    expect(parseListenAddress("https://[::]:8443?cert=server.crt&key=server.key")).toEqual({
+      scheme: "https",
+      hostname: "::",
+      port: 8443,
+      cert: "server.crt",
+      key: "server.key",
+    });
+    expect(parseListenAddress("unix:/tmp/tt.sock")).toEqual({ scheme: "unix", path: "/tmp/tt.sock", h2c: false });
+    expect(parseListenAddress("unix:///tmp/tt.sock?h2c")).toEqual({ scheme: "unix", path: "/tmp/tt.sock", h2c: true });
+  });
+
+  it("should reject malformed addresses and misplaced settings", () => {
+    expect(() => parseListenAddress("localhost:8080")).toThrow("Invalid listen address");
+    expect(() => parseListenAddress("http://localhost:99999")).toThrow("Invalid port");
+    expect(() => parseListenAddress("https://localhost:8443")).toThrow("need cert and key");
+    expect(() => parseListenAddress("https://localhost:8443?cert=a&key=b&h2c")).toThrow("h2c");
+    expect(() => parseListenAddress("http://localhost:8080?cert=a")).toThrow("only apply to https");
+    expect(() => parseListenAddress("unix:")).toThrow("Missing socket path");
+    expect(() => parseListenAddress("http://localhost:8080?tls")).toThrow('Unknown listener setting "tls"');
+  });
+});
+
+describe("listenerUrl", () => {
+  it("should give clients a reachable base URL", () => {
+    expect(listenerUrl({ scheme: "http", hostname: "", port: 8080 })).toBe("http://localhost:8080");
+    expect(listenerUrl({ scheme: "https", hostname: "::1", port: 8443 })).toBe("https://[::1]:8443");
+    expect(listenerUrl({ scheme: "unix", path: "/tmp/tt.sock" })).toBe("unix:/tmp/tt.sock");
+  });
+});
@@ -0,0 +1,102 @@
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+
+export type ListenScheme = 'http' | 'https' | 'unix';
+
+// One --listen address with its own settings, e.g.
+// "https://0.0.0.0:8443?cert=server.crt&key=server.key" or
+// "unix:/tmp/teenytiny.sock?h2c"
+export interface ListenAddress {
+  scheme: ListenScheme;
+  // TCP listeners; an empty hostname listens on every interface
+  hostname?: string | undefined;
+  port?: number | undefined;
+  // Unix listeners
+  path?: string | undefined;
+  // Files with the PEM certificate and key, required for https
+  cert?: string | undefined;
+  key?: string | undefined;
+  // Speaks cleartext HTTP/2 (with prior knowledge) instead of HTTP/1.1; not
+  // for https
+  h2c?: boolean | undefined;
+}
+
+// Bind state of one listener, shown by /health/deep
+export interface ListenerStatus {
+  // The requested address until bound, when a free port's number is known
+  url: string;
+  status: 'binding' | 'listening' | 'failed' | 'closed';
+  error?: string;
+}
+
+const SETTINGS = ['cert', 'key', 'h2c'];
+
+/**
+ * Parses a --listen address: http://host:port, https://host:port?cert=<file>&key=<file>
+ * or unix:<path>, optionally with ?h2c for cleartext HTTP/2. The host may be
+ * left out to listen on every interface, e.g. http://:8080.
+ */
+export function parseListenAddress(value: string): ListenAddress {
+  const queryStart = value.includes('?') ? value.indexOf('?') : value.length;
+  const base = value.slice(0, queryStart);
+  const settings = new URLSearchParams(value.slice(queryStart + 1));
+  const unknownKey = [...settings.keys()].find((key) => !SETTINGS.includes(key));
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown listener setting "${unknownKey}" in ${value}`, 'listen');
+  }
+
+  const cert = settings.get('cert') || undefined;
+  const key = settings.get('key') || undefined;
+  const h2c = settings.has('h2c') && settings.get('h2c') !== 'false';
+
+  if (base.startsWith('unix:')) {
+    const path = base.slice('unix:'.length).replace(/^\/\/(?=\/)/, '');
+    if (path === '') {
+      throw new InvalidRequestError(`Missing socket path in ${value}`, 'listen');
+    }
+    if (cert || key) {
+      throw new InvalidRequestError(`TLS settings only apply to https listeners: ${value}`, 'listen');
+    }
+    return { scheme: 'unix', path, h2c };
+  }
+
+  const match = /^(https?):\/\/(\[[^\]]*\]|[^:/]*):(\d+)\/?$/.exec(base);
+  if (!match) {
+    throw new InvalidRequestError(
+      `Invalid listen address "${value}": expected http://host:port, https://host:port or unix:<path>`,
+      'listen'
+    );
+  }
+  const [, scheme, hostname = '', port] = match;
+  if (Number(port) > 65535) {
+    throw new InvalidRequestError(`Invalid port in ${value}`, 'listen');
+  }
+
+  if (scheme === 'https') {
+    if (!cert || !key) {
+      throw new InvalidRequestError(`https listeners need cert and key files: ${value}`, 'listen');
+    }
+    if (h2c) {
+      throw new InvalidRequestError(`h2c is cleartext HTTP/2 and can't be used with https: ${value}`, 'listen');
+    }
+    return { scheme: 'https', hostname: hostname.replace(/^\[|\]$/g, ''), port: Number(port), cert, key };
+  }
+  if (cert || key) {
+    throw new InvalidRequestError(`TLS settings only apply to https listeners: ${value}`, 'listen');
+  }
+  return { scheme: 'http', hostname: hostname.replace(/^\[|\]$/g, ''), port: Number(port), h2c };
+}
+
+// The base URL clients use for a bound listener; unix sockets are written
+// the way --listen takes them
+export function listenerUrl(address: ListenAddress): string {
+  if (address.scheme === 'unix') {
+    return `unix:${address.path ?? ''}`;
+  }
+  let hostname = address.hostname ?? '';
+  if (hostname === '' || hostname === '0.0.0.0' || hostname === '::') {
+    hostname = 'localhost';
+  } else if (hostname.includes(':')) {
+    hostname = `[${hostname}]`;
+  }
+  return `${address.scheme}://${hostname}:${address.port ?? 0}`;
+}
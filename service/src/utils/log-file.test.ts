@@ -0,0 +1,111 @@
+import { describe, it, expect, beforeEach, afterEach } from "vitest";
+import { mkdtemp, readdir, readFile, rename, rm } from "fs/promises";
+import { tmpdir } from "os";
+import { join } from "path";
+import { gunzipSync } from "zlib";
+import { LogFile } from "./log-file.js";
+
+describe("LogFile", () => {
+  let dir: string;
+  let path: string;
+
+  beforeEach(async () => {
+    dir = await mkdtemp(join(tmpdir(), "log-file-"));
+    path = join(dir, "app.log");
+  });
+
+  afterEach(async () => {
+    await rm(dir, { recursive: true, force: true });
+  });
+
+  // Every line in the directory, oldest file first
+  async function allLines(): Promise<string[]> {
+    const names = (await readdir(dir)).filter((name) => name !== "app.log").sort();
+    const lines: string[] = [];
+    for (const name of [...names, "app.log"]) {
+      const data = await readFile(join(dir, name));
+      const text = name.endsWith(".gz") ? gunzipSync(data).toString("utf8") : data.toString("utf8");
+      lines.push(...text.split("\n").filter((line) => line !== ""));
+    }
+    return lines;
+  }
+
+  it("should append lines to the file", async () => {
+    const file = new LogFile(path, { maxBytes: 0, daily: false, keep: 1 });
+
+    file.write('{"n":1}');
+    file.write('{"n":2}');
+    await file.close();
+
+    expect(await readFile(path, "utf8")).toBe('{"n":1}\n{"n":2}\n');
+  });
+
+  it("should roll over by size and keep only the newest compressed files", async () => {
+    const file = new LogFile(path, { maxBytes: 40, daily: false, keep: 3 });
+
+    for (let n = 0; n < 30; n++) {
+      file.write(JSON.stringify({ n }));
+    }
+    await file.close();
+
+    const names = await readdir(dir);
+    expect(names.filter((name) => name.endsWith(".gz"))).toHaveLength(3);
+    expect(names.filter((name) => !name.endsWith(".gz"))).toEqual(["app.log"]);
+    const numbers = (await allLines()).map((line) => JSON.parse(line).n);
+    // The oldest files were pruned, but what's left is contiguous and ends at the last line
+    expect(numbers[numbers.length - 1]).toBe(29);
+    expect(numbers).toEqual(numbers.map((_, i) => numbers[0] + i));
+  });
+
+  it("should never split or lose lines from concurrent writers across rotations", async () => {
+    const file = new LogFile(path, { maxBytes: 256, daily: false, keep: 1000 });
+
+    await Promise.all(
+      Array.from({ length: 20 }, async (_, writer) => {
+        for (let n = 0; n < 25; n++) {
+          file.write(JSON.stringify({ writer, n, padding: "x".repeat(writer) }));
+          await new Promise((resolve) => setImmediate(resolve));
+        }
+      }),
+    );
+    await file.close();
+
+    const entries = (await allLines()).map((line) => JSON.parse(line));
+    expect((await readdir(dir)).length).toBeGreaterThan(10);
+    expect(entries).toHaveLength(500);
+    for (let writer = 0; writer < 20; writer++) {
+      expect(entries.filter((entry) => entry.writer === writer).map((entry) => entry.n)).toEqual(
+        Array.from({ length: 25 }, (_, n) => n),
+      );
+    }
+  });
+
+  it("should roll over on the first write after midnight", async () => {
+    const clock = { now: new Date(2026, 9, 15, 23, 59, 59) };
+    const file = new LogFile(path, { maxBytes: 0, daily: true, keep: 5 }, () => clock.now);
+
+    file.write("before midnight");
+    clock.now = new Date(2026, 9, 16, 0, 0, 1);
+    file.write("after midnight");
+    file.write("later that day");
+    await file.close();
+
+    const rotated = (await readdir(dir)).filter((name) => name.endsWith(".gz"));
+    expect(rotated).toHaveLength(1);
+    expect(gunzipSync(await readFile(join(dir, rotated[0]!))).toString()).toBe("before midnight\n");
+    expect(await readFile(path, "utf8")).toBe("after midnight\nlater that day\n");
+  });
+
+  it("should start a fresh file on reopen after an external rotator moves it", async () => {
+    const file = new LogFile(path, { maxBytes: 0, daily: false, keep: 1 });
+
+    file.write("old");
+    await rename(path, `${path}.1`);
+    file.reopen();
+    file.write("new");
+    await file.close();
+
+    expect(await readFile(`${path}.1`, "utf8")).toBe("old\n");
+    expect(await readFile(path, "utf8")).toBe("new\n");
+  });
+});
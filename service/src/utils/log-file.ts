@@ -0,0 +1,133 @@
+import { closeSync, createReadStream, createWriteStream, openSync, fstatSync, readdirSync, renameSync, rmSync, writeSync } from 'fs';
+import { basename, dirname, join } from 'path';
+import { pipeline } from 'stream/promises';
+import { createGzip } from 'zlib';
+import type { LogOutput } from './logger.js';
+
+export interface LogFileConfig {
+  // Roll over before a write would take the file past this size (0: never)
+  maxBytes: number;
+  // Also roll over on the first write after local midnight
+  daily: boolean;
+  // Compressed old files kept; older ones are deleted
+  keep: number;
+}
+
+export const DEFAULT_LOG_FILE_CONFIG: LogFileConfig = {
+  maxBytes: 100 * 1024 * 1024,
+  daily: true,
+  keep: 7,
+};
+
+/**
+ * Log output that appends to a file and rotates it.
+ *
+ * Each line goes out in a single synchronous write, so lines from concurrent
+ * requests are never split or interleaved, and rotation happens between
+ * lines. A rotated file is renamed to path.<timestamp> and gzipped in the
+ * background; `settled()` waits for that. `reopen()` starts a fresh file at
+ * the same path, for external rotators such as logrotate that have just
+ * moved the old one away (wired to SIGUSR1 by the server).
+ */
+export class LogFile implements LogOutput {
+  private fd: number;
+  private size: number;
+  private day: string;
+  private compressing = new Set<Promise<void>>();
+  private lastStamp = '';
+  private sameStamp = 0;
+
+  constructor(
+    private path: string,
+    private config: LogFileConfig = DEFAULT_LOG_FILE_CONFIG,
+    private now: () => Date = () => new Date(),
+  ) {
+    this.fd = openSync(path, 'a');
+    this.size = fstatSync(this.fd).size;
+    this.day = this.now().toDateString();
+  }
+
+  write(line: string): void {
+    const data = Buffer.from(`${line}\n`);
+    if (this.size > 0 && this.shouldRotate(data.length)) {
+      this.rotate();
+    }
+    writeSync(this.fd, data);
+    this.size += data.length;
+  }
+
+  reopen(): void {
+    closeSync(this.fd);
+    this.fd = openSync(this.path, 'a');
+    this.size = fstatSync(this.fd).size;
+    this.day = this.now().toDateString();
+  }
+
+  // Resolves once every rotated file has been compressed and pruned
+  async settled(): Promise<void> {
+    while (this.compressing.size > 0) {
+      await Promise.all(this.compressing);
+    }
+  }
+
+  close(): Promise<void> {
+    closeSync(this.fd);
+    return this.settled();
+  }
+
+  private shouldRotate(bytes: number): boolean {
+    if (this.config.maxBytes > 0 && this.size + bytes > this.config.maxBytes) {
+      return true;
+    }
+    return this.config.daily && this.now().toDateString() !== this.day;
+  }
+
+  private rotate(): void {
+    const rotated = `${this.path}.${this.suffix()}`;
+    closeSync(this.fd);
+    renameSync(this.path, rotated);
+    this.fd = openSync(this.path, 'a');
+    this.size = 0;
+    this.day = this.now().toDateString();
+
+    const done = (async () => {
+      try {
+        await this.compress(rotated);
+        this.prune();
+      } catch (error) {
+        // Logging about the log would go nowhere useful; stderr it is
+        console.error(`Log rotation of ${rotated} failed: ${error instanceof Error ? error.message : String(error)}`);
+      }
+    })();
+    this.compressing.add(done);
+    void done.then(() => this.compressing.delete(done));
+  }
+
+  // A timestamp that sorts chronologically and is unique to this file
+  private suffix(): string {
+    const stamp = this.now().toISOString().replace(/:/g, '-');
+    if (stamp === this.lastStamp) {
+      this.sameStamp++;
+    } else {
+      this.lastStamp = stamp;
+      this.sameStamp = 0;
+    }
+    // '~' sorts after the '.' of '.gz', so same-stamp files stay in order
+    return this.sameStamp === 0 ? stamp : `${stamp}~${String(this.sameStamp).padStart(4, '0')}`;
+  }
+
+  private async compress(file: string): Promise<void> {
+    await pipeline(createReadStream(file), createGzip(), createWriteStream(`${file}.gz`));
+    rmSync(file);
+  }
+
+  private prune(): void {
+    const prefix = `${basename(this.path)}.`;
+    const compressed = readdirSync(dirname(this.path))
+      .filter((name) => name.startsWith(prefix) && name.endsWith('.gz'))
+      .sort();
+    for (const name of compressed.slice(0, Math.max(compressed.length - this.config.keep, 0))) {
+      rmSync(join(dirname(this.path), name), { force: true });
+    }
+  }
+}
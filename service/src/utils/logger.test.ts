@@ -0,0 +1,58 @@
+import { describe, it, expect, vi } from "vitest";
+import { Logger } from "./logger.js";
+
+describe("Logger", () => {
+  it("should write JSON lines to the console", () => {
+    const spy = vi.spyOn(console, "log").mockImplementation(() => {});
+    const logger = new Logger();
+
+    logger.info("Hello", { request_id: "abc" });
+
+    expect(spy).toHaveBeenCalledWith(
+      '{"level":"info","message":"Hello","request_id":"abc"}',
+    );
+    spy.mockRestore();
+  });
+
+  it("should write to the given output instead of the console", () => {
+    const spy = vi.spyOn(console, "log").mockImplementation(() => {});
+    const lines: string[] = [];
+    const logger = new Logger(10, { write: (line) => lines.push(line) });
+
+    logger.info("Hello");
+
+    expect(lines).toEqual(['{"level":"info","message":"Hello"}']);
+    expect(spy).not.toHaveBeenCalled();
+    spy.mockRestore();
+  });
+
+  it("should keep only the most recent entries", () => {
+    const spy = vi.spyOn(console, "log").mockImplementation(() => {});
+    const logger = new Logger(3);
+
+    for (let i = 1; i <= 5; i++) {
+      logger.info(`entry ${i}`);
+    }
+
+    expect(logger.recent().map((e) => e.message)).toEqual([
+      "entry 3",
+      "entry 4",
+      "entry 5",
+    ]);
+    spy.mockRestore();
+  });
+
+  it("should notify subscribers until they unsubscribe", () => {
+    const spy = vi.spyOn(console, "log").mockImplementation(() => {});
+    const logger = new Logger();
+    const received: string[] = [];
+
+    const unsubscribe = logger.subscribe((entry) => received.push(entry.message));
+    logger.info("first");
+    unsubscribe();
+    logger.info("second");
+
+    expect(received).toEqual(["first"]);
+    spy.mockRestore();
+  });
+});
@@ -0,0 +1,83 @@
+export type LogLevel = 'info' | 'warn' | 'error';
+
+export interface LogEntry {
+  level: LogLevel;
+  message: string;
+  [field: string]: unknown;
+}
+
+export type LogSubscriber = (entry: LogEntry) => void;
+
+// Destination for log lines other than the console, e.g. a LogFile
+export interface LogOutput {
+  write(line: string): void;
+}
+
+/**
+ * Structured JSON logger
+ *
+ * Writes one JSON object per line to the console (or the given output), and
+ * keeps the most recent entries in a ring buffer so they can be replayed to
+ * live subscribers (e.g. the admin log stream) that connect after the fact.
+ */
+export class Logger {
+  private buffer: LogEntry[] = [];
+  private next = 0;
+  private subscribers = new Set<LogSubscriber>();
+
+  constructor(
+    private capacity: number = 500,
+    private output?: LogOutput,
+  ) {}
+
+  info(message: string, fields: Record<string, unknown> = {}): void {
+    this.log({ level: 'info', message, ...fields });
+  }
+
+  warn(message: string, fields: Record<string, unknown> = {}): void {
+    this.log({ level: 'warn', message, ...fields });
+  }
+
+  error(message: string, fields: Record<string, unknown> = {}): void {
+    this.log({ level: 'error', message, ...fields });
+  }
+
+  log(entry: LogEntry): void {
+    const line = JSON.stringify(entry);
+    if (this.output) {
+      this.output.write(line);
+    } else if (entry.level === 'error') {
+      console.error(line);
+    } else {
+      console.log(line);
+    }
+
+    if (this.capacity > 0) {
+      if (this.buffer.length < this.capacity) {
+        this.buffer.push(entry);
+      } else {
+        this.buffer[this.next] = entry;
+      }
+      this.next = (this.next + 1) % this.capacity;
+    }
+
+    for (const subscriber of this.subscribers) {
+      subscriber(entry);
+    }
+  }
+
+  // Buffered entries, oldest first
+  recent(): LogEntry[] {
+    if (this.buffer.length < this.capacity) {
+      return [...this.buffer];
+    }
+    return [...this.buffer.slice(this.next), ...this.buffer.slice(0, this.next)];
+  }
+
+  subscribe(subscriber: LogSubscriber): () => void {
+    this.subscribers.add(subscriber);
+    return () => {
+      this.subscribers.delete(subscriber);
+    };
+  }
+}
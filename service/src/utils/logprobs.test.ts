@@ -0,0 +1,41 @@
+import { describe, it, expect } from "vitest";
+import { tokenize, tokenLogprobs } from "./logprobs.js";
+import { MAX_TOP_LOGPROBS } from "../openai-protocol/types.js";
+
+describe("tokenize", () => {
+  it("should split text into tokens that join back into it", () => {
+    const text = "Hello,  wonderful\nworld!";
+
+    expect(tokenize(text)).toEqual(["Hell", "o,", " ", " wond", "erfu", "l", "\n", "worl", "d!"]);
+    expect(tokenize(text).join("")).toBe(text);
+  });
+
+  it("should keep characters outside the BMP whole", () => {
+    expect(tokenize("🙂🙂🙂🙂🙂").join("|")).toBe("🙂🙂🙂🙂|🙂");
+  });
+});
+
+describe("tokenLogprobs", () => {
+  it("should give each token exactly the asked-for distinct alternatives, most likely first", () => {
+    for (let k = 0; k <= MAX_TOP_LOGPROBS; k++) {
+      for (const token of tokenLogprobs("The quick brown fox, and the lazy dog.", k)) {
+        expect(token.top_logprobs).toHaveLength(k);
+        expect(new Set(token.top_logprobs.map((top) => top.token)).size).toBe(k);
+        const logprobs = token.top_logprobs.map((top) => top.logprob);
+        expect(logprobs).toEqual([...logprobs].sort((a, b) => b - a));
+        if (k > 0) {
+          expect(token.top_logprobs[0]).toEqual({ token: token.token, logprob: token.logprob, bytes: token.bytes });
+        }
+      }
+    }
+  });
+
+  it("should be stable, with each token's UTF-8 bytes", () => {
+    const [first] = tokenLogprobs(" café", 2);
+
+    expect(tokenLogprobs(" café", 2)[0]).toEqual(first);
+    expect(first!.bytes).toEqual([32, 99, 97, 102, 195, 169]);
+    expect(first!.logprob).toBeLessThanOrEqual(0);
+    expect(first!.logprob).toBeGreaterThan(-2);
+  });
+});
@@ -0,0 +1,54 @@
+import type { ChatCompletionTokenLogprob, ChatCompletionTopLogprob } from '../openai-protocol/types.js';
+import { fnv1a } from './fnv.js';
+
+// Common tokens offered as the alternatives to each token, so there are
+// always more than MAX_TOP_LOGPROBS distinct ones to choose from
+const ALTERNATIVES = [
+  ' the', ' a', ' and', ' to', ' of', ' is', ' in', ' it', ' that', ' for', ' you', ' with',
+  ' on', ' as', ' I', ' was', ' be', ' are', ' this', ' not', ',', '.', '\n', ' an',
+];
+
+// Tokens as models see them: up to 4 characters of a word, the estimate's
+// ratio, with the space before it, or a whitespace character of its own
+const TOKEN = / ?\S{1,4}|\s/gu;
+
+export function tokenize(text: string): string[] {
+  return text.match(TOKEN) ?? [];
+}
+
+/**
+ * Made-up but stable logprobs for each token of a piece of output: the same
+ * token always gets the same logprob, and its topLogprobs alternatives are
+ * the token itself followed by distinct common tokens, each less likely than
+ * the one before.
+ */
+export function tokenLogprobs(text: string, topLogprobs: number): ChatCompletionTokenLogprob[] {
+  return tokenize(text).map((token) => {
+    const chosen = logprobOf(token);
+    const hash = fnv1a(token);
+    const alternatives = ALTERNATIVES.filter((alternative) => alternative !== token);
+    const top = Array.from({ length: topLogprobs }, (_, rank): ChatCompletionTopLogprob => {
+      if (rank === 0) {
+        return chosen;
+      }
+      const alternative = alternatives[(hash + rank) % alternatives.length]!;
+      return {
+        ...logprobOf(alternative),
+        logprob: round(chosen.logprob - rank - ((hash >>> rank) % 100) / 100),
+      };
+    });
+    return { ...chosen, top_logprobs: top };
+  });
+}
+
+function logprobOf(token: string): ChatCompletionTopLogprob {
+  return {
+    token,
+    logprob: round(-(fnv1a(token) % 2000) / 1000),
+    bytes: Array.from(new TextEncoder().encode(token)),
+  };
+}
+
+function round(logprob: number): number {
+  return Math.round(logprob * 1e6) / 1e6;
+}
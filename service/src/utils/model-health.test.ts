@@ -0,0 +1,98 @@
+import { describe, it, expect } from "vitest";
+import { ModelHealthMonitor } from "./model-health.js";
+import { ModelRegistry } from "../models/model-registry.js";
+import { EchoModel } from "../models/echo-model.js";
+import { Logger } from "./logger.js";
+import type { Model } from "../models/model.js";
+
+// A model whose dependency can be switched between up and down
+class FlakyModel implements Model {
+  healthy = true;
+
+  async *process(input: string): AsyncGenerator<string> {
+    yield input;
+  }
+
+  async checkHealth(): Promise<void> {
+    if (!this.healthy) {
+      throw new Error("upstream unreachable");
+    }
+  }
+}
+
+function setup(disableUnhealthy = false) {
+  const registry = new ModelRegistry();
+  const flaky = new FlakyModel();
+  registry.register("echo", new EchoModel());
+  registry.register("flaky", flaky);
+  const lines: string[] = [];
+  const logger = new Logger(undefined, { write: (line: string) => lines.push(line) });
+  const monitor = new ModelHealthMonitor(registry, { intervalMs: 60_000, disableUnhealthy }, logger, () => new Date(0));
+  return { registry, flaky, monitor, lines };
+}
+
+describe("ModelHealthMonitor", () => {
+  it("should only record models that have a health check", async () => {
+    const { monitor } = setup();
+
+    await monitor.checkAll();
+
+    expect(monitor.report()).toEqual({
+      flaky: { status: "ok", checked_at: "1970-01-01T00:00:00.000Z", consecutive_failures: 0 },
+    });
+    expect(monitor.status("echo")).toBeUndefined();
+  });
+
+  it("should mark a failing model degraded until it recovers", async () => {
+    const { flaky, monitor, lines } = setup();
+
+    flaky.healthy = false;
+    await monitor.checkAll();
+    await monitor.checkAll();
+    expect(monitor.status("flaky")).toMatchObject({
+      status: "degraded",
+      consecutive_failures: 2,
+      error: "upstream unreachable",
+    });
+    expect(monitor.isAvailable("flaky")).toBe(true);
+
+    flaky.healthy = true;
+    await monitor.checkAll();
+    expect(monitor.status("flaky")).toEqual({
+      status: "ok",
+      checked_at: "1970-01-01T00:00:00.000Z",
+      consecutive_failures: 0,
+    });
+
+    // Logged once per transition, not per failed check
+    expect(lines.filter((line) => line.includes("Model health check failed"))).toHaveLength(1);
+    expect(lines.filter((line) => line.includes("Model recovered"))).toHaveLength(1);
+  });
+
+  it("should make failing models unavailable when configured to", async () => {
+    const { flaky, monitor } = setup(true);
+
+    flaky.healthy = false;
+    await monitor.checkAll();
+    expect(monitor.isAvailable("flaky")).toBe(false);
+    expect(monitor.isAvailable("echo")).toBe(true);
+
+    flaky.healthy = true;
+    await monitor.checkAll();
+    expect(monitor.isAvailable("flaky")).toBe(true);
+  });
+
+  it("should fail checks that take too long", async () => {
+    const registry = new ModelRegistry();
+    const hanging: Model = {
+      async *process() {},
+      checkHealth: () => new Promise(() => {}),
+    };
+    registry.register("hanging", hanging);
+    const monitor = new ModelHealthMonitor(registry, { intervalMs: 60_000, timeoutMs: 20 }, new Logger(undefined, { write: () => {} }));
+
+    await monitor.checkAll();
+
+    expect(monitor.status("hanging")).toMatchObject({ status: "degraded", error: "No result within 20ms" });
+  });
+});
@@ -0,0 +1,119 @@
+import type { ModelRegistry } from '../models/model-registry.js';
+import { Logger } from './logger.js';
+
+export interface ModelHealthConfig {
+  // How often models with external dependencies are checked
+  intervalMs: number;
+  // How long one check may take before it counts as failed
+  timeoutMs?: number | undefined;
+  // Refuse requests to a failing model with a 503 until it recovers
+  disableUnhealthy?: boolean | undefined;
+}
+
+export const DEFAULT_MODEL_HEALTH_INTERVAL_MS = 30_000;
+
+export interface ModelHealth {
+  status: 'ok' | 'degraded';
+  checked_at: string;
+  // Checks failed in a row, 0 once one passes
+  consecutive_failures: number;
+  error?: string;
+}
+
+/**
+ * Periodically runs checkHealth() on the registered models that implement
+ * it, so a missing command or unreachable dependency is found before a user
+ * request hits it. Models without the method are never checked and have no
+ * health recorded.
+ */
+export class ModelHealthMonitor {
+  private health = new Map<string, ModelHealth>();
+  private timer: ReturnType<typeof setInterval> | undefined;
+  private running: Promise<void> | undefined;
+
+  constructor(
+    private registry: ModelRegistry,
+    private config: ModelHealthConfig,
+    private logger: Logger = new Logger(),
+    private now: () => Date = () => new Date()
+  ) {}
+
+  // Checks right away, then every interval; does nothing when no model has
+  // a check, so apps without such models never start a timer
+  start(): void {
+    if (this.timer || !this.registry.getIds().some((id) => this.registry.get(id)?.checkHealth)) {
+      return;
+    }
+    void this.checkAll();
+    this.timer = setInterval(() => void this.checkAll(), this.config.intervalMs);
+    // Don't keep the process alive just for health checks
+    this.timer.unref?.();
+  }
+
+  stop(): void {
+    clearInterval(this.timer);
+    this.timer = undefined;
+  }
+
+  // Runs every check once; a round still in progress is waited on instead of
+  // starting another
+  checkAll(): Promise<void> {
+    this.running ??= Promise.all(this.registry.getIds().map((id) => this.check(id))).then(() => {
+      this.running = undefined;
+    });
+    return this.running;
+  }
+
+  status(id: string): ModelHealth | undefined {
+    return this.health.get(id);
+  }
+
+  // False for a failing model when failing models are disabled
+  isAvailable(id: string): boolean {
+    return !(this.config.disableUnhealthy && this.health.get(id)?.status === 'degraded');
+  }
+
+  // Every checked model's latest result, by model id
+  report(): Record<string, ModelHealth> {
+    return Object.fromEntries(this.health);
+  }
+
+  private async check(id: string): Promise<void> {
+    const model = this.registry.get(id);
+    if (!model?.checkHealth) {
+      this.health.delete(id);
+      return;
+    }
+
+    const timeoutMs = this.config.timeoutMs ?? 5000;
+    const signal = AbortSignal.timeout(timeoutMs);
+    let error: string | undefined;
+    try {
+      await Promise.race([
+        model.checkHealth(signal),
+        new Promise<never>((_, reject) =>
+          signal.addEventListener('abort', () => reject(new Error(`No result within ${timeoutMs}ms`)), { once: true })
+        ),
+      ]);
+    } catch (cause) {
+      error = cause instanceof Error ? cause.message : String(cause);
+    }
+
+    const previous = this.health.get(id);
+    const health: ModelHealth = {
+      status: error === undefined ? 'ok' : 'degraded',
+      checked_at: this.now().toISOString(),
+      consecutive_failures: error === undefined ? 0 : (previous?.consecutive_failures ?? 0) + 1,
+    };
+    if (error !== undefined) {
+      health.error = error;
+    }
+    this.health.set(id, health);
+
+    if (error !== undefined && previous?.status !== 'degraded') {
+      this.logger.warn('Model health check failed', { model: id, error });
+    } else if (error === undefined && previous?.status === 'degraded') {
+      this.logger.info('Model recovered', { model: id });
+    }
+  }
+}
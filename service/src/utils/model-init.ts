@@ -0,0 +1,18 @@
+import type { ModelRegistry } from '../models/model-registry.js';
+
+/**
+ * Runs init() on every registered model that implements it, all at once.
+ * Resolves when they've all finished; rejects naming the first model whose
+ * init failed.
+ */
+export async function initModels(registry: ModelRegistry): Promise<void> {
+  await Promise.all(
+    registry.getIds().map(async (id) => {
+      try {
+        await registry.get(id)?.init?.();
+      } catch (error) {
+        throw new Error(`Model ${id} failed to initialize: ${error instanceof Error ? error.message : String(error)}`);
+      }
+    })
+  );
+}
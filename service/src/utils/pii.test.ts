@@ -0,0 +1,71 @@
+import { describe, it, expect } from "vitest";
+import { findPII, redactPII } from "./pii.js";
+
+describe("findPII", () => {
+  it.each([
+    ["jane.doe+news@mail.example.co.uk", "EMAIL"],
+    ["(555) 123-4567", "PHONE"],
+    ["+44 20 7946 0958", "PHONE"],
+    ["555.123.4567", "PHONE"],
+    ["4111 1111 1111 1111", "CREDIT_CARD"],
+    ["4111-1111-1111-1111", "CREDIT_CARD"],
+    ["378282246310005", "CREDIT_CARD"],
+    ["192.168.100.200", "IPV4"],
+  ])("should find %s as %s", (text, type) => {
+    expect(findPII(`<${text}>`)).toEqual([{ type, start: 1, end: 1 + text.length }]);
+  });
+
+  it.each([
+    "2024-01-15",
+    "version 1.2.3",
+    "256.1.1.1",
+    "10.0.0.1.5",
+    "123 456",
+    "user@localhost",
+  ])("should leave %s alone", (text) => {
+    expect(findPII(text)).toEqual([]);
+  });
+
+  it("should keep the longest of overlapping matches", () => {
+    // The phone number is part of the email address
+    expect(findPII("555-123-4567@example.com")).toEqual([{ type: "EMAIL", start: 0, end: 24 }]);
+    // "192.168.100" on its own reads as a dotted phone number
+    expect(findPII("192.168.100.200")).toEqual([{ type: "IPV4", start: 0, end: 15 }]);
+    // A card number contains many phone-shaped runs
+    expect(findPII("4111 1111 1111 1111")).toEqual([{ type: "CREDIT_CARD", start: 0, end: 19 }]);
+  });
+
+  it("should keep separate matches that only touch", () => {
+    expect(findPII("a@b.io,10.0.0.1")).toEqual([
+      { type: "EMAIL", start: 0, end: 6 },
+      { type: "IPV4", start: 7, end: 15 },
+    ]);
+  });
+
+  it("should count offsets in code points around non-ASCII text", () => {
+    const text = "😀 naïve a@b.io 日本語 10.1.2.3 🎉";
+
+    expect(findPII(text)).toEqual([
+      { type: "EMAIL", start: 8, end: 14 },
+      { type: "IPV4", start: 19, end: 27 },
+    ]);
+    expect(Array.from(text).slice(8, 14).join("")).toBe("a@b.io");
+    expect(Array.from(text).slice(19, 27).join("")).toBe("10.1.2.3");
+  });
+});
+
+describe("redactPII", () => {
+  it("should replace matches with typed placeholders, keeping the text around them", () => {
+    expect(redactPII("Ünïcödé 😀 a@b.io 😀 then 555.123.4567 ✓")).toEqual({
+      text: "Ünïcödé 😀 [EMAIL] 😀 then [PHONE] ✓",
+      spans: [
+        { type: "EMAIL", start: 10, end: 16 },
+        { type: "PHONE", start: 24, end: 36 },
+      ],
+    });
+  });
+
+  it("should leave text without matches unchanged", () => {
+    expect(redactPII("héllo")).toEqual({ text: "héllo", spans: [] });
+  });
+});
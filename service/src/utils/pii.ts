@@ -0,0 +1,77 @@
+// Kinds of personal data the redactor masks, each replaced by `[<type>]`
+export type PIIType = 'EMAIL' | 'PHONE' | 'CREDIT_CARD' | 'IPV4';
+
+// Where a match was found; offsets count code points of the original text,
+// with the end exclusive
+export interface PIISpan {
+  type: PIIType;
+  start: number;
+  end: number;
+}
+
+export interface Redaction {
+  text: string;
+  spans: PIISpan[];
+}
+
+const OCTET = '(?:25[0-5]|2[0-4]\\d|1\\d\\d|[1-9]?\\d)';
+
+// In order of precedence when two matches cover the same text, e.g. an IP
+// address that also reads as a dotted phone number
+const PATTERNS: Array<[PIIType, RegExp]> = [
+  ['EMAIL', /[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}/g],
+  // 13 to 19 digits, optionally grouped with single spaces or dashes
+  ['CREDIT_CARD', /(?<!\d)\d(?:[ -]?\d){12,18}(?!\d)/g],
+  ['IPV4', new RegExp(`(?<![\\d.])(?:${OCTET}\\.){3}${OCTET}(?!\\.?\\d)`, 'g')],
+  // An optional country code, then an area code in parentheses or followed
+  // by a separator, then two groups of 3 or 4 digits
+  ['PHONE', /(?<![\w+])(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)[ .-]?|\d{2,4}[ .-])\d{3,4}[ .-]?\d{3,4}(?!\d)/g],
+];
+
+/**
+ * Finds email addresses, phone numbers, credit-card-like digit runs and IPv4
+ * addresses. Where matches overlap the longest wins, then the earlier type
+ * in PATTERNS, so each character belongs to at most one span. Spans are
+ * returned in text order.
+ */
+export function findPII(text: string): PIISpan[] {
+  const candidates = PATTERNS.flatMap(([type, pattern], precedence) =>
+    Array.from(text.matchAll(pattern), (match) => ({
+      type,
+      precedence,
+      start: match.index ?? 0,
+      end: (match.index ?? 0) + match[0].length,
+    }))
+  );
+  candidates.sort((a, b) => b.end - b.start - (a.end - a.start) || a.precedence - b.precedence || a.start - b.start);
+
+  const kept: typeof candidates = [];
+  for (const candidate of candidates) {
+    if (kept.every((other) => candidate.end <= other.start || candidate.start >= other.end)) {
+      kept.push(candidate);
+    }
+  }
+  kept.sort((a, b) => a.start - b.start);
+
+  // Offsets so far are UTF-16 code units; callers count code points
+  const codePoints = (index: number) => codePointLength(text.slice(0, index));
+  return kept.map(({ type, start, end }) => ({ type, start: codePoints(start), end: codePoints(end) }));
+}
+
+// Replaces every match with its `[<type>]` placeholder
+export function redactPII(text: string): Redaction {
+  const spans = findPII(text);
+  const characters = [...text];
+  let redacted = '';
+  let position = 0;
+  for (const span of spans) {
+    redacted += characters.slice(position, span.start).join('') + `[${span.type}]`;
+    position = span.end;
+  }
+  redacted += characters.slice(position).join('');
+  return { text: redacted, spans };
+}
+
+function codePointLength(text: string): number {
+  return Array.from(text).length;
+}
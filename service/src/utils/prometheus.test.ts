@@ -0,0 +1,51 @@
+import { describe, it, expect } from "vitest";
+import { counter, formatMetrics, gauge, histogram } from "./prometheus.js";
+
+describe("Prometheus text format", () => {
+  it("should write histogram buckets, sum and count for each series", () => {
+    const text = formatMetrics([
+      histogram("size", "Request size", [
+        {
+          labels: { model: "echo" },
+          snapshot: { buckets: { "1": 1, "10": 2, "+Inf": 3 }, count: 3, sum: 25 },
+        },
+      ]),
+    ]);
+
+    expect(text).toBe(
+      [
+        "# HELP size Request size",
+        "# TYPE size histogram",
+        'size_bucket{model="echo",le="1"} 1',
+        'size_bucket{model="echo",le="10"} 2',
+        'size_bucket{model="echo",le="+Inf"} 3',
+        'size_sum{model="echo"} 25',
+        'size_count{model="echo"} 3',
+        "",
+      ].join("\n"),
+    );
+  });
+
+  it("should write gauges and counters with and without labels", () => {
+    const text = formatMetrics([
+      gauge("up", "Whether it's up", [{ value: 1 }]),
+      counter("shed_total", "Requests shed", [{ labels: { priority: "low" }, value: 4 }]),
+    ]);
+
+    expect(text.split("\n")).toEqual([
+      "# HELP up Whether it's up",
+      "# TYPE up gauge",
+      "up 1",
+      "# HELP shed_total Requests shed",
+      "# TYPE shed_total counter",
+      'shed_total{priority="low"} 4',
+      "",
+    ]);
+  });
+
+  it("should escape backslashes, quotes and newlines in label values", () => {
+    const [, , line] = gauge("g", "G", [{ labels: { model: 'a\\b"c\nd' }, value: 0 }]);
+
+    expect(line).toBe('g{model="a\\\\b\\"c\\nd"} 0');
+  });
+});
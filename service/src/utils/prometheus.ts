@@ -0,0 +1,61 @@
+import type { HistogramSnapshot } from './request-sizes.js';
+
+export const PROMETHEUS_CONTENT_TYPE = 'text/plain; version=0.0.4; charset=utf-8';
+
+export type Labels = Record<string, string>;
+
+export interface Sample {
+  labels?: Labels | undefined;
+  value: number;
+}
+
+export interface HistogramSeries {
+  labels: Labels;
+  snapshot: HistogramSnapshot;
+}
+
+/**
+ * Metric families in Prometheus' text exposition format, for GET /metrics:
+ * each is its HELP and TYPE lines, then a line per sample, and families are
+ * joined into the whole page with formatMetrics.
+ */
+export function gauge(name: string, help: string, samples: Sample[]): string[] {
+  return family(name, help, 'gauge', samples.map((sample) => line(name, sample.labels, sample.value)));
+}
+
+export function counter(name: string, help: string, samples: Sample[]): string[] {
+  return family(name, help, 'counter', samples.map((sample) => line(name, sample.labels, sample.value)));
+}
+
+// Buckets are already cumulative in the snapshot, as Prometheus expects
+export function histogram(name: string, help: string, series: HistogramSeries[]): string[] {
+  return family(
+    name,
+    help,
+    'histogram',
+    series.flatMap(({ labels, snapshot }) => [
+      ...Object.entries(snapshot.buckets).map(([le, count]) => line(`${name}_bucket`, { ...labels, le }, count)),
+      line(`${name}_sum`, labels, snapshot.sum),
+      line(`${name}_count`, labels, snapshot.count),
+    ])
+  );
+}
+
+export function formatMetrics(families: string[][]): string {
+  return families.flat().join('\n') + '\n';
+}
+
+function family(name: string, help: string, type: string, lines: string[]): string[] {
+  return [`# HELP ${name} ${help}`, `# TYPE ${name} ${type}`, ...lines];
+}
+
+function line(name: string, labels: Labels | undefined, value: number): string {
+  const pairs = Object.entries(labels ?? {}).map(([label, text]) => `${label}="${escapeLabel(text)}"`);
+  return `${name}${pairs.length > 0 ? `{${pairs.join(',')}}` : ''} ${value}`;
+}
+
+// Backslashes, double quotes and newlines are the only escapes label values
+// need
+function escapeLabel(text: string): string {
+  return text.replace(/\\/g, '\\\\').replace(/"/g, '\\"').replace(/\n/g, '\\n');
+}
@@ -0,0 +1,16 @@
+import { describe, it, expect } from "vitest";
+import { seededRandom } from "./random.js";
+
+describe("seededRandom", () => {
+  it("should repeat its sequence for a seed and stay in [0, 1)", () => {
+    const a = seededRandom(123);
+    const b = seededRandom(123);
+
+    for (let i = 0; i < 100; i++) {
+      const value = a();
+      expect(b()).toBe(value);
+      expect(value).toBeGreaterThanOrEqual(0);
+      expect(value).toBeLessThan(1);
+    }
+  });
+});
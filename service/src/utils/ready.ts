@@ -0,0 +1,36 @@
+import { execFile } from 'child_process';
+import { rename, writeFile } from 'fs/promises';
+
+// What's known once the server can take requests, printed on startup and
+// written to --ready-file
+export interface ReadyInfo {
+  addresses: string[];
+  models: string[];
+  auth: { mode: 'api_key'; api_key: string; constant_time: boolean };
+  pid: number;
+}
+
+// Written under a temporary name and renamed into place, so anything waiting
+// for the file never reads it half written
+export async function writeReadyFile(file: string, info: ReadyInfo): Promise<void> {
+  const temporary = `${file}.${process.pid}.tmp`;
+  await writeFile(temporary, JSON.stringify(info) + '\n');
+  await rename(temporary, file);
+}
+
+/**
+ * Tells systemd the service is ready (sd_notify READY=1) when it started us
+ * with Type=notify. Node.js can't send to the unix datagram socket itself, so
+ * this runs systemd-notify, which needs NotifyAccess=all in the unit.
+ * Resolves false when not under systemd.
+ */
+export function notifySystemd(env: NodeJS.ProcessEnv = process.env): Promise<boolean> {
+  if (!env.NOTIFY_SOCKET) {
+    return Promise.resolve(false);
+  }
+  return new Promise((resolve, reject) => {
+    execFile('systemd-notify', ['--ready', `--pid=${process.pid}`], { env }, (error) =>
+      error ? reject(error) : resolve(true)
+    );
+  });
+}
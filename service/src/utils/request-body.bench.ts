@@ -0,0 +1,40 @@
+import { bench, describe } from "vitest";
+import { readJsonBody } from "./request-body.js";
+import {
+  canCollectGarbage,
+  collectGarbage,
+  largeConversationBody,
+  memoryInUse,
+} from "../../tests/test-helpers.js";
+
+// Run with: npm run bench
+const body = largeConversationBody(5 * 1024 * 1024);
+const request = () => new Request("http://localhost/", { method: "POST", body });
+
+const readers: [string, () => Promise<unknown>][] = [
+  ["Request.json", () => request().json()],
+  ["readJsonBody", () => readJsonBody(request())],
+];
+
+// Memory taken by reading and parsing a body, before any of it is collected:
+// what each concurrent large request costs at its peak
+async function bytesAllocated(read: () => Promise<unknown>): Promise<number> {
+  collectGarbage();
+  const before = memoryInUse();
+  await read();
+  return memoryInUse() - before;
+}
+
+const megabytes = (bytes: number) => `${(bytes / 1024 / 1024).toFixed(1)}MB`;
+
+// Each bench is named with what it allocates, so the figures show in the
+// bench results alongside the timings
+describe(`${megabytes(body.length)} request body`, async () => {
+  for (const [name, read] of readers) {
+    const label = canCollectGarbage ? `${name}, ${megabytes(await bytesAllocated(read))} allocated` : name;
+
+    bench(label, async () => {
+      await read();
+    });
+  }
+});
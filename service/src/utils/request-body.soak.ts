@@ -0,0 +1,30 @@
+import { describe, it, expect } from "vitest";
+import { readJsonBody } from "./request-body.js";
+import {
+  canCollectGarbage,
+  collectGarbage,
+  largeConversationBody,
+  memoryInUse,
+} from "../../tests/test-helpers.js";
+
+// Run with: npm run soak
+describe("readJsonBody under load", () => {
+  it.skipIf(!canCollectGarbage)("should hold the heap steady over repeated 5MB requests", async () => {
+    const body = largeConversationBody(5 * 1024 * 1024);
+    const read = () => readJsonBody(new Request("http://localhost/", { method: "POST", body }));
+
+    // Warm up first, so lazily allocated runtime state isn't counted
+    for (let i = 0; i < 3; i++) {
+      await read();
+    }
+    collectGarbage();
+    const baseline = memoryInUse();
+    for (let i = 0; i < 20; i++) {
+      await read();
+    }
+    collectGarbage();
+
+    // Nothing of the 20 bodies read is kept: growth stays under one of them
+    expect(memoryInUse() - baseline).toBeLessThan(body.length);
+  }, 30_000);
+});
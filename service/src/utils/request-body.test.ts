@@ -0,0 +1,99 @@
+import { describe, it, expect } from "vitest";
+import { readJsonBody } from "./request-body.js";
+import { APIError } from "../openai-protocol/errors.js";
+import { largeConversationBody } from "../../tests/test-helpers.js";
+
+function chunkedRequest(
+  chunks: Uint8Array[],
+  onPull: () => void,
+  headers: Record<string, string> = {},
+): Request {
+  let index = 0;
+  const body = new ReadableStream<Uint8Array>(
+    {
+      pull(controller) {
+        onPull();
+        const chunk = chunks[index++];
+        if (chunk) {
+          controller.enqueue(chunk);
+        } else {
+          controller.close();
+        }
+      },
+    },
+    // Only pull when the reader asks, so pulls count actual reads
+    { highWaterMark: 0 },
+  );
+  return new Request("http://localhost/", {
+    method: "POST",
+    headers,
+    body,
+    duplex: "half",
+  } as RequestInit);
+}
+
+async function expectTooLarge(promise: Promise<unknown>) {
+  const error = await promise.catch((e) => e);
+  expect(error).toBeInstanceOf(APIError);
+  expect(error.statusCode).toBe(413);
+  expect(error.code).toBe("request_too_large");
+}
+
+describe("readJsonBody", () => {
+  it("should parse a JSON body", async () => {
+    const request = new Request("http://localhost/", {
+      method: "POST",
+      body: JSON.stringify({ model: "echo" }),
+    });
+
+    expect(await readJsonBody(request)).toEqual({ model: "echo" });
+  });
+
+  it("should reject malformed JSON as an invalid request", async () => {
+    const request = new Request("http://localhost/", {
+      method: "POST",
+      body: "{not json",
+    });
+
+    const error = await readJsonBody(request).catch((e) => e);
+    expect(error.statusCode).toBe(400);
+    expect(error.message).toBe("Invalid JSON in request body");
+  });
+
+  it("should reject an oversized Content-Length without reading the body", async () => {
+    let pulls = 0;
+    const request = chunkedRequest([new Uint8Array(10)], () => pulls++, {
+      "Content-Length": "1000",
+    });
+
+    await expectTooLarge(readJsonBody(request, 100));
+    expect(pulls).toBe(0);
+  });
+
+  it("should stop reading as soon as the cap is crossed", async () => {
+    let pulls = 0;
+    const chunks = Array.from({ length: 100 }, () => new Uint8Array(1024));
+    const request = chunkedRequest(chunks, () => pulls++);
+
+    await expectTooLarge(readJsonBody(request, 2500));
+    expect(pulls).toBeLessThan(10);
+  });
+
+  it("should decode multibyte characters split across chunks", async () => {
+    const bytes = new TextEncoder().encode(JSON.stringify({ content: "héllo 👋" }));
+    const chunks = Array.from(bytes, (byte) => new Uint8Array([byte]));
+    const request = chunkedRequest(chunks, () => {});
+
+    expect(await readJsonBody(request)).toEqual({ content: "héllo 👋" });
+  });
+
+  it("should handle a 5MB conversation under the default cap", async () => {
+    const request = new Request("http://localhost/", {
+      method: "POST",
+      body: largeConversationBody(5 * 1024 * 1024),
+    });
+
+    const parsed = await readJsonBody<{ messages: unknown[] }>(request);
+    expect(parsed.messages).toHaveLength(5 * 1024);
+  });
+});
@@ -0,0 +1,63 @@
+import { describeValue, InvalidRequestError, RequestTooLargeError } from '../openai-protocol/errors.js';
+
+export const DEFAULT_MAX_REQUEST_BYTES = 16 * 1024 * 1024;
+
+/**
+ * Reads and parses a JSON request body without buffering more than the cap.
+ *
+ * A declared Content-Length over the cap is rejected before any bytes are
+ * read. Otherwise the body is decoded incrementally as chunks arrive, so the
+ * raw bytes are released as soon as they are turned into text, and reading
+ * stops (cancelling the upload) the moment the cap is crossed. The text is
+ * still joined into one string, as JSON.parse can't parse in pieces; see
+ * request-body.bench.ts for what this saves over Request.json().
+ */
+export async function readJsonBody<T>(request: Request, maxBytes: number = DEFAULT_MAX_REQUEST_BYTES): Promise<T> {
+  const declaredLength = Number(request.headers.get('Content-Length'));
+  if (Number.isFinite(declaredLength) && declaredLength > maxBytes) {
+    throw new RequestTooLargeError(maxBytes);
+  }
+
+  const text = await readText(request, maxBytes);
+  try {
+    return JSON.parse(text) as T;
+  } catch (error) {
+    const reason = error instanceof Error ? error.message : String(error);
+    throw new InvalidRequestError(
+      'Invalid JSON in request body',
+      undefined,
+      `${reason}; body starts ${describeValue(text, 60)}`
+    );
+  }
+}
+
+async function readText(request: Request, maxBytes: number): Promise<string> {
+  if (!request.body) {
+    return '';
+  }
+
+  const reader = request.body.getReader();
+  const decoder = new TextDecoder();
+  const parts: string[] = [];
+  let totalBytes = 0;
+
+  try {
+    while (true) {
+      const { done, value } = await reader.read();
+      if (done) break;
+
+      totalBytes += value.byteLength;
+      if (totalBytes > maxBytes) {
+        await reader.cancel();
+        throw new RequestTooLargeError(maxBytes);
+      }
+
+      parts.push(decoder.decode(value, { stream: true }));
+    }
+  } finally {
+    reader.releaseLock();
+  }
+
+  parts.push(decoder.decode());
+  return parts.join('');
+}
@@ -0,0 +1,89 @@
+import { describe, it, expect } from "vitest";
+import { BodyCapture, REDACTED, RequestHistory, sanitizeHeaders } from "./request-history.js";
+import type { RequestRecord } from "./request-history.js";
+
+function record(id: string, model: string | null, status: number): RequestRecord {
+  const message = { headers: {}, body: "", body_bytes: 0, body_truncated: false };
+  return {
+    id,
+    timestamp: new Date(0).toISOString(),
+    key_label: "tt-123***",
+    method: "POST",
+    path: "/v1/chat/completions",
+    model,
+    status,
+    streaming: false,
+    prompt_tokens: 0,
+    completion_tokens: 0,
+    total_tokens: 0,
+    duration_ms: 1,
+    request: message,
+    response: message,
+  };
+}
+
+describe("RequestHistory", () => {
+  it("should list summaries newest first, filtered by model and status", () => {
+    const history = new RequestHistory();
+    history.record(record("a", "echo", 200));
+    history.record(record("b", "echo", 404));
+    history.record(record("c", "eliza", 429));
+    history.record(record("d", "echo", 200));
+
+    expect(history.list().map((summary) => summary.id)).toEqual(["d", "c", "b", "a"]);
+    expect(history.list({ model: "echo" }).map((summary) => summary.id)).toEqual(["d", "b", "a"]);
+    expect(history.list({ status: "4xx" }).map((summary) => summary.id)).toEqual(["c", "b"]);
+    expect(history.list({ status: "200", limit: 1 }).map((summary) => summary.id)).toEqual(["d"]);
+    expect(history.list()[0]).not.toHaveProperty("request");
+  });
+
+  it("should reject status filters that aren't a status or class", () => {
+    expect(() => new RequestHistory().list({ status: "client" })).toThrow("Invalid status filter: client");
+  });
+
+  it("should keep only the most recent requests", () => {
+    const history = new RequestHistory(2);
+    history.record(record("a", "echo", 200));
+    history.record(record("b", "echo", 200));
+    history.record(record("c", "echo", 200));
+
+    expect(history.get("a")).toBeUndefined();
+    expect(history.get("c")?.id).toBe("c");
+    expect(history.clear()).toBe(2);
+    expect(history.list()).toEqual([]);
+  });
+});
+
+describe("sanitizeHeaders", () => {
+  it("should redact credentials and cookies entirely", () => {
+    const headers = new Headers({ Authorization: "Bearer tt-1234567890", Cookie: "session=1", "X-Trace": "abc" });
+
+    expect(sanitizeHeaders(headers)).toEqual({ authorization: REDACTED, cookie: REDACTED, "x-trace": "abc" });
+  });
+});
+
+describe("BodyCapture", () => {
+  it("should keep a body up to the cap, counting the rest", () => {
+    const capture = new BodyCapture(5);
+    capture.add(new TextEncoder().encode("abc"));
+    expect(capture.full).toBe(false);
+    capture.add(new TextEncoder().encode("defgh"));
+
+    expect(capture.full).toBe(true);
+    expect(capture.finish(new Headers())).toMatchObject({ body: "abcde", body_bytes: 8, body_truncated: true });
+  });
+
+  it("should drop a character split by the cap", () => {
+    const capture = new BodyCapture(2);
+    capture.add(new TextEncoder().encode("aéb"));
+
+    expect(capture.finish(new Headers()).body).toBe("a");
+  });
+
+  it("should count an unread remainder from the declared length", () => {
+    const capture = new BodyCapture(2);
+    capture.add(new TextEncoder().encode("abc"));
+
+    expect(capture.finish(new Headers(), 100).body_bytes).toBe(100);
+  });
+});
@@ -0,0 +1,147 @@
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+import { CREDENTIAL_HEADERS } from './credential-headers.js';
+
+export const DEFAULT_REQUEST_HISTORY_SIZE = 50;
+export const DEFAULT_REQUEST_HISTORY_LIMIT = 20;
+// Of each request and response body kept; the rest is counted but dropped
+export const MAX_HISTORY_BODY_BYTES = 64 * 1024;
+
+export const REDACTED = '[redacted]';
+
+// A request or response as kept in the history
+export interface CapturedMessage {
+  headers: Record<string, string>;
+  // Decoded as UTF-8, up to MAX_HISTORY_BODY_BYTES
+  body: string;
+  // The whole body's size, including any part that wasn't kept
+  body_bytes: number;
+  body_truncated: boolean;
+}
+
+export interface RequestSummary {
+  // The X-Request-ID the response was sent with
+  id: string;
+  timestamp: string;
+  // Masked API key
+  key_label: string;
+  method: string;
+  path: string;
+  // Unknown when the request didn't name one
+  model: string | null;
+  status: number;
+  streaming: boolean;
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+  duration_ms: number;
+}
+
+export interface RequestRecord extends RequestSummary {
+  request: CapturedMessage;
+  response: CapturedMessage;
+}
+
+export interface RequestHistoryFilter {
+  model?: string | undefined;
+  // Exact, e.g. "429", or a class, e.g. "4xx"
+  status?: string | undefined;
+  limit?: number | undefined;
+}
+
+/**
+ * The most recent API requests and their responses, for looking up from the
+ * admin endpoints while debugging a client. Only the last `capacity` are
+ * kept, and bodies are captured sanitized and capped, so the history stays
+ * small however much traffic goes through.
+ */
+export class RequestHistory {
+  private records: RequestRecord[] = [];
+
+  constructor(private capacity: number = DEFAULT_REQUEST_HISTORY_SIZE) {}
+
+  record(record: RequestRecord): void {
+    this.records.push(record);
+    if (this.records.length > this.capacity) {
+      this.records.shift();
+    }
+  }
+
+  // Newest first
+  list(filter: RequestHistoryFilter = {}): RequestSummary[] {
+    const matchesStatus = filter.status === undefined ? () => true : statusMatcher(filter.status);
+    return this.records
+      .filter((record) => filter.model === undefined || record.model === filter.model)
+      .filter((record) => matchesStatus(record.status))
+      .reverse()
+      .slice(0, filter.limit ?? DEFAULT_REQUEST_HISTORY_LIMIT)
+      .map(({ request: _request, response: _response, ...summary }) => summary);
+  }
+
+  get(id: string): RequestRecord | undefined {
+    return this.records.find((record) => record.id === id);
+  }
+
+  // Forgets every request, returning how many there were
+  clear(): number {
+    const cleared = this.records.length;
+    this.records = [];
+    return cleared;
+  }
+}
+
+// Matches statuses against "404" exactly or "4xx" by class
+function statusMatcher(status: string): (value: number) => boolean {
+  if (/^[1-5]\d\d$/.test(status)) {
+    return (value) => value === Number(status);
+  }
+  if (/^[1-5]xx$/i.test(status)) {
+    return (value) => Math.floor(value / 100) === Number(status[0]);
+  }
+  throw new InvalidRequestError(`Invalid status filter: ${status}; expected e.g. 404 or 4xx`, 'status');
+}
+
+// Header values as kept: credentials and cookies replaced outright
+export function sanitizeHeaders(headers: Headers): Record<string, string> {
+  const sanitized: Record<string, string> = {};
+  headers.forEach((value, name) => {
+    sanitized[name] = CREDENTIAL_HEADERS.includes(name) ? REDACTED : value;
+  });
+  return sanitized;
+}
+
+/**
+ * Collects the start of a body as it passes, counting the rest. A character
+ * split by the cap is dropped rather than kept half.
+ */
+export class BodyCapture {
+  private decoder = new TextDecoder();
+  private text = '';
+  private bytes = 0;
+
+  constructor(private maxBytes: number = MAX_HISTORY_BODY_BYTES) {}
+
+  add(chunk: Uint8Array): void {
+    const room = this.maxBytes - this.bytes;
+    if (room > 0) {
+      this.text += this.decoder.decode(chunk.subarray(0, room), { stream: true });
+    }
+    this.bytes += chunk.byteLength;
+  }
+
+  // Whether the body has gone past the cap, so the rest needn't be read
+  get full(): boolean {
+    return this.bytes > this.maxBytes;
+  }
+
+  // totalBytes, when known, stands in for the count of a body that wasn't
+  // read to the end
+  finish(headers: Headers, totalBytes?: number): CapturedMessage {
+    const truncated = this.full;
+    return {
+      headers: sanitizeHeaders(headers),
+      body: truncated ? this.text : this.text + this.decoder.decode(),
+      body_bytes: Math.max(this.bytes, totalBytes ?? 0),
+      body_truncated: truncated,
+    };
+  }
+}
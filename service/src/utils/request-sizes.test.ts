@@ -0,0 +1,50 @@
+import { describe, it, expect } from "vitest";
+import { RequestSizeStats } from "./request-sizes.js";
+import type { ChatCompletionRequest } from "../openai-protocol/types.js";
+
+const request = (messages: number, extra: Partial<ChatCompletionRequest> = {}): ChatCompletionRequest => ({
+  model: "echo",
+  messages: Array.from({ length: messages }, () => ({ role: "user", content: "x".repeat(50) })),
+  ...extra,
+});
+
+describe("RequestSizeStats", () => {
+  it("should fill cumulative buckets per measurement", () => {
+    const stats = new RequestSizeStats();
+    stats.record("/v1/chat/completions", request(1));
+    stats.record("/v1/chat/completions", request(3, { max_tokens: 100 }));
+
+    const [series] = stats.stats();
+    expect(series).toMatchObject({ route: "/v1/chat/completions", model: "echo" });
+    expect(series?.histograms.messages).toEqual({
+      buckets: { "1": 1, "2": 1, "4": 2, "8": 2, "16": 2, "32": 2, "64": 2, "128": 2, "+Inf": 2 },
+      count: 2,
+      sum: 4,
+    });
+    expect(series?.histograms.prompt_characters.buckets).toMatchObject({ "100": 1, "1000": 2 });
+    expect(series?.histograms.max_tokens).toMatchObject({ count: 1, sum: 100, buckets: { "64": 0, "256": 1 } });
+    expect(series?.histograms.tools.buckets["0"]).toBe(2);
+  });
+
+  it("should count tools and deprecated functions together", () => {
+    const stats = new RequestSizeStats();
+    const tool = { type: "function" as const, function: { name: "lookup" } };
+    stats.record("/v1/chat/completions", request(1, { tools: [tool, tool], functions: [{ name: "legacy" }] }));
+
+    expect(stats.stats()[0]?.histograms.tools).toMatchObject({ count: 1, sum: 3, buckets: { "2": 0, "4": 1 } });
+  });
+
+  it("should keep a series per route and model", () => {
+    const stats = new RequestSizeStats();
+    stats.record("/v1/teenytiny/trace", request(1));
+    stats.record("/v1/chat/completions", request(1, { model: "countdown" }));
+    stats.record("/v1/chat/completions", request(1));
+    stats.record("/v1/chat/completions", request(1));
+
+    expect(stats.stats().map(({ route, model, histograms }) => [route, model, histograms.messages.count])).toEqual([
+      ["/v1/chat/completions", "countdown", 1],
+      ["/v1/chat/completions", "echo", 2],
+      ["/v1/teenytiny/trace", "echo", 1],
+    ]);
+  });
+});
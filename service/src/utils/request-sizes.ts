@@ -0,0 +1,107 @@
+import { contentToText } from '../openai-protocol/types.js';
+import type { ChatCompletionRequest } from '../openai-protocol/types.js';
+
+// Upper bounds of the histogram buckets for each measurement; a value
+// lands in every bucket it fits, as in Prometheus histograms
+export const REQUEST_SIZE_BUCKETS = {
+  messages: [1, 2, 4, 8, 16, 32, 64, 128],
+  prompt_characters: [100, 1000, 10000, 100000, 1000000],
+  max_tokens: [16, 64, 256, 1024, 4096, 16384],
+  tools: [0, 1, 2, 4, 8, 16, 32],
+};
+
+export type RequestSizeMeasure = keyof typeof REQUEST_SIZE_BUCKETS;
+
+export interface HistogramSnapshot {
+  // Observations at or below each bound, keyed by the bound, then "+Inf"
+  buckets: Record<string, number>;
+  count: number;
+  sum: number;
+}
+
+export interface RequestSizeSeries {
+  route: string;
+  model: string;
+  // max_tokens only counts requests that set it
+  histograms: Record<RequestSizeMeasure, HistogramSnapshot>;
+}
+
+class Histogram {
+  private counts: number[];
+  private count = 0;
+  private sum = 0;
+
+  constructor(private bounds: number[]) {
+    this.counts = bounds.map(() => 0);
+  }
+
+  observe(value: number): void {
+    this.bounds.forEach((bound, i) => {
+      if (value <= bound) {
+        this.counts[i]!++;
+      }
+    });
+    this.count++;
+    this.sum += value;
+  }
+
+  snapshot(): HistogramSnapshot {
+    const buckets = Object.fromEntries(this.bounds.map((bound, i) => [String(bound), this.counts[i]!]));
+    return { buckets: { ...buckets, '+Inf': this.count }, count: this.count, sum: this.sum };
+  }
+}
+
+/**
+ * Histograms of how big chat completion requests are, for capacity
+ * planning: messages, prompt characters, max_tokens and tool definitions.
+ * Series are labelled only by route and model, and callers record only
+ * requests for registered models, so their number stays bounded.
+ */
+export class RequestSizeStats {
+  private series = new Map<string, { route: string; model: string; histograms: Record<RequestSizeMeasure, Histogram> }>();
+
+  record(route: string, request: ChatCompletionRequest): void {
+    const key = JSON.stringify([route, request.model]);
+    let series = this.series.get(key);
+    if (!series) {
+      series = {
+        route,
+        model: request.model,
+        histograms: {
+          messages: new Histogram(REQUEST_SIZE_BUCKETS.messages),
+          prompt_characters: new Histogram(REQUEST_SIZE_BUCKETS.prompt_characters),
+          max_tokens: new Histogram(REQUEST_SIZE_BUCKETS.max_tokens),
+          tools: new Histogram(REQUEST_SIZE_BUCKETS.tools),
+        },
+      };
+      this.series.set(key, series);
+    }
+
+    const { histograms } = series;
+    histograms.messages.observe(request.messages.length);
+    histograms.prompt_characters.observe(
+      request.messages.reduce((total, message) => total + [...contentToText(message.content)].length, 0)
+    );
+    if (request.max_tokens !== undefined) {
+      histograms.max_tokens.observe(request.max_tokens);
+    }
+    // Deprecated function definitions count as tools too
+    histograms.tools.observe((request.tools?.length ?? 0) + (request.functions?.length ?? 0));
+  }
+
+  // Every series, ordered by route then model
+  stats(): RequestSizeSeries[] {
+    return [...this.series.values()]
+      .map(({ route, model, histograms }) => ({
+        route,
+        model,
+        histograms: {
+          messages: histograms.messages.snapshot(),
+          prompt_characters: histograms.prompt_characters.snapshot(),
+          max_tokens: histograms.max_tokens.snapshot(),
+          tools: histograms.tools.snapshot(),
+        },
+      }))
+      .sort((a, b) => a.route.localeCompare(b.route) || a.model.localeCompare(b.model));
+  }
+}
@@ -0,0 +1,66 @@
+import { describe, it, expect } from "vitest";
+import { RequestTimer } from "./request-timer.js";
+
+function fakeClock() {
+  const clock = { time: 1000, now: () => clock.time };
+  return clock;
+}
+
+describe("RequestTimer", () => {
+  it("should report every phase, defaulting to zero", () => {
+    const timer = new RequestTimer(fakeClock().now);
+
+    expect(timer.phases()).toEqual({ auth: 0, parse: 0, model: 0, write: 0 });
+  });
+
+  it("should accumulate repeated timings of the same phase", () => {
+    const clock = fakeClock();
+    const timer = new RequestTimer(clock.now);
+
+    timer.start("model");
+    clock.time += 5;
+    timer.stop("model");
+    timer.start("write");
+    clock.time += 2;
+    timer.stop("write");
+    timer.start("model");
+    clock.time += 3;
+    timer.stop("model");
+
+    expect(timer.phases()).toMatchObject({ model: 8, write: 2 });
+    expect(timer.elapsed()).toBe(10);
+  });
+
+  it("should count a running phase up to now", () => {
+    const clock = fakeClock();
+    const timer = new RequestTimer(clock.now);
+
+    timer.start("parse");
+    clock.time += 4;
+
+    expect(timer.phases().parse).toBe(4);
+  });
+
+  it("should ignore stopping a phase that is not running", () => {
+    const timer = new RequestTimer(fakeClock().now);
+
+    timer.stop("auth");
+
+    expect(timer.phases().auth).toBe(0);
+  });
+
+  it("should stop the phase when a timed function throws", async () => {
+    const clock = fakeClock();
+    const timer = new RequestTimer(clock.now);
+
+    await expect(
+      timer.time("parse", async () => {
+        clock.time += 6;
+        throw new Error("bad body");
+      }),
+    ).rejects.toThrow("bad body");
+    clock.time += 10;
+
+    expect(timer.phases().parse).toBe(6);
+  });
+});
@@ -0,0 +1,62 @@
+// Phases of a chat completion request, in the order they happen
+export const TIMING_PHASES = ['auth', 'parse', 'model', 'write'] as const;
+
+export type TimingPhase = typeof TIMING_PHASES[number];
+
+/**
+ * Per-request stopwatch, created by the logging middleware and shared through
+ * the Hono context. Each phase accumulates, so a streaming response can time
+ * every pull from the model and every write separately and still report one
+ * figure per phase.
+ */
+export class RequestTimer {
+  // Wall-clock arrival, for correlating with client-side logs
+  readonly arrivedAt = new Date();
+  private readonly origin: number;
+  private totals = new Map<TimingPhase, number>();
+  private running = new Map<TimingPhase, number>();
+
+  constructor(private now: () => number = () => performance.now()) {
+    this.origin = now();
+  }
+
+  start(phase: TimingPhase): void {
+    if (!this.running.has(phase)) {
+      this.running.set(phase, this.now());
+    }
+  }
+
+  stop(phase: TimingPhase): void {
+    const started = this.running.get(phase);
+    if (started === undefined) {
+      return;
+    }
+    this.running.delete(phase);
+    this.totals.set(phase, (this.totals.get(phase) ?? 0) + this.now() - started);
+  }
+
+  async time<T>(phase: TimingPhase, fn: () => Promise<T>): Promise<T> {
+    this.start(phase);
+    try {
+      return await fn();
+    } finally {
+      this.stop(phase);
+    }
+  }
+
+  // Milliseconds spent in each phase so far, counting phases still running
+  phases(): Record<TimingPhase, number> {
+    const now = this.now();
+    const phases = {} as Record<TimingPhase, number>;
+    for (const phase of TIMING_PHASES) {
+      const started = this.running.get(phase);
+      phases[phase] = (this.totals.get(phase) ?? 0) + (started === undefined ? 0 : now - started);
+    }
+    return phases;
+  }
+
+  // Milliseconds since the request arrived
+  elapsed(): number {
+    return this.now() - this.origin;
+  }
+}
@@ -0,0 +1,92 @@
+import { describe, it, expect } from "vitest";
+import { ResponseCache, responseCacheKey } from "./response-cache.js";
+import type { ChatCompletionRequest } from "../openai-protocol/types.js";
+
+function fakeClock() {
+  const clock = { time: 1000, now: () => clock.time };
+  return clock;
+}
+
+const response = (body: string) => ({
+  headers: { "Content-Type": "application/json" },
+  body,
+});
+
+describe("ResponseCache", () => {
+  it("should count hits and misses", () => {
+    const cache = new ResponseCache({ ttlMs: 1000, maxEntries: 10 });
+
+    expect(cache.get("a")).toBeUndefined();
+    cache.set("a", response("{}"));
+    expect(cache.get("a")).toEqual(response("{}"));
+
+    expect(cache.stats()).toEqual({ entries: 1, hits: 1, misses: 1 });
+  });
+
+  it("should expire entries after the TTL", () => {
+    const clock = fakeClock();
+    const cache = new ResponseCache({ ttlMs: 1000, maxEntries: 10 }, clock.now);
+    cache.set("a", response("{}"));
+
+    clock.time += 999;
+    expect(cache.get("a")).toBeDefined();
+    clock.time += 1;
+    expect(cache.get("a")).toBeUndefined();
+    expect(cache.stats().entries).toBe(0);
+  });
+
+  it("should evict the least recently used entry beyond the size limit", () => {
+    const cache = new ResponseCache({ ttlMs: 1000, maxEntries: 2 });
+    cache.set("a", response("a"));
+    cache.set("b", response("b"));
+    cache.get("a");
+    cache.set("c", response("c"));
+
+    expect(cache.get("a")).toBeDefined();
+    expect(cache.get("b")).toBeUndefined();
+    expect(cache.get("c")).toBeDefined();
+  });
+
+  it("should empty on flush but keep its counters", () => {
+    const cache = new ResponseCache({ ttlMs: 1000, maxEntries: 10 });
+    cache.set("a", response("{}"));
+    cache.get("a");
+
+    cache.flush();
+
+    expect(cache.stats()).toEqual({ entries: 0, hits: 1, misses: 0 });
+  });
+});
+
+describe("responseCacheKey", () => {
+  const request: ChatCompletionRequest = {
+    model: "echo",
+    messages: [{ role: "user", content: "Hi" }],
+  };
+
+  it("should ignore transport options", async () => {
+    expect(await responseCacheKey({ ...request, stream: false, user: "someone" })).toBe(
+      await responseCacheKey(request),
+    );
+  });
+
+  it("should change with the model, messages and generation parameters", async () => {
+    const key = await responseCacheKey(request);
+
+    expect(await responseCacheKey({ ...request, model: "eliza" })).not.toBe(key);
+    expect(await responseCacheKey({ ...request, messages: [{ role: "user", content: "Hi!" }] })).not.toBe(key);
+    expect(await responseCacheKey({ ...request, max_tokens: 1 })).not.toBe(key);
+  });
+
+  it("should change with the logprobs asked for", async () => {
+    const key = await responseCacheKey(request);
+    const withLogprobs = await responseCacheKey({ ...request, logprobs: true });
+
+    expect(withLogprobs).not.toBe(key);
+    expect(await responseCacheKey({ ...request, logprobs: true, top_logprobs: 2 })).not.toBe(withLogprobs);
+  });
+
+  it("should change when the model is reconfigured", async () => {
+    expect(await responseCacheKey(request, "fp_0000000001")).not.toBe(await responseCacheKey(request, "fp_0000000002"));
+  });
+});
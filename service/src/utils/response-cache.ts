@@ -0,0 +1,108 @@
+import type { ChatCompletionRequest } from '../openai-protocol/types.js';
+
+export interface ResponseCacheConfig {
+  // How long a cached response is served for
+  ttlMs: number;
+  // Upper bound on cached responses; the least recently used are evicted first
+  maxEntries: number;
+}
+
+export const DEFAULT_RESPONSE_CACHE_CONFIG: ResponseCacheConfig = {
+  ttlMs: 5 * 60 * 1000,
+  maxEntries: 1000,
+};
+
+export interface CachedResponse {
+  headers: Record<string, string>;
+  body: string;
+}
+
+export interface ResponseCacheStats {
+  entries: number;
+  hits: number;
+  misses: number;
+}
+
+interface CacheEntry extends CachedResponse {
+  expiresAt: number;
+}
+
+/**
+ * In-memory cache of serialized chat completion responses, so identical
+ * requests to deterministic models get byte-identical replies, ids included.
+ */
+export class ResponseCache {
+  private entries = new Map<string, CacheEntry>();
+  private hits = 0;
+  private misses = 0;
+
+  constructor(
+    private config: ResponseCacheConfig = DEFAULT_RESPONSE_CACHE_CONFIG,
+    private now: () => number = Date.now
+  ) {}
+
+  // Looks up a response, counting the hit or miss
+  get(key: string): CachedResponse | undefined {
+    const entry = this.entries.get(key);
+    if (!entry || entry.expiresAt <= this.now()) {
+      this.entries.delete(key);
+      this.misses++;
+      return undefined;
+    }
+
+    this.hits++;
+    this.entries.delete(key);
+    this.entries.set(key, entry);
+    return { headers: entry.headers, body: entry.body };
+  }
+
+  set(key: string, response: CachedResponse): void {
+    this.entries.delete(key);
+    this.entries.set(key, { ...response, expiresAt: this.now() + this.config.ttlMs });
+
+    // Maps iterate in insertion order and get() re-inserts, so the first key is least recently used
+    while (this.entries.size > this.config.maxEntries) {
+      const oldest = this.entries.keys().next().value;
+      if (oldest === undefined) break;
+      this.entries.delete(oldest);
+    }
+  }
+
+  // Drops every cached response; the counters keep running
+  flush(): void {
+    this.entries.clear();
+  }
+
+  stats(): ResponseCacheStats {
+    return { entries: this.entries.size, hits: this.hits, misses: this.misses };
+  }
+}
+
+/**
+ * Hash of everything in a request that can change the response. Transport
+ * options such as stream and user are left out. The model's fingerprint
+ * keeps responses from before it was reconfigured from being replayed.
+ */
+export async function responseCacheKey(request: ChatCompletionRequest, fingerprint?: string): Promise<string> {
+  const relevant = [
+    fingerprint,
+    request.model,
+    request.messages,
+    request.tools,
+    request.tool_choice,
+    request.functions,
+    request.function_call,
+    request.response_format,
+    request.max_tokens,
+    request.temperature,
+    request.top_p,
+    request.n,
+    request.stop,
+    request.service_tier,
+    request.seed,
+    request.logprobs,
+    request.top_logprobs,
+  ];
+  const digest = await globalThis.crypto.subtle.digest('SHA-256', new TextEncoder().encode(JSON.stringify(relevant)));
+  return Array.from(new Uint8Array(digest), (byte) => byte.toString(16).padStart(2, '0')).join('');
+}
@@ -0,0 +1,58 @@
+import { describe, it, expect, beforeEach, afterEach } from "vitest";
+import { mkdtemp, readdir, readFile, rm } from "fs/promises";
+import { tmpdir } from "os";
+import { join } from "path";
+import { RotatingFileSink } from "./rotating-file-sink.js";
+
+describe("RotatingFileSink", () => {
+  let dir: string;
+  let path: string;
+
+  beforeEach(async () => {
+    dir = await mkdtemp(join(tmpdir(), "rotating-sink-"));
+    path = join(dir, "security.log");
+  });
+
+  afterEach(async () => {
+    await rm(dir, { recursive: true, force: true });
+  });
+
+  it("should append lines to the file straight away", async () => {
+    const sink = new RotatingFileSink(path, { maxBytes: 1000, keep: 2 });
+
+    sink.write("one");
+    sink.write("two");
+
+    expect(await readFile(path, "utf8")).toBe("one\ntwo\n");
+  });
+
+  it("should rotate by size and keep only the configured number of files", async () => {
+    // Each line is 6 bytes with its newline, so two fit in a file
+    const sink = new RotatingFileSink(path, { maxBytes: 12, keep: 2 });
+
+    for (const line of ["ln-01", "ln-02", "ln-03", "ln-04", "ln-05", "ln-06", "ln-07"]) {
+      sink.write(line);
+    }
+
+    expect((await readdir(dir)).sort()).toEqual(["security.log", "security.log.1", "security.log.2"]);
+    expect(await readFile(path, "utf8")).toBe("ln-07\n");
+    expect(await readFile(`${path}.1`, "utf8")).toBe("ln-05\nln-06\n");
+    expect(await readFile(`${path}.2`, "utf8")).toBe("ln-03\nln-04\n");
+  });
+
+  it("should pick up the size and last line of an existing file", async () => {
+    new RotatingFileSink(path, { maxBytes: 12, keep: 1 }).write("ln-01");
+
+    const reopened = new RotatingFileSink(path, { maxBytes: 12, keep: 1 });
+    expect(reopened.lastLine()).toBe("ln-01");
+    reopened.write("ln-02");
+    reopened.write("ln-03");
+
+    expect(await readFile(path, "utf8")).toBe("ln-03\n");
+    expect(await readFile(`${path}.1`, "utf8")).toBe("ln-01\nln-02\n");
+  });
+
+  it("should have no last line for a new log", () => {
+    expect(new RotatingFileSink(path).lastLine()).toBeUndefined();
+  });
+});
@@ -0,0 +1,71 @@
+import { appendFileSync, existsSync, readFileSync, renameSync, rmSync, statSync } from 'fs';
+import type { AuditSink } from './audit-log.js';
+
+export interface RotationConfig {
+  // Rotate before a write would take the file past this size
+  maxBytes: number;
+  // Rotated files kept as path.1 (newest) to path.N; older ones are deleted
+  keep: number;
+}
+
+export const DEFAULT_ROTATION_CONFIG: RotationConfig = {
+  maxBytes: 10 * 1024 * 1024,
+  keep: 5,
+};
+
+/**
+ * Appends lines to a file synchronously, rotating it by size.
+ *
+ * Unlike FileAuditSink this blocks on every write, so a line is on disk
+ * before the request that caused it carries on. That suits rare, important
+ * events such as security log entries, not per-request traffic.
+ */
+export class RotatingFileSink implements AuditSink {
+  private size: number;
+
+  constructor(
+    private path: string,
+    private config: RotationConfig = DEFAULT_ROTATION_CONFIG,
+  ) {
+    this.size = existsSync(path) ? statSync(path).size : 0;
+  }
+
+  write(line: string): void {
+    const data = `${line}\n`;
+    const bytes = Buffer.byteLength(data);
+    if (this.size > 0 && this.size + bytes > this.config.maxBytes) {
+      this.rotate();
+    }
+    appendFileSync(this.path, data);
+    this.size += bytes;
+  }
+
+  // The newest line written, across rotations, if any
+  lastLine(): string | undefined {
+    for (const file of [this.path, `${this.path}.1`]) {
+      if (existsSync(file)) {
+        const lines = readFileSync(file, 'utf8').split('\n').filter((line) => line.trim() !== '');
+        const last = lines[lines.length - 1];
+        if (last !== undefined) {
+          return last;
+        }
+      }
+    }
+    return undefined;
+  }
+
+  private rotate(): void {
+    rmSync(`${this.path}.${this.config.keep}`, { force: true });
+    for (let n = this.config.keep - 1; n >= 1; n--) {
+      if (existsSync(`${this.path}.${n}`)) {
+        renameSync(`${this.path}.${n}`, `${this.path}.${n + 1}`);
+      }
+    }
+    if (this.config.keep > 0) {
+      renameSync(this.path, `${this.path}.1`);
+    } else {
+      rmSync(this.path, { force: true });
+    }
+    this.size = 0;
+  }
+}
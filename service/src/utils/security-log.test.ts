@@ -0,0 +1,88 @@
+import { describe, it, expect } from "vitest";
+import { chainHeadOf, GENESIS, SecurityLogger, verifySecurityLog } from "./security-log.js";
+
+function capture() {
+  const lines: string[] = [];
+  const logger = new SecurityLogger({ write: (line) => lines.push(line) });
+  return { lines, logger };
+}
+
+function sampleLog(): string[] {
+  const { lines, logger } = capture();
+  logger.record({ event: "auth_failure", reason: "Invalid API key", source_ip: "10.0.0.1", api_key: "tt-bad***" });
+  logger.record({ event: "key_created", api_key: "tt-new***", source_ip: "10.0.0.2" });
+  logger.record({ event: "admin_request", method: "GET", path: "/admin/logs", api_key: "tt-adm***", source_ip: "10.0.0.3" });
+  logger.record({ event: "config_reloaded", setting: "log_filters", api_key: "tt-adm***" });
+  return lines;
+}
+
+describe("SecurityLogger", () => {
+  it("should chain each entry to the one before", () => {
+    const lines = sampleLog();
+    const entries = lines.map((line) => JSON.parse(line));
+
+    expect(entries.map((entry) => entry.seq)).toEqual([0, 1, 2, 3]);
+    expect(entries[0].prev_hash).toBe(GENESIS.hash);
+    expect(entries[1].prev_hash).toBe(entries[0].hash);
+    expect(entries[3].prev_hash).toBe(entries[2].hash);
+    expect(entries[0]).toMatchObject({ event: "auth_failure", reason: "Invalid API key", source_ip: "10.0.0.1" });
+  });
+
+  it("should continue an existing chain", () => {
+    const lines = sampleLog();
+    const more: string[] = [];
+    const resumed = new SecurityLogger({ write: (line) => more.push(line) }, chainHeadOf(lines[lines.length - 1]!));
+
+    resumed.record({ event: "key_created", api_key: "tt-abc***", source_ip: "10.0.0.4" });
+
+    expect(JSON.parse(more[0]!).seq).toBe(4);
+    expect(verifySecurityLog([...lines, ...more])).toEqual({ valid: true, entries: 5, firstSeq: 0 });
+  });
+});
+
+describe("verifySecurityLog", () => {
+  it("should accept an untouched log, ignoring blank lines", () => {
+    expect(verifySecurityLog([...sampleLog(), ""])).toEqual({ valid: true, entries: 4, firstSeq: 0 });
+  });
+
+  it("should detect a modified entry", () => {
+    const lines = sampleLog();
+    lines[1] = lines[1]!.replace("10.0.0.2", "10.9.9.9");
+
+    expect(verifySecurityLog(lines)).toMatchObject({ valid: false, line: 2, entries: 1, error: "entry 1 has been modified" });
+  });
+
+  it("should detect a modified entry whose hash was recomputed", () => {
+    const lines = sampleLog();
+    const { lines: forged, logger } = capture();
+    logger.record({ event: "auth_failure", reason: "Invalid API key", source_ip: "127.0.0.1" });
+    lines[0] = forged[0]!;
+
+    expect(verifySecurityLog(lines)).toMatchObject({ valid: false, line: 2, error: "entry 1 does not follow entry 0" });
+  });
+
+  it("should detect a deleted entry", () => {
+    const lines = sampleLog();
+    lines.splice(2, 1);
+
+    expect(verifySecurityLog(lines)).toMatchObject({ valid: false, line: 3, error: "expected entry 2 but found entry 3" });
+  });
+
+  it("should detect reordered entries", () => {
+    const lines = sampleLog();
+    [lines[1], lines[2]] = [lines[2]!, lines[1]!];
+
+    expect(verifySecurityLog(lines)).toMatchObject({ valid: false, line: 2 });
+  });
+
+  it("should report where a log cut off at the front starts", () => {
+    const lines = sampleLog().slice(2);
+
+    expect(verifySecurityLog(lines)).toEqual({ valid: true, entries: 2, firstSeq: 2 });
+  });
+
+  it("should reject lines that aren't chained entries", () => {
+    expect(verifySecurityLog(["not json"])).toMatchObject({ valid: false, line: 1, error: "not valid JSON" });
+    expect(verifySecurityLog(['{"event":"key_created"}'])).toMatchObject({ valid: false, line: 1 });
+  });
+});
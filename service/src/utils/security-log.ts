@@ -0,0 +1,126 @@
+import { createHash } from 'node:crypto';
+import type { AuditSink } from './audit-log.js';
+
+/**
+ * Tamper-evident log of authentication and admin events
+ *
+ * Kept apart from the access log and the completion audit log. Every entry
+ * carries a sequence number and the hash of the entry before it, and its own
+ * hash covers both, so editing, deleting or reordering entries breaks the
+ * chain. `tt audit verify` checks a log with verifySecurityLog.
+ */
+
+export type SecurityEvent =
+  | { event: 'auth_failure'; reason: string; source_ip: string; api_key?: string | undefined }
+  | { event: 'key_created'; api_key: string; source_ip: string }
+  | { event: 'config_reloaded'; setting: string; api_key: string }
+  | { event: 'admin_request'; method: string; path: string; api_key: string; source_ip: string };
+
+export type SecurityLogEntry = SecurityEvent & {
+  seq: number;
+  timestamp: string;
+  prev_hash: string;
+  hash: string;
+};
+
+// Where the chain currently ends; a new log starts from GENESIS
+export interface ChainHead {
+  seq: number;
+  hash: string;
+}
+
+export const GENESIS: ChainHead = { seq: -1, hash: '0'.repeat(64) };
+
+export class SecurityLogger {
+  private head: ChainHead;
+
+  constructor(
+    private sink: AuditSink,
+    head: ChainHead = GENESIS,
+    private now: () => Date = () => new Date(),
+  ) {
+    this.head = head;
+  }
+
+  record(event: SecurityEvent): void {
+    const unsigned = {
+      seq: this.head.seq + 1,
+      timestamp: this.now().toISOString(),
+      ...event,
+      prev_hash: this.head.hash,
+    };
+    const hash = hashEntry(unsigned);
+    this.sink.write(JSON.stringify({ ...unsigned, hash }));
+    this.head = { seq: unsigned.seq, hash };
+  }
+}
+
+// The chain head after the given line, for resuming a log after a restart
+export function chainHeadOf(line: string): ChainHead {
+  const entry = JSON.parse(line) as SecurityLogEntry;
+  return { seq: entry.seq, hash: entry.hash };
+}
+
+export interface ChainVerification {
+  valid: boolean;
+  entries: number;
+  // Sequence number of the first entry; above 0 when earlier entries were
+  // rotated out or cut off
+  firstSeq?: number | undefined;
+  // 1-based line of the first problem, and what it was
+  line?: number | undefined;
+  error?: string | undefined;
+}
+
+/**
+ * Checks the hash chain over log lines, oldest first. Lines from several
+ * rotated files can be concatenated in order; blank lines are ignored.
+ */
+export function verifySecurityLog(lines: string[]): ChainVerification {
+  let head: ChainHead | undefined;
+  let firstSeq: number | undefined;
+  let entries = 0;
+
+  for (const [index, line] of lines.entries()) {
+    if (line.trim() === '') {
+      continue;
+    }
+    const fail = (error: string): ChainVerification => ({ valid: false, entries, firstSeq, line: index + 1, error });
+
+    let entry: Record<string, unknown>;
+    try {
+      entry = JSON.parse(line);
+    } catch {
+      return fail('not valid JSON');
+    }
+
+    const { hash, ...unsigned } = entry;
+    if (typeof hash !== 'string' || typeof unsigned.seq !== 'number' || typeof unsigned.prev_hash !== 'string') {
+      return fail('missing seq, prev_hash or hash');
+    }
+    if (hashEntry(unsigned) !== hash) {
+      return fail(`entry ${unsigned.seq} has been modified`);
+    }
+
+    if (head === undefined) {
+      // The first entry anchors the chain unless it claims to be the very first
+      firstSeq = unsigned.seq;
+      if (unsigned.seq === 0 && unsigned.prev_hash !== GENESIS.hash) {
+        return fail('entry 0 does not start from the genesis hash');
+      }
+    } else if (unsigned.seq !== head.seq + 1) {
+      return fail(`expected entry ${head.seq + 1} but found entry ${unsigned.seq}`);
+    } else if (unsigned.prev_hash !== head.hash) {
+      return fail(`entry ${unsigned.seq} does not follow entry ${head.seq}`);
+    }
+
+    head = { seq: unsigned.seq, hash };
+    entries++;
+  }
+
+  return { valid: true, entries, firstSeq };
+}
+
+function hashEntry(unsigned: Record<string, unknown>): string {
+  return createHash('sha256').update(JSON.stringify(unsigned)).digest('hex');
+}
@@ -0,0 +1,79 @@
+import { describe, it, expect } from "vitest";
+import { SessionStore } from "./session-store.js";
+
+function fakeClock() {
+  const clock = { time: 1_000_000, now: () => clock.time };
+  return clock;
+}
+
+function sequentialIds() {
+  let next = 0;
+  return () => `sess_${++next}`;
+}
+
+describe("SessionStore", () => {
+  it("should start sessions empty and accumulate appended messages", () => {
+    const store = new SessionStore({ ttlMs: 1000, maxSessionsPerKey: 10 });
+    const session = store.create("key-a");
+
+    expect(session.messages).toEqual([]);
+
+    store.append(session.id, "key-a", [{ role: "user", content: "Hi" }]);
+    store.append(session.id, "key-a", [{ role: "assistant", content: "Hello" }]);
+
+    expect(store.get(session.id, "key-a")?.messages).toEqual([
+      { role: "user", content: "Hi" },
+      { role: "assistant", content: "Hello" },
+    ]);
+  });
+
+  it("should hide sessions from other API keys", () => {
+    const store = new SessionStore({ ttlMs: 1000, maxSessionsPerKey: 10 });
+    const session = store.create("key-a");
+
+    store.append(session.id, "key-b", [{ role: "user", content: "Intruder" }]);
+
+    expect(store.get(session.id, "key-b")).toBeUndefined();
+    expect(store.delete(session.id, "key-b")).toBe(false);
+    expect(store.get(session.id, "key-a")?.messages).toEqual([]);
+  });
+
+  it("should expire sessions left unused for the TTL", () => {
+    const clock = fakeClock();
+    const store = new SessionStore({ ttlMs: 1000, maxSessionsPerKey: 10 }, clock.now);
+    const session = store.create("key-a");
+
+    clock.time += 900;
+    expect(store.get(session.id, "key-a")).toBeDefined();
+
+    // The read above extended the lifetime
+    clock.time += 900;
+    expect(store.get(session.id, "key-a")).toBeDefined();
+
+    clock.time += 1000;
+    expect(store.get(session.id, "key-a")).toBeUndefined();
+  });
+
+  it("should drop a key's least recently used session at the cap", () => {
+    const store = new SessionStore({ ttlMs: 1000, maxSessionsPerKey: 2 }, Date.now, sequentialIds());
+    const first = store.create("key-a");
+    const second = store.create("key-a");
+    const other = store.create("key-b");
+
+    store.get(first.id, "key-a");
+    store.create("key-a");
+
+    expect(store.get(first.id, "key-a")).toBeDefined();
+    expect(store.get(second.id, "key-a")).toBeUndefined();
+    expect(store.get(other.id, "key-b")).toBeDefined();
+  });
+
+  it("should forget deleted sessions", () => {
+    const store = new SessionStore({ ttlMs: 1000, maxSessionsPerKey: 10 });
+    const session = store.create("key-a");
+
+    expect(store.delete(session.id, "key-a")).toBe(true);
+    expect(store.get(session.id, "key-a")).toBeUndefined();
+    expect(store.delete(session.id, "key-a")).toBe(false);
+  });
+});
@@ -0,0 +1,104 @@
+import type { ChatCompletionMessage } from '../openai-protocol/types.js';
+
+export interface SessionConfig {
+  // Sessions unused for this long are forgotten
+  ttlMs: number;
+  // Sessions per API key; creating another evicts that key's least recently used
+  maxSessionsPerKey: number;
+}
+
+export const DEFAULT_SESSION_CONFIG: SessionConfig = {
+  ttlMs: 60 * 60 * 1000,
+  maxSessionsPerKey: 100,
+};
+
+export interface Session {
+  id: string;
+  created: number;
+  messages: ChatCompletionMessage[];
+}
+
+interface StoredSession extends Session {
+  owner: string;
+  expiresAt: number;
+}
+
+/**
+ * In-memory conversation transcripts for clients that only send the latest
+ * message. Sessions belong to the API key that created them and are
+ * invisible to other keys.
+ */
+export class SessionStore {
+  private sessions = new Map<string, StoredSession>();
+
+  constructor(
+    private config: SessionConfig = DEFAULT_SESSION_CONFIG,
+    private now: () => number = Date.now,
+    private generateId: () => string = () => `sess_${globalThis.crypto.randomUUID().replace(/-/g, '')}`
+  ) {}
+
+  create(owner: string): Session {
+    this.evictExpired();
+
+    const owned = [...this.sessions.values()].filter((session) => session.owner === owner);
+    // Maps iterate in insertion order and get() re-inserts, so the first is least recently used
+    for (const session of owned.slice(0, Math.max(owned.length - this.config.maxSessionsPerKey + 1, 0))) {
+      this.sessions.delete(session.id);
+    }
+
+    const session: StoredSession = {
+      id: this.generateId(),
+      created: Math.floor(this.now() / 1000),
+      messages: [],
+      owner,
+      expiresAt: this.now() + this.config.ttlMs,
+    };
+    this.sessions.set(session.id, session);
+    return this.view(session);
+  }
+
+  // The session if it exists, hasn't expired and belongs to owner; using a
+  // session extends its lifetime
+  get(id: string, owner: string): Session | undefined {
+    const session = this.sessions.get(id);
+    if (!session || session.owner !== owner) {
+      return undefined;
+    }
+    if (session.expiresAt <= this.now()) {
+      this.sessions.delete(id);
+      return undefined;
+    }
+
+    session.expiresAt = this.now() + this.config.ttlMs;
+    this.sessions.delete(id);
+    this.sessions.set(id, session);
+    return this.view(session);
+  }
+
+  append(id: string, owner: string, messages: ChatCompletionMessage[]): void {
+    const session = this.sessions.get(id);
+    if (session && session.owner === owner) {
+      session.messages.push(...messages);
+    }
+  }
+
+  delete(id: string, owner: string): boolean {
+    if (!this.get(id, owner)) {
+      return false;
+    }
+    return this.sessions.delete(id);
+  }
+
+  private evictExpired(): void {
+    const now = this.now();
+    for (const [id, session] of this.sessions) {
+      if (session.expiresAt <= now) {
+        this.sessions.delete(id);
+      }
+    }
+  }
+
+  private view(session: StoredSession): Session {
+    return { id: session.id, created: session.created, messages: [...session.messages] };
+  }
+}
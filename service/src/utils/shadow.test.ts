@@ -0,0 +1,84 @@
+import { describe, it, expect } from "vitest";
+import { ShadowMirror } from "./shadow.js";
+import type { PrimaryResult } from "./shadow.js";
+import { Logger } from "./logger.js";
+
+const primary = (overrides: Partial<PrimaryResult> = {}): PrimaryResult => ({
+  requestId: "req-1",
+  request: {
+    model: "echo",
+    messages: [{ role: "user", content: "Hi" }],
+    stream: true,
+    stream_options: { include_usage: true },
+  },
+  status: 200,
+  latencyMs: 5,
+  usage: { prompt_tokens: 1, completion_tokens: 1, total_tokens: 2 },
+  ...overrides,
+});
+
+describe("ShadowMirror", () => {
+  it("should send a non-streaming copy and record the deltas", async () => {
+    const sent: Array<{ url: string; init: RequestInit }> = [];
+    const clock = { time: 0 };
+    const mirror = new ShadowMirror(
+      { baseUrl: "http://shadow/v1/", apiKey: "sk-shadow", model: "gpt-test" },
+      new Logger(0),
+      (async (url: string, init: RequestInit) => {
+        sent.push({ url, init });
+        clock.time += 30;
+        return Response.json({ usage: { prompt_tokens: 4, completion_tokens: 6, total_tokens: 10 } });
+      }) as typeof fetch,
+      () => clock.time,
+    );
+
+    mirror.mirror(primary());
+    await mirror.settled();
+
+    expect(sent[0]!.url).toBe("http://shadow/v1/chat/completions");
+    expect((sent[0]!.init.headers as Record<string, string>)["Authorization"]).toBe("Bearer sk-shadow");
+    expect(JSON.parse(sent[0]!.init.body as string)).toEqual({
+      model: "gpt-test",
+      messages: [{ role: "user", content: "Hi" }],
+      stream: false,
+    });
+
+    const summary = mirror.summary();
+    expect(summary).toMatchObject({ mirrored: 1, succeeded: 1, failed: 0, status_mismatches: 0, in_flight: 0 });
+    expect(summary.recent[0]).toMatchObject({
+      request_id: "req-1",
+      model: "gpt-test",
+      shadow: { status: 200, latency_ms: 30, total_tokens: 10 },
+      deltas: { latency_ms: 25, total_tokens: 8 },
+      status_match: true,
+    });
+  });
+
+  it("should count unreachable shadows as failures without throwing", async () => {
+    const mirror = new ShadowMirror({ baseUrl: "http://shadow/v1" }, new Logger(0), (async () => {
+      throw new Error("connection refused");
+    }) as typeof fetch);
+
+    mirror.mirror(primary());
+    await mirror.settled();
+
+    expect(mirror.summary()).toMatchObject({ failed: 1, status_mismatches: 1 });
+    expect(mirror.summary().recent[0]!.shadow).toMatchObject({ status: null, error: "connection refused" });
+  });
+
+  it("should skip copies while too many are outstanding", async () => {
+    let release = () => {};
+    const blocked = new Promise<void>((resolve) => (release = resolve));
+    const mirror = new ShadowMirror({ baseUrl: "http://shadow/v1", maxInFlight: 1 }, new Logger(0), (async () => {
+      await blocked;
+      return Response.json({});
+    }) as typeof fetch);
+
+    mirror.mirror(primary());
+    mirror.mirror(primary());
+    release();
+    await mirror.settled();
+
+    expect(mirror.summary()).toMatchObject({ mirrored: 1, skipped: 1 });
+  });
+});
@@ -0,0 +1,198 @@
+import type { ChatCompletionRequest, ChatCompletionUsage } from '../openai-protocol/types.js';
+import { Logger } from './logger.js';
+
+// Where and how to reach another OpenAI-compatible API
+export interface UpstreamConfig {
+  // Base URL including the version, e.g. 'https://api.openai.com/v1'
+  baseUrl: string;
+  apiKey?: string | undefined;
+  timeoutMs?: number | undefined;
+}
+
+export interface ShadowConfig extends UpstreamConfig {
+  // Replaces the model name in mirrored requests, since the shadow won't
+  // have the same models
+  model?: string | undefined;
+  // Mirrored requests outstanding at once; beyond this copies are skipped
+  maxInFlight?: number | undefined;
+  // Comparisons kept for the admin summary
+  maxRecords?: number | undefined;
+}
+
+// How a request went locally, to compare against the shadow
+export interface PrimaryResult {
+  requestId: string;
+  request: ChatCompletionRequest;
+  status: number;
+  latencyMs: number;
+  usage?: ChatCompletionUsage | undefined;
+}
+
+export interface ShadowSide {
+  // Null when the shadow couldn't be reached
+  status: number | null;
+  latency_ms: number;
+  total_tokens: number | null;
+  error?: string;
+}
+
+export interface ShadowRecord {
+  request_id: string;
+  model: string;
+  primary: ShadowSide;
+  shadow: ShadowSide;
+  // Shadow minus primary; null when either side is missing the figure
+  deltas: {
+    latency_ms: number;
+    total_tokens: number | null;
+  };
+  status_match: boolean;
+}
+
+export interface ShadowSummary {
+  mirrored: number;
+  succeeded: number;
+  failed: number;
+  skipped: number;
+  in_flight: number;
+  status_mismatches: number;
+  mean_latency_delta_ms: number | null;
+  recent: ShadowRecord[];
+}
+
+/**
+ * Replays completed requests to a shadow backend and compares the outcome.
+ *
+ * Copies are sent in the background after the primary response, always as
+ * non-streaming requests, so the shadow can neither slow down nor break the
+ * primary. Only status, latency and usage are compared; content is expected
+ * to differ.
+ */
+export class ShadowMirror {
+  private records: ShadowRecord[] = [];
+  private counts = { mirrored: 0, succeeded: 0, failed: 0, skipped: 0, statusMismatches: 0 };
+  private latencyDeltaTotal = 0;
+  private pending = new Set<Promise<void>>();
+
+  constructor(
+    private config: ShadowConfig,
+    private logger: Logger = new Logger(),
+    private fetchImpl: typeof fetch = (input, init) => globalThis.fetch(input, init),
+    private now: () => number = () => performance.now()
+  ) {}
+
+  mirror(primary: PrimaryResult): void {
+    if (this.pending.size >= (this.config.maxInFlight ?? 10)) {
+      this.counts.skipped++;
+      return;
+    }
+
+    const replay = this.replay(primary).catch((error) => {
+      this.logger.error('Shadow comparison failed', {
+        request_id: primary.requestId,
+        error: error instanceof Error ? error.message : String(error),
+      });
+    });
+    this.pending.add(replay);
+    void replay.finally(() => this.pending.delete(replay));
+  }
+
+  summary(): ShadowSummary {
+    const compared = this.counts.succeeded + this.counts.failed;
+    return {
+      mirrored: this.counts.mirrored,
+      succeeded: this.counts.succeeded,
+      failed: this.counts.failed,
+      skipped: this.counts.skipped,
+      in_flight: this.pending.size,
+      status_mismatches: this.counts.statusMismatches,
+      mean_latency_delta_ms: compared === 0 ? null : this.latencyDeltaTotal / compared,
+      recent: [...this.records],
+    };
+  }
+
+  // Resolves once every mirrored request so far has been compared
+  async settled(): Promise<void> {
+    while (this.pending.size > 0) {
+      await Promise.all(this.pending);
+    }
+  }
+
+  private async replay(primary: PrimaryResult): Promise<void> {
+    this.counts.mirrored++;
+    const request: ChatCompletionRequest = {
+      ...primary.request,
+      model: this.config.model ?? primary.request.model,
+      stream: false,
+    };
+    delete request.stream_options;
+
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    if (this.config.apiKey !== undefined) {
+      headers['Authorization'] = `Bearer ${this.config.apiKey}`;
+    }
+
+    const start = this.now();
+    let shadow: ShadowSide;
+    try {
+      const response = await this.fetchImpl(`${this.config.baseUrl.replace(/\/+$/, '')}/chat/completions`, {
+        method: 'POST',
+        headers,
+        body: JSON.stringify(request),
+        signal: AbortSignal.timeout(this.config.timeoutMs ?? 30_000),
+      });
+      const body = (await response.json().catch(() => undefined)) as { usage?: ChatCompletionUsage } | undefined;
+      shadow = {
+        status: response.status,
+        latency_ms: this.now() - start,
+        total_tokens: body?.usage?.total_tokens ?? null,
+      };
+    } catch (error) {
+      shadow = {
+        status: null,
+        latency_ms: this.now() - start,
+        total_tokens: null,
+        error: error instanceof Error ? error.message : String(error),
+      };
+    }
+
+    this.record(primary, request.model, shadow);
+  }
+
+  private record(primary: PrimaryResult, model: string, shadow: ShadowSide): void {
+    const primarySide: ShadowSide = {
+      status: primary.status,
+      latency_ms: primary.latencyMs,
+      total_tokens: primary.usage?.total_tokens ?? null,
+    };
+    const record: ShadowRecord = {
+      request_id: primary.requestId,
+      model,
+      primary: primarySide,
+      shadow,
+      deltas: {
+        latency_ms: shadow.latency_ms - primarySide.latency_ms,
+        total_tokens:
+          shadow.total_tokens === null || primarySide.total_tokens === null
+            ? null
+            : shadow.total_tokens - primarySide.total_tokens,
+      },
+      status_match: shadow.status === primary.status,
+    };
+
+    if (shadow.status !== null && shadow.status < 400) {
+      this.counts.succeeded++;
+    } else {
+      this.counts.failed++;
+    }
+    if (!record.status_match) {
+      this.counts.statusMismatches++;
+    }
+    this.latencyDeltaTotal += record.deltas.latency_ms;
+
+    this.records.push(record);
+    if (this.records.length > (this.config.maxRecords ?? 100)) {
+      this.records.shift();
+    }
+  }
+}
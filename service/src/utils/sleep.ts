@@ -0,0 +1,22 @@
+/**
+ * Resolves after `ms` milliseconds, or straight away once `signal` aborts.
+ *
+ * Never rejects: callers check `signal.aborted` afterwards to decide whether
+ * to carry on, which keeps cancellation out of their error handling.
+ */
+export function sleep(ms: number, signal?: AbortSignal): Promise<void> {
+  if (ms <= 0 || signal?.aborted) {
+    return Promise.resolve();
+  }
+  return new Promise((resolve) => {
+    const onAbort = () => {
+      clearTimeout(timer);
+      resolve();
+    };
+    const timer = setTimeout(() => {
+      signal?.removeEventListener('abort', onAbort);
+      resolve();
+    }, ms);
+    signal?.addEventListener('abort', onAbort, { once: true });
+  });
+}
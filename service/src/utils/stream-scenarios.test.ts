@@ -0,0 +1,141 @@
+import { describe, it, expect } from "vitest";
+import {
+  parseStreamScenarioConfig,
+  parseTimeline,
+  runScenario,
+  StreamScenarios,
+} from "./stream-scenarios.js";
+import type { ScenarioClock } from "./stream-scenarios.js";
+
+// A clock whose sleeps return at once, moving time forward instead
+function fakeClock(): ScenarioClock & { sleeps: number[] } {
+  let now = 0;
+  const sleeps: number[] = [];
+  return {
+    sleeps,
+    now: () => now,
+    sleep: async (ms) => {
+      sleeps.push(ms);
+      now += ms;
+    },
+  };
+}
+
+// Yields 1..count, taking intervalMs of clock time before each
+async function* ticking(clock: ScenarioClock, count: number, intervalMs: number) {
+  for (let i = 1; i <= count; i++) {
+    await clock.sleep(intervalMs);
+    yield i;
+  }
+}
+
+// Runs a scenario, recording each chunk with the time it was sent and
+// heartbeats as "♥"
+async function timeline(steps: string, count: number, heartbeatMs?: number) {
+  const clock = fakeClock();
+  const sent: Array<[number | string, number]> = [];
+  const source = ticking(clock, count, 100);
+  for await (const chunk of runScenario(source, parseTimeline(steps), {
+    clock,
+    heartbeatMs,
+    onHeartbeat: async () => {
+      sent.push(["♥", clock.now()]);
+    },
+  })) {
+    sent.push([chunk, clock.now()]);
+  }
+  return sent;
+}
+
+describe("parseTimeline", () => {
+  it("should parse durations and bursts", () => {
+    expect(parseTimeline("normal 2s, stall 500ms, burst 50 chunks, stall 1.5s, burst 1")).toEqual([
+      { kind: "normal", ms: 2000 },
+      { kind: "stall", ms: 500 },
+      { kind: "burst", chunks: 50 },
+      { kind: "stall", ms: 1500 },
+      { kind: "burst", chunks: 1 },
+    ]);
+  });
+
+  it("should reject unknown or empty steps", () => {
+    expect(() => parseTimeline("normal 2s, wobble 1s")).toThrow('Invalid scenario step "wobble 1s"');
+    expect(() => parseTimeline("stall 5")).toThrow("Invalid scenario step");
+    expect(() => parseTimeline(" , ")).toThrow("at least one step");
+  });
+});
+
+describe("parseStreamScenarioConfig", () => {
+  it("should validate every timeline and the heartbeat interval", () => {
+    expect(parseStreamScenarioConfig({ scenarios: { spike: "stall 1s" }, heartbeatMs: 250 })).toEqual({
+      scenarios: { spike: "stall 1s" },
+      heartbeatMs: 250,
+    });
+    expect(() => parseStreamScenarioConfig({ scenarios: { spike: "nap 1s" } })).toThrow("Invalid scenario step");
+    expect(() => parseStreamScenarioConfig({ scenarios: { spike: 5 } })).toThrow("scenarios.spike");
+    expect(() => parseStreamScenarioConfig({ scenarios: {}, heartbeatMs: 0 })).toThrow("heartbeatMs");
+    expect(() => parseStreamScenarioConfig({ scenarios: {}, jitter: 1 })).toThrow("Unknown stream scenario setting");
+  });
+});
+
+describe("runScenario", () => {
+  it("should stall, burst and then pass the rest through", async () => {
+    expect(await timeline("normal 250ms, stall 1s, burst 3 chunks", 6)).toEqual([
+      [1, 100],
+      [2, 200],
+      [3, 300],
+      // Stalled until 1300, then three chunks pulled before any is sent
+      [4, 1600],
+      [5, 1600],
+      [6, 1600],
+    ]);
+  });
+
+  it("should send heartbeats while stalled when enabled", async () => {
+    expect(await timeline("stall 1s", 1, 400)).toEqual([
+      ["♥", 400],
+      ["♥", 800],
+      [1, 1100],
+    ]);
+  });
+
+  it("should end with the source even mid-burst", async () => {
+    expect(await timeline("burst 10 chunks, stall 1s", 2)).toEqual([
+      [1, 200],
+      [2, 200],
+    ]);
+  });
+
+  it("should stop stalling once the signal aborts", async () => {
+    const clock = fakeClock();
+    const abort = new AbortController();
+    abort.abort();
+
+    const chunks: number[] = [];
+    for await (const chunk of runScenario(ticking(clock, 2, 0), parseTimeline("stall 10s"), {
+      clock,
+      signal: abort.signal,
+    })) {
+      chunks.push(chunk);
+    }
+
+    expect(chunks).toEqual([1, 2]);
+    expect(clock.sleeps.filter((ms) => ms > 0)).toEqual([]);
+  });
+});
+
+describe("StreamScenarios", () => {
+  it("should count requests per scenario and reject unknown names", () => {
+    const scenarios = new StreamScenarios({ scenarios: { spike: "stall 1s" } });
+    scenarios.use("spike");
+    scenarios.define("burst", "burst 5");
+
+    expect(scenarios.stats()).toEqual({
+      spike: { timeline: "stall 1s", requests: 1 },
+      burst: { timeline: "burst 5", requests: 0 },
+    });
+    expect(() => scenarios.use("calm")).toThrow("Unknown stream scenario: calm");
+    expect(scenarios.remove("spike")).toBe(true);
+    expect(scenarios.remove("spike")).toBe(false);
+  });
+});
@@ -0,0 +1,204 @@
+import { InvalidRequestError } from '../openai-protocol/errors.js';
+import { sleep } from './sleep.js';
+
+// Names the scenario a streamed chat completion runs under
+export const SCENARIO_HEADER = 'X-TeenyTiny-Scenario';
+
+// One phase of a scenario's timeline:
+// - normal: chunks pass through at the model's pace for ms
+// - stall:  nothing is sent for ms, apart from heartbeats if enabled
+// - burst:  the next chunks are sent back to back, as if they'd queued up
+//           behind a stall
+export type ScenarioStep =
+  | { kind: 'normal'; ms: number }
+  | { kind: 'stall'; ms: number }
+  | { kind: 'burst'; chunks: number };
+
+export interface StreamScenarioConfig {
+  // Timelines by scenario name, e.g. "normal 2s, stall 5s, burst 50 chunks"
+  scenarios: Record<string, string>;
+  // Interval of SSE comment heartbeats during stalls; none when unset
+  heartbeatMs?: number | undefined;
+}
+
+// Time source for running scenarios; tests swap in one that doesn't wait
+export interface ScenarioClock {
+  now(): number;
+  sleep(ms: number, signal?: AbortSignal): Promise<void>;
+}
+
+export const systemClock: ScenarioClock = { now: () => Date.now(), sleep };
+
+export interface ScenarioOptions {
+  clock?: ScenarioClock | undefined;
+  heartbeatMs?: number | undefined;
+  // Sends one heartbeat; called every heartbeatMs while stalled
+  onHeartbeat?: (() => Promise<void>) | undefined;
+  // Stops the scenario, e.g. once the client disconnects
+  signal?: AbortSignal | undefined;
+}
+
+const STEP_PATTERN = /^(normal|stall)\s+(\d+(?:\.\d+)?)\s*(ms|s)$|^burst\s+(\d+)(?:\s+chunks?)?$/;
+
+/**
+ * Parses a timeline such as "normal 2s, stall 5s, burst 50 chunks, stall
+ * 1s". Durations are in s or ms; steps run in order, after which the stream
+ * continues normally.
+ */
+export function parseTimeline(timeline: string): ScenarioStep[] {
+  const steps = timeline
+    .split(',')
+    .map((part) => part.trim().toLowerCase())
+    .filter((part) => part !== '')
+    .map((part): ScenarioStep => {
+      const match = STEP_PATTERN.exec(part);
+      if (!match) {
+        throw new InvalidRequestError(
+          `Invalid scenario step "${part}": expected normal <duration>, stall <duration> or burst <n> chunks`,
+          'timeline'
+        );
+      }
+      const [, kind, amount, unit, chunks] = match;
+      if (chunks !== undefined) {
+        return { kind: 'burst', chunks: Number(chunks) };
+      }
+      const ms = Math.round(Number(amount) * (unit === 's' ? 1000 : 1));
+      return { kind: kind === 'stall' ? 'stall' : 'normal', ms };
+    });
+
+  if (steps.length === 0) {
+    throw new InvalidRequestError('A scenario timeline needs at least one step', 'timeline');
+  }
+  return steps;
+}
+
+// Validates scenarios from the --stream-scenarios file
+export function parseStreamScenarioConfig(value: unknown): StreamScenarioConfig {
+  if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+    throw new InvalidRequestError('Stream scenarios must be an object');
+  }
+  const { scenarios, heartbeatMs, ...rest } = value as Record<string, unknown>;
+
+  const unknownKey = Object.keys(rest)[0];
+  if (unknownKey !== undefined) {
+    throw new InvalidRequestError(`Unknown stream scenario setting: ${unknownKey}`, unknownKey);
+  }
+
+  if (typeof scenarios !== 'object' || scenarios === null || Array.isArray(scenarios)) {
+    throw new InvalidRequestError('scenarios must map names to timelines', 'scenarios');
+  }
+  for (const [name, timeline] of Object.entries(scenarios)) {
+    if (typeof timeline !== 'string') {
+      throw new InvalidRequestError(`scenarios.${name} must be a timeline string`, `scenarios.${name}`);
+    }
+    parseTimeline(timeline);
+  }
+
+  if (heartbeatMs !== undefined && !(Number.isInteger(heartbeatMs) && (heartbeatMs as number) > 0)) {
+    throw new InvalidRequestError('heartbeatMs must be a positive integer', 'heartbeatMs');
+  }
+
+  return {
+    scenarios: scenarios as Record<string, string>,
+    heartbeatMs: heartbeatMs as number | undefined,
+  };
+}
+
+/**
+ * Replays chunks from source under a scenario's timeline. Time is measured
+ * from the first chunk requested; once the timeline is over, or the signal
+ * aborts mid-stall, the rest of the source passes straight through.
+ */
+export async function* runScenario<T>(
+  source: AsyncIterator<T>,
+  steps: ScenarioStep[],
+  options: ScenarioOptions = {}
+): AsyncGenerator<T> {
+  const clock = options.clock ?? systemClock;
+
+  for (const step of steps) {
+    if (step.kind === 'normal') {
+      const end = clock.now() + step.ms;
+      while (clock.now() < end) {
+        const next = await source.next();
+        if (next.done) {
+          return;
+        }
+        yield next.value;
+      }
+    } else if (step.kind === 'stall') {
+      const end = clock.now() + step.ms;
+      for (let remaining = step.ms; remaining > 0 && !options.signal?.aborted; remaining = end - clock.now()) {
+        const wait = options.heartbeatMs === undefined ? remaining : Math.min(remaining, options.heartbeatMs);
+        await clock.sleep(wait, options.signal);
+        if (end - clock.now() > 0 && !options.signal?.aborted) {
+          await options.onHeartbeat?.();
+        }
+      }
+    } else {
+      // Pulled before any is yielded, so they reach the client together
+      const burst: T[] = [];
+      while (burst.length < step.chunks) {
+        const next = await source.next();
+        if (next.done) {
+          yield* burst;
+          return;
+        }
+        burst.push(next.value);
+      }
+      yield* burst;
+    }
+  }
+
+  for (let next = await source.next(); !next.done; next = await source.next()) {
+    yield next.value;
+  }
+}
+
+export interface StreamScenarioStats {
+  timeline: string;
+  // Requests naming the scenario since it was defined
+  requests: number;
+}
+
+/**
+ * The named scenarios requests can pick with X-TeenyTiny-Scenario, from the
+ * config file and the admin API.
+ */
+export class StreamScenarios {
+  private scenarios = new Map<string, { timeline: string; steps: ScenarioStep[]; requests: number }>();
+  readonly heartbeatMs: number | undefined;
+
+  constructor(config: StreamScenarioConfig = { scenarios: {} }) {
+    this.heartbeatMs = config.heartbeatMs;
+    for (const [name, timeline] of Object.entries(config.scenarios)) {
+      this.define(name, timeline);
+    }
+  }
+
+  // Adds or replaces a scenario, throwing if the timeline is malformed
+  define(name: string, timeline: string): void {
+    this.scenarios.set(name, { timeline, steps: parseTimeline(timeline), requests: 0 });
+  }
+
+  remove(name: string): boolean {
+    return this.scenarios.delete(name);
+  }
+
+  // The scenario's steps, counting one request under it; throws naming the
+  // header when there's no such scenario
+  use(name: string): ScenarioStep[] {
+    const scenario = this.scenarios.get(name);
+    if (!scenario) {
+      throw new InvalidRequestError(`Unknown stream scenario: ${name}`, SCENARIO_HEADER);
+    }
+    scenario.requests++;
+    return scenario.steps;
+  }
+
+  stats(): Record<string, StreamScenarioStats> {
+    return Object.fromEntries(
+      [...this.scenarios].map(([name, { timeline, requests }]) => [name, { timeline, requests }])
+    );
+  }
+}
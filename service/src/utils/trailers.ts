@@ -0,0 +1,31 @@
+import type { Context } from 'hono';
+import type { ChatCompletionUsage } from '../openai-protocol/types.js';
+
+// Trailers carrying usage after a streamed completion, declared up front in
+// the Trailer header
+export const USAGE_TRAILERS = ['X-Usage-Prompt-Tokens', 'X-Usage-Completion-Tokens', 'X-Usage-Total-Tokens'];
+
+export function usageTrailers(usage: ChatCompletionUsage): Record<string, string> {
+  return {
+    'X-Usage-Prompt-Tokens': String(usage.prompt_tokens),
+    'X-Usage-Completion-Tokens': String(usage.completion_tokens),
+    'X-Usage-Total-Tokens': String(usage.total_tokens),
+  };
+}
+
+/**
+ * Adds trailers to a response whose body is still being written. The Fetch
+ * API has no way to send them, so this only works on the Node.js server,
+ * through the raw response @hono/node-server exposes as `c.env.outgoing`,
+ * and only when the body is chunked (HTTP/1.1) or on HTTP/2. Elsewhere it
+ * does nothing and returns false.
+ */
+export function sendTrailers(c: Context, trailers: Record<string, string>): boolean {
+  const env = c.env as { outgoing?: { addTrailers?: unknown } } | undefined;
+  const outgoing = env?.outgoing;
+  if (!outgoing || typeof outgoing.addTrailers !== 'function') {
+    return false;
+  }
+  outgoing.addTrailers(trailers);
+  return true;
+}
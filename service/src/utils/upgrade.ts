@@ -0,0 +1,85 @@
+import { spawn } from 'child_process';
+import type { ChildProcess } from 'child_process';
+import type { Server } from 'net';
+
+// Set for a process started by startUpgrade, which then takes its parent's
+// listening socket instead of binding its own
+export const UPGRADE_ENV = 'TEENYTINY_UPGRADE';
+
+// Messages over the IPC channel between the old and new process: the new one
+// says when it can receive the socket, the old one sends it, and the new one
+// confirms once it's accepting connections on it
+type UpgradeMessage = { type: 'waiting' } | { type: 'listener' } | { type: 'ready' };
+
+/**
+ * Starts a new copy of this process, with the same Node.js options and
+ * arguments so an updated build on disk is picked up, and hands it the
+ * listening socket. Resolves once the copy is accepting connections; both
+ * processes accept on the socket until the caller stops this one's server.
+ * Rejects, stopping the copy, if it exits or isn't ready in time, leaving
+ * this process serving as before.
+ */
+export function startUpgrade(listener: Server, timeoutMs: number = 30_000): Promise<ChildProcess> {
+  const child = spawn(process.execPath, [...process.execArgv, ...process.argv.slice(1)], {
+    stdio: ['inherit', 'inherit', 'inherit', 'ipc'],
+    env: { ...process.env, [UPGRADE_ENV]: '1' },
+  });
+
+  return new Promise((resolve, reject) => {
+    const cleanUp = () => {
+      clearTimeout(timer);
+      child.off('message', onMessage);
+      child.off('exit', onExit);
+      child.off('error', fail);
+    };
+    const fail = (error: Error) => {
+      cleanUp();
+      child.kill();
+      reject(error);
+    };
+    const onExit = (code: number | null, signal: string | null) =>
+      fail(new Error(`New process exited (${signal ?? `code ${code}`}) before taking over`));
+    const onMessage = (message: unknown) => {
+      const { type } = message as UpgradeMessage;
+      if (type === 'waiting') {
+        child.send({ type: 'listener' }, listener);
+      } else if (type === 'ready') {
+        cleanUp();
+        child.unref();
+        resolve(child);
+      }
+    };
+    const timer = setTimeout(() => fail(new Error(`New process not ready after ${timeoutMs}ms`)), timeoutMs);
+
+    child.on('message', onMessage);
+    child.on('exit', onExit);
+    child.on('error', fail);
+  });
+}
+
+// In a process started by startUpgrade, receives the old process's listening
+// socket; undefined in any other process
+export function inheritedListener(): Promise<Server | undefined> {
+  const send = process.send?.bind(process);
+  if (process.env[UPGRADE_ENV] !== '1' || !send) {
+    return Promise.resolve(undefined);
+  }
+
+  return new Promise((resolve) => {
+    const onMessage = (message: unknown, handle: unknown) => {
+      if ((message as UpgradeMessage).type === 'listener') {
+        process.off('message', onMessage);
+        resolve(handle as Server);
+      }
+    };
+    process.on('message', onMessage);
+    send({ type: 'waiting' });
+  });
+}
+
+// Tells the old process this one is accepting connections, so it can drain
+// and exit, then cuts the IPC channel so this one can be upgraded in turn
+export function confirmUpgrade(): void {
+  delete process.env[UPGRADE_ENV];
+  process.send?.({ type: 'ready' }, undefined, undefined, () => process.disconnect?.());
+}
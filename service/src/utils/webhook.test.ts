@@ -0,0 +1,107 @@
+import { describe, it, expect } from "vitest";
+import { createHmac } from "crypto";
+import { matchesWebhookFilter, signWebhookBody, WebhookNotifier } from "./webhook.js";
+import type { CompletionEvent } from "./webhook.js";
+import { Logger } from "./logger.js";
+
+const event = (overrides: Partial<CompletionEvent> = {}): CompletionEvent => ({
+  event: "chat.completion",
+  request_id: "req-1",
+  key_label: "tt-tes***",
+  model: "echo",
+  streaming: false,
+  status: 200,
+  prompt_tokens: 1,
+  completion_tokens: 2,
+  total_tokens: 3,
+  duration_ms: 4,
+  timestamp: "2024-01-01T00:00:00.000Z",
+  ...overrides,
+});
+
+// Records each call and answers with the given statuses in turn
+function fakeFetch(...statuses: number[]) {
+  const calls: RequestInit[] = [];
+  const fetchImpl = async (_url: string | URL | Request, init?: RequestInit) => {
+    calls.push(init ?? {});
+    const status = statuses.shift() ?? 200;
+    if (status === 0) {
+      throw new Error("connection refused");
+    }
+    return new Response(null, { status });
+  };
+  return { calls, fetchImpl: fetchImpl as typeof fetch };
+}
+
+describe("matchesWebhookFilter", () => {
+  it("should pass everything without a filter", () => {
+    expect(matchesWebhookFilter({}, event())).toBe(true);
+  });
+
+  it("should restrict events to errors and to listed models", () => {
+    expect(matchesWebhookFilter({ errorsOnly: true }, event())).toBe(false);
+    expect(matchesWebhookFilter({ errorsOnly: true }, event({ status: 429 }))).toBe(true);
+    expect(matchesWebhookFilter({ models: ["eliza"] }, event())).toBe(false);
+    expect(matchesWebhookFilter({ models: ["echo"] }, event())).toBe(true);
+    expect(matchesWebhookFilter({ models: ["echo"] }, event({ model: null }))).toBe(false);
+  });
+});
+
+describe("WebhookNotifier", () => {
+  it("should sign bodies with HMAC-SHA256 of the secret", async () => {
+    const { calls, fetchImpl } = fakeFetch();
+    const notifier = new WebhookNotifier({ url: "http://hook", secret: "s3cret" }, new Logger(0), fetchImpl);
+
+    notifier.notify(event());
+    await notifier.settled();
+
+    const body = calls[0]!.body as string;
+    const expected = createHmac("sha256", "s3cret").update(body).digest("hex");
+    expect((calls[0]!.headers as Record<string, string>)["X-TeenyTiny-Signature"]).toBe(`sha256=${expected}`);
+    expect(await signWebhookBody("s3cret", body)).toBe(expected);
+    expect(JSON.parse(body)).toEqual(event());
+  });
+
+  it("should retry failed deliveries, then count and log the failure", async () => {
+    const { calls, fetchImpl } = fakeFetch(500, 0, 503, 0, 200);
+    const logger = new Logger(10, { write: () => {} });
+    const notifier = new WebhookNotifier(
+      { url: "http://hook", maxAttempts: 3, retryDelayMs: 1 },
+      logger,
+      fetchImpl,
+    );
+
+    notifier.notify(event({ request_id: "req-1" }));
+    notifier.notify(event({ request_id: "req-2" }));
+    await notifier.settled();
+
+    expect(calls).toHaveLength(5);
+    expect(notifier.stats()).toEqual({ queued: 0, delivered: 1, failed: 1, dropped: 0 });
+    expect(logger.recent()).toContainEqual(
+      expect.objectContaining({ message: "Webhook delivery failed", request_id: "req-1", error: "HTTP 503" }),
+    );
+  });
+
+  it("should drop notifications beyond the queue bound", async () => {
+    const { fetchImpl } = fakeFetch();
+    const notifier = new WebhookNotifier({ url: "http://hook", maxQueued: 2 }, new Logger(0, { write: () => {} }), fetchImpl);
+
+    for (let i = 0; i < 5; i++) {
+      notifier.notify(event());
+    }
+    await notifier.settled();
+
+    expect(notifier.stats()).toEqual({ queued: 0, delivered: 2, failed: 0, dropped: 3 });
+  });
+
+  it("should skip filtered events entirely", async () => {
+    const { calls, fetchImpl } = fakeFetch();
+    const notifier = new WebhookNotifier({ url: "http://hook", filter: { errorsOnly: true } }, new Logger(0), fetchImpl);
+
+    notifier.notify(event());
+    await notifier.settled();
+
+    expect(calls).toHaveLength(0);
+    expect(notifier.stats().delivered).toBe(0);
+  });
+});
@@ -0,0 +1,180 @@
+import { Logger } from './logger.js';
+import { sleep } from './sleep.js';
+
+export interface WebhookFilter {
+  // Only notify about responses with an error status
+  errorsOnly?: boolean | undefined;
+  // Only notify about completions for these models
+  models?: string[] | undefined;
+}
+
+export interface WebhookConfig {
+  url: string;
+  // Signs each body with HMAC-SHA256 in the X-TeenyTiny-Signature header
+  secret?: string | undefined;
+  filter?: WebhookFilter | undefined;
+  // Notifications waiting for delivery; beyond this new ones are dropped
+  maxQueued?: number | undefined;
+  // Deliveries tried per notification before giving up
+  maxAttempts?: number | undefined;
+  // Wait before the first retry, doubling for each one after
+  retryDelayMs?: number | undefined;
+  // Per attempt
+  timeoutMs?: number | undefined;
+}
+
+export interface CompletionEvent {
+  event: 'chat.completion';
+  request_id: string;
+  // Masked API key
+  key_label: string;
+  // From the OpenAI-Organization and OpenAI-Project headers, when sent
+  organization?: string;
+  project?: string;
+  // Unknown when the request was rejected before naming a valid model
+  model: string | null;
+  // Stream scenario the request ran under, when it named one
+  scenario?: string;
+  streaming: boolean;
+  status: number;
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+  duration_ms: number;
+  timestamp: string;
+}
+
+export interface WebhookStats {
+  queued: number;
+  delivered: number;
+  failed: number;
+  dropped: number;
+}
+
+export const SIGNATURE_HEADER = 'X-TeenyTiny-Signature';
+
+// Whether an event passes the filter
+export function matchesWebhookFilter(filter: WebhookFilter, event: CompletionEvent): boolean {
+  if (filter.errorsOnly && event.status < 400) {
+    return false;
+  }
+  if (filter.models && (event.model === null || !filter.models.includes(event.model))) {
+    return false;
+  }
+  return true;
+}
+
+// Hex HMAC-SHA256 of a body, as sent in the signature header after "sha256="
+export async function signWebhookBody(secret: string, body: string): Promise<string> {
+  const encoder = new TextEncoder();
+  const key = await globalThis.crypto.subtle.importKey(
+    'raw',
+    encoder.encode(secret),
+    { name: 'HMAC', hash: 'SHA-256' },
+    false,
+    ['sign']
+  );
+  const signature = await globalThis.crypto.subtle.sign('HMAC', key, encoder.encode(body));
+  return Array.from(new Uint8Array(signature), (byte) => byte.toString(16).padStart(2, '0')).join('');
+}
+
+/**
+ * Posts completion events to a webhook in the background.
+ *
+ * notify() only queues, so requests never wait on the receiver. Events are
+ * delivered one at a time in order, retried with backoff on network errors
+ * and non-2xx responses; ones that still fail, or that arrive while the
+ * queue is full, are logged and counted, never surfaced to clients.
+ */
+export class WebhookNotifier {
+  private queue: CompletionEvent[] = [];
+  private counts = { delivered: 0, failed: 0, dropped: 0 };
+  private draining = false;
+  private drained: Promise<void> = Promise.resolve();
+
+  constructor(
+    private config: WebhookConfig,
+    private logger: Logger = new Logger(),
+    private fetchImpl: typeof fetch = (input, init) => globalThis.fetch(input, init)
+  ) {}
+
+  notify(event: CompletionEvent): void {
+    if (!matchesWebhookFilter(this.config.filter ?? {}, event)) {
+      return;
+    }
+    if (this.queue.length >= (this.config.maxQueued ?? 100)) {
+      this.counts.dropped++;
+      this.logger.warn('Webhook queue full, notification dropped', { request_id: event.request_id });
+      return;
+    }
+
+    this.queue.push(event);
+    if (!this.draining) {
+      this.draining = true;
+      this.drained = this.drain();
+    }
+  }
+
+  stats(): WebhookStats {
+    return { queued: this.queue.length, ...this.counts };
+  }
+
+  // Resolves once everything queued so far has been delivered or given up on
+  async settled(): Promise<void> {
+    while (this.draining) {
+      await this.drained;
+    }
+  }
+
+  private async drain(): Promise<void> {
+    try {
+      for (let event = this.queue[0]; event; event = this.queue[0]) {
+        const error = await this.deliver(event);
+        this.queue.shift();
+        if (error === undefined) {
+          this.counts.delivered++;
+        } else {
+          this.counts.failed++;
+          this.logger.error('Webhook delivery failed', { request_id: event.request_id, error });
+        }
+      }
+    } finally {
+      // Cleared in the same turn the queue is found empty, so a notify()
+      // right after always starts a new drain
+      this.draining = false;
+    }
+  }
+
+  // Tries each attempt in turn, returning the last error if none succeeded
+  private async deliver(event: CompletionEvent): Promise<string | undefined> {
+    const body = JSON.stringify(event);
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    if (this.config.secret !== undefined) {
+      headers[SIGNATURE_HEADER] = `sha256=${await signWebhookBody(this.config.secret, body)}`;
+    }
+
+    const attempts = this.config.maxAttempts ?? 3;
+    let error = '';
+    for (let attempt = 0; attempt < attempts; attempt++) {
+      if (attempt > 0) {
+        await sleep((this.config.retryDelayMs ?? 500) * 2 ** (attempt - 1));
+      }
+      try {
+        const response = await this.fetchImpl(this.config.url, {
+          method: 'POST',
+          headers,
+          body,
+          signal: AbortSignal.timeout(this.config.timeoutMs ?? 5000),
+        });
+        await response.body?.cancel();
+        if (response.ok) {
+          return undefined;
+        }
+        error = `HTTP ${response.status}`;
+      } catch (cause) {
+        error = cause instanceof Error ? cause.message : String(cause);
+      }
+    }
+    return error;
+  }
+}
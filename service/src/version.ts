@@ -0,0 +1,3 @@
+// Server build version, kept in step with package.json; part of every
+// model's system_fingerprint
+export const SERVER_VERSION = '1.0.0';
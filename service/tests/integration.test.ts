@@ -1,6 +1,27 @@
 import { describe, it, expect, beforeAll, afterAll } from 'vitest';
 import { createApp } from '../src/app.js';
+import { CHECKS, parseSSEData } from '../src/conformance/conformance.js';
+import { AuditLogger } from '../src/utils/audit-log.js';
+import { Logger } from '../src/utils/logger.js';
+import { SecurityLogger, verifySecurityLog } from '../src/utils/security-log.js';
+import { FileAuditSink } from '../src/utils/file-audit-sink.js';
+import { mkdtemp, readFile, rm } from 'fs/promises';
+import { createServer, request as httpRequest } from 'http';
+import { createServer as createNetServer } from 'net';
+import type { AddressInfo } from 'net';
+import { spawn } from 'child_process';
+import { fileURLToPath } from 'url';
+import { createHmac } from 'crypto';
+import { serve } from '@hono/node-server';
+import { tmpdir } from 'os';
+import { join } from 'path';
 import type { ChatCompletionRequest } from '../src/types/openai.js';
+import { parseCannedModels } from '../src/models/canned-models.js';
+import { parseVirtualModels } from '../src/models/virtual-models.js';
+import { parseResponseMap } from '../src/models/responses-model.js';
+import { DEFAULT_CONTENT_FILTER_RESULTS } from '../src/utils/content-filter.js';
+import { EchoModel } from '../src/models/echo-model.js';
+import type { Model } from '../src/models/model.js';
 
 const testAPIKey = 'tt-test-key-123';
 
@@ -15,326 +36,5247 @@ describe('TeenyTiny API Integration Tests', () => {
     });
   });
 
+  describe('Zero-Downtime Upgrades', () => {
+    const freePort = () =>
+      new Promise<number>((resolve) => {
+        const probe = createNetServer().listen(0, '127.0.0.1', () => {
+          const { port } = probe.address() as AddressInfo;
+          probe.close(() => resolve(port));
+        });
+      });
+
+    // Streams a short countdown on a fresh connection, resolving with whether
+    // it completed and, if not, what came back instead
+    const streamCountdown = (port: number) =>
+      new Promise<{ ok: boolean; error?: string }>((resolve) => {
+        const req = httpRequest(
+          {
+            host: '127.0.0.1',
+            port,
+            path: '/v1/chat/completions',
+            method: 'POST',
+            agent: false,
+            headers: {
+              'Authorization': `Bearer ${testAPIKey}`,
+              'Content-Type': 'application/json',
+            },
+          },
+          (res) => {
+            let body = '';
+            res.setEncoding('utf8');
+            res.on('data', (chunk) => (body += chunk));
+            res.on('end', () =>
+              resolve(res.statusCode === 200 && body.includes('data: [DONE]') ? { ok: true } : { ok: false, error: body })
+            );
+          }
+        );
+        req.on('error', (error) => resolve({ ok: false, error: error.message }));
+        req.end(
+          JSON.stringify({ model: 'countdown', messages: [{ role: 'user', content: '3' }], stream: true })
+        );
+      });
+
+    it('should hand the socket to a new process without failing a request', async () => {
+      const port = await freePort();
+      const serverPath = fileURLToPath(new URL('../src/server.ts', import.meta.url));
+      const original = spawn(
+        process.execPath,
+        ['--import', 'tsx', serverPath, '--port', String(port), '--api-key', testAPIKey, '--upgrade-socket'],
+        { stdio: ['ignore', 'pipe', 'inherit'] }
+      );
+      const exited = new Promise((resolve) => original.on('exit', resolve));
+      let output = '';
+      original.stdout.setEncoding('utf8');
+      original.stdout.on('data', (chunk) => (output += chunk));
+      const logged = async (message: string) => {
+        while (!output.includes(message)) {
+          await new Promise((resolve) => setTimeout(resolve, 50));
+        }
+      };
+
+      let newPid: number | undefined;
+      try {
+        await logged('Server started successfully');
+
+        // Continuous low-rate load, each request streaming for ~600ms, across
+        // the whole handoff
+        const results: Promise<{ ok: boolean; error?: string }>[] = [];
+        const load = setInterval(() => results.push(streamCountdown(port)), 50);
+
+        await new Promise((resolve) => setTimeout(resolve, 500));
+        original.kill('SIGUSR2');
+        await logged('Upgrade: took over the listening socket');
+        await logged('new_pid');
+        newPid = Number(/"new_pid":(\d+)/.exec(output)?.[1]);
+        expect(await exited).toBe(0);
+        await new Promise((resolve) => setTimeout(resolve, 500));
+        clearInterval(load);
+
+        const outcomes = await Promise.all(results);
+        expect(outcomes.length).toBeGreaterThan(20);
+        expect(outcomes.filter((outcome) => !outcome.ok)).toEqual([]);
+        expect(output.indexOf('Upgrade: drained, exiting')).toBeGreaterThan(
+          output.indexOf('Upgrade: new process accepting connections')
+        );
+      } finally {
+        original.kill();
+        if (newPid) {
+          process.kill(newPid);
+        }
+      }
+    }, 30_000);
+  });
+
+  describe('Ready Signal', () => {
+    it('should write the ready file once requests succeed, with the bound port', async () => {
+      const dir = await mkdtemp(join(tmpdir(), 'teenytiny-ready-'));
+      const readyFile = join(dir, 'ready.json');
+      const serverPath = fileURLToPath(new URL('../src/server.ts', import.meta.url));
+      const server = spawn(
+        process.execPath,
+        ['--import', 'tsx', serverPath, '--port', '0', '--api-key', testAPIKey, '--ready-file', readyFile],
+        { stdio: ['ignore', 'pipe', 'inherit'] }
+      );
+      let output = '';
+      server.stdout.setEncoding('utf8');
+      server.stdout.on('data', (chunk) => (output += chunk));
+
+      try {
+        let contents: string | undefined;
+        while (contents === undefined) {
+          contents = await readFile(readyFile, 'utf8').catch(() => undefined);
+          await new Promise((resolve) => setTimeout(resolve, 20));
+        }
+        const ready = JSON.parse(contents);
+
+        // Already serving by the time the file appears
+        const [address] = ready.addresses;
+        expect(address).toMatch(/^http:\/\/localhost:\d+$/);
+        expect(address).not.toBe('http://localhost:0');
+        expect((await fetch(`${address}/health`)).status).toBe(200);
+
+        expect(ready.models).toContain('echo');
+        expect(ready.auth).toEqual({ mode: 'api_key', api_key: expect.any(String), constant_time: false });
+        expect(ready.auth.api_key).not.toBe(testAPIKey);
+        expect(ready.pid).toBe(server.pid);
+
+        // The startup line carries the same details
+        const started = output
+          .split('\n')
+          .filter((line) => line.includes('Server started successfully'))
+          .map((line) => JSON.parse(line));
+        expect(started).toHaveLength(1);
+        expect(started[0]).toMatchObject({ listeners: ready.addresses, models: ready.models, auth: ready.auth });
+      } finally {
+        server.kill();
+        await rm(dir, { recursive: true, force: true });
+      }
+    }, 30_000);
+  });
+
+  describe('Startup Configuration', () => {
+    it('should refuse to start, naming every invalid environment variable', async () => {
+      const serverPath = fileURLToPath(new URL('../src/server.ts', import.meta.url));
+      const server = spawn(process.execPath, ['--import', 'tsx', serverPath, '--port', '0'], {
+        env: {
+          ...process.env,
+          TEENYTINY_MAX_CONCURRENT: 'lots',
+          TEENYTINY_CACHE_TTL: '-1',
+          TEENYTINY_ADMIN: 'yes',
+        },
+        stdio: ['ignore', 'ignore', 'pipe'],
+      });
+      let errors = '';
+      server.stderr.setEncoding('utf8');
+      server.stderr.on('data', (chunk) => (errors += chunk));
+
+      const code = await new Promise((resolve) => server.on('exit', resolve));
+
+      expect(code).toBe(1);
+      expect(errors).toContain('TEENYTINY_MAX_CONCURRENT requires a positive integer (got "lots")');
+      expect(errors).toContain('TEENYTINY_CACHE_TTL requires a positive number of seconds (got "-1")');
+      expect(errors).toContain('TEENYTINY_ADMIN requires true or false (got "yes")');
+    }, 30_000);
+  });
+
+  describe('Model Health Checks', () => {
+    class FlakyModel implements Model {
+      healthy = false;
+
+      async *process(input: string): AsyncGenerator<string> {
+        yield input;
+      }
+
+      async checkHealth(): Promise<void> {
+        if (!this.healthy) {
+          throw new Error('upstream unreachable');
+        }
+      }
+    }
+
+    const chat = (target: ReturnType<typeof createApp>) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'flaky', messages: [{ role: 'user', content: 'hi' }] }),
+      });
+
+    const modelStatus = async (target: ReturnType<typeof createApp>) => {
+      const res = await target.request('/v1/models', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+      const data = await res.json();
+      return data.data.find((model: { id: string }) => model.id === 'flaky')?.status;
+    };
+
+    const waitForStatus = async (target: ReturnType<typeof createApp>, status: string) => {
+      for (let attempt = 0; attempt < 100 && (await modelStatus(target)) !== status; attempt++) {
+        await new Promise((resolve) => setTimeout(resolve, 10));
+      }
+      expect(await modelStatus(target)).toBe(status);
+    };
+
+    it('should report, refuse and then restore a model whose check fails', async () => {
+      const flaky = new FlakyModel();
+      const healthApp = createApp({
+        auth: { apiKey: testAPIKey },
+        models: [{ id: 'flaky', model: flaky }],
+        modelHealth: { intervalMs: 20, disableUnhealthy: true },
+      });
+
+      await waitForStatus(healthApp, 'degraded');
+
+      const deep = await healthApp.request('/health/deep');
+      expect(deep.status).toBe(200);
+      expect(await deep.json()).toMatchObject({
+        status: 'degraded',
+        checks: {
+          generation: { status: 'ok' },
+          models: { flaky: { status: 'degraded', error: 'upstream unreachable' } },
+        },
+      });
+
+      const refused = await chat(healthApp);
+      expect(refused.status).toBe(503);
+      expect((await refused.json()).error).toMatchObject({ code: 'model_unavailable', param: 'model' });
+
+      flaky.healthy = true;
+      await waitForStatus(healthApp, 'ok');
+
+      const res = await chat(healthApp);
+      expect(res.status).toBe(200);
+      expect((await res.json()).choices[0].message.content).toBe('hi');
+    });
+
+    it('should leave models without a check unreported', async () => {
+      const res = await app.request('/v1/models', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+      const data = await res.json();
+
+      expect(data.data.every((model: { status?: string }) => model.status === undefined)).toBe(true);
+    });
+  });
+
+  describe('Canned Models', () => {
+    let cannedApp: ReturnType<typeof createApp>;
+
+    beforeAll(async () => {
+      const file = fileURLToPath(new URL('./testdata/canned-models.json', import.meta.url));
+      cannedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        cannedModels: parseCannedModels(JSON.parse(await readFile(file, 'utf8'))),
+      });
+    });
+
+    const post = (path: string, body: unknown) =>
+      cannedApp.request(path, {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+      });
+
+    it('should list the declared ids alongside the built-in models', async () => {
+      const res = await cannedApp.request('/v1/models', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+      const data = await res.json();
+
+      for (const id of ['gpt-3.5-turbo', 'gpt-4', 'text-embedding-3-small']) {
+        expect(data.data).toContainEqual(expect.objectContaining({ id, object: 'model', owned_by: 'openai' }));
+      }
+      expect(data.data).toContainEqual(expect.objectContaining({ id: 'echo', owned_by: 'teenytiny-ai' }));
+    });
+
+    it('should answer chat completions on chat models with echo', async () => {
+      for (const model of ['gpt-3.5-turbo', 'gpt-4']) {
+        const res = await post('/v1/chat/completions', { model, messages: [{ role: 'user', content: 'Hello' }] });
+        expect(res.status).toBe(200);
+
+        const data = await res.json();
+        expect(data.model).toBe(model);
+        expect(data.choices[0].message.content).toBe('Hello');
+      }
+    });
+
+    it('should answer embeddings on embedding models only', async () => {
+      const res = await post('/v1/embeddings', { model: 'text-embedding-3-small', input: 'Hello' });
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.model).toBe('text-embedding-3-small');
+      expect(data.data[0].embedding).toHaveLength(8);
+
+      const chatOnly = await post('/v1/embeddings', { model: 'gpt-4', input: 'Hello' });
+      expect(chatOnly.status).toBe(400);
+    });
+  });
+
+  describe('Virtual Models', () => {
+    let virtualApp: ReturnType<typeof createApp>;
+
+    beforeAll(async () => {
+      const file = fileURLToPath(new URL('./testdata/virtual-models.json', import.meta.url));
+      virtualApp = createApp({
+        auth: { apiKey: testAPIKey },
+        reflectParameters: true,
+        virtualModels: parseVirtualModels(JSON.parse(await readFile(file, 'utf8'))),
+      });
+    });
+
+    const complete = (target: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+      });
+
+    it('should list virtual models alongside the built-in ones', async () => {
+      const res = await virtualApp.request('/v1/models', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+      const ids = (await res.json()).data.map((model: { id: string }) => model.id);
+
+      expect(ids).toEqual(expect.arrayContaining(['echo', 'echo-loud', 'pirate', 'system-echo']));
+    });
+
+    it('should transform the base model\'s output', async () => {
+      const data = await (await complete(virtualApp, {
+        model: 'echo-loud',
+        messages: [{ role: 'user', content: '  make some noise  ' }],
+      })).json();
+
+      expect(data.choices[0].message.content).toBe('MAKE SOME NOISE');
+      expect(data.model).toBe('echo-loud');
+    });
+
+    it('should cut output off at the forced max_tokens, whatever the request asks for', async () => {
+      const data = await (await complete(virtualApp, {
+        model: 'echo-loud',
+        messages: [{ role: 'user', content: 'a'.repeat(1000) }],
+        max_tokens: 500,
+      })).json();
+
+      expect(data.choices[0].message.content).toBe('A'.repeat(200));
+      expect(data.choices[0].finish_reason).toBe('length');
+      expect(data.x_parameters.max_tokens).toBe(50);
+    });
+
+    it('should stream transformed output', async () => {
+      const res = await complete(virtualApp, {
+        model: 'pirate',
+        messages: [{ role: 'user', content: 'Hello' }],
+        stream: true,
+      });
+      const content = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0]?.delta.content ?? '')
+        .join('');
+
+      expect(content).toBe('Arr! You are a pirate. Yo ho!');
+    });
+
+    it('should send the default system prompt only when the request has none', async () => {
+      const reply = async (messages: unknown[]) =>
+        (await (await complete(virtualApp, { model: 'pirate', messages })).json());
+
+      const defaulted = await reply([{ role: 'user', content: 'Hello' }]);
+      expect(defaulted.choices[0].message.content).toBe('Arr! You are a pirate. Yo ho!');
+      expect(defaulted.x_parameters.temperature).toBe(0.3);
+
+      const own = await reply([
+        { role: 'system', content: 'You are a parrot.' },
+        { role: 'user', content: 'Hello' },
+      ]);
+      expect(own.choices[0].message.content).toBe('Arr! You are a parrot. Yo ho!');
+    });
+
+    it('should leave the base model unchanged', async () => {
+      const data = await (await complete(virtualApp, {
+        model: 'echo',
+        messages: [{ role: 'user', content: 'quiet please' }],
+      })).json();
+
+      expect(data.choices[0].message.content).toBe('quiet please');
+    });
+
+    it('should stack virtual models, inheriting what the outer one doesn\'t set', async () => {
+      const stacked = createApp({
+        auth: { apiKey: testAPIKey },
+        virtualModels: [
+          { id: 'pirate-shouting', base: 'pirate', output: ['uppercase'] },
+          ...parseVirtualModels(JSON.parse(await readFile(
+            fileURLToPath(new URL('./testdata/virtual-models.json', import.meta.url)),
+            'utf8',
+          ))),
+        ],
+      });
+
+      const data = await (await complete(stacked, {
+        model: 'pirate-shouting',
+        messages: [{ role: 'user', content: 'Hello' }],
+      })).json();
+
+      expect(data.choices[0].message.content).toBe('ARR! YOU ARE A PIRATE. YO HO!');
+    });
+
+    it('should refuse to start with a cycle or an unknown base', () => {
+      expect(() => createApp({
+        auth: { apiKey: testAPIKey },
+        virtualModels: [{ id: 'a', base: 'b' }, { id: 'b', base: 'a' }],
+      })).toThrow('Virtual models form a cycle: a -> b -> a');
+      expect(() => createApp({
+        auth: { apiKey: testAPIKey },
+        virtualModels: [{ id: 'ghost', base: 'nope' }],
+      })).toThrow('Virtual model ghost is built on unknown model: nope');
+    });
+  });
+
+  describe('Response Map', () => {
+    const load = async () => {
+      const file = fileURLToPath(new URL('./testdata/responses.json', import.meta.url));
+      return parseResponseMap(JSON.parse(await readFile(file, 'utf8')));
+    };
+    const ask = (target: ReturnType<typeof createApp>, content: string, stream = false) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'responses', messages: [{ role: 'user', content }], stream }),
+      });
+
+    it('should answer a mapped prompt with its response', async () => {
+      const mappedApp = createApp({ auth: { apiKey: testAPIKey }, responses: await load() });
+
+      const res = await ask(mappedApp, 'What is the capital of France?');
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('The capital of France is Paris.');
+      expect(data.choices[0].finish_reason).toBe('stop');
+
+      const streamed = parseSSEData(await (await ask(mappedApp, 'Write a haiku about tests', true)).text())
+        .filter((event) => event !== '[DONE]')
+        .map((event) => JSON.parse(event).choices[0]?.delta.content ?? '')
+        .join('');
+      expect(streamed).toBe('Green checks in a row\nfixtures hold the world steady\nno flakes fall today');
+    });
+
+    it('should echo prompts missing from the map', async () => {
+      const mappedApp = createApp({ auth: { apiKey: testAPIKey }, responses: await load() });
+
+      const data = await (await ask(mappedApp, 'What is the capital of Spain?')).json();
+      expect(data.choices[0].message.content).toBe('What is the capital of Spain?');
+    });
+
+    it('should reject prompts missing from the map with the error fallback', async () => {
+      const mappedApp = createApp({ auth: { apiKey: testAPIKey }, responses: await load(), responsesFallback: 'error' });
+
+      const res = await ask(mappedApp, 'what is the capital of france?');
+      expect(res.status).toBe(400);
+      expect((await res.json()).error).toMatchObject({ type: 'invalid_request_error', param: 'messages' });
+      expect((await ask(mappedApp, 'What is the capital of France?')).status).toBe(200);
+    });
+  });
+
+  describe('Stream Scenarios', () => {
+    let scenarioApp: ReturnType<typeof createApp>;
+    let now = 0;
+
+    beforeAll(() => {
+      scenarioApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        streamScenarios: { scenarios: { 'lag-spike': 'stall 5s, burst 50 chunks' }, heartbeatMs: 2000 },
+        // Stalls pass instantly, moving this clock on
+        scenarioClock: {
+          now: () => now,
+          sleep: async (ms) => {
+            now += ms;
+          },
+        },
+      });
+    });
+
+    const headers = { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' };
+    const streamWith = (scenario: string, target = scenarioApp) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { ...headers, 'X-TeenyTiny-Scenario': scenario },
+        body: JSON.stringify({ model: 'echo', stream: true, messages: [{ role: 'user', content: 'one two three' }] }),
+      });
+
+    it('should stall with heartbeats and then deliver the whole stream', async () => {
+      const before = now;
+      const res = await streamWith('lag-spike');
+      expect(res.status).toBe(200);
+
+      const body = await res.text();
+      expect(now - before).toBe(5000);
+      expect(body.match(/^: keep-alive$/gm)).toHaveLength(2);
+      // Heartbeats come before any data, then the stream is unchanged
+      expect(body.indexOf(': keep-alive')).toBeLessThan(body.indexOf('data: '));
+      const content = body
+        .split('\n')
+        .filter((line) => line.startsWith('data: {'))
+        .map((line) => JSON.parse(line.slice(6)).choices[0]?.delta.content ?? '')
+        .join('');
+      expect(content).toBe('one two three');
+      expect(body.trimEnd().endsWith('data: [DONE]')).toBe(true);
+    });
+
+    it('should reject unknown scenarios, naming the header', async () => {
+      const res = await streamWith('calm');
+      expect(res.status).toBe(400);
+      expect((await res.json()).error).toMatchObject({
+        message: 'Unknown stream scenario: calm',
+        param: 'X-TeenyTiny-Scenario',
+      });
+    });
+
+    it('should reject the header when scenarios are not enabled', async () => {
+      const res = await streamWith('lag-spike', app);
+      expect(res.status).toBe(400);
+      expect((await res.json()).error.param).toBe('X-TeenyTiny-Scenario');
+    });
+
+    it('should define scenarios via the admin API and count requests per scenario', async () => {
+      const put = await scenarioApp.request('/admin/scenarios/hiccup', {
+        method: 'PUT',
+        headers,
+        body: JSON.stringify({ timeline: 'normal 1s, stall 250ms' }),
+      });
+      expect(put.status).toBe(200);
+      expect(await put.json()).toEqual({ name: 'hiccup', timeline: 'normal 1s, stall 250ms', requests: 0 });
+
+      expect((await streamWith('hiccup')).status).toBe(200);
+
+      const stats = await (await scenarioApp.request('/admin/scenarios', { headers })).json();
+      expect(stats.heartbeat_ms).toBe(2000);
+      expect(stats.scenarios.hiccup).toEqual({ timeline: 'normal 1s, stall 250ms', requests: 1 });
+      expect(stats.scenarios['lag-spike'].requests).toBeGreaterThan(0);
+
+      const invalid = await scenarioApp.request('/admin/scenarios/bad', {
+        method: 'PUT',
+        headers,
+        body: JSON.stringify({ timeline: 'wobble 1s' }),
+      });
+      expect(invalid.status).toBe(400);
+
+      const removed = await scenarioApp.request('/admin/scenarios/hiccup', { method: 'DELETE', headers });
+      expect(removed.status).toBe(200);
+      expect((await streamWith('hiccup')).status).toBe(400);
+    });
+  });
+
+  describe('Prompt Token Counting', () => {
+    const post = (path: string, body: unknown) =>
+      app.request(path, {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+      });
+
+    it('should count the prompt tokens a completion of the same messages reports', async () => {
+      const request = {
+        model: 'echo',
+        messages: [
+          { role: 'system', content: 'You are a terse assistant.' },
+          { role: 'user', content: 'What is the capital of France?' },
+          { role: 'assistant', content: 'Paris.' },
+          { role: 'user', content: [{ type: 'text', text: 'And of Italy, in one word please?' }] },
+        ],
+      };
+
+      const counted = await post('/v1/chat/completions/count', request);
+      expect(counted.status).toBe(200);
+      const count = await counted.json();
+
+      const completion = await (await post('/v1/chat/completions', request)).json();
+      expect(count).toEqual({ prompt_tokens: completion.usage.prompt_tokens });
+      expect(count.prompt_tokens).toBeGreaterThan(0);
+    });
+
+    it('should validate the request like a completion', async () => {
+      const missing = await post('/v1/chat/completions/count', { model: 'echo' });
+      expect(missing.status).toBe(400);
+
+      const unknown = await post('/v1/chat/completions/count', {
+        model: 'no-such-model',
+        messages: [{ role: 'user', content: 'Hi' }],
+      });
+      expect(unknown.status).toBe(400);
+      expect((await unknown.json()).error.param).toBe('model');
+    });
+  });
+
+  describe('Usage Accounting', () => {
+    const usageOf = async (
+      messages: unknown[],
+      model = 'echo',
+      target: ReturnType<typeof createApp> = app
+    ) => {
+      const res = await target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model, messages }),
+      });
+      const data = await res.json();
+      return { usage: data.usage, finishReason: data.choices[0].finish_reason };
+    };
+
+    // prompt_tokens = ceil(characters of the last user message / 4)
+    //               + 3 per message + 3 priming the reply
+    it('should count the formatting overhead of an empty message', async () => {
+      const { usage } = await usageOf([{ role: 'user', content: '' }]);
+
+      expect(usage.prompt_tokens).toBe(0 + 3 + 3);
+    });
+
+    it('should count a single word', async () => {
+      const { usage } = await usageOf([{ role: 'user', content: 'Hello' }]);
+
+      expect(usage).toEqual({ prompt_tokens: 2 + 3 + 3, completion_tokens: 2, total_tokens: 10 });
+    });
+
+    it('should count every message of a conversation', async () => {
+      const { usage } = await usageOf([
+        { role: 'system', content: 'Be brief.' },
+        { role: 'user', content: 'Hi' },
+        { role: 'assistant', content: 'Hello!' },
+        { role: 'user', content: 'How are you?' },
+      ]);
+
+      expect(usage).toEqual({ prompt_tokens: 3 + 4 * 3 + 3, completion_tokens: 3, total_tokens: 21 });
+    });
+
+    it('should count no completion tokens only for truly empty content', async () => {
+      // The chunky model's "|" is two empty chunks
+      const { usage, finishReason } = await usageOf([{ role: 'user', content: '|' }], 'chunky');
+
+      expect(finishReason).toBe('stop');
+      expect(usage).toEqual({ prompt_tokens: 1 + 3 + 3, completion_tokens: 0, total_tokens: 7 });
+    });
+
+    it('should use the configured overhead', async () => {
+      const configured = createApp({ auth: { apiKey: testAPIKey }, tokensPerMessage: 1, replyPrimingTokens: 0 });
+
+      const { usage } = await usageOf(
+        [
+          { role: 'system', content: 'Be brief.' },
+          { role: 'user', content: 'Hello' },
+        ],
+        'echo',
+        configured
+      );
+
+      expect(usage.prompt_tokens).toBe(2 + 2 * 1 + 0);
+    });
+  });
+
+  describe('Assistant Prefill', () => {
+    const prefilled = (model: string, stream = false) => ({
+      model,
+      stream,
+      messages: [
+        { role: 'user', content: 'the quick brown fox' },
+        { role: 'assistant', content: 'You said:' },
+      ],
+    });
+
+    const post = (body: unknown, target = app) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+      });
+
+    it('should continue the prefill, sending only what follows it', async () => {
+      const res = await post(prefilled('echo'));
+      expect(res.status).toBe(200);
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe(' the quick brown fox');
+      expect('You said:' + data.choices[0].message.content).toBe('You said: the quick brown fox');
+    });
+
+    it('should stream the continuation the same way', async () => {
+      const res = await post(prefilled('echo', true));
+      const content = (await res.text())
+        .split('\n')
+        .filter((line) => line.startsWith('data: {'))
+        .map((line) => JSON.parse(line.slice(6)).choices[0]?.delta.content ?? '')
+        .join('');
+
+      expect(content).toBe(' the quick brown fox');
+    });
+
+    it('should have generator models continue from the prefill', async () => {
+      const countdownApp = createApp({ auth: { apiKey: testAPIKey }, countdown: { delayMs: 0 } });
+      const res = await post(
+        {
+          model: 'countdown',
+          messages: [
+            { role: 'user', content: '5' },
+            { role: 'assistant', content: '5... 4...' },
+          ],
+        },
+        countdownApp,
+      );
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe(' 3... 2... 1... Done!');
+    });
+
+    it('should answer as before for models that opt out', async () => {
+      const optedOut = createApp({
+        auth: { apiKey: testAPIKey },
+        models: [{ id: 'plain-echo', model: new EchoModel(), capabilities: { supportsPrefill: false } }],
+      });
+
+      const data = await (await post(prefilled('plain-echo'), optedOut)).json();
+      expect(data.choices[0].message.content).toBe('the quick brown fox');
+    });
+  });
+
+  describe('Redactor Model', () => {
+    it('should return the redacted text and spans with json_object', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'redactor',
+          response_format: { type: 'json_object' },
+          messages: [{ role: 'user', content: 'Ça va? Écris à zoe@example.fr, merci' }],
+        }),
+      });
+      expect(res.status).toBe(200);
+
+      const reply = JSON.parse((await res.json()).choices[0].message.content);
+      expect(reply).toEqual({
+        text: 'Ça va? Écris à [EMAIL], merci',
+        redactions: [{ type: 'EMAIL', start: 15, end: 29 }],
+        counts: { EMAIL: 1 },
+      });
+    });
+  });
+
+  describe('Garbled Output', () => {
+    const reply = async (probability: number) => {
+      const garbledApp = createApp({
+        auth: { apiKey: testAPIKey },
+        garble: { echo: { probability, token: '<?>' } },
+      });
+      const res = await garbledApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'keep this clean' }] }),
+      });
+      expect(res.status).toBe(200);
+      return (await res.json()).choices[0].message.content;
+    };
+
+    it('should insert the garbage token at probability 1', async () => {
+      expect(await reply(1)).toBe('keep<?> this<?> clean<?>');
+    });
+
+    it('should leave the output clean at probability 0', async () => {
+      expect(await reply(0)).toBe('keep this clean');
+    });
+
+    it('should refuse to garble a model that does not exist', () => {
+      expect(() => createApp({ auth: { apiKey: testAPIKey }, garble: { nope: { probability: 1 } } })).toThrow(
+        "Can't garble unknown model: nope",
+      );
+    });
+  });
+
+  describe('Multiple System Messages', () => {
+    const messages = [
+      { role: 'system', content: 'You are a pirate.' },
+      { role: 'system', content: [{ type: 'text', text: 'Answer in one line.' }] },
+      { role: 'user', content: 'Where is the treasure?' },
+    ];
+
+    const reply = async (model: string) => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model, messages }),
+      });
+      expect(res.status).toBe(200);
+      return (await res.json()).choices[0].message.content;
+    };
+
+    it('should still echo the user message', async () => {
+      expect(await reply('echo')).toBe('Where is the treasure?');
+    });
+
+    it('should give system-aware models every system message', async () => {
+      expect(await reply('system-echo')).toBe('You are a pirate.\n\nAnswer in one line.');
+    });
+  });
+
+  describe('Resolved Parameters', () => {
+    const complete = (target: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'params' }], ...body }),
+      });
+
+    it('should leave x_parameters out by default', async () => {
+      const data = await (await complete(app, {})).json();
+      expect(data).not.toHaveProperty('x_parameters');
+    });
+
+    it('should reflect request values and configured defaults', async () => {
+      const reflecting = createApp({
+        auth: { apiKey: testAPIKey },
+        reflectParameters: true,
+        defaultTemperature: 0.2,
+      });
+
+      const defaults = await (await complete(reflecting, {})).json();
+      expect(defaults.x_parameters).toEqual({
+        temperature: 0.2,
+        top_p: 1,
+        n: 1,
+        max_tokens: null,
+        stop: null,
+        seed: null,
+      });
+
+      const requested = await (await complete(reflecting, {
+        temperature: 1.3,
+        top_p: 0.9,
+        max_tokens: 50,
+        stop: 'END',
+        seed: 7,
+      })).json();
+      expect(requested.x_parameters).toEqual({
+        temperature: 1.3,
+        top_p: 0.9,
+        n: 1,
+        max_tokens: 50,
+        stop: ['END'],
+        seed: 7,
+      });
+    });
+
+    it('should reflect them on the first streamed chunk only', async () => {
+      const reflecting = createApp({ auth: { apiKey: testAPIKey }, reflectParameters: true, defaultTopP: 0.5 });
+
+      const res = await complete(reflecting, { stream: true, temperature: 0 });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      expect(chunks[0].x_parameters).toMatchObject({ temperature: 0, top_p: 0.5 });
+      expect(chunks.slice(1).some((chunk) => 'x_parameters' in chunk)).toBe(false);
+    });
+  });
+
+  describe('Degraded Mode', () => {
+    const minimal = createApp({ auth: { apiKey: testAPIKey }, minimalResponses: true, reflectParameters: true });
+    const complete = (body: Record<string, unknown>) =>
+      minimal.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'sparse' }], ...body }),
+      });
+
+    it('should leave every optional field out of completions', async () => {
+      const res = await complete({});
+      expect(res.status).toBe(200);
+      const data = await res.json();
+
+      expect(Object.keys(data).sort()).toEqual(['choices', 'created', 'id', 'model', 'object']);
+      expect(data).toMatchObject({ object: 'chat.completion', model: 'echo' });
+      expect(data.id).toMatch(/^chatcmpl-/);
+      expect(typeof data.created).toBe('number');
+      expect(data.choices).toEqual([
+        { index: 0, message: { role: 'assistant', content: 'sparse' }, finish_reason: 'stop' },
+      ]);
+    });
+
+    it('should stream chunks without them, and no usage chunk', async () => {
+      const res = await complete({ stream: true, stream_options: { include_usage: true } });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      for (const chunk of chunks) {
+        expect(Object.keys(chunk).sort()).toEqual(['choices', 'created', 'id', 'model', 'object']);
+        expect(chunk.object).toBe('chat.completion.chunk');
+        expect(chunk.choices).toHaveLength(1);
+      }
+      expect(chunks.map((chunk) => chunk.choices[0].delta.content ?? '').join('')).toBe('sparse');
+      expect(chunks.at(-1).choices[0].finish_reason).toBe('stop');
+    });
+  });
+
+  describe('Azure Compatibility', () => {
+    const complete = (target: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'filter me' }], ...body }),
+      });
+
+    it('should leave prompt_filter_results out by default', async () => {
+      const data = await (await complete(app, {})).json();
+      expect(data).not.toHaveProperty('prompt_filter_results');
+    });
+
+    it('should report the prompt as safe in every default category', async () => {
+      const azure = createApp({ auth: { apiKey: testAPIKey }, promptFilterResults: DEFAULT_CONTENT_FILTER_RESULTS });
+
+      const data = await (await complete(azure, {})).json();
+      expect(data.prompt_filter_results).toEqual([{
+        prompt_index: 0,
+        content_filter_results: {
+          hate: { filtered: false, severity: 'safe' },
+          self_harm: { filtered: false, severity: 'safe' },
+          sexual: { filtered: false, severity: 'safe' },
+          violence: { filtered: false, severity: 'safe' },
+        },
+      }]);
+      expect(data.choices[0].message.content).toBe('filter me');
+    });
+
+    it('should report configured results on the first streamed chunk only', async () => {
+      const results = {
+        hate: { filtered: false, severity: 'low' as const },
+        jailbreak: { filtered: false, detected: false },
+      };
+      const azure = createApp({ auth: { apiKey: testAPIKey }, promptFilterResults: results });
+
+      const res = await complete(azure, { stream: true });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      expect(chunks[0].prompt_filter_results).toEqual([{ prompt_index: 0, content_filter_results: results }]);
+      expect(chunks.slice(1).some((chunk) => 'prompt_filter_results' in chunk)).toBe(false);
+    });
+  });
+
+  describe('Multiple Choices', () => {
+    const countdownApp = createApp({ auth: { apiKey: testAPIKey }, countdown: { delayMs: 5 }, maxChoices: 8 });
+    const complete = (target: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'countdown', messages: [{ role: 'user', content: '5' }], ...body }),
+      });
+
+    it('should return n choices, with usage across all of them', async () => {
+      const res = await complete(countdownApp, { n: 3 });
+      expect(res.status).toBe(200);
+
+      const data = await res.json();
+      expect(data.choices.map((choice: { index: number }) => choice.index)).toEqual([0, 1, 2]);
+      for (const choice of data.choices) {
+        expect(choice.message.content).toBe('5... 4... 3... 2... 1... Done!');
+        expect(choice.finish_reason).toBe('stop');
+      }
+      expect(data.usage.completion_tokens).toBe(15);
+    });
+
+    it('should stream choices side by side, each reassembling by index', async () => {
+      const n = 8;
+      const res = await complete(countdownApp, { n, stream: true, stream_options: { include_usage: true } });
+      expect(res.status).toBe(200);
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      const contents: string[] = Array(n).fill('');
+      const finishReasons: (string | undefined)[] = Array(n).fill(undefined);
+      const contentOrder: number[] = [];
+      for (const chunk of chunks) {
+        expect(chunk.choices.length).toBeLessThanOrEqual(1);
+        const choice = chunk.choices[0];
+        if (!choice) continue;
+        expect(finishReasons[choice.index]).toBeUndefined();
+        if (choice.delta.content) {
+          contents[choice.index] += choice.delta.content;
+          contentOrder.push(choice.index);
+        }
+        if (choice.finish_reason) {
+          finishReasons[choice.index] = choice.finish_reason;
+        }
+      }
+
+      expect(contents).toEqual(Array(n).fill('5... 4... 3... 2... 1... Done!'));
+      expect(finishReasons).toEqual(Array(n).fill('stop'));
+      // Every choice had started before the first one finished, rather than
+      // each being generated in full in turn
+      expect(new Set(contentOrder.slice(0, n)).size).toBe(n);
+
+      const usage = chunks.filter((chunk) => chunk.usage);
+      expect(usage.at(-1).choices).toEqual([]);
+      expect(usage.at(-1).usage.completion_tokens).toBe(5 * n);
+    });
+
+    it('should send the role first for every choice', async () => {
+      const res = await complete(countdownApp, { n: 3, stream: true });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      expect(chunks.slice(0, 3).map((chunk) => chunk.choices[0])).toEqual([
+        { index: 0, delta: { role: 'assistant' } },
+        { index: 1, delta: { role: 'assistant' } },
+        { index: 2, delta: { role: 'assistant' } },
+      ]);
+    });
+
+    it('should reject n beyond the configured maximum', async () => {
+      const res = await complete(countdownApp, { n: 9, stream: true });
+      expect(res.status).toBe(400);
+
+      const data = await res.json();
+      expect(data.error.param).toBe('n');
+      expect(data.error.message).toBe("Invalid 'n': must be an integer from 1 to 8");
+    });
+
+    it.each([0, 1.5, '2'])('should reject n of %j', async (n) => {
+      const res = await complete(app, { n });
+      expect(res.status).toBe(400);
+      expect((await res.json()).error.param).toBe('n');
+    });
+
+    it('should allow OpenAI\'s 128 choices by default', async () => {
+      expect((await complete(app, { model: 'echo', n: 128 })).status).toBe(200);
+      expect((await complete(app, { model: 'echo', n: 129 })).status).toBe(400);
+    });
+  });
+
+  describe('Fanout Model', () => {
+    const fanoutApp = createApp({ auth: { apiKey: testAPIKey }, fanout: ['echo', 'reverse'] });
+    const complete = (body: Record<string, unknown>) =>
+      fanoutApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'fanout', messages: [{ role: 'user', content: 'Hello, fanout!' }], ...body }),
+      });
+
+    it('should answer with one choice per backend, in order', async () => {
+      const res = await complete({});
+      expect(res.status).toBe(200);
+      const data = await res.json();
+
+      expect(data.model).toBe('fanout');
+      expect(data.choices).toEqual([
+        { index: 0, message: { role: 'assistant', content: 'Hello, fanout!' }, finish_reason: 'stop' },
+        { index: 1, message: { role: 'assistant', content: '!tuonaf ,olleH' }, finish_reason: 'stop' },
+      ]);
+    });
+
+    it('should run every backend whatever n asks for', async () => {
+      const data = await (await complete({ n: 5 })).json();
+      expect(data.choices).toHaveLength(2);
+    });
+
+    it('should stream each backend as its own choice', async () => {
+      const res = await complete({ stream: true });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      const content = (index: number) =>
+        chunks
+          .flatMap((chunk) => chunk.choices)
+          .filter((choice) => choice.index === index)
+          .map((choice) => choice.delta.content ?? '')
+          .join('');
+      expect(content(0)).toBe('Hello, fanout!');
+      expect(content(1)).toBe('!tuonaf ,olleH');
+    });
+
+    it('should run virtual backends with their own system prompt and max_tokens', async () => {
+      const virtualApp = createApp({
+        auth: { apiKey: testAPIKey },
+        virtualModels: [{ id: 'terse', base: 'system-echo', system: 'You are terse and to the point.', max_tokens: 2 }],
+        fanout: ['echo', 'terse'],
+      });
+
+      const res = await virtualApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'fanout', messages: [{ role: 'user', content: 'Hello, fanout!' }] }),
+      });
+      const data = await res.json();
+
+      expect(data.choices).toEqual([
+        { index: 0, message: { role: 'assistant', content: 'Hello, fanout!' }, finish_reason: 'stop' },
+        { index: 1, message: { role: 'assistant', content: 'You are' }, finish_reason: 'length' },
+      ]);
+    });
+
+    it('should not exist unless configured, nor start over unknown models', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'fanout', messages: [{ role: 'user', content: 'Hi' }] }),
+      });
+      expect(res.status).toBe(400);
+
+      expect(() => createApp({ auth: { apiKey: testAPIKey }, fanout: ['echo', 'nope'] })).toThrow(
+        'Fanout is over unknown model: nope'
+      );
+    });
+  });
+
+  describe('Logprobs', () => {
+    const complete = (body: Record<string, unknown>) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'Logprobs for every token, please!' }],
+          ...body,
+        }),
+      });
+
+    it('should give each token exactly top_logprobs distinct alternatives', async () => {
+      for (const k of [0, 1, 5, 20]) {
+        const res = await complete({ logprobs: true, top_logprobs: k });
+        expect(res.status).toBe(200);
+
+        const data = await res.json();
+        const tokens = data.choices[0].logprobs.content;
+        expect(tokens.map((token: { token: string }) => token.token).join('')).toBe(
+          'Logprobs for every token, please!',
+        );
+        for (const token of tokens) {
+          expect(token.top_logprobs).toHaveLength(k);
+          const alternatives = token.top_logprobs.map((top: { token: string }) => top.token);
+          expect(new Set(alternatives).size).toBe(k);
+          const logprobs = token.top_logprobs.map((top: { logprob: number }) => top.logprob);
+          expect(logprobs).toEqual([...logprobs].sort((a, b) => b - a));
+          expect(token.logprob).toBeLessThanOrEqual(0);
+        }
+        expect(data.choices[0].logprobs.refusal).toBeNull();
+      }
+    });
+
+    it('should default to no alternatives, and leave logprobs out unless asked', async () => {
+      const withLogprobs = await (await complete({ logprobs: true })).json();
+      expect(withLogprobs.choices[0].logprobs.content[0].top_logprobs).toEqual([]);
+      expect(withLogprobs.choices[0].logprobs.content[0].bytes).toEqual([...Buffer.from('Logp')]);
+
+      const without = await (await complete({})).json();
+      expect(without.choices[0]).not.toHaveProperty('logprobs');
+    });
+
+    it('should stream logprobs with each content chunk', async () => {
+      const res = await complete({ logprobs: true, top_logprobs: 3, stream: true });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      const contentChunks = chunks.filter((chunk) => chunk.choices[0]?.delta.content);
+      expect(contentChunks.length).toBeGreaterThan(0);
+      for (const chunk of contentChunks) {
+        const { delta, logprobs } = chunk.choices[0];
+        expect(logprobs.content.map((token: { token: string }) => token.token).join('')).toBe(delta.content);
+        for (const token of logprobs.content) {
+          expect(token.top_logprobs).toHaveLength(3);
+        }
+      }
+    });
+
+    it('should reject top_logprobs outside 0 to 20', async () => {
+      for (const topLogprobs of [25, -1, 2.5]) {
+        const res = await complete({ logprobs: true, top_logprobs: topLogprobs });
+        expect(res.status).toBe(400);
+
+        const data = await res.json();
+        expect(data.error.param).toBe('top_logprobs');
+        expect(data.error.message).toBe("Invalid 'top_logprobs': must be an integer from 0 to 20");
+      }
+    });
+
+    it('should reject top_logprobs without logprobs', async () => {
+      const res = await complete({ top_logprobs: 2 });
+      expect(res.status).toBe(400);
+      expect((await res.json()).error.message).toBe("Invalid 'top_logprobs': requires 'logprobs' to be true");
+    });
+  });
+
+  describe('Stream Pacing', () => {
+    const delayMs = 40;
+    const pacedApp = createApp({ auth: { apiKey: testAPIKey }, countdown: { delayMs } });
+    const countdown = async (body: Record<string, unknown>) => {
+      const res = await pacedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'countdown', messages: [{ role: 'user', content: '3' }], stream: true, ...body }),
+      });
+      return parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+    };
+
+    it('should report pacing alongside the standard usage fields', async () => {
+      const chunks = await countdown({ stream_options: { include_usage: true } });
+      const { teenytiny, ...usage } = chunks.at(-1).usage;
+
+      expect(Object.keys(usage)).toEqual(['prompt_tokens', 'completion_tokens', 'total_tokens']);
+      // Role, three numbers, Done!, the finish chunk and the usage chunk
+      expect(teenytiny.chunk_count).toBe(chunks.length);
+      expect(teenytiny.chunk_count).toBe(7);
+
+      // A pause follows each of the three numbers; everything else is sent
+      // back to back
+      expect(teenytiny.duration_ms).toBeGreaterThanOrEqual(3 * delayMs * 0.9);
+      expect(teenytiny.duration_ms).toBeLessThan(3 * delayMs + 1000);
+      expect(teenytiny.time_to_first_chunk_ms).toBeLessThan(delayMs);
+      expect(teenytiny.inter_chunk_gap_ms.max).toBeGreaterThanOrEqual(delayMs * 0.9);
+      expect(teenytiny.inter_chunk_gap_ms.max).toBeLessThan(delayMs + 500);
+      expect(teenytiny.inter_chunk_gap_ms.min).toBeLessThan(delayMs / 2);
+      expect(teenytiny.inter_chunk_gap_ms.mean).toBeGreaterThanOrEqual((3 * delayMs * 0.9) / 6);
+      expect(teenytiny.inter_chunk_gap_ms.mean).toBeLessThanOrEqual(teenytiny.inter_chunk_gap_ms.max);
+    });
+
+    it('should leave pacing out without include_usage', async () => {
+      const chunks = await countdown({});
+      expect(chunks.some((chunk) => chunk.usage?.teenytiny !== undefined)).toBe(false);
+    });
+  });
+
+  describe('Dropped Chunks', () => {
+    const countdown = (target: ReturnType<typeof createApp>, body: Record<string, unknown> = {}) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'countdown',
+          messages: [{ role: 'user', content: 'From 20' }],
+          stream: true,
+          ...body,
+        }),
+      });
+    const received = async (res: Response) =>
+      parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+    const lossy = createApp({
+      auth: { apiKey: testAPIKey },
+      countdown: { delayMs: 0 },
+      dropChunks: { countdown: { probability: 0.8, seed: 42 } },
+    });
+
+    it('should receive fewer chunks than were emitted, but still start and finish', async () => {
+      const lossless = createApp({ auth: { apiKey: testAPIKey }, countdown: { delayMs: 0 } });
+      const emitted = await received(await countdown(lossless));
+
+      const res = await countdown(lossy);
+      expect(res.status).toBe(200);
+      const chunks = await received(res);
+
+      expect(chunks.length).toBeLessThan(emitted.length);
+      expect(chunks[0].choices[0].delta.role).toBe('assistant');
+      expect(chunks.at(-1).choices[0].finish_reason).toBe('stop');
+      expect(chunks.at(-1).usage.completion_tokens).toBe(20);
+    });
+
+    it('should drop the same chunks for the same seed', async () => {
+      const contents = async (seed: number) =>
+        (await received(await countdown(lossy, { seed })))
+          .map((chunk) => chunk.choices[0].delta.content ?? '')
+          .join('');
+
+      expect(await contents(1)).toBe(await contents(1));
+      expect(await contents(1)).not.toBe('20... 19... 18... 17... 16... 15... 14... 13... 12... 11... 10... 9... 8... 7... 6... 5... 4... 3... 2... 1... Done!');
+    });
+
+    it('should refuse to start for an unknown model', () => {
+      expect(() => createApp({
+        auth: { apiKey: testAPIKey },
+        dropChunks: { nope: { probability: 0.5 } },
+      })).toThrow("Can't drop chunks of unknown model: nope");
+    });
+  });
+
+  describe('Vision Model', () => {
+    it('should describe image parts and echo the text parts', async () => {
+      const png = await readFile(fileURLToPath(new URL('./testdata/red-3x2.png', import.meta.url)));
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'vision',
+          messages: [
+            {
+              role: 'user',
+              content: [
+                { type: 'text', text: 'Compare these.' },
+                { type: 'image_url', image_url: { url: `data:image/png;base64,${png.toString('base64')}` } },
+                { type: 'image_url', image_url: { url: 'https://example.com/cat.jpg', detail: 'low' } },
+              ],
+            },
+          ],
+        }),
+      });
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe(
+        'Image 1: data URI, 73 bytes, PNG 3x2\nImage 2: https://example.com/cat.jpg (not fetched)\n\nCompare these.'
+      );
+    });
+  });
+
+  describe('Refine Model', () => {
+    it('should stream a revision marker and end with the revised answer', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'refine',
+          messages: [{ role: 'user', content: 'Paris is the capital of France' }],
+          stream: true,
+        }),
+      });
+
+      expect(res.status).toBe(200);
+      const content = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0]?.delta.content ?? '')
+        .join('');
+
+      expect(content).toContain('\n\n[revised]\n\n');
+      const [draft, revised] = content.split('\n\n[revised]\n\n');
+      expect(draft).toBe('Paris is the…');
+      expect(revised).toBe('Paris is the capital of France');
+    });
+  });
+
+  describe('Markdown Model', () => {
+    const complete = (stream: boolean) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'markdown',
+          messages: [{ role: 'user', content: 'Render this please' }],
+          stream,
+        }),
+      });
+
+    it('should stream one markdown element per chunk, reassembling to the full reply', async () => {
+      const streamed = await complete(true);
+      expect(streamed.status).toBe(200);
+      const pieces = parseSSEData(await streamed.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0]?.delta.content)
+        .filter((content): content is string => Boolean(content));
+
+      const reply = (await (await complete(false)).json()).choices[0].message.content;
+      expect(pieces.join('')).toBe(reply);
+      expect(pieces).toHaveLength(6);
+      expect(pieces[0]).toBe('# Render this please\n\n');
+      expect(reply).toContain('> Render this please');
+      expect(reply).toContain('```text\nRender this please\n```');
+      expect(reply).toContain('| # | Word | Length |\n| ---: | --- | ---: |\n| 1 | Render | 6 |');
+      expect(reply).toContain('<details>');
+    });
+  });
+
+  describe('Markdown Torture Model', () => {
+    const complete = (content: string, stream: boolean) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'markdown-torture', messages: [{ role: 'user', content }], stream }),
+      });
+
+    it('should stream the pinned chunks byte for byte, and the same document unstreamed', async () => {
+      const file = fileURLToPath(new URL('./testdata/markdown-torture.json', import.meta.url));
+      const { sections } = JSON.parse(await readFile(file, 'utf8')) as { sections: Record<string, string[]> };
+
+      const streamed = await complete('tables and code', true);
+      expect(streamed.status).toBe(200);
+      const pieces = parseSSEData(await streamed.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0]?.delta.content)
+        .filter((content): content is string => Boolean(content));
+      expect(pieces).toEqual([...sections.code!, ...sections.tables!]);
+
+      const whole = (await (await complete('all', false)).json()).choices[0].message.content;
+      expect(whole).toBe(Object.values(sections).flat().join(''));
+    });
+  });
+
+  describe('Escalating Model', () => {
+    const escalatingApp = createApp({
+      auth: { apiKey: testAPIKey },
+      admin: { enabled: true },
+      escalating: { script: [429, 503, 'success'] },
+    });
+    const auth = { 'Authorization': `Bearer ${testAPIKey}` };
+    const attempt = (content: string, idempotencyKey?: string) =>
+      escalatingApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          ...auth,
+          'Content-Type': 'application/json',
+          ...(idempotencyKey === undefined ? {} : { 'Idempotency-Key': idempotencyKey }),
+        },
+        body: JSON.stringify({ model: 'escalating', messages: [{ role: 'user', content }] }),
+      });
+
+    it('should fail retries of a request by script, then report the attempts', async () => {
+      const failures = [await attempt('Retry me', 'retry-1'), await attempt('Retry me', 'retry-1')];
+      expect(failures.map((res) => res.status)).toEqual([429, 503]);
+      const body = await failures[0]!.json();
+      expect(body.error.type).toBe('rate_limit_error');
+      expect(body.error.code).toBe('scripted_failure');
+      expect(body.error.message).toContain('Attempt 1 failed with 429');
+
+      // Another request is counted separately
+      expect((await attempt('Retry me', 'retry-2')).status).toBe(429);
+
+      const success = await attempt('Retry me', 'retry-1');
+      expect(success.status).toBe(200);
+      expect(success.headers.get('x-teenytiny-attempts')).toBe('3');
+      expect((await success.json()).choices[0].message.content).toBe('Succeeded on attempt 3, after 429, 503.');
+
+      // The stored response answers any further retry of the key
+      const replay = await attempt('Retry me', 'retry-1');
+      expect(replay.headers.get('Idempotent-Replay')).toBe('true');
+    });
+
+    it('should count resent conversations without an idempotency key', async () => {
+      expect((await attempt('Same conversation')).status).toBe(429);
+      expect((await attempt('Same conversation')).status).toBe(503);
+      expect((await attempt('Same conversation')).status).toBe(200);
+      expect((await attempt('Same conversation')).status).toBe(429);
+    });
+
+    it('should start every count over from /admin/escalating', async () => {
+      await attempt('Reset me');
+      expect((await escalatingApp.request('/admin/escalating', { headers: auth })).status).toBe(200);
+
+      const reset = await escalatingApp.request('/admin/escalating', { method: 'DELETE', headers: auth });
+      expect(reset.status).toBe(200);
+      expect((await reset.json()).reset).toBeGreaterThan(0);
+
+      expect((await attempt('Reset me')).status).toBe(429);
+      const status = await (await escalatingApp.request('/admin/escalating', { headers: auth })).json();
+      expect(status).toEqual({ script: [429, 503, 'success'], tracked: 1 });
+    });
+  });
+
+  describe('JSON Patch Model', () => {
+    const patch = (messages: string[], extra: Record<string, unknown> = {}) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          model: 'jsonpatch',
+          messages: messages.map((content) => ({ role: 'user', content })),
+          ...extra,
+        }),
+      });
+    const state = JSON.stringify({ todos: [{ title: 'Write tests', done: false }] });
+
+    it('should round-trip a document through a patch', async () => {
+      const res = await patch([state, JSON.stringify([
+        { op: 'test', path: '/todos/0/done', value: false },
+        { op: 'replace', path: '/todos/0/done', value: true },
+        { op: 'add', path: '/todos/-', value: { title: 'Ship', done: false } },
+      ])], { response_format: { type: 'json_object' } });
+      expect(res.status).toBe(200);
+
+      const content = (await res.json()).choices[0].message.content;
+      expect(JSON.parse(content)).toEqual({ todos: [{ title: 'Write tests', done: true }, { title: 'Ship', done: false }] });
+      expect(content).not.toContain('\n');
+    });
+
+    it('should explain patch errors in the reply rather than failing', async () => {
+      const res = await patch([state, JSON.stringify([{ op: 'remove', path: '/todos/5' }])]);
+      expect(res.status).toBe(200);
+
+      const data = await res.json();
+      expect(data.choices[0].finish_reason).toBe('stop');
+      expect(data.choices[0].message.content).toContain('Operation 0 (remove /todos/5) failed: index 5 is out of bounds');
+    });
+  });
+
+  describe('CSV Model', () => {
+    const convert = (content: string, extra: Record<string, unknown> = {}) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'csv', messages: [{ role: 'user', content }], ...extra }),
+      });
+
+    it('should round-trip rows between CSV and JSON', async () => {
+      const csv = 'name,note\nAda,"Wrote the first program, arguably"\nZoë,"Line one\nline two"\n';
+
+      const toJson = await convert(csv, { response_format: { type: 'json_object' } });
+      expect(toJson.status).toBe(200);
+      const { rows } = JSON.parse((await toJson.json()).choices[0].message.content);
+      expect(rows).toEqual([
+        { name: 'Ada', note: 'Wrote the first program, arguably' },
+        { name: 'Zoë', note: 'Line one\nline two' },
+      ]);
+
+      const toCsv = await convert(JSON.stringify(rows));
+      expect((await toCsv.json()).choices[0].message.content).toBe(csv);
+    });
+
+    it('should report ragged rows in the reply', async () => {
+      const res = await convert('a,b\n1,2\n3\n');
+      expect(res.status).toBe(200);
+      expect((await res.json()).choices[0].message.content).toContain('parse error on line 3: expected 2 fields, got 1');
+    });
+  });
+
+  describe('Trace Endpoint', () => {
+    const trace = (target: ReturnType<typeof createApp>, body: unknown) =>
+      target.request('/v1/teenytiny/trace', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+      });
+
+    it('should not be served unless enabled', async () => {
+      const res = await trace(app, { model: 'echo', messages: [{ role: 'user', content: 'Hi' }] });
+      expect(res.status).toBe(404);
+    });
+
+    it('should list the SSE events of a streamed completion in order', async () => {
+      const traceApp = createApp({ auth: { apiKey: testAPIKey }, trace: true });
+      const res = await trace(traceApp, { model: 'echo', messages: [{ role: 'user', content: 'Hello' }] });
+
+      expect(res.status).toBe(200);
+      const body = await res.json();
+      expect(body.object).toBe('list');
+      expect(body.model).toBe('echo');
+
+      const events = body.data;
+      expect(events.map((event: any) => event.index)).toEqual(events.map((_: unknown, i: number) => i));
+      expect(events[0].type).toBe('chunk');
+      expect(events[0].parsed.choices[0].delta.role).toBe('assistant');
+      expect(events[events.length - 1]).toMatchObject({ type: 'done', raw: 'data: [DONE]\n\n', parsed: null, writes: 1 });
+
+      const chunks = events.filter((event: any) => event.type === 'chunk');
+      expect(chunks.map((event: any) => event.parsed.choices[0]?.delta.content ?? '').join('')).toBe('Hello');
+      for (const event of chunks) {
+        expect(event.raw).toBe(`data: ${JSON.stringify(event.parsed)}\n\n`);
+        expect(event.bytes).toBe(new TextEncoder().encode(event.raw).length);
+      }
+      const offsets = events.map((event: any) => event.offset_ms);
+      expect(offsets).toEqual([...offsets].sort((a, b) => a - b));
+    });
+
+    it('should reject unknown models', async () => {
+      const traceApp = createApp({ auth: { apiKey: testAPIKey }, trace: true });
+      const res = await trace(traceApp, { model: 'missing', messages: [{ role: 'user', content: 'Hi' }] });
+
+      expect(res.status).toBe(400);
+      expect((await res.json()).error.param).toBe('model');
+    });
+  });
+
   describe('Health Check', () => {
-    it('should return healthy status', async () => {
-      const res = await app.request('/health');
+    it('should name the service and the time', async () => {
+      const data = await (await app.request('/health')).json();
+
+      expect(data.service).toBe('teenytiny-api');
+      expect(data.timestamp).toBeDefined();
+    });
+
+    it('should report a working model layer from the deep check', async () => {
+      const res = await app.request('/health/deep');
+      expect(res.status).toBe(200);
+
+      const data = await res.json();
+      expect(data).toMatchObject({
+        status: 'ok',
+        checks: { generation: { status: 'ok', latency_ms: expect.any(Number) } },
+      });
+    });
+
+    it('should fail the deep check with 503 when echo is disabled', async () => {
+      const brokenApp = createApp({ auth: { apiKey: testAPIKey }, disabledModels: ['echo'] });
+
+      expect((await brokenApp.request('/health')).status).toBe(200);
+      const res = await brokenApp.request('/health/deep');
+      expect(res.status).toBe(503);
+
+      const data = await res.json();
+      expect(data.status).toBe('error');
+      expect(data.checks.generation.error).toContain('echo');
+    });
+  });
+
+  describe('Models Endpoint', () => {
+    it('should list models as owned by teenytiny-ai', async () => {
+      const res = await app.request('/v1/models', {
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+        },
+      });
+
+      const data = await res.json();
+      expect(data.data.find((model: { id: string }) => model.id === 'echo').owned_by).toBe('teenytiny-ai');
+    });
+
+    it('should reject duplicate Authorization headers with 400', async () => {
+      const headers = new Headers();
+      headers.append('Authorization', `Bearer ${testAPIKey}`);
+      headers.append('Authorization', 'Bearer invalid-key');
+
+      const res = await app.request('/v1/models', { headers });
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error).toMatchObject({ type: 'invalid_request_error', param: 'Authorization' });
+      expect(data.error.message).toContain('2 Authorization headers');
+    });
+
+    it('should reject duplicates even when both carry the valid key', async () => {
+      const headers = new Headers();
+      headers.append('Authorization', `Bearer ${testAPIKey}`);
+      headers.append('Authorization', `Bearer ${testAPIKey}`);
+
+      const res = await app.request('/v1/models', { headers });
+
+      expect(res.status).toBe(400);
+    });
+  });
+
+  describe('Chat Completions', () => {
+    const validRequest: ChatCompletionRequest = {
+      model: 'echo',
+      messages: [
+        { role: 'user', content: 'Hello, Echo!' },
+      ],
+    };
+
+    it('should stream as text/event-stream with usage on the last chunk', async () => {
+      const streamingRequest: ChatCompletionRequest = {
+        ...validRequest,
+        stream: true,
+      };
+
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(streamingRequest),
+      });
+
+      expect(res.headers.get('content-type')).toContain('text/event-stream');
+
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+      expect(chunks[chunks.length - 1].usage).toBeDefined();
+    });
+
+    it('should require authentication', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(validRequest),
+      });
+
+      expect(res.status).toBe(401);
+    });
+
+    it('should validate required fields', async () => {
+      const invalidRequest = {
+        messages: [{ role: 'user', content: 'Hello!' }],
+        // Missing model field
+      };
+
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(invalidRequest),
+      });
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.param).toBe('model');
+    });
+
+    it('should handle empty messages array', async () => {
+      const invalidRequest: ChatCompletionRequest = {
+        model: 'echo',
+        messages: [],
+      };
+
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(invalidRequest),
+      });
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.param).toBe('messages');
+    });
+  });
+
+  describe('Echo Model Behavior', () => {
+    it('should echo the last user message', async () => {
+      const request: ChatCompletionRequest = {
+        model: 'echo',
+        messages: [
+          { role: 'system', content: 'You are a helpful assistant.' },
+          { role: 'user', content: 'First message' },
+          { role: 'assistant', content: 'First response' },
+          { role: 'user', content: 'Second message' },
+        ],
+      };
+
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(request),
+      });
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('Second message');
+    });
+
+    it('should provide default response when no user messages', async () => {
+      const request: ChatCompletionRequest = {
+        model: 'echo',
+        messages: [
+          { role: 'system', content: 'You are a helpful assistant.' },
+        ],
+      };
+
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(request),
+      });
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].message.content).toContain('Echo model');
+    });
+  });
+
+  describe('Tool Calls', () => {
+    const weatherFunction = {
+      name: 'get_weather',
+      description: 'Get the weather for a city',
+      parameters: {
+        type: 'object',
+        properties: { city: { type: 'string' } },
+      },
+    };
+
+    it('should return tool_calls for tools requests', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'toolcall',
+          messages: [{ role: 'user', content: '{"city": "Paris"}' }],
+          tools: [{ type: 'function', function: weatherFunction }],
+        }),
+      });
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      const choice = data.choices[0];
+      expect(choice.finish_reason).toBe('tool_calls');
+      expect(choice.message.content).toBeNull();
+      expect(choice.message.function_call).toBeUndefined();
+      expect(choice.message.tool_calls).toEqual([
+        {
+          id: expect.stringMatching(/^call_/),
+          type: 'function',
+          function: { name: 'get_weather', arguments: '{"city":"Paris"}' },
+        },
+      ]);
+    });
+
+    it('should return a legacy function_call for functions requests', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'toolcall',
+          messages: [{ role: 'user', content: '{"city": "Paris"}' }],
+          functions: [weatherFunction],
+          function_call: { name: 'get_weather' },
+        }),
+      });
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      const choice = data.choices[0];
+      expect(choice.finish_reason).toBe('function_call');
+      expect(choice.message.content).toBeNull();
+      expect(choice.message.tool_calls).toBeUndefined();
+      expect(choice.message.function_call).toEqual({
+        name: 'get_weather',
+        arguments: '{"city":"Paris"}',
+      });
+    });
+
+    it('should stream a legacy function_call delta', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'toolcall',
+          messages: [{ role: 'user', content: 'Paris' }],
+          functions: [weatherFunction],
+          stream: true,
+        }),
+      });
+
+      const chunks = (await res.text())
+        .split('\n')
+        .filter(line => line.startsWith('data: ') && line !== 'data: [DONE]')
+        .map(line => JSON.parse(line.slice(6)));
+
+      const functionCall = chunks.find(chunk => chunk.choices[0].delta.function_call);
+      expect(functionCall.choices[0].delta.function_call).toEqual({
+        name: 'get_weather',
+        arguments: '{"input":"Paris"}',
+      });
+      expect(chunks.some(chunk => chunk.choices[0].delta.tool_calls)).toBe(false);
+      expect(chunks[chunks.length - 1].choices[0].finish_reason).toBe('function_call');
+    });
+
+    it('should not call functions when function_call is none', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'toolcall',
+          messages: [{ role: 'user', content: 'Paris' }],
+          functions: [weatherFunction],
+          function_call: 'none',
+        }),
+      });
+
+      const data = await res.json();
+      expect(data.choices[0].finish_reason).toBe('stop');
+      expect(data.choices[0].message.function_call).toBeUndefined();
+    });
+
+    it('should accept a legacy function result turn', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'toolcall',
+          messages: [
+            { role: 'user', content: 'Paris' },
+            {
+              role: 'assistant',
+              content: null,
+              function_call: { name: 'get_weather', arguments: '{"input":"Paris"}' },
+            },
+            { role: 'function', name: 'get_weather', content: 'Sunny' },
+          ],
+          functions: [weatherFunction],
+        }),
+      });
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('Tool result: Sunny');
+      expect(data.choices[0].finish_reason).toBe('stop');
+    });
+  });
+
+  describe('CORS', () => {
+    it('should handle OPTIONS requests', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'OPTIONS',
+      });
+
+      expect(res.status).toBe(200);
+      expect(res.headers.get('access-control-allow-origin')).toBe('*');
+      expect(res.headers.get('access-control-allow-methods')).toContain('POST');
+      expect(res.headers.get('access-control-allow-headers')).toContain('Authorization');
+    });
+
+    it('should allow the headers the v1 endpoints read by default', async () => {
+      const res = await app.request('/v1/chat/completions', { method: 'OPTIONS' });
+
+      const allowed = res.headers.get('access-control-allow-headers')?.split(', ');
+      expect(allowed).toEqual(expect.arrayContaining(['Idempotency-Key', 'X-Session-Id', 'OpenAI-Organization']));
+      expect(res.headers.get('access-control-allow-methods')).toBe('GET, POST, DELETE, OPTIONS');
+      expect(res.headers.get('access-control-max-age')).toBeNull();
+    });
+
+    it('should answer preflights with the configured methods, headers and max age', async () => {
+      const corsApp = createApp({
+        auth: { apiKey: testAPIKey },
+        cors: { allowMethods: ['POST', 'OPTIONS'], allowHeaders: ['Authorization', 'X-Stainless-OS'], maxAge: 600 },
+      });
+
+      const preflight = await corsApp.request('/v1/chat/completions', {
+        method: 'OPTIONS',
+        headers: {
+          'Origin': 'https://app.example.com',
+          'Access-Control-Request-Method': 'POST',
+          'Access-Control-Request-Headers': 'authorization, x-stainless-os',
+        },
+      });
+
+      expect(preflight.status).toBe(200);
+      expect(preflight.headers.get('access-control-allow-methods')).toBe('POST, OPTIONS');
+      expect(preflight.headers.get('access-control-allow-headers')).toBe('Authorization, X-Stainless-OS');
+      expect(preflight.headers.get('access-control-max-age')).toBe('600');
+
+      // Max age only means something on preflights
+      const models = await corsApp.request('/v1/models', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+      expect(models.headers.get('access-control-allow-methods')).toBe('POST, OPTIONS');
+      expect(models.headers.get('access-control-max-age')).toBeNull();
+    });
+  });
+
+  describe('Error Handling', () => {
+    it('should handle 404 for unknown routes', async () => {
+      const res = await app.request('/unknown-route', {
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+        },
+      });
+
+      expect(res.status).toBe(404);
+      const data = await res.json();
+      expect(data.error.type).toBe('not_found_error');
+    });
+
+    it('should carry the request id in a mid-stream error chunk', async () => {
+      const crashing: Model = {
+        async *process(input: string): AsyncGenerator<string> {
+          yield input;
+          throw new Error('model crashed');
+        },
+      };
+      const crashApp = createApp({ auth: { apiKey: testAPIKey }, models: [{ id: 'crashing', model: crashing }] });
+
+      const res = await crashApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'crashing', messages: [{ role: 'user', content: 'Hello' }], stream: true }),
+      });
+      expect(res.status).toBe(200);
+
+      const events = parseSSEData(await res.text());
+      expect(events).not.toContain('[DONE]');
+      const requestId = res.headers.get('x-request-id');
+      expect(requestId).toBeTruthy();
+      expect(JSON.parse(events[events.length - 1]!)).toEqual({
+        error: { message: 'Streaming failed', type: 'api_error', request_id: requestId },
+      });
+    });
+  });
+
+  describe('Auth Failure Delay', () => {
+    const delayedApp = createApp({ auth: { apiKey: testAPIKey, failureDelayMs: 100 } });
+
+    it('should take at least the configured delay to reject a bad key', async () => {
+      const start = Date.now();
+      const res = await delayedApp.request('/v1/models', {
+        headers: { 'Authorization': 'Bearer wrong-key' },
+      });
+
+      expect(res.status).toBe(401);
+      expect(Date.now() - start).toBeGreaterThanOrEqual(95);
+    });
+
+    it('should delay a missing header too', async () => {
+      const start = Date.now();
+      const res = await delayedApp.request('/v1/models');
+
+      expect(res.status).toBe(401);
+      expect(Date.now() - start).toBeGreaterThanOrEqual(95);
+    });
+
+    it('should delay successful requests only when asked to', async () => {
+      const constantTimeApp = createApp({
+        auth: { apiKey: testAPIKey, failureDelayMs: 100, delayOnSuccess: true },
+      });
+      const headers = { 'Authorization': `Bearer ${testAPIKey}` };
+
+      let start = Date.now();
+      expect((await delayedApp.request('/v1/models', { headers })).status).toBe(200);
+      expect(Date.now() - start).toBeLessThan(95);
+
+      start = Date.now();
+      expect((await constantTimeApp.request('/v1/models', { headers })).status).toBe(200);
+      expect(Date.now() - start).toBeGreaterThanOrEqual(95);
+    });
+  });
+
+  describe('Audit Log', () => {
+    let dir: string;
+
+    beforeAll(async () => {
+      dir = await mkdtemp(join(tmpdir(), 'teenytiny-audit-'));
+    });
+
+    afterAll(async () => {
+      await rm(dir, { recursive: true, force: true });
+    });
+
+    it('should append a JSONL record per completion', async () => {
+      const path = join(dir, 'audit.jsonl');
+      const sink = new FileAuditSink(path);
+      const auditApp = createApp({ auth: { apiKey: testAPIKey }, audit: new AuditLogger(sink, true) });
+
+      for (const stream of [false, true]) {
+        const res = await auditApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({
+            model: 'echo',
+            messages: [{ role: 'user', content: 'Audit me' }],
+            stream,
+          }),
+        });
+        await res.text();
+      }
+      await sink.close();
+
+      const lines = (await readFile(path, 'utf8')).trim().split('\n');
+      expect(lines).toHaveLength(2);
+      for (const [index, line] of lines.entries()) {
+        const record = JSON.parse(line);
+        expect(record).toMatchObject({
+          api_key: 'tt-tes***',
+          model: 'echo',
+          streaming: index === 1,
+          prompt_tokens: 8,
+          completion_tokens: 2,
+          total_tokens: 10,
+          messages: [{ role: 'user', content: 'Audit me' }],
+          response: 'Audit me',
+        });
+        expect(typeof record.timestamp).toBe('string');
+        expect(typeof record.request_id).toBe('string');
+      }
+    });
+  });
+
+  describe('Error Verbosity', () => {
+    const verboseApp = createApp({ auth: { apiKey: testAPIKey }, errorVerbosity: 'verbose' });
+
+    const post = (target: ReturnType<typeof createApp>, body: string) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body,
+      });
+
+    const badRole = JSON.stringify({
+      model: 'echo',
+      messages: [{ role: 'wizard', content: 'Hello!' }],
+    });
+
+    it('should include the offending field value in verbose mode', async () => {
+      const res = await post(verboseApp, badRole);
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.message).toContain('"wizard"');
+      expect(data.error.param).toBe('messages');
+    });
+
+    it('should leave the offending field value out in terse mode', async () => {
+      const res = await post(app, badRole);
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.message).not.toContain('wizard');
+      expect(data.error.param).toBe('messages');
+    });
+
+    it('should include a snippet of malformed JSON only in verbose mode', async () => {
+      const verbose = await (await post(verboseApp, '{"model": oops}')).json();
+      const terse = await (await post(app, '{"model": oops}')).json();
+
+      expect(verbose.error.message).toContain('{\\"model\\": oops}');
+      expect(terse.error.message).toBe('Invalid JSON in request body');
+    });
+  });
+
+  describe('Request Size Limits', () => {
+    it('should reject bodies over the configured limit with 413', async () => {
+      const limitedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        maxRequestBytes: 1024,
+      });
+
+      const res = await limitedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'x'.repeat(2048) }],
+        }),
+      });
+
+      expect(res.status).toBe(413);
+      const data = await res.json();
+      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.code).toBe('request_too_large');
+    });
+  });
+
+  describe('Prompt Token Limit', () => {
+    // 3 tokens for the message and 3 priming the reply count too
+    const limitedApp = createApp({ auth: { apiKey: testAPIKey }, maxPromptTokens: 11 });
+
+    const send = (content: string, stream: boolean) =>
+      limitedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content }],
+          stream,
+        }),
+      });
+
+    it.each([false, true])('should reject prompts over the cap (stream: %s)', async (stream) => {
+      const res = await send('x'.repeat(24), stream);
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error).toMatchObject({
+        type: 'invalid_request_error',
+        param: 'messages',
+        code: 'prompt_too_long',
+      });
+      expect(data.error.message).toContain('12 prompt tokens');
+      expect(data.error.message).toContain('limit of 11');
+    });
+
+    it('should accept prompts at the cap', async () => {
+      const res = await send('x'.repeat(20), false);
+
+      expect(res.status).toBe(200);
+    });
+  });
+
+  describe('Output Token Limit', () => {
+    const cappedApp = createApp({ auth: { apiKey: testAPIKey }, maxOutputTokens: 3 });
+
+    const send = (model: string, content: string, stream: boolean) =>
+      cappedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model,
+          messages: [{ role: 'user', content }],
+          max_tokens: 1_000_000,
+          stream,
+        }),
+      });
+
+    it('should cap the random model despite a huge max_tokens', async () => {
+      const res = await send('racter', 'Tell me a story', false);
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].finish_reason).toBe('length');
+      expect(data.choices[0].message.content.length).toBeLessThanOrEqual(12);
+      expect(data.usage.completion_tokens).toBeLessThanOrEqual(3);
+    });
+
+    it('should stop streaming at the cap', async () => {
+      const res = await send('echo', 'one two three four five six', true);
+
+      const chunks = (await res.text())
+        .split('\n')
+        .filter(line => line.startsWith('data: ') && line !== 'data: [DONE]')
+        .map(line => JSON.parse(line.slice(6)));
+      const content = chunks.map(chunk => chunk.choices[0].delta.content ?? '').join('');
+      expect(content).toBe('one two thre');
+      expect(chunks[chunks.length - 1].choices[0].finish_reason).toBe('length');
+      expect(chunks[chunks.length - 1].usage.completion_tokens).toBe(3);
+    });
+
+    it('should not split an emoji at the cap', async () => {
+      const data = await (await send('echo', 'abcdefghijk😀😀', false)).json();
+
+      expect(data.choices[0].message.content).toBe('abcdefghijk');
+      expect(data.choices[0].finish_reason).toBe('length');
+    });
+
+    it('should leave output under the cap alone', async () => {
+      const data = await (await send('echo', 'Hi there', false)).json();
+
+      expect(data.choices[0].message.content).toBe('Hi there');
+      expect(data.choices[0].finish_reason).toBe('stop');
+    });
+  });
+
+  describe('Idempotency Keys', () => {
+    const completion = (idempotencyKey: string, target = app) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+          'Idempotency-Key': idempotencyKey,
+        },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'Hello!' }],
+        }),
+      });
+
+    it('should replay the first response for a repeated key', async () => {
+      const first = await (await completion('key-replay')).json();
+      const second = await (await completion('key-replay')).json();
+
+      expect(second).toEqual(first);
+    });
+
+    it('should generate a fresh response for a different key', async () => {
+      const first = await (await completion('key-one')).json();
+      const second = await (await completion('key-two')).json();
+
+      expect(second.id).not.toBe(first.id);
+    });
+
+    it('should generate a fresh response once the key expires', async () => {
+      const shortLivedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        idempotency: { ttlMs: 20, maxEntries: 10 },
+      });
+
+      const first = await (await completion('key-expiry', shortLivedApp)).json();
+      await new Promise(resolve => setTimeout(resolve, 40));
+      const second = await (await completion('key-expiry', shortLivedApp)).json();
+
+      expect(second.id).not.toBe(first.id);
+    });
+
+    it('should mark replays with Idempotent-Replay', async () => {
+      const first = await completion('key-header');
+      const second = await completion('key-header');
+
+      expect(first.headers.get('Idempotent-Replay')).toBeNull();
+      expect(second.headers.get('Idempotent-Replay')).toBe('true');
+      expect(await second.json()).toEqual(await first.json());
+    });
+
+    it('should reject a key reused with a different body', async () => {
+      await completion('key-conflict');
+      const conflicting = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+          'Idempotency-Key': 'key-conflict',
+        },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Something else' }] }),
+      });
+
+      expect(conflicting.status).toBe(409);
+      const body = await conflicting.json();
+      expect(body.error.type).toBe('invalid_request_error');
+      expect(body.error.code).toBe('idempotency_key_conflict');
+    });
+
+    it('should replay a finished stream as the same events', async () => {
+      const stream = () =>
+        app.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+            'Idempotency-Key': 'key-stream',
+          },
+          body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Stream me' }], stream: true }),
+        });
+
+      const first = await stream();
+      const original = await first.text();
+      const second = await stream();
+
+      expect(second.status).toBe(200);
+      expect(second.headers.get('Content-Type')).toContain('text/event-stream');
+      expect(second.headers.get('Idempotent-Replay')).toBe('true');
+      expect(await second.text()).toBe(original);
+      expect(original.endsWith('data: [DONE]\n\n')).toBe(true);
+    });
+
+    it('should count replays and conflicts at /admin/idempotency', async () => {
+      const adminApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+
+      await completion('key-stats', adminApp);
+      await completion('key-stats', adminApp);
+      const res = await adminApp.request('/admin/idempotency', {
+        headers: { 'Authorization': `Bearer ${testAPIKey}` },
+      });
+
+      expect(res.status).toBe(200);
+      expect(await res.json()).toMatchObject({ entries: 1, hits: 1, misses: 1, conflicts: 0 });
+    });
+  });
+
+  describe('Admin Log Stream', () => {
+    it('should not exist unless admin is enabled', async () => {
+      const res = await app.request('/admin/logs', {
+        headers: { 'Authorization': `Bearer ${testAPIKey}` },
+      });
+
+      expect(res.status).toBe(404);
+    });
+
+    it('should require authentication', async () => {
+      const adminApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+
+      const res = await adminApp.request('/admin/logs');
+
+      expect(res.status).toBe(401);
+    });
+
+    it('should stream log events for requests made while subscribed', async () => {
+      const adminApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+
+      const res = await adminApp.request('/admin/logs', {
+        headers: { 'Authorization': `Bearer ${testAPIKey}` },
+      });
+      expect(res.status).toBe(200);
+      expect(res.headers.get('content-type')).toContain('text/event-stream');
+
+      const completion = await adminApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'Log me' }],
+        }),
+      });
+      const requestId = completion.headers.get('x-request-id');
+
+      const reader = res.body!.getReader();
+      const decoder = new TextDecoder();
+      let buffered = '';
+      let found: any;
+      while (!found) {
+        const { done, value } = await reader.read();
+        if (done) break;
+        buffered += decoder.decode(value, { stream: true });
+        // Only complete events (terminated by a blank line) are parsed
+        found = buffered
+          .split('\n\n')
+          .slice(0, -1)
+          .map(event => JSON.parse(event.slice('data: '.length)))
+          .find(entry => entry.message === 'Chat completion completed' && entry.request_id === requestId);
+      }
+      await reader.cancel();
+
+      expect(found).toMatchObject({
+        level: 'info',
+        model: 'echo',
+        request_id: requestId,
+      });
+    });
+  });
+
+  describe('Admin Request History', () => {
+    let historyApp: ReturnType<typeof createApp>;
+    const admin = (path: string, init: RequestInit = {}) =>
+      historyApp.request(path, { ...init, headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+    const complete = (body: Record<string, unknown>, apiKey = testAPIKey) =>
+      historyApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${apiKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+      });
+    const ids = async (query: string) =>
+      (await (await admin(`/admin/requests${query}`)).json()).data.map((summary: { id: string }) => summary.id);
+
+    let ok: string, streamed: string, unknownModel: string, unauthorized: string, eliza: string;
+
+    beforeAll(async () => {
+      historyApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true, requestHistory: 10 } });
+      const requestId = (res: Response) => res.headers.get('x-request-id')!;
+
+      ok = requestId(await complete({ model: 'echo', messages: [{ role: 'user', content: 'Remember me' }] }));
+      const stream = await complete({ model: 'echo', messages: [{ role: 'user', content: 'Stream me' }], stream: true });
+      await stream.text();
+      streamed = requestId(stream);
+      unknownModel = requestId(await complete({ model: 'nonexistent-model', messages: [{ role: 'user', content: 'Hi' }] }));
+      unauthorized = requestId(
+        await complete({ model: 'echo', messages: [{ role: 'user', content: 'Let me in' }] }, 'wrong-key'),
+      );
+      eliza = requestId(await complete({ model: 'eliza', messages: [{ role: 'user', content: 'I feel tested' }] }));
+    });
+
+    it('should not exist unless admin is enabled', async () => {
+      const res = await app.request('/admin/requests', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+
+      expect(res.status).toBe(404);
+    });
+
+    it('should list every request newest first, failures included', async () => {
+      const res = await admin('/admin/requests');
+      const data = await res.json();
+
+      expect(data.object).toBe('list');
+      expect(data.data.map((summary: { id: string }) => summary.id)).toEqual([
+        eliza, unauthorized, unknownModel, streamed, ok,
+      ]);
+      expect(data.data[4]).toMatchObject({
+        id: ok,
+        key_label: testAPIKey.slice(0, 6) + '***',
+        method: 'POST',
+        path: '/v1/chat/completions',
+        model: 'echo',
+        status: 200,
+        streaming: false,
+        timestamp: expect.any(String),
+        duration_ms: expect.any(Number),
+      });
+      expect(data.data[4].total_tokens).toBeGreaterThan(0);
+      expect(data.data[4]).not.toHaveProperty('request');
+    });
+
+    it('should filter by model, status and limit', async () => {
+      expect(await ids('?model=echo')).toEqual([unauthorized, streamed, ok]);
+      expect(await ids('?status=4xx')).toEqual([unauthorized, unknownModel]);
+      expect(await ids('?status=401')).toEqual([unauthorized]);
+      expect(await ids('?model=echo&status=2xx&limit=1')).toEqual([streamed]);
+      expect(await ids('?model=nonexistent-model')).toEqual([unknownModel]);
+    });
+
+    it('should reject invalid filters', async () => {
+      expect((await admin('/admin/requests?status=bad')).status).toBe(400);
+      expect((await admin('/admin/requests?limit=0')).status).toBe(400);
+    });
+
+    it('should return the full request and response with Authorization redacted', async () => {
+      const res = await admin(`/admin/requests/${ok}`);
+      const data = await res.json();
+
+      expect(data.request.headers.authorization).toBe('[redacted]');
+      expect(JSON.stringify(data)).not.toContain(testAPIKey);
+      expect(JSON.parse(data.request.body).messages[0].content).toBe('Remember me');
+      expect(data.request.body_truncated).toBe(false);
+      expect(JSON.parse(data.response.body).choices[0].message.content).toBe('Remember me');
+      expect(data.response.headers['x-request-id']).toBe(ok);
+
+      const failed = await (await admin(`/admin/requests/${unauthorized}`)).json();
+      expect(failed.request.headers.authorization).toBe('[redacted]');
+      expect(JSON.parse(failed.response.body).error).toBeDefined();
+    });
+
+    it('should record a streamed response once it ends', async () => {
+      const data = await (await admin(`/admin/requests/${streamed}`)).json();
+
+      expect(data.streaming).toBe(true);
+      expect(data.response.body).toContain('Stream me');
+      expect(data.response.body).toContain('data: [DONE]');
+    });
+
+    it('should cap the bodies it keeps', async () => {
+      const id = (await complete({ model: 'echo', messages: [{ role: 'user', content: 'x'.repeat(100_000) }] }))
+        .headers.get('x-request-id');
+      const data = await (await admin(`/admin/requests/${id}`)).json();
+
+      expect(data.request.body_truncated).toBe(true);
+      expect(data.request.body.length).toBe(64 * 1024);
+      expect(data.request.body_bytes).toBeGreaterThan(100_000);
+      expect(data.response.body_truncated).toBe(true);
+    });
+
+    it('should 404 for requests it doesn\'t have', async () => {
+      expect((await admin('/admin/requests/unknown')).status).toBe(404);
+    });
+
+    it('should forget every request on DELETE', async () => {
+      const cleared = await (await admin('/admin/requests', { method: 'DELETE' })).json();
+
+      expect(cleared.cleared).toBeGreaterThan(0);
+      expect(await ids('')).toEqual([]);
+      expect((await admin(`/admin/requests/${ok}`)).status).toBe(404);
+    });
+  });
+
+  describe('Header Overrides', () => {
+    const overridableApp = createApp({ auth: { apiKey: testAPIKey }, allowHeaderOverrides: true });
+    const complete = (
+      overrideApp: ReturnType<typeof createApp>,
+      headers: Record<string, string>,
+      body: Record<string, unknown> = { model: 'echo', messages: [{ role: 'user', content: 'Hello there' }] },
+    ) =>
+      overrideApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+          ...headers,
+        },
+        body: JSON.stringify(body),
+      });
+
+    it('should let the model header take precedence over the body', async () => {
+      const res = await complete(overridableApp, { 'X-TeenyTiny-Model': 'acronym' });
+
+      expect(res.status).toBe(200);
+      expect(res.headers.get('X-TeenyTiny-Overrides-Applied')).toBe('model');
+      const body = await res.json();
+      expect(body.model).toBe('acronym');
+    });
+
+    it('should keep body fields the headers leave alone', async () => {
+      const res = await complete(
+        overridableApp,
+        { 'X-TeenyTiny-Chunking': 'char' },
+        { model: 'echo', messages: [{ role: 'user', content: 'Hi you' }], stream: true },
+      );
+
+      const deltas = (await res.text())
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)))
+        .map(chunk => chunk.choices[0]?.delta.content)
+        .filter((content): content is string => content !== undefined);
+      expect(res.headers.get('X-TeenyTiny-Overrides-Applied')).toBe('chunking');
+      expect(deltas).toEqual(['H', 'i', ' ', 'y', 'o', 'u']);
+    });
+
+    it('should delay the response', async () => {
+      const start = Date.now();
+      const res = await complete(overridableApp, { 'X-TeenyTiny-Delay': '100' });
+
+      expect(res.status).toBe(200);
+      expect(Date.now() - start).toBeGreaterThanOrEqual(90);
+    });
+
+    it('should force the status with a matching error and list every override applied', async () => {
+      const res = await complete(overridableApp, {
+        'X-TeenyTiny-Model': 'eliza',
+        'X-TeenyTiny-Force-Status': '429',
+      });
+
+      expect(res.status).toBe(429);
+      expect(res.headers.get('X-TeenyTiny-Overrides-Applied')).toBe('model, force-status');
+      const body = await res.json();
+      expect(body.error).toMatchObject({ type: 'rate_limit_error', code: 'forced_status' });
+    });
+
+    it('should reject malformed override values naming the header', async () => {
+      const res = await complete(overridableApp, { 'X-TeenyTiny-Delay': 'soon' });
+
+      expect(res.status).toBe(400);
+      expect((await res.json()).error.param).toBe('X-TeenyTiny-Delay');
+    });
+
+    it('should ignore override headers unless enabled', async () => {
+      const res = await complete(app, { 'X-TeenyTiny-Model': 'acronym', 'X-TeenyTiny-Force-Status': '500' });
+
+      expect(res.status).toBe(200);
+      expect(res.headers.get('X-TeenyTiny-Overrides-Applied')).toBeNull();
+      expect((await res.json()).model).toBe('echo');
+    });
+  });
+
+  describe('Usage Trailers', () => {
+    // Trailers never reach app.request or fetch, so this goes over a real socket
+    const streamOverHTTP = (trailerApp: ReturnType<typeof createApp>) =>
+      new Promise<{ headers: Record<string, unknown>; body: string; trailers: Record<string, unknown> }>((resolve, reject) => {
+        const server = serve({ fetch: trailerApp.fetch, hostname: '127.0.0.1', port: 0 }, (info) => {
+          const req = httpRequest(
+            {
+              host: '127.0.0.1',
+              port: info.port,
+              path: '/v1/chat/completions',
+              method: 'POST',
+              headers: {
+                'Authorization': `Bearer ${testAPIKey}`,
+                'Content-Type': 'application/json',
+              },
+            },
+            (res) => {
+              let body = '';
+              res.setEncoding('utf8');
+              res.on('data', (chunk) => (body += chunk));
+              res.on('end', () => {
+                server.close();
+                resolve({ headers: res.headers, body, trailers: res.trailers });
+              });
+            }
+          );
+          req.on('error', reject);
+          req.end(JSON.stringify({
+            model: 'echo',
+            messages: [{ role: 'user', content: 'Count my tokens please' }],
+            stream: true,
+          }));
+        });
+      });
+
+    it('should send usage as trailers after the stream when enabled', async () => {
+      const { headers, body, trailers } = await streamOverHTTP(
+        createApp({ auth: { apiKey: testAPIKey }, usageTrailers: true })
+      );
+
+      expect(headers['trailer']).toBe('X-Usage-Prompt-Tokens, X-Usage-Completion-Tokens, X-Usage-Total-Tokens');
+      expect(body.trimEnd().endsWith('data: [DONE]')).toBe(true);
+      const usage = body
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)))
+        .find(chunk => chunk.usage)?.usage;
+      expect(trailers).toEqual({
+        'x-usage-prompt-tokens': String(usage.prompt_tokens),
+        'x-usage-completion-tokens': String(usage.completion_tokens),
+        'x-usage-total-tokens': String(usage.total_tokens),
+      });
+      expect(Number(trailers['x-usage-total-tokens'])).toBe(18);
+    });
+
+    it('should send no trailers by default', async () => {
+      const { headers, trailers } = await streamOverHTTP(createApp({ auth: { apiKey: testAPIKey } }));
+
+      expect(headers['trailer']).toBeUndefined();
+      expect(trailers).toEqual({});
+    });
+  });
+
+  describe('Shadow Mirroring', () => {
+    const shadowKey = 'tt-shadow-key-456';
+    const shadowApp = createApp({ auth: { apiKey: shadowKey } });
+    const shadowRequests: Array<Record<string, unknown>> = [];
+    let shadowServer: ReturnType<typeof serve>;
+    let baseUrl = '';
+
+    beforeAll(async () => {
+      await new Promise<void>((resolve) => {
+        shadowServer = serve({
+          fetch: async (req) => {
+            shadowRequests.push(await req.clone().json());
+            return shadowApp.fetch(req);
+          },
+          hostname: '127.0.0.1',
+          port: 0,
+        }, (info) => {
+          baseUrl = `http://127.0.0.1:${info.port}/v1`;
+          resolve();
+        });
+      });
+    });
+
+    afterAll(() => {
+      shadowServer.close();
+    });
+
+    const mirroredApp = (apiKey: string) =>
+      createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        shadow: { baseUrl, apiKey },
+      });
+    const complete = (primaryApp: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      primaryApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+      });
+    const summaryOnce = async (primaryApp: ReturnType<typeof createApp>, compared: number) => {
+      for (let i = 0; i < 100; i++) {
+        const res = await primaryApp.request('/admin/shadow', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+        const summary = await res.json();
+        if (summary.succeeded + summary.failed >= compared) {
+          return summary;
+        }
+        await new Promise((resolve) => setTimeout(resolve, 10));
+      }
+      throw new Error('Shadow comparisons never completed');
+    };
+
+    it('should replay requests to the shadow without streaming and compare the results', async () => {
+      const primaryApp = mirroredApp(shadowKey);
+      shadowRequests.splice(0);
+
+      const plain = await complete(primaryApp, { model: 'echo', messages: [{ role: 'user', content: 'Mirror me' }] });
+      expect(plain.status).toBe(200);
+      const streamed = await complete(primaryApp, {
+        model: 'echo',
+        messages: [{ role: 'user', content: 'Stream me' }],
+        stream: true,
+        stream_options: { include_usage: true },
+      });
+      expect(streamed.headers.get('Content-Type')).toContain('text/event-stream');
+      await streamed.text();
+
+      const summary = await summaryOnce(primaryApp, 2);
+
+      expect(summary).toMatchObject({ mirrored: 2, succeeded: 2, failed: 0, status_mismatches: 0, skipped: 0 });
+      expect(shadowRequests.map((request) => request.stream)).toEqual([false, false]);
+      expect(shadowRequests[1]).not.toHaveProperty('stream_options');
+      for (const record of summary.recent) {
+        expect(record.primary.status).toBe(200);
+        expect(record.shadow.status).toBe(200);
+        expect(record.deltas.total_tokens).toBe(0);
+        expect(typeof record.deltas.latency_ms).toBe('number');
+      }
+    });
+
+    it('should record shadow failures without affecting the primary response', async () => {
+      const primaryApp = mirroredApp('wrong-key');
+
+      const res = await complete(primaryApp, { model: 'echo', messages: [{ role: 'user', content: 'Still fine' }] });
+      expect(res.status).toBe(200);
+      expect((await res.json()).choices[0].message.content).toBe('Still fine');
+
+      const summary = await summaryOnce(primaryApp, 1);
+      expect(summary).toMatchObject({ succeeded: 0, failed: 1, status_mismatches: 1 });
+      expect(summary.recent[0].shadow.status).toBe(401);
+    });
+  });
+
+  describe('Webhooks', () => {
+    const received: Array<{ body: string; signature: string | undefined }> = [];
+    const receiver = createServer((req, res) => {
+      let body = '';
+      req.on('data', (chunk) => (body += chunk));
+      req.on('end', () => {
+        received.push({ body, signature: req.headers['x-teenytiny-signature'] as string | undefined });
+        res.writeHead(204).end();
+      });
+    });
+    let url = '';
+
+    beforeAll(async () => {
+      await new Promise<void>((resolve) => receiver.listen(0, '127.0.0.1', resolve));
+      url = `http://127.0.0.1:${(receiver.address() as AddressInfo).port}/hook`;
+    });
+
+    afterAll(() => {
+      receiver.close();
+    });
+
+    const waitForDeliveries = async (count: number) => {
+      for (let i = 0; i < 100 && received.length < count; i++) {
+        await new Promise((resolve) => setTimeout(resolve, 10));
+      }
+      return received.splice(0).map(({ body, signature }) => ({ event: JSON.parse(body), body, signature }));
+    };
+
+    const complete = (hookedApp: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      hookedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+      });
+
+    it('should post a signed summary of each completion, streamed or failed', async () => {
+      const hookedApp = createApp({ auth: { apiKey: testAPIKey }, webhook: { url, secret: 'hook-secret' } });
+
+      expect((await complete(hookedApp, { model: 'echo', messages: [{ role: 'user', content: 'Hello there' }] })).status).toBe(200);
+      const streamed = await complete(hookedApp, {
+        model: 'echo',
+        messages: [{ role: 'user', content: 'Streamed' }],
+        stream: true,
+        stream_options: { include_usage: true },
+      });
+      await streamed.text();
+      expect((await complete(hookedApp, { model: 'missing', messages: [{ role: 'user', content: 'Hi' }] })).status).toBe(400);
+
+      const deliveries = await waitForDeliveries(3);
+
+      expect(deliveries).toHaveLength(3);
+      for (const { body, signature } of deliveries) {
+        expect(signature).toBe(`sha256=${createHmac('sha256', 'hook-secret').update(body).digest('hex')}`);
+      }
+      const [plain, stream, failed] = deliveries.map(({ event }) => event);
+      expect(plain).toEqual({
+        event: 'chat.completion',
+        request_id: expect.any(String),
+        key_label: 'tt-tes***',
+        model: 'echo',
+        streaming: false,
+        status: 200,
+        prompt_tokens: 9,
+        completion_tokens: 3,
+        total_tokens: 12,
+        duration_ms: expect.any(Number),
+        timestamp: expect.any(String),
+      });
+      expect(stream).toMatchObject({ model: 'echo', streaming: true, status: 200 });
+      expect(stream.total_tokens).toBeGreaterThan(0);
+      expect(failed).toMatchObject({ model: null, status: 400, total_tokens: 0 });
+    });
+
+    it('should export delivery counts to /metrics', async () => {
+      const hookedApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true }, webhook: { url } });
+      await complete(hookedApp, { model: 'echo', messages: [{ role: 'user', content: 'Hi' }] });
+      await waitForDeliveries(1);
+
+      // Counted once the receiver has answered
+      let metrics = '';
+      for (let i = 0; i < 100 && !metrics.includes('result="delivered"} 1'); i++) {
+        await new Promise((resolve) => setTimeout(resolve, 10));
+        metrics = await (await hookedApp.request('/metrics', { headers: { 'Authorization': `Bearer ${testAPIKey}` } })).text();
+      }
+      expect(metrics.split('\n')).toEqual(
+        expect.arrayContaining([
+          'teenytiny_webhook_queued 0',
+          'teenytiny_webhook_notifications_total{result="delivered"} 1',
+          'teenytiny_webhook_notifications_total{result="failed"} 0',
+          'teenytiny_webhook_notifications_total{result="dropped"} 0',
+        ]),
+      );
+    });
+
+    it('should only notify about events passing the filters', async () => {
+      const hookedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        maxPromptTokens: 8,
+        webhook: { url, filter: { errorsOnly: true, models: ['echo'] } },
+      });
+
+      await complete(hookedApp, { model: 'echo', messages: [{ role: 'user', content: 'Fine' }] });
+      await complete(hookedApp, { model: 'echo', messages: [{ role: 'user', content: 'Far too long a prompt' }] });
+      await complete(hookedApp, { model: 'missing', messages: [{ role: 'user', content: 'Hi' }] });
+
+      const deliveries = await waitForDeliveries(1);
+      // Give any unexpected extra notification time to arrive
+      await new Promise((resolve) => setTimeout(resolve, 50));
+
+      expect(deliveries.concat(await waitForDeliveries(0)).map(({ event }) => [event.model, event.status])).toEqual([
+        ['echo', 400],
+      ]);
+    });
+  });
+
+  describe('Response Cache', () => {
+    const cachedApp = () =>
+      createApp({
+        auth: { apiKey: testAPIKey },
+        cache: { ttlMs: 60_000, maxEntries: 10 },
+        admin: { enabled: true },
+      });
+    const complete = (cacheApp: ReturnType<typeof createApp>, body: Record<string, unknown>) =>
+      cacheApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+      });
+    const admin = (cacheApp: ReturnType<typeof createApp>, method: string) =>
+      cacheApp.request('/admin/cache', { method, headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+
+    it('should replay byte-identical responses to identical requests', async () => {
+      const cacheApp = cachedApp();
+      const request = { model: 'echo', messages: [{ role: 'user', content: 'Cache me' }] };
+
+      const first = await complete(cacheApp, request);
+      const second = await complete(cacheApp, request);
+
+      expect(first.headers.get('x-teenytiny-cache')).toBe('miss');
+      expect(second.headers.get('x-teenytiny-cache')).toBe('hit');
+      expect(second.headers.get('Content-Type')).toContain('application/json');
+      const body = await second.text();
+      expect(body).toBe(await first.text());
+      expect(JSON.parse(body).id).toMatch(/^chatcmpl-/);
+
+      const different = await complete(cacheApp, { ...request, max_tokens: 1 });
+      expect(different.headers.get('x-teenytiny-cache')).toBe('miss');
+
+      expect(await (await admin(cacheApp, 'GET')).json()).toEqual({ entries: 2, hits: 1, misses: 2 });
+    });
+
+    it('should not replay replies with other logprobs', async () => {
+      const cacheApp = cachedApp();
+      const request = { model: 'echo', messages: [{ role: 'user', content: 'Cache me' }] };
+
+      await complete(cacheApp, request);
+      const withLogprobs = await complete(cacheApp, { ...request, logprobs: true });
+      expect(withLogprobs.headers.get('x-teenytiny-cache')).toBe('miss');
+      expect((await withLogprobs.json()).choices[0].logprobs.content[0].top_logprobs).toEqual([]);
+
+      const withTop = await complete(cacheApp, { ...request, logprobs: true, top_logprobs: 2 });
+      expect(withTop.headers.get('x-teenytiny-cache')).toBe('miss');
+      expect((await withTop.json()).choices[0].logprobs.content[0].top_logprobs).toHaveLength(2);
+
+      const without = await complete(cacheApp, request);
+      expect(without.headers.get('x-teenytiny-cache')).toBe('hit');
+      expect((await without.json()).choices[0]).not.toHaveProperty('logprobs');
+    });
+
+    it('should never cache seedless random models or streams', async () => {
+      const cacheApp = cachedApp();
+      // Blank input gets eliza's fixed reply, so no random choice is needed
+      const request = { model: 'eliza', messages: [{ role: 'user', content: ' ' }] };
+
+      const first = await complete(cacheApp, request);
+      const second = await complete(cacheApp, request);
+      const streamed = await complete(cacheApp, {
+        model: 'echo',
+        messages: [{ role: 'user', content: 'Hi' }],
+        stream: true,
+      });
+      await streamed.text();
+
+      expect([first.status, second.status, streamed.status]).toEqual([200, 200, 200]);
+      expect(first.headers.get('x-teenytiny-cache')).toBeNull();
+      expect(second.headers.get('x-teenytiny-cache')).toBeNull();
+      expect(streamed.headers.get('x-teenytiny-cache')).toBeNull();
+      expect(await (await admin(cacheApp, 'GET')).json()).toEqual({ entries: 0, hits: 0, misses: 0 });
+    });
+
+    it('should miss again after a flush', async () => {
+      const cacheApp = cachedApp();
+      const request = { model: 'echo', messages: [{ role: 'user', content: 'Flush me' }] };
+      await complete(cacheApp, request);
+
+      const flushed = await admin(cacheApp, 'DELETE');
+      expect(flushed.status).toBe(200);
+      expect((await flushed.json()).entries).toBe(0);
+
+      expect((await complete(cacheApp, request)).headers.get('x-teenytiny-cache')).toBe('miss');
+    });
+
+    it('should leave responses uncached by default', async () => {
+      const res = await complete(app, { model: 'echo', messages: [{ role: 'user', content: 'Hi' }] });
+
+      expect(res.headers.get('x-teenytiny-cache')).toBeNull();
+    });
+  });
+
+  describe('Rate Limits', () => {
+    const limitedApp = createApp({
+      auth: { apiKey: testAPIKey },
+      rateLimits: {
+        endpoints: {
+          '/v1/chat/completions': { requests: 2, windowMs: 60_000 },
+          '/v1/embeddings': { requests: 100, windowMs: 60_000 },
+        },
+      },
+    });
+    const post = (path: string, body: Record<string, unknown>) =>
+      limitedApp.request(path, {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(body),
+      });
+    const chat = () => post('/v1/chat/completions', { model: 'echo', messages: [{ role: 'user', content: 'Hi' }] });
+    const embeddings = () => post('/v1/embeddings', { model: 'embedding', input: 'Hi' });
+
+    it('should throttle chat completions without throttling embeddings', async () => {
+      expect((await chat()).status).toBe(200);
+      const second = await chat();
+      expect(second.status).toBe(200);
+      expect(second.headers.get('x-ratelimit-remaining-requests')).toBe('0');
+
+      const throttled = await chat();
+      expect(throttled.status).toBe(429);
+      expect(Number(throttled.headers.get('Retry-After'))).toBeGreaterThan(0);
+      expect(Number(throttled.headers.get('Retry-After'))).toBeLessThanOrEqual(60);
+      const body = await throttled.json();
+      expect(body.error.type).toBe('rate_limit_error');
+      expect(body.error.code).toBe('rate_limit_exceeded');
+
+      for (let i = 0; i < 5; i++) {
+        const res = await embeddings();
+        expect(res.status).toBe(200);
+        expect(res.headers.get('x-ratelimit-limit-requests')).toBe('100');
+      }
+    });
+
+    it('should count down the remaining requests across successive requests', async () => {
+      const counting = createApp({
+        auth: { apiKey: testAPIKey },
+        rateLimits: { endpoints: { '/v1/chat/completions': { requests: 5, windowMs: 60_000 } } },
+      });
+      const remaining: (string | null)[] = [];
+      for (let i = 0; i < 3; i++) {
+        const res = await counting.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Hi' }] }),
+        });
+        expect(res.headers.get('x-ratelimit-limit-requests')).toBe('5');
+        expect(res.headers.get('x-ratelimit-reset-requests')).toMatch(/^\d+s$/);
+        expect(res.headers.get('x-ratelimit-limit-tokens')).toBeNull();
+        remaining.push(res.headers.get('x-ratelimit-remaining-requests'));
+      }
+
+      expect(remaining).toEqual(['4', '3', '2']);
+    });
+
+    it('should report and enforce token limits', async () => {
+      const tokenLimited = createApp({
+        auth: { apiKey: testAPIKey },
+        rateLimits: { endpoints: { '/v1/chat/completions': { requests: 100, tokens: 20, windowMs: 60_000 } } },
+      });
+      const chatUsage = () =>
+        tokenLimited.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ model: 'usage', messages: [{ role: 'user', content: 'prompt=10 completion=5' }] }),
+        });
+
+      const first = await chatUsage();
+      expect(first.status).toBe(200);
+      expect(first.headers.get('x-ratelimit-limit-tokens')).toBe('20');
+      expect(first.headers.get('x-ratelimit-remaining-tokens')).toBe('5');
+      expect(first.headers.get('x-ratelimit-reset-tokens')).toMatch(/^\d+s$/);
+
+      expect((await chatUsage()).headers.get('x-ratelimit-remaining-tokens')).toBe('0');
+
+      const throttled = await chatUsage();
+      expect(throttled.status).toBe(429);
+      expect(throttled.headers.get('x-ratelimit-remaining-tokens')).toBe('0');
+    });
+
+    it('should not send rate limit headers when limiting is disabled', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Hi' }] }),
+      });
+
+      expect(res.headers.get('x-ratelimit-limit-requests')).toBeNull();
+      expect(res.headers.get('x-ratelimit-remaining-requests')).toBeNull();
+      expect(res.headers.get('x-ratelimit-limit-tokens')).toBeNull();
+    });
+
+    it('should apply per-key limits in place of the endpoint default', async () => {
+      const generous = createApp({
+        auth: { apiKey: testAPIKey },
+        rateLimits: {
+          endpoints: { '/v1/chat/completions': { requests: 1, windowMs: 60_000 } },
+          keys: { [testAPIKey]: { '/v1/chat/completions': { requests: 3, windowMs: 60_000 } } },
+        },
+      });
+      const statuses: number[] = [];
+      for (let i = 0; i < 4; i++) {
+        const res = await generous.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Hi' }] }),
+        });
+        statuses.push(res.status);
+      }
+
+      expect(statuses).toEqual([200, 200, 200, 429]);
+    });
+  });
+
+  describe('System Fingerprint', () => {
+    const fingerprintApp = createApp({
+      auth: { apiKey: testAPIKey },
+      admin: { enabled: true },
+      countdown: { delayMs: 0 },
+    });
+    const auth = { 'Authorization': `Bearer ${testAPIKey}` };
+    const countdown = async (stream: boolean) => {
+      const res = await fingerprintApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { ...auth, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'countdown', messages: [{ role: 'user', content: '3' }], stream }),
+      });
+      if (!stream) {
+        return [(await res.json()).system_fingerprint];
+      }
+      return (await res.text())
+        .split('\n\n')
+        .filter((event) => event.startsWith('data: {'))
+        .map((event) => JSON.parse(event.slice('data: '.length)).system_fingerprint);
+    };
+    const listed = async (listApp: ReturnType<typeof createApp>) => {
+      const models = await (await listApp.request('/v1/models', { headers: auth })).json();
+      return models.data.find((model: { id: string }) => model.id === 'countdown').system_fingerprint;
+    };
+    const reconfigure = (id: string, options: unknown) =>
+      fingerprintApp.request(`/admin/models/${id}/config`, {
+        method: 'PUT',
+        headers: { ...auth, 'Content-Type': 'application/json' },
+        body: JSON.stringify(options),
+      });
+
+    it('should send the fingerprint listed for the model on every response and chunk', async () => {
+      const fingerprint = await listed(fingerprintApp);
+      expect(fingerprint).toMatch(/^fp_[0-9a-f]{10}$/);
+
+      expect(await countdown(false)).toEqual([fingerprint]);
+      expect(await countdown(false)).toEqual([fingerprint]);
+      const chunks = await countdown(true);
+      expect(chunks.length).toBeGreaterThan(2);
+      expect(new Set(chunks)).toEqual(new Set([fingerprint]));
+
+      // Identical deployments agree; other models and configurations differ
+      const twin = createApp({ auth: { apiKey: testAPIKey }, countdown: { delayMs: 0 } });
+      expect(await listed(twin)).toBe(fingerprint);
+      expect(await listed(createApp({ auth: { apiKey: testAPIKey } }))).not.toBe(fingerprint);
+    });
+
+    it('should change the fingerprint when a model is reconfigured', async () => {
+      const before = await listed(fingerprintApp);
+
+      const res = await reconfigure('countdown', { delayMs: 0, maxCount: 2 });
+      expect(res.status).toBe(200);
+      const { system_fingerprint: after } = await res.json();
+
+      expect(after).not.toBe(before);
+      expect(await listed(fingerprintApp)).toBe(after);
+      expect(await countdown(false)).toEqual([after]);
+      expect(new Set(await countdown(true))).toEqual(new Set([after]));
+
+      await reconfigure('countdown', { delayMs: 0 });
+      expect(await listed(fingerprintApp)).toBe(before);
+    });
+
+    it('should reject invalid options and models without any', async () => {
+      expect((await reconfigure('countdown', { delayMs: -5 })).status).toBe(400);
+      expect((await reconfigure('echo', {})).status).toBe(404);
+    });
+  });
+
+  describe('Response ID Prefix', () => {
+    const complete = (stream: boolean, headers: Record<string, string> = {}) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json', ...headers },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Group me' }], stream }),
+      });
+
+    it('should start the completion id with the prefix', async () => {
+      const res = await complete(false, { 'X-Response-ID-Prefix': 'mytest-' });
+
+      expect(res.status).toBe(200);
+      expect((await res.json()).id).toMatch(/^mytest-chatcmpl-[a-zA-Z0-9]{29}$/);
+    });
+
+    it('should start every streamed chunk id with the prefix', async () => {
+      const res = await complete(true, { 'X-Response-ID-Prefix': 'mytest-' });
+      const chunks = parseSSEData(await res.text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data));
+
+      expect(chunks.length).toBeGreaterThan(2);
+      for (const chunk of chunks) {
+        expect(chunk.id).toMatch(/^mytest-chatcmpl-/);
+      }
+      expect(new Set(chunks.map((chunk) => chunk.id)).size).toBe(1);
+    });
+
+    it('should use the default prefix without the header', async () => {
+      const res = await complete(false);
+
+      expect((await res.json()).id).toMatch(/^chatcmpl-/);
+    });
+
+    it('should reject prefixes with unsafe characters', async () => {
+      const res = await complete(false, { 'X-Response-ID-Prefix': 'my test/' });
+
+      expect(res.status).toBe(400);
+      const body = await res.json();
+      expect(body.error.param).toBe('X-Response-ID-Prefix');
+      expect(body.error.message).toContain('X-Response-ID-Prefix');
+    });
+  });
+
+  describe('Organization Headers', () => {
+    const complete = (orgApp: ReturnType<typeof createApp>, headers: Record<string, string>) =>
+      orgApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+          ...headers,
+        },
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Hi' }] }),
+      });
+    const configuredApp = createApp({
+      auth: { apiKey: testAPIKey },
+      organizations: { organizations: ['org-acme'], projects: ['proj_web'] },
+    });
+
+    it('should accept and echo anything when no organizations are configured', async () => {
+      const res = await complete(app, { 'OpenAI-Organization': 'org-anything', 'OpenAI-Project': 'proj_any' });
+
+      expect(res.status).toBe(200);
+      expect(res.headers.get('openai-organization')).toBe('org-anything');
+      expect(res.headers.get('openai-project')).toBe('proj_any');
+    });
+
+    it('should accept configured ids and requests without the headers', async () => {
+      const res = await complete(configuredApp, { 'OpenAI-Organization': 'org-acme', 'OpenAI-Project': 'proj_web' });
+      expect(res.status).toBe(200);
+      expect(res.headers.get('openai-organization')).toBe('org-acme');
+
+      const bare = await complete(configuredApp, {});
+      expect(bare.status).toBe(200);
+      expect(bare.headers.get('openai-organization')).toBeNull();
+    });
+
+    it('should reject unknown organizations and projects with invalid_organization', async () => {
+      for (const headers of [{ 'OpenAI-Organization': 'org-evil' }, { 'OpenAI-Project': 'proj_evil' }]) {
+        const res = await complete(configuredApp, headers);
+
+        expect(res.status).toBe(401);
+        const body = await res.json();
+        expect(body.error.code).toBe('invalid_organization');
+        expect(body.error.message).toContain('evil');
+      }
+    });
+
+    it('should attribute audited usage to the organization and project', async () => {
+      const lines: string[] = [];
+      const auditedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        audit: new AuditLogger({ write: (line) => lines.push(line) }),
+      });
+
+      await complete(auditedApp, { 'OpenAI-Organization': 'org-acme', 'OpenAI-Project': 'proj_web' });
+
+      expect(JSON.parse(lines[0]!)).toMatchObject({ organization: 'org-acme', project: 'proj_web', model: 'echo' });
+    });
+  });
+
+  describe('Per-IP Concurrency Limits', () => {
+    const proxy = { incoming: { socket: { remoteAddress: '10.0.0.1' } } };
+    const limitedApp = createApp({
+      auth: { apiKey: testAPIKey },
+      countdown: { delayMs: 50 },
+      ipLimit: { maxConcurrent: 2 },
+      trustedProxies: ['10.0.0.1'],
+    });
+    const slowStream = (forwardedFor: string, ipApp = limitedApp) =>
+      ipApp.request(
+        '/v1/chat/completions',
+        {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+            'X-Forwarded-For': forwardedFor,
+          },
+          body: JSON.stringify({ model: 'countdown', messages: [{ role: 'user', content: '5' }], stream: true }),
+        },
+        proxy,
+      );
+
+    it('should throttle a client with too many streams open until one ends', async () => {
+      const open = [await slowStream('203.0.113.1'), await slowStream('203.0.113.1')];
+      expect(open.map((res) => res.status)).toEqual([200, 200]);
+
+      const overflow = await slowStream('203.0.113.1');
+      expect(overflow.status).toBe(429);
+      const body = await overflow.json();
+      expect(body.error.type).toBe('rate_limit_error');
+
+      // Another client behind the same proxy has its own slots
+      const neighbour = await slowStream('203.0.113.2');
+      expect(neighbour.status).toBe(200);
+
+      await Promise.all([...open, neighbour].map((res) => res.text()));
+      const later = await slowStream('203.0.113.1');
+      expect(later.status).toBe(200);
+      await later.text();
+    });
+
+    it('should not let untrusted peers pick their IP with X-Forwarded-For', async () => {
+      const untrustingApp = createApp({
+        auth: { apiKey: testAPIKey },
+        countdown: { delayMs: 50 },
+        ipLimit: { maxConcurrent: 1 },
+      });
+
+      const first = await slowStream('203.0.113.1', untrustingApp);
+      const second = await slowStream('203.0.113.2', untrustingApp);
+
+      expect(first.status).toBe(200);
+      expect(second.status).toBe(429);
+      await first.text();
+    });
+  });
+
+  describe('Per-Key Stream Limits', () => {
+    const limitedApp = createApp({
+      auth: { apiKey: testAPIKey },
+      countdown: { delayMs: 50 },
+      maxStreamsPerKey: 3,
+    });
+    const complete = (apiKey: string, stream: boolean) =>
+      limitedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${apiKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'countdown', messages: [{ role: 'user', content: '5' }], stream }),
+      });
+
+    it('should throttle a key with its streams all open, leaving other keys alone', async () => {
+      const { key: otherKey } = await (await limitedApp.request('/site/new-key', { method: 'POST' })).json();
+
+      const open = [
+        await complete(testAPIKey, true),
+        await complete(testAPIKey, true),
+        await complete(testAPIKey, true),
+      ];
+      expect(open.map((res) => res.status)).toEqual([200, 200, 200]);
+
+      const overflow = await complete(testAPIKey, true);
+      expect(overflow.status).toBe(429);
+      const body = await overflow.json();
+      expect(body.error.type).toBe('rate_limit_error');
+      expect(body.error.message).toContain('streams');
+
+      // Other keys have their own slots, and non-streaming requests don't count
+      const other = await complete(otherKey, true);
+      expect(other.status).toBe(200);
+      const unstreamed = await complete(testAPIKey, false);
+      expect(unstreamed.status).toBe(200);
+
+      await Promise.all([...open, other].map((res) => res.text()));
+      const later = await complete(testAPIKey, true);
+      expect(later.status).toBe(200);
+      await later.text();
+    });
+
+    it('should free a slot when the client disconnects mid-stream', async () => {
+      const open = [await complete(testAPIKey, true), await complete(testAPIKey, true)];
+      const abandoned = await complete(testAPIKey, true);
+      expect((await complete(testAPIKey, true)).status).toBe(429);
+
+      await abandoned.body!.cancel();
+      const replacement = await complete(testAPIKey, true);
+      expect(replacement.status).toBe(200);
+
+      await Promise.all([...open, replacement].map((res) => res.text()));
+    });
+  });
+
+  describe('Quotas', () => {
+    const quotaApp = createApp({
+      auth: { apiKey: testAPIKey },
+      admin: { enabled: true },
+      quotas: { keys: { [testAPIKey]: 40 } },
+    });
+    const spend = () =>
+      quotaApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ model: 'usage', messages: [{ role: 'user', content: 'prompt=10 completion=5' }] }),
+      });
+    const admin = (method: string) =>
+      quotaApp.request('/admin/quotas', {
+        method,
+        headers: { 'Authorization': `Bearer ${testAPIKey}` },
+      });
+
+    it('should refuse a key with insufficient_quota once its budget is spent, until reset', async () => {
+      const remaining: Array<string | null> = [];
+      for (let i = 0; i < 3; i++) {
+        const res = await spend();
+        expect(res.status).toBe(200);
+        remaining.push(res.headers.get('X-TeenyTiny-Quota-Remaining-Tokens'));
+      }
+      // The third request started with budget left, so it runs over
+      expect(remaining).toEqual(['25', '10', '0']);
+
+      const refused = await spend();
+      expect(refused.status).toBe(429);
+      expect(refused.headers.get('Retry-After')).toBeNull();
+      expect(refused.headers.get('X-TeenyTiny-Quota-Remaining-Tokens')).toBe('0');
+      const body = await refused.json();
+      expect(body.error.type).toBe('insufficient_quota');
+      expect(body.error.code).toBe('insufficient_quota');
+
+      const quotas = await (await admin('GET')).json();
+      expect(quotas.data).toEqual([{ key: 'tt-tes***', budget: 40, used: 45, remaining: 0 }]);
+
+      expect((await admin('DELETE')).status).toBe(200);
+      const restored = await spend();
+      expect(restored.status).toBe(200);
+      expect(restored.headers.get('X-TeenyTiny-Quota-Remaining-Tokens')).toBe('25');
+    });
+
+    it('should charge streamed completions when the stream ends', async () => {
+      const streamApp = createApp({ auth: { apiKey: testAPIKey }, quotas: { default: 10 } });
+      const stream = () =>
+        streamApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({
+            model: 'usage',
+            messages: [{ role: 'user', content: 'prompt=6 completion=6' }],
+            stream: true,
+          }),
+        });
+
+      const first = await stream();
+      expect(first.headers.get('X-TeenyTiny-Quota-Remaining-Tokens')).toBe('10');
+      await first.text();
+
+      const second = await stream();
+      expect(second.status).toBe(429);
+      expect((await second.json()).error.code).toBe('insufficient_quota');
+    });
+
+    it('should report quotas as not enabled without a config', async () => {
+      const adminApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+      const res = await adminApp.request('/admin/quotas', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+
+      expect(res.status).toBe(404);
+    });
+  });
+
+  describe('Embeddings', () => {
+    it('should return a vector per input', async () => {
+      const res = await app.request('/v1/embeddings', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ model: 'embedding', input: ['first text', 'second text'] }),
+      });
+
+      expect(res.status).toBe(200);
+      const body = await res.json();
+      expect(body.object).toBe('list');
+      expect(body.data.map((item: { index: number }) => item.index)).toEqual([0, 1]);
+      expect(body.data[0].embedding).toHaveLength(8);
+      expect(body.data[0].embedding).not.toEqual(body.data[1].embedding);
+      expect(body.usage).toEqual({ prompt_tokens: 6, total_tokens: 6 });
+    });
+
+    it('should embed a large batch in input order', async () => {
+      const embeddings = (input: string | string[], embeddingApp = app) =>
+        embeddingApp.request('/v1/embeddings', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ model: 'embedding', input }),
+        });
+      const inputs = Array.from({ length: 100 }, (_, i) => `text number ${i % 90}`);
+
+      const res = await embeddings(inputs);
+      expect(res.status).toBe(200);
+      const body = await res.json();
+      expect(body.data.map((item: { index: number }) => item.index)).toEqual(inputs.map((_, i) => i));
+      for (const i of [0, 42, 95]) {
+        const single = await (await embeddings(inputs[i]!)).json();
+        expect(body.data[i].embedding).toEqual(single.data[0].embedding);
+      }
+      expect(body.data[95].embedding).toEqual(body.data[5].embedding);
+      expect(body.data[95].embedding).not.toEqual(body.data[94].embedding);
+
+      const limited = createApp({ auth: { apiKey: testAPIKey }, maxEmbeddingBatchSize: 3 });
+      expect((await embeddings(['a', 'b', 'c'], limited)).status).toBe(200);
+      const oversized = await embeddings(['a', 'b', 'c', 'd'], limited);
+      expect(oversized.status).toBe(400);
+      const error = (await oversized.json()).error;
+      expect(error.param).toBe('input');
+      expect(error.message).toContain('at most 3 inputs');
+    });
+
+    it('should return vectors of the requested dimensions', async () => {
+      const embedding = async (body: Record<string, unknown>, embeddingApp = app) => {
+        const res = await embeddingApp.request('/v1/embeddings', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ model: 'embedding', input: 'Shorter please', ...body }),
+        });
+        return res.json();
+      };
+
+      expect((await embedding({ dimensions: 3 })).data[0].embedding).toHaveLength(3);
+      expect((await embedding({ dimensions: 256 })).data[0].embedding).toHaveLength(256);
+
+      const configured = createApp({ auth: { apiKey: testAPIKey }, embeddingDimensions: 5, maxEmbeddingDimensions: 16 });
+      expect((await embedding({}, configured)).data[0].embedding).toHaveLength(5);
+      for (const dimensions of [0, 17, 2.5, '4']) {
+        expect((await embedding({ dimensions }, configured)).error.param).toBe('dimensions');
+      }
+    });
+
+    it('should encode vectors as base64 little-endian float32 when asked', async () => {
+      const embedding = async (body: Record<string, unknown>) => {
+        const res = await app.request('/v1/embeddings', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ model: 'embedding', input: 'Pack me', dimensions: 64, ...body }),
+        });
+        return res.json();
+      };
+
+      const floats: number[] = (await embedding({ encoding_format: 'float' })).data[0].embedding;
+      const base64: string = (await embedding({ encoding_format: 'base64' })).data[0].embedding;
+      expect(typeof base64).toBe('string');
+
+      const bytes = Buffer.from(base64, 'base64');
+      expect(bytes.length).toBe(64 * 4);
+      const decoded = Array.from({ length: 64 }, (_, i) => bytes.readFloatLE(i * 4));
+      decoded.forEach((value, i) => expect(value).toBeCloseTo(floats[i]!, 6));
+
+      expect((await embedding({})).data[0].embedding).toEqual(floats);
+      expect((await embedding({ encoding_format: 'binary' })).error.param).toBe('encoding_format');
+    });
+
+    it('should reject other models and empty input', async () => {
+      const post = (body: Record<string, unknown>) =>
+        app.request('/v1/embeddings', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify(body),
+        });
+
+      expect((await (await post({ model: 'echo', input: 'Hi' })).json()).error.param).toBe('model');
+      expect((await (await post({ model: 'embedding', input: [] })).json()).error.param).toBe('input');
+    });
+  });
+
+  describe('Request Queueing', () => {
+    // 40 characters is 10 prompt tokens, so each request takes about 100ms
+    const slow = async (queuedApp: ReturnType<typeof createApp>, stream = false, extra: Record<string, unknown> = {}) => {
+      const res = await queuedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'slowprompt',
+          messages: [{ role: 'user', content: 'x'.repeat(40) }],
+          stream,
+          ...extra,
+        }),
+      });
+      return { res, body: await res.text() };
+    };
+    const pause = (ms: number) => new Promise((resolve) => setTimeout(resolve, ms));
+
+    const queuedApp = (maxConcurrent: number, maxQueued: number) =>
+      createApp({
+        auth: { apiKey: testAPIKey },
+        queue: { maxConcurrent, maxQueued },
+        promptLatencyMsPerToken: 10,
+      });
+
+    it('should report the wait of requests queued behind a saturated server', async () => {
+      const saturated = queuedApp(1, 2);
+
+      const results = await Promise.all([slow(saturated), slow(saturated), slow(saturated)]);
+
+      expect(results.map(({ res }) => res.status)).toEqual([200, 200, 200]);
+      const waits = results
+        .map(({ res }) => res.headers.get('x-queue-wait-ms'))
+        .filter((wait): wait is string => wait !== null)
+        .map(Number)
+        .sort((a, b) => a - b);
+      expect(waits).toHaveLength(2);
+      expect(waits[0]).toBeGreaterThanOrEqual(80);
+      expect(waits[1]).toBeGreaterThanOrEqual(160);
+    });
+
+    it('should hold the slot until a streamed response finishes', async () => {
+      const saturated = queuedApp(1, 1);
+
+      const results = await Promise.all([slow(saturated, true), slow(saturated, true)]);
+
+      expect(results.every(({ body }) => body.includes('data: [DONE]'))).toBe(true);
+      const waits = results.map(({ res }) => res.headers.get('x-queue-wait-ms')).filter(wait => wait !== null);
+      expect(waits).toHaveLength(1);
+      expect(Number(waits[0])).toBeGreaterThanOrEqual(80);
+    });
+
+    it('should return 503 once the queue is full', async () => {
+      const saturated = queuedApp(1, 1);
+
+      const results = await Promise.all([slow(saturated), slow(saturated), slow(saturated)]);
+
+      expect(results.map(({ res }) => res.status).sort()).toEqual([200, 200, 503]);
+      const rejected = results.find(({ res }) => res.status === 503)!;
+      expect(JSON.parse(rejected.body).error.type).toBe('overloaded_error');
+    });
+
+    it('should not queue when no limit is configured', async () => {
+      const { res } = await slow(app);
+
+      expect(res.headers.get('x-queue-wait-ms')).toBeNull();
+    });
+
+    it('should shed a queued low priority request to admit a high priority one', async () => {
+      const saturated = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        queue: { maxConcurrent: 1, maxQueued: 1 },
+        promptLatencyMsPerToken: 10,
+      });
+      const queueStats = async () =>
+        (await saturated.request('/admin/queue', { headers: { 'Authorization': `Bearer ${testAPIKey}` } })).json();
+
+      const holding = slow(saturated, true);
+      await pause(10);
+      const low = slow(saturated, false, { service_tier: 'flex' });
+      await pause(10);
+      expect((await queueStats()).queued).toEqual({ high: 0, normal: 0, low: 1 });
+
+      const high = slow(saturated, false, { service_tier: 'priority' });
+      const shed = await low;
+      expect(shed.res.status).toBe(503);
+      expect(JSON.parse(shed.body).error.message).toContain('Shed from the low priority queue');
+      expect(await queueStats()).toMatchObject({ active: 1, queued: { high: 1, normal: 0, low: 0 }, shed: { low: 1 } });
+
+      const admitted = await high;
+      expect(admitted.res.status).toBe(200);
+      expect(JSON.parse(admitted.body).service_tier).toBe('priority');
+      expect((await holding).body).toContain('data: [DONE]');
+    });
+
+    it('should time out low priority requests while others keep waiting', async () => {
+      const saturated = createApp({
+        auth: { apiKey: testAPIKey },
+        queue: { maxConcurrent: 1, maxQueued: 2, maxWaitMs: { low: 20 } },
+        promptLatencyMsPerToken: 10,
+      });
+
+      const holding = slow(saturated, true);
+      await pause(10);
+      const [low, normal] = await Promise.all([
+        slow(saturated, false, { service_tier: 'flex' }),
+        slow(saturated, false, { service_tier: 'default' }),
+      ]);
+
+      expect(low.res.status).toBe(503);
+      expect(JSON.parse(low.body).error).toMatchObject({ type: 'overloaded_error', message: expect.stringContaining('Timed out after 20ms') });
+      expect(normal.res.status).toBe(200);
+      expect(Number(normal.res.headers.get('x-queue-wait-ms'))).toBeGreaterThanOrEqual(60);
+      await holding;
+    });
+
+    it('should report the tier an API key\'s priority puts requests on', async () => {
+      const keyed = createApp({
+        auth: { apiKey: testAPIKey },
+        queue: { maxConcurrent: 1, maxQueued: 0 },
+        priorities: { [testAPIKey]: 'low' },
+      });
+      const tierOf = async (extra: Record<string, unknown>) => {
+        const res = await keyed.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+          body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Hi' }], ...extra }),
+        });
+        return (await res.json()).service_tier;
+      };
+
+      expect(await tierOf({})).toBe('flex');
+      expect(await tierOf({ service_tier: 'auto' })).toBe('flex');
+      expect(await tierOf({ service_tier: 'priority' })).toBe('priority');
+    });
+  });
+
+  describe('Security Log', () => {
+    const securityApp = () => {
+      const lines: string[] = [];
+      const securedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        security: new SecurityLogger({ write: (line) => lines.push(line) }),
+        trustedProxies: ['10.0.0.1'],
+      });
+      return { lines, securedApp, events: () => lines.map(line => JSON.parse(line)) };
+    };
+
+    it('should record auth failures with the reason and source address', async () => {
+      const { securedApp, events } = securityApp();
+      const from = (remoteAddress: string) => ({ incoming: { socket: { remoteAddress } } });
+
+      await securedApp.request('/v1/models', {
+        headers: { 'Authorization': 'Bearer tt-wrong-key', 'X-Forwarded-For': '203.0.113.7' },
+      }, from('10.0.0.1'));
+      await securedApp.request('/v1/models', {
+        headers: { 'X-Forwarded-For': '203.0.113.7' },
+      }, from('198.51.100.7'));
+      await securedApp.request('/v1/models');
+
+      expect(events()).toMatchObject([
+        { seq: 0, event: 'auth_failure', reason: 'Invalid API key', source_ip: '203.0.113.7', api_key: 'tt-wro***' },
+        { seq: 1, event: 'auth_failure', reason: 'No authorization header provided', source_ip: '198.51.100.7' },
+        { seq: 2, event: 'auth_failure', reason: 'No authorization header provided', source_ip: 'unknown' },
+      ]);
+    });
+
+    it('should not record successful API requests', async () => {
+      const { securedApp, lines } = securityApp();
+
+      await securedApp.request('/v1/models', { headers: { 'Authorization': `Bearer ${testAPIKey}` } });
+
+      expect(lines).toEqual([]);
+    });
+
+    it('should record key creation, admin requests and config reloads in a verifiable chain', async () => {
+      const { securedApp, lines, events } = securityApp();
+      const auth = { 'Authorization': `Bearer ${testAPIKey}` };
+
+      await securedApp.request('/site/new-key', { method: 'POST' });
+      await securedApp.request('/admin/log-filters', {
+        method: 'PUT',
+        headers: { ...auth, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ suppressRoutes: ['/health'] }),
+      });
+
+      expect(events()).toMatchObject([
+        { event: 'key_created' },
+        { event: 'admin_request', method: 'PUT', path: '/admin/log-filters', api_key: 'tt-tes***' },
+        { event: 'config_reloaded', setting: 'log_filters' },
+      ]);
+      expect(verifySecurityLog(lines)).toEqual({ valid: true, entries: 3, firstSeq: 0 });
+    });
+  });
+
+  describe('Admin Log Filters', () => {
+    const auth = { 'Authorization': `Bearer ${testAPIKey}` };
+
+    const completedPaths = (logger: Logger) =>
+      logger.recent()
+        .filter(entry => entry.message === 'Request completed')
+        .map(entry => entry.path);
+
+    it('should not exist unless admin is enabled', async () => {
+      const res = await app.request('/admin/log-filters', { headers: auth });
+
+      expect(res.status).toBe(404);
+    });
+
+    it('should suppress configured routes but still log their errors and count them', async () => {
+      const logger = new Logger();
+      const filteredApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        logger,
+        logFilters: { suppressRoutes: ['/health', '/v1/models'] },
+      });
+
+      await filteredApp.request('/health');
+      await filteredApp.request('/v1/models', { headers: auth });
+      await filteredApp.request('/v1/models');
+
+      const res = await filteredApp.request('/admin/log-filters', { headers: auth });
+      const data = await res.json();
+
+      expect(completedPaths(logger)).toEqual(['/v1/models', '/admin/log-filters']);
+      expect(logger.recent().some(entry => entry.path === '/health')).toBe(false);
+      expect(data.filters).toEqual({ suppressRoutes: ['/health', '/v1/models'] });
+      expect(data.counts).toEqual({ requests: 4, logged: 1, suppressed: 2 });
+    });
+
+    it('should apply filters updated at runtime', async () => {
+      const logger = new Logger();
+      const adminApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true }, logger });
+
+      await adminApp.request('/health');
+      const res = await adminApp.request('/admin/log-filters', {
+        method: 'PUT',
+        headers: { ...auth, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ suppressRoutes: ['/health'], sampleRates: { '/v1/models': 0 } }),
+      });
+      await adminApp.request('/health');
+      await adminApp.request('/v1/models', { headers: auth });
+
+      expect(res.status).toBe(200);
+      expect((await res.json()).filters).toEqual({
+        suppressRoutes: ['/health'],
+        sampleRates: { '/v1/models': 0 },
+      });
+      expect(completedPaths(logger)).toEqual(['/health', '/admin/log-filters']);
+    });
+
+    it('should reject invalid filters', async () => {
+      const adminApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+
+      const res = await adminApp.request('/admin/log-filters', {
+        method: 'PUT',
+        headers: { ...auth, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ sampleRates: { '/health': 2 } }),
+      });
+      const data = await res.json();
+
+      expect(res.status).toBe(400);
+      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.param).toBe('sampleRates');
+    });
+  });
+
+  describe('Maintenance Mode', () => {
+    const admin = { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' };
+    const setMaintenance = (target: ReturnType<typeof createApp>, settings: unknown) =>
+      target.request('/admin/maintenance', { method: 'PUT', headers: admin, body: JSON.stringify(settings) });
+    const complete = (target: ReturnType<typeof createApp>, model: string, content: string, stream = false) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: admin,
+        body: JSON.stringify({ model, messages: [{ role: 'user', content }], stream }),
+      });
+
+    it('should reject new requests while letting a running stream finish', async () => {
+      const maintainedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        countdown: { delayMs: 20 },
+      });
+
+      const streaming = await complete(maintainedApp, 'countdown', '5', true);
+      expect(streaming.status).toBe(200);
+      const reader = streaming.body!.getReader();
+      const decoder = new TextDecoder();
+      let streamed = decoder.decode((await reader.read()).value, { stream: true });
+
+      const switched = await setMaintenance(maintainedApp, { enabled: true, retryAfterSeconds: 120 });
+      expect(switched.status).toBe(200);
+      expect(await switched.json()).toEqual({ enabled: true, retry_after_seconds: 120, since: expect.any(String) });
+
+      const rejected = await complete(maintainedApp, 'echo', 'Hello');
+      expect(rejected.status).toBe(503);
+      expect(rejected.headers.get('retry-after')).toBe('120');
+      expect((await rejected.json()).error).toMatchObject({ type: 'api_error', code: 'service_unavailable' });
+
+      const health = await maintainedApp.request('/health/deep');
+      expect(health.status).toBe(503);
+      expect(await health.json()).toMatchObject({ status: 'maintenance', checks: { maintenance: { enabled: true } } });
+
+      for (let chunk = await reader.read(); !chunk.done; chunk = await reader.read()) {
+        streamed += decoder.decode(chunk.value, { stream: true });
+      }
+      const content = parseSSEData(streamed)
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0]?.delta.content ?? '')
+        .join('');
+      expect(content).toContain('Done!');
+      expect(streamed.trimEnd().endsWith('data: [DONE]')).toBe(true);
+
+      const resumed = await setMaintenance(maintainedApp, { enabled: false });
+      expect(await resumed.json()).toEqual({ enabled: false, retry_after_seconds: 120, since: null });
+      expect((await complete(maintainedApp, 'echo', 'Hello')).status).toBe(200);
+      expect((await maintainedApp.request('/health/deep')).status).toBe(200);
+    });
+
+    it('should use the configured Retry-After by default', async () => {
+      const maintainedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        maintenanceRetryAfterSeconds: 30,
+      });
+
+      await setMaintenance(maintainedApp, { enabled: true });
+
+      expect((await complete(maintainedApp, 'echo', 'Hello')).headers.get('retry-after')).toBe('30');
+      expect((await maintainedApp.request('/v1/models', { headers: admin })).status).toBe(503);
+    });
+
+    it('should validate the settings', async () => {
+      const maintainedApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+
+      const invalid = await setMaintenance(maintainedApp, { enabled: 'yes' });
+      expect(invalid.status).toBe(400);
+      expect((await invalid.json()).error.param).toBe('enabled');
+      expect((await setMaintenance(maintainedApp, { enabled: true, retryAfterSeconds: -1 })).status).toBe(400);
+      expect((await maintainedApp.request('/admin/maintenance', { headers: admin })).status).toBe(200);
+    });
+  });
+
+  describe('Request Size Stats', () => {
+    const headers = { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' };
+
+    it('should move the histogram buckets with request sizes', async () => {
+      const sizedApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+      const tool = { type: 'function', function: { name: 'lookup' } };
+      const sizes = [
+        { messages: 1, characters: 10, tools: 0 },
+        { messages: 3, characters: 500, tools: 1, max_tokens: 50 },
+        { messages: 12, characters: 5000, tools: 5, max_tokens: 2000 },
+      ];
+
+      for (const size of sizes) {
+        const res = await sizedApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers,
+          body: JSON.stringify({
+            model: 'echo',
+            messages: Array.from({ length: size.messages }, (_, i) => ({
+              role: i % 2 === 0 ? 'user' : 'assistant',
+              content: 'x'.repeat(size.characters / size.messages),
+            })).reverse(),
+            ...(size.tools > 0 && { tools: Array.from({ length: size.tools }, () => tool) }),
+            ...(size.max_tokens !== undefined && { max_tokens: size.max_tokens }),
+          }),
+        });
+        expect(res.status).toBe(200);
+      }
+      await sizedApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers,
+        body: JSON.stringify({ model: 'no-such-model', messages: [{ role: 'user', content: 'Hi' }] }),
+      });
+
+      const res = await sizedApp.request('/admin/request-sizes', { headers });
+      expect(res.status).toBe(200);
+      const { data } = await res.json();
+      expect(data).toHaveLength(1);
+      expect(data[0]).toMatchObject({ route: '/v1/chat/completions', model: 'echo' });
+
+      const { messages, prompt_characters, max_tokens, tools } = data[0].histograms;
+      expect(messages).toMatchObject({ count: 3, sum: 16, buckets: { '1': 1, '2': 1, '4': 2, '8': 2, '16': 3 } });
+      expect(prompt_characters).toMatchObject({ count: 3, buckets: { '100': 1, '1000': 2, '10000': 3 } });
+      expect(max_tokens).toMatchObject({ count: 2, sum: 2050, buckets: { '16': 0, '64': 1, '1024': 1, '4096': 2 } });
+      expect(tools).toMatchObject({ count: 3, sum: 6, buckets: { '0': 1, '1': 2, '4': 2, '8': 3 } });
+    });
+  });
+
+  describe('Metrics', () => {
+    const headers = { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' };
+    const scrape = async (target: ReturnType<typeof createApp>) => {
+      const res = await target.request('/metrics', { headers });
       expect(res.status).toBe(200);
-      
+      expect(res.headers.get('content-type')).toContain('text/plain; version=0.0.4');
+      return (await res.text()).split('\n');
+    };
+
+    it('should expose request sizes as Prometheus histograms', async () => {
+      const metricsApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+      for (const content of ['x'.repeat(10), 'x'.repeat(500)]) {
+        await metricsApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers,
+          body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content }], max_tokens: 50 }),
+        });
+      }
+
+      const lines = await scrape(metricsApp);
+      const labels = 'route="/v1/chat/completions",model="echo"';
+      expect(lines).toContain('# TYPE teenytiny_request_prompt_characters histogram');
+      expect(lines).toContain(`teenytiny_request_prompt_characters_bucket{${labels},le="100"} 1`);
+      expect(lines).toContain(`teenytiny_request_prompt_characters_bucket{${labels},le="+Inf"} 2`);
+      expect(lines).toContain(`teenytiny_request_prompt_characters_sum{${labels}} 510`);
+      expect(lines).toContain(`teenytiny_request_max_tokens_count{${labels}} 2`);
+      expect(lines).toContain(`teenytiny_request_messages_bucket{${labels},le="1"} 2`);
+    });
+
+    it('should report maintenance mode as a gauge', async () => {
+      const metricsApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+      expect(await scrape(metricsApp)).toContain('teenytiny_maintenance_mode 0');
+
+      await metricsApp.request('/admin/maintenance', { method: 'PUT', headers, body: JSON.stringify({ enabled: true }) });
+
+      expect(await scrape(metricsApp)).toContain('teenytiny_maintenance_mode 1');
+    });
+
+    it('should report queue depths by priority while requests wait', async () => {
+      const queuedApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        queue: { maxConcurrent: 1, maxQueued: 2 },
+        promptLatencyMsPerToken: 10,
+      });
+      // 40 characters is 10 prompt tokens, so each request takes about 100ms
+      const slow = () =>
+        queuedApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers,
+          body: JSON.stringify({ model: 'slowprompt', messages: [{ role: 'user', content: 'x'.repeat(40) }] }),
+        });
+      const running = [slow(), slow()];
+      await new Promise((resolve) => setTimeout(resolve, 20));
+
+      const lines = await scrape(queuedApp);
+      expect(lines).toContain('teenytiny_queue_active 1');
+      expect(lines).toContain('teenytiny_queue_depth{priority="normal"} 1');
+      expect(lines).toContain('teenytiny_queue_depth{priority="high"} 0');
+      expect(lines).toContain('teenytiny_queue_shed_total{priority="low"} 0');
+      await Promise.all(running);
+    });
+
+    it('should count cache, idempotency, log filter and scenario outcomes', async () => {
+      const metricsApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        cache: { ttlMs: 60_000, maxEntries: 10 },
+        logFilters: { suppressRoutes: ['/health'] },
+        streamScenarios: { scenarios: { quick: 'burst 2 chunks' } },
+      });
+      const complete = (content: string, extra: Record<string, string> = {}, stream = false) =>
+        metricsApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: { ...headers, ...extra },
+          body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content }], stream }),
+        });
+
+      await metricsApp.request('/health');
+      await metricsApp.request('/health');
+      await complete('cached');
+      await complete('cached');
+      await complete('once', { 'Idempotency-Key': 'metrics-retry' });
+      await complete('once', { 'Idempotency-Key': 'metrics-retry' });
+      await (await complete('streamed', { 'X-TeenyTiny-Scenario': 'quick' }, true)).text();
+
+      const lines = await scrape(metricsApp);
+      // Every request so far, and the scrape itself
+      expect(lines).toContain('teenytiny_requests_total 8');
+      expect(lines).toContain('teenytiny_requests_suppressed_total 2');
+      expect(lines).toContain('teenytiny_cache_hits_total 1');
+      expect(lines).toContain('teenytiny_idempotency_hits_total 1');
+      expect(lines).toContain('teenytiny_idempotency_conflicts_total 0');
+      expect(lines).toContain('teenytiny_scenario_requests_total{scenario="quick"} 1');
+    });
+
+    it('should report model health as a gauge per checked model', async () => {
+      const down: Model = {
+        async *process(input: string): AsyncGenerator<string> {
+          yield input;
+        },
+        async checkHealth(): Promise<void> {
+          throw new Error('upstream unreachable');
+        },
+      };
+      const metricsApp = createApp({
+        auth: { apiKey: testAPIKey },
+        admin: { enabled: true },
+        models: [{ id: 'down', model: down }],
+        modelHealth: { intervalMs: 20 },
+      });
+
+      let lines: string[] = [];
+      for (let attempt = 0; attempt < 100 && !lines.includes('teenytiny_model_healthy{model="down"} 0'); attempt++) {
+        await new Promise((resolve) => setTimeout(resolve, 10));
+        lines = await scrape(metricsApp);
+      }
+      expect(lines).toContain('teenytiny_model_healthy{model="down"} 0');
+      expect(lines.some((line) => line.startsWith('teenytiny_model_consecutive_failures{model="down"} '))).toBe(true);
+    });
+
+    it('should leave out metrics of features that are off, and require auth', async () => {
+      const metricsApp = createApp({ auth: { apiKey: testAPIKey }, admin: { enabled: true } });
+
+      const lines = await scrape(metricsApp);
+      for (const prefix of ['teenytiny_queue', 'teenytiny_cache', 'teenytiny_model', 'teenytiny_webhook']) {
+        expect(lines.some((line) => line.startsWith(prefix))).toBe(false);
+      }
+      expect((await metricsApp.request('/metrics')).status).toBe(401);
+      expect((await app.request('/metrics', { headers })).status).toBe(404);
+    });
+  });
+
+  describe('Completion IDs', () => {
+    const sequentialApp = () => {
+      let next = 0;
+      return createApp({
+        auth: { apiKey: testAPIKey },
+        idGenerator: { generate: (prefix: string) => `${prefix}test-${++next}` },
+      });
+    };
+
+    it('should use the injected id generator', async () => {
+      const res = await sequentialApp().request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'Hello!' }],
+        }),
+      });
+
       const data = await res.json();
-      expect(data).toMatchObject({
-        status: 'ok',
-        service: 'teenytiny-api',
+      expect(data.id).toBe('chatcmpl-test-1');
+    });
+
+    it('should share a single id across all streaming chunks', async () => {
+      const res = await sequentialApp().request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'Hello there!' }],
+          stream: true,
+        }),
       });
-      expect(data.timestamp).toBeDefined();
+
+      const ids = (await res.text())
+        .split('\n')
+        .filter(line => line.startsWith('data: ') && line !== 'data: [DONE]')
+        .map(line => JSON.parse(line.slice(6)).id);
+
+      expect(ids.length).toBeGreaterThan(2);
+      expect(new Set(ids)).toEqual(new Set(['chatcmpl-test-1']));
+    });
+  });
+
+  describe('Countdown Model', () => {
+    const countdownApp = createApp({ auth: { apiKey: testAPIKey }, countdown: { delayMs: 0 } });
+
+    const countdown = (stream: boolean) =>
+      countdownApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'countdown',
+          messages: [{ role: 'user', content: 'From 3' }],
+          stream,
+        }),
+      });
+
+    it('should return the whole sequence for non-streaming requests', async () => {
+      const res = await countdown(false);
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('3... 2... 1... Done!');
+      expect(data.usage.completion_tokens).toBe(3);
+    });
+
+    it('should stream one number per chunk', async () => {
+      const res = await countdown(true);
+
+      const events = (await res.text())
+        .split('\n\n')
+        .filter((event) => event.startsWith('data: ') && event !== 'data: [DONE]')
+        .map((event) => JSON.parse(event.slice(6)));
+      const contents = events
+        .map((event) => event.choices[0].delta.content)
+        .filter((content) => content !== undefined);
+
+      expect(contents).toEqual(['3... ', '2... ', '1... ', 'Done!']);
+      expect(events[events.length - 1].usage.completion_tokens).toBe(3);
+    });
+  });
+
+  describe('Refuser Model', () => {
+    const refuse = (content: string, stream: boolean) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'refuser',
+          messages: [{ role: 'user', content }],
+          stream,
+        }),
+      });
+
+    it('should populate refusal and null content on the trigger', async () => {
+      const res = await refuse('Please refuse this', false);
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      const message = data.choices[0].message;
+      expect(message.content).toBeNull();
+      expect(message.refusal).toBe("I'm sorry, but I can't help with that request.");
+      expect(data.choices[0].finish_reason).toBe('stop');
+      expect(data.usage.completion_tokens).toBeGreaterThan(0);
+    });
+
+    it('should echo messages without the trigger', async () => {
+      const res = await refuse('Hello there', false);
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('Hello there');
+      expect(data.choices[0].message.refusal).toBeUndefined();
+    });
+
+    it('should stream refusal deltas on the trigger', async () => {
+      const res = await refuse('REFUSE', true);
+
+      const events = (await res.text())
+        .split('\n\n')
+        .filter((event) => event.startsWith('data: ') && event !== 'data: [DONE]')
+        .map((event) => JSON.parse(event.slice(6)));
+      const deltas = events.map((event) => event.choices[0].delta);
+
+      expect(deltas.some((delta) => delta.content !== undefined)).toBe(false);
+      expect(deltas.filter((delta) => delta.refusal !== undefined).length).toBeGreaterThan(1);
+      expect(deltas.map((delta) => delta.refusal ?? '').join('')).toBe(
+        "I'm sorry, but I can't help with that request.",
+      );
+    });
+  });
+
+  describe('Shuffle Model', () => {
+    const shuffle = (body: Record<string, unknown>) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'shuffle',
+          messages: [{ role: 'user', content: 'one two three four five six' }],
+          ...body,
+        }),
+      });
+
+    it('should reply with the same words in a stable order for a seed', async () => {
+      const first = await (await shuffle({ seed: 7 })).json();
+      const second = await (await shuffle({ seed: 7 })).json();
+
+      const content: string = first.choices[0].message.content;
+      expect(second.choices[0].message.content).toBe(content);
+      expect(content.split(' ').sort()).toEqual(['five', 'four', 'one', 'six', 'three', 'two']);
+    });
+
+    it('should reject a non-integer seed', async () => {
+      const res = await shuffle({ seed: 1.5 });
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.param).toBe('seed');
+    });
+  });
+
+  describe('Interleaved Model', () => {
+    const interleaved = (body: Record<string, unknown>) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'interleaved',
+          messages: [{ role: 'user', content: 'Look it up' }],
+          ...body,
+        }),
+      });
+
+    const streamedChunks = async (res: Response) =>
+      (await res.text())
+        .split('\n')
+        .filter(line => line.startsWith('data: ') && line !== 'data: [DONE]')
+        .map(line => JSON.parse(line.slice(6)));
+
+    it('should stream content, then tool call deltas, finishing with tool_calls', async () => {
+      const chunks = await streamedChunks(await interleaved({ stream: true }));
+      const deltas = chunks.map(chunk => chunk.choices[0].delta);
+
+      const firstCall = deltas.findIndex(delta => delta.tool_calls);
+      const content = deltas.slice(0, firstCall).map(delta => delta.content ?? '').join('');
+      expect(content).toBe('Let me look that up for you.');
+
+      const callDeltas = deltas.slice(firstCall).filter(delta => delta.tool_calls);
+      expect(callDeltas.length).toBeGreaterThan(2);
+      expect(callDeltas[0].tool_calls[0]).toEqual({
+        index: 0,
+        id: expect.stringMatching(/^call_/),
+        type: 'function',
+        function: { name: 'lookup', arguments: '' },
+      });
+      for (const delta of callDeltas.slice(1)) {
+        expect(delta.tool_calls[0].id).toBeUndefined();
+        expect(delta.tool_calls[0].function.name).toBeUndefined();
+      }
+      const args = callDeltas.map(delta => delta.tool_calls[0].function.arguments).join('');
+      expect(JSON.parse(args)).toEqual({ query: 'teenytiny', limit: 3 });
+      expect(deltas.slice(firstCall).some(delta => delta.content)).toBe(false);
+
+      expect(chunks[chunks.length - 1].choices[0].finish_reason).toBe('tool_calls');
+    });
+
+    it('should stream the closing sentence once the tool result comes back', async () => {
+      const chunks = await streamedChunks(
+        await interleaved({
+          stream: true,
+          messages: [
+            { role: 'user', content: 'Look it up' },
+            {
+              role: 'assistant',
+              content: 'Let me look that up for you.',
+              tool_calls: [
+                { id: 'call_1', type: 'function', function: { name: 'lookup', arguments: '{"query":"teenytiny","limit":3}' } },
+              ],
+            },
+            { role: 'tool', tool_call_id: 'call_1', content: '3 results' },
+          ],
+        })
+      );
+
+      const content = chunks.map(chunk => chunk.choices[0].delta.content ?? '').join('');
+      expect(content).toBe('The lookup returned 3 results, so that is your answer.');
+      expect(chunks.some(chunk => chunk.choices[0].delta.tool_calls)).toBe(false);
+      expect(chunks[chunks.length - 1].choices[0].finish_reason).toBe('stop');
+    });
+
+    it('should return the content alongside the whole tool call when not streaming', async () => {
+      const data = await (await interleaved({})).json();
+      const choice = data.choices[0];
+
+      expect(choice.finish_reason).toBe('tool_calls');
+      expect(choice.message.content).toBe('Let me look that up for you.');
+      expect(choice.message.tool_calls).toEqual([
+        {
+          id: expect.stringMatching(/^call_/),
+          type: 'function',
+          function: { name: 'lookup', arguments: '{"query":"teenytiny","limit":3}' },
+        },
+      ]);
+    });
+  });
+
+  describe('Palindrome Model', () => {
+    const check = (body: Record<string, unknown>) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'palindrome',
+          messages: [{ role: 'user', content: 'Racecar' }],
+          ...body,
+        }),
+      });
+
+    it('should answer in a fixed sentence', async () => {
+      const res = await check({});
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe("Yes, 'Racecar' is a palindrome.");
+    });
+
+    it('should honour response_format json_object', async () => {
+      const res = await check({ response_format: { type: 'json_object' } });
+
+      const data = await res.json();
+      expect(JSON.parse(data.choices[0].message.content)).toEqual({
+        palindrome: true,
+        normalized: 'racecar',
+      });
+    });
+
+    it('should reject an unknown response_format type', async () => {
+      const res = await check({ response_format: { type: 'yaml' } });
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.param).toBe('response_format');
+    });
+  });
+
+  describe('Chunky Model', () => {
+    it('should stream one delta per scripted chunk', async () => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'chunky',
+          messages: [{ role: 'user', content: 'Hel|lo wo|rld \\| pipe' }],
+          stream: true,
+        }),
+      });
+
+      const contents = (await res.text())
+        .split('\n\n')
+        .filter((event) => event.startsWith('data: ') && event !== 'data: [DONE]')
+        .map((event) => JSON.parse(event.slice(6)).choices[0].delta.content)
+        .filter((content) => content !== undefined);
+
+      expect(contents).toEqual(['Hel', 'lo wo', 'rld | pipe']);
+    });
+  });
+
+  describe('FinishReason Model', () => {
+    const finish = (content: string, stream: boolean) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'finishreason',
+          messages: [{ role: 'user', content }],
+          stream,
+        }),
+      });
+
+    const reasons = ['stop', 'length', 'tool_calls', 'content_filter', 'function_call'];
+
+    it.each(reasons)('should finish with %s when not streaming', async (reason) => {
+      const res = await finish(reason, false);
+
+      const data = await res.json();
+      const choice = data.choices[0];
+      expect(choice.finish_reason).toBe(reason);
+      if (reason === 'tool_calls') {
+        expect(choice.message.tool_calls[0].function.name).toBe('finish_reason_stub');
+        expect(choice.message.content).toBeNull();
+      } else if (reason === 'function_call') {
+        expect(choice.message.function_call.name).toBe('finish_reason_stub');
+        expect(choice.message.tool_calls).toBeUndefined();
+      } else {
+        expect(typeof choice.message.content).toBe('string');
+      }
+    });
+
+    it.each(reasons)('should finish with %s when streaming', async (reason) => {
+      const res = await finish(reason, true);
+
+      const events = (await res.text())
+        .split('\n\n')
+        .filter((event) => event.startsWith('data: ') && event !== 'data: [DONE]')
+        .map((event) => JSON.parse(event.slice(6)));
+      const finishReasons = events
+        .map((event) => event.choices[0].finish_reason)
+        .filter((value) => value !== undefined);
+
+      expect(finishReasons).toEqual([reason]);
+    });
+
+    it.each([false, true])('should reject unknown values with a 400 (stream: %s)', async (stream) => {
+      const res = await finish('exhausted', stream);
+
+      expect(res.status).toBe(400);
+      const data = await res.json();
+      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.message).toContain('stop, length, tool_calls, content_filter, function_call');
+    });
+  });
+
+  describe('Normalize Model', () => {
+    const normalize = (target: ReturnType<typeof createApp>) =>
+      target.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'normalize',
+          messages: [{ role: 'user', content: '\u00E9\u00E9\u00E9\u00E9' }],
+        }),
+      });
+
+    it('should apply the configured form and count usage from the result', async () => {
+      const nfdApp = createApp({ auth: { apiKey: testAPIKey }, normalizeForm: 'NFD' });
+
+      const composed = await (await normalize(app)).json();
+      const decomposed = await (await normalize(nfdApp)).json();
+
+      expect(composed.choices[0].message.content).toBe('\u00E9\u00E9\u00E9\u00E9');
+      expect(decomposed.choices[0].message.content).toBe('e\u0301e\u0301e\u0301e\u0301');
+      expect(composed.usage.completion_tokens).toBe(1);
+      expect(decomposed.usage.completion_tokens).toBe(2);
+    });
+  });
+
+  describe('Usage Model', () => {
+    const dictate = (content: string, extra: Record<string, unknown> = {}) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'usage',
+          messages: [{ role: 'user', content }],
+          ...extra,
+        }),
+      });
+
+    it('should report exactly the dictated usage', async () => {
+      const res = await dictate('prompt=123 completion=45');
+
+      const data = await res.json();
+      expect(data.usage).toEqual({ prompt_tokens: 123, completion_tokens: 45, total_tokens: 168 });
+      expect(data.choices[0].message.content).toBe('Usage: prompt=123 completion=45 total=168.');
+    });
+
+    it('should carry the dictated usage in the stream_options usage chunk', async () => {
+      const res = await dictate('prompt=123 completion=45', {
+        stream: true,
+        stream_options: { include_usage: true },
+      });
+
+      const events = (await res.text())
+        .split('\n\n')
+        .filter((event) => event.startsWith('data: ') && event !== 'data: [DONE]')
+        .map((event) => JSON.parse(event.slice(6)));
+      const last = events[events.length - 1];
+
+      expect(last.choices).toEqual([]);
+      expect(last.usage).toEqual({
+        prompt_tokens: 123,
+        completion_tokens: 45,
+        total_tokens: 168,
+        teenytiny: expect.any(Object),
+      });
+    });
+
+    it('should fall back to estimated usage for unparseable input', async () => {
+      const res = await dictate('prompt=-5 completion=x');
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toContain("Couldn't read usage");
+      expect(data.usage.prompt_tokens).toBe(Math.ceil('prompt=-5 completion=x'.length / 4) + 3 + 3);
     });
   });
 
-  describe('Models Endpoint', () => {
-    it('should list available models', async () => {
-      const res = await app.request('/v1/models', {
+  describe('Headers Model', () => {
+    const request = (stream: boolean) =>
+      app.request('/v1/chat/completions', {
+        method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
         },
+        body: JSON.stringify({
+          model: 'headers',
+          messages: [{ role: 'user', content: 'X-TeenyTiny-Test: hello\nConnection: close' }],
+          stream,
+        }),
       });
-      
+
+    it.each([false, true])('should set allowed headers on the response (stream: %s)', async (stream) => {
+      const res = await request(stream);
+
       expect(res.status).toBe(200);
-      const data = await res.json();
-      
-      expect(data).toMatchObject({
-        object: 'list',
-        data: expect.arrayContaining([
-          expect.objectContaining({
-            id: 'echo',
-            object: 'model',
-            owned_by: 'teenytiny-ai',
-          }),
-        ]),
-      });
+      expect(res.headers.get('X-TeenyTiny-Test')).toBe('hello');
+      expect(res.headers.get('Connection')).not.toBe('close');
     });
 
-    it('should require authentication', async () => {
-      const res = await app.request('/v1/models');
-      expect(res.status).toBe(401);
-      
-      const data = await res.json();
-      expect(data.error.type).toBe('authentication_error');
-    });
+    it('should explain refused headers in the content', async () => {
+      const res = await request(false);
 
-    it('should reject invalid API key', async () => {
-      const res = await app.request('/v1/models', {
-        headers: {
-          'Authorization': 'Bearer invalid-key',
-        },
-      });
-      
-      expect(res.status).toBe(401);
       const data = await res.json();
-      expect(data.error.type).toBe('authentication_error');
+      expect(data.choices[0].message.content).toBe(
+        'Set X-TeenyTiny-Test: hello\nRefused Connection: hop-by-hop headers are managed by the server',
+      );
     });
   });
 
-  describe('Chat Completions', () => {
-    const validRequest: ChatCompletionRequest = {
-      model: 'echo',
-      messages: [
-        { role: 'user', content: 'Hello, Echo!' },
-      ],
-    };
-
-    it('should generate non-streaming completion', async () => {
+  describe('Request Headers Model', () => {
+    const reply = async (body: Record<string, unknown> = {}) => {
       const res = await app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
+          'X-Debug-Trace': 'proxy-test-42',
         },
-        body: JSON.stringify(validRequest),
+        body: JSON.stringify({ model: 'request-headers', messages: [{ role: 'user', content: 'show me' }], ...body }),
       });
-
       expect(res.status).toBe(200);
-      const data = await res.json();
+      return res;
+    };
 
-      expect(data).toMatchObject({
-        object: 'chat.completion',
-        model: 'echo',
-        choices: [
-          {
-            index: 0,
-            message: {
-              role: 'assistant',
-              content: 'Hello, Echo!',
-            },
-            finish_reason: 'stop',
-          },
-        ],
-        usage: {
-          prompt_tokens: expect.any(Number),
-          completion_tokens: expect.any(Number),
-          total_tokens: expect.any(Number),
-        },
-      });
+    it('should reply with the request headers, Authorization masked', async () => {
+      const headers = JSON.parse((await (await reply()).json()).choices[0].message.content);
 
-      expect(data.id).toMatch(/^chatcmpl-/);
-      expect(data.created).toBeTypeOf('number');
+      expect(headers['x-debug-trace']).toBe('proxy-test-42');
+      expect(headers['content-type']).toBe('application/json');
+      expect(headers.authorization).toBe(`Bearer ${testAPIKey.slice(0, 6)}***`);
+      expect(JSON.stringify(headers)).not.toContain(testAPIKey);
     });
 
-    it('should generate streaming completion', async () => {
-      const streamingRequest: ChatCompletionRequest = {
-        ...validRequest,
-        stream: true,
+    it('should stream the same headers', async () => {
+      const content = parseSSEData(await (await reply({ stream: true })).text())
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0]?.delta.content ?? '')
+        .join('');
+
+      expect(JSON.parse(content)['x-debug-trace']).toBe('proxy-test-42');
+    });
+  });
+
+  describe('Slowprompt Model', () => {
+    it('should delay the first chunk in proportion to the prompt', async () => {
+      const slowApp = createApp({ auth: { apiKey: testAPIKey }, promptLatencyMsPerToken: 2 });
+
+      const timeToFirstByte = async (content: string) => {
+        const start = Date.now();
+        const res = await slowApp.request('/v1/chat/completions', {
+          method: 'POST',
+          headers: {
+            'Authorization': `Bearer ${testAPIKey}`,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({
+            model: 'slowprompt',
+            messages: [{ role: 'user', content }],
+            stream: true,
+          }),
+        });
+        await res.body!.getReader().read();
+        return Date.now() - start;
       };
 
-      const res = await app.request('/v1/chat/completions', {
+      const short = await timeToFirstByte('x'.repeat(40));
+      const long = await timeToFirstByte('x'.repeat(400));
+
+      expect(long).toBeGreaterThanOrEqual(190);
+      expect(long).toBeGreaterThan(short * 4);
+    });
+  });
+
+  describe('Sessions', () => {
+    const sessionApp = createApp({
+      auth: { apiKey: testAPIKey },
+      sessions: { ttlMs: 60_000, maxSessionsPerKey: 10 },
+    });
+    const call = (path: string, method: string, apiKey = testAPIKey) =>
+      sessionApp.request(path, { method, headers: { 'Authorization': `Bearer ${apiKey}` } });
+    const say = (sessionId: string, content: string, stream = false) =>
+      sessionApp.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
+          'X-Session-Id': sessionId,
         },
-        body: JSON.stringify(streamingRequest),
+        body: JSON.stringify({ model: 'history', messages: [{ role: 'user', content }], stream }),
       });
 
-      expect(res.status).toBe(200);
-      expect(res.headers.get('content-type')).toContain('text/event-stream');
+    it('should give the model the whole conversation when only single messages are sent', async () => {
+      const created = await call('/v1/teenytiny/sessions', 'POST');
+      expect(created.status).toBe(201);
+      const session = await created.json();
+      expect(session.object).toBe('teenytiny.session');
+      expect(session.id).toMatch(/^sess_/);
 
-      const text = await res.text();
-      const lines = text.split('\n').filter(line => line.startsWith('data: '));
-      
-      expect(lines.length).toBeGreaterThan(0);
-      expect(lines[lines.length - 1]).toBe('data: [DONE]');
+      const first = await (await say(session.id, 'Hi')).json();
+      expect(first.choices[0].message.content).toBe('1. user: Hi');
 
-      // Parse chunks (excluding [DONE])
-      const chunks = lines.slice(0, -1).map(line => {
-        const data = line.replace('data: ', '');
-        return JSON.parse(data);
-      });
+      const second = await (await say(session.id, 'Again')).json();
+      expect(second.choices[0].message.content).toBe('1. user: Hi\n2. assistant: 1. user: Hi\n3. user: Again');
 
-      expect(chunks.length).toBeGreaterThan(0);
+      // The streamed reply is stored too
+      const third = await (await say(session.id, 'Last', true)).text();
+      const content = third
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)).choices[0].delta.content ?? '')
+        .join('');
+      expect(content.startsWith('1. user: Hi\n2. assistant: ')).toBe(true);
+      expect(content.endsWith('\n5. user: Last')).toBe(true);
 
-      // First chunk should have role
-      expect(chunks[0]).toMatchObject({
-        object: 'chat.completion.chunk',
-        model: 'echo',
-        choices: [
-          {
-            index: 0,
-            delta: { role: 'assistant' },
-          },
-        ],
-      });
+      const transcript = await (await call(`/v1/teenytiny/sessions/${session.id}`, 'GET')).json();
+      expect(transcript.messages.map((m: { role: string }) => m.role)).toEqual([
+        'user', 'assistant', 'user', 'assistant', 'user', 'assistant',
+      ]);
+      expect(transcript.messages[4]).toEqual({ role: 'user', content: 'Last' });
+      expect(transcript.messages[5]).toEqual({ role: 'assistant', content });
+    });
 
-      // Last chunk should have finish_reason and usage
-      const lastChunk = chunks[chunks.length - 1];
-      expect(lastChunk.choices[0]).toMatchObject({
-        index: 0,
-        finish_reason: 'stop',
-      });
-      expect(lastChunk.usage).toBeDefined();
+    it('should forget a deleted session', async () => {
+      const session = await (await call('/v1/teenytiny/sessions', 'POST')).json();
+
+      const deleted = await call(`/v1/teenytiny/sessions/${session.id}`, 'DELETE');
+      expect(deleted.status).toBe(200);
+      expect((await deleted.json()).deleted).toBe(true);
+
+      expect((await call(`/v1/teenytiny/sessions/${session.id}`, 'GET')).status).toBe(404);
+      expect((await say(session.id, 'Hi')).status).toBe(404);
     });
 
-    it('should require authentication', async () => {
+    it('should keep sessions private to the API key that created them', async () => {
+      const session = await (await call('/v1/teenytiny/sessions', 'POST')).json();
+      const { key } = await (await sessionApp.request('/site/new-key', { method: 'POST' })).json();
+
+      expect((await call(`/v1/teenytiny/sessions/${session.id}`, 'GET', key)).status).toBe(404);
+      expect((await call(`/v1/teenytiny/sessions/${session.id}`, 'DELETE', key)).status).toBe(404);
+    });
+
+    it('should reject X-Session-Id when sessions are disabled', async () => {
       const res = await app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
+          'X-Session-Id': 'sess_missing',
         },
-        body: JSON.stringify(validRequest),
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content: 'Hi' }] }),
       });
 
-      expect(res.status).toBe(401);
+      expect(res.status).toBe(400);
+      expect((await app.request('/v1/teenytiny/sessions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}` },
+      })).status).toBe(404);
     });
+  });
 
-    it('should validate required fields', async () => {
-      const invalidRequest = {
-        messages: [{ role: 'user', content: 'Hello!' }],
-        // Missing model field
-      };
+  describe('Role Chunk', () => {
+    const streamChunks = async (roleApp: ReturnType<typeof createApp>) => {
+      const res = await roleApp.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: {
+          'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          model: 'annotate',
+          messages: [{ role: 'user', content: 'Several words to stream.' }],
+          stream: true,
+        }),
+      });
+      return (await res.text())
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)));
+    };
 
-      const res = await app.request('/v1/chat/completions', {
+    it('should send only the role in the first chunk by default', async () => {
+      const chunks = await streamChunks(app);
+
+      expect(chunks[0].choices[0].delta).toEqual({ role: 'assistant' });
+      expect(chunks[1].choices[0].delta).toEqual({ content: 'Several ' });
+    });
+
+    it('should send the role with empty content first when configured', async () => {
+      const roleApp = createApp({ auth: { apiKey: testAPIKey }, roleChunkContent: true });
+
+      const chunks = await streamChunks(roleApp);
+
+      expect(chunks[0].choices[0].delta).toEqual({ role: 'assistant', content: '' });
+      const rest = chunks.slice(1).map(chunk => chunk.choices[0].delta);
+      expect(rest.some(delta => 'role' in delta)).toBe(false);
+      expect(rest.map(delta => delta.content ?? '').join('')).toBe('Several words to stream.');
+    });
+  });
+
+  describe('Service Tier', () => {
+    const complete = (body: Record<string, unknown>) =>
+      app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(invalidRequest),
+        body: JSON.stringify({
+          model: 'echo',
+          messages: [{ role: 'user', content: 'tiered' }],
+          ...body,
+        }),
       });
 
-      expect(res.status).toBe(400);
+    it.each([
+      [undefined, 'default'],
+      ['auto', 'default'],
+      ['default', 'default'],
+      ['flex', 'flex'],
+      ['priority', 'priority'],
+    ])('should resolve service_tier %s to %s', async (requested, resolved) => {
+      const res = await complete({ service_tier: requested });
+      const data = await res.json();
+
+      expect(res.status).toBe(200);
+      expect(data.service_tier).toBe(resolved);
+    });
+
+    it('should report the tier on every streamed chunk', async () => {
+      const res = await complete({ service_tier: 'flex', stream: true });
+      const chunks = (await res.text())
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)));
+
+      expect(chunks.length).toBeGreaterThan(1);
+      expect(chunks.every(chunk => chunk.service_tier === 'flex')).toBe(true);
+    });
+
+    it.each(['scale', 'FLEX', 1, null])('should reject service_tier %s', async (tier) => {
+      const res = await complete({ service_tier: tier });
       const data = await res.json();
+
+      expect(res.status).toBe(400);
       expect(data.error.type).toBe('invalid_request_error');
-      expect(data.error.param).toBe('model');
+      expect(data.error.param).toBe('service_tier');
     });
+  });
 
-    it('should validate model exists', async () => {
-      const invalidRequest: ChatCompletionRequest = {
-        model: 'nonexistent-model',
-        messages: [{ role: 'user', content: 'Hello!' }],
-      };
+  describe('Annotate Model', () => {
+    const content = 'Tiny models are fun. They cite 👋 sources! Third sentence';
 
-      const res = await app.request('/v1/chat/completions', {
+    const annotate = (stream: boolean) =>
+      app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(invalidRequest),
+        body: JSON.stringify({
+          model: 'annotate',
+          messages: [{ role: 'user', content }],
+          stream,
+        }),
       });
 
-      expect(res.status).toBe(400);
+    const expectCitationsWithin = (annotations: any[], text: string) => {
+      const length = Array.from(text).length;
+      expect(annotations).toHaveLength(3);
+      for (const annotation of annotations) {
+        expect(annotation.type).toBe('url_citation');
+        expect(annotation.url_citation.url).toMatch(/^https:\/\//);
+        expect(annotation.url_citation.title).toBeTruthy();
+        expect(annotation.url_citation.start_index).toBeGreaterThanOrEqual(0);
+        expect(annotation.url_citation.start_index).toBeLessThan(annotation.url_citation.end_index);
+        expect(annotation.url_citation.end_index).toBeLessThanOrEqual(length);
+      }
+    };
+
+    it('should return url citations within the content', async () => {
+      const res = await annotate(false);
       const data = await res.json();
-      expect(data.error.type).toBe('invalid_request_error');
-      expect(data.error.param).toBe('model');
+
+      const message = data.choices[0].message;
+      expect(message.content).toBe(content);
+      expectCitationsWithin(message.annotations, message.content);
+      const first = message.annotations[0].url_citation;
+      expect(Array.from(content).slice(first.start_index, first.end_index).join('')).toBe('Tiny models are fun.');
     });
 
-    it('should handle empty messages array', async () => {
-      const invalidRequest: ChatCompletionRequest = {
-        model: 'echo',
-        messages: [],
-      };
+    it('should stream an annotations delta after the content', async () => {
+      const res = await annotate(true);
+      const chunks = (await res.text())
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)));
+
+      const deltas = chunks.map(chunk => chunk.choices[0].delta);
+      const annotated = deltas.findIndex(delta => delta.annotations);
+      const streamed = deltas.map(delta => delta.content ?? '').join('');
+      expect(streamed).toBe(content);
+      expect(deltas.slice(annotated + 1).some(delta => delta.content)).toBe(false);
+      expectCitationsWithin(deltas[annotated].annotations, streamed);
+    });
 
+    it('should not add annotations for other models', async () => {
       const res = await app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(invalidRequest),
+        body: JSON.stringify({ model: 'echo', messages: [{ role: 'user', content }] }),
       });
-
-      expect(res.status).toBe(400);
       const data = await res.json();
-      expect(data.error.type).toBe('invalid_request_error');
-      expect(data.error.param).toBe('messages');
+
+      expect(data.choices[0].message).not.toHaveProperty('annotations');
     });
   });
 
-  describe('Echo Model Behavior', () => {
-    it('should echo the last user message', async () => {
-      const request: ChatCompletionRequest = {
-        model: 'echo',
-        messages: [
-          { role: 'system', content: 'You are a helpful assistant.' },
-          { role: 'user', content: 'First message' },
-          { role: 'assistant', content: 'First response' },
-          { role: 'user', content: 'Second message' },
-        ],
-      };
-
-      const res = await app.request('/v1/chat/completions', {
+  describe('Streaming Support', () => {
+    const complete = (model: string, stream: boolean) =>
+      app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(request),
+        body: JSON.stringify({
+          model,
+          messages: [{ role: 'user', content: 'hello' }],
+          stream,
+        }),
       });
 
-      expect(res.status).toBe(200);
+    it('should reject streaming requests to a non-streaming model', async () => {
+      const res = await complete('embedding', true);
       const data = await res.json();
-      expect(data.choices[0].message.content).toBe('Second message');
+
+      expect(res.status).toBe(400);
+      expect(res.headers.get('content-type')).toContain('application/json');
+      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.param).toBe('stream');
+      expect(data.error.message).toContain('embedding does not support streaming');
     });
 
-    it('should provide default response when no user messages', async () => {
-      const request: ChatCompletionRequest = {
-        model: 'echo',
-        messages: [
-          { role: 'system', content: 'You are a helpful assistant.' },
-        ],
-      };
+    it('should answer non-streaming requests to a non-streaming model', async () => {
+      const res = await complete('embedding', false);
+      const data = await res.json();
 
-      const res = await app.request('/v1/chat/completions', {
+      expect(res.status).toBe(200);
+      expect(JSON.parse(data.choices[0].message.content)).toHaveLength(8);
+    });
+
+    it('should still stream from models that support it', async () => {
+      const res = await complete('echo', true);
+
+      expect(res.status).toBe(200);
+      expect(res.headers.get('content-type')).toContain('text/event-stream');
+    });
+  });
+
+  describe('Latency Echo Model', () => {
+    const PHASES = ['auth', 'parse', 'model', 'write'];
+
+    const request = (body: Record<string, unknown>) =>
+      app.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify(request),
+        body: JSON.stringify({
+          model: 'latency-echo',
+          messages: [{ role: 'user', content: 'time me' }],
+          ...body,
+        }),
       });
 
+    it('should return every phase, summing to less than the request took', async () => {
+      const before = Date.now();
+      const res = await request({ response_format: { type: 'json_object' } });
+      const data = await res.json();
+      const duration = Date.now() - before;
+
       expect(res.status).toBe(200);
+      const timings = JSON.parse(data.choices[0].message.content);
+      expect(timings.echo).toBe('time me');
+      expect(Object.keys(timings.phases_ms)).toEqual(PHASES);
+      const total = PHASES.reduce((sum, phase) => sum + timings.phases_ms[phase], 0);
+      expect(timings.phases_ms.parse).toBeGreaterThan(0);
+      expect(timings.phases_ms.model).toBeGreaterThan(0);
+      expect(total).toBeLessThanOrEqual(timings.elapsed_ms);
+      expect(timings.elapsed_ms).toBeLessThanOrEqual(duration + 1);
+      expect(Date.parse(timings.arrived_at)).toBeGreaterThanOrEqual(before);
+    });
+
+    it('should append readable timings to the echo', async () => {
+      const res = await request({});
       const data = await res.json();
-      expect(data.choices[0].message.content).toContain('Echo model');
+
+      expect(data.choices[0].message.content).toMatch(
+        /^time me\n\nServer timing: auth [\d.]+ms, parse [\d.]+ms, model [\d.]+ms, write [\d.]+ms \(arrived .+Z\)$/,
+      );
+    });
+
+    it('should count earlier chunk writes when streaming', async () => {
+      const res = await request({ stream: true });
+      const body = await res.text();
+
+      const content = body
+        .split('\n\n')
+        .filter(e => e.startsWith('data: ') && e !== 'data: [DONE]')
+        .map(e => JSON.parse(e.slice(6)).choices[0].delta.content ?? '')
+        .join('');
+      const write = content.match(/write ([\d.]+)ms/);
+      expect(content.startsWith('time me\n\nServer timing: ')).toBe(true);
+      expect(Number(write![1])).toBeGreaterThan(0);
     });
   });
 
-  describe('CORS', () => {
-    it('should handle OPTIONS requests', async () => {
+  describe('Latency Model', () => {
+    it('should reply with measured parse and generate durations', async () => {
+      const before = Date.now();
       const res = await app.request('/v1/chat/completions', {
-        method: 'OPTIONS',
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'latency', messages: [{ role: 'user', content: 'How fast are you?' }] }),
       });
+      const duration = Date.now() - before;
 
       expect(res.status).toBe(200);
-      expect(res.headers.get('access-control-allow-origin')).toBe('*');
-      expect(res.headers.get('access-control-allow-methods')).toContain('POST');
-      expect(res.headers.get('access-control-allow-headers')).toContain('Authorization');
+      const timings = JSON.parse((await res.json()).choices[0].message.content);
+      expect(Object.keys(timings)).toEqual(['arrived_at', 'auth_ms', 'parse_ms', 'generate_ms', 'elapsed_ms']);
+      expect(timings.parse_ms).toBeGreaterThan(0);
+      expect(timings.generate_ms).toBeGreaterThan(0);
+      expect(timings.auth_ms + timings.parse_ms + timings.generate_ms).toBeLessThanOrEqual(timings.elapsed_ms);
+      expect(timings.elapsed_ms).toBeLessThanOrEqual(duration + 1);
     });
   });
 
-  describe('Error Handling', () => {
-    it('should handle 404 for unknown routes', async () => {
-      const res = await app.request('/unknown-route', {
+  describe('SSE Torture Model', () => {
+    const torture = async (content: string) => {
+      const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
+          'Content-Type': 'application/json',
         },
+        body: JSON.stringify({
+          model: 'sse-torture',
+          messages: [{ role: 'user', content }],
+          stream: true,
+        }),
       });
+      expect(res.status).toBe(200);
+      return res.text();
+    };
 
-      expect(res.status).toBe(404);
-      const data = await res.json();
-      expect(data.error.type).toBe('not_found_error');
+    const reassemble = (body: string) =>
+      parseSSEData(body)
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0].delta.content ?? '')
+        .join('');
+
+    it.each([
+      ['crlf', (body: string) => expect(body).toMatch(/^data: \{.*\}\r\n\r\n/)],
+      ['cr', (body: string) => expect(body).toMatch(/^data: \{.*\}\r\r/)],
+      ['multiline', (body: string) => expect(body).toMatch(/^data: \{\ndata:  "id": /)],
+      ['comments', (body: string) => expect(body).toMatch(/^: before\ndata: \{.*\}\n: inside\n\n/)],
+      ['fields', (body: string) => expect(body).toMatch(/^id: 1\nretry: 1000\ndata: \{/)],
+      ['nospace', (body: string) => expect(body).toMatch(/^data:\{/)],
+      ['bom', (body: string) => expect(body.startsWith('\uFEFFdata: {')).toBe(true)],
+    ])('should produce the %s variant and reassemble exactly', async (variant, check) => {
+      const content = `${variant} framing keeps héllo 👋 intact`;
+
+      const body = await torture(content);
+
+      check(body);
+      expect(reassemble(body)).toBe(content);
+    });
+
+    it('should rotate through every variant when none is named', async () => {
+      const content = 'one two three four five six seven eight nine ten';
+
+      const body = await torture(content);
+
+      expect(body).toContain('\r\n\r\n');
+      expect(body).toContain(': inside');
+      expect(body).toContain('retry: 1000');
+      expect(reassemble(body)).toBe(content);
     });
+  });
 
-    it('should handle malformed JSON', async () => {
+  describe('UTF-8 Split Model', () => {
+    it('should split a multibyte character across reads yet reassemble to valid UTF-8', async () => {
+      const content = 'crème brûlée 🍮 世界';
       const res = await app.request('/v1/chat/completions', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${testAPIKey}`, 'Content-Type': 'application/json' },
+        body: JSON.stringify({ model: 'utf8-split', messages: [{ role: 'user', content }], stream: true }),
+      });
+      expect(res.status).toBe(200);
+
+      const reads: Uint8Array[] = [];
+      const reader = res.body!.getReader();
+      for (let read = await reader.read(); !read.done; read = await reader.read()) {
+        reads.push(read.value);
+      }
+
+      // Decoding each read on its own garbles the split characters...
+      const naive = reads.map((bytes) => new TextDecoder().decode(bytes)).join('');
+      expect(naive).toContain('�');
+      const strict = new TextDecoder('utf-8', { fatal: true });
+      expect(reads.some((bytes) => {
+        try {
+          strict.decode(bytes);
+          return false;
+        } catch {
+          return true;
+        }
+      })).toBe(true);
+
+      // ...while buffering across reads recovers the content exactly
+      const buffered = new TextDecoder('utf-8', { fatal: true });
+      const body = reads.map((bytes) => buffered.decode(bytes, { stream: true })).join('') + buffered.decode();
+      const reassembled = parseSSEData(body)
+        .filter((data) => data !== '[DONE]')
+        .map((data) => JSON.parse(data).choices[0].delta.content ?? '')
+        .join('');
+      expect(reassembled).toBe(content);
+    });
+  });
+
+  describe('Array Content', () => {
+    const arrayContentRequest = {
+      model: 'echo',
+      messages: [
+        {
+          role: 'user',
+          content: [
+            { type: 'text', text: 'Hello, ' },
+            { type: 'image_url', image_url: { url: 'https://example.com/cat.png' } },
+            { type: 'text', text: 'parts!' },
+          ],
+        },
+      ],
+    };
+
+    const complete = (target: ReturnType<typeof createApp>, body: unknown) =>
+      target.request('/v1/chat/completions', {
         method: 'POST',
         headers: {
           'Authorization': `Bearer ${testAPIKey}`,
           'Content-Type': 'application/json',
         },
-        body: 'invalid json',
+        body: JSON.stringify(body),
+      });
+
+    it('should accept array content and reply with a string by default', async () => {
+      const res = await complete(app, arrayContentRequest);
+
+      expect(res.status).toBe(200);
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('Hello, parts!');
+    });
+
+    it('should mirror array content as output_text parts when enabled', async () => {
+      const mirroringApp = createApp({ auth: { apiKey: testAPIKey }, mirrorArrayContent: true });
+
+      const res = await complete(mirroringApp, arrayContentRequest);
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toEqual([
+        { type: 'output_text', text: 'Hello, parts!' },
+      ]);
+    });
+
+    it('should keep string content as a string when mirroring is enabled', async () => {
+      const mirroringApp = createApp({ auth: { apiKey: testAPIKey }, mirrorArrayContent: true });
+
+      const res = await complete(mirroringApp, {
+        model: 'echo',
+        messages: [{ role: 'user', content: 'Plain' }],
+      });
+
+      const data = await res.json();
+      expect(data.choices[0].message.content).toBe('Plain');
+    });
+
+    it('should reject malformed content parts', async () => {
+      const res = await complete(app, {
+        model: 'echo',
+        messages: [{ role: 'user', content: [{ type: 'audio' }] }],
       });
 
       expect(res.status).toBe(400);
       const data = await res.json();
-      expect(data.error.type).toBe('invalid_request_error');
+      expect(data.error.param).toBe('messages');
     });
   });
+
+  describe('Conformance Suite', () => {
+    for (const check of CHECKS) {
+      it(`should pass the ${check.name} check`, async () => {
+        await check.run({
+          baseUrl: 'http://localhost',
+          apiKey: testAPIKey,
+          fetch: (input, init) => app.request(input, init),
+        });
+      });
+    }
+  });
 });
\ No newline at end of file
@@ -5,7 +5,10 @@
  * removing boilerplate around async generators and chunk handling.
  */
 
-import { Model } from '../src/models/model.js';
+import { request as httpRequest } from 'http';
+import { Model, ModelContext } from '../src/models/model.js';
+import { createServer } from '../src/teenytiny.js';
+import type { AppConfig, ListeningGroup, ListenOptions, ServerStats, TeenyTinyServer } from '../src/teenytiny.js';
 
 /**
  * Extract the response text from a model's process method
@@ -15,6 +18,7 @@ import { Model } from '../src/models/model.js';
  * 
  * @param model - The model to test
  * @param input - The input text to process
+ * @param context - Optional request context (conversation, tools)
  * @returns Promise resolving to the complete response text
  * 
  * @example
@@ -32,10 +36,10 @@ import { Model } from '../src/models/model.js';
  * expect(response).toBe('Hello there!');
  * ```
  */
-export async function getResponse(model: Model, input: string): Promise<string> {
+export async function getResponse(model: Model, input: string, context?: ModelContext): Promise<string> {
   const chunks: string[] = [];
   
-  for await (const chunk of model.process(input)) {
+  for await (const chunk of model.process(input, context)) {
     chunks.push(chunk);
   }
   
@@ -50,6 +54,7 @@ export async function getResponse(model: Model, input: string): Promise<string>
  * 
  * @param model - The model to test  
  * @param input - The input text to process
+ * @param context - Optional request context (conversation, tools)
  * @returns Promise resolving to array of response chunks
  * 
  * @example
@@ -63,13 +68,122 @@ export async function getResponse(model: Model, input: string): Promise<string>
  * expect(chunks).toHaveLength(1);
  * ```
  */
-export async function getChunks(model: Model, input: string): Promise<string[]> {
+export async function getChunks(model: Model, input: string, context?: ModelContext): Promise<string[]> {
   const chunks: string[] = [];
   
-  for await (const chunk of model.process(input)) {
+  for await (const chunk of model.process(input, context)) {
     chunks.push(chunk);
   }
   
   return chunks;
 }
 
+
+/**
+ * A server listening on real sockets, for tests that go over the network
+ *
+ * Every listener serves the same app, so they share sessions, quotas and
+ * counters. Requests to unix socket listeners go through Node's http module,
+ * since fetch can't reach them.
+ *
+ * @example
+ * ```typescript
+ * const server = await TestServer.start(config, [{ port: 0, hostname: '127.0.0.1' }, { path: socketPath }]);
+ * for (const baseUrl of server.baseUrls) {
+ *   const res = await server.request(baseUrl, '/health');
+ *   expect(res.status).toBe(200);
+ * }
+ * await server.close();
+ * ```
+ */
+export class TestServer {
+  private constructor(
+    readonly server: TeenyTinyServer,
+    private listening: ListeningGroup
+  ) {}
+
+  static async start(
+    config: AppConfig,
+    listen: ListenOptions[] = [{ port: 0, hostname: '127.0.0.1' }]
+  ): Promise<TestServer> {
+    const server = createServer(config);
+    return new TestServer(server, await server.listenAll(listen));
+  }
+
+  // One per listener, e.g. http://127.0.0.1:53124 or unix:/tmp/tt.sock
+  get baseUrls(): string[] {
+    return this.listening.servers.map((listening) => listening.url);
+  }
+
+  // The server's aggregates, e.g. request size histograms, to assert on
+  // without going through /admin
+  stats(): ServerStats {
+    return this.server.stats();
+  }
+
+  async request(baseUrl: string, path: string, init: RequestInit = {}): Promise<Response> {
+    if (!baseUrl.startsWith('unix:')) {
+      return fetch(`${baseUrl}${path}`, init);
+    }
+
+    const body = init.body === undefined || init.body === null ? undefined : String(init.body);
+    return new Promise((resolve, reject) => {
+      const req = httpRequest(
+        {
+          socketPath: baseUrl.slice('unix:'.length),
+          path,
+          method: init.method ?? 'GET',
+          headers: Object.fromEntries(new Headers(init.headers)),
+        },
+        (res) => {
+          const chunks: Buffer[] = [];
+          res.on('data', (chunk: Buffer) => chunks.push(chunk));
+          res.on('error', reject);
+          res.on('end', () => {
+            const headers = new Headers();
+            for (const [name, value] of Object.entries(res.headers)) {
+              for (const item of [value ?? []].flat()) {
+                headers.append(name, item);
+              }
+            }
+            resolve(new Response(Buffer.concat(chunks), { status: res.statusCode ?? 500, headers }));
+          });
+        }
+      );
+      req.on('error', reject);
+      req.end(body);
+    });
+  }
+
+  close(): Promise<void> {
+    return this.listening.close();
+  }
+}
+
+/**
+ * Bytes of JS heap and ArrayBuffers in use, for tests and benchmarks of
+ * memory use. Call collectGarbage() first to leave out what's unreachable.
+ */
+export function memoryInUse(): number {
+  const { heapUsed, arrayBuffers } = process.memoryUsage();
+  return heapUsed + arrayBuffers;
+}
+
+// Whether collectGarbage() can run: node needs --expose-gc, which the
+// vitest config passes to its workers
+export const canCollectGarbage = typeof globalThis.gc === 'function';
+
+// A full garbage collection
+export function collectGarbage(): void {
+  if (!globalThis.gc) {
+    throw new Error('Collecting garbage needs node --expose-gc');
+  }
+  globalThis.gc();
+}
+
+// A chat completion request body of about the given size, in 1KB messages
+export function largeConversationBody(bytes: number): string {
+  const content = 'x'.repeat(1024);
+  const messages = Array.from({ length: Math.ceil(bytes / 1024) }, () => ({ role: 'user', content }));
+  return JSON.stringify({ model: 'echo', messages });
+}
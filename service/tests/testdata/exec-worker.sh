@@ -0,0 +1,22 @@
+#!/usr/bin/env bash
+# Pooled exec model test worker: speaks the length-prefixed protocol on
+# stdin/stdout ("<byte length>\n<bytes>" each way) and echoes each request
+# prefixed with its process ID, so tests can tell workers apart.
+#
+# Special requests: "crash" exits without replying, "sleep" never replies.
+export LC_ALL=C
+
+while read -r length; do
+  payload=''
+  if [ "$length" -gt 0 ]; then
+    read -r -N "$length" payload || exit 0
+  fi
+
+  case "$payload" in
+    crash) exit 1 ;;
+    sleep) sleep 10 ;;
+  esac
+
+  reply="$$: $payload"
+  printf '%s\n%s' "${#reply}" "$reply"
+done
@@ -5,5 +5,9 @@ export default defineConfig({
     environment: 'node',
     globals: true,
     setupFiles: ['./tests/setup.ts'],
+    // Memory benchmarks and soak tests collect garbage between measurements
+    poolOptions: {
+      forks: { execArgv: ['--expose-gc'] },
+    },
   },
 });
\ No newline at end of file
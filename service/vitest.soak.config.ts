@@ -0,0 +1,12 @@
+import { defineConfig, mergeConfig } from 'vitest/config';
+import base from './vitest.config';
+
+// Long-running memory tests, kept out of `npm test`; run with: npm run soak
+export default mergeConfig(
+  base,
+  defineConfig({
+    test: {
+      include: ['src/**/*.soak.ts'],
+    },
+  })
+);